@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+const adoptUsage = "usage: lokt adopt <name> --token <lock_id> [--pid N]"
+
+// cmdAdopt hands a lock taken with lock --handoff to the process that is to
+// hold it, by default lokt's parent: a systemd ExecStart that runs
+// `lokt adopt ... && exec daemon` passes the lock on to the daemon.
+func cmdAdopt(args []string) int {
+	// Reorder args so "lokt adopt svc --token t" parses --token.
+	var flags, pos []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case (a == "--token" || a == "-token" || a == "--pid" || a == "-pid") && i+1 < len(args):
+			flags = append(flags, a, args[i+1])
+			i++
+		case len(a) > 0 && a[0] == '-':
+			flags = append(flags, a)
+		default:
+			pos = append(pos, a)
+		}
+	}
+
+	fs := flag.NewFlagSet("adopt", flag.ContinueOnError)
+	token := fs.String("token", "", "The lock_id lock --handoff printed")
+	pid := fs.Int("pid", os.Getppid(), "Process to hold the lock (default: the one running lokt adopt)")
+	if err := fs.Parse(append(flags, pos...)); err != nil || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, adoptUsage)
+		return ExitUsage
+	}
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "error: --token is required (the lock_id lock --handoff printed)")
+		return ExitUsage
+	}
+	if *pid <= 0 {
+		fmt.Fprintln(os.Stderr, "error: --pid must be a positive process ID")
+		return ExitUsage
+	}
+	name := fs.Arg(0)
+
+	rootDir, err := root.Find()
+	if err != nil {
+		reportError(name, err, "")
+		return ExitError
+	}
+	if code := checkWritable(rootDir, name); code != ExitOK {
+		return code
+	}
+
+	_, err = lock.Adopt(rootDir, name, *token, lock.AdoptOptions{Auditor: newAuditor(rootDir), PID: *pid})
+	var mismatch *lock.TokenMismatchError
+	switch {
+	case err == nil:
+		fmt.Printf("adopted lock %q for pid %d\n", name, *pid)
+		return ExitOK
+	case errors.Is(err, lock.ErrNotFound):
+		reportError(name, err, "")
+		return ExitNotFound
+	case errors.As(err, &mismatch):
+		reportError(name, err, "")
+		return ExitNotOwner
+	}
+	reportError(name, err, "")
+	return ExitError
+}
+
+// handoffToken returns the lock_id of name, just acquired with --handoff,
+// for the process adopting it to prove it was handed this acquisition.
+func handoffToken(rootDir, name string) (string, error) {
+	lf, err := lockfile.Read(root.LockFilePath(rootDir, name))
+	if err != nil {
+		return "", err
+	}
+	if lf.LockID == "" {
+		return "", errors.New("lock has no lock_id to hand off")
+	}
+	return lf.LockID, nil
+}
+
+// printHandoff prints name's handoff token on stdout, alone so that
+// TOKEN=$(lokt lock --handoff name) captures it, and how to use it on
+// stderr; with jsonOutput, as lock_id in the acquire JSON.
+func printHandoff(rootDir, name string, jsonOutput bool) int {
+	token, err := handoffToken(rootDir, name)
+	if err != nil {
+		reportError(name, err, fmt.Sprintf("error: read back handed-off lock: %v", err))
+		return ExitError
+	}
+	if jsonOutput {
+		data, _ := json.MarshalIndent(lockAcquireOutput{Status: "acquired", Name: name, LockID: token}, "", "  ")
+		fmt.Println(string(data))
+		return ExitOK
+	}
+	fmt.Println(token)
+	fmt.Fprintf(os.Stderr, "acquired lock %q for handoff; adopt it with: lokt adopt %s --token %s\n", name, name, token)
+	return ExitOK
+}
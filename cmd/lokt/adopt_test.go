@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestLockHandoffAdopt(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	daemon := exec.Command("sleep", "30")
+	if err := daemon.Start(); err != nil {
+		t.Skipf("can't start a process to adopt the lock: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = daemon.Process.Kill()
+		_ = daemon.Wait()
+	})
+	pid := strconv.Itoa(daemon.Process.Pid)
+
+	stdout, stderr, code := captureCmd(cmdLock, []string{"svc", "--handoff"})
+	token := strings.TrimSpace(stdout)
+	if code != ExitOK || len(token) != 32 || !strings.Contains(stderr, "lokt adopt svc --token "+token) {
+		t.Fatalf("lock --handoff: exit %d, stdout %q, stderr %q; want the lock_id alone on stdout", code, stdout, stderr)
+	}
+
+	if _, _, code := captureCmd(cmdAdopt, []string{"svc", "--token", "wrong", "--pid", pid}); code != ExitNotOwner {
+		t.Errorf("wrong token: exit %d, want %d", code, ExitNotOwner)
+	}
+	if _, _, code := captureCmd(cmdAdopt, []string{"missing", "--token", token, "--pid", pid}); code != ExitNotFound {
+		t.Errorf("missing lock: exit %d, want %d", code, ExitNotFound)
+	}
+	stdout, stderr, code = captureCmd(cmdAdopt, []string{"svc", "--token", token, "--pid", pid})
+	if code != ExitOK || !strings.Contains(stdout, "adopted lock \"svc\" for pid "+pid) {
+		t.Fatalf("adopt: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	lf, err := lockfile.Read(filepath.Join(locksDir, "svc.json"))
+	if err != nil || strconv.Itoa(lf.PID) != pid || lf.Retained || lf.LockID != token {
+		t.Errorf("lock file after adopt: %+v, %v", lf, err)
+	}
+}
+
+func TestLockHandoff_JSONAndUsage(t *testing.T) {
+	setupTestRoot(t)
+	stdout, _, code := captureCmd(cmdLock, []string{"--handoff", "--json", "svc"})
+	var out lockAcquireOutput
+	if err := json.Unmarshal([]byte(stdout), &out); code != ExitOK || err != nil || out.LockID == "" {
+		t.Errorf("lock --handoff --json: exit %d, %s (%v); want lock_id", code, stdout, err)
+	}
+
+	for _, args := range [][]string{{"--handoff", "--shared", "a"}, {"--handoff", "a", "b"}} {
+		if _, _, code := captureCmd(cmdLock, args); code != ExitUsage {
+			t.Errorf("lock %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+	for _, args := range [][]string{nil, {"svc"}, {"svc", "--token", "x", "--pid", "0"}} {
+		if _, _, code := captureCmd(cmdAdopt, args); code != ExitUsage {
+			t.Errorf("adopt %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
 )
 
 func TestCmdAudit_NoFlags(t *testing.T) {
@@ -21,15 +23,15 @@ func TestCmdAudit_NoFlags(t *testing.T) {
 	}
 }
 
-func TestCmdAudit_SinceAndTailMutuallyExclusive(t *testing.T) {
+func TestCmdAudit_TailInvalidSince(t *testing.T) {
 	setupTestRoot(t)
 
-	_, stderr, code := captureCmd(cmdAudit, []string{"--since", "1h", "--tail"})
+	_, stderr, code := captureCmd(cmdAudit, []string{"--since", "yesterday", "--tail"})
 	if code != ExitUsage {
 		t.Errorf("expected exit %d, got %d", ExitUsage, code)
 	}
-	if !strings.Contains(stderr, "mutually exclusive") {
-		t.Errorf("expected mutual exclusion error, got: %s", stderr)
+	if !strings.Contains(stderr, "invalid --since") {
+		t.Errorf("expected invalid --since error, got: %s", stderr)
 	}
 }
 
@@ -73,7 +75,7 @@ func TestCmdAudit_SinceDuration_FiltersEvents(t *testing.T) {
 	}
 
 	// Write old event (2 hours ago)
-	oldEvent := auditEvent{
+	oldEvent := audit.Event{
 		Timestamp: time.Now().Add(-2 * time.Hour),
 		Event:     "acquire",
 		Name:      "old-lock",
@@ -85,7 +87,7 @@ func TestCmdAudit_SinceDuration_FiltersEvents(t *testing.T) {
 	_, _ = f.Write(append(data, '\n'))
 
 	// Write recent event (5 minutes ago)
-	recentEvent := auditEvent{
+	recentEvent := audit.Event{
 		Timestamp: time.Now().Add(-5 * time.Minute),
 		Event:     "release",
 		Name:      "recent-lock",
@@ -120,7 +122,7 @@ func TestCmdAudit_SinceTimestamp(t *testing.T) {
 	}
 
 	now := time.Now()
-	event := auditEvent{
+	event := audit.Event{
 		Timestamp: now,
 		Event:     "acquire",
 		Name:      "ts-lock",
@@ -153,7 +155,7 @@ func TestCmdAudit_SinceWithNameFilter(t *testing.T) {
 	}
 
 	now := time.Now()
-	events := []auditEvent{
+	events := []audit.Event{
 		{Timestamp: now, Event: "acquire", Name: "wanted", Owner: "a", Host: "h", PID: 1},
 		{Timestamp: now, Event: "acquire", Name: "unwanted", Owner: "b", Host: "h", PID: 2},
 	}
@@ -175,6 +177,66 @@ func TestCmdAudit_SinceWithNameFilter(t *testing.T) {
 	}
 }
 
+func TestCmdAudit_EventOwnerFiltersAndJSON(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	ts := time.Now().UTC().Format(time.RFC3339)
+	writeAuditEvents(t, rootDir,
+		map[string]any{"ts": ts, "event": "acquire", "name": "build", "owner": "alice", "pid": 1},
+		map[string]any{"ts": ts, "event": "deny", "name": "build", "owner": "bob", "pid": 2},
+		map[string]any{"ts": ts, "event": "force-break", "name": "deploy", "owner": "bob", "pid": 3},
+		map[string]any{"ts": ts, "event": "deny", "name": "deploy", "owner": "carol", "pid": 4},
+	)
+
+	stdout, stderr, code := captureCmd(cmdAudit, []string{"--since", "1h", "--event", "force-break,deny", "--owner", "bob", "--json"})
+	if code != ExitOK {
+		t.Fatalf("exit %d (stderr %q)", code, stderr)
+	}
+	var got []audit.Event
+	if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+		t.Fatalf("--json output is not a JSON array: %v\n%s", err, stdout)
+	}
+	if len(got) != 2 || got[0].PID != 2 || got[1].PID != 3 {
+		t.Errorf("events = %+v, want bob's deny and force-break", got)
+	}
+
+	stdout, _, _ = captureCmd(cmdAudit, []string{"--since", "1h", "--event", "release", "--format", "json"})
+	if strings.TrimSpace(stdout) != "[]" {
+		t.Errorf("no matches = %q, want []", stdout)
+	}
+}
+
+func TestCmdAudit_FormatTable(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	writeAuditEvents(t, rootDir, map[string]any{
+		"ts": time.Now().UTC().Format(time.RFC3339), "event": "acquire", "name": "build", "owner": "alice", "pid": 42,
+		"ttl_sec": 300, "extra": map[string]any{"wait_ms": 1500000, "mode": "shared"},
+	})
+
+	stdout, stderr, code := captureCmd(cmdAudit, []string{"--since", "1h", "--format", "table"})
+	if code != ExitOK {
+		t.Fatalf("exit %d (stderr %q)", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "TIME") {
+		t.Fatalf("table = %q, want header and one row", stdout)
+	}
+	for _, want := range []string{"acquire", "build", "alice", "42", "ttl=5m0s mode=shared wait_ms=1500000"} {
+		if !strings.Contains(lines[1], want) {
+			t.Errorf("row %q missing %q", lines[1], want)
+		}
+	}
+}
+
+func TestCmdAudit_FormatUsage(t *testing.T) {
+	setupTestRoot(t)
+	if _, _, code := captureCmd(cmdAudit, []string{"--since", "1h", "--format", "xml"}); code != ExitUsage {
+		t.Errorf("--format xml: exit %d, want %d", code, ExitUsage)
+	}
+	if _, _, code := captureCmd(cmdAudit, []string{"--since", "1h", "--format", "table", "--json"}); code != ExitUsage {
+		t.Errorf("--format table --json: exit %d, want %d", code, ExitUsage)
+	}
+}
+
 func TestCmdAudit_NoAuditLog(t *testing.T) {
 	setupTestRoot(t) // no audit.log created
 
@@ -195,7 +257,7 @@ func TestCmdAudit_MalformedLines(t *testing.T) {
 
 	// Malformed line followed by valid event
 	_, _ = f.WriteString("not valid json at all\n")
-	event := auditEvent{
+	event := audit.Event{
 		Timestamp: time.Now(),
 		Event:     "acquire",
 		Name:      "valid-lock",
@@ -246,3 +308,63 @@ func TestParseSince_Invalid(t *testing.T) {
 		t.Error("expected error for invalid input")
 	}
 }
+
+func TestCmdAudit_ReadsRotatedFiles(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	if err := os.WriteFile(filepath.Join(rootDir, "config.json"), []byte(`{"audit": {"max_size": 1, "keep": 3}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Each event rotates the log, leaving one event per rotated file.
+	for _, name := range []string{"first", "second", "third"} {
+		if _, _, code := captureCmd(cmdLock, []string{name}); code != ExitOK {
+			t.Fatalf("lock %s: exit %d", name, code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "audit.log.3")); err != nil {
+		t.Fatalf("expected audit.log.3 after rotation: %v", err)
+	}
+
+	stdout, _, code := captureCmd(cmdAudit, []string{"--since", "1h"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"first"`) || !strings.Contains(lines[2], `"third"`) {
+		t.Errorf("expected the three events oldest first, got: %s", stdout)
+	}
+}
+
+func TestCmdAudit_Prune(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	for _, name := range []string{"audit.log.2.gz", "audit.log.1", "audit.log"} {
+		path := filepath.Join(rootDir, name)
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if name != "audit.log.1" {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	stdout, stderr, code := captureCmd(cmdAudit, []string{"--prune", "--keep", "30d"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d (stderr %q)", ExitOK, code, stderr)
+	}
+	if strings.TrimSpace(stdout) != "removed audit.log.2.gz" {
+		t.Errorf("stdout = %q, want only the old rotated file removed", stdout)
+	}
+	for name, wantKept := range map[string]bool{"audit.log.2.gz": false, "audit.log.1": true, "audit.log": true} {
+		if _, err := os.Stat(filepath.Join(rootDir, name)); (err == nil) != wantKept {
+			t.Errorf("%s: kept = %v, want %v", name, err == nil, wantKept)
+		}
+	}
+
+	for _, args := range [][]string{{"--prune"}, {"--keep", "30d"}, {"--prune", "--keep", "soon"}, {"--prune", "--keep", "30d", "--since", "1h"}} {
+		if _, _, code := captureCmd(cmdAudit, args); code != ExitUsage {
+			t.Errorf("audit %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
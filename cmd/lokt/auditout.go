@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+)
+
+// Output formats of lokt audit.
+const (
+	auditFormatJSONL = "jsonl" // log lines as stored (default)
+	auditFormatTable = "table" // aligned columns for people
+	auditFormatJSON  = "json"  // one JSON array of all matching events
+)
+
+// auditFormats are the values --format accepts, for usage and completion.
+var auditFormats = []string{auditFormatJSONL, auditFormatTable, auditFormatJSON}
+
+// auditEvents are the event types --event can filter on.
+var auditEvents = []string{
+	audit.EventAcquire, audit.EventDeny, audit.EventRelease, audit.EventForceBreak,
+	audit.EventStaleBreak, audit.EventAutoPrune, audit.EventCorruptBreak, audit.EventRenew,
+	audit.EventFreeze, audit.EventUnfreeze, audit.EventForceUnfreeze, audit.EventFreezeDeny,
+	audit.EventThawWait, audit.EventSeqReset, audit.EventRelocate, audit.EventClockGap,
+	audit.EventGC, audit.EventRetain, audit.EventDeadlock, audit.EventLockLost,
+	audit.EventSkip, audit.EventFreezeMigrate, audit.EventWaitTimeout, audit.EventImport,
+	audit.EventLockVanished, audit.EventTakeover, audit.EventAdopt, audit.EventGuardStart,
+	audit.EventGuardEnd, audit.EventLostSuspend, audit.EventReserve, audit.EventUnreserve,
+	audit.EventForceUnreserve, audit.EventReserveDeny,
+}
+
+// auditFilter selects the events lokt audit prints. Empty lists match
+// everything; each list matches any of its values.
+type auditFilter struct {
+	since  time.Time
+	names  []string
+	events []string
+	owners []string
+}
+
+// match reports whether e passes every filter.
+func (f auditFilter) match(e *audit.Event) bool {
+	return !e.Timestamp.Before(f.since) &&
+		matchAny(f.names, e.Name) && matchAny(f.events, e.Event) && matchAny(f.owners, e.Owner)
+}
+
+func matchAny(values []string, v string) bool {
+	return len(values) == 0 || slices.Contains(values, v)
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// auditPrinter writes matching events in one of the audit formats. JSON
+// output is collected and written by finish; the others stream, so they
+// also suit --tail.
+type auditPrinter struct {
+	w       io.Writer
+	format  string
+	started bool
+	events  []json.RawMessage
+}
+
+// print writes one event; line is its log line.
+func (p *auditPrinter) print(e *audit.Event, line []byte) {
+	switch p.format {
+	case auditFormatJSON:
+		p.events = append(p.events, json.RawMessage(slices.Clone(line)))
+	case auditFormatTable:
+		if !p.started {
+			fmt.Fprintf(p.w, "%-19s  %-14s  %-20s  %-16s  %7s  %s\n", "TIME", "EVENT", "NAME", "OWNER", "PID", "DETAILS")
+		}
+		fmt.Fprintf(p.w, "%-19s  %-14s  %-20s  %-16s  %7d  %s\n",
+			e.Timestamp.Local().Format("2006-01-02 15:04:05"), e.Event, e.Name, e.Owner, e.PID, auditDetails(e))
+	default:
+		fmt.Fprintln(p.w, string(line))
+	}
+	p.started = true
+}
+
+// finish writes the JSON array; a no-op for streaming formats.
+func (p *auditPrinter) finish() {
+	if p.format != auditFormatJSON {
+		return
+	}
+	if p.events == nil {
+		p.events = []json.RawMessage{}
+	}
+	data, _ := json.MarshalIndent(p.events, "", "  ")
+	fmt.Fprintln(p.w, string(data))
+}
+
+// auditDetails summarizes the fields of e the table has no column for:
+// the TTL and the extra map, as sorted key=value pairs.
+func auditDetails(e *audit.Event) string {
+	var parts []string
+	if e.TTLSec > 0 {
+		parts = append(parts, "ttl="+(time.Duration(e.TTLSec)*time.Second).String())
+	}
+	keys := make([]string, 0, len(e.Extra))
+	for k := range e.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var v string
+		switch x := e.Extra[k].(type) {
+		case float64: // JSON numbers; avoid 1.5e+06
+			v = strconv.FormatFloat(x, 'f', -1, 64)
+		case string:
+			v = x
+		default:
+			data, _ := json.Marshal(x)
+			v = string(data)
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, " ")
+}
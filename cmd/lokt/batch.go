@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// batchResult is one NDJSON line of lock/unlock --batch --json output.
+// Holder fields are set for names that are held by someone else.
+type batchResult struct {
+	lockDenyOutput
+	Error string `json:"error,omitempty"`
+}
+
+// readBatchNames reads lock names, one per line, from stdin ("-") or a file.
+// Blank lines and #-comments are skipped. Every name is validated up front so
+// a typo fails the batch before anything is acquired.
+func readBatchNames(src string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if src != "-" {
+		f, err := os.Open(src) //nolint:gosec // G304: user-supplied batch file is intended
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := lockfile.ValidateName(line); err != nil {
+			return nil, err
+		}
+		names = append(names, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no lock names in batch input")
+	}
+	return names, nil
+}
+
+// parseLockList splits a comma-separated list of lock names, as given to
+// guard --locks, validating each and dropping duplicates.
+func parseLockList(list string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, n := range strings.Split(list, ",") {
+		n = strings.TrimSpace(n)
+		if seen[n] {
+			continue
+		}
+		if err := lockfile.ValidateName(n); err != nil {
+			return nil, err
+		}
+		seen[n] = true
+		names = append(names, n)
+	}
+	return names, nil
+}
+
+// firstHeld returns the first of names, in acquisition (sorted) order, held
+// by someone else: what a multi-lock acquisition is waiting for. It returns
+// names[0] if none is.
+func firstHeld(rootDir string, names []string) string {
+	sorted := slices.Sorted(slices.Values(names))
+	for _, n := range sorted {
+		if _, ok := heldBatchResult(rootDir, n, 0); ok {
+			return n
+		}
+	}
+	return names[0]
+}
+
+// lockBatch acquires all names via lock.AcquireMany and reports per-name
+// results. Exit code is ExitOK only if every name was acquired, ExitLockHeld
+// if any was held (all blockers are listed), exitFrozen() or exitTimeout()
+// if one was frozen or the wait timed out, ExitDeadlock if waiting for one
+// would deadlock, ExitError otherwise.
+func lockBatch(ctx context.Context, rootDir string, names []string, opts lock.AcquireOptions, wait, jsonOutput bool) int {
+	res, err := lock.AcquireMany(ctx, rootDir, names, opts, wait)
+
+	code := ExitOK
+	var held *lock.HeldError
+	var frozen *lock.FrozenError
+	switch {
+	case err == nil:
+	case errors.As(err, &held):
+		code = ExitLockHeld
+	case errors.Is(err, context.DeadlineExceeded):
+		code = exitTimeout()
+	case errors.As(err, &frozen):
+		code = exitFrozen()
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintln(os.Stderr, "interrupted")
+		code = ExitError
+	case errors.Is(err, lock.ErrDeadlock):
+		code = ExitDeadlock
+	default:
+		code = ExitError
+	}
+
+	rolledBack := make(map[string]bool, len(res.RolledBack))
+	for _, n := range res.RolledBack {
+		rolledBack[n] = true
+	}
+	failedSeen := false
+	for _, name := range res.Names {
+		var r batchResult
+		r.Name = name
+		switch {
+		case name == res.Failed:
+			failedSeen = true
+			r.Status = "error"
+			r.Error = err.Error()
+			if frozen != nil {
+				r.Status = "frozen" // with --respect-freeze
+				r.RetryAfterSec = int(frozen.RetryAfter.Seconds())
+			} else if held != nil || errors.Is(err, context.DeadlineExceeded) {
+				r.Status, r.Error = "held", ""
+				if blocker, ok := heldBatchResult(rootDir, name, opts.RetryAfterDefault); ok {
+					r = blocker
+				}
+			}
+		case rolledBack[name]:
+			r.Status = "rolled_back"
+		case failedSeen:
+			// Never attempted; still report it if someone else holds it,
+			// so the caller sees every blocker at once.
+			r.Status = "skipped"
+			if blocker, ok := heldBatchResult(rootDir, name, opts.RetryAfterDefault); ok {
+				r = blocker
+			}
+		case res.Failed != "":
+			// Already held by us before the batch; left untouched.
+			r.Status = "unchanged"
+		default:
+			r.Status = "acquired"
+		}
+		printBatchResult(r, jsonOutput)
+	}
+	return code
+}
+
+// heldBatchResult reads the current holder of name from disk, with a retry
+// hint computed from retryFallback. It returns false if the lock is free,
+// unreadable, or held by the caller (lock.SameHolder).
+func heldBatchResult(rootDir, name string, retryFallback time.Duration) (batchResult, bool) {
+	lf, err := lockfile.Read(root.LockFilePath(rootDir, name))
+	if err != nil || lock.SameHolder(lf, identity.Current()) {
+		return batchResult{}, false
+	}
+	out := denyOutputFromLock("held", name, lf)
+	out.RetryAfterSec = int(lock.RetryAfter(lf, retryFallback).Seconds())
+	return batchResult{lockDenyOutput: out}, true
+}
+
+// unlockBatch releases each name with opts, reporting not-found and
+// not-owner names individually and going on with the rest. Without strict
+// those do not fail the batch.
+func unlockBatch(rootDir string, names []string, opts lock.ReleaseOptions, strict, jsonOutput bool) int {
+	var anyErr, anyNotOwner, anyNotFound bool
+	for _, name := range names {
+		var r batchResult
+		r.Name = name
+		err := lock.Release(rootDir, name, opts)
+		var notOwner *lock.NotOwnerError
+		switch {
+		case err == nil:
+			r.Status = "released"
+		case errors.Is(err, lock.ErrNotFound):
+			anyNotFound = true
+			r.Status = "not_found"
+		case errors.As(err, &notOwner):
+			anyNotOwner = true
+			r.lockDenyOutput = denyOutputFromLock("not_owner", name, notOwner.Lock)
+		default:
+			anyErr = true
+			r.Status = "error"
+			r.Error = err.Error()
+		}
+		printBatchResult(r, jsonOutput)
+	}
+
+	switch {
+	case anyErr:
+		return ExitError
+	case strict && anyNotOwner:
+		return ExitNotOwner
+	case strict && anyNotFound:
+		return ExitNotFound
+	default:
+		return ExitOK
+	}
+}
+
+// prefixedLockNames returns the names of the locks in rootDir starting
+// with prefix, sorted. Legacy freeze files in locks/ aren't locks.
+func prefixedLockNames(rootDir, prefix string) ([]string, error) {
+	all, err := root.LockNames(rootDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var names []string
+	for _, name := range all {
+		if strings.HasPrefix(name, prefix) && !strings.HasPrefix(name, lock.FreezePrefix) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// printBatchResult prints one result as an NDJSON line, or as text with
+// successes on stdout and everything else on stderr.
+func printBatchResult(r batchResult, jsonOutput bool) {
+	if jsonOutput {
+		data, _ := json.Marshal(r)
+		fmt.Println(string(data))
+		return
+	}
+	switch r.Status {
+	case "acquired":
+		fmt.Printf("acquired lock %q\n", r.Name)
+	case "released":
+		fmt.Printf("released lock %q\n", r.Name)
+	case "unchanged":
+		fmt.Printf("kept lock %q (held before batch)\n", r.Name)
+	case "rolled_back":
+		fmt.Fprintf(os.Stderr, "rolled back lock %q\n", r.Name)
+	case "skipped":
+		fmt.Fprintf(os.Stderr, "skipped lock %q\n", r.Name)
+	case "not_found":
+		fmt.Fprintf(os.Stderr, "error: lock %q not found\n", r.Name)
+	case "held", "not_owner":
+		if r.HolderOwner == "" {
+			fmt.Fprintf(os.Stderr, "error: lock %q is held\n", r.Name)
+			return
+		}
+		age := time.Duration(r.HolderAgeSec) * time.Second
+		hint := ""
+		if r.RetryAfterSec > 0 {
+			hint = "; " + lock.FormatRetryAfter(time.Duration(r.RetryAfterSec)*time.Second)
+		}
+		fmt.Fprintf(os.Stderr, "error: lock %q held by %s@%s (pid %d) for %s%s\n",
+			r.Name, r.HolderOwner, r.HolderHost, r.HolderPID, age, hint)
+	default:
+		fmt.Fprintf(os.Stderr, "error: lock %q: %s\n", r.Name, r.Error)
+	}
+}
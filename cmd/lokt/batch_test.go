@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// withStdin replaces os.Stdin with a file containing input for the test.
+func withStdin(t *testing.T, input string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(path, []byte(input), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path) //nolint:gosec // test file
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdin
+	os.Stdin = f
+	t.Cleanup(func() {
+		os.Stdin = old
+		_ = f.Close()
+	})
+}
+
+func decodeBatchLines(t *testing.T, out string) []batchResult {
+	t.Helper()
+	var results []batchResult
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var r batchResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", line, err)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestLockBatch_AllAcquired(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	withStdin(t, "# fan-out set\nsvc-c\n\nsvc-a\nsvc-b\n")
+
+	stdout, _, code := captureCmd(cmdLock, []string{"--batch", "-", "--ttl", "5m", "--json"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	results := decodeBatchLines(t, stdout)
+	want := []string{"svc-a", "svc-b", "svc-c"}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), results)
+	}
+	for i, r := range results {
+		if r.Name != want[i] || r.Status != "acquired" {
+			t.Errorf("result[%d] = %s/%s, want %s/acquired", i, r.Name, r.Status, want[i])
+		}
+		lf, err := lockfile.Read(filepath.Join(locksDir, want[i]+".json"))
+		if err != nil {
+			t.Fatalf("lock %s not written: %v", want[i], err)
+		}
+		if lf.TTLSec != 300 {
+			t.Errorf("lock %s TTLSec = %d, want 300", want[i], lf.TTLSec)
+		}
+	}
+}
+
+func TestLockBatch_HeldRollsBackAndListsBlockers(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	for _, name := range []string{"svc-b", "svc-d"} {
+		writeLockJSON(t, locksDir, name+".json", &lockfile.Lock{
+			Version: 1, Name: name, Owner: "other-owner", Host: "other-host", PID: 1, AcquiredAt: time.Now(),
+		})
+	}
+	batchFile := filepath.Join(t.TempDir(), "names.txt")
+	if err := os.WriteFile(batchFile, []byte("svc-a\nsvc-b\nsvc-c\nsvc-d\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, code := captureCmd(cmdLock, []string{"--batch", batchFile, "--json"})
+	if code != ExitLockHeld {
+		t.Fatalf("expected exit %d, got %d", ExitLockHeld, code)
+	}
+	statuses := map[string]batchResult{}
+	for _, r := range decodeBatchLines(t, stdout) {
+		statuses[r.Name] = r
+	}
+	if statuses["svc-a"].Status != "rolled_back" {
+		t.Errorf("svc-a status = %q, want rolled_back", statuses["svc-a"].Status)
+	}
+	if statuses["svc-c"].Status != "skipped" {
+		t.Errorf("svc-c status = %q, want skipped", statuses["svc-c"].Status)
+	}
+	for _, name := range []string{"svc-b", "svc-d"} {
+		if r := statuses[name]; r.Status != "held" || r.HolderOwner != "other-owner" {
+			t.Errorf("%s = %+v, want held by other-owner", name, r)
+		}
+	}
+	for _, name := range []string{"svc-a", "svc-c"} {
+		if _, err := os.Stat(filepath.Join(locksDir, name+".json")); !os.IsNotExist(err) {
+			t.Errorf("lock %s should not be held after rollback", name)
+		}
+	}
+}
+
+func TestLock_SeveralNames(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+
+	stdout, _, code := captureCmd(cmdLock, []string{"db-migrate", "asset-upload", "--ttl", "5m"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	if want := "acquired lock \"asset-upload\"\nacquired lock \"db-migrate\"\n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+
+	writeLockJSON(t, locksDir, "svc-b.json", &lockfile.Lock{
+		Version: 1, Name: "svc-b", Owner: "other-owner", Host: "other-host", PID: 1, AcquiredAt: time.Now(),
+	})
+	if _, _, code := captureCmd(cmdLock, []string{"svc-a", "svc-b"}); code != ExitLockHeld {
+		t.Errorf("one held: expected exit %d, got %d", ExitLockHeld, code)
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "svc-a.json")); !os.IsNotExist(err) {
+		t.Error("svc-a should be rolled back when svc-b is held")
+	}
+	if _, _, code := captureCmd(cmdLock, []string{"svc-a", "bad name!"}); code != ExitUsage {
+		t.Errorf("invalid name: expected exit %d, got %d", ExitUsage, code)
+	}
+}
+
+func TestLockBatch_Usage(t *testing.T) {
+	setupTestRoot(t)
+
+	withStdin(t, "ok\nbad name!\n")
+	if _, _, code := captureCmd(cmdLock, []string{"--batch", "-"}); code != ExitUsage {
+		t.Errorf("invalid name: expected exit %d, got %d", ExitUsage, code)
+	}
+	if _, _, code := captureCmd(cmdLock, []string{"--batch", "-", "build"}); code != ExitUsage {
+		t.Errorf("batch with name: expected exit %d, got %d", ExitUsage, code)
+	}
+	withStdin(t, "\n# nothing\n")
+	if _, _, code := captureCmd(cmdLock, []string{"--batch", "-"}); code != ExitUsage {
+		t.Errorf("empty batch: expected exit %d, got %d", ExitUsage, code)
+	}
+}
+
+func TestUnlockBatch_ReportsEachName(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	id := identity.Current()
+	writeLockJSON(t, locksDir, "mine.json", &lockfile.Lock{
+		Version: 1, Name: "mine", Owner: id.Owner, Host: id.Host, PID: id.PID, AcquiredAt: time.Now(),
+	})
+	writeLockJSON(t, locksDir, "theirs.json", &lockfile.Lock{
+		Version: 1, Name: "theirs", Owner: "other-owner", Host: "other-host", PID: 1, AcquiredAt: time.Now(),
+	})
+
+	withStdin(t, "mine\ntheirs\nmissing\n")
+	stdout, _, code := captureCmd(cmdUnlock, []string{"--batch", "-", "--json"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d without --strict, got %d", ExitOK, code)
+	}
+	statuses := map[string]string{}
+	for _, r := range decodeBatchLines(t, stdout) {
+		statuses[r.Name] = r.Status
+	}
+	want := map[string]string{"mine": "released", "theirs": "not_owner", "missing": "not_found"}
+	for name, status := range want {
+		if statuses[name] != status {
+			t.Errorf("%s status = %q, want %q", name, statuses[name], status)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "theirs.json")); err != nil {
+		t.Error("lock held by another owner must not be released")
+	}
+
+	withStdin(t, "theirs\nmissing\n")
+	_, stderr, code := captureCmd(cmdUnlock, []string{"--batch", "-", "--strict"})
+	if code != ExitNotOwner {
+		t.Errorf("--strict: expected exit %d, got %d", ExitNotOwner, code)
+	}
+	if !strings.Contains(stderr, `"theirs" held by other-owner`) || !strings.Contains(stderr, `"missing" not found`) {
+		t.Errorf("expected per-name errors, got %q", stderr)
+	}
+}
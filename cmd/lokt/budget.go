@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// waitBudgetEnv carries an absolute wait deadline (RFC 3339) from a guard
+// started with --total-wait-budget to every lokt invocation in its process
+// tree. Nested waits clamp their own deadline to it; nothing extends it.
+const waitBudgetEnv = "LOKT_WAIT_BUDGET_DEADLINE"
+
+// errWaitBudget is the context cause when the inherited budget, rather than
+// --timeout, ends a wait.
+var errWaitBudget = errors.New("inherited wait budget exhausted")
+
+// inheritedWaitBudget returns the deadline exported by an enclosing guard, or
+// the zero time if there is none. A malformed value is ignored with a warning
+// so a bad environment can't break the command outright.
+func inheritedWaitBudget() time.Time {
+	v := os.Getenv(waitBudgetEnv)
+	if v == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring malformed %s=%q\n", waitBudgetEnv, v)
+		return time.Time{}
+	}
+	return t
+}
+
+// waitBudgetDeadline returns this invocation's budget deadline: the inherited
+// one, shortened to now+budget when budget is set. Zero if neither applies.
+func waitBudgetDeadline(budget time.Duration, now time.Time) time.Time {
+	deadline := inheritedWaitBudget()
+	if budget > 0 {
+		if own := now.Add(budget); deadline.IsZero() || own.Before(deadline) {
+			deadline = own
+		}
+	}
+	return deadline
+}
+
+// waitContext returns a context that ends on SIGINT/SIGTERM or after timeout
+// (DefaultWaitTimeout when zero), whichever is first. A non-zero budget that
+// falls earlier than the timeout becomes the deadline instead, with
+// errWaitBudget as the context cause.
+func waitContext(timeout time.Duration, budget time.Time) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		timeout = DefaultWaitTimeout
+	}
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if !budget.IsZero() && budget.Before(time.Now().Add(timeout)) {
+		ctx, cancel = context.WithDeadlineCause(sigCtx, budget, errWaitBudget)
+	} else {
+		ctx, cancel = context.WithTimeout(sigCtx, timeout)
+	}
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// budgetNote returns a suffix for timeout messages naming the inherited
+// budget when it was the binding constraint.
+func budgetNote(ctx context.Context) string {
+	if errors.Is(context.Cause(ctx), errWaitBudget) {
+		return " (" + errWaitBudget.Error() + ")"
+	}
+	return ""
+}
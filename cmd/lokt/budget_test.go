@@ -0,0 +1,115 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func writeBlocker(t *testing.T, locksDir, name string) {
+	t.Helper()
+	writeLockJSON(t, locksDir, name+".json", &lockfile.Lock{
+		Version: 1, Name: name, Owner: "blocker", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+}
+
+func TestWaitBudgetDeadline(t *testing.T) {
+	now := time.Now()
+	inherited := now.Add(time.Minute)
+	t.Setenv(waitBudgetEnv, inherited.Format(time.RFC3339Nano))
+
+	if got := waitBudgetDeadline(0, now); !got.Equal(inherited) {
+		t.Errorf("no own budget: got %v, want inherited %v", got, inherited)
+	}
+	if got := waitBudgetDeadline(10*time.Second, now); !got.Equal(now.Add(10 * time.Second)) {
+		t.Errorf("shorter own budget: got %v, want %v", got, now.Add(10*time.Second))
+	}
+	if got := waitBudgetDeadline(time.Hour, now); !got.Equal(inherited) {
+		t.Errorf("own budget must not extend the inherited one: got %v", got)
+	}
+
+	t.Setenv(waitBudgetEnv, "")
+	if got := waitBudgetDeadline(0, now); !got.IsZero() {
+		t.Errorf("no budget at all: got %v, want zero", got)
+	}
+}
+
+func TestLock_InheritedBudgetShortensWait(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeBlocker(t, locksDir, "budgeted")
+	t.Setenv(waitBudgetEnv, time.Now().Add(300*time.Millisecond).Format(time.RFC3339Nano))
+
+	start := time.Now()
+	_, stderr, code := captureCmd(cmdLock, []string{"--wait", "--timeout", "30s", "budgeted"})
+	elapsed := time.Since(start)
+
+	if code != ExitLockHeld {
+		t.Errorf("expected exit %d, got %d", ExitLockHeld, code)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("inherited budget should have cut the wait short, took %v", elapsed)
+	}
+	if !strings.Contains(stderr, "timeout waiting for lock") || !strings.Contains(stderr, "inherited wait budget exhausted") {
+		t.Errorf("expected timeout naming the inherited budget, got: %s", stderr)
+	}
+}
+
+func TestLock_InheritedBudgetNeverExtends(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeBlocker(t, locksDir, "short-timeout")
+	t.Setenv(waitBudgetEnv, time.Now().Add(time.Hour).Format(time.RFC3339Nano))
+
+	start := time.Now()
+	_, stderr, code := captureCmd(cmdLock, []string{"--wait", "--timeout", "300ms", "short-timeout"})
+	if code != ExitLockHeld {
+		t.Errorf("expected exit %d, got %d", ExitLockHeld, code)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("--timeout should still apply under a longer budget, took %v", elapsed)
+	}
+	if strings.Contains(stderr, "wait budget") {
+		t.Errorf("--timeout was the binding constraint, got: %s", stderr)
+	}
+}
+
+func TestLock_MalformedBudgetIgnored(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeBlocker(t, locksDir, "malformed")
+	t.Setenv(waitBudgetEnv, "not-a-time")
+
+	_, stderr, code := captureCmd(cmdLock, []string{"--wait", "--timeout", "200ms", "malformed"})
+	if code != ExitLockHeld {
+		t.Errorf("expected exit %d, got %d", ExitLockHeld, code)
+	}
+	if !strings.Contains(stderr, "warning: ignoring malformed "+waitBudgetEnv) {
+		t.Errorf("expected malformed-budget warning, got: %s", stderr)
+	}
+}
+
+// TestGuard_NestedWaitRespectsOuterBudget runs a guard whose child is another
+// guard waiting on a held lock: the inner --timeout is long, but the outer
+// --total-wait-budget must bound it.
+func TestGuard_NestedWaitRespectsOuterBudget(t *testing.T) {
+	binary := buildBinary(t)
+	rootDir := setupIntegrationRoot(t)
+	writeBlocker(t, filepath.Join(rootDir, "locks"), "inner")
+
+	start := time.Now()
+	_, stderr, code := runLokt(t, binary, rootDir,
+		"guard", "--total-wait-budget", "1s", "outer", "--",
+		binary, "guard", "--wait", "--timeout", "30s", "inner", "--", "true")
+	elapsed := time.Since(start)
+
+	if code != ExitLockHeld {
+		t.Errorf("expected inner exit %d to propagate, got %d (stderr: %s)", ExitLockHeld, code, stderr)
+	}
+	if elapsed > 10*time.Second {
+		t.Errorf("outer budget should bound the nested wait, took %v", elapsed)
+	}
+	if !strings.Contains(stderr, `timeout waiting for lock "inner"`) || !strings.Contains(stderr, "inherited wait budget exhausted") {
+		t.Errorf("expected inner timeout naming the budget, got: %s", stderr)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// cmdCheck is the read-only counterpart of lock: it reports whether name
+// could be acquired right now without acquiring it, pruning anything, or
+// writing audit events. Exit 0 means free, 2 means held or frozen.
+func cmdCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	wait := fs.Bool("wait", false, "Wait for the lock to become free")
+	timeout := fs.Duration("timeout", 0, "Maximum time to wait (requires --wait)")
+	if err := fs.Parse(interspersed(fs, args)); err != nil || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: lokt check [--wait [--timeout d]] <name>")
+		return ExitUsage
+	}
+	if *timeout != 0 && !*wait {
+		fmt.Fprintln(os.Stderr, "error: --timeout requires --wait")
+		return ExitUsage
+	}
+	if *timeout < 0 {
+		fmt.Fprintln(os.Stderr, "error: --timeout must be positive (e.g., 5s, 1m)")
+		return ExitUsage
+	}
+	name := fs.Arg(0)
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	retryDefault := retryAfterDefault(rootDir)
+	groups := exclusionGroups(rootDir)
+
+	err = lock.Check(rootDir, name, retryDefault, groups)
+	if err != nil && *wait && blocked(err) {
+		ctx, cancel := waitContext(*timeout, waitBudgetDeadline(0, time.Now()))
+		defer cancel()
+		err = waitCheck(ctx, rootDir, name, retryDefault, groups, lock.DefaultRetryPolicy, err)
+	}
+	if err == nil {
+		return ExitOK
+	}
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	if blocked(err) {
+		return ExitLockHeld
+	}
+	return ExitError
+}
+
+// blocked reports whether err means the name is held or frozen.
+func blocked(err error) bool {
+	return errors.Is(err, lock.ErrLockHeld) || errors.Is(err, lock.ErrFrozen)
+}
+
+// waitCheck polls lock.Check on the retry schedule until the name is free or
+// ctx ends, returning the last blocking error (initially err) in the latter
+// case.
+func waitCheck(ctx context.Context, rootDir, name string, retryDefault time.Duration, groups map[string][]string, retry lock.RetryPolicy, err error) error {
+	for attempt := 0; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retry.Interval(attempt)):
+		}
+		if err = lock.Check(rootDir, name, retryDefault, groups); err == nil || !blocked(err) {
+			return err
+		}
+	}
+}
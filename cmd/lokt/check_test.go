@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestCheck_States(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "me")
+	writeLockJSON(t, locksDir, "held.json", &lockfile.Lock{
+		Version: 1, Name: "held", Owner: "other", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+	writeLockJSON(t, locksDir, "mine.json", &lockfile.Lock{
+		Version: 1, Name: "mine", Owner: "me", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+	freezesDir := filepath.Join(rootDir, "freezes")
+	if err := os.MkdirAll(freezesDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(10 * time.Minute)
+	writeLockJSON(t, freezesDir, "frozen.json", &lockfile.Lock{
+		Version: 1, Name: "frozen", Owner: "other", Host: "other-host", PID: 99999,
+		AcquiredAt: time.Now(), TTLSec: 600, ExpiresAt: &exp,
+	})
+
+	tests := []struct {
+		name     string
+		wantCode int
+		wantErr  string
+	}{
+		{"free", ExitOK, ""},
+		{"mine", ExitOK, ""},
+		{"held", ExitLockHeld, `lock "held" held by other@other-host`},
+		{"frozen", ExitLockHeld, `"frozen" frozen by other@other-host`},
+	}
+	for _, tt := range tests {
+		_, stderr, code := captureCmd(cmdCheck, []string{tt.name})
+		if code != tt.wantCode {
+			t.Errorf("check %s: exit %d, want %d (stderr %q)", tt.name, code, tt.wantCode, stderr)
+		}
+		if !strings.Contains(stderr, tt.wantErr) {
+			t.Errorf("check %s: stderr %q, want %q", tt.name, stderr, tt.wantErr)
+		}
+	}
+
+	// Read-only: the held lock is untouched and nothing was audited.
+	if _, err := os.Stat(filepath.Join(locksDir, "held.json")); err != nil {
+		t.Errorf("check must not remove locks: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "audit.log")); !os.IsNotExist(err) {
+		t.Errorf("check must not write audit events (stat: %v)", err)
+	}
+}
+
+func TestCheck_WaitTimesOut(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "held.json", &lockfile.Lock{
+		Version: 1, Name: "held", Owner: "other", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+
+	start := time.Now()
+	_, stderr, code := captureCmd(cmdCheck, []string{"--wait", "--timeout", "300ms", "held"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "held by other") {
+		t.Errorf("exit %d, stderr %q; want held after timeout", code, stderr)
+	}
+	if time.Since(start) < 300*time.Millisecond {
+		t.Error("check --wait returned before its timeout")
+	}
+}
+
+func TestCheck_WaitSucceedsOnRelease(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "held.json", &lockfile.Lock{
+		Version: 1, Name: "held", Owner: "other", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = os.Remove(filepath.Join(locksDir, "held.json"))
+	}()
+
+	if _, stderr, code := captureCmd(cmdCheck, []string{"held", "--wait", "--timeout", "5s"}); code != ExitOK {
+		t.Errorf("exit %d (stderr %q), want 0 once released", code, stderr)
+	}
+}
+
+func TestCheck_Usage(t *testing.T) {
+	setupTestRoot(t)
+	for _, args := range [][]string{nil, {"a", "b"}, {"--timeout", "5s", "a"}} {
+		if _, _, code := captureCmd(cmdCheck, args); code != ExitUsage {
+			t.Errorf("check %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
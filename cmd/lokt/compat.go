@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// compatWriteEnv holds the lockfile version set by --compat-write, so any
+// lokt the command starts writes the same one.
+const compatWriteEnv = "LOKT_COMPAT_WRITE"
+
+// stripCompatWriteFlag removes leading --compat-write flags
+// ("--compat-write 1" or "--compat-write=1") from args and exports the last
+// one as LOKT_COMPAT_WRITE.
+func stripCompatWriteFlag(args []string) ([]string, error) {
+	for len(args) > 0 {
+		name, value, hasValue := strings.Cut(args[0], "=")
+		if name != "--compat-write" && name != "-compat-write" {
+			break
+		}
+		args = args[1:]
+		if !hasValue {
+			if len(args) == 0 {
+				return nil, errors.New("--compat-write needs a lockfile version")
+			}
+			value, args = args[0], args[1:]
+		}
+		if _, err := parseWriteVersion(value); err != nil {
+			return nil, fmt.Errorf("--compat-write: %w", err)
+		}
+		if err := os.Setenv(compatWriteEnv, value); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// parseWriteVersion parses a lockfile version this lokt can write.
+func parseWriteVersion(s string) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || !lockfile.Supported(v) {
+		return 0, fmt.Errorf("%q is not a lockfile version this lokt writes (supported: %v)", s, lockfile.SupportedVersions())
+	}
+	return v, nil
+}
+
+// configureWriteVersion picks the lockfile version new lock files are
+// written in: LOKT_COMPAT_WRITE (--compat-write), else compat_write_version
+// in the root's config.json, else the newest. Only a bad LOKT_COMPAT_WRITE
+// is an error; a broken config is doctor's to report.
+func configureWriteVersion() error {
+	if s := os.Getenv(compatWriteEnv); s != "" {
+		v, err := parseWriteVersion(s)
+		if err != nil {
+			return fmt.Errorf("%s: %w", compatWriteEnv, err)
+		}
+		return lockfile.SetWriteVersion(v)
+	}
+	rootDir, err := root.Find()
+	if err != nil {
+		return nil
+	}
+	if cfg, err := config.Load(rootDir); err == nil {
+		return lockfile.SetWriteVersion(cfg.CompatWriteVersion)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func TestStripCompatWriteFlag(t *testing.T) {
+	t.Setenv(compatWriteEnv, "")
+
+	args, err := stripCompatWriteFlag([]string{"--compat-write", "1", "--compat-write=1", "lock", "build"})
+	if err != nil || !slices.Equal(args, []string{"lock", "build"}) {
+		t.Fatalf("stripCompatWriteFlag() = %v, %v", args, err)
+	}
+	if got := os.Getenv(compatWriteEnv); got != "1" {
+		t.Errorf("LOKT_COMPAT_WRITE = %q, want 1", got)
+	}
+	for _, bad := range [][]string{{"--compat-write"}, {"--compat-write=two", "lock"}, {"--compat-write", "99", "lock"}} {
+		if _, err := stripCompatWriteFlag(bad); err == nil {
+			t.Errorf("stripCompatWriteFlag(%v) should fail", bad)
+		}
+	}
+}
+
+func TestConfigureWriteVersion(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	t.Cleanup(func() { _ = lockfile.SetWriteVersion(0) })
+	if err := os.WriteFile(config.Path(rootDir), []byte(`{"compat_write_version": 1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(compatWriteEnv, "")
+	if err := configureWriteVersion(); err != nil || lockfile.WriteVersion() != 1 {
+		t.Errorf("from config: %v, WriteVersion() = %d; want 1", err, lockfile.WriteVersion())
+	}
+	t.Setenv(compatWriteEnv, "1")
+	if err := configureWriteVersion(); err != nil || lockfile.WriteVersion() != 1 {
+		t.Errorf("from LOKT_COMPAT_WRITE: %v, WriteVersion() = %d; want 1", err, lockfile.WriteVersion())
+	}
+	t.Setenv(compatWriteEnv, "99")
+	if err := configureWriteVersion(); err == nil {
+		t.Error("LOKT_COMPAT_WRITE=99: want an error")
+	}
+
+	// The version chosen is the one lock files get
+	t.Setenv(compatWriteEnv, "")
+	if _, stderr, code := captureCmd(cmdLock, []string{"build"}); code != ExitOK {
+		t.Fatalf("lock: exit %d, stderr %q", code, stderr)
+	}
+	if v, err := lockfile.ReadVersion(root.LockFilePath(rootDir, "build")); err != nil || v != 1 {
+		t.Errorf("lock written in version %d (%v), want 1", v, err)
+	}
+}
@@ -0,0 +1,599 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// maxCompleteEntries bounds the directory reads behind one completion, so a
+// root with thousands of locks can't stall the shell.
+const maxCompleteEntries = 500
+
+// Value kinds for completion of flag values and positional arguments.
+// Anything else (durations, paths) gets no candidates, which lets shells
+// fall back to their own file completion.
+const (
+	completeLock   = "lock"   // lock names, annotated with their holder
+	completeFreeze = "freeze" // active freeze names
+	completeName   = "name"   // lock names, then frozen names nobody holds
+	completeOwner  = "owner"  // owners of current locks
+	completeGroup  = "group"  // configured exclusion groups
+)
+
+// completeFlag is one flag of a command: value is "" for booleans, a value
+// kind, or a fixed list of choices.
+type completeFlag struct {
+	name    string
+	value   string
+	choices []string
+}
+
+// completeCmd describes a command for completion: its flags, what its
+// positional arguments are, and any subcommands. It mirrors the FlagSets in
+// the cmd functions; TestComplete_CoversUsage keeps the two in sync.
+type completeCmd struct {
+	flags   []completeFlag
+	args    []string // value kind, or choices joined by "|", for each position
+	subs    map[string]*completeCmd
+	dashCmd bool // a "--" (or watch's --exec) ends lokt's arguments (guard)
+}
+
+var (
+	primeFormats = []string{"claude-md", "cursorrules", "windsurfrules", "copilot", "clinerules", "aider"}
+	demoNames    = []string{"hexwall", "trunk"}
+	hookNames    = strings.Join(supportedHooks, "|")
+)
+
+var (
+	waitFlags = []completeFlag{
+		{name: "wait"}, {name: "timeout", value: "duration"}, {name: "wait-thaw"}, {name: "no-adaptive"},
+		{name: "poll-min", value: "duration"}, {name: "poll-max", value: "duration"},
+	}
+	completionSpec = map[string]*completeCmd{
+		"lock": {
+			flags: append([]completeFlag{
+				{name: "ttl", value: "duration"}, {name: "json"}, {name: "batch", value: "path"}, {name: "shared"},
+				{name: "message", value: "text"}, {name: "label", value: "key=value"}, {name: "session", value: "id"},
+				{name: "take-over-from", value: completeOwner}, {name: "force-takeover"}, {name: "for-path", value: "path"},
+				{name: "handoff"}, {name: "respect-freeze"},
+			}, waitFlags...),
+			args: []string{completeLock},
+		},
+		"unlock": {
+			flags: []completeFlag{
+				{name: "force"}, {name: "break-stale"}, {name: "owner", value: completeOwner}, {name: "all-mine"}, {name: "all"},
+				{name: "json"}, {name: "batch", value: "path"}, {name: "strict"}, {name: "for-path", value: "path"},
+				{name: "prefix", value: "prefix"}, {name: "fail-if-none"},
+			},
+			args: []string{completeLock},
+		},
+		"renew": {
+			flags: []completeFlag{{name: "ttl", value: "duration"}, {name: "force"}},
+			args:  []string{completeLock},
+		},
+		"adopt": {
+			flags: []completeFlag{{name: "token", value: "lock_id"}, {name: "pid", value: "pid"}},
+			args:  []string{completeLock},
+		},
+		"status": {
+			flags: []completeFlag{
+				{name: "json"}, {name: "prune-expired"}, {name: "output", value: "path"}, {name: "group", value: completeGroup},
+				{name: "watch"}, {name: "interval", value: "duration"}, {name: "stale"}, {name: "fail-if-stale"},
+				{name: "schema", choices: []string{"1", "2"}},
+				{name: "all-roots"}, {name: "roots", value: "path"},
+			},
+			args: []string{completeName},
+		},
+		"exists": {args: []string{completeLock}},
+		"check": {
+			flags: []completeFlag{{name: "wait"}, {name: "timeout", value: "duration"}},
+			args:  []string{completeLock},
+		},
+		"watch": {
+			flags:   []completeFlag{{name: "timeout", value: "duration"}, {name: "and-acquire"}, {name: "ttl", value: "duration"}, {name: "exec"}},
+			args:    []string{completeLock},
+			dashCmd: true,
+		},
+		"guard": {
+			flags: append([]completeFlag{
+				{name: "ttl", value: "duration"},
+				{name: "total-wait-budget", value: "duration"},
+				{name: "wait-report", value: "duration"},
+				{name: "max-renew-gap", value: "duration"},
+				{name: "kill-timeout", value: "duration"},
+				{name: "on-lost", choices: []string{"warn", "terminate"}}, {name: "strict-ttl"},
+				{name: "verify-interval", value: "duration"},
+				{name: "no-release"},
+				{name: "shared"},
+				{name: "flock"},
+				{name: "on-timeout", value: "command"},
+				{name: "if-free"}, {name: "skip-exit-code", value: "code"},
+				{name: "locks", value: completeLock},
+				{name: "slots", value: "n"},
+				{name: "shell"},
+				{name: "message", value: "text"}, {name: "label", value: "key=value"},
+				{name: "session", value: "id"},
+				{name: "cwd", value: "path"}, {name: "env", value: "key=value"}, {name: "env-file", value: "path"},
+				{name: "tag-output"}, {name: "log-file", value: "path"},
+				{name: "retry", value: "n"}, {name: "retry-delay", value: "duration"}, {name: "no-retry-on", value: "codes"},
+			}, waitFlags...),
+			args:    []string{completeLock, "--"},
+			dashCmd: true,
+		},
+		"run": {
+			flags: append([]completeFlag{
+				{name: "ttl", value: "duration"}, {name: "post-release"}, {name: "shell"},
+				{name: "message", value: "text"}, {name: "label", value: "key=value"},
+			}, waitFlags...),
+			args:    []string{completeLock, "--"},
+			dashCmd: true,
+		},
+		"plan": {subs: map[string]*completeCmd{
+			"run": {
+				flags: []completeFlag{{name: "parallel", value: "n"}, {name: "timeout", value: "duration"}, {name: "results", value: "path"}},
+				args:  []string{"path"},
+			},
+		}},
+		"freeze": {
+			flags: []completeFlag{{name: "ttl", value: "duration"}, {name: "until", value: "time"}, {name: "reason", value: "text"}, {name: "all"}, {name: "match", value: "pattern"}, {name: "wait-idle"}, {name: "timeout", value: "duration"}},
+			args:  []string{completeName},
+		},
+		"unfreeze": {flags: []completeFlag{{name: "force"}, {name: "all"}, {name: "match", value: "pattern"}}, args: []string{completeFreeze}},
+		"freezes":  {flags: []completeFlag{{name: "json"}}},
+		"reserve": {
+			flags: []completeFlag{
+				{name: "until", value: "time"}, {name: "from", value: "time"}, {name: "owner", value: completeOwner},
+				{name: "reason", value: "text"}, {name: "json"},
+			},
+			args: []string{completeName},
+		},
+		"unreserve":    {flags: []completeFlag{{name: "id", value: "id"}, {name: "force"}}, args: []string{completeLock}},
+		"reservations": {flags: []completeFlag{{name: "json"}}, args: []string{completeLock}},
+		"audit": {flags: []completeFlag{
+			{name: "since", value: "duration"}, {name: "tail"}, {name: "name", value: completeLock}, {name: "output", value: "path"},
+			{name: "event", choices: auditEvents}, {name: "owner", value: completeOwner},
+			{name: "format", choices: auditFormats}, {name: "json"},
+			{name: "prune"}, {name: "keep", value: "duration"},
+		}},
+		"why":     {flags: []completeFlag{{name: "json"}}, args: []string{completeLock}},
+		"whoami":  {flags: []completeFlag{{name: "json"}}},
+		"inspect": {flags: []completeFlag{{name: "freeze"}, {name: "json"}}, args: []string{completeLock}},
+		"doctor": {flags: []completeFlag{
+			{name: "json"}, {name: "output", value: "path"}, {name: "probe-webhooks"}, {name: "fix"},
+			{name: "torture"}, {name: "duration", value: "duration"}, {name: "procs", value: "n"},
+		}},
+		"prime": {flags: []completeFlag{
+			{name: "format", choices: primeFormats}, {name: "no-history-discovery"}, {name: "json"},
+			{name: "write"}, {name: "check"},
+		}},
+		"history": {
+			flags: []completeFlag{{name: "limit", value: "n"}, {name: "json"}},
+			args:  []string{completeLock},
+			subs: map[string]*completeCmd{
+				"show": {flags: []completeFlag{{name: "at", value: "duration"}, {name: "json"}, {name: "output", value: "path"}}},
+			},
+		},
+		"session": {subs: map[string]*completeCmd{
+			"list": {flags: []completeFlag{{name: "json"}}},
+			"end":  {flags: []completeFlag{{name: "json"}}, args: []string{"id"}},
+			"gc":   {flags: []completeFlag{{name: "json"}}},
+		}},
+		"stats": {flags: []completeFlag{{name: "since", value: "duration"}, {name: "json"}}},
+		"serve": {flags: []completeFlag{{name: "http", value: "addr"}, {name: "read-only"}, {name: "allow-force"}}},
+		"relocate": {flags: []completeFlag{
+			{name: "to", value: "path"}, {name: "redirect", choices: []string{root.RedirectFollow, root.RedirectFail}},
+		}},
+		"export": {flags: []completeFlag{{name: "output", value: "path"}, {name: "audit"}}},
+		"import": {
+			flags: []completeFlag{
+				{name: "root", value: "path"}, {name: "force"}, {name: "dry-run"}, {name: "no-audit"}, {name: "json"},
+			},
+			args: []string{"path"},
+		},
+		"sweep": {flags: []completeFlag{{name: "dry-run"}, {name: "json"}, {name: "retention", value: "duration"}}},
+		"prune": {flags: []completeFlag{{name: "dry-run"}, {name: "json"}, {name: "older-than", value: "duration"}}},
+		"init":  {flags: []completeFlag{{name: "root", value: "path"}}},
+		"hook": {subs: map[string]*completeCmd{
+			"install": {
+				flags: []completeFlag{
+					{name: "check", value: completeLock}, {name: "wait"}, {name: "timeout", value: "duration"}, {name: "strict"},
+				},
+				args: []string{hookNames},
+			},
+			"uninstall": {args: []string{hookNames}},
+		}},
+		"demo":       {args: []string{strings.Join(demoNames, "|")}},
+		"completion": {args: []string{strings.Join(completionShells, "|")}},
+		"version":    {},
+		"help":       {},
+	}
+)
+
+// completionShells are the shells lokt completion has scripts for. Each
+// script is a thin wrapper around lokt _complete, so candidates stay
+// current as commands and flags are added.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+const bashCompletion = `# lokt completion for bash; load with: source <(lokt completion bash)
+_lokt_complete() {
+	local IFS=$'\n'
+	COMPREPLY=($(lokt _complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null | cut -f1))
+}
+complete -o default -F _lokt_complete lokt
+`
+
+const zshCompletion = `#compdef lokt
+# lokt completion for zsh; load with: source <(lokt completion zsh)
+_lokt_complete() {
+	local -a lines cands
+	local line
+	lines=("${(@f)$(lokt _complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+	for line in "${lines[@]}"; do
+		[[ -n $line ]] || continue
+		if [[ $line == *$'\t'* ]]; then
+			cands+=("${${line%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+		else
+			cands+=("${line//:/\\:}")
+		fi
+	done
+	(( ${#cands} )) && _describe 'lokt' cands || _files
+}
+compdef _lokt_complete lokt
+`
+
+const fishCompletion = `# lokt completion for fish; load with: lokt completion fish | source
+complete -c lokt -f -a '(lokt _complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`
+
+func cmdCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: lokt completion <%s>\n", strings.Join(completionShells, "|"))
+		return ExitUsage
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		fmt.Fprintf(os.Stderr, "error: unsupported shell %q (want %s)\n", args[0], strings.Join(completionShells, ", "))
+		return ExitUsage
+	}
+	return ExitOK
+}
+
+// cmdComplete implements the hidden "lokt _complete <words...>" command.
+// words is the command line after "lokt"; the last word is the one being
+// completed and may be empty. Candidates are printed one per line, with an
+// optional tab-separated annotation. It never fails: any problem just means
+// fewer (or no) candidates, and it never writes to the root.
+func cmdComplete(args []string) int {
+	for _, c := range complete(args) {
+		fmt.Println(c)
+	}
+	return ExitOK
+}
+
+// complete returns the candidates for words.
+func complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+	prev := words[:len(words)-1]
+
+	if len(prev) == 0 {
+		names := make([]string, 0, len(completionSpec))
+		for name := range completionSpec {
+			names = append(names, name)
+		}
+		return filterPrefix(sorted(names), cur)
+	}
+	spec := completionSpec[prev[0]]
+	if spec == nil {
+		return nil
+	}
+
+	// Walk the words before the cursor: descend into subcommands, skip flag
+	// values, and count positional arguments.
+	var pending *completeFlag // flag still waiting for its value
+	positional := 0
+	for _, w := range prev[1:] {
+		switch {
+		case pending != nil:
+			pending = nil
+		case spec.dashCmd && (w == "--" || w == "--exec"):
+			return nil // the guarded command's own arguments
+		case strings.HasPrefix(w, "-") && w != "-":
+			name, _, hasValue := strings.Cut(strings.TrimLeft(w, "-"), "=")
+			if f := spec.flag(name); f != nil && (f.value != "" || f.choices != nil) && !hasValue {
+				pending = f
+			}
+		case positional == 0 && spec.subs != nil && (spec.subs[w] != nil || spec.args == nil):
+			if spec = spec.subs[w]; spec == nil {
+				return nil
+			}
+		default:
+			positional++
+		}
+	}
+
+	if pending != nil {
+		return pending.candidates(cur, "")
+	}
+	if strings.HasPrefix(cur, "-") {
+		if name, _, ok := strings.Cut(strings.TrimLeft(cur, "-"), "="); ok {
+			if f := spec.flag(name); f != nil {
+				prefix := cur[:strings.Index(cur, "=")+1]
+				return f.candidates(strings.TrimPrefix(cur, prefix), prefix)
+			}
+			return nil
+		}
+		var out []string
+		for _, f := range spec.flags {
+			out = append(out, "--"+f.name)
+		}
+		return filterPrefix(sorted(out), cur)
+	}
+	if spec.subs != nil && positional == 0 {
+		names := make([]string, 0, len(spec.subs))
+		for name := range spec.subs {
+			names = append(names, name)
+		}
+		out := filterPrefix(sorted(names), cur)
+		if len(spec.args) > 0 { // a subcommand or the command's own argument
+			out = append(out, valueCandidates(spec.args[0], cur, "")...)
+		}
+		return out
+	}
+	if positional >= len(spec.args) {
+		return nil
+	}
+	return valueCandidates(spec.args[positional], cur, "")
+}
+
+// flag returns the named flag of c, or nil.
+func (c *completeCmd) flag(name string) *completeFlag {
+	for i := range c.flags {
+		if c.flags[i].name == name {
+			return &c.flags[i]
+		}
+	}
+	return nil
+}
+
+// candidates returns the values of f matching cur, each prefixed with
+// prefix (the "--flag=" part when completing that form).
+func (f *completeFlag) candidates(cur, prefix string) []string {
+	if f.choices != nil {
+		return withPrefix(filterPrefix(f.choices, cur), prefix)
+	}
+	return valueCandidates(f.value, cur, prefix)
+}
+
+// valueCandidates resolves a value kind, or a |-separated list of choices.
+func valueCandidates(kind, cur, prefix string) []string {
+	var out []string
+	switch kind {
+	case completeLock:
+		out = lockCandidates(cur)
+	case completeFreeze:
+		out = freezeCandidates(cur)
+	case completeName:
+		out = nameCandidates(cur)
+	case completeOwner:
+		out = ownerCandidates(cur)
+	case completeGroup:
+		out = groupCandidates(cur)
+	case "duration", "path", "addr", "command":
+		return nil
+	default:
+		out = filterPrefix(strings.Split(kind, "|"), cur)
+	}
+	return withPrefix(out, prefix)
+}
+
+// lockCandidates lists lock names starting with cur, annotated with their
+// holder, e.g. "deploy\theld by alice 4m".
+func lockCandidates(cur string) []string {
+	rootDir, err := root.Find()
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, name := range listLockNames(rootDir, cur) {
+		if strings.HasPrefix(name, lock.FreezePrefix) {
+			continue // legacy freeze files
+		}
+		lk, err := lockfile.Read(root.LockFilePath(rootDir, name))
+		if err != nil {
+			out = append(out, name)
+			continue
+		}
+		note := fmt.Sprintf("held by %s %s", lk.Owner, lk.Age().Truncate(time.Second))
+		if lk.IsExpired() {
+			note += " (expired)"
+		}
+		out = append(out, name+"\t"+note)
+	}
+	for _, name := range lock.SharedNames(rootDir) {
+		if strings.HasPrefix(name, cur) {
+			out = append(out, fmt.Sprintf("%s\tshared by %d", name, len(lock.SharedHolders(rootDir, name))))
+		}
+	}
+	return out
+}
+
+// nameCandidates lists lockCandidates, then the freezeCandidates on names
+// none of them has: status and freeze take a name whether it is locked,
+// frozen or both.
+func nameCandidates(cur string) []string {
+	out := lockCandidates(cur)
+	held := make(map[string]bool, len(out))
+	for _, c := range out {
+		name, _, _ := strings.Cut(c, "\t")
+		held[name] = true
+	}
+	for _, c := range freezeCandidates(cur) {
+		if name, _, _ := strings.Cut(c, "\t"); !held[name] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// freezeCandidates lists active freezes starting with cur, from both the
+// freezes directory and legacy freeze-prefixed lock files.
+func freezeCandidates(cur string) []string {
+	rootDir, err := root.Find()
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var out []string
+	add := func(name, path string) {
+		if seen[name] {
+			return
+		}
+		lk, err := lockfile.Read(path)
+		if err != nil || lk.IsExpired() || lk.Pattern {
+			return // a pattern freeze is removed with --match
+		}
+		seen[name] = true
+		note := "frozen by " + lk.Owner
+		if rem := lk.Remaining(); rem > 0 {
+			note += fmt.Sprintf(" %s left", rem.Truncate(time.Second))
+		}
+		out = append(out, name+"\t"+note)
+	}
+	for _, name := range listJSONNames(root.FreezesPath(rootDir), cur) {
+		add(name, root.FreezeFilePath(rootDir, name))
+	}
+	for _, file := range listJSONNames(root.LocksPath(rootDir), lock.FreezePrefix+cur) {
+		add(strings.TrimPrefix(file, lock.FreezePrefix), root.LockFilePath(rootDir, file))
+	}
+	return sorted(out)
+}
+
+// ownerCandidates lists the distinct owners of current locks.
+func ownerCandidates(cur string) []string {
+	rootDir, err := root.Find()
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var out []string
+	for _, name := range listLockNames(rootDir, "") {
+		lk, err := lockfile.Read(root.LockFilePath(rootDir, name))
+		if err != nil || seen[lk.Owner] || !strings.HasPrefix(lk.Owner, cur) {
+			continue
+		}
+		seen[lk.Owner] = true
+		out = append(out, lk.Owner)
+	}
+	return sorted(out)
+}
+
+// groupCandidates lists configured exclusion groups starting with cur.
+func groupCandidates(cur string) []string {
+	rootDir, err := root.Find()
+	if err != nil {
+		return nil
+	}
+	cfg, err := config.Load(rootDir)
+	if err != nil {
+		return nil
+	}
+	return filterPrefix(groupNames(cfg), cur)
+}
+
+// listJSONNames returns the names (without .json) of the files in dir that
+// start with prefix, sorted. Namespace subdirectories are descended only
+// while prefix can still match inside them, and at most maxCompleteEntries
+// directory entries are read in all.
+func listJSONNames(dir, prefix string) []string {
+	return listNames(dir, prefix, 0)
+}
+
+// listLockNames is listJSONNames for the locks of rootDir, looking into
+// every shard of a sharded root (see root.ShardLevel): a name's shard can't
+// be told from a prefix of it.
+func listLockNames(rootDir, prefix string) []string {
+	return listNames(root.LocksPath(rootDir), prefix, root.ShardLevel(rootDir))
+}
+
+func listNames(dir, prefix string, shardLevel int) []string {
+	budget := maxCompleteEntries
+	var names []string
+	var walk func(base, ns string)
+	walk = func(base, ns string) {
+		if budget <= 0 {
+			return
+		}
+		d, err := os.Open(filepath.Join(base, filepath.FromSlash(ns))) //nolint:gosec // G304: path is built from the lokt root
+		if err != nil {
+			return
+		}
+		entries, _ := d.ReadDir(budget)
+		_ = d.Close()
+		budget -= len(entries)
+		for _, e := range entries {
+			name := ns + e.Name()
+			if e.IsDir() {
+				if base == dir && ns == "" && shardLevel > 0 && strings.HasPrefix(name, root.ShardPrefix) {
+					walk(filepath.Join(dir, name), "") // a shard
+				} else if sub := name + "/"; strings.HasPrefix(sub, prefix) || strings.HasPrefix(prefix, sub) {
+					walk(base, sub)
+				}
+				continue
+			}
+			name, ok := strings.CutSuffix(name, ".json")
+			if !ok || !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if base != dir && root.Shard(name, shardLevel) != filepath.Base(base) {
+				continue // not sharded; listed through its namespace
+			}
+			names = append(names, name)
+		}
+	}
+	walk(dir, "")
+	return sorted(names)
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func withPrefix(candidates []string, prefix string) []string {
+	if prefix == "" {
+		return candidates
+	}
+	out := make([]string, len(candidates))
+	for i, c := range candidates {
+		out[i] = prefix + c
+	}
+	return out
+}
+
+func sorted(s []string) []string {
+	slices.Sort(s)
+	return s
+}
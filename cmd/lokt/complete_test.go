@@ -0,0 +1,198 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// setupCompleteRoot creates a root with two locks and one active freeze.
+func setupCompleteRoot(t *testing.T) string {
+	t.Helper()
+	rootDir, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "deploy.json", &lockfile.Lock{
+		Version: 1, Name: "deploy", Owner: "alice", Host: "h1", PID: 1, AcquiredAt: time.Now().Add(-4 * time.Minute),
+	})
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", Owner: "bob", Host: "h2", PID: 2, AcquiredAt: time.Now(),
+	})
+	freezesDir := filepath.Join(rootDir, "freezes")
+	if err := os.MkdirAll(freezesDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(10 * time.Minute)
+	writeLockJSON(t, freezesDir, "release.json", &lockfile.Lock{
+		Version: 1, Name: "release", Owner: "oncall", Host: "h3", PID: 3,
+		AcquiredAt: time.Now(), TTLSec: 600, ExpiresAt: &exp,
+	})
+	return rootDir
+}
+
+// names strips annotations, leaving just the candidates.
+func names(candidates []string) []string {
+	out := make([]string, len(candidates))
+	for i, c := range candidates {
+		out[i], _, _ = strings.Cut(c, "\t")
+	}
+	return out
+}
+
+func TestComplete_Positions(t *testing.T) {
+	rootDir := setupCompleteRoot(t)
+
+	tests := []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{"un"}, []string{"unfreeze", "unlock", "unreserve"}},
+		{[]string{"unlock", ""}, []string{"build", "deploy"}},
+		{[]string{"unlock", "d"}, []string{"deploy"}},
+		{[]string{"unlock", "--owner", ""}, []string{"alice", "bob"}},
+		{[]string{"unlock", "--b"}, []string{"--batch", "--break-stale"}},
+		{[]string{"unfreeze", ""}, []string{"release"}},
+		{[]string{"status", ""}, []string{"build", "deploy", "release"}},
+		{[]string{"freeze", "--ttl", "5m", "r"}, []string{"release"}},
+		{[]string{"why", "--json", ""}, []string{"build", "deploy"}},
+		{[]string{"guard", "--ttl", ""}, nil},
+		{[]string{"guard", "--ttl", "5m", "b"}, []string{"build"}},
+		{[]string{"guard", "--on-lost", ""}, []string{"warn", "terminate"}},
+		{[]string{"guard", "--on-lost=t"}, []string{"--on-lost=terminate"}},
+		{[]string{"guard", "deploy", ""}, []string{"--"}},
+		{[]string{"guard", "deploy", "--", "ma"}, nil},
+		{[]string{"lock", "deploy", ""}, nil},
+		{[]string{"prime", "--format", "c"}, []string{"claude-md", "cursorrules", "copilot", "clinerules"}},
+		{[]string{"audit", "--name", ""}, []string{"build", "deploy"}},
+		{[]string{"hook", ""}, []string{"install", "uninstall"}},
+		{[]string{"hook", "install", ""}, []string{"pre-push", "pre-commit"}},
+		{[]string{"hook", "install", "pre-push", "--check", "de"}, []string{"deploy"}},
+		{[]string{"history", ""}, []string{"show", "build", "deploy"}},
+		{[]string{"history", "--limit", "5", "de"}, []string{"deploy"}},
+		{[]string{"history", "build", ""}, nil},
+		{[]string{"history", "show", "--"}, []string{"--at", "--json", "--output"}},
+		{[]string{"relocate", "--redirect", ""}, []string{"follow", "fail"}},
+		{[]string{"completion", ""}, []string{"bash", "zsh", "fish"}},
+		{[]string{"nosuchcmd", ""}, nil},
+	}
+	for _, tt := range tests {
+		got := names(complete(tt.words))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("complete(%q) = %q, want %q", tt.words, got, tt.want)
+		}
+	}
+
+	// Lock candidates carry a holder annotation; nothing is written.
+	got := complete([]string{"unlock", "de"})
+	if len(got) != 1 || got[0] != "deploy\theld by alice 4m0s" {
+		t.Errorf("annotated candidate = %q, want %q", got, "deploy\theld by alice 4m0s")
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "audit.log")); !os.IsNotExist(err) {
+		t.Errorf("completion must not write audit events (stat: %v)", err)
+	}
+}
+
+func TestComplete_ShardedLocks(t *testing.T) {
+	rootDir := setupCompleteRoot(t) // build and deploy from before sharding
+	if err := os.WriteFile(filepath.Join(rootDir, "config.json"), []byte(`{"shard_locks": 2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"branch-a", "team/web"} {
+		path := root.ShardedLockFilePath(rootDir, name, 2)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		writeLockJSON(t, filepath.Dir(path), filepath.Base(path), &lockfile.Lock{
+			Version: 1, Name: name, Owner: "carol", Host: "h4", PID: 4, AcquiredAt: time.Now(),
+		})
+	}
+
+	if got, want := names(complete([]string{"unlock", ""})), []string{"branch-a", "build", "deploy", "team/web"}; !slices.Equal(got, want) {
+		t.Errorf("complete(unlock) = %q, want %q", got, want)
+	}
+	if got, want := names(complete([]string{"unlock", "te"})), []string{"team/web"}; !slices.Equal(got, want) {
+		t.Errorf("complete(unlock te) = %q, want %q", got, want)
+	}
+}
+
+func TestComplete_NoRoot(t *testing.T) {
+	t.Setenv("LOKT_ROOT", filepath.Join(t.TempDir(), "missing"))
+	stdout, stderr, code := captureCmd(cmdComplete, []string{"unlock", ""})
+	if code != ExitOK || stdout != "" || stderr != "" {
+		t.Errorf("missing root: exit %d, stdout %q, stderr %q; want silent success", code, stdout, stderr)
+	}
+	if got := complete([]string{"lo"}); !slices.Equal(got, []string{"lock"}) {
+		t.Errorf("commands should complete without a root, got %q", got)
+	}
+}
+
+// TestComplete_CoversUsage keeps the completion spec in step with the usage
+// text: every command and flag documented there must be completable.
+func TestComplete_CoversUsage(t *testing.T) {
+	out, _, _ := captureCmd(func([]string) int { usage(); return 0 }, nil)
+	body, _, _ := strings.Cut(out, "Exit codes:")
+
+	var spec *completeCmd
+	var where string
+	for _, line := range strings.Split(body, "\n") {
+		switch {
+		case strings.HasPrefix(line, "    -"):
+			flag := strings.TrimLeft(strings.Fields(line)[0], "-")
+			if spec != nil && spec.flag(flag) == nil {
+				t.Errorf("usage documents %s --%s, but completion doesn't offer it", where, flag)
+			}
+		case strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "   "):
+			fields := strings.Fields(line)
+			where = fields[0]
+			spec = completionSpec[where]
+			if spec == nil {
+				t.Errorf("usage documents command %q, but completion doesn't offer it", where)
+				continue
+			}
+			if len(fields) > 1 && spec.subs[fields[1]] != nil {
+				where += " " + fields[1]
+				spec = spec.subs[fields[1]]
+			}
+			for _, f := range fields[1:] {
+				if strings.HasPrefix(f, "--") && f != "--" && spec.flag(strings.TrimLeft(f, "-")) == nil {
+					t.Errorf("usage documents %s %s, but completion doesn't offer it", where, f)
+				}
+			}
+		}
+	}
+}
+
+func TestCompletion_BashScript(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	binary := buildBinary(t)
+	rootDir := setupIntegrationRoot(t)
+	writeLockJSON(t, filepath.Join(rootDir, "locks"), "deploy.json", &lockfile.Lock{
+		Version: 1, Name: "deploy", Owner: "alice", Host: "h1", PID: 1, AcquiredAt: time.Now(),
+	})
+
+	script, _, code := captureCmd(cmdCompletion, []string{"bash"})
+	if code != ExitOK {
+		t.Fatalf("completion bash: exit %d", code)
+	}
+	cmd := exec.Command("bash", "-c", script+`
+COMP_WORDS=(lokt unlock de); COMP_CWORD=2; _lokt_complete; printf '%s\n' "${COMPREPLY[@]}"`)
+	cmd.Env = []string{"PATH=" + filepath.Dir(binary) + ":/usr/bin:/bin", "LOKT_ROOT=" + rootDir}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("bash: %v\n%s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "deploy" {
+		t.Errorf("bash completion = %q, want %q (annotation stripped)", got, "deploy")
+	}
+
+	if _, _, code := captureCmd(cmdCompletion, []string{"tcsh"}); code != ExitUsage {
+		t.Errorf("unsupported shell: exit %d, want %d", code, ExitUsage)
+	}
+}
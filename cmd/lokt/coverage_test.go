@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nikolasavic/lokt/internal/lock"
 	"github.com/nikolasavic/lokt/internal/lockfile"
 )
 
@@ -167,6 +168,18 @@ func TestGuard_NegativeTimeout(t *testing.T) {
 	}
 }
 
+func TestGuard_BadOnLost(t *testing.T) {
+	setupTestRoot(t)
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"--on-lost", "ignore", "mylock", "--", "true"})
+	if code != ExitUsage {
+		t.Errorf("expected exit %d, got %d", ExitUsage, code)
+	}
+	if !strings.Contains(stderr, "--on-lost must be warn or terminate") {
+		t.Errorf("expected on-lost error, got: %s", stderr)
+	}
+}
+
 func TestGuard_ChildSuccess(t *testing.T) {
 	setupTestRoot(t)
 
@@ -206,96 +219,11 @@ func TestGuard_BadCommand(t *testing.T) {
 	}
 }
 
-// --- lockFile.remaining() ---
-
-func TestLockFile_Remaining_WithExpiresAt(t *testing.T) {
-	future := time.Now().Add(5 * time.Minute)
-	lf := &lockFile{
-		AcquiredAt: time.Now(),
-		TTLSec:     300,
-		ExpiresAt:  &future,
-	}
-	rem := lf.remaining()
-	if rem < 4*time.Minute || rem > 6*time.Minute {
-		t.Errorf("expected ~5m remaining, got %v", rem)
-	}
-}
-
-func TestLockFile_Remaining_Expired(t *testing.T) {
-	past := time.Now().Add(-5 * time.Minute)
-	lf := &lockFile{
-		AcquiredAt: time.Now().Add(-10 * time.Minute),
-		TTLSec:     300,
-		ExpiresAt:  &past,
-	}
-	rem := lf.remaining()
-	if rem != 0 {
-		t.Errorf("expected 0 remaining for expired lock, got %v", rem)
-	}
-}
-
-func TestLockFile_Remaining_NoTTL(t *testing.T) {
-	lf := &lockFile{
-		AcquiredAt: time.Now(),
-	}
-	rem := lf.remaining()
-	if rem != 0 {
-		t.Errorf("expected 0 remaining for no-TTL lock, got %v", rem)
-	}
-}
-
-func TestLockFile_Remaining_FallbackArithmetic(t *testing.T) {
-	lf := &lockFile{
-		AcquiredAt: time.Now().Add(-2 * time.Minute),
-		TTLSec:     300, // 5 min TTL, 2 min elapsed => 3 min remaining
-	}
-	rem := lf.remaining()
-	if rem < 2*time.Minute || rem > 4*time.Minute {
-		t.Errorf("expected ~3m remaining, got %v", rem)
-	}
-}
-
-func TestLockFile_Remaining_FallbackExpired(t *testing.T) {
-	lf := &lockFile{
-		AcquiredAt: time.Now().Add(-10 * time.Minute),
-		TTLSec:     60, // 1 min TTL, 10 min elapsed => expired
-	}
-	rem := lf.remaining()
-	if rem != 0 {
-		t.Errorf("expected 0 remaining for expired fallback, got %v", rem)
-	}
-}
-
-// --- lockFile.IsExpired() ---
-
-func TestLockFile_IsExpired_WithExpiresAt(t *testing.T) {
-	past := time.Now().Add(-1 * time.Minute)
-	lf := &lockFile{ExpiresAt: &past}
-	if !lf.IsExpired() {
-		t.Error("expected expired with past ExpiresAt")
-	}
-
-	future := time.Now().Add(5 * time.Minute)
-	lf2 := &lockFile{ExpiresAt: &future}
-	if lf2.IsExpired() {
-		t.Error("expected not expired with future ExpiresAt")
-	}
-}
-
-func TestLockFile_IsExpired_NoTTL(t *testing.T) {
-	lf := &lockFile{
-		AcquiredAt: time.Now().Add(-1 * time.Hour),
-	}
-	if lf.IsExpired() {
-		t.Error("expected not expired with no TTL")
-	}
-}
-
 // --- printLockDenyJSON ---
 
 func TestPrintLockDenyJSON_NilLockFile(t *testing.T) {
 	stdout, _, _ := captureCmd(func(_ []string) int {
-		printLockDenyJSON("test-lock", nil)
+		printLockDenyJSON("test-lock", nil, 0)
 		return 0
 	}, nil)
 
@@ -318,7 +246,7 @@ func TestPrintLockDenyJSON_WithLockFile(t *testing.T) {
 	hostname, _ := os.Hostname()
 	acqTime := time.Now().Add(-30 * time.Second)
 	future := time.Now().Add(5 * time.Minute)
-	lf := &lockFile{
+	lf := &lockfile.Lock{
 		Owner:      "alice",
 		Host:       hostname,
 		PID:        os.Getpid(),
@@ -328,7 +256,7 @@ func TestPrintLockDenyJSON_WithLockFile(t *testing.T) {
 	}
 
 	stdout, _, _ := captureCmd(func(_ []string) int {
-		printLockDenyJSON("deny-lock", lf)
+		printLockDenyJSON("deny-lock", lf, lock.RetryAfter(lf, 0))
 		return 0
 	}, nil)
 
@@ -351,11 +279,14 @@ func TestPrintLockDenyJSON_WithLockFile(t *testing.T) {
 	if out.HolderExpiresAt == "" {
 		t.Error("expected non-empty expires_at")
 	}
+	if out.RetryAfterSec < 299 || out.RetryAfterSec > 300 {
+		t.Errorf("expected retry_after_sec ~300 (remaining TTL), got %d", out.RetryAfterSec)
+	}
 }
 
 func TestPrintLockDenyJSON_ExpiredLock(t *testing.T) {
 	past := time.Now().Add(-5 * time.Minute)
-	lf := &lockFile{
+	lf := &lockfile.Lock{
 		Owner:      "bob",
 		Host:       "remote",
 		PID:        1234,
@@ -365,7 +296,7 @@ func TestPrintLockDenyJSON_ExpiredLock(t *testing.T) {
 	}
 
 	stdout, _, _ := captureCmd(func(_ []string) int {
-		printLockDenyJSON("expired", lf)
+		printLockDenyJSON("expired", lf, 0)
 		return 0
 	}, nil)
 
@@ -580,28 +511,6 @@ func TestUnfreeze_Force(t *testing.T) {
 	}
 }
 
-// --- readLockFile error handling ---
-
-func TestReadLockFile_Corrupted(t *testing.T) {
-	dir := t.TempDir()
-	path := filepath.Join(dir, "bad.json")
-	if err := os.WriteFile(path, []byte("{{{"), 0600); err != nil {
-		t.Fatal(err)
-	}
-
-	_, err := readLockFile(path)
-	if err == nil {
-		t.Error("expected error for corrupted file")
-	}
-}
-
-func TestReadLockFile_NonExistent(t *testing.T) {
-	_, err := readLockFile("/nonexistent/path/lock.json")
-	if err == nil {
-		t.Error("expected error for nonexistent file")
-	}
-}
-
 // --- showLockBrief ---
 
 func TestShowLockBrief_DeadPID(t *testing.T) {
@@ -617,7 +526,7 @@ func TestShowLockBrief_DeadPID(t *testing.T) {
 	})
 
 	stdout, _, _ := captureCmd(func(_ []string) int {
-		showLockBrief(rootDir, "dead-pid", false)
+		showLockBrief(os.Stdout, rootDir, "dead-pid", false)
 		return 0
 	}, nil)
 
@@ -639,7 +548,7 @@ func TestShowLockBrief_Expired(t *testing.T) {
 	})
 
 	stdout, _, _ := captureCmd(func(_ []string) int {
-		showLockBrief(rootDir, "exp", false)
+		showLockBrief(os.Stdout, rootDir, "exp", false)
 		return 0
 	}, nil)
 
@@ -666,7 +575,7 @@ func TestShowLockBrief_Freeze(t *testing.T) {
 	})
 
 	stdout, _, _ := captureCmd(func(_ []string) int {
-		showLockBrief(rootDir, "deploy", true)
+		showLockBrief(os.Stdout, rootDir, "deploy", true)
 		return 0
 	}, nil)
 
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Guard phases at which --simulate-crash-after can abort the process. The
+// flag exists for crash-recovery testing and is deliberately left out of
+// usage output.
+const (
+	crashAfterAcquire    = "acquire"
+	crashAfterChildStart = "child-start"
+	crashAfterChildExit  = "child-exit"
+)
+
+// crashExitCode mimics a SIGKILL'd process (128 + 9).
+const crashExitCode = 137
+
+// extractCrashFlag removes --simulate-crash-after (in any of the forms the
+// flag package accepts) from args, so the hidden flag never shows up in the
+// guard FlagSet's defaults. Returns the crash point, or "" if not set.
+func extractCrashFlag(args []string) (string, []string, error) {
+	point := ""
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		key, val, hasVal := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || key != "simulate-crash-after" {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasVal {
+			if i+1 >= len(args) {
+				return "", nil, errors.New("--simulate-crash-after requires a value")
+			}
+			i++
+			val = args[i]
+		}
+		switch val {
+		case crashAfterAcquire, crashAfterChildStart, crashAfterChildExit:
+			point = val
+		default:
+			return "", nil, fmt.Errorf("--simulate-crash-after must be %s, %s or %s",
+				crashAfterAcquire, crashAfterChildStart, crashAfterChildExit)
+		}
+	}
+	return point, rest, nil
+}
+
+// simulateCrash exits immediately if configured names phase. os.Exit skips
+// deferred cleanup, so the lock is left behind exactly as after a SIGKILL.
+func simulateCrash(configured, phase string) {
+	if configured != phase {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "lokt: simulating crash after %s\n", phase)
+	os.Exit(crashExitCode)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// readAuditLog parses every event in rootDir's audit log.
+func readAuditLog(t *testing.T, rootDir string) []audit.Event {
+	t.Helper()
+	f, err := os.Open(filepath.Join(rootDir, "audit.log"))
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+	var events []audit.Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e audit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func countEvents(events []audit.Event, name, event string) int {
+	n := 0
+	for _, e := range events {
+		if e.Name == name && e.Event == event {
+			n++
+		}
+	}
+	return n
+}
+
+// TestCrashRecovery_DeadPIDPrune crashes guard at each phase and verifies the
+// same-host recovery story: the orphaned lock is left on disk, status flags
+// the holder as dead, the audit log shows an acquire with no release, and the
+// next acquirer reclaims the lock immediately via auto-prune.
+func TestCrashRecovery_DeadPIDPrune(t *testing.T) {
+	binary := buildBinary(t)
+
+	for _, phase := range []string{crashAfterAcquire, crashAfterChildStart, crashAfterChildExit} {
+		t.Run(phase, func(t *testing.T) {
+			rootDir := setupIntegrationRoot(t)
+			const name = "crash-test"
+
+			_, stderr, code := runLoktAs(t, binary, rootDir, "crasher",
+				"guard", "--simulate-crash-after", phase, name, "--", "true")
+			if code != crashExitCode {
+				t.Fatalf("guard exit = %d, want %d (stderr: %s)", code, crashExitCode, stderr)
+			}
+
+			lf, err := lockfile.Read(filepath.Join(rootDir, "locks", name+".json"))
+			if err != nil {
+				t.Fatalf("crashed guard should leave its lock behind: %v", err)
+			}
+			if lf.Owner != "crasher" {
+				t.Errorf("orphaned lock owner = %q, want crasher", lf.Owner)
+			}
+
+			events := readAuditLog(t, rootDir)
+			if countEvents(events, name, audit.EventAcquire) != 1 || countEvents(events, name, audit.EventRelease) != 0 {
+				t.Errorf("audit should show acquire without release, got %+v", events)
+			}
+
+			stdout, _, _ := runLokt(t, binary, rootDir, "status")
+			if !strings.Contains(stdout, name) || !strings.Contains(stdout, "[DEAD]") {
+				t.Errorf("status should flag the orphaned lock as dead, got %q", stdout)
+			}
+			stdout, _, _ = runLokt(t, binary, rootDir, "status", "--json", name)
+			var out statusOutput
+			if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+				t.Fatalf("invalid status JSON: %v\n%s", err, stdout)
+			}
+			if out.PIDStatus != "dead" {
+				t.Errorf("pid_status = %q, want dead", out.PIDStatus)
+			}
+
+			_, stderr, code = runLoktAs(t, binary, rootDir, "recoverer", "lock", name)
+			if code != ExitOK {
+				t.Fatalf("recovery lock exit = %d, want %d (stderr: %s)", code, ExitOK, stderr)
+			}
+			events = readAuditLog(t, rootDir)
+			pruned := false
+			for _, e := range events {
+				if e.Event == audit.EventAutoPrune && e.Name == name {
+					pruned = e.Extra["stale_reason"] == "dead_pid" && e.Extra["pruned_owner"] == "crasher"
+				}
+			}
+			if !pruned {
+				t.Errorf("expected auto-prune of crasher's lock with stale_reason dead_pid, got %+v", events)
+			}
+		})
+	}
+}
+
+// TestCrashRecovery_TTLExpiry covers a holder whose liveness can't be checked
+// (crashed on another host): the lock blocks others until its TTL lapses
+// without heartbeat renewal, then a waiting acquirer breaks it.
+func TestCrashRecovery_TTLExpiry(t *testing.T) {
+	binary := buildBinary(t)
+	rootDir := setupIntegrationRoot(t)
+	const name = "crash-ttl"
+	lockPath := filepath.Join(rootDir, "locks", name+".json")
+
+	_, _, code := runLoktAs(t, binary, rootDir, "crasher",
+		"guard", "--ttl", "2s", "--simulate-crash-after", crashAfterAcquire, name, "--", "true")
+	if code != crashExitCode {
+		t.Fatalf("guard exit = %d, want %d", code, crashExitCode)
+	}
+
+	// Pretend the crash happened on another machine.
+	lf, err := lockfile.Read(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lf.Host = "remote-host"
+	if err := lockfile.Write(lockPath, lf); err != nil {
+		t.Fatal(err)
+	}
+	// Keep the cross-host skew grace short so the wait below stays quick.
+	if err := os.WriteFile(filepath.Join(rootDir, config.FileName), []byte(`{"clock_skew_grace": "1s"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, code := runLoktAs(t, binary, rootDir, "recoverer", "lock", name); code != ExitLockHeld {
+		t.Errorf("before expiry: lock exit = %d, want %d", code, ExitLockHeld)
+	}
+	if _, _, code := runLoktAs(t, binary, rootDir, "recoverer", "unlock", "--break-stale", name); code == ExitOK {
+		t.Error("before expiry: --break-stale should refuse an unexpired remote lock")
+	}
+
+	start := time.Now()
+	_, stderr, code := runLoktAs(t, binary, rootDir, "recoverer", "lock", "--wait", "--timeout", "10s", name)
+	if code != ExitOK {
+		t.Fatalf("waiting lock exit = %d, want %d (stderr: %s)", code, ExitOK, stderr)
+	}
+	if waited := time.Since(start); waited > 8*time.Second {
+		t.Errorf("waiter took %v; expected the lock to be broken shortly after TTL expiry", waited)
+	}
+
+	events := readAuditLog(t, rootDir)
+	broken := false
+	for _, e := range events {
+		if e.Event == audit.EventAutoPrune && e.Name == name && e.Extra["stale_reason"] == "expired" {
+			broken = true
+		}
+	}
+	if !broken {
+		t.Errorf("expected auto-prune with stale_reason expired, got %+v", events)
+	}
+}
+
+func TestExtractCrashFlag(t *testing.T) {
+	tests := []struct {
+		args      []string
+		wantPoint string
+		wantRest  []string
+		wantErr   bool
+	}{
+		{[]string{"--ttl", "5m", "build"}, "", []string{"--ttl", "5m", "build"}, false},
+		{[]string{"--simulate-crash-after", "acquire", "build"}, "acquire", []string{"build"}, false},
+		{[]string{"-simulate-crash-after=child-exit", "build"}, "child-exit", []string{"build"}, false},
+		{[]string{"--simulate-crash-after=later", "build"}, "", nil, true},
+		{[]string{"build", "--simulate-crash-after"}, "", nil, true},
+	}
+	for _, tt := range tests {
+		point, rest, err := extractCrashFlag(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: err = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if point != tt.wantPoint || strings.Join(rest, " ") != strings.Join(tt.wantRest, " ") {
+			t.Errorf("%v: got (%q, %v), want (%q, %v)", tt.args, point, rest, tt.wantPoint, tt.wantRest)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -108,6 +110,16 @@ func TestPrintCheckResult(t *testing.T) {
 			result: doctor.CheckResult{Name: "clock", Status: doctor.StatusOK},
 			want:   "Clock sanity",
 		},
+		{
+			name:   "webhooks-display-name",
+			result: doctor.CheckResult{Name: "webhooks", Status: doctor.StatusOK},
+			want:   "Webhooks",
+		},
+		{
+			name:   "misplaced-display-name",
+			result: doctor.CheckResult{Name: string(doctor.IssueMisplaced), Status: doctor.StatusWarn},
+			want:   "Misplaced locks",
+		},
 		{
 			name:   "unknown-name-passthrough",
 			result: doctor.CheckResult{Name: "custom_check", Status: doctor.StatusOK},
@@ -118,7 +130,7 @@ func TestPrintCheckResult(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			stdout, _, _ := captureCmd(func(_ []string) int {
-				printCheckResult(tc.result)
+				printCheckResult(os.Stdout, tc.result)
 				return 0
 			}, nil)
 			if !strings.Contains(stdout, tc.want) {
@@ -130,7 +142,7 @@ func TestPrintCheckResult(t *testing.T) {
 
 func TestPrintCheckResult_WithMessage(t *testing.T) {
 	stdout, _, _ := captureCmd(func(_ []string) int {
-		printCheckResult(doctor.CheckResult{
+		printCheckResult(os.Stdout, doctor.CheckResult{
 			Name:    "writable",
 			Status:  doctor.StatusWarn,
 			Message: "check details here",
@@ -159,3 +171,42 @@ func TestOverallDescription(t *testing.T) {
 		}
 	}
 }
+
+func TestCmdDoctor_Fix(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	corrupt := filepath.Join(locksDir, "garbled.json")
+	if err := os.WriteFile(corrupt, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, code := captureCmd(cmdDoctor, []string{"--json"})
+	var out doctorOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("invalid JSON: %v\noutput: %s", err, stdout)
+	}
+	if code != ExitOK || out.Overall != doctor.StatusWarn || out.Fixed == nil || len(out.Fixed) != 0 {
+		t.Errorf("without --fix: exit %d, overall %s, fixed %v; want a warning and nothing fixed", code, out.Overall, out.Fixed)
+	}
+
+	stdout, _, code = captureCmd(cmdDoctor, []string{"--json", "--fix"})
+	out = doctorOutput{}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("invalid JSON: %v\noutput: %s", err, stdout)
+	}
+	if code != ExitOK || len(out.Fixed) != 1 || out.Fixed[0].Name != "garbled" || out.Fixed[0].Action != "removed" {
+		t.Errorf("--fix: exit %d, fixed %+v; want garbled removed", code, out.Fixed)
+	}
+	if _, err := os.Stat(corrupt); !os.IsNotExist(err) {
+		t.Error("corrupted lock file should be removed")
+	}
+	for _, c := range out.Checks {
+		if c.Name == string(doctor.IssueCorrupt) && c.Status != doctor.StatusOK {
+			t.Errorf("after --fix: %s = %s %q", c.Name, c.Status, c.Message)
+		}
+	}
+
+	stdout, _, _ = captureCmd(cmdDoctor, []string{"--fix"})
+	if !strings.Contains(stdout, "Fixed: nothing to repair") {
+		t.Errorf("second --fix output lacks the nothing-to-repair line:\n%s", stdout)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envFlag collects guard's --env KEY=VALUE and --env-file settings in
+// command line order; appended to the environment, a later one overrides
+// an earlier one for the same key.
+type envFlag struct {
+	vars []string
+}
+
+func (e *envFlag) String() string {
+	if e == nil {
+		return ""
+	}
+	return strings.Join(e.vars, " ")
+}
+
+func (e *envFlag) Set(s string) error {
+	if err := checkEnvVar(s); err != nil {
+		return err
+	}
+	e.vars = append(e.vars, s)
+	return nil
+}
+
+// envFileFlag is --env-file: the file is read when the flag is parsed, so a
+// missing or malformed one fails the command before the lock is acquired.
+type envFileFlag struct {
+	env *envFlag
+}
+
+func (f envFileFlag) String() string { return "" }
+
+func (f envFileFlag) Set(path string) error {
+	vars, err := readEnvFile(path)
+	if err != nil {
+		return err
+	}
+	f.env.vars = append(f.env.vars, vars...)
+	return nil
+}
+
+// checkEnvVar checks that s is KEY=VALUE with a non-empty KEY.
+func checkEnvVar(s string) error {
+	if k, _, ok := strings.Cut(s, "="); !ok || strings.TrimSpace(k) == "" {
+		return fmt.Errorf("env %q: want KEY=VALUE", s)
+	}
+	return nil
+}
+
+// readEnvFile reads the KEY=VALUE lines of path, skipping blank lines and
+// # comments. Values are taken as is, quotes included.
+func readEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path) //nolint:gosec // G304: the user's own file
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var vars []string
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := checkEnvVar(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		vars = append(vars, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return vars, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// jsonErrorsEnv set to anything but "" or "0" is the same as --json-errors.
+const jsonErrorsEnv = "LOKT_JSON"
+
+// jsonErrors makes lock, unlock, renew, guard, freeze and unfreeze report
+// failures as one line of JSON on stderr (see errorOutput) instead of text,
+// for wrappers that would otherwise parse the messages. Set by the global
+// --json-errors flag or LOKT_JSON.
+var jsonErrors bool
+
+// Values of errorOutput.Error. These are stable; messages are not.
+const (
+	errCodeLockHeld      = "lock_held"
+	errCodeNotFound      = "not_found"
+	errCodeNotOwner      = "not_owner"
+	errCodeNotStale      = "not_stale"
+	errCodeHolderChanged = "holder_changed"
+	errCodeFrozen        = "frozen"
+	errCodeReserved      = "reserved"
+	errCodeTimeout       = "timeout"
+	errCodeDeadlock      = "deadlock"
+	errCodeLockLost      = "lock_lost"
+	errCodePolicy        = "policy_violation"
+	errCodeInterrupted   = "interrupted"
+	errCodeReadOnly      = "read_only"
+	errCodeUnsigned      = "unsigned"
+	errCodeBadSignature  = "bad_signature"
+	errCodeError         = "error"
+)
+
+// errorOutput is the --json-errors form of a failure.
+type errorOutput struct {
+	Error         string        `json:"error"`
+	Name          string        `json:"name,omitempty"`
+	Message       string        `json:"message"`
+	Holder        *holderOutput `json:"holder,omitempty"`
+	RetryAfterSec int           `json:"retry_after_sec,omitempty"`
+}
+
+// holderOutput describes the lock or freeze behind a failure: the holder
+// for lock_held, not_owner, not_stale, holder_changed and timeout, the
+// freeze for frozen, the reservation (its owner, until its end) for
+// reserved.
+type holderOutput struct {
+	Owner      string `json:"owner"`
+	Host       string `json:"host"`
+	PID        int    `json:"pid"`
+	AgentID    string `json:"agent_id,omitempty"`
+	AcquiredTS string `json:"acquired_ts"`
+	TTLSec     int    `json:"ttl_sec,omitempty"`
+	ExpiresAt  string `json:"expires_at,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// timeoutError is a wait on a lock or freeze that ran out of time. holder
+// is what blocked it at the end, or nil if that could not be read.
+type timeoutError struct {
+	holder     *lockfile.Lock
+	retryAfter time.Duration
+}
+
+func (e *timeoutError) Error() string { return context.DeadlineExceeded.Error() }
+
+func (e *timeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// reportError reports err, a failure of the command on name, on stderr.
+// As text it prints text, or "error: <err>" if text is empty; with
+// --json-errors it prints errorOutput with text (less "error: ") as the
+// message.
+func reportError(name string, err error, text string) {
+	if text == "" {
+		text = "error: " + err.Error()
+	}
+	if !jsonErrors {
+		fmt.Fprintln(os.Stderr, text)
+		return
+	}
+	out := errorJSON(name, err)
+	out.Message = strings.TrimPrefix(text, "error: ")
+	data, _ := json.Marshal(out)
+	fmt.Fprintln(os.Stderr, string(data))
+}
+
+// errorJSON maps err to its error code and holder details.
+func errorJSON(name string, err error) errorOutput {
+	out := errorOutput{Error: errCodeError, Name: name}
+	var (
+		held     *lock.HeldError
+		reserved *lock.ReservedError
+		frozen   *lock.FrozenError
+		notOwner *lock.NotOwnerError
+		mismatch *lock.TokenMismatchError
+		notStale *lock.NotStaleError
+		changed  *lock.HolderChangedError
+		timeout  *timeoutError
+	)
+	switch {
+	case errors.As(err, &reserved) && errors.As(err, &held):
+		out.Error, out.Holder = errCodeReserved, holderJSON(held.Lock)
+		out.RetryAfterSec = int(held.RetryAfter.Seconds())
+	case errors.As(err, &held):
+		out.Error, out.Holder = errCodeLockHeld, holderJSON(held.Lock)
+		out.RetryAfterSec = int(held.RetryAfter.Seconds())
+	case errors.As(err, &frozen):
+		out.Error, out.Holder = errCodeFrozen, holderJSON(frozen.Lock)
+		out.RetryAfterSec = int(frozen.RetryAfter.Seconds())
+	case errors.As(err, &notOwner):
+		out.Error, out.Holder = errCodeNotOwner, holderJSON(notOwner.Lock)
+	case errors.As(err, &mismatch):
+		out.Error, out.Holder = errCodeNotOwner, holderJSON(mismatch.Lock)
+	case errors.As(err, &notStale):
+		out.Error, out.Holder = errCodeNotStale, holderJSON(notStale.Lock)
+	case errors.As(err, &changed):
+		out.Error, out.Holder = errCodeHolderChanged, holderJSON(changed.Lock)
+	case errors.As(err, &timeout):
+		out.Error, out.Holder = errCodeTimeout, holderJSON(timeout.holder)
+		out.RetryAfterSec = int(timeout.retryAfter.Seconds())
+	case errors.Is(err, context.DeadlineExceeded):
+		out.Error = errCodeTimeout
+	case errors.Is(err, context.Canceled):
+		out.Error = errCodeInterrupted
+	case errors.Is(err, lock.ErrDeadlock):
+		out.Error = errCodeDeadlock
+	case errors.Is(err, lock.ErrLockStolen), errors.Is(err, lock.ErrLockLost):
+		out.Error = errCodeLockLost
+	case errors.Is(err, lock.ErrPolicy):
+		out.Error = errCodePolicy
+	case errors.Is(err, root.ErrReadOnly):
+		out.Error = errCodeReadOnly
+	case errors.Is(err, lockfile.ErrUnsigned):
+		out.Error = errCodeUnsigned
+	case errors.Is(err, lockfile.ErrBadSignature):
+		out.Error = errCodeBadSignature
+	case errors.Is(err, lock.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		out.Error = errCodeNotFound
+	}
+	return out
+}
+
+// holderJSON describes lk, or returns nil for a nil or anonymous lock.
+func holderJSON(lk *lockfile.Lock) *holderOutput {
+	if lk == nil || lk.Owner == "" {
+		return nil
+	}
+	h := &holderOutput{
+		Owner:      lk.Owner,
+		Host:       lk.Host,
+		PID:        lk.PID,
+		AgentID:    lk.AgentID,
+		AcquiredTS: lk.AcquiredAt.Format(time.RFC3339),
+		TTLSec:     lk.TTLSec,
+		Message:    lk.Message,
+	}
+	if lk.ExpiresAt != nil {
+		h.ExpiresAt = lk.ExpiresAt.Format(time.RFC3339)
+	}
+	return h
+}
+
+// stripJSONErrorsFlag removes leading --json-errors flags from args (the
+// command line after the program name), setting jsonErrors if any were
+// given or LOKT_JSON is set.
+func stripJSONErrorsFlag(args []string) []string {
+	for len(args) > 0 && (args[0] == "--json-errors" || args[0] == "-json-errors") {
+		jsonErrors = true
+		args = args[1:]
+	}
+	if v := os.Getenv(jsonErrorsEnv); v != "" && v != "0" {
+		jsonErrors = true
+	}
+	return args
+}
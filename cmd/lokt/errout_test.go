@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func withJSONErrors(t *testing.T) {
+	t.Helper()
+	jsonErrors = true
+	t.Cleanup(func() { jsonErrors = false })
+}
+
+func parseErrorJSON(t *testing.T, stderr string) errorOutput {
+	t.Helper()
+	if strings.Count(strings.TrimSpace(stderr), "\n") != 0 {
+		t.Fatalf("stderr = %q, want a single line", stderr)
+	}
+	var out errorOutput
+	if err := json.Unmarshal([]byte(stderr), &out); err != nil {
+		t.Fatalf("stderr %q is not JSON: %v", stderr, err)
+	}
+	return out
+}
+
+func TestJSONErrors(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "me")
+	withJSONErrors(t)
+
+	acquired := time.Now().Add(-time.Minute).Truncate(time.Second)
+	expires := acquired.Add(61 * time.Minute)
+	writeLockJSON(t, locksDir, "held.json", &lockfile.Lock{
+		Name: "held", Owner: "alice", Host: "other-host", PID: 42,
+		AcquiredAt: acquired, TTLSec: 3660, ExpiresAt: &expires,
+	})
+
+	tests := []struct {
+		name     string
+		cmd      func([]string) int
+		args     []string
+		wantCode int
+		wantErr  string
+		holder   bool
+	}{
+		{"lock/held", cmdLock, []string{"held"}, ExitLockHeld, errCodeLockHeld, true},
+		{"lock/timeout", cmdLock, []string{"--wait", "--timeout", "50ms", "held"}, ExitLockHeld, errCodeTimeout, true},
+		{"unlock/not-owner", cmdUnlock, []string{"held"}, ExitNotOwner, errCodeNotOwner, true},
+		{"unlock/not-found", cmdUnlock, []string{"missing"}, ExitNotFound, errCodeNotFound, false},
+		{"renew/not-found", cmdRenew, []string{"missing"}, ExitNotFound, errCodeNotFound, false},
+		{"unfreeze/not-found", cmdUnfreeze, []string{"missing"}, ExitNotFound, errCodeNotFound, false},
+		{"guard/held", cmdGuard, []string{"held", "--", "true"}, ExitLockHeld, errCodeLockHeld, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stderr, code := captureCmd(tt.cmd, tt.args)
+			if code != tt.wantCode {
+				t.Fatalf("exit = %d, want %d (stderr %q)", code, tt.wantCode, stderr)
+			}
+			out := parseErrorJSON(t, stderr)
+			if out.Error != tt.wantErr || out.Message == "" || !slices.Contains(tt.args, out.Name) {
+				t.Errorf("error = %+v, want %s for a name in %v", out, tt.wantErr, tt.args)
+			}
+			if !tt.holder {
+				return
+			}
+			want := holderOutput{
+				Owner: "alice", Host: "other-host", PID: 42, TTLSec: 3660,
+				AcquiredTS: acquired.Format(time.RFC3339), ExpiresAt: expires.Format(time.RFC3339),
+			}
+			if out.Holder == nil || *out.Holder != want {
+				t.Errorf("holder = %+v, want %+v", out.Holder, want)
+			}
+		})
+	}
+}
+
+func TestJSONErrors_Frozen(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "me")
+	if _, _, code := captureCmd(cmdFreeze, []string{"--ttl", "1h", "deploy"}); code != ExitOK {
+		t.Fatalf("freeze: exit %d", code)
+	}
+	withJSONErrors(t)
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"deploy", "--", "true"})
+	if code != ExitLockHeld {
+		t.Fatalf("guard on a frozen name: exit %d, want %d", code, ExitLockHeld)
+	}
+	if out := parseErrorJSON(t, stderr); out.Error != errCodeFrozen || out.Holder == nil || out.Holder.Owner != "me" || out.RetryAfterSec == 0 {
+		t.Errorf("error = %+v, want frozen by me with a retry hint", out)
+	}
+}
+
+func TestStripJSONErrorsFlag(t *testing.T) {
+	t.Cleanup(func() { jsonErrors = false })
+
+	jsonErrors = false
+	if args := stripJSONErrorsFlag([]string{"--json-errors", "lock", "x"}); !slices.Equal(args, []string{"lock", "x"}) || !jsonErrors {
+		t.Errorf("stripJSONErrorsFlag() = %v, jsonErrors %v", args, jsonErrors)
+	}
+	jsonErrors = false
+	if args := stripJSONErrorsFlag([]string{"lock", "--json-errors"}); len(args) != 2 || jsonErrors {
+		t.Errorf("a flag after the command = %v, jsonErrors %v; want it left to the command", args, jsonErrors)
+	}
+	t.Setenv(jsonErrorsEnv, "1")
+	if stripJSONErrorsFlag([]string{"lock"}); !jsonErrors {
+		t.Error("LOKT_JSON=1 should enable JSON errors")
+	}
+}
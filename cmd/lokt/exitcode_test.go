@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
 )
 
 // TestExitCodeContract is a table-driven test that systematically verifies
@@ -58,9 +59,16 @@ func TestExitCodeContract(t *testing.T) {
 		{
 			name:     "lock/invalid-name",
 			cmd:      cmdLock,
-			args:     []string{"bad/name"},
+			args:     []string{"bad//name"},
 			wantCode: ExitError,
 		},
+		{
+			name:     "lock/wait-deadlock",
+			cmd:      cmdLock,
+			args:     []string{"--wait", "--timeout", "5s", "cache"},
+			setup:    setupDeadlock,
+			wantCode: ExitDeadlock,
+		},
 
 		// ── unlock command ──────────────────────────────────────────
 		{
@@ -138,7 +146,7 @@ func TestExitCodeContract(t *testing.T) {
 		{
 			name:     "exists/invalid-name",
 			cmd:      cmdExists,
-			args:     []string{"bad/name"},
+			args:     []string{"bad//name"},
 			wantCode: ExitError,
 		},
 
@@ -192,6 +200,13 @@ func TestExitCodeContract(t *testing.T) {
 			args:     []string{"lockname", "true"},
 			wantCode: ExitUsage,
 		},
+		{
+			name:     "guard/wait-deadlock",
+			cmd:      cmdGuard,
+			args:     []string{"--wait", "--timeout", "5s", "cache", "--", "true"},
+			setup:    setupDeadlock,
+			wantCode: ExitDeadlock,
+		},
 
 		// ── freeze command ──────────────────────────────────────────
 		{
@@ -286,3 +301,23 @@ func TestExitCodeContract(t *testing.T) {
 		})
 	}
 }
+
+// setupDeadlock makes waiting for "cache" a deadlock: me holds "db", and
+// bob, who holds "cache", has been waiting for "db" for a minute.
+func setupDeadlock(t *testing.T, rootDir, locksDir string) {
+	t.Setenv("LOKT_OWNER", "me")
+	for name, owner := range map[string]string{"db": "me", "cache": "bob"} {
+		writeLockJSON(t, locksDir, name+".json", &lockfile.Lock{
+			Version: 1, Name: name, Owner: owner, Host: "h",
+			PID: os.Getpid(), AcquiredAt: time.Now(),
+		})
+	}
+	intents := root.IntentDirPath(rootDir, "db")
+	if err := os.MkdirAll(intents, 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeLockJSON(t, intents, "h.1.json", &lockfile.Lock{
+		Version: 1, Name: "db", Owner: "bob", Host: "h",
+		PID: 1, AcquiredAt: time.Now().Add(-time.Minute),
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// exitCodesEnv selects the exit-code scheme; --exit-codes sets it, so any
+// lokt the command starts uses the same one.
+const exitCodesEnv = "LOKT_EXIT_CODES"
+
+// Exit-code schemes. v1, the default for now, reports a frozen lock and a
+// wait that timed out as ExitLockHeld, like a held one; v2 gives them
+// ExitFrozen and ExitTimeout.
+const (
+	exitCodesV1 = "v1"
+	exitCodesV2 = "v2"
+)
+
+// stripExitCodesFlag removes leading --exit-codes flags ("--exit-codes v2"
+// or "--exit-codes=v2") from args and exports the last one as
+// LOKT_EXIT_CODES.
+func stripExitCodesFlag(args []string) ([]string, error) {
+	for len(args) > 0 {
+		name, value, hasValue := strings.Cut(args[0], "=")
+		if name != "--exit-codes" && name != "-exit-codes" {
+			break
+		}
+		args = args[1:]
+		if !hasValue {
+			if len(args) == 0 {
+				return nil, errors.New("--exit-codes needs a scheme (v1 or v2)")
+			}
+			value, args = args[0], args[1:]
+		}
+		if err := checkExitCodes(value); err != nil {
+			return nil, fmt.Errorf("--exit-codes: %w", err)
+		}
+		if err := os.Setenv(exitCodesEnv, value); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// checkExitCodes checks that s names an exit-code scheme.
+func checkExitCodes(s string) error {
+	if s != exitCodesV1 && s != exitCodesV2 {
+		return fmt.Errorf("%q is not an exit-code scheme (v1 or v2)", s)
+	}
+	return nil
+}
+
+// configureExitCodes checks LOKT_EXIT_CODES, if set.
+func configureExitCodes() error {
+	if s := os.Getenv(exitCodesEnv); s != "" {
+		if err := checkExitCodes(s); err != nil {
+			return fmt.Errorf("%s: %w", exitCodesEnv, err)
+		}
+	}
+	return nil
+}
+
+// exitCodeScheme returns the active exit-code scheme.
+func exitCodeScheme() string {
+	if os.Getenv(exitCodesEnv) == exitCodesV2 {
+		return exitCodesV2
+	}
+	return exitCodesV1
+}
+
+// exitFrozen is the exit code for a lock or name that is frozen.
+func exitFrozen() int {
+	if exitCodeScheme() == exitCodesV2 {
+		return ExitFrozen
+	}
+	return ExitLockHeld
+}
+
+// exitTimeout is the exit code for a --wait (or thaw wait) that timed out.
+func exitTimeout() int {
+	if exitCodeScheme() == exitCodesV2 {
+		return ExitTimeout
+	}
+	return ExitLockHeld
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestStripExitCodesFlag(t *testing.T) {
+	t.Setenv(exitCodesEnv, "")
+
+	args, err := stripExitCodesFlag([]string{"--exit-codes", "v1", "--exit-codes=v2", "guard", "build"})
+	if err != nil || !slices.Equal(args, []string{"guard", "build"}) {
+		t.Fatalf("stripExitCodesFlag() = %v, %v", args, err)
+	}
+	if got := os.Getenv(exitCodesEnv); got != exitCodesV2 || exitCodeScheme() != exitCodesV2 {
+		t.Errorf("LOKT_EXIT_CODES = %q, want v2", got)
+	}
+	for _, bad := range [][]string{{"--exit-codes"}, {"--exit-codes=v3", "lock"}} {
+		if _, err := stripExitCodesFlag(bad); err == nil {
+			t.Errorf("stripExitCodesFlag(%v) should fail", bad)
+		}
+	}
+
+	t.Setenv(exitCodesEnv, "2")
+	if err := configureExitCodes(); err == nil {
+		t.Error("LOKT_EXIT_CODES=2: want an error")
+	}
+	t.Setenv(exitCodesEnv, "")
+	if err := configureExitCodes(); err != nil || exitCodeScheme() != exitCodesV1 {
+		t.Errorf("unset: %v, scheme %q; want v1", err, exitCodeScheme())
+	}
+}
+
+func TestExitCodes_Schemes(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "oncall")
+	if code := cmdFreeze([]string{"--ttl", "3m", "deploy"}); code != ExitOK {
+		t.Fatalf("freeze failed: %d", code)
+	}
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Name: "build", Owner: "alice", Host: "h", PID: os.Getpid(), AcquiredAt: time.Now(), TTLSec: 300,
+	})
+	t.Setenv("LOKT_OWNER", "me")
+
+	cases := []struct {
+		name   string
+		cmd    func([]string) int
+		args   []string
+		v1, v2 int
+	}{
+		{"lock held", cmdLock, []string{"build"}, ExitLockHeld, ExitLockHeld},
+		{"lock frozen", cmdLock, []string{"--respect-freeze", "deploy"}, ExitLockHeld, ExitFrozen},
+		{"lock wait timeout", cmdLock, []string{"--wait", "--timeout", "50ms", "build"}, ExitLockHeld, ExitTimeout},
+		{"guard held", cmdGuard, []string{"build", "--", "true"}, ExitLockHeld, ExitLockHeld},
+		{"guard frozen", cmdGuard, []string{"deploy", "--", "true"}, ExitLockHeld, ExitFrozen},
+		{"guard wait timeout", cmdGuard, []string{"--wait", "--timeout", "50ms", "build", "--", "true"}, ExitLockHeld, ExitTimeout},
+		{"guard thaw timeout", cmdGuard, []string{"--wait-thaw", "--timeout", "50ms", "deploy", "--", "true"}, ExitLockHeld, ExitTimeout},
+		{"freeze frozen by another", cmdFreeze, []string{"--ttl", "3m", "deploy"}, ExitLockHeld, ExitFrozen},
+	}
+	for _, scheme := range []string{exitCodesV1, exitCodesV2} {
+		t.Setenv(exitCodesEnv, scheme)
+		for _, tc := range cases {
+			want := tc.v1
+			if scheme == exitCodesV2 {
+				want = tc.v2
+			}
+			if _, stderr, code := captureCmd(tc.cmd, tc.args); code != want {
+				t.Errorf("%s %s: exit %d, want %d (stderr %q)", scheme, tc.name, code, want, stderr)
+			}
+		}
+	}
+}
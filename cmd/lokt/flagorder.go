@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+// interspersed reorders args so the flags come before the positional
+// arguments, which Go's flag package otherwise stops at: "lokt freeze deploy
+// --ttl 5m" parses --ttl. A flag keeps the argument after it as its value
+// unless fs defines it as a boolean or it is written --flag=value. "-" (for
+// stdin) is positional, and so is everything from "--" on, in order.
+func interspersed(fs *flag.FlagSet, args []string) []string {
+	var flags, pos []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			return append(append(flags, pos...), args[i:]...)
+		case len(a) < 2 || a[0] != '-':
+			pos = append(pos, a)
+		default:
+			flags = append(flags, a)
+			name := strings.TrimLeft(a, "-")
+			if !strings.Contains(name, "=") && !isBoolFlag(fs, name) && i+1 < len(args) {
+				i++
+				flags = append(flags, args[i])
+			}
+		}
+	}
+	return append(flags, pos...)
+}
+
+// isBoolFlag reports whether fs defines name as a flag without a value.
+func isBoolFlag(fs *flag.FlagSet, name string) bool {
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
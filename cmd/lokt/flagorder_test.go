@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"testing"
+)
+
+func TestInterspersed(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("root", "", "")
+	fs.Bool("dry-run", false, "")
+	fs.Duration("ttl", 0, "")
+
+	tests := []struct {
+		args, want []string
+	}{
+		{[]string{"a.tgz", "--root", "/r", "--dry-run"}, []string{"--root", "/r", "--dry-run", "a.tgz"}},
+		{[]string{"--dry-run", "a.tgz"}, []string{"--dry-run", "a.tgz"}},
+		{[]string{"-", "--ttl=5m"}, []string{"--ttl=5m", "-"}},
+		{[]string{"deploy", "--dry-run", "build"}, []string{"--dry-run", "deploy", "build"}},
+		{[]string{"deploy", "--ttl", "-1s"}, []string{"--ttl", "-1s", "deploy"}},
+		{[]string{"deploy", "--", "cmd", "--ttl", "1m"}, []string{"deploy", "--", "cmd", "--ttl", "1m"}},
+		{[]string{"deploy", "--ttl"}, []string{"--ttl", "deploy"}},
+	}
+	for _, tt := range tests {
+		if got := interspersed(fs, tt.args); !slices.Equal(got, tt.want) {
+			t.Errorf("interspersed(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
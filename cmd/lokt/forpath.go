@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+)
+
+// nameForPathFlag resolves a --for-path value to the lock name standing for
+// that file (lock.NameForPath) and its cleaned absolute path, for the lock
+// file to record. The code is ExitUsage, after reporting why, if the path
+// can't be resolved.
+func nameForPathFlag(path string) (name, abs string, code int) {
+	name, err := lock.NameForPath(path)
+	if err == nil {
+		abs, err = filepath.Abs(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: --for-path: %v\n", err)
+		return "", "", ExitUsage
+	}
+	return name, abs, ExitOK
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// freezeScope is what a freeze covers: name, every name if name is
+// lock.GlobalFreeze, or with match the names the pattern name matches
+// (freeze --match).
+type freezeScope struct {
+	name  string
+	match bool
+}
+
+// holders returns the live holders of the names s covers.
+func (s freezeScope) holders(rootDir string) ([]*lockfile.Lock, error) {
+	if s.match {
+		return lock.HoldersMatching(rootDir, s.name)
+	}
+	return lock.Holders(rootDir, s.name)
+}
+
+// warnHolders tells the operator who still holds a name of s just after
+// freezing it: a freeze blocks new acquisitions, not a guard already
+// running.
+func warnHolders(rootDir string, s freezeScope) {
+	holders, err := s.holders(rootDir)
+	if err != nil {
+		return // the freeze is in place; only the warning is lost
+	}
+	for _, h := range holders {
+		fmt.Fprintf(os.Stderr, "warning: %s; the freeze doesn't stop it (--wait-idle waits for it)\n", describeHolder(h))
+	}
+}
+
+// waitIdle implements freeze --wait-idle: it polls the holders of the
+// names s covers on the root's retry schedule until there are none,
+// reporting them as they change. It returns ExitLockHeld if some remain
+// after timeout; the freeze stays either way.
+func waitIdle(rootDir string, s freezeScope, timeout time.Duration) int {
+	ctx, cancel := waitContext(timeout, waitBudgetDeadline(0, time.Now()))
+	defer cancel()
+	retry := waitRetryPolicy(rootDir)
+
+	var reported map[string]bool
+	for attempt := 0; ; attempt++ {
+		holders, err := s.holders(rootDir)
+		if err != nil {
+			reportError(s.name, err, "")
+			return ExitError
+		}
+		if len(holders) == 0 {
+			switch {
+			case s.match:
+				fmt.Printf("idle: no lock matching %q is held\n", s.name)
+			case s.name == lock.GlobalFreeze:
+				fmt.Println("idle: no locks held")
+			default:
+				fmt.Printf("idle: lock %q is not held\n", s.name)
+			}
+			return ExitOK
+		}
+		current := make(map[string]bool, len(holders))
+		for _, h := range holders {
+			key := h.Name + "\x00" + h.LockID
+			current[key] = true
+			if !reported[key] {
+				fmt.Fprintf(os.Stderr, "waiting for: %s\n", describeHolder(h))
+			}
+		}
+		reported = current
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				fmt.Fprintf(os.Stderr, "interrupted while waiting for %s to go idle; the freeze stays\n", s)
+				return ExitError
+			}
+			held := &lock.HeldError{Lock: holders[0]}
+			reportError(holders[0].Name, held, fmt.Sprintf("error: still held after waiting%s: %v; the freeze stays", budgetNote(ctx), held))
+			return ExitLockHeld
+		case <-time.After(retry.Interval(attempt)):
+		}
+	}
+}
+
+// describeHolder describes a live holder as a held lock is reported.
+func describeHolder(h *lockfile.Lock) string {
+	return (&lock.HeldError{Lock: h}).Error()
+}
+
+// String names what s covers in messages.
+func (s freezeScope) String() string {
+	switch {
+	case s.match:
+		return fmt.Sprintf("locks matching %q", s.name)
+	case s.name == lock.GlobalFreeze:
+		return "all locks"
+	}
+	return fmt.Sprintf("lock %q", s.name)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFreeze_WarnsAboutHolder(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "deployer")
+	if _, stderr, code := captureCmd(cmdLock, []string{"deploy"}); code != ExitOK {
+		t.Fatalf("lock: exit %d, stderr %q", code, stderr)
+	}
+
+	_, stderr, code := captureCmd(cmdFreeze, []string{"--ttl", "10m", "deploy"})
+	if code != ExitOK || !strings.Contains(stderr, "warning:") || !strings.Contains(stderr, "held by deployer") {
+		t.Errorf("freeze: exit %d, stderr %q; want success with the holder named", code, stderr)
+	}
+	if _, _, code := captureCmd(cmdUnfreeze, []string{"deploy"}); code != ExitOK {
+		t.Fatalf("unfreeze: exit %d", code)
+	}
+	if _, stderr, _ := captureCmd(cmdFreeze, []string{"--ttl", "10m", "other"}); stderr != "" {
+		t.Errorf("freeze of a free name: stderr %q, want no warning", stderr)
+	}
+}
+
+func TestFreeze_WaitIdle(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "deployer")
+	if _, stderr, code := captureCmd(cmdLock, []string{"deploy"}); code != ExitOK {
+		t.Fatalf("lock: exit %d, stderr %q", code, stderr)
+	}
+
+	_, stderr, code := captureCmd(cmdFreeze, []string{"--ttl", "10m", "--wait-idle", "--timeout", "300ms", "deploy"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "waiting for:") || !strings.Contains(stderr, "still held") {
+		t.Errorf("freeze --wait-idle on a held lock: exit %d, stderr %q; want %d after the timeout", code, stderr, ExitLockHeld)
+	}
+	if _, stderr, code := captureCmd(cmdGuard, []string{"deploy", "--", "true"}); code != ExitLockHeld || !strings.Contains(stderr, "frozen") {
+		t.Errorf("guard after the timeout: exit %d, stderr %q; want the freeze kept", code, stderr)
+	}
+	if _, _, code := captureCmd(cmdUnfreeze, []string{"deploy"}); code != ExitOK {
+		t.Fatalf("unfreeze: exit %d", code)
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = os.Remove(filepath.Join(locksDir, "deploy.json"))
+	}()
+	stdout, stderr, code := captureCmd(cmdFreeze, []string{"deploy", "--ttl", "10m", "--wait-idle", "--timeout", "5s"})
+	if code != ExitOK || !strings.Contains(stdout, "idle") {
+		t.Errorf("freeze --wait-idle with the lock released: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+
+	for _, args := range [][]string{{"--ttl", "10m", "--timeout", "1s", "x"}, {"--ttl", "10m", "--wait-idle", "--timeout", "-1s", "x"}} {
+		if _, _, code := captureCmd(cmdFreeze, args); code != ExitUsage {
+			t.Errorf("freeze %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
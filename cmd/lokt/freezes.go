@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// Kinds of freeze in lokt freezes.
+const (
+	freezeKindGlobal  = "global"  // freeze --all
+	freezeKindName    = "name"    // freeze <name>
+	freezeKindPattern = "pattern" // freeze --match
+)
+
+// freezeOutput is one entry of lokt freezes --json.
+type freezeOutput struct {
+	Name         string `json:"name"` // the pattern, for a pattern freeze
+	Kind         string `json:"kind"`
+	Owner        string `json:"owner"`
+	Host         string `json:"host"`
+	AgentID      string `json:"agent_id,omitempty"`
+	AcquiredAt   string `json:"acquired_ts"`
+	ExpiresAt    string `json:"expires_at,omitempty"`
+	RemainingSec int    `json:"remaining_sec"`
+	Reason       string `json:"reason,omitempty"`
+	Path         string `json:"path"`
+	// Legacy marks a freeze at locks/freeze-<name>.json, where lokt kept
+	// freezes before freezes/.
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// cmdFreezes lists the active freezes: the global one, those by name
+// (legacy ones included) and pattern freezes.
+func cmdFreezes(args []string) int {
+	fs := flag.NewFlagSet("freezes", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: lokt freezes [--json]")
+		return ExitUsage
+	}
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	freezes, err := lock.ActiveFreezes(rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	outputs := make([]freezeOutput, 0, len(freezes))
+	for _, fz := range freezes {
+		outputs = append(outputs, freezeOutputOf(fz))
+	}
+	if *jsonOutput {
+		data, _ := json.MarshalIndent(outputs, "", "  ")
+		fmt.Println(string(data))
+		return ExitOK
+	}
+	printFreezes(os.Stdout, outputs)
+	return ExitOK
+}
+
+// freezeOutputOf converts an active freeze to its lokt freezes entry.
+func freezeOutputOf(fz lock.ActiveFreeze) freezeOutput {
+	out := freezeOutput{
+		Name:         fz.Name,
+		Kind:         freezeKindName,
+		Owner:        fz.Lock.Owner,
+		Host:         fz.Lock.Host,
+		AgentID:      fz.Lock.AgentID,
+		AcquiredAt:   fz.Lock.AcquiredAt.Format(time.RFC3339),
+		RemainingSec: int(fz.Lock.Remaining().Seconds()),
+		Reason:       fz.Lock.Message,
+		Path:         fz.Path,
+		Legacy:       fz.Legacy,
+	}
+	switch {
+	case fz.Lock.Pattern:
+		out.Kind = freezeKindPattern
+	case fz.Name == lock.GlobalFreeze:
+		out.Kind = freezeKindGlobal
+	}
+	if exp, ok := fz.Lock.Expiry(); ok {
+		out.ExpiresAt = exp.Format(time.RFC3339)
+	}
+	return out
+}
+
+// printFreezes prints freezes as lokt freezes does without --json.
+func printFreezes(w io.Writer, freezes []freezeOutput) {
+	if len(freezes) == 0 {
+		fmt.Fprintln(w, "no active freezes")
+		return
+	}
+	fmt.Fprintf(w, "%-20s  %-7s  %-24s  %-9s  %s\n", "NAME", "KIND", "OWNER", "LEFT", "REASON")
+	for _, fz := range freezes {
+		name := fz.Name
+		if fz.Kind == freezeKindGlobal {
+			name = "(all)"
+		}
+		left := "-"
+		if fz.RemainingSec > 0 {
+			left = (time.Duration(fz.RemainingSec) * time.Second).String()
+		}
+		reason := fz.Reason
+		if fz.Legacy {
+			reason += " (legacy location; lokt doctor --fix moves it)"
+		}
+		fmt.Fprintf(w, "%-20s  %-7s  %-24s  %-9s  %s\n", name, fz.Kind, fz.Owner+"@"+fz.Host, left, reason)
+	}
+}
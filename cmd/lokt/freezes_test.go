@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFreezeMatch(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "deployer")
+	if _, stderr, code := captureCmd(cmdLock, []string{"deploy-api"}); code != ExitOK {
+		t.Fatalf("lock: exit %d, stderr %q", code, stderr)
+	}
+
+	stdout, stderr, code := captureCmd(cmdFreeze, []string{"--ttl", "10m", "--reason", "release", "--match", "deploy-*"})
+	if code != ExitOK || !strings.Contains(stdout, `frozen locks matching "deploy-*"`) || !strings.Contains(stdout, "now: deploy-api") {
+		t.Fatalf("freeze --match: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if !strings.Contains(stderr, "held by deployer") {
+		t.Errorf("freeze --match: stderr %q, want the holder of deploy-api warned about", stderr)
+	}
+	if _, stderr, code := captureCmd(cmdGuard, []string{"deploy-web", "--", "true"}); code != ExitLockHeld || !strings.Contains(stderr, `matching "deploy-*" frozen`) {
+		t.Errorf("guard deploy-web: exit %d, stderr %q; want the pattern freeze", code, stderr)
+	}
+	if _, _, code := captureCmd(cmdGuard, []string{"build", "--", "true"}); code != ExitOK {
+		t.Errorf("guard build: exit %d, want %d", code, ExitOK)
+	}
+
+	for _, args := range [][]string{
+		{"--ttl", "10m", "--match", "deploy"},           // no wildcard
+		{"--ttl", "10m", "--match", "dep["},             // malformed
+		{"--ttl", "10m", "--match", "deploy-*", "name"}, // two targets
+		{"--ttl", "10m", "--all", "--match", "deploy-*"},
+	} {
+		if _, _, code := captureCmd(cmdFreeze, args); code != ExitUsage {
+			t.Errorf("freeze %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+
+	if _, _, code := captureCmd(cmdUnfreeze, []string{"--match", "deploy-*"}); code != ExitOK {
+		t.Fatalf("unfreeze --match: exit %d", code)
+	}
+	if _, stderr, code := captureCmd(cmdUnfreeze, []string{"--match", "deploy-*"}); code != ExitNotFound || !strings.Contains(stderr, "no freeze on pattern") {
+		t.Errorf("second unfreeze --match: exit %d, stderr %q; want %d", code, stderr, ExitNotFound)
+	}
+}
+
+func TestFreezes(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "oncall")
+	if stdout, _, code := captureCmd(cmdFreezes, nil); code != ExitOK || !strings.Contains(stdout, "no active freezes") {
+		t.Errorf("freezes with none: exit %d, stdout %q", code, stdout)
+	}
+	for _, args := range [][]string{
+		{"--ttl", "10m", "--reason", "incident", "--all"},
+		{"--ttl", "5m", "deploy"},
+		{"--ttl", "10m", "--match", "web-*"},
+	} {
+		if _, stderr, code := captureCmd(cmdFreeze, args); code != ExitOK {
+			t.Fatalf("freeze %v: exit %d, stderr %q", args, code, stderr)
+		}
+	}
+
+	stdout, _, code := captureCmd(cmdFreezes, nil)
+	if code != ExitOK || !strings.Contains(stdout, "(all)") || !strings.Contains(stdout, "incident") || !strings.Contains(stdout, "web-*") {
+		t.Errorf("freezes: exit %d, stdout %q", code, stdout)
+	}
+
+	stdout, _, code = captureCmd(cmdFreezes, []string{"--json"})
+	var out []freezeOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil || code != ExitOK {
+		t.Fatalf("freezes --json: exit %d, %v: %q", code, err, stdout)
+	}
+	var got []string
+	for _, fz := range out {
+		got = append(got, fz.Name+":"+fz.Kind)
+		if fz.Owner != "oncall" || fz.RemainingSec <= 0 {
+			t.Errorf("freeze %s: owner %q, remaining %ds", fz.Name, fz.Owner, fz.RemainingSec)
+		}
+	}
+	if want := "__all__:global deploy:name web-*:pattern"; strings.Join(got, " ") != want {
+		t.Errorf("freezes --json = %q, want %q", strings.Join(got, " "), want)
+	}
+
+	if _, _, code := captureCmd(cmdFreezes, []string{"extra"}); code != ExitUsage {
+		t.Errorf("freezes extra: exit %d, want %d", code, ExitUsage)
+	}
+}
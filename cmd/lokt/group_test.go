@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// setupGroupRoot configures exclusion group "db" and has another owner hold
+// its member db-migrate.
+func setupGroupRoot(t *testing.T) string {
+	t.Helper()
+	rootDir, locksDir := setupTestRoot(t)
+	cfg := `{"exclusion_groups": {"db": ["db-migrate", "db-restore"]}}`
+	if err := os.WriteFile(filepath.Join(rootDir, "config.json"), []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeLockJSON(t, locksDir, "db-migrate.json", &lockfile.Lock{
+		Version: 1, Name: "db-migrate", Owner: "other", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+	return rootDir
+}
+
+func TestLock_ExclusionConflict(t *testing.T) {
+	setupGroupRoot(t)
+
+	_, stderr, code := captureCmd(cmdLock, []string{"db-restore"})
+	if code != ExitLockHeld {
+		t.Fatalf("lock db-restore: exit %d, want %d (stderr %q)", code, ExitLockHeld, stderr)
+	}
+	if !strings.Contains(stderr, `excluded by group "db": lock "db-migrate" held by other@other-host`) {
+		t.Errorf("stderr = %q, want the conflicting member", stderr)
+	}
+
+	_, stderr, code = captureCmd(cmdCheck, []string{"db-restore"})
+	if code != ExitLockHeld || !strings.Contains(stderr, `excluded by group "db"`) {
+		t.Errorf("check db-restore: exit %d, stderr %q; want conflict", code, stderr)
+	}
+}
+
+func TestStatus_Group(t *testing.T) {
+	setupGroupRoot(t)
+
+	stdout, stderr, code := captureCmd(cmdStatus, []string{"--group", "db"})
+	if code != ExitOK {
+		t.Fatalf("status --group db: exit %d (stderr %q)", code, stderr)
+	}
+	if !strings.HasPrefix(stdout, "group db: held by db-migrate\n") {
+		t.Errorf("stdout = %q, want combined state first", stdout)
+	}
+	if !strings.Contains(stdout, "db-migrate            other@other-host") || !strings.Contains(stdout, "db-restore            free") {
+		t.Errorf("stdout = %q, want one line per member", stdout)
+	}
+
+	stdout, _, code = captureCmd(cmdStatus, []string{"--group", "db", "--json"})
+	if code != ExitOK {
+		t.Fatalf("status --group db --json: exit %d", code)
+	}
+	var out groupStatusOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("unmarshal %q: %v", stdout, err)
+	}
+	if out.HeldBy != "db-migrate" || len(out.Members) != 2 || !out.Members[0].Held || out.Members[1].Held || out.Members[1].Lock != nil {
+		t.Errorf("json = %+v", out)
+	}
+
+	if _, _, code := captureCmd(cmdStatus, []string{"--group", "nope"}); code != ExitNotFound {
+		t.Errorf("unknown group: exit %d, want %d", code, ExitNotFound)
+	}
+	if _, _, code := captureCmd(cmdStatus, []string{"--group", "db", "db-restore"}); code != ExitUsage {
+		t.Errorf("--group with a name: exit %d, want %d", code, ExitUsage)
+	}
+}
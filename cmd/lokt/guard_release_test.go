@@ -5,6 +5,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -86,6 +88,9 @@ func TestGuardRelease_ExitCodePropagation(t *testing.T) {
 // TestGuardRelease_Signal verifies that sending SIGTERM to guard releases the
 // lock and exits with 128+15=143.
 func TestGuardRelease_Signal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("processes can't be sent SIGTERM on Windows")
+	}
 	binary := buildBinary(t)
 	rootDir := t.TempDir()
 	locksDir := filepath.Join(rootDir, "locks")
@@ -149,3 +154,92 @@ func TestGuardRelease_Signal(t *testing.T) {
 		t.Errorf("lock file still exists after SIGTERM")
 	}
 }
+
+// TestGuardRelease_FastChildNoRenewalWarning runs many short-lived guarded
+// children with a TTL and checks that shutdown never races the heartbeat
+// into a spurious renewal warning. Children sleeping ~one heartbeat interval
+// land the first tick right around release time.
+func TestGuardRelease_FastChildNoRenewalWarning(t *testing.T) {
+	binary := buildBinary(t)
+	rootDir := t.TempDir()
+
+	children := [][]string{}
+	for range 20 {
+		children = append(children, []string{"true"})
+	}
+	for range 4 {
+		children = append(children, []string{"sleep", "0.5"})
+	}
+
+	for i, child := range children {
+		args := append([]string{"guard", "--ttl", "1s", "fast", "--"}, child...)
+		cmd := exec.Command(binary, args...)
+		cmd.Env = []string{
+			"LOKT_ROOT=" + rootDir,
+			"LOKT_OWNER=test-guard",
+			"LOKT_NO_SWEEP=1",
+			"HOME=" + os.Getenv("HOME"),
+			"PATH=" + os.Getenv("PATH"),
+		}
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("run %d: guard failed: %v\n%s", i, err, out)
+		}
+		if strings.Contains(string(out), "renewal failed") {
+			t.Fatalf("run %d: spurious renewal warning: %s", i, out)
+		}
+	}
+}
+
+// TestGuardRelease_StrictTTLLost force-releases the lock out from under a
+// running guard --strict-ttl: the next renewal finds it gone, the command is
+// terminated and guard exits 2 with a lock-lost audit event.
+func TestGuardRelease_StrictTTLLost(t *testing.T) {
+	binary := buildBinary(t)
+	rootDir := t.TempDir()
+	const lockName = "strict-test"
+	env := []string{
+		"LOKT_ROOT=" + rootDir,
+		"LOKT_OWNER=test-guard",
+		"HOME=" + os.Getenv("HOME"),
+		"PATH=" + os.Getenv("PATH"),
+	}
+
+	cmd := exec.Command(binary, "guard", "--ttl", "1s", "--strict-ttl", lockName, "--", "sleep", "60")
+	cmd.Env = env
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start guard: %v", err)
+	}
+	lockPath := filepath.Join(rootDir, "locks", lockName+".json")
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(lockPath); err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	unlock := exec.Command(binary, "unlock", "--force", lockName)
+	unlock.Env = env
+	if out, err := unlock.CombinedOutput(); err != nil {
+		t.Fatalf("unlock --force: %v\n%s", err, out)
+	}
+
+	start := time.Now()
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != ExitLockHeld {
+		t.Fatalf("guard: %v, want exit %d", err, ExitLockHeld)
+	}
+	if waited := time.Since(start); waited > 10*time.Second {
+		t.Errorf("guard took %s to notice the lost lock", waited)
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootDir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"event":"lock-lost"`) {
+		t.Errorf("expected a lock-lost event, audit log:\n%s", data)
+	}
+}
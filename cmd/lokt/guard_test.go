@@ -2,11 +2,19 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/guard"
 	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
 )
 
 // TestGuardHeartbeatPreventsStaleBreak validates that heartbeat renewal
@@ -149,3 +157,376 @@ func TestGuardHeartbeatPreventsStaleBreak(t *testing.T) {
 	t.Logf("Results: %d total attempts, %d breaks during heartbeat (expected 0), %d breaks after stop (expected ≥1)",
 		len(attempts), breaksDuringHeartbeat, breaksAfterHeartbeat)
 }
+
+func TestGuard_WaitThaw_ProceedsAfterUnfreeze(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	if err := lock.Freeze(rootDir, "deploy", lock.FreezeOptions{TTL: 15 * time.Minute}); err != nil {
+		t.Fatalf("Freeze() error = %v", err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = lock.Unfreeze(rootDir, "deploy", lock.UnfreezeOptions{})
+	}()
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"--wait-thaw", "--timeout", "5s", "deploy", "--", "true"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d; stderr: %s", ExitOK, code, stderr)
+	}
+	if !strings.Contains(stderr, "waiting for freeze") {
+		t.Errorf("expected thaw wait notice, got: %s", stderr)
+	}
+
+	var sawThawWait bool
+	var thawMS float64
+	_ = audit.ScanFile(audit.Path(rootDir), func(e *audit.Event, _ []byte) bool {
+		switch e.Event {
+		case audit.EventThawWait:
+			sawThawWait = true
+		case audit.EventAcquire:
+			thawMS, _ = e.Extra["thaw_wait_ms"].(float64)
+		}
+		return true
+	})
+	if !sawThawWait {
+		t.Error("expected thaw-wait audit event")
+	}
+	if thawMS <= 0 {
+		t.Errorf("expected acquire event to record thaw_wait_ms, got %v", thawMS)
+	}
+}
+
+func TestGuard_WaitThaw_Timeout(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	if err := lock.Freeze(rootDir, "deploy", lock.FreezeOptions{TTL: 15 * time.Minute}); err != nil {
+		t.Fatalf("Freeze() error = %v", err)
+	}
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"--wait-thaw", "--timeout", "200ms", "deploy", "--", "true"})
+	if code != ExitLockHeld {
+		t.Errorf("expected exit %d, got %d", ExitLockHeld, code)
+	}
+	if !strings.Contains(stderr, "timeout waiting for freeze") {
+		t.Errorf("expected thaw timeout error, got: %s", stderr)
+	}
+}
+
+func TestGuard_FrozenWithoutWaitThaw(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	if err := lock.Freeze(rootDir, "deploy", lock.FreezeOptions{TTL: 15 * time.Minute}); err != nil {
+		t.Fatalf("Freeze() error = %v", err)
+	}
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"deploy", "--", "true"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "frozen") {
+		t.Errorf("expected immediate frozen denial, got exit %d: %s", code, stderr)
+	}
+}
+
+func TestGuard_OnTimeout(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "deploy.json", &lockfile.Lock{
+		Version: 1, Name: "deploy", Owner: "alice", Host: "other-host", PID: 4242, AcquiredAt: time.Now().Add(-90 * time.Second),
+	})
+	out := filepath.Join(t.TempDir(), "hook.out")
+	hook := `echo "$LOKT_LOCK_NAME $LOKT_HOLDER_OWNER $LOKT_HOLDER_PID $LOKT_HOLDER_AGE_SEC" > ` + out + `; exit 7`
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"--wait", "--timeout", "200ms", "--on-timeout", hook, "deploy", "--", "true"})
+	if code != ExitLockHeld {
+		t.Errorf("expected exit %d despite the hook's exit 7, got %d", ExitLockHeld, code)
+	}
+	if !strings.Contains(stderr, "--on-timeout command failed") {
+		t.Errorf("expected the hook failure reported, got: %s", stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook did not run: %v", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 4 || fields[0] != "deploy" || fields[1] != "alice" || fields[2] != "4242" {
+		t.Fatalf("hook env = %q", data)
+	}
+	if age, _ := strconv.Atoi(fields[3]); age < 90 {
+		t.Errorf("LOKT_HOLDER_AGE_SEC = %s, want >= 90", fields[3])
+	}
+
+	// Not run when the lock is acquired.
+	if err := os.Remove(out); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(locksDir, "deploy.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, code := captureCmd(cmdGuard, []string{"--wait", "--on-timeout", hook, "deploy", "--", "true"}); code != ExitOK {
+		t.Errorf("expected exit %d, got %d", ExitOK, code)
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Error("hook ran although the lock was acquired")
+	}
+
+	if _, _, code := captureCmd(cmdGuard, []string{"--on-timeout", "true", "deploy", "--", "true"}); code != ExitUsage {
+		t.Errorf("--on-timeout without --wait: exit %d, want %d", code, ExitUsage)
+	}
+}
+
+func TestGuard_WaitReport(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "deploy.json", &lockfile.Lock{
+		Version: 1, Name: "deploy", Owner: "alice", Host: "other-host", PID: 4242,
+		AcquiredAt: time.Now().Add(-4 * time.Minute), TTLSec: 600,
+	})
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"--wait", "--timeout", "350ms", "--wait-report", "100ms", "deploy", "--", "true"})
+	if code != ExitLockHeld {
+		t.Fatalf("expected exit %d, got %d", ExitLockHeld, code)
+	}
+	if !strings.Contains(stderr, `still waiting for lock "deploy": held by alice@other-host (pid 4242) for 4m0s, ttl remaining 5m59s, waited 0s so far`) {
+		t.Errorf("expected a progress line, got: %s", stderr)
+	}
+
+	// Not a terminal, and not asked for: quiet.
+	_, stderr, _ = captureCmd(cmdGuard, []string{"--wait", "--timeout", "200ms", "deploy", "--", "true"})
+	if strings.Contains(stderr, "still waiting") {
+		t.Errorf("progress reported to a non-terminal: %s", stderr)
+	}
+
+	for _, args := range [][]string{{"--wait-report", "5s"}, {"--wait", "--wait-report", "-1s"}} {
+		if _, _, code := captureCmd(cmdGuard, append(args, "deploy", "--", "true")); code != ExitUsage {
+			t.Errorf("args %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
+
+func TestGuard_IfFree(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Name: "build", Owner: "alice", Host: "other-host", PID: 42, AcquiredAt: time.Now(),
+	})
+	marker := filepath.Join(t.TempDir(), "ran")
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"--if-free", "build", "--", "touch", marker})
+	if code != ExitOK || !strings.HasPrefix(stderr, "skipped: lock \"build\" held by alice@other-host") {
+		t.Errorf("held: exit %d, stderr %q; want 0 and a skipped line", code, stderr)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the command ran although the lock was held")
+	}
+	if _, _, code := captureCmd(cmdGuard, []string{"--if-free", "--skip-exit-code", "75", "build", "--", "true"}); code != 75 {
+		t.Errorf("--skip-exit-code 75: exit %d", code)
+	}
+	if data, err := os.ReadFile(filepath.Join(rootDir, "audit.log")); err != nil || strings.Count(string(data), `"event":"skip"`) != 2 {
+		t.Errorf("want two skip events, audit log:\n%s", data)
+	}
+
+	if _, _, code := captureCmd(cmdGuard, []string{"--if-free", "free", "--", "touch", marker}); code != ExitOK {
+		t.Errorf("free: exit %d", code)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("the command should run when the lock is free")
+	}
+
+	for _, args := range [][]string{
+		{"--if-free", "--wait", "build", "--", "true"},
+		{"--skip-exit-code", "3", "build", "--", "true"},
+		{"--if-free", "--skip-exit-code", "300", "build", "--", "true"},
+	} {
+		if _, _, code := captureCmd(cmdGuard, args); code != ExitUsage {
+			t.Errorf("%v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
+
+func TestGuard_NestedRunsUnderOuterHold(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Name: "build", LockID: "outer-id", Owner: "alice", Host: "other-host", PID: 42, AcquiredAt: time.Now(),
+	})
+	t.Setenv(guard.EnvLock, "build")
+	t.Setenv(guard.EnvLockID, "outer-id")
+	marker := filepath.Join(t.TempDir(), "ran")
+
+	if _, stderr, code := captureCmd(cmdGuard, []string{"build", "--", "touch", marker}); code != ExitOK {
+		t.Fatalf("nested guard: exit %d, stderr %q", code, stderr)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("the nested command should run under the outer hold")
+	}
+	lf, err := lockfile.Read(filepath.Join(locksDir, "build.json"))
+	if err != nil || lf.LockID != "outer-id" {
+		t.Errorf("lock after nested guard = %+v, %v; want the outer hold kept", lf, err)
+	}
+
+	// Another lock is acquired as usual.
+	if _, _, code := captureCmd(cmdGuard, []string{"deploy", "--", "true"}); code != ExitOK {
+		t.Errorf("guard deploy: exit %d", code)
+	}
+}
+
+func TestGuard_Locks(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	marker := filepath.Join(t.TempDir(), "ran")
+
+	if _, stderr, code := captureCmd(cmdGuard, []string{"--locks", "db-migrate,asset-upload", "--", "touch", marker}); code != ExitOK {
+		t.Fatalf("exit %d, stderr %q", code, stderr)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("the command should run with both locks free")
+	}
+
+	writeLockJSON(t, locksDir, "db-migrate.json", &lockfile.Lock{
+		Name: "db-migrate", Owner: "alice", Host: "other-host", PID: 42, AcquiredAt: time.Now(),
+	})
+	_, stderr, code := captureCmd(cmdGuard, []string{"--locks", "db-migrate,asset-upload", "--", "true"})
+	if code != ExitLockHeld || !strings.Contains(stderr, `lock "db-migrate" held by alice`) {
+		t.Errorf("held: exit %d, stderr %q; want 2 naming db-migrate", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "asset-upload.json")); !os.IsNotExist(err) {
+		t.Error("asset-upload should not be held after the failed acquisition")
+	}
+
+	for _, args := range [][]string{
+		{"--locks", "a,b", "build", "--", "true"},
+		{"--locks", "a,bad name!", "--", "true"},
+		{"--locks", "a,b", "--if-free", "--", "true"},
+		{"--locks", "a,b", "--no-release", "--", "true"},
+	} {
+		if _, _, code := captureCmd(cmdGuard, args); code != ExitUsage {
+			t.Errorf("%v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
+
+func TestGuard_Shell(t *testing.T) {
+	setupTestRoot(t)
+	out := filepath.Join(t.TempDir(), "out")
+
+	for _, flag := range []string{"--shell", "-c"} {
+		_ = os.Remove(out)
+		args := []string{flag, "build", "--", "echo a > " + out + " && echo b >> " + out}
+		if _, stderr, code := captureCmd(cmdGuard, args); code != ExitOK {
+			t.Fatalf("%s: exit %d, stderr %q", flag, code, stderr)
+		}
+		if data, _ := os.ReadFile(out); string(data) != "a\nb\n" {
+			t.Errorf("%s: output %q, want both commands run", flag, data)
+		}
+	}
+
+	if _, _, code := captureCmd(cmdGuard, []string{"--shell", "build", "--", "exit 9"}); code != 9 {
+		t.Errorf("exit code %d, want the shell's 9", code)
+	}
+	if _, stderr, code := captureCmd(cmdGuard, []string{"--shell", "build", "--", "echo", "a"}); code != ExitUsage || !strings.Contains(stderr, "one quoted string") {
+		t.Errorf("unquoted --shell command: exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestGuard_CwdAndEnv(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	dir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "out")
+	envFile := filepath.Join(t.TempDir(), "ci.env")
+	if err := os.WriteFile(envFile, []byte("# CI settings\n\nFOO=from-file\nBAR=1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"--cwd", dir, "--env-file", envFile, "--env", "FOO=from-flag", "--shell", "build", "--",
+		`pwd > ` + out + ` && echo "$FOO $BAR" >> ` + out}
+	if _, stderr, code := captureCmd(cmdGuard, args); code != ExitOK {
+		t.Fatalf("exit %d, stderr %q", code, stderr)
+	}
+	data, _ := os.ReadFile(out)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || filepath.Base(lines[0]) != filepath.Base(dir) || lines[1] != "from-flag 1" {
+		t.Errorf("command saw %q, want to run in %s with FOO=from-flag BAR=1", data, dir)
+	}
+
+	// All are checked before the lock is taken.
+	acquires := func() int {
+		n := 0
+		_ = audit.ScanFile(audit.Path(rootDir), func(e *audit.Event, _ []byte) bool {
+			if e.Event == audit.EventAcquire {
+				n++
+			}
+			return true
+		})
+		return n
+	}
+	before := acquires()
+	for _, bad := range [][]string{
+		{"--cwd", filepath.Join(dir, "missing")},
+		{"--env-file", filepath.Join(dir, "missing.env")},
+		{"--env", "NOEQUALS"},
+	} {
+		args := append(bad, "build", "--", "true")
+		if _, _, code := captureCmd(cmdGuard, args); code != ExitUsage {
+			t.Errorf("%v: exit %d, want %d", bad, code, ExitUsage)
+		}
+	}
+	if n := acquires(); n != before {
+		t.Errorf("%d acquisitions for bad --cwd/--env settings, want none", n-before)
+	}
+}
+
+func TestGuard_LockVanished(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+
+	// The command wipes the whole root, as git clean -xfd does to .lokt/
+	_, stderr, code := captureCmd(cmdGuard, []string{"build", "--", "rm", "-rf", rootDir})
+	if code != ExitVanished || !strings.Contains(stderr, "vanished") {
+		t.Errorf("guard: exit %d, stderr %q; want %d and a warning", code, stderr, ExitVanished)
+	}
+	if _, _, code := captureCmd(cmdGuard, []string{"--verify-interval", "-1s", "build", "--", "true"}); code != ExitUsage {
+		t.Errorf("negative --verify-interval: exit %d, want %d", code, ExitUsage)
+	}
+}
+
+func TestGuard_AuditsChildLifecycle(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	if _, stderr, code := captureCmd(cmdGuard, []string{"deploy", "--", "sh", "-c", "exit 4"}); code != 4 {
+		t.Fatalf("guard: exit %d, stderr %q; want the command's 4", code, stderr)
+	}
+
+	var events []string
+	var argv, exitCode any
+	_ = audit.ScanFile(audit.Path(rootDir), func(e *audit.Event, _ []byte) bool {
+		events = append(events, e.Event)
+		switch e.Event {
+		case audit.EventGuardStart:
+			argv = e.Extra["argv"]
+		case audit.EventGuardEnd:
+			exitCode = e.Extra["exit_code"]
+		}
+		return true
+	})
+	if got := strings.Join(events, ","); got != "acquire,guard-start,guard-end,release" {
+		t.Errorf("events = %s, want the command's start and end between acquire and release", got)
+	}
+	if fmt.Sprint(argv) != "[sh -c exit 4]" || exitCode != float64(4) {
+		t.Errorf("argv %v, exit_code %v; want the command and its exit code", argv, exitCode)
+	}
+}
+
+func TestGuard_Retry(t *testing.T) {
+	setupTestRoot(t)
+	count := filepath.Join(t.TempDir(), "count")
+	script := `n=$(($(cat ` + count + ` 2>/dev/null || echo 0) + 1)); echo $n > ` + count + `; [ $n -ge 2 ] || exit 3`
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"--retry", "2", "--shell", "build", "--", script})
+	if code != ExitOK || !strings.Contains(stderr, "attempt 1 of 3 exited 3; retrying") || !strings.Contains(stderr, "attempt 2 of 3 succeeded") {
+		t.Errorf("guard --retry: exit %d, stderr %q; want success on attempt 2, reported", code, stderr)
+	}
+	_, stderr, code = captureCmd(cmdGuard, []string{"--retry", "1", "--no-retry-on", "3", "--shell", "build", "--", "exit 3"})
+	if code != 3 || strings.Contains(stderr, "retrying") {
+		t.Errorf("guard --no-retry-on 3: exit %d, stderr %q; want 3 without a retry", code, stderr)
+	}
+
+	for _, bad := range [][]string{
+		{"--retry", "-1"},
+		{"--retry-delay", "1s"},
+		{"--no-retry-on", "3"},
+		{"--retry", "1", "--no-retry-on", "256"},
+	} {
+		args := append(bad, "build", "--", "true")
+		if _, _, code := captureCmd(cmdGuard, args); code != ExitUsage {
+			t.Errorf("%v: exit %d, want %d", bad, code, ExitUsage)
+		}
+	}
+}
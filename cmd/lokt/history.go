@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/snapshot"
+	"github.com/nikolasavic/lokt/internal/stats"
+)
+
+const historyUsage = "usage: lokt history show --at <duration|timestamp> [--json] [--output <path>]\n" +
+	"       lokt history <name> [--limit n] [--json]"
+
+func cmdHistory(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, historyUsage)
+		return ExitUsage
+	}
+	if args[0] == "show" {
+		return cmdHistoryShow(args[1:])
+	}
+	return cmdHistoryLock(args)
+}
+
+// cmdHistoryLock lists the recent acquisitions of one lock from the audit
+// log: who held it, for how long, and how the hold ended.
+func cmdHistoryLock(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "Show the last n acquisitions (0 for all)")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	if err := fs.Parse(interspersed(fs, args)); err != nil || fs.NArg() != 1 || *limit < 0 {
+		fmt.Fprintln(os.Stderr, historyUsage)
+		return ExitUsage
+	}
+	name := fs.Arg(0)
+	if err := lockfile.ValidateName(name); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	acqs, err := stats.LockHistory(rootDir, name, *limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	if *jsonOutput {
+		data, _ := json.MarshalIndent(acqs, "", "  ")
+		fmt.Println(string(data))
+		return ExitOK
+	}
+	printLockHistory(os.Stdout, name, acqs, time.Now())
+	return ExitOK
+}
+
+// printLockHistory renders acquisitions as a table, one line each.
+func printLockHistory(w io.Writer, name string, acqs []stats.Acquisition, now time.Time) {
+	if len(acqs) == 0 {
+		fmt.Fprintf(w, "no acquisitions of %q in the audit log\n", name)
+		return
+	}
+	fmt.Fprintf(w, "%-20s  %-20s  %8s  %-30s  %s\n", "START", "END", "HELD", "HOLDER", "ENDED")
+	for i := range acqs {
+		a := &acqs[i]
+		end, held := "-", "-"
+		if a.End != nil {
+			end = a.End.Local().Format(time.DateTime)
+		}
+		if a.End != nil || a.EndReason == stats.EndHeld {
+			held = fmtHold(a.Duration(now))
+		}
+		reason := a.EndReason
+		if a.EndedBy != "" {
+			reason += " by " + a.EndedBy
+		}
+		if a.Renewals > 0 {
+			reason += fmt.Sprintf(" (%d renewal(s))", a.Renewals)
+		}
+		fmt.Fprintf(w, "%-20s  %-20s  %8s  %-30s  %s\n",
+			a.Start.Local().Format(time.DateTime), end, held, a.Owner+"@"+a.Host, reason)
+	}
+}
+
+// cmdHistoryShow reconstructs the lock root state at a past instant from the
+// nearest earlier snapshot plus the audit events recorded after it.
+func cmdHistoryShow(args []string) int {
+	fs := flag.NewFlagSet("history show", flag.ExitOnError)
+	at := fs.String("at", "", "Point in time: duration ago (30m) or RFC3339 timestamp")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	outputPath := fs.String("output", "", "Write output to file atomically (- for stdout)")
+	_ = fs.Parse(args)
+
+	if *at == "" {
+		fmt.Fprintln(os.Stderr, historyUsage)
+		return ExitUsage
+	}
+	atTime, err := parseSince(*at)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid --at value %q: %v\n", *at, err)
+		fmt.Fprintln(os.Stderr, "  expected duration (1h, 30m) or RFC3339 timestamp")
+		return ExitUsage
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	rec, err := snapshot.Reconstruct(rootDir, atTime)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	out := newOutputSink(*outputPath)
+	return out.finish(printReconstruction(out, rec, atTime, *jsonOutput))
+}
+
+// printReconstruction renders a reconstructed state as JSON or text.
+func printReconstruction(w io.Writer, rec *snapshot.Reconstruction, atTime time.Time, jsonOutput bool) int {
+	if jsonOutput {
+		data, _ := json.MarshalIndent(rec, "", "  ")
+		fmt.Fprintln(w, string(data))
+		return ExitOK
+	}
+
+	st := rec.State
+	if rec.Base != nil {
+		fmt.Fprintf(w, "state at %s (snapshot %s + %d audit event(s))\n",
+			st.Timestamp.Format(time.RFC3339), rec.Base.Format(time.RFC3339), rec.Replayed)
+	} else {
+		fmt.Fprintf(w, "state at %s (no snapshot; replayed %d audit event(s) from start of log)\n",
+			st.Timestamp.Format(time.RFC3339), rec.Replayed)
+	}
+	fmt.Fprintln(w)
+	if len(st.Locks) == 0 {
+		fmt.Fprintln(w, "no locks")
+		return ExitOK
+	}
+	for i := range st.Locks {
+		e := &st.Locks[i]
+		age := atTime.Sub(e.AcquiredAt).Truncate(time.Second)
+		status := ""
+		if e.Freeze {
+			status = " [FROZEN]"
+		}
+		if e.IsExpiredAt(atTime) {
+			status += " [EXPIRED]"
+		}
+		fmt.Fprintf(w, "%-20s  %s@%s  %s%s\n", e.Name, e.Owner, e.Host, age, status)
+	}
+	fmt.Fprintf(w, "\n%d lock(s), %d freeze(s)\n", st.LockCount, st.FreezeCount)
+	return ExitOK
+}
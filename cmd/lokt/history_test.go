@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/snapshot"
+	"github.com/nikolasavic/lokt/internal/stats"
+)
+
+func TestHistory_Usage(t *testing.T) {
+	setupTestRoot(t)
+
+	for _, args := range [][]string{nil, {"show"}, {"a", "b"}, {"--limit", "-1", "build"}, {"../x"}} {
+		_, _, code := captureCmd(cmdHistory, args)
+		if code != ExitUsage {
+			t.Errorf("args %v: expected exit %d, got %d", args, ExitUsage, code)
+		}
+	}
+}
+
+func TestHistory_Show_ReplaysAudit(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+
+	now := time.Now().UTC()
+	writeAuditEvents(t, rootDir,
+		map[string]any{"ts": now.Add(-20 * time.Minute), "event": "acquire", "name": "build", "owner": "alice", "host": "h", "pid": 1},
+		map[string]any{"ts": now.Add(-15 * time.Minute), "event": "acquire", "name": "test", "owner": "bob", "host": "h", "pid": 2},
+		map[string]any{"ts": now.Add(-5 * time.Minute), "event": "release", "name": "build", "owner": "alice", "host": "h", "pid": 1},
+	)
+
+	stdout, _, code := captureCmd(cmdHistory, []string{"show", "--at", "10m"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	if !strings.Contains(stdout, "build") || !strings.Contains(stdout, "test") {
+		t.Errorf("expected build and test held 10m ago, got:\n%s", stdout)
+	}
+	if !strings.Contains(stdout, "no snapshot") {
+		t.Errorf("expected note about missing snapshot, got:\n%s", stdout)
+	}
+
+	stdout, _, code = captureCmd(cmdHistory, []string{"show", "--at", "1m", "--json"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	var rec snapshot.Reconstruction
+	if err := json.Unmarshal([]byte(stdout), &rec); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if rec.State.LockCount != 1 || rec.State.Locks[0].Name != "test" {
+		t.Errorf("expected only test held 1m ago, got %+v", rec.State.Locks)
+	}
+}
+
+func TestHistory_Lock(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+
+	now := time.Now().UTC()
+	writeAuditEvents(t, rootDir,
+		map[string]any{"ts": now.Add(-time.Hour), "event": "acquire", "name": "build", "lock_id": "b1", "owner": "alice", "host": "h1", "pid": 1},
+		map[string]any{"ts": now.Add(-55 * time.Minute), "event": "acquire", "name": "deploy", "lock_id": "d1", "owner": "bob", "host": "h2", "pid": 2},
+		map[string]any{"ts": now.Add(-50 * time.Minute), "event": "renew", "name": "build", "lock_id": "b1", "owner": "alice", "host": "h1", "pid": 1},
+		map[string]any{"ts": now.Add(-45 * time.Minute), "event": "release", "name": "build", "lock_id": "b1", "owner": "alice", "host": "h1", "pid": 1},
+		map[string]any{"ts": now.Add(-30 * time.Minute), "event": "acquire", "name": "build", "lock_id": "b2", "owner": "carol", "host": "h3", "pid": 3},
+		map[string]any{"ts": now.Add(-20 * time.Minute), "event": "force-break", "name": "build", "lock_id": "b2", "owner": "ops", "host": "h4", "pid": 4},
+		map[string]any{"ts": now.Add(-10 * time.Minute), "event": "acquire", "name": "build", "lock_id": "b3", "owner": "dave", "host": "h5", "pid": 5},
+	)
+
+	stdout, _, code := captureCmd(cmdHistory, []string{"build"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header and 3 acquisitions, got:\n%s", stdout)
+	}
+	if !strings.Contains(lines[1], "15m0s") || !strings.Contains(lines[1], "alice@h1") ||
+		!strings.Contains(lines[1], "released (1 renewal(s))") {
+		t.Errorf("first acquisition: %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "force-break by ops") {
+		t.Errorf("second acquisition: %q", lines[2])
+	}
+	if !strings.Contains(lines[3], "dave@h5") || !strings.Contains(lines[3], "abandoned") {
+		t.Errorf("third acquisition, lock gone: %q", lines[3])
+	}
+	if strings.Contains(stdout, "bob") {
+		t.Errorf("another lock's acquisition listed:\n%s", stdout)
+	}
+
+	stdout, _, code = captureCmd(cmdHistory, []string{"--limit", "1", "--json", "build"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	var acqs []stats.Acquisition
+	if err := json.Unmarshal([]byte(stdout), &acqs); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if len(acqs) != 1 || acqs[0].LockID != "b3" || acqs[0].EndReason != stats.EndAbandoned {
+		t.Errorf("--limit 1 = %+v, want only the latest", acqs)
+	}
+
+	// The form the usage shows, flags after the name.
+	after, _, code := captureCmd(cmdHistory, []string{"build", "--limit", "1", "--json"})
+	if code != ExitOK || after != stdout {
+		t.Errorf("history build --limit 1 --json: exit %d, output %q; want %q", code, after, stdout)
+	}
+}
+
+func TestRunSnapshot_DisabledByDefault(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", Owner: "alice", Host: "h", PID: 1, AcquiredAt: time.Now(),
+	})
+
+	runSnapshot()
+
+	if _, err := os.Stat(filepath.Join(rootDir, snapshot.DirName)); !os.IsNotExist(err) {
+		t.Errorf("expected no history dir without config, stat err = %v", err)
+	}
+}
+
+func TestRunSnapshot_Enabled(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	cfg := `{"snapshot": {"enabled": true, "interval": "1h"}}`
+	if err := os.WriteFile(filepath.Join(rootDir, "config.json"), []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", Owner: "alice", Host: "h", PID: 1, AcquiredAt: time.Now(),
+	})
+
+	runSnapshot()
+	runSnapshot() // within interval: must not append a second line
+
+	st, err := snapshot.Nearest(rootDir, time.Now())
+	if err != nil || st == nil {
+		t.Fatalf("expected a snapshot, got %v, %v", st, err)
+	}
+	if st.LockCount != 1 {
+		t.Errorf("lock_count = %d, want 1", st.LockCount)
+	}
+	matches, _ := filepath.Glob(filepath.Join(rootDir, snapshot.DirName, "state-*.ndjson"))
+	if len(matches) != 1 {
+		t.Fatalf("expected one day file, got %v", matches)
+	}
+	data, _ := os.ReadFile(matches[0])
+	if n := strings.Count(string(data), "\n"); n != 1 {
+		t.Errorf("expected 1 snapshot line, got %d", n)
+	}
+}
+
+// writeAuditEvents appends raw events to <rootDir>/audit.log.
+func writeAuditEvents(t *testing.T, rootDir string, events ...map[string]any) {
+	t.Helper()
+	f, err := os.OpenFile(filepath.Join(rootDir, "audit.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
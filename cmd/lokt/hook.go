@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// Markers delimiting the region of a git hook that lokt manages. Everything
+// outside them belongs to the user or to other hook managers and is never
+// touched.
+const (
+	hookBlockBegin = "# >>> lokt hook >>>"
+	hookBlockEnd   = "# <<< lokt hook <<<"
+)
+
+// defaultHookWait is how long a hook installed with --wait waits for the
+// lock when no --timeout is given. Short: a developer is staring at it.
+const defaultHookWait = 30 * time.Second
+
+// supportedHooks are the git hooks lokt hook can manage.
+var supportedHooks = []string{"pre-push", "pre-commit"}
+
+func cmdHook(args []string) int {
+	if len(args) < 1 {
+		hookUsage()
+		return ExitUsage
+	}
+	switch args[0] {
+	case "install":
+		return cmdHookInstall(args[1:])
+	case "uninstall":
+		return cmdHookUninstall(args[1:])
+	default:
+		hookUsage()
+		return ExitUsage
+	}
+}
+
+func hookUsage() {
+	fmt.Fprintln(os.Stderr, "usage: lokt hook install <pre-push|pre-commit> --check <name> [--wait [--timeout d]] [--strict]")
+	fmt.Fprintln(os.Stderr, "       lokt hook uninstall [pre-push|pre-commit]")
+}
+
+func cmdHookInstall(args []string) int {
+	if len(args) < 1 || !isSupportedHook(args[0]) {
+		hookUsage()
+		return ExitUsage
+	}
+	hook := args[0]
+	fset := flag.NewFlagSet("hook install", flag.ContinueOnError)
+	check := fset.String("check", "", "Lock name the hook checks")
+	wait := fset.Bool("wait", false, "Wait for the lock instead of failing immediately")
+	timeout := fset.Duration("timeout", 0, "Maximum time to wait (requires --wait; default 30s)")
+	strict := fset.Bool("strict", false, "Block when lokt is missing or the check errors")
+	if err := fset.Parse(args[1:]); err != nil || fset.NArg() > 0 || *check == "" {
+		hookUsage()
+		return ExitUsage
+	}
+	if err := lockfile.ValidateName(*check); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+	if *timeout != 0 && !*wait {
+		fmt.Fprintln(os.Stderr, "error: --timeout requires --wait")
+		return ExitUsage
+	}
+	if *timeout < 0 {
+		fmt.Fprintln(os.Stderr, "error: --timeout must be positive (e.g., 5s, 1m)")
+		return ExitUsage
+	}
+	if *wait && *timeout == 0 {
+		*timeout = defaultHookWait
+	}
+
+	dir, err := gitHooksDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	path := filepath.Join(dir, hook)
+
+	existing, err := os.ReadFile(path) //nolint:gosec // G304: the repo's own hook file
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	updated, err := installHookBlock(string(existing), hookBlock(hook, *check, *timeout, *strict))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", path, err)
+		return ExitError
+	}
+
+	mode := fs.FileMode(0755)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm() | 0111
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if err := lockfile.WriteFileAtomic(path, []byte(updated), mode); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	fmt.Printf("installed %s hook checking %q: %s\n", hook, *check, path)
+	return ExitOK
+}
+
+func cmdHookUninstall(args []string) int {
+	hooks := supportedHooks
+	switch {
+	case len(args) == 1 && isSupportedHook(args[0]):
+		hooks = args
+	case len(args) > 0:
+		hookUsage()
+		return ExitUsage
+	}
+
+	dir, err := gitHooksDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	removed := 0
+	for _, hook := range hooks {
+		path := filepath.Join(dir, hook)
+		data, err := os.ReadFile(path) //nolint:gosec // G304: the repo's own hook file
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+		rest, found := removeHookBlock(string(data))
+		if !found {
+			continue
+		}
+		if isEmptyHook(rest) {
+			err = os.Remove(path)
+		} else {
+			var info os.FileInfo
+			if info, err = os.Stat(path); err == nil {
+				err = lockfile.WriteFileAtomic(path, []byte(rest), info.Mode().Perm())
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+		removed++
+		fmt.Printf("removed lokt block from %s\n", path)
+	}
+	if removed == 0 {
+		fmt.Println("no lokt-managed hooks found")
+	}
+	return ExitOK
+}
+
+func isSupportedHook(name string) bool {
+	return slices.Contains(supportedHooks, name)
+}
+
+// gitHooksDir returns the absolute hooks directory of the current repository,
+// honoring core.hooksPath.
+func gitHooksDir() (string, error) {
+	out, err := exec.Command("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", fmt.Errorf("not inside a git repository (git rev-parse: %w)", err)
+	}
+	return filepath.Abs(strings.TrimSpace(string(out)))
+}
+
+// hookBlock renders the managed POSIX sh region for hook. lokt check exits 2
+// when the lock is held or frozen, which always blocks; a missing lokt or any
+// other failure only warns unless strict.
+func hookBlock(hook, name string, wait time.Duration, strict bool) string {
+	args := "check"
+	if wait > 0 {
+		args += " --wait --timeout " + wait.String()
+	}
+	onProblem := "allowing " + hook
+	fail := ""
+	if strict {
+		onProblem = "blocking " + hook + " (--strict)"
+		fail = "\n\t\texit 1"
+	}
+
+	var b strings.Builder
+	fmt.Fprintln(&b, hookBlockBegin)
+	fmt.Fprintf(&b, "# Managed by 'lokt hook install'; remove with 'lokt hook uninstall %s'.\n", hook)
+	fmt.Fprintln(&b, "if command -v lokt >/dev/null 2>&1; then")
+	fmt.Fprintf(&b, "\tlokt %s '%s' && lokt_status=0 || lokt_status=$?\n", args, name)
+	fmt.Fprintln(&b, "\tif [ \"$lokt_status\" -eq 2 ]; then")
+	fmt.Fprintf(&b, "\t\techo \"lokt: %s blocked: lock '%s' is held or frozen (see: lokt why %s)\" >&2\n", hook, name, name)
+	fmt.Fprintln(&b, "\t\texit 1")
+	fmt.Fprintln(&b, "\telif [ \"$lokt_status\" -ne 0 ]; then")
+	fmt.Fprintf(&b, "\t\techo \"lokt: could not check lock '%s', %s\" >&2%s\n", name, onProblem, fail)
+	fmt.Fprintln(&b, "\tfi")
+	fmt.Fprintln(&b, "else")
+	fmt.Fprintf(&b, "\techo \"lokt: not found in PATH; cannot check lock '%s', %s\" >&2%s\n", name, onProblem, strings.ReplaceAll(fail, "\t\t", "\t"))
+	fmt.Fprintln(&b, "fi")
+	fmt.Fprintln(&b, hookBlockEnd)
+	return b.String()
+}
+
+// installHookBlock returns content with block in place of any existing lokt
+// region. A new region goes right after the shebang so it runs even if the
+// rest of the hook exits early. Hooks that aren't shell scripts are refused.
+func installHookBlock(content, block string) (string, error) {
+	if content == "" {
+		return "#!/bin/sh\n" + block, nil
+	}
+	if start, end, ok := findHookBlock(content); ok {
+		return content[:start] + block + content[end:], nil
+	}
+
+	first, rest, _ := strings.Cut(content, "\n")
+	if !strings.HasPrefix(first, "#!") {
+		return block + content, nil
+	}
+	if !strings.Contains(first, "sh") {
+		return "", fmt.Errorf("existing hook is not a shell script (%s); call 'lokt check' from it manually", first)
+	}
+	return first + "\n" + block + rest, nil
+}
+
+// removeHookBlock returns content without the lokt region, and whether one
+// was found.
+func removeHookBlock(content string) (string, bool) {
+	start, end, ok := findHookBlock(content)
+	if !ok {
+		return content, false
+	}
+	return content[:start] + content[end:], true
+}
+
+// findHookBlock locates the lokt region, including its trailing newline.
+func findHookBlock(content string) (start, end int, ok bool) {
+	start = strings.Index(content, hookBlockBegin+"\n")
+	if start < 0 {
+		return 0, 0, false
+	}
+	rel := strings.Index(content[start:], hookBlockEnd)
+	if rel < 0 {
+		return 0, 0, false
+	}
+	end = start + rel + len(hookBlockEnd)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return start, end, true
+}
+
+// isEmptyHook reports whether a hook has nothing left but a shebang.
+func isEmptyHook(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#!") {
+			return false
+		}
+	}
+	return true
+}
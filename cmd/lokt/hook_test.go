@@ -0,0 +1,215 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// setupHookRepo creates a git repository and makes it the working directory
+// for the rest of the test.
+func setupHookRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	orig, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(repo); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(orig) })
+	return repo
+}
+
+// runHook executes a generated hook with sh, with lokt's directory (if any)
+// as the only PATH entry besides the system shell utilities.
+func runHook(t *testing.T, path, rootDir, binDir string) (string, int) {
+	t.Helper()
+	cmd := exec.Command("sh", path)
+	pathEnv := "/usr/bin:/bin"
+	if binDir != "" {
+		pathEnv = binDir + ":" + pathEnv
+	}
+	cmd.Env = []string{"PATH=" + pathEnv, "LOKT_ROOT=" + rootDir, "LOKT_OWNER=dev", "HOME=" + os.Getenv("HOME")}
+	out, err := cmd.CombinedOutput()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("run hook: %v", err)
+	}
+	return string(out), code
+}
+
+func TestHookInstall_ExecutesAgainstLockStates(t *testing.T) {
+	binary := buildBinary(t)
+	repo := setupHookRepo(t)
+	rootDir := setupIntegrationRoot(t)
+
+	if _, stderr, code := captureCmd(cmdHook, []string{"install", "pre-push", "--check", "deploy"}); code != ExitOK {
+		t.Fatalf("install: exit %d: %s", code, stderr)
+	}
+	hookPath := filepath.Join(repo, ".git", "hooks", "pre-push")
+	info, err := os.Stat(hookPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		t.Errorf("hook should be executable, mode %v", info.Mode())
+	}
+
+	binDir := filepath.Dir(binary)
+	if out, code := runHook(t, hookPath, rootDir, binDir); code != 0 {
+		t.Errorf("free: hook exit %d, want 0\n%s", code, out)
+	}
+
+	writeLockJSON(t, filepath.Join(rootDir, "locks"), "deploy.json", &lockfile.Lock{
+		Version: 1, Name: "deploy", Owner: "release-bot", Host: "ci-host", PID: 4242, AcquiredAt: time.Now(),
+	})
+	out, code := runHook(t, hookPath, rootDir, binDir)
+	if code == 0 || !strings.Contains(out, "pre-push blocked: lock 'deploy' is held or frozen") ||
+		!strings.Contains(out, "held by release-bot@ci-host") {
+		t.Errorf("held: hook exit %d, want blocked with a readable message\n%s", code, out)
+	}
+	_ = os.Remove(filepath.Join(rootDir, "locks", "deploy.json"))
+
+	freezesDir := filepath.Join(rootDir, "freezes")
+	if err := os.MkdirAll(freezesDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(10 * time.Minute)
+	writeLockJSON(t, freezesDir, "deploy.json", &lockfile.Lock{
+		Version: 1, Name: "deploy", Owner: "oncall", Host: "ops-host", PID: 1,
+		AcquiredAt: time.Now(), TTLSec: 600, ExpiresAt: &exp,
+	})
+	out, code = runHook(t, hookPath, rootDir, binDir)
+	if code == 0 || !strings.Contains(out, "frozen by oncall@ops-host") {
+		t.Errorf("frozen: hook exit %d, want blocked\n%s", code, out)
+	}
+}
+
+func TestHookInstall_MissingLokt(t *testing.T) {
+	repo := setupHookRepo(t)
+	rootDir := setupIntegrationRoot(t)
+	hookPath := filepath.Join(repo, ".git", "hooks", "pre-commit")
+
+	if _, stderr, code := captureCmd(cmdHook, []string{"install", "pre-commit", "--check", "deploy"}); code != ExitOK {
+		t.Fatalf("install: exit %d: %s", code, stderr)
+	}
+	out, code := runHook(t, hookPath, rootDir, "")
+	if code != 0 || !strings.Contains(out, "not found in PATH; cannot check lock 'deploy', allowing pre-commit") {
+		t.Errorf("default: exit %d, want warn and allow\n%s", code, out)
+	}
+
+	// Reinstalling replaces the block rather than stacking a second one.
+	if _, stderr, code := captureCmd(cmdHook, []string{"install", "pre-commit", "--check", "deploy", "--strict"}); code != ExitOK {
+		t.Fatalf("reinstall: exit %d: %s", code, stderr)
+	}
+	data, _ := os.ReadFile(hookPath)
+	if n := strings.Count(string(data), hookBlockBegin); n != 1 {
+		t.Errorf("expected one managed block after reinstall, got %d", n)
+	}
+	out, code = runHook(t, hookPath, rootDir, "")
+	if code == 0 || !strings.Contains(out, "blocking pre-commit (--strict)") {
+		t.Errorf("strict: exit %d, want blocked\n%s", code, out)
+	}
+}
+
+func TestHookInstall_PreservesOtherContentAndHooksPath(t *testing.T) {
+	repo := setupHookRepo(t)
+	if out, err := exec.Command("git", "config", "core.hooksPath", ".githooks").CombinedOutput(); err != nil {
+		t.Fatalf("git config: %v\n%s", err, out)
+	}
+	hooksDir := filepath.Join(repo, ".githooks")
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	hookPath := filepath.Join(hooksDir, "pre-push")
+	other := "#!/bin/sh\n# husky-style content\necho other-tool\nexit 0\n"
+	if err := os.WriteFile(hookPath, []byte(other), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, stderr, code := captureCmd(cmdHook, []string{"install", "pre-push", "--check", "deploy", "--wait"}); code != ExitOK {
+		t.Fatalf("install: exit %d: %s", code, stderr)
+	}
+	data, err := os.ReadFile(hookPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if !strings.HasPrefix(got, "#!/bin/sh\n"+hookBlockBegin) {
+		t.Errorf("block should run first, right after the shebang:\n%s", got)
+	}
+	if !strings.Contains(got, "lokt check --wait --timeout 30s 'deploy'") {
+		t.Errorf("expected --wait with the default 30s timeout:\n%s", got)
+	}
+	if !strings.HasSuffix(got, "# husky-style content\necho other-tool\nexit 0\n") {
+		t.Errorf("content outside the block must be preserved:\n%s", got)
+	}
+	if _, err := os.Stat(filepath.Join(repo, ".git", "hooks", "pre-push")); !os.IsNotExist(err) {
+		t.Error("core.hooksPath should be honored instead of .git/hooks")
+	}
+
+	if _, stderr, code := captureCmd(cmdHook, []string{"uninstall"}); code != ExitOK {
+		t.Fatalf("uninstall: exit %d: %s", code, stderr)
+	}
+	data, _ = os.ReadFile(hookPath)
+	if string(data) != other {
+		t.Errorf("uninstall should restore the original hook exactly, got:\n%s", data)
+	}
+}
+
+func TestHookUninstall_RemovesLoktOnlyHook(t *testing.T) {
+	repo := setupHookRepo(t)
+	if _, _, code := captureCmd(cmdHook, []string{"install", "pre-push", "--check", "deploy"}); code != ExitOK {
+		t.Fatal("install failed")
+	}
+	stdout, _, code := captureCmd(cmdHook, []string{"uninstall", "pre-push"})
+	if code != ExitOK || !strings.Contains(stdout, "removed lokt block") {
+		t.Errorf("uninstall: exit %d, output %q", code, stdout)
+	}
+	if _, err := os.Stat(filepath.Join(repo, ".git", "hooks", "pre-push")); !os.IsNotExist(err) {
+		t.Error("a hook containing only the lokt block should be deleted")
+	}
+}
+
+func TestHookInstall_RefusesNonShellHook(t *testing.T) {
+	repo := setupHookRepo(t)
+	hookPath := filepath.Join(repo, ".git", "hooks", "pre-push")
+	if err := os.WriteFile(hookPath, []byte("#!/usr/bin/env python3\nprint('hi')\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, code := captureCmd(cmdHook, []string{"install", "pre-push", "--check", "deploy"})
+	if code != ExitError || !strings.Contains(stderr, "not a shell script") {
+		t.Errorf("exit %d, stderr %q; want refusal", code, stderr)
+	}
+}
+
+func TestHook_Usage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"bogus"},
+		{"install"},
+		{"install", "post-merge", "--check", "deploy"},
+		{"install", "pre-push"},
+		{"install", "pre-push", "--check", "deploy", "--timeout", "5s"},
+		{"uninstall", "post-merge"},
+	} {
+		if _, _, code := captureCmd(cmdHook, args); code != ExitUsage {
+			t.Errorf("hook %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// initConfig is the config.json lokt init writes: the settings most often
+// tuned, at their built-in defaults, so there is one place to change them.
+// Every other config.json setting can be added alongside.
+type initConfig struct {
+	DefaultTTL        config.Duration `json:"default_ttl"`
+	WaitPollInterval  config.Duration `json:"wait_poll_interval"`
+	WatchInterval     config.Duration `json:"watch_interval"`
+	RetryAfterDefault config.Duration `json:"retry_after_default"`
+	AdaptiveBackoff   bool            `json:"adaptive_backoff"`
+}
+
+func defaultInitConfig() initConfig {
+	return initConfig{
+		WaitPollInterval:  config.Duration(lock.DefaultRetryPolicy.Max),
+		WatchInterval:     config.Duration(DefaultWatchInterval),
+		RetryAfterDefault: config.Duration(lock.DefaultRetryAfter),
+		AdaptiveBackoff:   true,
+	}
+}
+
+func cmdInit(args []string) int {
+	fset := flag.NewFlagSet("init", flag.ContinueOnError)
+	rootFlag := fset.String("root", "", "Directory to initialize (default: the root lokt would use here)")
+	if err := fset.Parse(args); err != nil || fset.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: lokt init [--root path]")
+		return ExitUsage
+	}
+
+	rootDir := *rootFlag
+	if rootDir == "" {
+		var err error
+		if rootDir, err = root.Find(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+	}
+	rootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if code := checkWritable(rootDir, ""); code != ExitOK {
+		return code
+	}
+
+	if err := initRoot(os.Stdout, rootDir); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// initRoot creates rootDir with its locks/ and freezes/ directories, writes
+// a default config.json unless one exists, and, for a .lokt/ directory
+// inside a git work tree, a .gitignore that keeps the root out of the
+// repository. Existing files are never overwritten, so it is safe to rerun.
+// A shared root (the system scope's, see root.Shared) gets shared
+// subdirectories and a config.json every user can read.
+func initRoot(w io.Writer, rootDir string) error {
+	if err := os.MkdirAll(rootDir, 0700); err != nil {
+		return err
+	}
+	if err := root.EnsureDirs(rootDir); err != nil {
+		return err
+	}
+	shared := root.Shared(rootDir)
+	if shared {
+		fmt.Fprintf(w, "initialized lokt root %s (shared by all users)\n", rootDir)
+	} else {
+		fmt.Fprintf(w, "initialized lokt root %s\n", rootDir)
+	}
+
+	data, err := json.MarshalIndent(defaultInitConfig(), "", "  ")
+	if err != nil {
+		return err
+	}
+	configPerm := os.FileMode(0600)
+	if shared {
+		configPerm = 0644
+	}
+	switch created, err := createFile(config.Path(rootDir), append(data, '\n'), configPerm); {
+	case err != nil:
+		return fmt.Errorf("write %s: %w", config.FileName, err)
+	case created:
+		fmt.Fprintf(w, "wrote %s\n", config.Path(rootDir))
+	default:
+		if _, err := config.Load(rootDir); err != nil {
+			fmt.Fprintf(w, "kept existing %s (warning: %v)\n", config.Path(rootDir), err)
+		} else {
+			fmt.Fprintf(w, "kept existing %s\n", config.Path(rootDir))
+		}
+	}
+
+	if filepath.Base(rootDir) == root.DirName && inGitWorkTree(filepath.Dir(rootDir)) {
+		path := filepath.Join(rootDir, ".gitignore")
+		created, err := createFile(path, []byte("# lokt state is local to this checkout\n*\n"), 0600)
+		if err != nil {
+			return fmt.Errorf("write .gitignore: %w", err)
+		}
+		if created {
+			fmt.Fprintf(w, "wrote %s\n", path)
+		}
+	}
+	return nil
+}
+
+// createFile writes data to a new file at path with mode perm (less the
+// umask). It returns false, and no error, if the file already exists.
+func createFile(path string, data []byte, perm os.FileMode) (bool, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm) //nolint:gosec // G304: path is controlled
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return false, err
+	}
+	return true, f.Close()
+}
+
+// inGitWorkTree reports whether dir is inside a git work tree.
+func inGitWorkTree(dir string) bool {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--is-inside-work-tree").Output()
+	return err == nil && string(out) == "true\n"
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/policy"
+)
+
+func TestInit(t *testing.T) {
+	repo := setupHookRepo(t)
+	rootDir := filepath.Join(repo, ".lokt")
+
+	stdout, stderr, code := captureCmd(cmdInit, []string{"--root", ".lokt"})
+	if code != ExitOK {
+		t.Fatalf("init: exit %d (stderr %q)", code, stderr)
+	}
+	for _, want := range []string{"initialized lokt root", "wrote " + config.Path(rootDir), "wrote " + filepath.Join(rootDir, ".gitignore")} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout = %q, missing %q", stdout, want)
+		}
+	}
+	for _, dir := range []string{rootDir, filepath.Join(rootDir, "locks"), filepath.Join(rootDir, "freezes")} {
+		if fi, err := os.Stat(dir); err != nil || fi.Mode().Perm() != 0700 {
+			t.Errorf("%s: %v, %v; want a 0700 directory", dir, fi, err)
+		}
+	}
+	cfg, err := config.Load(rootDir)
+	if err != nil || time.Duration(cfg.WaitPollInterval) != 2*time.Second || !cfg.AdaptiveBackoffEnabled() {
+		t.Errorf("written config = %+v, %v; want the built-in defaults", cfg, err)
+	}
+
+	// Rerunning keeps what is there.
+	if err := os.WriteFile(config.Path(rootDir), []byte(`{"default_ttl": "5m"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, code = captureCmd(cmdInit, []string{"--root", ".lokt"})
+	if code != ExitOK || !strings.Contains(stdout, "kept existing") {
+		t.Errorf("second init: exit %d, stdout %q", code, stdout)
+	}
+	if cfg, _ := config.Load(rootDir); cfg == nil || time.Duration(cfg.DefaultTTL) != 5*time.Minute {
+		t.Errorf("config after second init = %+v, want it untouched", cfg)
+	}
+
+	if _, _, code := captureCmd(cmdInit, []string{"extra"}); code != ExitUsage {
+		t.Errorf("init with an argument: exit %d, want %d", code, ExitUsage)
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	if err := os.WriteFile(config.Path(rootDir), []byte(`{"default_ttl": "5m"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, code := captureCmd(cmdLock, []string{"build"}); code != ExitOK {
+		t.Fatalf("lock: exit %d", code)
+	}
+	if lf, err := lockfile.Read(filepath.Join(locksDir, "build.json")); err != nil || lf.TTLSec != 300 {
+		t.Errorf("lock without --ttl = %+v, %v; want default_ttl 5m", lf, err)
+	}
+	if _, _, code := captureCmd(cmdLock, []string{"build", "--ttl", "0"}); code != ExitOK {
+		t.Fatalf("lock --ttl 0: exit %d", code)
+	}
+	if lf, _ := lockfile.Read(filepath.Join(locksDir, "build.json")); lf == nil || lf.TTLSec != 0 {
+		t.Errorf("lock --ttl 0 = %+v, want the flag to override the config", lf)
+	}
+
+	stdout, _, _ := captureCmd(cmdDoctor, nil)
+	if !strings.Contains(stdout, "[OK]   Config file") {
+		t.Errorf("doctor = %q, want the config check", stdout)
+	}
+	if err := os.WriteFile(config.Path(rootDir), []byte(`{`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, _ = captureCmd(cmdDoctor, nil)
+	if !strings.Contains(stdout, "[FAIL] Config file") {
+		t.Errorf("doctor = %q, want the broken config reported", stdout)
+	}
+}
+
+func TestPolicyDefaults(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	if err := os.WriteFile(config.Path(rootDir), []byte(`{"default_ttl": "5m"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(policy.Path(rootDir), []byte(`{"locks": {"deploy-*": {"default_ttl": "30m", "max_ttl": "1h"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, code := captureCmd(cmdLock, []string{"deploy-web"}); code != ExitOK {
+		t.Fatalf("lock deploy-web: exit %d", code)
+	}
+	if lf, _ := lockfile.Read(filepath.Join(locksDir, "deploy-web.json")); lf == nil || lf.TTLSec != 1800 {
+		t.Errorf("lock without --ttl = %+v, want the policy default over default_ttl", lf)
+	}
+	if _, _, code := captureCmd(cmdLock, []string{"build"}); code != ExitOK {
+		t.Fatalf("lock build: exit %d", code)
+	}
+	if lf, _ := lockfile.Read(filepath.Join(locksDir, "build.json")); lf == nil || lf.TTLSec != 300 {
+		t.Errorf("unmatched lock = %+v, want default_ttl", lf)
+	}
+
+	_, stderr, code := captureCmd(cmdLock, []string{"--ttl", "2h", "deploy-api"})
+	if code != ExitError || !strings.Contains(stderr, `exceeds max_ttl 1h0m0s (policy.json rule "deploy-*")`) {
+		t.Errorf("lock over max_ttl: exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestWaitRetryPolicy(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	if p := waitRetryPolicy(rootDir); p.Max != 0 {
+		t.Errorf("without config: %+v, want the zero (default) policy", p)
+	}
+	if err := os.WriteFile(config.Path(rootDir), []byte(`{"wait_poll_interval": "500ms", "watch_interval": "10s"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if p := waitRetryPolicy(rootDir); p.Max != 500*time.Millisecond || p.Base != 50*time.Millisecond {
+		t.Errorf("wait_poll_interval 500ms: %+v", p)
+	}
+	if d := watchInterval(rootDir); d != 10*time.Second {
+		t.Errorf("watchInterval() = %v, want 10s", d)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// Statuses of an inspect check, mildest first.
+const (
+	inspectSkip  = "skip" // doesn't apply, or can't be checked from here
+	inspectOK    = "ok"
+	inspectWarn  = "warn"
+	inspectStale = "stale"
+	inspectError = "error"
+)
+
+// Verdicts of lokt inspect, each with its own exit code.
+const (
+	verdictValid     = "valid"     // ExitOK
+	verdictStale     = "stale"     // ExitStale
+	verdictCorrupted = "corrupted" // ExitError
+)
+
+// inspectCheck is one line of the validation report.
+type inspectCheck struct {
+	Check  string `json:"check"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// inspectOutput is the lokt inspect --json output.
+type inspectOutput struct {
+	Name   string `json:"name"`
+	Freeze bool   `json:"freeze,omitempty"`
+	Path   string `json:"path"`
+	// Legacy marks a freeze found at locks/freeze-<name>.json, where lokt
+	// kept freezes before freezes/.
+	Legacy      bool             `json:"legacy,omitempty"`
+	Raw         string           `json:"raw"` // the file as read, up to lockfile.MaxFileSize
+	Issues      []lockfile.Issue `json:"issues"`
+	Checks      []inspectCheck   `json:"checks"`
+	Verdict     string           `json:"verdict"`
+	StaleReason stale.Reason     `json:"stale_reason,omitempty"`
+}
+
+// cmdInspect prints a lock or freeze file exactly as it is on disk, then
+// checks it: lockfile.Validate for its fields, stale for its holder. It
+// takes and changes nothing, so it also reads files other commands reject.
+func cmdInspect(args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	freeze := fs.Bool("freeze", false, "Inspect the freeze on <name> (freezes/, else the legacy locks/freeze-<name>.json)")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	_ = fs.Parse(interspersed(fs, args))
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: lokt inspect [--freeze] [--json] <name>")
+		return ExitUsage
+	}
+	name := fs.Arg(0)
+	if err := lockfile.ValidateName(name); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+	rootDir, err := root.Find()
+	if err != nil {
+		reportError(name, err, "")
+		return ExitError
+	}
+
+	out := inspectOutput{Name: name, Freeze: *freeze, Path: root.LockFilePath(rootDir, name)}
+	if *freeze {
+		out.Path = root.FreezeFilePath(rootDir, name)
+		if _, err := os.Lstat(out.Path); os.IsNotExist(err) {
+			out.Path, out.Legacy = root.LockFilePath(rootDir, lock.FreezePrefix+name), true
+		}
+	}
+	data, err := readInspected(out.Path)
+	if os.IsNotExist(err) {
+		what := fmt.Sprintf("lock %q", name)
+		if *freeze {
+			what = fmt.Sprintf("freeze on %q", name)
+		}
+		reportError(name, lock.ErrNotFound, fmt.Sprintf("error: %s not found", what))
+		return ExitNotFound
+	}
+	if err != nil {
+		reportError(name, err, "")
+		return ExitError
+	}
+	out.Raw = string(data)
+	inspectFile(&out, data, skewGrace(rootDir))
+
+	if *jsonOutput {
+		if out.Issues == nil {
+			out.Issues = []lockfile.Issue{}
+		}
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printInspect(os.Stdout, out)
+	}
+	switch out.Verdict {
+	case verdictValid:
+		return ExitOK
+	case verdictStale:
+		return ExitStale
+	}
+	return ExitError
+}
+
+// readInspected reads up to one byte more than lockfile.MaxFileSize of
+// path, enough to tell a file over the limit.
+func readInspected(path string) ([]byte, error) {
+	f, err := os.Open(path) //nolint:gosec // G304: built from the lokt root and a validated name
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return io.ReadAll(io.LimitReader(f, lockfile.MaxFileSize+1))
+}
+
+// inspectFile fills in out's issues, checks and verdict for the file data
+// read from out.Path.
+func inspectFile(out *inspectOutput, data []byte, grace time.Duration) {
+	out.Verdict = verdictCorrupted
+	check := func(name, status, detail string) {
+		out.Checks = append(out.Checks, inspectCheck{Check: name, Status: status, Detail: detail})
+	}
+	switch {
+	case len(data) == 0:
+		check("json", inspectError, "the file is empty (being written, or left by a crash)")
+		return
+	case len(data) > lockfile.MaxFileSize:
+		check("json", inspectError, fmt.Sprintf("larger than %d bytes; lokt reads no further", lockfile.MaxFileSize))
+		return
+	}
+
+	// Parse rejects a file from a newer lokt, badly signed or without the
+	// required fields; decode those anyway to say what is wrong with them.
+	lf, err := lockfile.Parse(data)
+	if errors.Is(err, lockfile.ErrUnsupportedVersion) || errors.Is(err, lockfile.ErrBadSignature) || errors.Is(err, lockfile.ErrInvalidSchema) {
+		lf = &lockfile.Lock{}
+		if json.Unmarshal(data, lf) != nil {
+			lf = nil
+		}
+	}
+	if lf == nil {
+		check("json", inspectError, strings.TrimPrefix(err.Error(), lockfile.ErrCorrupted.Error()+": "))
+		return
+	}
+
+	out.Issues = lockfile.Validate(lf)
+	if lf.Name != "" && lf.Name != out.Name && !out.Legacy {
+		out.Issues = append(out.Issues, lockfile.Issue{
+			Field: "name", Severity: lockfile.SeverityWarning, Message: fmt.Sprintf("%q, not the %q the file is named after", lf.Name, out.Name),
+		})
+	}
+	byCheck := map[string][]lockfile.Issue{}
+	for _, is := range out.Issues {
+		byCheck[inspectCheckOf(is.Field)] = append(byCheck[inspectCheckOf(is.Field)], is)
+	}
+	fromIssues := func(name, okDetail string) {
+		issues := byCheck[name]
+		if len(issues) == 0 {
+			check(name, inspectOK, okDetail)
+			return
+		}
+		status := inspectWarn
+		if lockfile.HasError(issues) {
+			status = inspectError
+		}
+		msgs := make([]string, len(issues))
+		for i, is := range issues {
+			msgs[i] = is.String()
+		}
+		check(name, status, strings.Join(msgs, "; "))
+	}
+
+	// The holder, as stale judges it
+	r := stale.CheckFile(out.Path, lf, grace)
+	if out.Freeze {
+		// A freeze's pid is the freeze command's, gone by design
+		r = stale.Result{}
+		if lf.IsExpired() {
+			r = stale.Result{Stale: true, Reason: stale.ReasonExpired}
+		}
+	}
+
+	fromIssues("version", fmt.Sprintf("%d (supported)", lf.Version))
+	fromIssues("fields", "name, owner, host, pid and acquired_ts present")
+	fromIssues("lock_id", lf.LockID)
+	fromIssues("expiry", expiryDetail(lf))
+	if c := &out.Checks[len(out.Checks)-1]; c.Status == inspectOK && r.Reason == stale.ReasonExpired {
+		c.Status = inspectStale
+	}
+	if lockfile.Signing() {
+		fromIssues("sig", "signed with a configured key")
+	}
+	if lockfile.HasError(out.Issues) {
+		return
+	}
+	out.Checks = append(out.Checks, holderChecks(lf, out.Freeze)...)
+	out.Verdict = verdictValid
+	if r.Stale {
+		out.Verdict, out.StaleReason = verdictStale, r.Reason
+	}
+}
+
+// inspectCheckOf returns the check a lockfile.Issue on field belongs to.
+func inspectCheckOf(field string) string {
+	switch field {
+	case "version", "lock_id", "sig":
+		return field
+	case "expires_at", "ttl_sec":
+		return "expiry"
+	}
+	return "fields"
+}
+
+// expiryDetail describes a consistent expiry.
+func expiryDetail(lf *lockfile.Lock) string {
+	exp, ok := lf.Expiry()
+	if !ok {
+		return "no TTL"
+	}
+	if lf.IsExpired() {
+		return fmt.Sprintf("expired %s ago", time.Since(exp).Truncate(time.Second))
+	}
+	return fmt.Sprintf("expires in %s (%s)", time.Until(exp).Truncate(time.Second), exp.Format(time.RFC3339))
+}
+
+// holderChecks checks lf's pid and pid_start_ns against this host's
+// processes.
+func holderChecks(lf *lockfile.Lock, freeze bool) []inspectCheck {
+	skip := func(why string) []inspectCheck {
+		return []inspectCheck{{"pid", inspectSkip, why}, {"pid_start", inspectSkip, why}}
+	}
+	host, _ := os.Hostname()
+	switch {
+	case freeze:
+		return skip("a freeze's pid is the freeze command's, gone by design")
+	case lf.Retained:
+		return skip("retained: the holder exited by design")
+	case lf.Host != host:
+		return skip(fmt.Sprintf("held on %s; not checkable from %s", lf.Host, host))
+	case !stale.IsProcessAlive(lf.PID):
+		return []inspectCheck{
+			{"pid", inspectStale, fmt.Sprintf("%d is not running on this host", lf.PID)},
+			{"pid_start", inspectSkip, "no process to compare"},
+		}
+	}
+	checks := []inspectCheck{{"pid", inspectOK, fmt.Sprintf("%d is running on this host", lf.PID)}}
+	if lf.PIDStartNS == 0 {
+		return append(checks, inspectCheck{"pid_start", inspectSkip, "not recorded; a recycled pid can't be told apart"})
+	}
+	startNS, err := stale.GetProcessStartTime(lf.PID)
+	switch {
+	case err != nil:
+		return append(checks, inspectCheck{"pid_start", inspectSkip, fmt.Sprintf("can't read the running process's start time: %v", err)})
+	case startNS != lf.PIDStartNS:
+		return append(checks, inspectCheck{"pid_start", inspectStale, fmt.Sprintf("pid %d now belongs to another process (recycled)", lf.PID)})
+	}
+	return append(checks, inspectCheck{"pid_start", inspectOK, "matches the running process"})
+}
+
+// printInspect prints out as lokt inspect does without --json.
+func printInspect(w io.Writer, out inspectOutput) {
+	fmt.Fprintf(w, "path: %s", out.Path)
+	if out.Legacy {
+		fmt.Fprint(w, " (legacy freeze location; lokt doctor --fix moves it)")
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w)
+	fmt.Fprint(w, out.Raw)
+	if !strings.HasSuffix(out.Raw, "\n") {
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+	width := 0
+	for _, c := range out.Checks {
+		width = max(width, len(c.Check))
+	}
+	for _, c := range out.Checks {
+		fmt.Fprintf(w, "%-*s  %-5s  %s\n", width, c.Check, c.Status, c.Detail)
+	}
+	fmt.Fprintln(w)
+	verdict := out.Verdict
+	if out.StaleReason != stale.ReasonNotStale {
+		verdict += " (" + out.StaleReason.Description() + ")"
+	}
+	if i := slices.IndexFunc(out.Checks, func(c inspectCheck) bool { return c.Status == inspectError }); i >= 0 {
+		verdict += " (" + out.Checks[i].Check + ")"
+	}
+	fmt.Fprintf(w, "verdict: %s\n", verdict)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+func TestInspect(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	host, _ := os.Hostname()
+	exp := time.Now().Add(time.Hour)
+	write := func(path string, lf *lockfile.Lock) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := lockfile.Write(path, lf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	live := &lockfile.Lock{
+		Version: 1, Name: "live", LockID: lockfile.GenerateLockID(), Owner: "me", Host: host, PID: os.Getpid(),
+		AcquiredAt: exp.Add(-time.Hour), TTLSec: 3600, ExpiresAt: &exp,
+	}
+	write(root.LockFilePath(rootDir, "live"), live)
+	dead := *live
+	dead.Name, dead.PID = "dead", 999999999
+	write(root.LockFilePath(rootDir, "dead"), &dead)
+	if err := os.WriteFile(filepath.Join(locksDir, "garbled.json"), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(locksDir, "future.json"), []byte(`{"version": 99, "name": "future"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	legacy := *live
+	legacy.Name = "freeze-deploy"
+	write(root.LockFilePath(rootDir, "freeze-deploy"), &legacy)
+
+	tests := []struct {
+		args    []string
+		code    int
+		verdict string
+	}{
+		{[]string{"live"}, ExitOK, verdictValid},
+		{[]string{"dead"}, ExitStale, verdictStale},
+		{[]string{"garbled"}, ExitError, verdictCorrupted},
+		{[]string{"future"}, ExitError, verdictCorrupted},
+		{[]string{"--freeze", "deploy"}, ExitOK, verdictValid},
+	}
+	for _, tt := range tests {
+		stdout, stderr, code := captureCmd(cmdInspect, append([]string{"--json"}, tt.args...))
+		var out inspectOutput
+		if err := json.Unmarshal([]byte(stdout), &out); err != nil || code != tt.code || out.Verdict != tt.verdict {
+			t.Errorf("inspect %v: exit %d, verdict %q, stderr %q; want %d, %q", tt.args, code, out.Verdict, stderr, tt.code, tt.verdict)
+		}
+	}
+
+	// The file as it is on disk, then the report
+	stdout, _, _ := captureCmd(cmdInspect, []string{"dead"})
+	data, _ := os.ReadFile(root.LockFilePath(rootDir, "dead"))
+	if !strings.Contains(stdout, string(data)) || !strings.Contains(stdout, "pid        stale") ||
+		!strings.Contains(stdout, "verdict: stale ("+stale.ReasonDeadPID.Description()+")") {
+		t.Errorf("inspect dead:\n%s", stdout)
+	}
+	stdout, _, _ = captureCmd(cmdInspect, []string{"future"})
+	if !strings.Contains(stdout, "version  error  version: 99 is newer") {
+		t.Errorf("inspect future:\n%s", stdout)
+	}
+	stdout, _, _ = captureCmd(cmdInspect, []string{"deploy", "--freeze"})
+	if !strings.Contains(stdout, "legacy freeze location") || !strings.Contains(stdout, "pid        skip") {
+		t.Errorf("inspect deploy --freeze:\n%s", stdout)
+	}
+
+	if _, stderr, code := captureCmd(cmdInspect, []string{"missing"}); code != ExitNotFound || !strings.Contains(stderr, `lock "missing" not found`) {
+		t.Errorf("inspect missing: exit %d, stderr %q", code, stderr)
+	}
+	if _, _, code := captureCmd(cmdInspect, []string{"--freeze", "live"}); code != ExitNotFound {
+		t.Errorf("inspect --freeze of an unfrozen name: exit %d, want %d", code, ExitNotFound)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// labelFlag collects repeated --label key=value flags.
+type labelFlag map[string]string
+
+func (l labelFlag) String() string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (l labelFlag) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("label %q: want key=value", s)
+	}
+	if _, err := lockfile.CleanLabels(map[string]string{k: v}); err != nil {
+		return err
+	}
+	l[k] = v
+	return nil
+}
+
+// formatLabels renders labels as sorted key=value pairs for status.
+func formatLabels(labels map[string]string) string {
+	return labelFlag(labels).String()
+}
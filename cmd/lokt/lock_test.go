@@ -2,10 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lock"
 	"github.com/nikolasavic/lokt/internal/lockfile"
 )
 
@@ -68,6 +73,9 @@ func TestLock_JSONDeny(t *testing.T) {
 	if out.HolderAcquiredTS == "" {
 		t.Error("expected holder_acquired_ts to be set")
 	}
+	if out.RetryAfterSec < 239 || out.RetryAfterSec > 240 {
+		t.Errorf("expected retry_after_sec ~240 (remaining TTL), got %d", out.RetryAfterSec)
+	}
 }
 
 func TestLock_JSONDenyExpired(t *testing.T) {
@@ -99,6 +107,9 @@ func TestLock_JSONDenyExpired(t *testing.T) {
 	if out.HolderRemainSec != 0 {
 		t.Errorf("expected holder_remaining_sec 0 for expired lock, got %d", out.HolderRemainSec)
 	}
+	if out.RetryAfterSec != 1 {
+		t.Errorf("expected retry_after_sec 1 for expired lock, got %d", out.RetryAfterSec)
+	}
 }
 
 func TestLock_JSONDenyNoTTL(t *testing.T) {
@@ -132,6 +143,83 @@ func TestLock_JSONDenyNoTTL(t *testing.T) {
 	if out.HolderExpired {
 		t.Error("expected holder_expired false for no-TTL lock")
 	}
+	if out.RetryAfterSec != 60 {
+		t.Errorf("expected default retry_after_sec 60 for no-TTL lock, got %d", out.RetryAfterSec)
+	}
+}
+
+func TestLock_RetryHint(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "other-agent")
+	if err := os.WriteFile(filepath.Join(rootDir, "config.json"), []byte(`{"retry_after_default": "2m"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+	writeLockJSON(t, locksDir, "no-ttl.json", &lockfile.Lock{
+		Name: "no-ttl", Owner: "charlie", Host: hostname, PID: os.Getpid(), AcquiredAt: time.Now(),
+	})
+
+	stdout, _, _ := captureCmd(cmdLock, []string{"--json", "no-ttl"})
+	var out lockDenyOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("invalid JSON: %v\noutput: %s", err, stdout)
+	}
+	if out.RetryAfterSec != 120 {
+		t.Errorf("expected configured retry_after_sec 120, got %d", out.RetryAfterSec)
+	}
+
+	_, stderr, code := captureCmd(cmdLock, []string{"no-ttl"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "try again in ~2m") {
+		t.Errorf("deny: exit %d, stderr %q", code, stderr)
+	}
+
+	_, stderr, code = captureCmd(cmdLock, []string{"--wait", "--timeout", "100ms", "no-ttl"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "timeout") || !strings.Contains(stderr, "try again in ~2m") {
+		t.Errorf("timeout: exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestGuard_FrozenRetryHint(t *testing.T) {
+	setupTestRoot(t)
+	if code := cmdFreeze([]string{"--ttl", "3m", "deploy"}); code != ExitOK {
+		t.Fatalf("freeze failed: %d", code)
+	}
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"deploy", "--", "true"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "try again in ~3m") {
+		t.Errorf("frozen guard: exit %d, stderr %q", code, stderr)
+	}
+
+	_, stderr, code = captureCmd(cmdGuard, []string{"--wait-thaw", "--timeout", "100ms", "deploy", "--", "true"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "timeout waiting for freeze") || !strings.Contains(stderr, "try again in ~3m") {
+		t.Errorf("thaw timeout: exit %d, stderr %q", code, stderr)
+	}
+}
+
+func TestLock_RespectFreeze(t *testing.T) {
+	setupTestRoot(t)
+	if code := cmdFreeze([]string{"--ttl", "3m", "deploy"}); code != ExitOK {
+		t.Fatalf("freeze failed: %d", code)
+	}
+
+	_, stderr, code := captureCmd(cmdLock, []string{"--respect-freeze", "deploy"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "frozen") {
+		t.Errorf("lock --respect-freeze: exit %d, stderr %q", code, stderr)
+	}
+	stdout, _, code := captureCmd(cmdLock, []string{"--respect-freeze", "--json", "deploy"})
+	var out lockDenyOutput
+	if code != ExitLockHeld || json.Unmarshal([]byte(stdout), &out) != nil || out.Status != "blocked" || out.RetryAfterSec < 170 {
+		t.Errorf("lock --respect-freeze --json: exit %d, stdout %q", code, stdout)
+	}
+	stdout, _, code = captureCmd(cmdLock, []string{"--respect-freeze", "--json", "deploy", "other"})
+	if code != ExitLockHeld || !strings.Contains(stdout, `"status":"frozen"`) {
+		t.Errorf("lock --respect-freeze with several names: exit %d, stdout %q", code, stdout)
+	}
+
+	// Without the flag lock ignores the freeze, as before
+	if code := cmdLock([]string{"deploy"}); code != ExitOK {
+		t.Errorf("lock without --respect-freeze: exit %d", code)
+	}
 }
 
 func TestLock_JSONAcquireSuccess(t *testing.T) {
@@ -205,3 +293,212 @@ func TestLock_WithoutJSON_Unchanged(t *testing.T) {
 		t.Error("stderr should not be valid JSON without --json flag")
 	}
 }
+
+func TestLock_PollFlags(t *testing.T) {
+	setupTestRoot(t)
+
+	tests := []struct {
+		name    string
+		cmd     func([]string) int
+		args    []string
+		wantErr string
+	}{
+		{"lock/no-wait", cmdLock, []string{"--poll-min", "1s", "x"}, "require --wait"},
+		{"lock/negative", cmdLock, []string{"--wait", "--poll-max", "-1s", "x"}, "must be positive"},
+		{"lock/min-over-max", cmdLock, []string{"--wait", "--poll-min", "5s", "--poll-max", "1s", "x"}, "--poll-min 5s exceeds --poll-max 1s"},
+		{"guard/min-over-max", cmdGuard, []string{"--wait", "--poll-min", "5s", "--poll-max", "1s", "x", "--", "true"}, "exceeds --poll-max"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stderr, code := captureCmd(tt.cmd, tt.args)
+			if code != ExitUsage || !strings.Contains(stderr, tt.wantErr) {
+				t.Errorf("exit %d, stderr %q; want %d and %q", code, stderr, ExitUsage, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLock_TimeoutReportsAttempts(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "busy.json", &lockfile.Lock{
+		Name: "busy", Owner: "alice", Host: "other-host", PID: 42, AcquiredAt: time.Now(),
+	})
+
+	// A constant 10ms poll makes well over 5 attempts in 300ms.
+	_, stderr, code := captureCmd(cmdLock, []string{"--wait", "--timeout", "300ms", "--poll-min", "10ms", "--poll-max", "10ms", "busy"})
+	if code != ExitLockHeld {
+		t.Fatalf("exit = %d, want %d (stderr %q)", code, ExitLockHeld, stderr)
+	}
+	var attempts int
+	if i := strings.Index(stderr, "gave up after "); i < 0 {
+		t.Fatalf("stderr = %q, want the attempt count", stderr)
+	} else if _, err := fmt.Sscanf(stderr[i:], "gave up after %d attempts", &attempts); err != nil || attempts < 5 {
+		t.Errorf("stderr = %q, want more than 5 attempts at a 10ms poll", stderr)
+	}
+}
+
+func TestWithPollFlags(t *testing.T) {
+	p := withPollFlags(lock.RetryPolicy{}, 0, 0)
+	if p.Base != 0 || p.Max != 0 {
+		t.Errorf("no flags = %+v, want the zero (default) policy", p)
+	}
+	p = withPollFlags(lock.RetryPolicy{}, 0, 20*time.Millisecond)
+	if p.Base != 20*time.Millisecond || p.Max != 20*time.Millisecond {
+		t.Errorf("--poll-max 20ms = %v..%v, want the first interval capped too", p.Base, p.Max)
+	}
+	p = withPollFlags(lock.RetryPolicy{}, 5*time.Second, 0)
+	if p.Base != 5*time.Second || p.Max != 5*time.Second {
+		t.Errorf("--poll-min 5s = %v..%v, want the cap raised to it", p.Base, p.Max)
+	}
+}
+
+func TestLock_TakeOverFrom(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "standby")
+	hostname, _ := os.Hostname()
+
+	if _, _, code := captureCmd(cmdLock, []string{"--force-takeover", "db"}); code != ExitUsage {
+		t.Errorf("--force-takeover alone: exit %d, want %d", code, ExitUsage)
+	}
+	if _, _, code := captureCmd(cmdLock, []string{"--take-over-from", "primary", "db"}); code != ExitNotFound {
+		t.Errorf("nothing to take over: exit %d, want %d", code, ExitNotFound)
+	}
+
+	// A live hold is only taken with --force-takeover.
+	writeLockJSON(t, locksDir, "db.json", &lockfile.Lock{
+		Version: 1, Name: "db", LockID: "live", Owner: "primary", Host: hostname, PID: os.Getpid(),
+		AcquiredAt: time.Now(),
+	})
+	if _, stderr, code := captureCmd(cmdLock, []string{"--take-over-from", "primary", "db"}); code != ExitLockHeld || !strings.Contains(stderr, "--force-takeover") {
+		t.Errorf("live holder: exit %d (stderr %q), want %d", code, stderr, ExitLockHeld)
+	}
+
+	// --respect-freeze refuses a frozen name, as without --take-over-from.
+	if _, _, code := captureCmd(cmdFreeze, []string{"db", "--ttl", "1h"}); code != ExitOK {
+		t.Fatalf("freeze db: exit %d", code)
+	}
+	if _, stderr, code := captureCmd(cmdLock, []string{"db", "--take-over-from", "primary", "--force-takeover", "--respect-freeze"}); code != ExitLockHeld || !strings.Contains(stderr, "frozen") {
+		t.Errorf("frozen with --respect-freeze: exit %d (stderr %q), want %d", code, stderr, ExitLockHeld)
+	}
+	if _, _, code := captureCmd(cmdUnfreeze, []string{"db"}); code != ExitOK {
+		t.Fatalf("unfreeze db: exit %d", code)
+	}
+
+	// An expired hold by someone else is not the expected owner's.
+	writeLockJSON(t, locksDir, "db.json", &lockfile.Lock{
+		Version: 1, Name: "db", LockID: "other", Owner: "replica", Host: hostname, PID: os.Getpid(),
+		AcquiredAt: time.Now().Add(-time.Hour), TTLSec: 60,
+	})
+	if _, _, code := captureCmd(cmdLock, []string{"--take-over-from", "primary", "db"}); code != ExitLockHeld {
+		t.Errorf("held by another owner: exit %d, want %d", code, ExitLockHeld)
+	}
+
+	writeLockJSON(t, locksDir, "db.json", &lockfile.Lock{
+		Version: 1, Name: "db", LockID: "expired", Owner: "primary", Host: hostname, PID: os.Getpid(),
+		AcquiredAt: time.Now().Add(-time.Hour), TTLSec: 60,
+	})
+	stdout, stderr, code := captureCmd(cmdLock, []string{"--take-over-from", "primary", "db"})
+	if code != ExitOK {
+		t.Fatalf("stale holder: exit %d, stderr %s", code, stderr)
+	}
+	if !strings.Contains(stdout, `took over lock "db" from primary`) {
+		t.Errorf("stdout = %q", stdout)
+	}
+	lf, err := lockfile.Read(filepath.Join(locksDir, "db.json"))
+	if err != nil || lf.Owner != "standby" {
+		t.Fatalf("lock after takeover = %+v, %v; want standby's", lf, err)
+	}
+	var takeover *audit.Event
+	_ = audit.ScanFile(audit.Path(rootDir), func(e *audit.Event, _ []byte) bool {
+		if e.Event == audit.EventTakeover {
+			takeover = e
+		}
+		return true
+	})
+	if takeover == nil || takeover.Owner != "standby" || takeover.Extra["previous_owner"] != "primary" || takeover.Extra["previous_lock_id"] != "expired" {
+		t.Errorf("takeover event = %+v, want standby taking over primary's lock", takeover)
+	}
+}
+
+func TestLock_ForPath(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	artifact := filepath.Join(t.TempDir(), "cache", "pkg-abc123.tar")
+	name, err := lock.NameForPath(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, code := captureCmd(cmdLock, []string{"--for-path", artifact, "other"}); code != ExitUsage {
+		t.Errorf("--for-path with a name: exit %d, want %d", code, ExitUsage)
+	}
+	stdout, stderr, code := captureCmd(cmdLock, []string{"--for-path", artifact})
+	if code != ExitOK {
+		t.Fatalf("lock --for-path: exit %d, stderr %s", code, stderr)
+	}
+	if want := fmt.Sprintf("acquired lock %q for %s", name, artifact); !strings.Contains(stdout, want) {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+	lf, err := lockfile.Read(filepath.Join(locksDir, name+".json"))
+	if err != nil || lf.Path != artifact {
+		t.Fatalf("lock file: %+v, %v; want path %s", lf, err, artifact)
+	}
+
+	stdout, _, _ = captureCmd(cmdStatus, []string{"--json", name})
+	var status struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &status); err != nil || status.Path != artifact {
+		t.Errorf("status --json = %s (%v), want the path", stdout, err)
+	}
+	if _, stderr, code := captureCmd(cmdUnlock, []string{"--for-path", artifact}); code != ExitOK {
+		t.Errorf("unlock --for-path: exit %d, stderr %s", code, stderr)
+	}
+}
+
+func TestLock_LongName(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	name := "deploy/" + strings.Repeat("k", 300)
+	stem := lockfile.FileStem(name)
+
+	if _, stderr, code := captureCmd(cmdLock, []string{name}); code != ExitOK {
+		t.Fatalf("lock: exit %d, stderr %s", code, stderr)
+	}
+	lf, err := lockfile.Read(filepath.Join(locksDir, stem+".json"))
+	if err != nil || lf.Name != name {
+		t.Fatalf("lock file under the stem: %+v, %v; want the full name inside", lf, err)
+	}
+
+	// status resolves the logical name and the stem alike.
+	for _, arg := range []string{name, stem} {
+		stdout, stderr, code := captureCmd(cmdStatus, []string{arg})
+		if code != ExitOK || !strings.Contains(stdout, name) {
+			t.Errorf("status %.20s...: exit %d, stdout %q, stderr %q", arg, code, stdout, stderr)
+		}
+	}
+	if _, stderr, code := captureCmd(cmdUnlock, []string{name}); code != ExitOK {
+		t.Errorf("unlock: exit %d, stderr %s", code, stderr)
+	}
+
+	// Released by the stem just as well.
+	if _, stderr, code := captureCmd(cmdLock, []string{name}); code != ExitOK {
+		t.Fatalf("relock: exit %d, stderr %s", code, stderr)
+	}
+	if _, stderr, code := captureCmd(cmdUnlock, []string{stem}); code != ExitOK {
+		t.Errorf("unlock by stem: exit %d, stderr %s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, stem+".json")); !os.IsNotExist(err) {
+		t.Errorf("lock left behind (stat: %v)", err)
+	}
+}
+
+func TestLock_InvalidCharacters(t *testing.T) {
+	setupTestRoot(t)
+	for _, name := range []string{"dé ploy", "déploy", "my lock"} {
+		for cmd, run := range map[string]func([]string) int{"lock": cmdLock, "unlock": cmdUnlock} {
+			_, stderr, code := captureCmd(run, []string{name})
+			if code != ExitError || !strings.Contains(stderr, "allowed are") {
+				t.Errorf("%s %q: exit %d, stderr %q; want the character explained", cmd, name, code, stderr)
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+const watchUsage = "usage: lokt watch [--timeout d] [--and-acquire [--ttl d]] <name> [--exec <command...>]"
+
+// cmdWatch waits, without acquiring, until name could be acquired (absent,
+// stale or released) and then exits 0, or runs the command after --exec (or
+// --) without a lock. With --and-acquire it takes the lock once it frees
+// and holds it while the command runs, as guard --wait does.
+func cmdWatch(args []string) int {
+	var cmdArgs []string
+	for i, arg := range args {
+		if arg == "--exec" || arg == "--" {
+			args, cmdArgs = args[:i], args[i+1:]
+			if len(cmdArgs) == 0 {
+				fmt.Fprintln(os.Stderr, watchUsage)
+				return ExitUsage
+			}
+			break
+		}
+	}
+
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 0, "Maximum time to wait (default: 10m)")
+	andAcquire := fs.Bool("and-acquire", false, "Acquire the lock once it frees and hold it while the command runs")
+	ttl := fs.Duration("ttl", 0, "Lock TTL with --and-acquire (default: default_ttl in config.json)")
+	if err := fs.Parse(interspersed(fs, args)); err != nil || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, watchUsage)
+		return ExitUsage
+	}
+	if *timeout < 0 {
+		fmt.Fprintln(os.Stderr, "error: --timeout must be positive (e.g., 5s, 1m)")
+		return ExitUsage
+	}
+	if *ttl < 0 {
+		fmt.Fprintln(os.Stderr, "error: TTL must be positive (e.g., 5m, 1h)")
+		return ExitUsage
+	}
+	if *andAcquire && len(cmdArgs) == 0 {
+		fmt.Fprintln(os.Stderr, "error: --and-acquire needs a command to hold the lock for (--exec <command...>)")
+		return ExitUsage
+	}
+	if *ttl != 0 && !*andAcquire {
+		fmt.Fprintln(os.Stderr, "error: --ttl requires --and-acquire")
+		return ExitUsage
+	}
+	name := fs.Arg(0)
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	retryDefault := retryAfterDefault(rootDir)
+	groups := exclusionGroups(rootDir)
+	retry := waitRetryPolicy(rootDir) // unset: DefaultRetryPolicy
+
+	ctx, cancel := waitContext(*timeout, waitBudgetDeadline(0, time.Now()))
+	defer cancel()
+	err = lock.Check(rootDir, name, retryDefault, groups)
+	if err != nil && blocked(err) {
+		fmt.Fprintf(os.Stderr, "watching: %v\n", err)
+		err = waitCheck(ctx, rootDir, name, retryDefault, groups, retry, err)
+	}
+	switch {
+	case err == nil:
+	case errors.Is(ctx.Err(), context.Canceled):
+		fmt.Fprintf(os.Stderr, "interrupted while watching %q\n", name)
+		return ExitError
+	case blocked(err):
+		fmt.Fprintf(os.Stderr, "error: still blocked after waiting%s: %v\n", budgetNote(ctx), err)
+		return ExitLockHeld
+	default:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	if len(cmdArgs) == 0 {
+		fmt.Fprintf(os.Stderr, "lock %q is free\n", name)
+		return ExitOK
+	}
+	remaining := time.Millisecond
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) > remaining {
+		remaining = time.Until(deadline)
+	}
+	cancel() // the command, or guard, handles signals from here on
+	if *andAcquire {
+		fmt.Fprintf(os.Stderr, "lock %q is free, acquiring it for the command\n", name)
+		return watchAcquire(name, remaining, *ttl, cmdArgs)
+	}
+	fmt.Fprintf(os.Stderr, "lock %q is free, running the command without it\n", name)
+	return runUnlocked(cmdArgs)
+}
+
+// watchAcquire hands a freed lock's command to guard, which waits up to
+// remaining, what is left of the watch's timeout, should someone else take
+// the lock first.
+func watchAcquire(name string, remaining, ttl time.Duration, cmdArgs []string) int {
+	guardArgs := []string{"--wait", "--timeout", remaining.String()}
+	if ttl > 0 {
+		guardArgs = append(guardArgs, "--ttl", ttl.String())
+	}
+	guardArgs = append(append(guardArgs, name, "--"), cmdArgs...)
+	return cmdGuard(guardArgs)
+}
+
+// runUnlocked runs cmdArgs with lokt's stdio and returns its exit code, or
+// ExitError if it couldn't be started or was killed. SIGINT and SIGTERM are
+// passed on to it rather than stopping lokt first.
+func runUnlocked(cmdArgs []string) int {
+	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...) //nolint:gosec // G204: the command is the user's own
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to start command: %v\n", err)
+		return ExitError
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	for {
+		select {
+		case sig := <-sigs:
+			_ = cmd.Process.Signal(sig)
+		case err := <-done:
+			var exitErr *exec.ExitError
+			switch {
+			case err == nil:
+				return ExitOK
+			case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+				return exitErr.ExitCode()
+			}
+			fmt.Fprintf(os.Stderr, "error: command: %v\n", err)
+			return ExitError
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestWatch_FreeAndTimeout(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "held.json", &lockfile.Lock{
+		Version: 1, Name: "held", Owner: "other", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+
+	if _, stderr, code := captureCmd(cmdWatch, []string{"free"}); code != ExitOK || !strings.Contains(stderr, `lock "free" is free`) {
+		t.Errorf("watch free: exit %d, stderr %q; want 0", code, stderr)
+	}
+
+	start := time.Now()
+	_, stderr, code := captureCmd(cmdWatch, []string{"held", "--timeout", "300ms", "--exec", "touch", filepath.Join(t.TempDir(), "ran")})
+	if code != ExitLockHeld || !strings.Contains(stderr, "held by other") {
+		t.Errorf("exit %d, stderr %q; want held after timeout", code, stderr)
+	}
+	if time.Since(start) < 300*time.Millisecond {
+		t.Error("watch returned before its timeout")
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "held.json")); err != nil {
+		t.Errorf("watch must not touch the lock: %v", err)
+	}
+}
+
+func TestWatch_ExecOnRelease(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "held.json", &lockfile.Lock{
+		Version: 1, Name: "held", Owner: "other", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = os.Remove(filepath.Join(locksDir, "held.json"))
+	}()
+
+	// The command runs without the lock: the lock file must be absent.
+	script := "test ! -e " + filepath.Join(locksDir, "held.json") + " && exit 3"
+	_, stderr, code := captureCmd(cmdWatch, []string{"--timeout", "5s", "held", "--exec", "sh", "-c", script})
+	if code != 3 {
+		t.Errorf("exit %d (stderr %q), want the command's 3", code, stderr)
+	}
+	if !strings.Contains(stderr, "watching:") || !strings.Contains(stderr, "without it") {
+		t.Errorf("stderr %q, want the wait and the unlocked run reported", stderr)
+	}
+}
+
+func TestWatch_AndAcquire(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "held.json", &lockfile.Lock{
+		Version: 1, Name: "held", Owner: "other", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = os.Remove(filepath.Join(locksDir, "held.json"))
+	}()
+
+	// The command runs holding the lock, which is released afterwards.
+	script := "test -e " + filepath.Join(locksDir, "held.json")
+	_, stderr, code := captureCmd(cmdWatch, []string{"held", "--timeout", "5s", "--and-acquire", "--", "sh", "-c", script})
+	if code != ExitOK || !strings.Contains(stderr, "acquiring it for the command") {
+		t.Errorf("exit %d (stderr %q), want 0 with the lock held", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "held.json")); !os.IsNotExist(err) {
+		t.Errorf("lock left behind after the command (stat: %v)", err)
+	}
+}
+
+func TestWatch_Usage(t *testing.T) {
+	setupTestRoot(t)
+	for _, args := range [][]string{
+		nil, {"a", "b"}, {"a", "--exec"}, {"--and-acquire", "a"}, {"--ttl", "5m", "a", "--", "true"},
+	} {
+		if _, _, code := captureCmd(cmdWatch, args); code != ExitUsage {
+			t.Errorf("watch %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
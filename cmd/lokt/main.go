@@ -2,27 +2,37 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/config"
 	"github.com/nikolasavic/lokt/internal/doctor"
+	"github.com/nikolasavic/lokt/internal/guard"
 	"github.com/nikolasavic/lokt/internal/identity"
 	"github.com/nikolasavic/lokt/internal/lock"
 	"github.com/nikolasavic/lokt/internal/lockfile"
 	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/snapshot"
 	"github.com/nikolasavic/lokt/internal/stale"
+	"github.com/nikolasavic/lokt/pkg/lokt"
 )
 
 var (
@@ -38,56 +48,162 @@ const (
 	ExitLockHeld = 2
 	ExitNotFound = 3
 	ExitNotOwner = 4
+	ExitDeadlock = 5
+	ExitStale    = 6  // status --fail-if-stale or prune --dry-run found stale locks
+	ExitReadOnly = 7  // the root can't be written (or --read-only) and the command would change it
+	ExitVanished = 8  // guard's lock file was gone or replaced when checked (lock-vanished)
+	ExitFrozen   = 9  // frozen by an operator; --exit-codes v2 only, v1 reports ExitLockHeld
+	ExitTimeout  = 10 // a --wait timed out; --exit-codes v2 only, v1 reports ExitLockHeld
 	ExitUsage    = 64
 )
 
+// lostKillGrace is how long guard --on-lost terminate gives the command to
+// exit after SIGTERM before killing it, unless --kill-timeout says otherwise.
+const lostKillGrace = 10 * time.Second
+
 // DefaultWaitTimeout is the default timeout applied when --wait is used without --timeout.
 // Prevents agents from hanging indefinitely if something goes wrong.
 const DefaultWaitTimeout = 10 * time.Minute
 
 func main() {
-	if len(os.Args) < 2 {
+	argv := os.Args[1:]
+	for n := -1; n != len(argv); { // global flags, in any order
+		n = len(argv)
+		argv = stripJSONErrorsFlag(argv)
+		var err error
+		if argv, err = stripScopeFlag(argv); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(ExitUsage)
+		}
+		if argv, err = stripRootFlag(argv); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(ExitUsage)
+		}
+		argv = stripReadOnlyFlag(argv)
+		if argv, err = stripCompatWriteFlag(argv); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(ExitUsage)
+		}
+		if argv, err = stripExitCodesFlag(argv); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(ExitUsage)
+		}
+	}
+	if len(argv) < 1 {
 		usage()
 		os.Exit(ExitUsage)
 	}
 
-	cmd := os.Args[1]
-	args := os.Args[2:]
+	cmd := argv[0]
+	args := argv[1:]
+	configureIdentity()
+	if err := configureExitCodes(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(ExitUsage)
+	}
+	if err := configureWriteVersion(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(ExitUsage)
+	}
+	// Refuse to act unsigned when keys are configured but unusable;
+	// doctor reports why
+	if err := configureSigning(); err != nil && cmd != "doctor" && cmd != "version" {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(ExitError)
+	}
 
 	// Opportunistic sweep: remove definitively stale locks before command runs.
 	// Skipped for commands that don't touch locks (version, help, audit, doctor, demo).
 	if sweepEnabled(cmd) {
 		runSweep()
 	}
+	if touchesLocks(cmd) {
+		warnRootAmbiguity()
+	}
 
 	var code int
 	switch cmd {
 	case "version":
 		fmt.Printf("lokt %s (commit: %s, built: %s)\n", version, commit, date)
+		fmt.Printf("exit codes: %s\n", exitCodeScheme())
 	case "lock":
 		code = cmdLock(args)
 	case "unlock":
 		code = cmdUnlock(args)
+	case "renew":
+		code = cmdRenew(args)
+	case "adopt":
+		code = cmdAdopt(args)
 	case "status":
 		code = cmdStatus(args)
 	case "exists":
 		code = cmdExists(args)
+	case "check":
+		code = cmdCheck(args)
+	case "watch":
+		code = cmdWatch(args)
 	case "guard":
 		code = cmdGuard(args)
+	case "run":
+		code = cmdRun(args)
+	case "plan":
+		code = cmdPlan(args)
+	case runReleaseCmd:
+		code = cmdRunRelease(args)
+	case tortureWorkerCmd:
+		code = cmdTortureWorker(args)
 	case "freeze":
 		code = cmdFreeze(args)
 	case "unfreeze":
 		code = cmdUnfreeze(args)
+	case "freezes":
+		code = cmdFreezes(args)
+	case "reserve":
+		code = cmdReserve(args)
+	case "unreserve":
+		code = cmdUnreserve(args)
+	case "reservations":
+		code = cmdReservations(args)
 	case "audit":
 		code = cmdAudit(args)
 	case "doctor":
 		code = cmdDoctor(args)
 	case "why":
 		code = cmdWhy(args)
+	case "whoami":
+		code = cmdWhoami(args)
+	case "inspect":
+		code = cmdInspect(args)
 	case "prime":
 		code = cmdPrime(args)
 	case "demo":
 		code = cmdDemo(args)
+	case "history":
+		code = cmdHistory(args)
+	case "stats":
+		code = cmdStats(args)
+	case "serve":
+		code = cmdServe(args)
+	case "relocate":
+		code = cmdRelocate(args)
+	case "export":
+		code = cmdExport(args)
+	case "import":
+		code = cmdImport(args)
+	case "sweep":
+		code = cmdSweep(args)
+	case "prune":
+		code = cmdPrune(args)
+	case "init":
+		code = cmdInit(args)
+	case "session":
+		code = cmdSession(args)
+	case "hook":
+		code = cmdHook(args)
+	case "completion":
+		code = cmdCompletion(args)
+	case "_complete":
+		code = cmdComplete(args)
 	case "help", "-h", "--help":
 		usage()
 	default:
@@ -95,58 +211,286 @@ func main() {
 		usage()
 		code = ExitUsage
 	}
+
+	// Opt-in state snapshot for post-mortem reconstruction (config: snapshot.enabled).
+	if snapshotEnabled(cmd) {
+		runSnapshot()
+	}
+	waitNotifiers()
 	os.Exit(code)
 }
 
 func usage() {
 	fmt.Println("lokt - file-based lock manager")
 	fmt.Println()
-	fmt.Println("Usage: lokt <command> [options] [args]")
+	fmt.Println("Usage: lokt [--json-errors] [--scope scope] [--root path] [--read-only] [--compat-write version] [--exit-codes v1|v2] <command> [options] [args]")
+	fmt.Println()
+	fmt.Println("Global options:")
+	fmt.Println("    --json-errors   Report lock, unlock, renew, guard, freeze and unfreeze")
+	fmt.Println("                    failures as one JSON line on stderr (also: LOKT_JSON=1)")
+	fmt.Println("    --scope scope   Which root to use: repo (default, discovered from here),")
+	fmt.Println("                    user or system, for machine-wide locks (also: LOKT_SCOPE)")
+	fmt.Println("    --root path     Use this root instead of discovering one; overrides")
+	fmt.Println("                    --scope and LOKT_SCOPE (also: LOKT_ROOT)")
+	fmt.Println("    --read-only     Refuse (exit 7) anything that would change the root; status,")
+	fmt.Println("                    audit and other queries still work (also: LOKT_READ_ONLY=1)")
+	fmt.Println("    --compat-write version  Write lock files in this older lockfile version, for")
+	fmt.Println("                    a root shared with an older lokt (also: LOKT_COMPAT_WRITE,")
+	fmt.Println("                    compat_write_version in config.json)")
+	fmt.Println("    --exit-codes v1|v2  v2 gives frozen (9) and wait timeout (10) their own exit")
+	fmt.Println("                    codes; v1, the default for now, reports both as 2 (also:")
+	fmt.Println("                    LOKT_EXIT_CODES; lokt version shows the active scheme)")
 	fmt.Println()
 	fmt.Println("Commands:")
-	fmt.Println("  lock <name>       Acquire a lock")
-	fmt.Println("    --ttl duration      Lock TTL (e.g., 5m, 1h)")
+	fmt.Println("  init              Create the lock root and a default config.json")
+	fmt.Println("    --root path     Directory to initialize (default: the discovered root)")
+	fmt.Println("  lock <name>...    Acquire a lock (several names: all or none)")
+	fmt.Println("    --ttl duration      Lock TTL (e.g., 5m, 1h; default: default_ttl in config.json)")
 	fmt.Println("    --wait              Wait for lock to be free (default timeout: 10m)")
 	fmt.Println("    --timeout duration  Maximum wait time (requires --wait, default: 10m)")
-	fmt.Println("    --json              Output JSON on acquire or deny")
-	fmt.Println("  unlock <name>     Release a lock")
+	fmt.Println("    --wait-thaw         Wait for an active freeze to lift before acquiring")
+	fmt.Println("    --no-adaptive       Keep fast polling even when many others are waiting")
+	fmt.Println("    --poll-min duration First poll interval while waiting (default: 50ms)")
+	fmt.Println("    --poll-max duration Longest poll interval while waiting (default: 2s)")
+	fmt.Println("    --json              Output JSON on acquire or deny (NDJSON with --batch)")
+	fmt.Println("    --batch file|-      Acquire all listed names, all-or-nothing")
+	fmt.Println("    --shared            Acquire a shared (read) lock alongside other shared holders")
+	fmt.Println("    --message text      Say what the lock is for (also -m); shown in status and to those it blocks")
+	fmt.Println("    --label key=value   Attach a label (repeatable; in status --json and audit)")
+	fmt.Println("    --session id        Register the lock in a session for lokt session end (default: $LOKT_SESSION)")
+	fmt.Println("    --take-over-from owner  Replace owner's lock, only while owner holds it and it is stale")
+	fmt.Println("    --force-takeover    With --take-over-from, take over even if the hold isn't stale")
+	fmt.Println("    --for-path path     Lock a file under its canonical name, path/<base>-<hash>, instead of <name>")
+	fmt.Println("    --handoff           Keep the lock for another process and print its lock_id (see adopt)")
+	fmt.Println("    --respect-freeze    Fail (exit 2) if the lock is frozen; with --wait, wait out a freeze placed meanwhile")
+	fmt.Println("  unlock <name>...  Release one or more locks (each reported; exits non-zero if any failed)")
 	fmt.Println("    --force         Remove without ownership check (break-glass)")
 	fmt.Println("    --break-stale   Remove only if stale (expired TTL or dead PID)")
-	fmt.Println("    --owner <name>  Release all locks held by owner")
-	fmt.Println("    --all           Release all locks held by current identity")
-	fmt.Println("    --json          Output in JSON format (with --owner/--all)")
+	fmt.Println("    --owner <name>  Release all locks held by owner (with --force: break-glass)")
+	fmt.Println("    --all-mine      Release all locks held by current identity")
+	fmt.Println("    --json          Output in JSON format (with several names, --prefix, --owner/--all-mine/--batch)")
+	fmt.Println("    --batch file|-  Release all listed names that you own")
+	fmt.Println("    --strict        With --batch, fail if any name is not found or not owned")
+	fmt.Println("    --for-path path Release the lock lock --for-path took for path")
+	fmt.Println("    --prefix prefix Release every lock whose name starts with prefix")
+	fmt.Println("    --fail-if-none  With --prefix, exit 3 if no lock matches")
+	fmt.Println("  renew <name>      Restart a held lock's TTL")
+	fmt.Println("    --ttl duration  Set a new TTL instead of keeping the current one")
+	fmt.Println("    --force         Renew (and sign) your lock even if unsigned or badly signed while signing is on")
+	fmt.Println("  adopt <name> --token lock_id  Hold a handed-off lock from another process, e.g. a daemon")
+	fmt.Println("    --pid N         Process to hold it (default: the one running lokt adopt)")
 	fmt.Println("  status [name]     Show lock status")
 	fmt.Println("    --json          Output in JSON format")
+	fmt.Println("    --schema 2      With --json: {\"schema\":2,\"generated_at\":...,\"locks\":[...]} (default 1: bare array, deprecated)")
 	fmt.Println("    --prune-expired Remove expired locks while listing")
+	fmt.Println("    --output path   Write output to file atomically (- for stdout)")
+	fmt.Println("    --group name    Show an exclusion group's members and combined state")
+	fmt.Println("    --watch         Re-render in place until interrupted (NDJSON with --json)")
+	fmt.Println("    --interval duration  Refresh interval for --watch (default: 2s or watch_interval)")
+	fmt.Println("    --stale         List only stale locks (expired, dead PID or corrupted) and why")
+	fmt.Println("    --fail-if-stale Like --stale, but exit 6 if there are any (for monitoring)")
+	fmt.Println("    --all-roots     List every root in this git worktree (.lokt dirs, .git/lokt) with a root column")
+	fmt.Println("    --roots a,b     List these roots instead, the same way")
 	fmt.Println("  exists <name>     Check if lock exists (silent, exit code only)")
+	fmt.Println("  check <name>      Exit 0 if the lock could be acquired now, 2 if held or frozen")
+	fmt.Println("    --wait              Wait for the lock to become free")
+	fmt.Println("    --timeout duration  Maximum wait time (requires --wait)")
+	fmt.Println("  watch <name> [--exec <cmd...>]")
+	fmt.Println("                    Wait, without acquiring, until the lock is free (absent, stale or")
+	fmt.Println("                    released), then exit 0 or run cmd without the lock; exit 2 on timeout")
+	fmt.Println("    --timeout duration  Maximum wait time (default: 10m)")
+	fmt.Println("    --and-acquire       Acquire the lock once it frees and hold it while cmd runs (like guard --wait)")
+	fmt.Println("    --ttl duration      Lock TTL with --and-acquire (default: default_ttl in config.json)")
 	fmt.Println("  guard <name> -- <cmd...>")
-	fmt.Println("                    Run command while holding lock")
-	fmt.Println("    --ttl duration      Lock TTL (e.g., 5m, 1h)")
+	fmt.Println("                    Run command while holding lock. Your shell splits")
+	fmt.Println("                    'lokt guard x -- a && b' before lokt runs: only a is guarded;")
+	fmt.Println("                    use --shell -- 'a && b' for pipes, && and redirections")
+	fmt.Println("    --ttl duration      Lock TTL (e.g., 5m, 1h; default: default_ttl in config.json)")
+	fmt.Println("    --wait              Wait for lock to be free (default timeout: 10m)")
+	fmt.Println("    --timeout duration  Maximum wait time (requires --wait, default: 10m)")
+	fmt.Println("    --wait-thaw         Wait for an active freeze to lift instead of failing")
+	fmt.Println("    --no-adaptive       Keep fast polling even when many others are waiting")
+	fmt.Println("    --poll-min duration First poll interval while waiting (default: 50ms)")
+	fmt.Println("    --poll-max duration Longest poll interval while waiting (default: 2s)")
+	fmt.Println("    --total-wait-budget duration")
+	fmt.Println("                        Cap total waiting for this guard and nested lokt calls")
+	fmt.Println("    --wait-report duration")
+	fmt.Println("                        Report the holder while waiting this often (default: 15s on a terminal)")
+	fmt.Println("    --max-renew-gap duration")
+	fmt.Println("                        Re-verify ownership after a longer renewal gap (default: TTL)")
+	fmt.Println("    --on-lost warn|terminate")
+	fmt.Println("                        What to do with the command if the lock was taken over")
+	fmt.Println("    --strict-ttl        Terminate the command (exit 2) if renewals fail or the lock is lost")
+	fmt.Println("    --verify-interval duration")
+	fmt.Println("                        Check the lock file is still ours this often (always before release)")
+	fmt.Println("    --kill-timeout duration")
+	fmt.Println("                        SIGKILL the command and its descendants this long after a signal")
+	fmt.Println("    --no-release        Keep the lock if the command succeeds (for a follow-up step)")
+	fmt.Println("    --shared            Hold a shared (read) lock alongside other shared holders")
+	fmt.Println("    --flock             Also hold a flock on the lock file (for NFS; default: flock in config.json)")
+	fmt.Println("    --on-timeout cmd    Run cmd (via sh) if the wait times out; LOKT_HOLDER_* name the holder")
+	fmt.Println("    --if-free           Skip the command (exit 0) if the lock is held, instead of failing")
+	fmt.Println("    --skip-exit-code n  Exit code for a --if-free skip (default: 0)")
+	fmt.Println("    --locks a,b,...     Hold all listed locks (all or none) instead of <name>")
+	fmt.Println("    --slots n           Hold one of n slots of <name> (<name>.slots/<k>), so up to n run at once")
+	fmt.Println("    --shell             Run <cmd>, one quoted string, via $SHELL -c (also -c); a signal stops the whole pipeline")
+	fmt.Println("    --message text      Say what the lock is for (also -m); shown in status and to those it blocks")
+	fmt.Println("    --label key=value   Attach a label (repeatable; in status --json and audit)")
+	fmt.Println("    --session id        Register the lock in a session; released on exit (default: $LOKT_SESSION)")
+	fmt.Println("    --cwd path          Run <cmd> in this directory (checked before acquiring)")
+	fmt.Println("    --env KEY=VALUE     Set a variable for <cmd> (repeatable; a later --env or --env-file wins)")
+	fmt.Println("    --env-file path     Set the KEY=VALUE lines of a file for <cmd> (# comments, blank lines skipped)")
+	fmt.Println("    --tag-output        Prefix each line <cmd> writes with [<name>], stdout and stderr kept apart")
+	fmt.Println("    --log-file path     Also write <cmd>'s raw output to path (truncated first)")
+	fmt.Println("    --retry n           Re-run <cmd> up to n times if it exits non-zero, holding the lock throughout")
+	fmt.Println("    --retry-delay duration")
+	fmt.Println("                        Wait this long before each re-run (default: 0)")
+	fmt.Println("    --no-retry-on codes Exit codes not to retry (comma-separated); a signal-killed <cmd> never is")
+	fmt.Println("  run <name> -- <cmd...>")
+	fmt.Println("                    Acquire the lock, then become the command (exec, Unix only).")
+	fmt.Println("                    guard stays in between: it renews the TTL, forwards signals and")
+	fmt.Println("                    releases on exit, but if guard is killed the command runs on")
+	fmt.Println("                    under a lock naming a dead PID. run leaves nothing in between:")
+	fmt.Println("                    the lock names the command's own PID, so it is freed exactly when")
+	fmt.Println("                    the command dies (dead-PID pruning, same host), with no renewal")
+	fmt.Println("    --ttl duration      Lock TTL, never renewed: it must cover the whole command (default: none)")
 	fmt.Println("    --wait              Wait for lock to be free (default timeout: 10m)")
 	fmt.Println("    --timeout duration  Maximum wait time (requires --wait, default: 10m)")
+	fmt.Println("    --wait-thaw         Wait for an active freeze to lift instead of failing")
+	fmt.Println("    --no-adaptive       Keep fast polling even when many others are waiting")
+	fmt.Println("    --poll-min duration First poll interval while waiting (default: 50ms)")
+	fmt.Println("    --poll-max duration Longest poll interval while waiting (default: 2s)")
+	fmt.Println("    --post-release      Start a small detached watcher that releases the lock when the command exits")
+	fmt.Println("    --shell             Run <cmd>, one quoted string, via $SHELL -c (also -c)")
+	fmt.Println("    --message text      Say what the lock is for (also -m); shown in status and to those it blocks")
+	fmt.Println("    --label key=value   Attach a label (repeatable; in status --json and audit)")
+	fmt.Println("  plan run <plan.json|->")
+	fmt.Println("                    Run a plan: a JSON array of {name, ttl, cmd, args, allow_skip_if_held},")
+	fmt.Println("                    each cmd guarded by its own lock (waiting for it, or skipped if held")
+	fmt.Println("                    with allow_skip_if_held), output tagged [<name>]; exit 1 if any failed")
+	fmt.Println("    --parallel n        Run up to n entries at once (default: 1)")
+	fmt.Println("    --timeout duration  Maximum time each entry waits for its lock (default: no limit)")
+	fmt.Println("    --results path|-    Write per-entry results as JSON (-: stdout, output then on stderr)")
 	fmt.Println("  freeze <name>     Temporarily block guard commands")
-	fmt.Println("    --ttl duration      Freeze duration (required, e.g., 15m, 1h)")
+	fmt.Println("    --ttl duration      Freeze duration (this or --until required, e.g., 15m, 1h)")
+	fmt.Println("    --until time        End of the freeze (RFC 3339, e.g., 2026-02-01T06:00:00Z)")
+	fmt.Println("    --reason text       Why; shown to the commands it blocks")
+	fmt.Println("    --all               Freeze every name instead of one (global freeze)")
+	fmt.Println("    --match pattern     Freeze every name matching a glob (e.g., 'deploy-*'), including later ones")
+	fmt.Println("    --wait-idle         Then wait until no one holds the lock (any lock with --all, any match with --match)")
+	fmt.Println("    --timeout duration  Maximum wait with --wait-idle (default: 10m; exit 2 if still held)")
 	fmt.Println("  unfreeze <name>   Remove a freeze early")
 	fmt.Println("    --force         Remove without ownership check (break-glass)")
+	fmt.Println("    --all           Remove the global freeze")
+	fmt.Println("    --match pattern Remove the freeze placed with freeze --match pattern")
+	fmt.Println("  freezes           List active freezes: global, by name and by pattern")
+	fmt.Println("    --json          Output in JSON format")
+	fmt.Println("  reserve <name>    Reserve a lock for one owner in a time window; others' holds")
+	fmt.Println("                    that would overlap it are refused (exit 2); a freeze still wins")
+	fmt.Println("    --until time        End of the window (RFC 3339, e.g., 2026-02-01T15:00:00Z; required)")
+	fmt.Println("    --from time         Start of the window (RFC 3339; default: now)")
+	fmt.Println("    --owner name        Reserve for this owner (default: you)")
+	fmt.Println("    --reason text       What the window is for; shown to those it refuses")
+	fmt.Println("    --json              Output the reservation as JSON")
+	fmt.Println("  unreserve <name>  Cancel your reservations of a lock")
+	fmt.Println("    --id id         Cancel only this one")
+	fmt.Println("    --force         Cancel others' too (break-glass)")
+	fmt.Println("  reservations [name]  List reservations that haven't ended")
+	fmt.Println("    --json          Output in JSON format")
 	fmt.Println("  audit             Query audit log")
 	fmt.Println("    --since duration|ts Show events since (e.g., 1h, 2026-01-27T10:00:00Z)")
-	fmt.Println("    --name lock         Filter by lock name")
+	fmt.Println("    --tail              Follow the log for new events (Ctrl+C to stop), after those --since shows")
+	fmt.Println("    --name lock,...     Filter by lock name")
+	fmt.Println("    --event type,...    Filter by event type (e.g., force-break,deny)")
+	fmt.Println("    --owner owner,...   Filter by owner")
+	fmt.Println("    --format fmt        Output jsonl (default), table, or json (one array)")
+	fmt.Println("    --json              Same as --format json")
+	fmt.Println("    --output path       Write events to file atomically (not with --tail)")
+	fmt.Println("    --prune --keep age  Delete rotated audit files older than age (e.g., 30d)")
 	fmt.Println("  why <name>        Explain why a lock cannot be acquired")
 	fmt.Println("    --json          Output in JSON format")
+	fmt.Println("  inspect <name>    Print the lock file as on disk, then check its fields and holder")
+	fmt.Println("                    (exit 0 valid, 6 stale, 1 corrupted, 3 not found)")
+	fmt.Println("    --freeze        Inspect the freeze on <name> (also at the legacy location)")
+	fmt.Println("    --json          Output in JSON format")
+	fmt.Println("  whoami            Show the owner, host, pid and agent ID locks are taken as, and where the owner came from")
+	fmt.Println("    --json          Output in JSON format")
 	fmt.Println("  doctor            Validate lokt setup")
 	fmt.Println("    --json          Output in JSON format")
+	fmt.Println("    --output path   Write report to file atomically (- for stdout)")
+	fmt.Println("    --probe-webhooks  HEAD every webhook URL in config.json")
+	fmt.Println("    --fix           Remove damaged and dead-holder files; move legacy freezes, misplaced locks")
+	fmt.Println("    --torture       Check that the lock excludes processes on this filesystem: workers")
+	fmt.Println("                    contend for a scratch lock and must never overlap")
+	fmt.Println("    --duration d    How long --torture runs (default 30s)")
+	fmt.Println("    --procs n       How many --torture worker processes (default 8)")
 	fmt.Println("  prime             Output agent context for AI tool integration")
 	fmt.Println("    --format name   Output format: claude-md, cursorrules, windsurfrules,")
 	fmt.Println("                    copilot, clinerules, aider")
+	fmt.Println("    --no-history-discovery  Only list locks found in wrapper scripts")
+	fmt.Println("    --json          Output guarded operations and current status as JSON")
+	fmt.Println("    --write         Install the --format snippet in its file (e.g. .cursorrules), inside")
+	fmt.Println("                    a lokt block; without --format, update every file that has one")
+	fmt.Println("    --check         Exit 1 if a lokt block is out of date; change nothing (for CI)")
+	fmt.Println("  history show      Reconstruct lock state at a past instant")
+	fmt.Println("    --at duration|ts    Point in time (e.g., 30m, 2026-01-27T14:32:00Z)")
+	fmt.Println("    --json              Output in JSON format")
+	fmt.Println("    --output path       Write output to file atomically")
+	fmt.Println("  history <name>    List a lock's recent acquisitions and how each ended")
+	fmt.Println("    --limit n           Show the last n acquisitions (default 20, 0 for all)")
+	fmt.Println("    --json              Output in JSON format")
+	fmt.Println("  stats             Summarize contention per lock from the audit log")
+	fmt.Println("    --since duration|ts Only count events since (e.g., 7d)")
+	fmt.Println("    --json              Output in JSON format")
+	fmt.Println("  serve             Serve a status page and JSON API over HTTP")
+	fmt.Println("    --http addr         Address to listen on (e.g., :8080)")
+	fmt.Println("    --allow-force       Enable bearer-token force release (serve.force_token)")
+	fmt.Println("  relocate --to dir Move the lock root without stopping holders")
+	fmt.Println("    --redirect mode     Old path afterwards: follow (default) or fail")
+	fmt.Println("  export            Archive locks and freezes (tar.gz) for lokt import")
+	fmt.Println("    --output path       Write the archive to file atomically (- for stdout)")
+	fmt.Println("    --audit             Include the audit log")
+	fmt.Println("  import <archive>  Restore an export into a root, keeping ownership")
+	fmt.Println("    --root path         Root to import into (default: the discovered root)")
+	fmt.Println("    --force             Replace existing locks and freezes even if newer")
+	fmt.Println("    --dry-run           Report what would be imported")
+	fmt.Println("    --no-audit          Leave an archived audit log out")
+	fmt.Println("    --json              Output in JSON format")
+	fmt.Println("  sweep             Remove stale locks and leftover per-name state (waiters/)")
+	fmt.Println("    --dry-run           Report what would be removed")
+	fmt.Println("    --json              Output in JSON format")
+	fmt.Println("    --retention duration  Keep state of names used within this period (default: 168h)")
+	fmt.Println("  prune             Remove stale locks and freezes (expired, dead holder, corrupted)")
+	fmt.Println("    --dry-run           Report what would be removed (exit 6 if anything)")
+	fmt.Println("    --json              Output in JSON format")
+	fmt.Println("    --older-than duration  Only locks and freezes acquired at least this long ago")
+	fmt.Println("  session list      List sessions (LOKT_SESSION), their locks and whether a holder lives")
+	fmt.Println("    --json              Output in JSON format")
+	fmt.Println("  session end <id>  Release every lock a session holds, e.g. after killing its agent")
+	fmt.Println("    --json              Output in JSON format")
+	fmt.Println("  session gc        End every session whose holders are all gone")
+	fmt.Println("    --json              Output in JSON format")
+	fmt.Println("  hook install <pre-push|pre-commit> --check name")
+	fmt.Println("                    Block a git hook while a lock is held or frozen")
+	fmt.Println("    --wait              Wait for the lock (default 30s, see --timeout)")
+	fmt.Println("    --strict            Also block when lokt is missing or the check errors")
+	fmt.Println("  hook uninstall [hook]  Remove the lokt block from git hooks")
 	fmt.Println("  demo [name]       Generate a demo script (hexwall, trunk)")
+	fmt.Println("  completion <shell>  Print a completion script (bash, zsh, fish)")
 	fmt.Println("  version           Show version info")
 	fmt.Println()
 	fmt.Println("Exit codes:")
 	fmt.Println("  0  Success")
 	fmt.Println("  1  General error")
-	fmt.Println("  2  Lock held by another owner")
+	fmt.Println("  2  Lock held by another owner (v1: also frozen, wait timed out)")
 	fmt.Println("  3  Lock not found")
 	fmt.Println("  4  Not lock owner")
+	fmt.Println("  5  Deadlock: the holder waits for a lock you hold (--wait)")
+	fmt.Println("  6  Stale locks found (status --fail-if-stale, prune --dry-run)")
+	fmt.Println("  7  Lock root is read-only (or --read-only) and the command would change it")
+	fmt.Println("  8  guard's lock vanished or was replaced while the command ran (e.g. git clean)")
+	fmt.Println("  9  Frozen (lock, guard, run, freeze; --exit-codes v2 only)")
+	fmt.Println("  10 Wait timed out (lock, guard, run --wait; --exit-codes v2 only)")
 }
 
 // sweepEnabled returns true if the command should trigger an opportunistic sweep.
@@ -154,8 +498,14 @@ func sweepEnabled(cmd string) bool {
 	if os.Getenv(lock.EnvLoktNoSweep) != "" {
 		return false
 	}
+	return touchesLocks(cmd)
+}
+
+// touchesLocks returns true if the command acquires, releases or reports
+// on locks in the root.
+func touchesLocks(cmd string) bool {
 	switch cmd {
-	case "lock", "unlock", "status", "guard", "freeze", "unfreeze", "why", "exists":
+	case "lock", "unlock", "renew", "status", "guard", "run", "plan", "freeze", "unfreeze", "why", "exists":
 		return true
 	}
 	return false
@@ -165,56 +515,130 @@ func sweepEnabled(cmd string) bool {
 // Errors are silently ignored — sweep must never block the actual command.
 func runSweep() {
 	rootDir, err := root.Find()
-	if err != nil {
+	if err != nil || root.CheckWritable(rootDir) != nil {
 		return
 	}
-	auditor := audit.NewWriter(rootDir)
-	lock.PruneAllExpired(rootDir, auditor)
+	auditor := newAuditor(rootDir)
+	lock.PruneAllExpired(rootDir, auditor, skewGrace(rootDir))
+	lock.PruneReservations(rootDir, skewGrace(rootDir))
 }
 
-func cmdLock(args []string) int {
-	// Reorder args: flags before positional args.
-	// Go's flag package stops at the first non-flag argument,
-	// so "lokt lock mylock --ttl 5m" would not parse --ttl.
-	var flags, pos []string
-	for i := 0; i < len(args); i++ {
-		if len(args[i]) > 0 && args[i][0] == '-' {
-			flags = append(flags, args[i])
-			// Check if this flag takes a value (--ttl, --timeout)
-			// and consume the next argument as the value
-			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
-				// Special case: flags like --json don't take values
-				flagName := strings.TrimLeft(args[i], "-")
-				if flagName == "ttl" || flagName == "timeout" {
-					i++
-					flags = append(flags, args[i])
-				}
-			}
-		} else {
-			pos = append(pos, args[i])
-		}
+// snapshotEnabled returns true if the command mutates lock state and should
+// give the snapshot recorder a chance to run.
+func snapshotEnabled(cmd string) bool {
+	switch cmd {
+	case "lock", "unlock", "renew", "adopt", "guard", "plan", "freeze", "unfreeze":
+		return true
+	}
+	return false
+}
+
+// runSnapshot records a state snapshot if enabled in config and the
+// configured interval has elapsed. Best-effort: errors are silently ignored.
+func runSnapshot() {
+	rootDir, err := root.Find()
+	if err != nil || root.CheckWritable(rootDir) != nil {
+		return
 	}
+	cfg, err := config.Load(rootDir)
+	if err != nil || !cfg.Snapshot.Enabled {
+		return
+	}
+	_, _ = snapshot.Record(rootDir, cfg.Snapshot.EffectiveInterval(), cfg.Snapshot.EffectiveRetentionDays(), time.Now())
+}
 
+func cmdLock(args []string) int {
 	fs := flag.NewFlagSet("lock", flag.ExitOnError)
 	ttl := fs.Duration("ttl", 0, "Lock TTL (e.g., 5m, 1h)")
 	wait := fs.Bool("wait", false, "Wait for lock to be free")
 	timeout := fs.Duration("timeout", 0, "Maximum time to wait (requires --wait)")
+	waitThaw := fs.Bool("wait-thaw", false, "Wait for an active freeze to lift before acquiring")
+	noAdaptive := fs.Bool("no-adaptive", false, "Don't slow polling when many others wait for the same lock")
 	jsonOutput := fs.Bool("json", false, "Output JSON on acquire or deny")
-	_ = fs.Parse(append(flags, pos...))
+	batch := fs.String("batch", "", "Acquire all names listed in a file, one per line (- for stdin)")
+	shared := fs.Bool("shared", false, "Acquire a shared (read) lock; coexists with other shared holders")
+	pollMin := fs.Duration("poll-min", 0, "First --wait poll interval (default 50ms)")
+	pollMax := fs.Duration("poll-max", 0, "Longest --wait poll interval (default 2s or wait_poll_interval)")
+	message := fs.String("message", "", "What the lock is held for, shown to those it blocks")
+	fs.StringVar(message, "m", "", "Short for --message")
+	labels := labelFlag{}
+	fs.Var(labels, "label", "Attach a key=value label (repeatable)")
+	session := fs.String("session", os.Getenv(lock.EnvLoktSession), "Register the lock in this session, for lokt session end (default: $LOKT_SESSION)")
+	takeOverFrom := fs.String("take-over-from", "", "Take the lock over from this owner, only if it still holds it and the hold is stale")
+	forceTakeover := fs.Bool("force-takeover", false, "With --take-over-from, take the lock over even if the hold isn't stale")
+	forPath := fs.String("for-path", "", "Lock the file at this path under its canonical name instead of <name>")
+	handoff := fs.Bool("handoff", false, "Keep the lock after lokt exits and print its lock_id for lokt adopt")
+	respectFreeze := fs.Bool("respect-freeze", false, "Fail if the lock is frozen, and with --wait keep waiting while it is")
+	_ = fs.Parse(interspersed(fs, args))
+
+	if *forPath != "" && (fs.NArg() > 0 || *batch != "") {
+		fmt.Fprintln(os.Stderr, "error: --for-path cannot be combined with a lock name or --batch")
+		return ExitUsage
+	}
 
-	if fs.NArg() < 1 {
-		fmt.Fprintln(os.Stderr, "usage: lokt lock [--ttl duration] [--wait] [--timeout duration] [--json] <name>")
+	if *forceTakeover && *takeOverFrom == "" {
+		fmt.Fprintln(os.Stderr, "error: --force-takeover requires --take-over-from")
 		return ExitUsage
 	}
-	name := fs.Arg(0)
+	if *takeOverFrom != "" && (*batch != "" || fs.NArg() > 1 || *shared || *wait || *waitThaw) {
+		fmt.Fprintln(os.Stderr, "error: --take-over-from takes one lock name and cannot be combined with --batch, --shared, --wait or --wait-thaw")
+		return ExitUsage
+	}
+	if *handoff && (*batch != "" || fs.NArg() > 1 || *shared || *takeOverFrom != "") {
+		fmt.Fprintln(os.Stderr, "error: --handoff takes one lock name and cannot be combined with --batch, --shared or --take-over-from")
+		return ExitUsage
+	}
+
+	var batchNames []string
+	if *batch != "" {
+		if fs.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, "error: --batch cannot be combined with a lock name")
+			return ExitUsage
+		}
+		if *waitThaw {
+			fmt.Fprintln(os.Stderr, "error: --wait-thaw cannot be combined with --batch")
+			return ExitUsage
+		}
+		names, err := readBatchNames(*batch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --batch: %v\n", err)
+			return ExitUsage
+		}
+		batchNames = names
+	} else if fs.NArg() < 1 && *forPath == "" {
+		fmt.Fprintln(os.Stderr, "usage: lokt lock [--ttl duration] [--wait] [--wait-thaw] [--timeout duration] [--poll-min duration] [--poll-max duration] [--shared] [--json] <name>...")
+		fmt.Fprintln(os.Stderr, "       lokt lock [flags] --for-path <path>")
+		fmt.Fprintln(os.Stderr, "       lokt lock [--ttl duration] [--wait] [--timeout duration] [--shared] [--json] --batch <file|->")
+		return ExitUsage
+	} else if fs.NArg() > 1 {
+		// Several names are a batch given on the command line
+		if *waitThaw {
+			fmt.Fprintln(os.Stderr, "error: --wait-thaw cannot be combined with several lock names")
+			return ExitUsage
+		}
+		for _, n := range fs.Args() {
+			if err := lockfile.ValidateName(n); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return ExitUsage
+			}
+		}
+		batchNames = fs.Args()
+	}
+	name, path := fs.Arg(0), ""
+	if *forPath != "" {
+		var code int
+		if name, path, code = nameForPathFlag(*forPath); code != ExitOK {
+			return code
+		}
+	}
 
 	if *ttl < 0 {
 		fmt.Fprintln(os.Stderr, "error: TTL must be positive (e.g., 5m, 1h)")
 		return ExitUsage
 	}
 
-	if *timeout > 0 && !*wait {
-		fmt.Fprintln(os.Stderr, "error: --timeout requires --wait")
+	if *timeout > 0 && !*wait && !*waitThaw {
+		fmt.Fprintln(os.Stderr, "error: --timeout requires --wait or --wait-thaw")
 		return ExitUsage
 	}
 
@@ -223,89 +647,158 @@ func cmdLock(args []string) int {
 		return ExitUsage
 	}
 
+	if err := checkPollFlags(*pollMin, *pollMax, *wait); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+	if *session != "" {
+		if err := lock.ValidateSessionID(*session); err != nil {
+			fmt.Fprintf(os.Stderr, "error: --session: %v\n", err)
+			return ExitUsage
+		}
+	}
+
 	rootDir, err := root.Find()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		reportError(name, err, "")
 		return ExitError
 	}
+	if code := checkWritable(rootDir, name); code != ExitOK {
+		return code
+	}
 
-	auditor := audit.NewWriter(rootDir)
-	opts := lock.AcquireOptions{TTL: *ttl, Auditor: auditor}
+	if !flagGiven(fs, "ttl") {
+		*ttl = defaultTTL(rootDir, name)
+	}
 
-	if *wait {
-		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	// One deadline covers both the thaw wait and the lock wait.
+	ctx := context.Background()
+	if *wait || *waitThaw {
+		var cancel context.CancelFunc
+		ctx, cancel = waitContext(*timeout, inheritedWaitBudget())
 		defer cancel()
+	}
 
-		waitTimeout := *timeout
-		if waitTimeout == 0 {
-			waitTimeout = DefaultWaitTimeout
+	// Batches and takeovers need more than the library client offers
+	if batchNames != nil || *takeOverFrom != "" {
+		opts := lock.AcquireOptions{
+			TTL:               *ttl,
+			Auditor:           newAuditor(rootDir),
+			RetryAfterDefault: retryAfterDefault(rootDir),
+			NoAdaptive:        *noAdaptive || !adaptiveBackoff(rootDir),
+			ExclusionGroups:   exclusionGroups(rootDir),
+			Shared:            *shared,
+			Retry:             withPollFlags(waitRetryPolicy(rootDir), *pollMin, *pollMax),
+			Message:           *message,
+			Labels:            labels,
+			SkewGrace:         skewGrace(rootDir),
+			Session:           *session,
+			Path:              path,
+			RespectFreeze:     *respectFreeze,
 		}
-		ctx, cancel = context.WithTimeout(ctx, waitTimeout)
-		defer cancel()
-
-		err = lock.AcquireWithWait(ctx, rootDir, name, opts)
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				fmt.Fprintln(os.Stderr, "interrupted")
-				return ExitError
-			}
-			if errors.Is(err, context.DeadlineExceeded) {
-				// Timeout - try to get current holder info
-				path := root.LockFilePath(rootDir, name)
-				if lf, readErr := readLockFile(path); readErr == nil {
-					if *jsonOutput {
-						printLockDenyJSON(name, lf)
-					} else {
-						age := time.Since(lf.AcquiredAt).Truncate(time.Second)
-						fmt.Fprintf(os.Stderr, "error: timeout waiting for lock %q held by %s@%s (pid %d) for %s\n",
-							name, lf.Owner, lf.Host, lf.PID, age)
-					}
-				} else {
-					if *jsonOutput {
-						printLockDenyJSON(name, nil)
-					} else {
-						fmt.Fprintf(os.Stderr, "error: timeout waiting for lock %q\n", name)
-					}
-				}
-				return ExitLockHeld
-			}
-			var held *lock.HeldError
-			if errors.As(err, &held) {
-				if *jsonOutput {
-					printLockDenyJSONFromLock(held.Lock)
-				} else {
-					fmt.Fprintf(os.Stderr, "error: %v\n", held)
-				}
-				return ExitLockHeld
+		if batchNames != nil {
+			return lockBatch(ctx, rootDir, batchNames, opts, *wait, *jsonOutput)
+		}
+		return lockTakeover(rootDir, name, *takeOverFrom, *forceTakeover, opts, *jsonOutput)
+	}
+
+	client := newClient(rootDir)
+	if err := client.ConfigError(); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring config: %v\n", err)
+	}
+	opts := lokt.AcquireOptions{
+		TTL:           *ttl,
+		Wait:          *wait,
+		NoAdaptive:    *noAdaptive,
+		Shared:        *shared,
+		PollMin:       *pollMin,
+		PollMax:       *pollMax,
+		Message:       *message,
+		Labels:        labels,
+		Path:          path,
+		Session:       *session,
+		Handoff:       *handoff,
+		RespectFreeze: *respectFreeze,
+	}
+	retryDefault := client.RetryAfterDefault()
+
+	if *waitThaw {
+		thawWait, code := awaitThaw(ctx, rootDir, name, newAuditor(rootDir))
+		if code != ExitOK {
+			if *jsonOutput {
+				printLockDenyJSON(name, nil, freezeRetryAfter(rootDir, name))
 			}
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return code
+		}
+		opts.ThawWait = thawWait
+	}
+
+	if err = client.Acquire(ctx, name, opts); err != nil {
+		if errors.Is(err, context.Canceled) {
+			reportError(name, err, "interrupted")
 			return ExitError
 		}
-	} else {
-		err = lock.Acquire(rootDir, name, opts)
-		if err != nil {
-			var held *lock.HeldError
-			if errors.As(err, &held) {
-				if *jsonOutput {
-					printLockDenyJSONFromLock(held.Lock)
-				} else {
-					fmt.Fprintf(os.Stderr, "error: %v\n", held)
-				}
-				return ExitLockHeld
+		if errors.Is(err, context.DeadlineExceeded) {
+			// Timeout - try to get current holder info
+			lf, _ := lockfile.Read(root.LockFilePath(rootDir, name)) // nil if unreadable
+			if *jsonOutput {
+				printLockDenyJSON(name, lf, lock.RetryAfter(lf, retryDefault))
+			} else {
+				reportError(name, &timeoutError{lf, lock.RetryAfter(lf, retryDefault)},
+					lockTimeoutMessage(name, lf, retryDefault, budgetNote(ctx), err))
 			}
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			return ExitError
+			return exitTimeout()
+		}
+		if errors.Is(err, lokt.ErrDeadlock) {
+			reportError(name, err, "")
+			return ExitDeadlock
+		}
+		var held *lokt.HeldError
+		if errors.As(err, &held) {
+			if *jsonOutput {
+				printLockDenyJSON(name, held.Lock, held.RetryAfter)
+			} else {
+				reportError(name, err, "")
+			}
+			return ExitLockHeld
+		}
+		if code := lockFrozen(name, err, *jsonOutput); code != ExitOK {
+			return code
 		}
+		reportError(name, err, "")
+		return ExitError
 	}
 
-	if *jsonOutput {
+	switch {
+	case *handoff:
+		return printHandoff(rootDir, name, *jsonOutput)
+	case *jsonOutput:
 		printLockAcquireJSON(name)
-	} else {
+	case *shared:
+		fmt.Printf("acquired shared lock %q\n", name)
+	case path != "":
+		fmt.Printf("acquired lock %q for %s\n", name, path)
+	default:
 		fmt.Printf("acquired lock %q\n", name)
 	}
 	return ExitOK
 }
 
+// lockFrozen reports err if it is the *lock.FrozenError of lock
+// --respect-freeze and returns exitFrozen(), or ExitOK if it isn't one.
+func lockFrozen(name string, err error, jsonOutput bool) int {
+	var frozen *lock.FrozenError
+	if !errors.As(err, &frozen) {
+		return ExitOK
+	}
+	if jsonOutput {
+		printLockDenyJSON(name, nil, frozen.RetryAfter)
+	} else {
+		reportError(name, err, "")
+	}
+	return exitFrozen()
+}
+
 // lockDenyOutput is the JSON structure for lock --json deny output.
 type lockDenyOutput struct {
 	Status           string `json:"status"`
@@ -321,27 +814,44 @@ type lockDenyOutput struct {
 	HolderPIDStatus  string `json:"holder_pid_status,omitempty"`
 	HolderAcquiredTS string `json:"holder_acquired_ts,omitempty"`
 	HolderExpiresAt  string `json:"holder_expires_at,omitempty"`
+	HolderMode       string `json:"holder_mode,omitempty"`
+	HolderMessage    string `json:"holder_message,omitempty"`
+	RetryAfterSec    int    `json:"retry_after_sec,omitempty"`
 }
 
 // lockAcquireOutput is the JSON structure for lock --json success output.
 type lockAcquireOutput struct {
 	Status string `json:"status"`
 	Name   string `json:"name"`
+	LockID string `json:"lock_id,omitempty"` // with --handoff
+}
+
+// printLockDenyJSON prints deny JSON for lock --json. lk may be nil when the
+// holder could not be read (e.g. the lock vanished right after a timeout).
+// retryAfter is the hint from lock.RetryAfter for the blocking lock or freeze.
+func printLockDenyJSON(name string, lk *lockfile.Lock, retryAfter time.Duration) {
+	out := denyOutputFromLock("blocked", name, lk)
+	out.RetryAfterSec = int(retryAfter.Seconds())
+	data, _ := json.MarshalIndent(out, "", "  ")
+	fmt.Println(string(data))
 }
 
-// printLockDenyJSONFromLock prints deny JSON from a lockfile.Lock (from HeldError).
-func printLockDenyJSONFromLock(lk *lockfile.Lock) {
+// denyOutputFromLock fills a lockDenyOutput with the holder details of lk.
+// A nil or anonymous lk yields only status and name.
+func denyOutputFromLock(status, name string, lk *lockfile.Lock) lockDenyOutput {
 	out := lockDenyOutput{
-		Status: "blocked",
-		Name:   lk.Name,
+		Status: status,
+		Name:   name,
 	}
-	if lk.Owner != "" {
+	if lk != nil && lk.Owner != "" {
 		out.HolderOwner = lk.Owner
 		out.HolderHost = lk.Host
 		out.HolderPID = lk.PID
 		out.HolderAgentID = lk.AgentID
 		out.HolderAcquiredTS = lk.AcquiredAt.Format(time.RFC3339)
-		out.HolderAgeSec = int(time.Since(lk.AcquiredAt).Seconds())
+		out.HolderAgeSec = int(lk.Age().Seconds())
+		out.HolderMode = lk.Mode
+		out.HolderMessage = lk.Message
 		out.HolderExpired = lk.IsExpired()
 		if lk.ExpiresAt != nil {
 			out.HolderExpiresAt = lk.ExpiresAt.Format(time.RFC3339)
@@ -352,43 +862,11 @@ func printLockDenyJSONFromLock(lk *lockfile.Lock) {
 				out.HolderRemainSec = int(rem.Seconds())
 			}
 		}
-		out.HolderPIDStatus = pidLivenessFromLock(lk)
-	}
-	data, _ := json.MarshalIndent(out, "", "  ")
-	fmt.Println(string(data))
-}
-
-// printLockDenyJSON prints deny JSON from a local lockFile (used in timeout path).
-func printLockDenyJSON(name string, lf *lockFile) {
-	if lf == nil {
-		out := lockDenyOutput{Status: "blocked", Name: name}
-		data, _ := json.MarshalIndent(out, "", "  ")
-		fmt.Println(string(data))
-		return
-	}
-	out := lockDenyOutput{
-		Status:           "blocked",
-		Name:             name,
-		HolderOwner:      lf.Owner,
-		HolderHost:       lf.Host,
-		HolderPID:        lf.PID,
-		HolderAgentID:    lf.AgentID,
-		HolderAcquiredTS: lf.AcquiredAt.Format(time.RFC3339),
-		HolderAgeSec:     int(time.Since(lf.AcquiredAt).Seconds()),
-		HolderExpired:    lf.IsExpired(),
-	}
-	if lf.ExpiresAt != nil {
-		out.HolderExpiresAt = lf.ExpiresAt.Format(time.RFC3339)
-	}
-	if lf.TTLSec > 0 {
-		out.HolderTTLSec = lf.TTLSec
-		if rem := lf.remaining(); rem > 0 {
-			out.HolderRemainSec = int(rem.Seconds())
+		if lk.PID != 0 { // a reservation's holder has no process
+			out.HolderPIDStatus = pidLiveness(lk)
 		}
 	}
-	out.HolderPIDStatus = pidLiveness(lf)
-	data, _ := json.MarshalIndent(out, "", "  ")
-	fmt.Println(string(data))
+	return out
 }
 
 // printLockAcquireJSON prints success JSON for lock --json.
@@ -398,7 +876,7 @@ func printLockAcquireJSON(name string) {
 	fmt.Println(string(data))
 }
 
-// unlockByOwnerOutput is the JSON structure for unlock --owner/--all output.
+// unlockByOwnerOutput is the JSON structure for unlock --owner/--all-mine output.
 type unlockByOwnerOutput struct {
 	Released []string `json:"released"`
 	Count    int      `json:"count"`
@@ -409,58 +887,143 @@ func cmdUnlock(args []string) int {
 	force := fs.Bool("force", false, "Remove lock without ownership check (break-glass)")
 	breakStale := fs.Bool("break-stale", false, "Remove lock only if stale (expired TTL or dead PID)")
 	owner := fs.String("owner", "", "Release all locks held by this owner")
-	all := fs.Bool("all", false, "Release all locks held by current identity")
+	allMine := fs.Bool("all-mine", false, "Release all locks held by current identity")
+	all := fs.Bool("all", false, "Alias for --all-mine")
 	jsonOutput := fs.Bool("json", false, "Output in JSON format")
-	_ = fs.Parse(args)
+	batch := fs.String("batch", "", "Release all names listed in a file, one per line (- for stdin)")
+	strict := fs.Bool("strict", false, "With --batch, fail if any name is not found or not owned")
+	forPath := fs.String("for-path", "", "Release the lock lock --for-path took for this path instead of <name>")
+	prefix := fs.String("prefix", "", "Release every lock whose name starts with this prefix")
+	failIfNone := fs.Bool("fail-if-none", false, "With --prefix, exit 3 if no lock matches")
+	_ = fs.Parse(interspersed(fs, args))
+	*allMine = *allMine || *all
+
+	name := fs.Arg(0)
+	if *failIfNone && *prefix == "" {
+		fmt.Fprintln(os.Stderr, "error: --fail-if-none requires --prefix")
+		return ExitUsage
+	}
+	if *prefix != "" && (fs.NArg() > 0 || *forPath != "" || *batch != "" || *owner != "" || *allMine) {
+		fmt.Fprintln(os.Stderr, "error: --prefix cannot be combined with lock names, --for-path, --batch or --owner/--all-mine")
+		return ExitUsage
+	}
+	if *forPath != "" {
+		if fs.NArg() > 0 || *batch != "" || *owner != "" || *allMine {
+			fmt.Fprintln(os.Stderr, "error: --for-path cannot be combined with a lock name, --batch or --owner/--all-mine")
+			return ExitUsage
+		}
+		var code int
+		if name, _, code = nameForPathFlag(*forPath); code != ExitOK {
+			return code
+		}
+	}
+
+	if *batch != "" {
+		if fs.NArg() > 0 || *owner != "" || *allMine || *force || *breakStale {
+			fmt.Fprintln(os.Stderr, "error: --batch cannot be combined with a lock name, --owner/--all-mine, or --force/--break-stale")
+			return ExitUsage
+		}
+		names, err := readBatchNames(*batch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --batch: %v\n", err)
+			return ExitUsage
+		}
+		rootDir, err := root.Find()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+		if code := checkWritable(rootDir, ""); code != ExitOK {
+			return code
+		}
+		return unlockBatch(rootDir, names, lock.ReleaseOptions{Auditor: newAuditor(rootDir)}, *strict, *jsonOutput)
+	}
+	if *strict {
+		fmt.Fprintln(os.Stderr, "error: --strict requires --batch")
+		return ExitUsage
+	}
 
-	batchMode := *owner != "" || *all
+	batchMode := *owner != "" || *allMine
 
-	// Mutual exclusion: --owner/--all cannot combine with positional name
+	// Mutual exclusion: --owner/--all-mine cannot combine with positional name
 	if batchMode && fs.NArg() > 0 {
-		fmt.Fprintln(os.Stderr, "error: --owner/--all cannot be combined with a lock name")
+		fmt.Fprintln(os.Stderr, "error: --owner/--all-mine cannot be combined with a lock name")
 		return ExitUsage
 	}
 
-	// Mutual exclusion: --force/--break-stale cannot combine with --owner/--all
-	if batchMode && (*force || *breakStale) {
-		fmt.Fprintln(os.Stderr, "error: --force/--break-stale cannot be combined with --owner/--all")
+	// --owner takes --force as its break-glass form; --all-mine releases
+	// only what is already ours, so neither flag applies to it.
+	if (batchMode && *breakStale) || (*allMine && *force) {
+		fmt.Fprintln(os.Stderr, "error: --force/--break-stale cannot be combined with --all-mine, and --break-stale not with --owner")
 		return ExitUsage
 	}
 
-	// Mutual exclusion: --owner and --all
-	if *owner != "" && *all {
-		fmt.Fprintln(os.Stderr, "error: --owner and --all are mutually exclusive")
+	// Mutual exclusion: --owner and --all-mine
+	if *owner != "" && *allMine {
+		fmt.Fprintln(os.Stderr, "error: --owner and --all-mine are mutually exclusive")
 		return ExitUsage
 	}
 
-	// Require either a positional name or --owner/--all
-	if !batchMode && fs.NArg() < 1 {
-		fmt.Fprintln(os.Stderr, "usage: lokt unlock [--force | --break-stale] <name>")
-		fmt.Fprintln(os.Stderr, "       lokt unlock --owner <owner> [--json]")
-		fmt.Fprintln(os.Stderr, "       lokt unlock --all [--json]")
+	// Require either a positional name, --prefix or --owner/--all-mine
+	if !batchMode && name == "" && *prefix == "" {
+		fmt.Fprintln(os.Stderr, "usage: lokt unlock [--force | --break-stale] [--json] <name>...")
+		fmt.Fprintln(os.Stderr, "       lokt unlock [--force | --break-stale] [--json] --prefix <prefix> [--fail-if-none]")
+		fmt.Fprintln(os.Stderr, "       lokt unlock [--force | --break-stale] --for-path <path>")
+		fmt.Fprintln(os.Stderr, "       lokt unlock --owner <owner> [--force] [--json]")
+		fmt.Fprintln(os.Stderr, "       lokt unlock --all-mine [--json]")
+		fmt.Fprintln(os.Stderr, "       lokt unlock --batch <file|-> [--strict] [--json]")
 		return ExitUsage
 	}
 
 	rootDir, err := root.Find()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		reportError(name, err, "")
 		return ExitError
 	}
+	if code := checkWritable(rootDir, name); code != ExitOK {
+		return code
+	}
+
+	// Several names, or every name matching --prefix: each released on its
+	// own, failures reported per name
+	if fs.NArg() > 1 || *prefix != "" {
+		names := fs.Args()
+		if *prefix != "" {
+			if names, err = prefixedLockNames(rootDir, *prefix); err != nil {
+				reportError("", err, "")
+				return ExitError
+			}
+			if len(names) == 0 {
+				if !*jsonOutput {
+					fmt.Fprintf(os.Stderr, "no locks match prefix %q\n", *prefix)
+				}
+				if *failIfNone {
+					return ExitNotFound
+				}
+				return ExitOK
+			}
+		}
+		opts := lock.ReleaseOptions{Force: *force, BreakStale: *breakStale, Auditor: newAuditor(rootDir)}
+		return unlockBatch(rootDir, names, opts, true, *jsonOutput)
+	}
 
-	auditor := audit.NewWriter(rootDir)
+	client := newClient(rootDir)
 
 	// Batch mode: release by owner
 	if batchMode {
 		targetOwner := *owner
-		if *all {
-			targetOwner = identity.Current().Owner
+		if *allMine {
+			targetOwner = client.Identity().Owner
 		}
 
+		// Each release is audited; with --force as a force-break, so an
+		// operator clearing a departed agent's locks is on record.
 		released, err := lock.ReleaseByOwner(rootDir, targetOwner, lock.ReleaseOptions{
-			Auditor: auditor,
+			Force:   *force,
+			Auditor: newAuditor(rootDir),
 		})
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			reportError("", err, "")
 			return ExitError
 		}
 
@@ -476,36 +1039,29 @@ func cmdUnlock(args []string) int {
 			data, _ := json.MarshalIndent(out, "", "  ")
 			fmt.Println(string(data))
 		case len(released) == 0:
-			fmt.Println("no locks matched")
+			fmt.Printf("no locks owned by %s\n", targetOwner)
 		default:
+			for _, name := range released {
+				fmt.Printf("released %s\n", name)
+			}
 			fmt.Printf("released %d lock(s)\n", len(released))
 		}
 		return ExitOK
 	}
 
 	// Single lock mode
-	name := fs.Arg(0)
-	err = lock.Release(rootDir, name, lock.ReleaseOptions{
-		Force:      *force,
-		BreakStale: *breakStale,
-		Auditor:    auditor,
-	})
+	err = client.Release(name, lokt.ReleaseOptions{Force: *force, BreakStale: *breakStale})
 	if err != nil {
-		if errors.Is(err, lock.ErrNotFound) {
-			fmt.Fprintf(os.Stderr, "error: lock %q not found\n", name)
+		if errors.Is(err, lokt.ErrNotFound) {
+			reportError(name, err, fmt.Sprintf("error: lock %q not found", name))
 			return ExitNotFound
 		}
-		var notOwner *lock.NotOwnerError
+		var notOwner *lokt.NotOwnerError
 		if errors.As(err, &notOwner) {
-			fmt.Fprintf(os.Stderr, "error: %v\n", notOwner)
+			reportError(name, err, "")
 			return ExitNotOwner
 		}
-		var notStale *lock.NotStaleError
-		if errors.As(err, &notStale) {
-			fmt.Fprintf(os.Stderr, "error: %v\n", notStale)
-			return ExitError
-		}
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		reportError(name, err, "")
 		return ExitError
 	}
 
@@ -513,133 +1069,465 @@ func cmdUnlock(args []string) int {
 	return ExitOK
 }
 
-func cmdStatus(args []string) int {
-	// Reorder args: flags before positional args.
-	// Go's flag package stops at the first non-flag argument,
-	// so "lokt status zone-api --json" would not parse --json.
+func cmdRenew(args []string) int {
+	// Reorder args so "lokt renew build --ttl 10m" parses --ttl.
 	var flags, pos []string
-	for _, a := range args {
-		if len(a) > 0 && a[0] == '-' {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case (a == "--ttl" || a == "-ttl") && i+1 < len(args):
+			flags = append(flags, a, args[i+1])
+			i++
+		case len(a) > 0 && a[0] == '-':
 			flags = append(flags, a)
-		} else {
+		default:
 			pos = append(pos, a)
 		}
 	}
 
-	fs := flag.NewFlagSet("status", flag.ExitOnError)
-	pruneExpired := fs.Bool("prune-expired", false, "Remove expired locks while listing")
-	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	fs := flag.NewFlagSet("renew", flag.ExitOnError)
+	ttl := fs.Duration("ttl", 0, "New lock TTL (default: keep the current one)")
+	force := fs.Bool("force", false, "Renew and sign the lock even if unsigned or badly signed (signing on)")
 	_ = fs.Parse(append(flags, pos...))
 
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "usage: lokt renew [--ttl duration] [--force] <name>")
+		return ExitUsage
+	}
+	name := fs.Arg(0)
+
+	if *ttl < 0 {
+		fmt.Fprintln(os.Stderr, "error: TTL must be positive (e.g., 5m, 1h)")
+		return ExitUsage
+	}
+
 	rootDir, err := root.Find()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		reportError(name, err, "")
 		return ExitError
 	}
+	if code := checkWritable(rootDir, name); code != ExitOK {
+		return code
+	}
 
-	// If a specific lock name given, show just that one
-	if fs.NArg() > 0 {
-		name := fs.Arg(0)
-		if *pruneExpired {
-			return showLockWithPrune(rootDir, name, *jsonOutput)
+	// The lock was usually taken by an earlier lokt process, so only the
+	// owner has to match.
+	client := newClient(rootDir)
+	err = client.RenewWith(name, lokt.RenewOptions{TTL: *ttl, AnyProcess: true, Force: *force})
+	if err != nil {
+		if errors.Is(err, lokt.ErrNotFound) {
+			reportError(name, err, fmt.Sprintf("error: lock %q not found", name))
+			return ExitNotFound
 		}
-		return showLock(rootDir, name, *jsonOutput)
+		var notOwner *lokt.NotOwnerError
+		if errors.As(err, &notOwner) {
+			reportError(name, err, "")
+			return ExitNotOwner
+		}
+		reportError(name, err, "")
+		return ExitError
 	}
 
-	// Scan locks/ directory
-	locksDir := root.LocksPath(rootDir)
-	lockEntries, _ := os.ReadDir(locksDir)
-
-	// Scan freezes/ directory
-	freezesDir := root.FreezesPath(rootDir)
-	freezeEntries, _ := os.ReadDir(freezesDir)
+	// No exclusive lock means it was a shared hold that got renewed
+	_, statusErr := client.Status(name)
+	lf := renewedLock(rootDir, name, errors.Is(statusErr, lokt.ErrNotFound))
+	switch {
+	case lf == nil:
+		fmt.Printf("renewed lock %q\n", name)
+	case lf.ExpiresAt == nil:
+		fmt.Printf("renewed lock %q (no TTL)\n", name)
+	default:
+		fmt.Printf("renewed lock %q, expires %s (in %s)\n", name, lf.ExpiresAt.Format(time.RFC3339), lf.Remaining().Round(time.Second))
+	}
+	return ExitOK
+}
 
-	if len(lockEntries) == 0 && len(freezeEntries) == 0 {
-		if *jsonOutput {
-			fmt.Println("[]")
-		} else {
-			fmt.Println("no locks")
+// renewedLock rereads the lock (or the current owner's newest shared hold)
+// that cmdRenew just renewed, or returns nil if it can't.
+func renewedLock(rootDir, name string, shared bool) *lockfile.Lock {
+	if !shared {
+		lf, _ := lockfile.Read(root.LockFilePath(rootDir, name))
+		return lf
+	}
+	var own *lockfile.Lock
+	owner := identity.Current().Owner
+	for _, h := range lock.SharedHolders(rootDir, name) {
+		if h.Owner == owner {
+			own = h // oldest first, so the last match is the newest
 		}
-		return ExitOK
 	}
+	return own
+}
 
-	var outputs []statusOutput
-	pruned := 0
-
-	// List regular locks from locks/
-	for _, entry := range lockEntries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		if len(name) > 5 && name[len(name)-5:] == ".json" {
-			lockName := name[:len(name)-5]
-			if *pruneExpired {
-				if pruneLockIfExpired(rootDir, lockName) {
-					pruned++
-					continue
-				}
-			}
-			if *jsonOutput {
-				path := root.LockFilePath(rootDir, lockName)
-				lf, err := readLockFile(path)
-				if err == nil {
-					outputs = append(outputs, lockToStatusOutput(lf, false))
-				}
-			} else {
-				showLockBrief(rootDir, lockName, false)
-			}
+func cmdStatus(args []string) int {
+	// Reorder args: flags before positional args.
+	// Go's flag package stops at the first non-flag argument,
+	// so "lokt status zone-api --json" would not parse --json.
+	// Flags taking a value keep it with them.
+	var flags, pos []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case (a == "--output" || a == "-output" || a == "--group" || a == "-group" || a == "--interval" || a == "-interval" || a == "--schema" || a == "-schema" || a == "--roots" || a == "-roots") && i+1 < len(args):
+			flags = append(flags, a, args[i+1])
+			i++
+		case len(a) > 0 && a[0] == '-':
+			flags = append(flags, a)
+		default:
+			pos = append(pos, a)
 		}
 	}
 
-	// List freeze locks from freezes/
-	for _, entry := range freezeEntries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		if len(name) > 5 && name[len(name)-5:] == ".json" {
-			freezeName := name[:len(name)-5]
-			if *pruneExpired {
-				path := root.FreezeFilePath(rootDir, freezeName)
-				lf, err := readLockFile(path)
-				if err == nil && lf.IsExpired() {
-					if rmErr := os.Remove(path); rmErr == nil || os.IsNotExist(rmErr) {
-						_ = lockfile.SyncDir(path)
-						if !*jsonOutput {
-							fmt.Printf("pruned: %s (expired freeze)\n", freezeName)
-						}
-						pruned++
-						continue
-					}
-				}
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	pruneExpired := fs.Bool("prune-expired", false, "Remove expired locks while listing")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	outputPath := fs.String("output", "", "Write output to file atomically (- for stdout)")
+	group := fs.String("group", "", "Show the members and combined state of an exclusion group")
+	watch := fs.Bool("watch", false, "Re-render every --interval until interrupted")
+	interval := fs.Duration("interval", DefaultWatchInterval, "Refresh interval for --watch")
+	staleOnly := fs.Bool("stale", false, "List only stale locks, with the reason")
+	failIfStale := fs.Bool("fail-if-stale", false, "Exit 6 if any lock is stale (implies --stale)")
+	schema := fs.Int("schema", 1, "JSON schema: 1, the bare array (deprecated), or 2, the versioned envelope")
+	allRoots := fs.Bool("all-roots", false, "List the locks of every root in this git worktree, with the root")
+	roots := fs.String("roots", "", "List the locks of these roots (comma-separated directories), with the root")
+	_ = fs.Parse(append(flags, pos...))
+
+	if *allRoots || *roots != "" {
+		if (*allRoots && *roots != "") || fs.NArg() > 0 || *group != "" || *watch || *staleOnly || *failIfStale || *pruneExpired || flagGiven(fs, "schema") {
+			fmt.Fprintln(os.Stderr, "error: --all-roots and --roots exclude each other and cannot be combined with a lock name, --group, --watch, --stale, --fail-if-stale, --prune-expired or --schema")
+			return ExitUsage
+		}
+		rootDirs, base, err := statusRootDirs(*allRoots, *roots)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+		out := newOutputSink(*outputPath)
+		return out.finish(statusRoots(out, rootDirs, base, *jsonOutput))
+	}
+
+	if *schema != 1 && *schema != statusSchema {
+		fmt.Fprintf(os.Stderr, "error: --schema must be 1 or %d\n", statusSchema)
+		return ExitUsage
+	}
+	if flagGiven(fs, "schema") && (!*jsonOutput || *group != "") {
+		fmt.Fprintln(os.Stderr, "error: --schema requires --json and cannot be combined with --group")
+		return ExitUsage
+	}
+	if *jsonOutput && *group == "" && !flagGiven(fs, "schema") && !*allRoots && *roots == "" {
+		fmt.Fprintln(os.Stderr, schema1Notice)
+	}
+
+	if *staleOnly || *failIfStale {
+		if fs.NArg() > 0 || *group != "" || *pruneExpired || *watch {
+			fmt.Fprintln(os.Stderr, "error: --stale/--fail-if-stale cannot be combined with a lock name, --group, --prune-expired or --watch")
+			return ExitUsage
+		}
+		out := newOutputSink(*outputPath)
+		render := func(w io.Writer) int { return statusStale(w, *jsonOutput, *failIfStale) }
+		return out.finish(withStatusSchema(*schema, render)(out))
+	}
+
+	if *group != "" && (fs.NArg() > 0 || *pruneExpired) {
+		fmt.Fprintln(os.Stderr, "error: --group cannot be combined with a lock name or --prune-expired")
+		return ExitUsage
+	}
+	if *watch {
+		if *outputPath != "" {
+			fmt.Fprintln(os.Stderr, "error: --watch cannot be combined with --output")
+			return ExitUsage
+		}
+		if *interval <= 0 {
+			fmt.Fprintln(os.Stderr, "error: --interval must be positive (e.g., 1s, 500ms)")
+			return ExitUsage
+		}
+		if !flagGiven(fs, "interval") {
+			*interval = 0 // watch_interval from config.json, once the root is known
+		}
+		return cmdStatusWatch(fs.Args(), *group, *interval, *pruneExpired, *jsonOutput, *schema)
+	}
+
+	out := newOutputSink(*outputPath)
+	if *group != "" {
+		rootDir, err := root.Find()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return out.finish(ExitError)
+		}
+		return out.finish(showGroup(out, rootDir, *group, *jsonOutput))
+	}
+	render := func(w io.Writer) int { return statusTo(w, fs.Args(), *pruneExpired, *jsonOutput) }
+	return out.finish(withStatusSchema(*schema, render)(out))
+}
+
+// cmdStatusWatch implements status --watch: the listing, a single lock or a
+// group, re-rendered every interval (zero: the configured default) until
+// SIGINT or SIGTERM.
+func cmdStatusWatch(args []string, group string, interval time.Duration, pruneExpired, jsonOutput bool, schema int) int {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if pruneExpired {
+		if code := checkWritable(rootDir, ""); code != ExitOK {
+			return code
+		}
+	}
+	if interval == 0 {
+		interval = watchInterval(rootDir)
+	}
+
+	if len(args) > 0 {
+		if err := lockfile.ValidateName(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+	}
+	render := withStatusSchema(schema, statusWatchRender(rootDir, args, group, pruneExpired, jsonOutput))
+	return watchStatus(ctx, os.Stdout, interval, isTerminal(os.Stdout), jsonOutput, watchTitle(args, group), render)
+}
+
+// statusWatchRender returns the frame renderer for cmdStatusWatch.
+func statusWatchRender(rootDir string, args []string, group string, pruneExpired, jsonOutput bool) func(io.Writer) int {
+	switch {
+	case group != "":
+		return func(w io.Writer) int { return showGroup(w, rootDir, group, jsonOutput) }
+	case len(args) > 0:
+		name := args[0]
+		return func(w io.Writer) int {
+			// A lock that comes and goes between ticks is a normal frame, not
+			// an error. The stat spares showLock reporting it on stderr.
+			var frame bytes.Buffer
+			code := ExitNotFound
+			if _, err := os.Stat(root.LockFilePath(rootDir, name)); !os.IsNotExist(err) || len(lock.SharedHolders(rootDir, name)) > 0 || activeFreeze(rootDir, name) != nil {
+				code = statusTo(&frame, args, pruneExpired, jsonOutput)
 			}
-			if *jsonOutput {
-				path := root.FreezeFilePath(rootDir, freezeName)
-				lf, err := readLockFile(path)
-				if err == nil {
-					outputs = append(outputs, lockToStatusOutput(lf, true))
+			switch {
+			case code == ExitNotFound && jsonOutput:
+				fmt.Fprintln(w, "[]")
+			case code == ExitNotFound:
+				fmt.Fprintf(w, "lock %q not held\n", name)
+			case jsonOutput:
+				_, _ = w.Write(wrapJSONArray(frame.Bytes()))
+			default:
+				_, _ = w.Write(frame.Bytes())
+			}
+			if code == ExitNotFound {
+				return ExitOK
+			}
+			return code
+		}
+	}
+	return func(w io.Writer) int { return statusTo(w, args, pruneExpired, jsonOutput) }
+}
+
+// statusTo implements cmdStatus, writing the listing to w.
+func statusTo(w io.Writer, args []string, pruneExpired, jsonOutput bool) int {
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	return statusRoot(w, rootDir, args, pruneExpired, jsonOutput)
+}
+
+// statusRoot is statusTo for the root at rootDir: the lock in args, or the
+// listing of every lock, shared hold and freeze there.
+func statusRoot(w io.Writer, rootDir string, args []string, pruneExpired, jsonOutput bool) int {
+	if pruneExpired {
+		if code := checkWritable(rootDir, ""); code != ExitOK {
+			return code
+		}
+	}
+
+	if !jsonOutput {
+		showGlobalFreeze(w, rootDir)
+	}
+
+	// If a specific lock name given, show just that one
+	if len(args) > 0 {
+		name := args[0]
+		if pruneExpired {
+			return showLockWithPrune(w, rootDir, name, jsonOutput)
+		}
+		return showLock(w, rootDir, name, jsonOutput)
+	}
+
+	// Scan locks/ and freezes/, namespace subdirectories included
+	lockNames, _ := root.LockNames(rootDir)
+	freezeNames, _ := root.Names(root.FreezesPath(rootDir))
+
+	sharedNames := lock.SharedNames(rootDir)
+
+	if len(lockNames) == 0 && len(freezeNames) == 0 && len(sharedNames) == 0 {
+		if jsonOutput {
+			fmt.Fprintln(w, "[]")
+		} else {
+			fmt.Fprintln(w, "no locks")
+		}
+		return ExitOK
+	}
+
+	var outputs []statusOutput
+	pruned := 0
+	grace := skewGrace(rootDir)
+
+	// Slots (guard --slots) are listed together under the name they are
+	// slots of
+	slotCounts := map[string]int{}
+	slotCount := func(lockName string) (string, int) {
+		name, _, ok := lock.SlotOf(lockName)
+		if !ok {
+			return "", 0
+		}
+		n, seen := slotCounts[name]
+		if !seen {
+			n, _ = lock.Slots(rootDir, name)
+			slotCounts[name] = n
+		}
+		return name, n
+	}
+	slotsShown := map[string]bool{}
+
+	// List regular locks from locks/
+	for _, lockName := range lockNames {
+		if pruneExpired {
+			if pruneLockIfExpired(w, rootDir, lockName, jsonOutput) {
+				pruned++
+				continue
+			}
+		}
+		slotOf, slots := slotCount(lockName)
+		if jsonOutput {
+			path := root.LockFilePath(rootDir, lockName)
+			lf, bad, err := readStatusLock(path)
+			if err == nil {
+				out := lockStatusOutput(path, lf, grace)
+				out.Signature = signatureState(lf, bad)
+				if slots > 0 {
+					out.SlotOf, out.Slots = slotOf, slots
 				}
-			} else {
-				showLockBrief(rootDir, freezeName, true)
+				outputs = append(outputs, out)
+			} else if out, ok := unsupportedStatus(path, lockName, err, false); ok {
+				outputs = append(outputs, out)
+			}
+		} else if slots > 0 {
+			if !slotsShown[slotOf] {
+				slotsShown[slotOf] = true
+				showSlotsBrief(w, rootDir, slotOf, slots)
 			}
+		} else {
+			showLockBrief(w, rootDir, lockName, false)
 		}
 	}
 
-	if *jsonOutput {
+	// List shared holds from shared/
+	for _, name := range sharedNames {
+		holders := lock.SharedHolders(rootDir, name)
+		if len(holders) == 0 {
+			continue // released meanwhile
+		}
+		if jsonOutput {
+			outputs = append(outputs, sharedStatusOutputs(holders)...)
+		} else {
+			showSharedBrief(w, name, holders)
+		}
+	}
+
+	// List freeze locks from freezes/
+	for _, freezeName := range freezeNames {
+		if pruneExpired && pruneFreezeIfExpired(w, rootDir, freezeName, jsonOutput) {
+			pruned++
+			continue
+		}
+		if jsonOutput {
+			path := root.FreezeFilePath(rootDir, freezeName)
+			lf, bad, err := readStatusLock(path)
+			if err == nil {
+				out := lockToStatusOutput(lf, true)
+				out.Signature = signatureState(lf, bad)
+				outputs = append(outputs, out)
+			} else if out, ok := unsupportedStatus(path, freezeName, err, true); ok {
+				outputs = append(outputs, out)
+			}
+		} else if freezeName != lock.GlobalFreeze { // shown as the banner
+			showLockBrief(w, rootDir, freezeName, true)
+		}
+	}
+
+	if jsonOutput {
 		if outputs == nil {
 			outputs = []statusOutput{}
 		}
 		data, _ := json.MarshalIndent(outputs, "", "  ")
-		fmt.Println(string(data))
+		fmt.Fprintln(w, string(data))
+	}
+
+	if pruned > 0 && !jsonOutput {
+		fmt.Fprintf(w, "\npruned %d expired lock(s)\n", pruned)
+	}
+	return ExitOK
+}
+
+// statusStale implements status --stale: the locks in locks/ that a waiting
+// acquire would break, with the reason. With failIfStale it returns
+// ExitStale if there are any.
+func statusStale(w io.Writer, jsonOutput, failIfStale bool) int {
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	lockNames, _ := root.LockNames(rootDir)
+	outputs := []statusOutput{}
+	grace := skewGrace(rootDir)
+	for _, name := range lockNames {
+		reason, lf := lock.StaleReason(rootDir, name, grace)
+		if reason == stale.ReasonNotStale {
+			continue
+		}
+		out := statusOutput{Name: name}
+		if lf != nil {
+			out = lockToStatusOutput(lf, false)
+		}
+		out.StaleReason = string(reason)
+		outputs = append(outputs, out)
 	}
 
-	if pruned > 0 && !*jsonOutput {
-		fmt.Printf("\npruned %d expired lock(s)\n", pruned)
+	if jsonOutput {
+		data, _ := json.MarshalIndent(outputs, "", "  ")
+		fmt.Fprintln(w, string(data))
+	} else {
+		showStaleBrief(w, outputs)
+	}
+	if failIfStale && len(outputs) > 0 {
+		return ExitStale
 	}
 	return ExitOK
 }
 
+// showStaleBrief prints the status --stale listing, one line per lock.
+func showStaleBrief(w io.Writer, outputs []statusOutput) {
+	if len(outputs) == 0 {
+		fmt.Fprintln(w, "no stale locks")
+		return
+	}
+	for _, out := range outputs {
+		reason := strings.ToUpper(out.StaleReason)
+		if out.StaleReason == string(stale.ReasonCorrupted) {
+			fmt.Fprintf(w, "%-20s  [%s]\n", out.Name, reason)
+			continue
+		}
+		age := time.Duration(out.AgeSec) * time.Second
+		fmt.Fprintf(w, "%-20s  %s@%s  %s  [%s]\n", out.Name, out.Owner, out.Host, age, reason)
+	}
+}
+
 func cmdExists(args []string) int {
 	if len(args) != 1 {
 		fmt.Fprintf(os.Stderr, "usage: lokt exists <name>\n")
@@ -658,8 +1546,8 @@ func cmdExists(args []string) int {
 		return ExitError
 	}
 
-	lockPath := filepath.Join(rootDir, "locks", name+".json")
-	if _, err := os.Stat(lockPath); err != nil {
+	lockPath := root.LockFilePath(rootDir, name)
+	if _, err := os.Stat(lockPath); err != nil && len(lock.SharedHolders(rootDir, name)) == 0 {
 		return ExitNotFound
 	}
 	return ExitOK
@@ -684,24 +1572,86 @@ func cmdGuard(args []string) int {
 	ttl := fs.Duration("ttl", 0, "Lock TTL (e.g., 5m, 1h)")
 	wait := fs.Bool("wait", false, "Wait for lock to be free")
 	timeout := fs.Duration("timeout", 0, "Maximum time to wait (requires --wait)")
-	if err := fs.Parse(args[:dashIdx]); err != nil {
+	waitThaw := fs.Bool("wait-thaw", false, "Wait for an active freeze to lift instead of failing")
+	noAdaptive := fs.Bool("no-adaptive", false, "Don't slow polling when many others wait for the same lock")
+	totalBudget := fs.Duration("total-wait-budget", 0, "Cap on total lock waiting for this guard and every nested lokt call")
+	useFlock := fs.Bool("flock", false, "Also hold an advisory flock on the lock file while the command runs")
+	waitReport := fs.Duration("wait-report", lock.DefaultProgressInterval, "How often --wait reports who it is waiting on (0: never; unless given, only on a terminal)")
+	maxRenewGap := fs.Duration("max-renew-gap", 0, "Re-verify ownership if renewals stall longer than this (default: TTL)")
+	onLost := fs.String("on-lost", string(guard.LostWarn), "When the lock is found lost: warn or terminate (SIGTERM the command)")
+	strictTTL := fs.Bool("strict-ttl", false, "Treat failed renewals as a lost lock and terminate the command (implies --on-lost terminate)")
+	verifyInterval := fs.Duration("verify-interval", 0, "Check this often that the lock file is still this guard's (default: only before release)")
+	noRelease := fs.Bool("no-release", false, "Keep the lock if the command exits 0, for a follow-up guard or unlock")
+	shared := fs.Bool("shared", false, "Hold a shared (read) lock; coexists with other shared holders")
+	onTimeout := fs.String("on-timeout", "", "Shell command to run if the wait times out (requires --wait)")
+	pollMin := fs.Duration("poll-min", 0, "First --wait poll interval (default 50ms)")
+	pollMax := fs.Duration("poll-max", 0, "Longest --wait poll interval (default 2s or wait_poll_interval)")
+	ifFree := fs.Bool("if-free", false, "Skip the command instead of failing if the lock is held")
+	skipExitCode := fs.Int("skip-exit-code", 0, "Exit code when --if-free skips the command")
+	locks := fs.String("locks", "", "Comma-separated locks to hold together, all or none, instead of <name>")
+	slots := fs.Int("slots", 0, "Hold one of this many slots of <name>, so that many commands can run at once")
+	killTimeout := fs.Duration("kill-timeout", 0, "After forwarding a signal, SIGKILL the command's process group if still running after this (default: wait)")
+	shell := fs.Bool("shell", false, "Run the command, given as one string, through $SHELL -c (or /bin/sh -c)")
+	fs.BoolVar(shell, "c", false, "Short for --shell")
+	message := fs.String("message", "", "What the lock is held for, shown to those it blocks")
+	fs.StringVar(message, "m", "", "Short for --message")
+	labels := labelFlag{}
+	fs.Var(labels, "label", "Attach a key=value label (repeatable)")
+	session := fs.String("session", os.Getenv(lock.EnvLoktSession), "Register the lock in this session, released with it by lokt session end (default: $LOKT_SESSION)")
+	cwd := fs.String("cwd", "", "Run the command in this directory")
+	childEnv := &envFlag{}
+	fs.Var(childEnv, "env", "Set KEY=VALUE in the command's environment (repeatable; later ones win)")
+	fs.Var(envFileFlag{childEnv}, "env-file", "Set the KEY=VALUE lines of this file in the command's environment (# comments allowed)")
+	tagOutput := fs.Bool("tag-output", false, "Prefix each line of the command's stdout and stderr with [<name>]")
+	logFile := fs.String("log-file", "", "Also write the command's output, untagged, to this file")
+	retry := fs.Int("retry", 0, "Re-run the command up to this many times if it fails, keeping the lock")
+	retryDelay := fs.Duration("retry-delay", 0, "Wait this long before each re-run (requires --retry)")
+	noRetryOn := fs.String("no-retry-on", "", "Comma-separated exit codes not to retry (requires --retry)")
+	crashAfter, guardArgs, err := extractCrashFlag(args[:dashIdx])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+	if err := fs.Parse(guardArgs); err != nil {
 		fmt.Fprintln(os.Stderr, "usage: lokt guard [flags] <name> -- <command...>")
 		return ExitUsage
 	}
-	if fs.NArg() != 1 {
+	var name string
+	var also []string
+	switch {
+	case *locks != "" && fs.NArg() == 0:
+		names, err := parseLockList(*locks)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --locks: %v\n", err)
+			return ExitUsage
+		}
+		name, also = names[0], names[1:]
+	case *locks == "" && fs.NArg() == 1:
+		name = fs.Arg(0)
+	default:
 		fmt.Fprintln(os.Stderr, "usage: lokt guard [flags] <name> -- <command...>")
+		fmt.Fprintln(os.Stderr, "       lokt guard [flags] --locks a,b,... -- <command...>")
 		return ExitUsage
 	}
-	name := fs.Arg(0)
 	cmdArgs := args[dashIdx+1:]
+	if *shell && len(cmdArgs) != 1 {
+		fmt.Fprintln(os.Stderr, "error: --shell takes the command as one quoted string, e.g. lokt guard --shell build -- 'make build && make test'")
+		return ExitUsage
+	}
+	if *session != "" {
+		if err := lock.ValidateSessionID(*session); err != nil {
+			fmt.Fprintf(os.Stderr, "error: --session: %v\n", err)
+			return ExitUsage
+		}
+	}
 
 	if *ttl < 0 {
 		fmt.Fprintln(os.Stderr, "error: TTL must be positive (e.g., 5m, 1h)")
 		return ExitUsage
 	}
 
-	if *timeout > 0 && !*wait {
-		fmt.Fprintln(os.Stderr, "error: --timeout requires --wait")
+	if *timeout > 0 && !*wait && !*waitThaw {
+		fmt.Fprintln(os.Stderr, "error: --timeout requires --wait or --wait-thaw")
 		return ExitUsage
 	}
 
@@ -710,272 +1660,708 @@ func cmdGuard(args []string) int {
 		return ExitUsage
 	}
 
+	if *totalBudget < 0 {
+		fmt.Fprintln(os.Stderr, "error: --total-wait-budget must be positive (e.g., 5m)")
+		return ExitUsage
+	}
+	budget := waitBudgetDeadline(*totalBudget, time.Now())
+	if *waitReport < 0 {
+		fmt.Fprintln(os.Stderr, "error: --wait-report must be positive (e.g., 30s), or 0 to disable")
+		return ExitUsage
+	}
+	if flagGiven(fs, "wait-report") && !*wait {
+		fmt.Fprintln(os.Stderr, "error: --wait-report requires --wait")
+		return ExitUsage
+	}
+
+	if *maxRenewGap < 0 {
+		fmt.Fprintln(os.Stderr, "error: --max-renew-gap must be positive (e.g., 10m)")
+		return ExitUsage
+	}
+	if *verifyInterval < 0 {
+		fmt.Fprintln(os.Stderr, "error: --verify-interval must be positive (e.g., 30s)")
+		return ExitUsage
+	}
+	if *killTimeout < 0 {
+		fmt.Fprintln(os.Stderr, "error: --kill-timeout must be positive (e.g., 10s)")
+		return ExitUsage
+	}
+	killGrace := lostKillGrace
+	if *killTimeout > 0 {
+		killGrace = *killTimeout
+	}
+	if p := guard.LostPolicy(*onLost); p != guard.LostWarn && p != guard.LostTerminate {
+		fmt.Fprintf(os.Stderr, "error: --on-lost must be %s or %s\n", guard.LostWarn, guard.LostTerminate)
+		return ExitUsage
+	}
+	if *strictTTL {
+		if flagGiven(fs, "on-lost") && guard.LostPolicy(*onLost) != guard.LostTerminate {
+			fmt.Fprintln(os.Stderr, "error: --strict-ttl cannot be combined with --on-lost warn")
+			return ExitUsage
+		}
+		*onLost = string(guard.LostTerminate)
+	}
+	if *shared && *noRelease {
+		fmt.Fprintln(os.Stderr, "error: --no-release cannot be combined with --shared")
+		return ExitUsage
+	}
+	if *onTimeout != "" && !*wait && !*waitThaw {
+		fmt.Fprintln(os.Stderr, "error: --on-timeout requires --wait or --wait-thaw")
+		return ExitUsage
+	}
+	if err := checkPollFlags(*pollMin, *pollMax, *wait); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+	if *ifFree && *wait {
+		fmt.Fprintln(os.Stderr, "error: --if-free cannot be combined with --wait")
+		return ExitUsage
+	}
+	if flagGiven(fs, "skip-exit-code") && !*ifFree {
+		fmt.Fprintln(os.Stderr, "error: --skip-exit-code requires --if-free")
+		return ExitUsage
+	}
+	if *skipExitCode < 0 || *skipExitCode > 255 {
+		fmt.Fprintln(os.Stderr, "error: --skip-exit-code must be between 0 and 255")
+		return ExitUsage
+	}
+	if len(also) > 0 && (*ifFree || *noRelease) {
+		fmt.Fprintln(os.Stderr, "error: --locks cannot be combined with --if-free or --no-release")
+		return ExitUsage
+	}
+	if flagGiven(fs, "slots") {
+		if *slots < 1 || *slots > lock.MaxSlots {
+			fmt.Fprintf(os.Stderr, "error: --slots must be between 1 and %d\n", lock.MaxSlots)
+			return ExitUsage
+		}
+		if *locks != "" || *shared || *noRelease {
+			fmt.Fprintln(os.Stderr, "error: --slots cannot be combined with --locks, --shared or --no-release")
+			return ExitUsage
+		}
+	}
+	if *retry < 0 {
+		fmt.Fprintln(os.Stderr, "error: --retry must be positive (e.g., 2)")
+		return ExitUsage
+	}
+	if *retryDelay < 0 {
+		fmt.Fprintln(os.Stderr, "error: --retry-delay must be positive (e.g., 5s)")
+		return ExitUsage
+	}
+	if (flagGiven(fs, "retry-delay") || flagGiven(fs, "no-retry-on")) && *retry == 0 {
+		fmt.Fprintln(os.Stderr, "error: --retry-delay and --no-retry-on require --retry")
+		return ExitUsage
+	}
+	noRetryCodes, err := parseExitCodes(*noRetryOn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: --no-retry-on: %v\n", err)
+		return ExitUsage
+	}
+	if *cwd != "" {
+		// Checked now: acquiring only to fail to start the command would
+		// make whoever waits for the lock wait for nothing.
+		if fi, err := os.Stat(*cwd); err != nil || !fi.IsDir() {
+			if err == nil {
+				err = fmt.Errorf("%s is not a directory", *cwd)
+			}
+			fmt.Fprintf(os.Stderr, "error: --cwd: %v\n", err)
+			return ExitUsage
+		}
+	}
+	var outputLog io.Writer
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644) //nolint:gosec // G304: the user's own flag
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --log-file: %v\n", err)
+			return ExitUsage
+		}
+		defer func() { _ = f.Close() }()
+		outputLog = f
+	}
+
 	// Resolve root
 	rootDir, err := root.Find()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		reportError(name, err, "")
 		return ExitError
 	}
-
-	auditor := audit.NewWriter(rootDir)
-
-	// Check for active freeze before acquiring
-	if err := lock.CheckFreeze(rootDir, name, auditor); err != nil {
-		var frozen *lock.FrozenError
-		if errors.As(err, &frozen) {
-			fmt.Fprintf(os.Stderr, "error: %v\n", frozen)
-			return ExitLockHeld
+	if code := checkWritable(rootDir, name); code != ExitOK {
+		return code
+	}
+
+	if !flagGiven(fs, "ttl") {
+		*ttl = defaultTTL(rootDir, name)
+	}
+
+	opts := lock.AcquireOptions{
+		TTL:               *ttl,
+		Auditor:           newAuditor(rootDir),
+		RetryAfterDefault: retryAfterDefault(rootDir),
+		NoAdaptive:        *noAdaptive || !adaptiveBackoff(rootDir),
+		ExclusionGroups:   exclusionGroups(rootDir),
+		Shared:            *shared,
+		Retry:             withPollFlags(waitRetryPolicy(rootDir), *pollMin, *pollMax),
+		Message:           *message,
+		Labels:            labels,
+		SkewGrace:         skewGrace(rootDir),
+		Flock:             *useFlock || flockLocks(rootDir),
+		Session:           *session,
+		RespectFreeze:     true, // a freeze placed while waiting holds the wait up
+	}
+	// Progress lines are for someone watching; a log gets them on request.
+	if *waitReport > 0 && (flagGiven(fs, "wait-report") || isTerminal(os.Stderr)) {
+		opts.ProgressInterval = *waitReport
+		opts.OnProgress = func(lf *lockfile.Lock, waited time.Duration) {
+			reportWaitProgress(name, lf, waited)
 		}
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		return ExitError
 	}
 
-	opts := lock.AcquireOptions{TTL: *ttl, Auditor: auditor}
-
-	// Acquire lock (with optional wait)
-	if *wait {
-		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	// One deadline covers both the thaw wait and the lock wait.
+	ctx := context.Background()
+	if *wait || *waitThaw {
+		var cancel context.CancelFunc
+		ctx, cancel = waitContext(*timeout, budget)
 		defer cancel()
+	}
 
-		waitTimeout := *timeout
-		if waitTimeout == 0 {
-			waitTimeout = DefaultWaitTimeout
+	var env []string // nil inherits
+	if *totalBudget > 0 {
+		// Whatever is left of the budget bounds every nested lokt wait.
+		env = append(os.Environ(), waitBudgetEnv+"="+budget.UTC().Format(time.RFC3339Nano))
+	}
+	if len(childEnv.vars) > 0 {
+		if env == nil {
+			env = os.Environ()
 		}
-		ctx, cancel = context.WithTimeout(ctx, waitTimeout)
-		defer cancel()
+		env = append(env, childEnv.vars...) // the last of a key wins
+	}
 
-		err = lock.AcquireWithWait(ctx, rootDir, name, opts)
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				fmt.Fprintln(os.Stderr, "interrupted")
-				return ExitError
+	// A guard run by a guard on the same lock, or a slot of it, runs under
+	// its hold
+	held := name
+	if s := os.Getenv(guard.EnvLock); *slots > 0 {
+		if base, _, ok := lock.SlotOf(s); ok && base == name {
+			held = s
+		}
+	}
+	inherited := len(also) == 0 && guard.Inherited(rootDir, held, *shared)
+	slotCount := *slots
+	if inherited {
+		slotCount = 0
+	}
+	runner := guard.New(guard.Options{
+		RootDir:   rootDir,
+		Name:      held,
+		Command:   cmdArgs,
+		Shell:     *shell,
+		Acquire:   opts,
+		Wait:      *wait,
+		WaitThaw:  *waitThaw,
+		IfFree:    *ifFree,
+		Inherited: inherited,
+		Also:      also,
+		Slots:     slotCount,
+		Env:       env,
+		Dir:       *cwd,
+		Stdin:     os.Stdin,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		TagOutput: *tagOutput,
+		OutputLog: outputLog,
+
+		MaxRenewGap:    *maxRenewGap,
+		OnLost:         guard.LostPolicy(*onLost),
+		StrictTTL:      *strictTTL,
+		KillGrace:      killGrace,
+		VerifyInterval: *verifyInterval,
+		KillTimeout:    *killTimeout,
+		NoRelease:      *noRelease,
+
+		Retry:      *retry,
+		RetryDelay: *retryDelay,
+		NoRetryOn:  noRetryCodes,
+	}, guard.Hooks{
+		OnWaiting: func(stage guard.Stage, lk *lockfile.Lock) {
+			if stage == guard.StageFreeze {
+				reportThawWait(name, lk)
 			}
-			if errors.Is(err, context.DeadlineExceeded) {
-				path := root.LockFilePath(rootDir, name)
-				if lf, readErr := readLockFile(path); readErr == nil {
-					age := time.Since(lf.AcquiredAt).Truncate(time.Second)
-					fmt.Fprintf(os.Stderr, "error: timeout waiting for lock %q held by %s@%s (pid %d) for %s\n",
-						name, lf.Owner, lf.Host, lf.PID, age)
-				} else {
-					fmt.Fprintf(os.Stderr, "error: timeout waiting for lock %q\n", name)
+		},
+		OnAcquired: func() { simulateCrash(crashAfter, crashAfterAcquire) },
+		OnRenewFailed: func(err error) {
+			// The child may still complete successfully
+			fmt.Fprintf(os.Stderr, "warning: lock renewal failed: %v\n", err)
+		},
+		OnClockGap: func(gap time.Duration) {
+			fmt.Fprintf(os.Stderr, "warning: no renewal of %q for %s (host suspended?); re-checking ownership\n",
+				name, gap.Truncate(time.Second))
+		},
+		OnLost: func(err error) {
+			action := "command keeps running unprotected"
+			if guard.LostPolicy(*onLost) == guard.LostTerminate {
+				action = "terminating command"
+			}
+			reportError(name, err, fmt.Sprintf("error: %v; %s", err, action))
+		},
+		OnVanished: func(err error) {
+			reportError(name, err, fmt.Sprintf("error: lock file vanished or was replaced while the command ran "+
+				"(did it delete the lock root, e.g. git clean -xfd?): %v", err))
+		},
+		OnChildStart: func(int) { simulateCrash(crashAfter, crashAfterChildStart) },
+		OnRetry: func(attempt int, res guard.Result) {
+			fmt.Fprintf(os.Stderr, "attempt %d of %d exited %d; retrying in %s under lock %q\n",
+				attempt, *retry+1, res.ExitCode, *retryDelay, name)
+		},
+		OnChildExit: func(res guard.Result) {
+			if *retry > 0 && res.Attempts > 1 && res.Signal == nil {
+				outcome := "succeeded"
+				if res.ExitCode != 0 {
+					outcome = fmt.Sprintf("exited %d", res.ExitCode)
 				}
-				return ExitLockHeld
+				fmt.Fprintf(os.Stderr, "attempt %d of %d %s\n", res.Attempts, *retry+1, outcome)
 			}
-			var held *lock.HeldError
-			if errors.As(err, &held) {
-				fmt.Fprintf(os.Stderr, "error: %v\n", held)
-				return ExitLockHeld
+			if res.Signal == nil {
+				simulateCrash(crashAfter, crashAfterChildExit)
 			}
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		},
+		OnRetain: func(err error) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: could not keep lock %q, releasing: %v\n", name, err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "kept lock %q; continue under it with lokt guard %s -- ..., or lokt unlock %s\n", name, name, name)
+		},
+	})
+
+	res, err := runner.Run(ctx)
+	if err == nil {
+		if res.Skipped != nil {
+			// Someone else is doing this work; not a failure
+			held := *res.Skipped
+			held.RetryAfter = 0
+			fmt.Fprintf(os.Stderr, "skipped: %v\n", &held)
+			return *skipExitCode
+		}
+		if res.Vanished != nil {
+			return ExitVanished
+		}
+		if res.Lost != nil && res.Signal != nil {
+			return ExitLockHeld // terminated for the lost lock
+		}
+		return res.ExitCode
+	}
+	switch res.Stage {
+	case guard.StageFreeze:
+		var frozen *lock.FrozenError
+		if errors.As(err, &frozen) {
+			reportError(name, err, "")
+			return exitFrozen()
+		}
+		code := thawWaitExit(ctx, rootDir, name, err)
+		if errors.Is(err, context.DeadlineExceeded) {
+			fz, _ := lockfile.Read(root.FreezeFilePath(rootDir, name)) // nil if lifted meanwhile
+			runTimeoutHook(*onTimeout, name, fz)
+		}
+		return code
+	case guard.StageAcquire:
+		if errors.Is(err, context.Canceled) {
+			reportError(name, err, "interrupted")
 			return ExitError
 		}
-	} else {
-		if err := lock.Acquire(rootDir, name, opts); err != nil {
-			var held *lock.HeldError
-			if errors.As(err, &held) {
-				fmt.Fprintf(os.Stderr, "error: %v\n", held)
-				return ExitLockHeld
+		if errors.Is(err, context.DeadlineExceeded) {
+			names := append([]string{name}, also...)
+			for k := range *slots {
+				names = append(names, lock.SlotName(name, k))
 			}
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
-			return ExitError
+			name := firstHeld(rootDir, names)
+			lf, _ := lockfile.Read(root.LockFilePath(rootDir, name)) // nil if unreadable
+			reportError(name, &timeoutError{lf, lock.RetryAfter(lf, opts.RetryAfterDefault)},
+				lockTimeoutMessage(name, lf, opts.RetryAfterDefault, budgetNote(ctx), err))
+			runTimeoutHook(*onTimeout, name, blockingHolder(rootDir, name))
+			return exitTimeout()
 		}
-	}
-
-	// Ensure release on all paths
-	released := false
-	releaseLock := func() {
-		if !released {
-			_ = lock.Release(rootDir, name, lock.ReleaseOptions{Auditor: auditor})
-			released = true
+		if errors.Is(err, lock.ErrDeadlock) {
+			reportError(name, err, "")
+			return ExitDeadlock
 		}
-	}
-	defer releaseLock()
-
-	// Start heartbeat goroutine if TTL is set
-	var cancelHeartbeat context.CancelFunc
-	if *ttl > 0 {
-		var heartbeatCtx context.Context
-		heartbeatCtx, cancelHeartbeat = context.WithCancel(context.Background())
-		go runHeartbeat(heartbeatCtx, rootDir, name, *ttl, auditor)
-	}
-	defer func() {
-		if cancelHeartbeat != nil {
-			cancelHeartbeat()
+		var held *lock.HeldError
+		if errors.As(err, &held) {
+			reportError(held.Lock.Name, err, "")
+			return ExitLockHeld
 		}
-	}()
-
-	// Set up signal handling
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(sigCh)
-
-	// Run child command
-	child := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-	child.Stdin = os.Stdin
-	child.Stdout = os.Stdout
-	child.Stderr = os.Stderr
-
-	if err := child.Start(); err != nil {
-		fmt.Fprintf(os.Stderr, "error: failed to start command: %v\n", err)
+		var frozen *lock.FrozenError
+		if errors.As(err, &frozen) {
+			// Frozen between the freeze check and the first attempt
+			reportError(name, err, "")
+			return exitFrozen()
+		}
+	case guard.StageStart:
+		reportError(name, err, fmt.Sprintf("error: failed to start command: %v", err))
 		return ExitError
 	}
+	reportError(name, err, "")
+	return ExitError
+}
 
-	// Wait for child or signal
-	done := make(chan error, 1)
-	go func() { done <- child.Wait() }()
-
-	select {
-	case sig := <-sigCh:
-		// Forward signal to child
-		_ = child.Process.Signal(sig)
-		<-done // wait for child to exit
-		releaseLock()
-		// Exit with 128 + signal number (standard Unix convention)
-		if s, ok := sig.(syscall.Signal); ok {
-			return 128 + int(s)
-		}
-		return ExitError
-	case err := <-done:
-		if err == nil {
-			return ExitOK
+// parseExitCodes parses a comma-separated list of exit codes, as given to
+// guard --no-retry-on.
+func parseExitCodes(list string) ([]int, error) {
+	var codes []int
+	for _, v := range splitList(list) {
+		code, err := strconv.Atoi(v)
+		if err != nil || code < 0 || code > 255 {
+			return nil, fmt.Errorf("%q is not an exit code (0-255)", v)
 		}
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return exitErr.ExitCode()
-		}
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		return ExitError
+		codes = append(codes, code)
 	}
+	return codes, nil
 }
 
-// runHeartbeat periodically renews the lock's TTL while the context is active.
-// It runs at TTL/2 intervals to ensure the lock is renewed before expiration.
-// Renewal failures are logged as warnings but don't stop the heartbeat.
-func runHeartbeat(ctx context.Context, rootDir, name string, ttl time.Duration, auditor *audit.Writer) {
-	// Calculate interval: TTL/2, with a minimum of 500ms
-	interval := ttl / 2
-	const minInterval = 500 * time.Millisecond
-	if interval < minInterval {
-		interval = minInterval
+// awaitThaw waits for any active freeze on name to lift, reporting progress
+// on stderr. Returns the time spent waiting and ExitOK, or the exit code to
+// use if the wait was interrupted or timed out.
+func awaitThaw(ctx context.Context, rootDir, name string, auditor *audit.Writer) (time.Duration, int) {
+	waited, err := lock.WaitForThaw(ctx, rootDir, name, lock.ThawOptions{
+		Auditor:  auditor,
+		OnChange: func(fz *lockfile.Lock) { reportThawWait(name, fz) },
+	})
+	if err != nil {
+		return waited, thawWaitExit(ctx, rootDir, name, err)
 	}
+	return waited, ExitOK
+}
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// reportThawWait prints the progress line for a thaw wait on name, when the
+// wait begins and whenever the freeze is replaced.
+func reportThawWait(name string, fz *lockfile.Lock) {
+	remaining := "no expiry"
+	if rem := fz.Remaining(); rem > 0 {
+		remaining = rem.Truncate(time.Second).String() + " remaining"
+	}
+	fmt.Fprintf(os.Stderr, "waiting for freeze on %q by %s@%s to lift (%s)\n",
+		name, fz.Owner, fz.Host, remaining)
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			err := lock.Renew(rootDir, name, lock.RenewOptions{Auditor: auditor})
-			if err != nil {
-				// Log warning but continue - child may still complete successfully
-				fmt.Fprintf(os.Stderr, "warning: lock renewal failed: %v\n", err)
-			}
-		}
+// reportWaitProgress tells a --wait still waiting who holds the lock it is
+// waiting for (lf; nil or without an owner if it couldn't be read).
+func reportWaitProgress(name string, lf *lockfile.Lock, waited time.Duration) {
+	waitedFor := waited.Truncate(time.Second)
+	if lf == nil || lf.Owner == "" {
+		fmt.Fprintf(os.Stderr, "still waiting for lock %q, waited %s so far\n", name, waitedFor)
+		return
+	}
+	if lf.Name != "" {
+		name = lf.Name // one of several --locks
+	}
+	ttl := ""
+	if rem := lf.Remaining(); rem > 0 {
+		ttl = ", ttl remaining " + rem.Truncate(time.Second).String()
 	}
+	fmt.Fprintf(os.Stderr, "still waiting for lock %q: held by %s@%s (pid %d) for %s%s, waited %s so far\n",
+		name, lf.Owner, lf.Host, lf.PID, lf.Age().Truncate(time.Second), ttl, waitedFor)
 }
 
-func showLock(rootDir, name string, jsonOutput bool) int {
+// thawWaitExit reports a failed thaw wait and returns its exit code.
+func thawWaitExit(ctx context.Context, rootDir, name string, err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		reportError(name, err, "interrupted")
+		return ExitError
+	case errors.Is(err, context.DeadlineExceeded):
+		fz, _ := lockfile.Read(root.FreezeFilePath(rootDir, name)) // nil if lifted meanwhile
+		retryAfter := freezeRetryAfter(rootDir, name)
+		reportError(name, &timeoutError{fz, retryAfter}, fmt.Sprintf("error: timeout waiting for freeze on %q to lift%s; %s",
+			name, budgetNote(ctx), lock.FormatRetryAfter(retryAfter)))
+		return exitTimeout()
+	default:
+		reportError(name, err, "")
+		return ExitError
+	}
+}
+
+// showLock prints the state of one name: its exclusive lock or shared
+// holders, and any active freeze on it. A name that is only frozen is
+// reported as such rather than not found.
+func showLock(w io.Writer, rootDir, name string, jsonOutput bool) int {
+	fz := activeFreeze(rootDir, name)
 	path := root.LockFilePath(rootDir, name)
-	lf, err := readLockFile(path)
+	lf, bad, err := readStatusLock(path)
 	if err != nil {
 		if os.IsNotExist(err) {
+			if holders := lock.SharedHolders(rootDir, name); len(holders) > 0 {
+				return showShared(w, name, holders, fz, jsonOutput)
+			}
+			if n, _ := lock.Slots(rootDir, name); n > 0 {
+				return showSlots(w, rootDir, name, n, fz, jsonOutput)
+			}
+			if fz != nil {
+				return showFreezeOnly(w, name, fz, jsonOutput)
+			}
 			fmt.Fprintf(os.Stderr, "lock %q not found\n", name)
 			return ExitNotFound
 		}
+		if out, ok := unsupportedStatus(path, name, err, false); ok {
+			if jsonOutput {
+				data, _ := json.MarshalIndent(out, "", "  ")
+				fmt.Fprintln(w, string(data))
+				return ExitOK
+			}
+			fmt.Fprintf(w, "name:     %s\n", name)
+			fmt.Fprintf(w, "version:  %d (unsupported by this binary; upgrade lokt to read it)\n", out.Version)
+			return ExitOK
+		}
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return ExitError
 	}
 
 	if jsonOutput {
-		output := lockToStatusOutput(lf, false)
+		output := lockStatusOutput(path, lf, skewGrace(rootDir))
+		output.Signature = signatureState(lf, bad)
+		if fz != nil {
+			frozen := lockToStatusOutput(fz, true)
+			output.ActiveFreeze = &frozen
+		}
 		data, _ := json.MarshalIndent(output, "", "  ")
-		fmt.Println(string(data))
+		fmt.Fprintln(w, string(data))
 		return ExitOK
 	}
 
-	age := time.Since(lf.AcquiredAt).Truncate(time.Second)
-	fmt.Printf("name:     %s\n", lf.Name)
-	fmt.Printf("owner:    %s\n", lf.Owner)
-	if lf.AgentID != "" {
-		fmt.Printf("agent:    %s\n", lf.AgentID)
+	age := lf.Age().Truncate(time.Second)
+	fmt.Fprintf(w, "name:     %s\n", lf.Name)
+	fmt.Fprintf(w, "owner:    %s\n", lf.Owner)
+	if lf.AgentExplicit {
+		fmt.Fprintf(w, "agent:    %s (LOKT_AGENT_ID)\n", lf.AgentID)
+	} else if lf.AgentID != "" {
+		fmt.Fprintf(w, "agent:    %s\n", lf.AgentID)
+	}
+	fmt.Fprintf(w, "host:     %s\n", lf.Host)
+	fmt.Fprintf(w, "pid:      %d (%s)\n", lf.PID, pidLiveness(lf))
+	fmt.Fprintf(w, "age:      %s\n", age)
+	if lf.RenewedAt != nil {
+		fmt.Fprintf(w, "renewed:  %s (last heartbeat %s ago)\n", lf.RenewedAt.Format(time.RFC3339), time.Since(*lf.RenewedAt).Truncate(time.Second))
+	}
+	if lf.Message != "" {
+		fmt.Fprintf(w, "message:  %s\n", lf.Message)
+	}
+	if lf.Path != "" {
+		fmt.Fprintf(w, "path:     %s\n", lf.Path)
+	}
+	if len(lf.Labels) > 0 {
+		fmt.Fprintf(w, "labels:   %s\n", formatLabels(lf.Labels))
+	}
+	switch signatureState(lf, bad) {
+	case signatureValid:
+		fmt.Fprintln(w, "sig:      valid")
+	case signatureUnsigned:
+		fmt.Fprintln(w, "sig:      UNSIGNED (unlock and renew refuse it without --force)")
+	case signatureBad:
+		fmt.Fprintln(w, "sig:      BAD (forged, or signed with a retired key; unlock --force removes it)")
 	}
-	fmt.Printf("host:     %s\n", lf.Host)
-	fmt.Printf("pid:      %d (%s)\n", lf.PID, pidLiveness(lf))
-	fmt.Printf("age:      %s\n", age)
 	if lf.TTLSec > 0 {
-		fmt.Printf("ttl:      %ds\n", lf.TTLSec)
+		fmt.Fprintf(w, "ttl:      %ds\n", lf.TTLSec)
 		if lf.ExpiresAt != nil {
 			if lf.IsExpired() {
-				fmt.Printf("expires:  %s (EXPIRED)\n", lf.ExpiresAt.Format(time.RFC3339))
+				fmt.Fprintf(w, "expires:  %s (EXPIRED)\n", lf.ExpiresAt.Format(time.RFC3339))
 			} else {
-				fmt.Printf("expires:  %s (in %s)\n", lf.ExpiresAt.Format(time.RFC3339), lf.remaining().Truncate(time.Second))
+				fmt.Fprintf(w, "expires:  %s (in %s)\n", lf.ExpiresAt.Format(time.RFC3339), lf.Remaining().Truncate(time.Second))
 			}
 		} else if lf.IsExpired() {
-			fmt.Println("status:   EXPIRED")
+			fmt.Fprintln(w, "status:   EXPIRED")
 		}
 	}
+	if fz != nil {
+		showFreezeLine(w, fz)
+	}
 	return ExitOK
 }
 
-func showLockBrief(rootDir, name string, isFreeze bool) {
+// activeFreeze returns the unexpired freeze on name, from freezes/ or the
+// legacy locks/freeze-<name>.json, or nil if there is none.
+func activeFreeze(rootDir, name string) *lockfile.Lock {
+	fz, err := lockfile.Read(root.FreezeFilePath(rootDir, name))
+	if os.IsNotExist(err) {
+		fz, err = lockfile.Read(root.LockFilePath(rootDir, lock.FreezePrefix+name))
+	}
+	if err != nil || fz.IsExpired() {
+		return nil
+	}
+	return fz
+}
+
+// showFreezeOnly prints the status of a name that is frozen but not locked.
+func showFreezeOnly(w io.Writer, name string, fz *lockfile.Lock, jsonOutput bool) int {
+	if jsonOutput {
+		data, _ := json.MarshalIndent(lockToStatusOutput(fz, true), "", "  ")
+		fmt.Fprintln(w, string(data))
+		return ExitOK
+	}
+	fmt.Fprintf(w, "name:     %s\n", name)
+	fmt.Fprintln(w, "lock:     not held")
+	showFreezeLine(w, fz)
+	return ExitOK
+}
+
+// showFreezeLine prints the frozen: line of a single-name status.
+func showFreezeLine(w io.Writer, fz *lockfile.Lock) {
+	remaining := ""
+	if rem := fz.Remaining(); rem > 0 {
+		remaining = fmt.Sprintf(", %s left", rem.Truncate(time.Second))
+	}
+	fmt.Fprintf(w, "frozen:   by %s@%s for %s%s [FROZEN]\n", fz.Owner, fz.Host, fz.Age().Truncate(time.Second), remaining)
+	if end, ok := fz.Expiry(); ok {
+		fmt.Fprintf(w, "until:    %s\n", end.UTC().Format(time.RFC3339))
+	}
+	if fz.Message != "" {
+		fmt.Fprintf(w, "reason:   %s\n", fz.Message)
+	}
+}
+
+// showGlobalFreeze prints a banner above the status output while a global
+// freeze is active.
+func showGlobalFreeze(w io.Writer, rootDir string) {
+	fz, err := lockfile.Read(root.FreezeFilePath(rootDir, lock.GlobalFreeze))
+	if err != nil || fz.IsExpired() {
+		return
+	}
+	remaining := ""
+	if rem := fz.Remaining(); rem > 0 {
+		remaining = fmt.Sprintf(", %s left", rem.Truncate(time.Second))
+	}
+	reason := ""
+	if fz.Message != "" {
+		reason = fz.Message + "; "
+	}
+	fmt.Fprintf(w, "GLOBAL FREEZE: every guard is blocked (%sby %s@%s%s; lift with lokt unfreeze --all)\n\n",
+		reason, fz.Owner, fz.Host, remaining)
+}
+
+func showLockBrief(w io.Writer, rootDir, name string, isFreeze bool) {
 	var path string
 	if isFreeze {
 		path = root.FreezeFilePath(rootDir, name)
 	} else {
 		path = root.LockFilePath(rootDir, name)
 	}
-	lf, err := readLockFile(path)
+	lf, bad, err := readStatusLock(path)
 	if err != nil {
+		if out, ok := unsupportedStatus(path, name, err, isFreeze); ok {
+			fmt.Fprintf(w, "%-20s  version: %d (unsupported by this binary)\n", name, out.Version)
+		}
 		return
 	}
 
-	age := time.Since(lf.AcquiredAt).Truncate(time.Second)
+	age := lf.Age().Truncate(time.Second)
 	status := ""
+	if rem := lf.Remaining(); rem > 0 {
+		status = fmt.Sprintf("  %s left", rem.Truncate(time.Second))
+	}
 	if isFreeze {
-		status = " [FROZEN]"
+		status += " [FROZEN]"
 	}
 	if lf.IsExpired() {
 		status += " [EXPIRED]"
 	} else if liveness := pidLiveness(lf); liveness == "dead" {
 		status += " [DEAD]"
 	}
-	fmt.Printf("%-20s  %s@%s  %s%s\n", name, lf.Owner, lf.Host, age, status)
+	status += signatureTag(signatureState(lf, bad))
+	if lf.Name != "" {
+		name = lf.Name // not the stem of a name too long for a file name
+	}
+	fmt.Fprintf(w, "%-20s  %s@%s  %s%s\n", name, lf.Owner, lf.Host, age, status)
 }
 
-// showLockWithPrune shows a lock and removes it if expired.
-func showLockWithPrune(rootDir, name string, jsonOutput bool) int {
+// showShared prints the holders of a lock held in shared mode, and the
+// active freeze fz on it if not nil. The JSON form is an array with one
+// entry per holder, then one for the freeze.
+func showShared(w io.Writer, name string, holders []*lockfile.Lock, fz *lockfile.Lock, jsonOutput bool) int {
+	if jsonOutput {
+		outputs := sharedStatusOutputs(holders)
+		if fz != nil {
+			outputs = append(outputs, lockToStatusOutput(fz, true))
+		}
+		data, _ := json.MarshalIndent(outputs, "", "  ")
+		fmt.Fprintln(w, string(data))
+		return ExitOK
+	}
+	fmt.Fprintf(w, "name:     %s\n", name)
+	fmt.Fprintf(w, "mode:     shared (%d holders)\n", len(holders))
+	for _, h := range holders {
+		status := ""
+		if h.IsExpired() {
+			status = ", EXPIRED"
+		}
+		fmt.Fprintf(w, "holder:   %s@%s (pid %d, %s) for %s%s\n",
+			h.Owner, h.Host, h.PID, pidLiveness(h), h.Age().Truncate(time.Second), status)
+	}
+	if fz != nil {
+		showFreezeLine(w, fz)
+	}
+	return ExitOK
+}
+
+// showSharedBrief prints the status line of a lock held in shared mode.
+func showSharedBrief(w io.Writer, name string, holders []*lockfile.Lock) {
+	who := make([]string, len(holders))
+	staleHolders := 0
+	for i, h := range holders {
+		who[i] = h.Owner + "@" + h.Host
+		if h.IsExpired() || pidLiveness(h) == "dead" {
+			staleHolders++
+		}
+	}
+	status := ""
+	if staleHolders > 0 {
+		status = fmt.Sprintf(" [%d STALE]", staleHolders)
+	}
+	fmt.Fprintf(w, "%-20s  shared by %d: %s  %s%s\n",
+		name, len(holders), strings.Join(who, ", "), holders[0].Age().Truncate(time.Second), status)
+}
+
+// sharedStatusOutputs returns the JSON status entries of a shared lock's
+// holders, each carrying the holder count.
+func sharedStatusOutputs(holders []*lockfile.Lock) []statusOutput {
+	out := make([]statusOutput, len(holders))
+	for i, h := range holders {
+		out[i] = lockToStatusOutput(h, false)
+		out[i].Holders = len(holders)
+	}
+	return out
+}
+
+// showLockWithPrune shows a lock, removing it and any freeze on the name
+// that has expired.
+func showLockWithPrune(w io.Writer, rootDir, name string, jsonOutput bool) int {
+	pruneFreezeIfExpired(w, rootDir, name, jsonOutput)
 	path := root.LockFilePath(rootDir, name)
-	lf, err := readLockFile(path)
+	lf, err := lockfile.Read(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "lock %q not found\n", name)
-			return ExitNotFound
+			return showLock(w, rootDir, name, jsonOutput) // shared or only frozen
 		}
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return ExitError
 	}
 
 	if lf.IsExpired() {
-		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		removed, err := removeExpired(path, lf)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "error removing lock: %v\n", err)
 			return ExitError
 		}
-		_ = lockfile.SyncDir(path)
-		if !jsonOutput {
-			fmt.Printf("pruned expired lock %q\n", name)
+		if removed {
+			if !jsonOutput {
+				fmt.Fprintf(w, "pruned expired lock %q\n", name)
+			}
+			return ExitOK
 		}
-		return ExitOK
 	}
 
-	// Not expired, show normally
-	return showLock(rootDir, name, jsonOutput)
+	// Not expired (or renewed meanwhile), show normally
+	return showLock(w, rootDir, name, jsonOutput)
 }
 
 // pruneLockIfExpired removes a lock if expired, returns true if pruned.
-func pruneLockIfExpired(rootDir, name string) bool {
+func pruneLockIfExpired(w io.Writer, rootDir, name string, jsonOutput bool) bool {
 	path := root.LockFilePath(rootDir, name)
-	lf, err := readLockFile(path)
+	lf, err := lockfile.Read(path)
 	if err != nil {
 		return false
 	}
@@ -984,42 +2370,43 @@ func pruneLockIfExpired(rootDir, name string) bool {
 		return false
 	}
 
-	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+	if removed, _ := removeExpired(path, lf); !removed {
 		return false
 	}
-	_ = lockfile.SyncDir(path)
 
-	fmt.Printf("pruned: %s (expired)\n", name)
+	if !jsonOutput {
+		fmt.Fprintf(w, "pruned: %s (expired)\n", name)
+	}
 	return true
 }
 
-func readLockFile(path string) (*lockFile, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+// pruneFreezeIfExpired removes the freeze on name from freezes/ if expired,
+// returns true if pruned.
+func pruneFreezeIfExpired(w io.Writer, rootDir, name string, jsonOutput bool) bool {
+	path := root.FreezeFilePath(rootDir, name)
+	lf, err := lockfile.Read(path)
+	if err != nil || !lf.IsExpired() {
+		return false
+	}
+	if removed, _ := removeExpired(path, lf); !removed {
+		return false
 	}
-	var lf lockFile
-	if err := parseJSON(data, &lf); err != nil {
-		return nil, err
+	if lf.Pattern {
+		name = lf.Name // not the file of the pattern under _patterns/
 	}
-	if lf.Version > lockfile.CurrentLockfileVersion {
-		return nil, fmt.Errorf("%w: version %d not supported (max: %d); upgrade lokt",
-			lockfile.ErrUnsupportedVersion, lf.Version, lockfile.CurrentLockfileVersion)
+	if !jsonOutput {
+		fmt.Fprintf(w, "pruned: %s (expired freeze)\n", name)
 	}
-	return &lf, nil
+	return true
 }
 
-type lockFile struct {
-	Version    int        `json:"version"`
-	Name       string     `json:"name"`
-	Owner      string     `json:"owner"`
-	Host       string     `json:"host"`
-	PID        int        `json:"pid"`
-	PIDStartNS int64      `json:"pid_start_ns,omitempty"`
-	AgentID    string     `json:"agent_id,omitempty"`
-	AcquiredAt time.Time  `json:"acquired_ts"`
-	TTLSec     int        `json:"ttl_sec,omitempty"`
-	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+// removeExpired removes the expired lock or freeze lf, read from path,
+// unless it has been renewed or replaced since (lockfile.RemoveIf).
+func removeExpired(path string, lf *lockfile.Lock) (bool, error) {
+	return lockfile.RemoveIf(path, func(aside string) bool {
+		current, err := lockfile.Read(aside)
+		return err == nil && current.IsExpired() && current.SameAcquisition(lf)
+	})
 }
 
 // statusOutput is the JSON structure for status --json output.
@@ -1030,156 +2417,360 @@ type statusOutput struct {
 	Host       string `json:"host"`
 	PID        int    `json:"pid"`
 	PIDStartNS int64  `json:"pid_start_ns,omitempty"`
+	LockID     string `json:"lock_id,omitempty"`
 	AgentID    string `json:"agent_id,omitempty"`
-	AcquiredAt string `json:"acquired_ts"`
-	TTLSec     int    `json:"ttl_sec,omitempty"`
-	ExpiresAt  string `json:"expires_at,omitempty"`
-	AgeSec     int    `json:"age_sec"`
-	Expired    bool   `json:"expired"`
-	PIDStatus  string `json:"pid_status"`
-	Freeze     bool   `json:"freeze,omitempty"`
+	// AgentExplicit: AgentID was set with LOKT_AGENT_ID.
+	AgentExplicit bool   `json:"agent_explicit,omitempty"`
+	AcquiredAt    string `json:"acquired_ts"`
+	RenewedAt     string `json:"renewed_ts,omitempty"` // the last renewal, if any
+	TTLSec        int    `json:"ttl_sec,omitempty"`
+	ExpiresAt     string `json:"expires_at,omitempty"`
+	RemainingSec  int    `json:"remaining_sec,omitempty"` // until expires_at, while unexpired
+	AgeSec        int    `json:"age_sec"`
+	Expired       bool   `json:"expired"`
+	PIDStatus     string `json:"pid_status"`
+	Freeze        bool   `json:"freeze,omitempty"`
+	Mode          string `json:"mode,omitempty"`
+	Flock         bool   `json:"flock,omitempty"`   // the holder keeps a flock on the lock file
+	Holders       int    `json:"holders,omitempty"` // shared holders of this name
+	SlotOf        string `json:"slot_of,omitempty"` // the name this lock is a slot of (guard --slots)
+	Slots         int    `json:"slots,omitempty"`   // that name's slot count
+	Global        bool   `json:"global,omitempty"`  // the global freeze (freeze --all)
+	Pattern       bool   `json:"pattern,omitempty"` // a pattern freeze (freeze --match); Name is the pattern
+	// StaleReason is a stale.Reason identifier, set when a lock in locks/ is
+	// stale.
+	StaleReason string            `json:"stale_reason,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Path        string            `json:"path,omitempty"` // the file a lock --for-path name stands for
+	// ActiveFreeze is the freeze on the name, in lokt status <name>.
+	ActiveFreeze *statusOutput `json:"active_freeze,omitempty"`
+	// Unsupported marks a file in a lockfile version this lokt can't read:
+	// only Name and Version are known.
+	Unsupported bool `json:"unsupported,omitempty"`
+	// Signature is "valid", "unsigned" or "bad" while lock file signing
+	// is on, and empty while it is off.
+	Signature string `json:"signature,omitempty"`
 }
 
-func lockToStatusOutput(lf *lockFile, isFreeze bool) statusOutput {
-	out := statusOutput{
-		Version:    lf.Version,
-		Name:       lf.Name,
-		Owner:      lf.Owner,
-		Host:       lf.Host,
-		PID:        lf.PID,
-		PIDStartNS: lf.PIDStartNS,
-		AgentID:    lf.AgentID,
-		AcquiredAt: lf.AcquiredAt.Format(time.RFC3339),
-		TTLSec:     lf.TTLSec,
-		AgeSec:     int(time.Since(lf.AcquiredAt).Seconds()),
-		Expired:    lf.IsExpired(),
-		PIDStatus:  pidLiveness(lf),
-	}
-	if lf.ExpiresAt != nil {
-		out.ExpiresAt = lf.ExpiresAt.Format(time.RFC3339)
+// Values of statusOutput.Signature.
+const (
+	signatureValid    = "valid"
+	signatureUnsigned = "unsigned"
+	signatureBad      = "bad"
+)
+
+// readStatusLock reads the lock or freeze file at path for status. A file
+// with a bad signature is read all the same, with bad set, so that status
+// flags it rather than skip it.
+func readStatusLock(path string) (lf *lockfile.Lock, bad bool, err error) {
+	lf, err = lockfile.Read(path)
+	if errors.Is(err, lockfile.ErrBadSignature) {
+		lf, err = lockfile.ReadWithOptions(path, lockfile.ReadOptions{NoVerify: true})
+		return lf, err == nil, err
 	}
-	if isFreeze {
-		out.Freeze = true
+	return lf, false, err
+}
+
+// signatureState returns the statusOutput.Signature of lf, read with bad
+// set by readStatusLock.
+func signatureState(lf *lockfile.Lock, bad bool) string {
+	switch {
+	case !lockfile.Signing():
+		return ""
+	case bad:
+		return signatureBad
+	case lf.Signature == "":
+		return signatureUnsigned
+	}
+	return signatureValid
+}
+
+// signatureTag is the status listing's flag for a signature state.
+func signatureTag(state string) string {
+	switch state {
+	case signatureUnsigned:
+		return " [UNSIGNED]"
+	case signatureBad:
+		return " [BAD SIGNATURE]"
 	}
-	return out
+	return ""
 }
 
-func (l *lockFile) IsExpired() bool {
-	if l.ExpiresAt != nil {
-		return time.Now().After(*l.ExpiresAt)
+// unsupportedStatus returns the status entry for the file at path, of the
+// lock or freeze name, if lockfile.Read failed on it with err because a
+// newer lokt wrote it. Status lists such files rather than skip them, so
+// that a lock held by a newer lokt isn't mistaken for a free one.
+func unsupportedStatus(path, name string, err error, isFreeze bool) (statusOutput, bool) {
+	if !errors.Is(err, lockfile.ErrUnsupportedVersion) {
+		return statusOutput{}, false
 	}
-	if l.TTLSec <= 0 {
-		return false
+	v, err := lockfile.ReadVersion(path)
+	if err != nil {
+		return statusOutput{}, false
 	}
-	return time.Since(l.AcquiredAt) > time.Duration(l.TTLSec)*time.Second
+	return statusOutput{Version: v, Name: name, PIDStatus: "unknown", Freeze: isFreeze, Unsupported: true}, true
 }
 
-func (l *lockFile) remaining() time.Duration {
-	if l.ExpiresAt != nil {
-		rem := time.Until(*l.ExpiresAt)
-		if rem < 0 {
-			return 0
-		}
-		return rem
+func lockToStatusOutput(lf *lockfile.Lock, isFreeze bool) statusOutput {
+	out := statusOutput{
+		Version:       lf.Version,
+		Name:          lf.Name,
+		Owner:         lf.Owner,
+		Host:          lf.Host,
+		PID:           lf.PID,
+		PIDStartNS:    lf.PIDStartNS,
+		LockID:        lf.LockID,
+		AgentID:       lf.AgentID,
+		AgentExplicit: lf.AgentExplicit,
+		AcquiredAt:    lf.AcquiredAt.Format(time.RFC3339),
+		TTLSec:        lf.TTLSec,
+		AgeSec:        int(lf.Age().Seconds()),
+		Expired:       lf.IsExpired(),
+		PIDStatus:     pidLiveness(lf),
+		Mode:          lf.Mode,
+		Flock:         lf.Flock,
+		Message:       lf.Message,
+		Labels:        lf.Labels,
+		Path:          lf.Path,
+	}
+	if lf.ExpiresAt != nil {
+		out.ExpiresAt = lf.ExpiresAt.Format(time.RFC3339)
+	} else if lf.TTLSec > 0 { // written before expires_at existed
+		out.ExpiresAt = lf.AcquiredAt.Add(time.Duration(lf.TTLSec) * time.Second).Format(time.RFC3339)
 	}
-	if l.TTLSec <= 0 {
-		return 0
+	if lf.RenewedAt != nil {
+		out.RenewedAt = lf.RenewedAt.Format(time.RFC3339)
 	}
-	rem := time.Duration(l.TTLSec)*time.Second - time.Since(l.AcquiredAt)
-	if rem < 0 {
-		return 0
+	out.Signature = signatureState(lf, false)
+	out.RemainingSec = int(lf.Remaining().Seconds())
+	if isFreeze {
+		out.Freeze = true
+		out.Global = lf.Name == lock.GlobalFreeze
+		out.Pattern = lf.Pattern
 	}
-	return rem
+	return out
 }
 
-func parseJSON(data []byte, v interface{}) error {
-	return json.Unmarshal(data, v)
+// lockStatusOutput is lockToStatusOutput for lf, the lock file at path in
+// locks/, with StaleReason set if a waiting acquire would break it.
+func lockStatusOutput(path string, lf *lockfile.Lock, grace time.Duration) statusOutput {
+	out := lockToStatusOutput(lf, false)
+	if result := stale.CheckFile(path, lf, grace); result.Stale {
+		out.StaleReason = string(result.Reason)
+	}
+	return out
 }
 
 // pidLiveness returns "alive", "dead", or "unknown" based on PID status.
-func pidLiveness(lock *lockFile) string {
+// A live PID whose start time differs from the one recorded in the lock
+// belongs to a different process, so the holder is reported dead.
+func pidLiveness(lf *lockfile.Lock) string {
 	hostname, err := os.Hostname()
-	if err != nil || hostname != lock.Host {
+	if err != nil || hostname != lf.Host {
 		return "unknown"
 	}
-	if stale.IsProcessAlive(lock.PID) {
-		return "alive"
+	if !stale.IsProcessAlive(lf.PID) {
+		return "dead"
 	}
-	return "dead"
+	if lf.PIDStartNS != 0 {
+		if start, err := stale.GetProcessStartTime(lf.PID); err == nil && start != lf.PIDStartNS {
+			return "dead"
+		}
+	}
+	return "alive"
 }
 
 func cmdFreeze(args []string) int {
 	fs := flag.NewFlagSet("freeze", flag.ExitOnError)
 	ttl := fs.Duration("ttl", 0, "Freeze duration (required, e.g., 15m, 1h)")
-	_ = fs.Parse(args)
-
-	if fs.NArg() < 1 {
-		fmt.Fprintln(os.Stderr, "usage: lokt freeze --ttl <duration> <name>")
+	until := fs.String("until", "", "End of the freeze, RFC 3339 (instead of --ttl)")
+	reason := fs.String("reason", "", "Why the name is frozen")
+	all := fs.Bool("all", false, "Freeze every name (global freeze)")
+	match := fs.String("match", "", "Freeze every name matching a glob pattern (e.g., 'deploy-*'), now and later")
+	waitIdleFlag := fs.Bool("wait-idle", false, "After freezing, wait until no one holds the lock")
+	timeout := fs.Duration("timeout", 0, "Maximum time to wait with --wait-idle (default: 10m)")
+	_ = fs.Parse(interspersed(fs, args))
+
+	if freezeTargets(fs.NArg(), *all, *match) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: lokt freeze --ttl <duration>|--until <time> [--reason <text>] [--wait-idle [--timeout d]] <name|--all|--match pattern>")
 		return ExitUsage
 	}
-	name := fs.Arg(0)
+	if *timeout < 0 {
+		fmt.Fprintln(os.Stderr, "error: --timeout must be positive (e.g., 5s, 1m)")
+		return ExitUsage
+	}
+	if flagGiven(fs, "timeout") && !*waitIdleFlag {
+		fmt.Fprintln(os.Stderr, "error: --timeout requires --wait-idle")
+		return ExitUsage
+	}
+	scope, what, code := freezeScopeOf(fs, *all, *match)
+	if code != ExitOK {
+		return code
+	}
+	name := scope.name
 
-	if *ttl <= 0 {
-		fmt.Fprintln(os.Stderr, "error: --ttl is required for freeze (e.g., --ttl 15m)")
+	var end time.Time
+	switch {
+	case *until != "" && flagGiven(fs, "ttl"):
+		fmt.Fprintln(os.Stderr, "error: --until and --ttl cannot be combined")
+		return ExitUsage
+	case *until != "":
+		var err error
+		if end, err = time.Parse(time.RFC3339, *until); err != nil {
+			fmt.Fprintf(os.Stderr, "error: --until %q is not an RFC 3339 time (e.g., 2026-02-01T06:00:00Z)\n", *until)
+			return ExitUsage
+		}
+		if !end.After(time.Now()) {
+			fmt.Fprintf(os.Stderr, "error: --until %s is in the past\n", *until)
+			return ExitUsage
+		}
+	case *ttl <= 0:
+		fmt.Fprintln(os.Stderr, "error: --ttl or --until is required for freeze (e.g., --ttl 15m)")
+		return ExitUsage
+	}
+	if n := utf8.RuneCountInString(*reason); n > lockfile.MaxMessageLen {
+		fmt.Fprintf(os.Stderr, "error: --reason is %d characters, at most %d allowed\n", n, lockfile.MaxMessageLen)
 		return ExitUsage
 	}
 
 	rootDir, err := root.Find()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		reportError(name, err, "")
 		return ExitError
 	}
+	if code := checkWritable(rootDir, name); code != ExitOK {
+		return code
+	}
 
-	auditor := audit.NewWriter(rootDir)
-	err = lock.Freeze(rootDir, name, lock.FreezeOptions{TTL: *ttl, Auditor: auditor})
+	freezeOpts := lokt.FreezeOptions{TTL: *ttl, Until: end, Reason: *reason}
+	if scope.match {
+		err = newClient(rootDir).FreezeMatch(name, freezeOpts)
+	} else {
+		err = newClient(rootDir).FreezeWith(name, freezeOpts)
+	}
 	if err != nil {
-		var held *lock.HeldError
-		if errors.As(err, &held) {
-			fmt.Fprintf(os.Stderr, "error: %v\n", held)
-			return ExitLockHeld
+		var held *lokt.HeldError
+		if errors.As(err, &held) { // someone else's freeze
+			reportError(name, err, "")
+			return exitFrozen()
 		}
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		reportError(name, err, "")
 		return ExitError
 	}
 
-	fmt.Printf("frozen %q for %s\n", name, *ttl)
+	if !end.IsZero() {
+		fmt.Printf("frozen %s until %s (%s)\n", what, end.UTC().Format(time.RFC3339), time.Until(end).Truncate(time.Second))
+	} else {
+		fmt.Printf("frozen %s for %s\n", what, *ttl)
+	}
+	if scope.match {
+		printMatching(rootDir, name)
+	}
+	if *waitIdleFlag {
+		return waitIdle(rootDir, scope, *timeout)
+	}
+	warnHolders(rootDir, scope)
 	return ExitOK
 }
 
+// freezeTargets counts the targets given to freeze or unfreeze: a name
+// argument, --all and --match. Exactly one is allowed.
+func freezeTargets(nargs int, all bool, match string) int {
+	n := 0
+	for _, given := range []bool{nargs > 0, all, match != ""} {
+		if given {
+			n++
+		}
+	}
+	return n
+}
+
+// freezeScopeOf returns the target of freeze or unfreeze fs, one of the
+// name argument, all and match, and how messages name it. A bad pattern
+// is reported, returning ExitUsage.
+func freezeScopeOf(fs *flag.FlagSet, all bool, match string) (freezeScope, string, int) {
+	switch {
+	case all:
+		return freezeScope{name: lokt.GlobalFreeze}, "all operations", ExitOK
+	case match != "":
+		if err := lockfile.ValidatePattern(match); err != nil {
+			fmt.Fprintf(os.Stderr, "error: --match: %v\n", err)
+			return freezeScope{}, "", ExitUsage
+		}
+		s := freezeScope{name: match, match: true}
+		return s, s.String(), ExitOK
+	}
+	return freezeScope{name: fs.Arg(0)}, strconv.Quote(fs.Arg(0)), ExitOK
+}
+
+// printMatching lists the names held now that a new pattern freeze on
+// pattern matches. Names locked later are frozen as well.
+func printMatching(rootDir, pattern string) {
+	names, err := lock.MatchingNames(rootDir, pattern)
+	switch {
+	case err != nil:
+		return // the freeze is in place; only the listing is lost
+	case len(names) == 0:
+		fmt.Println("no lock matches it now; any locked later is frozen")
+	default:
+		fmt.Printf("matches %d lock(s) now: %s\n", len(names), strings.Join(names, ", "))
+	}
+}
+
 func cmdUnfreeze(args []string) int {
 	fs := flag.NewFlagSet("unfreeze", flag.ExitOnError)
 	force := fs.Bool("force", false, "Remove freeze without ownership check (break-glass)")
+	all := fs.Bool("all", false, "Remove the global freeze")
+	match := fs.String("match", "", "Remove the pattern freeze placed with freeze --match")
 	_ = fs.Parse(args)
 
-	if fs.NArg() < 1 {
-		fmt.Fprintln(os.Stderr, "usage: lokt unfreeze [--force] <name>")
+	if freezeTargets(fs.NArg(), *all, *match) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: lokt unfreeze [--force] <name|--all|--match pattern>")
 		return ExitUsage
 	}
-	name := fs.Arg(0)
+	scope, what, code := freezeScopeOf(fs, *all, *match)
+	if code != ExitOK {
+		return code
+	}
+	name := scope.name
 
 	rootDir, err := root.Find()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		reportError(name, err, "")
 		return ExitError
 	}
+	if code := checkWritable(rootDir, name); code != ExitOK {
+		return code
+	}
 
-	auditor := audit.NewWriter(rootDir)
-	err = lock.Unfreeze(rootDir, name, lock.UnfreezeOptions{Force: *force, Auditor: auditor})
+	if scope.match {
+		err = newClient(rootDir).UnfreezeMatch(name, *force)
+	} else {
+		err = newClient(rootDir).Unfreeze(name, *force)
+	}
 	if err != nil {
-		if errors.Is(err, lock.ErrNotFound) {
-			fmt.Fprintf(os.Stderr, "error: freeze %q not found\n", name)
+		if errors.Is(err, lokt.ErrNotFound) {
+			msg := fmt.Sprintf("error: freeze %q not found", name)
+			switch {
+			case *all:
+				msg = "error: no global freeze is active"
+			case scope.match:
+				msg = fmt.Sprintf("error: no freeze on pattern %q (lokt freezes lists them)", name)
+			}
+			reportError(name, err, msg)
 			return ExitNotFound
 		}
-		var notOwner *lock.NotOwnerError
+		var notOwner *lokt.NotOwnerError
 		if errors.As(err, &notOwner) {
-			fmt.Fprintf(os.Stderr, "error: %v\n", notOwner)
+			reportError(name, err, "")
 			return ExitNotOwner
 		}
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		reportError(name, err, "")
 		return ExitError
 	}
 
-	fmt.Printf("unfrozen %q\n", name)
+	fmt.Printf("unfrozen %s\n", what)
 	return ExitOK
 }
 
@@ -1187,39 +2778,78 @@ func cmdAudit(args []string) int {
 	fs := flag.NewFlagSet("audit", flag.ExitOnError)
 	since := fs.String("since", "", "Show events since duration (1h, 30m) or timestamp (RFC3339)")
 	tail := fs.Bool("tail", false, "Follow audit log for new events (like tail -f)")
-	name := fs.String("name", "", "Filter by lock name")
+	name := fs.String("name", "", "Filter by lock name (comma-separated for several)")
+	event := fs.String("event", "", "Filter by event type, e.g. force-break,deny")
+	owner := fs.String("owner", "", "Filter by owner (comma-separated for several)")
+	format := fs.String("format", auditFormatJSONL, "Output format: jsonl, table or json")
+	jsonOutput := fs.Bool("json", false, "Output a JSON array (same as --format json)")
+	outputPath := fs.String("output", "", "Write matching events to file atomically (- for stdout)")
+	prune := fs.Bool("prune", false, "Delete rotated audit files older than --keep")
+	keep := fs.String("keep", "", "With --prune: age of the rotated files to keep (30d, 72h)")
 	_ = fs.Parse(args)
 
-	// Validate: --since and --tail are mutually exclusive
-	if *since != "" && *tail {
-		fmt.Fprintln(os.Stderr, "error: --since and --tail are mutually exclusive")
+	if *prune || *keep != "" {
+		if *since != "" || *tail {
+			fmt.Fprintln(os.Stderr, "error: --prune cannot be combined with --since or --tail")
+			return ExitUsage
+		}
+		return cmdAuditPrune(*prune, *keep)
+	}
+
+	if *tail && *outputPath != "" && *outputPath != "-" {
+		fmt.Fprintln(os.Stderr, "error: --output cannot be used with --tail")
 		return ExitUsage
 	}
+	if !slices.Contains(auditFormats, *format) {
+		fmt.Fprintf(os.Stderr, "error: unknown --format %q (want %s)\n", *format, strings.Join(auditFormats, ", "))
+		return ExitUsage
+	}
+	if *jsonOutput {
+		if *format != auditFormatJSONL && *format != auditFormatJSON {
+			fmt.Fprintln(os.Stderr, "error: --json cannot be combined with --format "+*format)
+			return ExitUsage
+		}
+		*format = auditFormatJSON
+	}
+	filter := auditFilter{names: splitList(*name), events: splitList(*event), owners: splitList(*owner)}
 
 	// Require at least one mode
 	if *since == "" && !*tail {
-		fmt.Fprintln(os.Stderr, "usage: lokt audit --since <duration|timestamp> [--name <lock>]")
-		fmt.Fprintln(os.Stderr, "       lokt audit --tail [--name <lock>]")
+		fmt.Fprintln(os.Stderr, "usage: lokt audit --since <duration|timestamp> [filters] [--format jsonl|table|json] [--output <path>]")
+		fmt.Fprintln(os.Stderr, "       lokt audit --tail [--since <duration|timestamp>] [filters] [--format jsonl|table]")
+		fmt.Fprintln(os.Stderr, "       lokt audit --prune --keep <age>")
 		fmt.Fprintln(os.Stderr, "")
 		fmt.Fprintln(os.Stderr, "  --since: query historical events")
 		fmt.Fprintln(os.Stderr, "    duration: 1h, 30m, 24h")
 		fmt.Fprintln(os.Stderr, "    timestamp: 2026-01-27T10:00:00Z (RFC3339)")
 		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintln(os.Stderr, "  --tail: follow log for new events (Ctrl+C to stop)")
+		fmt.Fprintln(os.Stderr, "  --tail: follow log for new events (Ctrl+C to stop); with --since, show those first")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "  filters: --name <lock,...> --event <type,...> --owner <owner,...>")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "  --prune: delete rotated audit files older than --keep (30d, 72h)")
 		return ExitUsage
 	}
 
-	// Handle tail mode
-	if *tail {
-		return cmdAuditTail(*name)
+	// Parse --since: try duration first, then RFC3339
+	if *since != "" {
+		sinceTime, err := parseSince(*since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid --since value %q: %v\n", *since, err)
+			fmt.Fprintln(os.Stderr, "  expected duration (1h, 30m) or RFC3339 timestamp")
+			return ExitUsage
+		}
+		filter.since = sinceTime
 	}
 
-	// Parse --since: try duration first, then RFC3339
-	sinceTime, err := parseSince(*since)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: invalid --since value %q: %v\n", *since, err)
-		fmt.Fprintln(os.Stderr, "  expected duration (1h, 30m) or RFC3339 timestamp")
-		return ExitUsage
+	// Handle tail mode
+	if *tail {
+		// A stream never ends, so there is no array to close: one JSON
+		// event per line, as stored.
+		if *format == auditFormatJSON {
+			*format = auditFormatJSONL
+		}
+		return cmdAuditTail(filter, *format)
 	}
 
 	rootDir, err := root.Find()
@@ -1228,70 +2858,75 @@ func cmdAudit(args []string) int {
 		return ExitError
 	}
 
-	auditPath := filepath.Join(rootDir, "audit.log")
-	f, err := os.Open(auditPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// No audit log yet - empty output is fine
-			return ExitOK
+	out := newOutputSink(*outputPath)
+	printer := &auditPrinter{w: out, format: *format}
+	err = audit.ScanAll(rootDir, filter.since, func(event *audit.Event, line []byte) bool {
+		if filter.match(event) {
+			printer.print(event, line)
 		}
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return true
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading audit log: %v\n", err)
 		return ExitError
 	}
-	defer func() { _ = f.Close() }()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
-		}
-
-		var event auditEvent
-		if err := json.Unmarshal(line, &event); err != nil {
-			// Skip malformed lines
-			continue
-		}
-
-		// Filter by time
-		if event.Timestamp.Before(sinceTime) {
-			continue
-		}
-
-		// Filter by name if specified
-		if *name != "" && event.Name != *name {
-			continue
-		}
+	printer.finish()
 
-		// Output matching event
-		fmt.Println(string(line))
+	return out.finish(ExitOK)
+}
+
+// cmdAuditPrune deletes rotated audit log files last written more than keep
+// ago. The live audit.log is never removed.
+func cmdAuditPrune(prune bool, keep string) int {
+	if !prune || keep == "" {
+		fmt.Fprintln(os.Stderr, "usage: lokt audit --prune --keep <age>")
+		return ExitUsage
+	}
+	age, err := parseAge(keep)
+	if err != nil || age <= 0 {
+		fmt.Fprintf(os.Stderr, "error: invalid --keep value %q: expected an age like 30d or 72h\n", keep)
+		return ExitUsage
 	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "error reading audit log: %v\n", err)
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		return ExitError
 	}
-
+	if code := checkWritable(rootDir, ""); code != ExitOK {
+		return code
+	}
+	removed, err := audit.Prune(rootDir, time.Now().Add(-age))
+	for _, path := range removed {
+		fmt.Printf("removed %s\n", filepath.Base(path))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: prune audit log: %v\n", err)
+		return ExitError
+	}
+	if len(removed) == 0 {
+		fmt.Println("no rotated audit files older than " + keep)
+	}
 	return ExitOK
 }
 
-// auditEvent is the JSON structure for audit log entries.
-type auditEvent struct {
-	Timestamp time.Time      `json:"ts"`
-	Event     string         `json:"event"`
-	Name      string         `json:"name"`
-	Owner     string         `json:"owner"`
-	Host      string         `json:"host"`
-	PID       int            `json:"pid"`
-	TTLSec    int            `json:"ttl_sec,omitempty"`
-	Extra     map[string]any `json:"extra,omitempty"`
+// parseAge parses a Go duration ("72h") or a number of days ("30d").
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
 }
 
-// parseSince parses a duration string (e.g., "1h", "30m") or RFC3339 timestamp.
-// Returns the time after which events should be shown.
+// parseSince parses a duration string (e.g., "1h", "30m", "7d") or RFC3339
+// timestamp. Returns the time after which events should be shown.
 func parseSince(s string) (time.Time, error) {
 	// Try duration first
-	if d, err := time.ParseDuration(s); err == nil {
+	if d, err := parseAge(s); err == nil {
 		return time.Now().Add(-d), nil
 	}
 
@@ -1303,10 +2938,11 @@ func parseSince(s string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("not a valid duration or RFC3339 timestamp")
 }
 
-// cmdAuditTail follows the audit log for new events (like tail -f).
+// cmdAuditTail follows the audit log for new events (like tail -f), after
+// printing those since filter.since if it is set.
 // It polls the file for new content and prints matching events.
 // Exits cleanly on SIGINT/SIGTERM.
-func cmdAuditTail(nameFilter string) int {
+func cmdAuditTail(filter auditFilter, format string) int {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
@@ -1316,23 +2952,67 @@ func cmdAuditTail(nameFilter string) int {
 		return ExitError
 	}
 
-	auditPath := filepath.Join(rootDir, "audit.log")
-	return tailAuditLog(ctx, auditPath, nameFilter)
+	if !filter.since.IsZero() {
+		return tailAuditLogSince(ctx, rootDir, filter, format)
+	}
+	return tailAuditLog(ctx, audit.Path(rootDir), filter, format)
 }
 
-// tailAuditLog implements the polling loop for following the audit log.
-// It handles file creation, truncation, and graceful shutdown.
-func tailAuditLog(ctx context.Context, path string, nameFilter string) int {
-	const pollInterval = 200 * time.Millisecond
+// tailAuditLogSince implements audit --since --tail: it prints the events
+// since filter.since, as a query would, then follows audit.log from
+// exactly where that read stopped, so no event written in between is
+// missed or printed twice.
+func tailAuditLogSince(ctx context.Context, rootDir string, filter auditFilter, format string) int {
+	printer := &auditPrinter{w: os.Stdout, format: format}
+	live, offset, err := audit.ScanAllFollow(rootDir, filter.since, func(event *audit.Event, line []byte) bool {
+		if filter.match(event) {
+			printer.print(event, line)
+		}
+		return true
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading audit log: %v\n", err)
+		return ExitError
+	}
+	// From here on every new event is shown, whatever the clock of the
+	// host that wrote it says
+	filter.since = time.Time{}
+	return followAuditLog(ctx, audit.Path(rootDir), live, offset, filter, printer)
+}
+
+// tailAuditLog follows the audit log from its current end, waiting for it
+// to be created if need be. Matching events are printed to stdout in format
+// (a streaming one; "" for jsonl).
+func tailAuditLog(ctx context.Context, path string, filter auditFilter, format string) int {
+	printer := &auditPrinter{w: os.Stdout, format: format}
+
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	var offset int64
+	if f != nil {
+		// Seek to end to start tailing from current position
+		if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			_ = f.Close()
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+	}
+	return followAuditLog(ctx, path, f, offset, filter, printer)
+}
 
-	var (
-		f      *os.File
-		offset int64
-		err    error
-	)
+// followAuditLog implements the polling loop for following the audit log
+// at path from offset in f, its open file; a nil f waits for the file to be
+// created and reads it from the start. It handles rotation, truncation
+// and graceful shutdown, and closes f.
+func followAuditLog(ctx context.Context, path string, f *os.File, offset int64, filter auditFilter, printer *auditPrinter) int {
+	const pollInterval = 200 * time.Millisecond
 
 	// Wait for file to exist
-	for {
+	for f == nil {
+		var err error
 		f, err = os.Open(path)
 		if err == nil {
 			break
@@ -1347,19 +3027,66 @@ func tailAuditLog(ctx context.Context, path string, nameFilter string) int {
 		case <-ctx.Done():
 			return ExitOK
 		case <-time.After(pollInterval):
-			continue
 		}
 	}
-	defer func() { _ = f.Close() }()
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
 
-	// Seek to end to start tailing from current position
-	offset, err = f.Seek(0, 2) // SEEK_END
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		return ExitError
+	reader := bufio.NewReader(f)
+
+	// drain prints the complete lines available from f. A line still
+	// being written is kept for the next call.
+	var partial []byte
+	drain := func() {
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				// No more data available
+				partial = append(partial, line...)
+				break
+			}
+			if len(partial) > 0 {
+				line = append(partial, line...)
+				partial = nil
+			}
+
+			offset += int64(len(line))
+
+			// Trim newline for processing
+			line = line[:len(line)-1]
+			if len(line) == 0 {
+				continue
+			}
+
+			var event audit.Event
+			if err := json.Unmarshal(line, &event); err != nil {
+				// Skip malformed lines
+				continue
+			}
+
+			if !filter.match(&event) {
+				continue
+			}
+			printer.print(&event, line)
+		}
 	}
 
-	reader := bufio.NewReader(f)
+	// reopen finishes the file being followed and switches to the one now
+	// at path, from its start; false if there is none yet.
+	reopen := func() bool {
+		drain()
+		nf, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		_ = f.Close()
+		f, offset, partial = nf, 0, nil
+		reader.Reset(f)
+		return true
+	}
 
 	// Main polling loop
 	for {
@@ -1369,27 +3096,19 @@ func tailAuditLog(ctx context.Context, path string, nameFilter string) int {
 		default:
 		}
 
-		// Check for file changes (truncation, deletion)
+		// Check for file changes (rotation, truncation, deletion)
 		stat, err := os.Stat(path)
 		if err != nil {
 			if os.IsNotExist(err) {
-				// File was deleted - wait for recreation
-				_ = f.Close()
-				f = nil
-
-				for {
+				// File was deleted or rotated away - finish what was
+				// written to it, then wait for recreation
+				drain()
+				for !reopen() {
 					select {
 					case <-ctx.Done():
 						return ExitOK
 					case <-time.After(pollInterval):
 					}
-
-					f, err = os.Open(path)
-					if err == nil {
-						offset = 0
-						reader = bufio.NewReader(f)
-						break
-					}
 				}
 				continue
 			}
@@ -1397,48 +3116,29 @@ func tailAuditLog(ctx context.Context, path string, nameFilter string) int {
 			return ExitError
 		}
 
-		// Detect truncation (file size decreased)
-		if stat.Size() < offset {
-			_, err = f.Seek(0, 0) // SEEK_SET
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error: %v\n", err)
-				return ExitError
-			}
-			offset = 0
-			reader.Reset(f)
-		}
-
-		// Read available lines
-		for {
-			line, err := reader.ReadBytes('\n')
-			if err != nil {
-				// No more data available
-				break
-			}
-
-			offset += int64(len(line))
-
-			// Trim newline for processing
-			line = line[:len(line)-1]
-			if len(line) == 0 {
-				continue
-			}
-
-			var event auditEvent
-			if err := json.Unmarshal(line, &event); err != nil {
-				// Skip malformed lines
+		// Detect rotation (path names a new file): finish the old file,
+		// then follow the new one from its start
+		if cur, err := f.Stat(); err == nil && !os.SameFile(cur, stat) {
+			if reopen() {
 				continue
 			}
+		}
 
-			// Apply name filter if specified
-			if nameFilter != "" && event.Name != nameFilter {
+		// A smaller file at path: truncated in place, or replaced by a new
+		// one that os.SameFile can't tell apart (a rotation where inode
+		// numbers aren't stable, as on some network filesystems). Either
+		// way what comes next is at the start of the file now at path;
+		// seeking back in the one open would replay the whole of it if it
+		// is the rotated-away log.
+		if stat.Size() < offset+int64(len(partial)) {
+			if !reopen() {
 				continue
 			}
-
-			// Output matching event
-			fmt.Println(string(line))
 		}
 
+		// Read available lines
+		drain()
+
 		// Wait before next poll
 		select {
 		case <-ctx.Done():
@@ -1463,7 +3163,7 @@ type whyReason struct {
 	FreezeAgeSec       int    `json:"freeze_age_sec,omitempty"`
 	FreezeRemainingSec int    `json:"freeze_remaining_sec,omitempty"`
 
-	// Lock holder fields (type=held, expired, dead_pid, self_held)
+	// Lock holder fields (type=held, expired, dead_pid, recycled_pid, self_held)
 	HolderOwner       string `json:"holder_owner,omitempty"`
 	HolderHost        string `json:"holder_host,omitempty"`
 	HolderPID         int    `json:"holder_pid,omitempty"`
@@ -1474,6 +3174,7 @@ type whyReason struct {
 	HolderExpired     bool   `json:"holder_expired,omitempty"`
 	HolderPIDStatus   string `json:"holder_pid_status,omitempty"`
 	HolderStaleReason string `json:"holder_stale_reason,omitempty"`
+	HolderStaleText   string `json:"holder_stale_reason_text,omitempty"`
 }
 
 // whyOutput is the JSON structure for why --json output.
@@ -1520,10 +3221,14 @@ func cmdWhy(args []string) int {
 	if freezeErr == nil && !freezeLock.IsExpired() {
 		age := freezeLock.Age().Truncate(time.Second)
 		remaining := freezeLock.Remaining()
+		message := fmt.Sprintf("Frozen by %s@%s for %s (%s remaining)", freezeLock.Owner, freezeLock.Host, age, remaining.Truncate(time.Second))
+		if freezeLock.Message != "" {
+			message += ": " + freezeLock.Message
+		}
 
 		reasons = append(reasons, whyReason{
 			Type:               "frozen",
-			Message:            fmt.Sprintf("Frozen by %s@%s for %s (%s remaining)", freezeLock.Owner, freezeLock.Host, age, remaining.Truncate(time.Second)),
+			Message:            message,
 			FreezeOwner:        freezeLock.Owner,
 			FreezeHost:         freezeLock.Host,
 			FreezePID:          freezeLock.PID,
@@ -1566,10 +3271,10 @@ func cmdWhy(args []string) int {
 		}
 		// Freeze exists but no regular lock — still blocked by freeze
 		lf = nil
-	case errors.Is(lockErr, lockfile.ErrCorrupted):
+	case lockfile.Broken(lockErr):
 		reasons = append(reasons, whyReason{
 			Type:    "corrupted",
-			Message: "Lock file contains invalid JSON",
+			Message: "Lock file isn't a valid lock: " + strings.TrimPrefix(lockErr.Error(), "corrupted lock file: "),
 		})
 		suggestions = append(suggestions,
 			fmt.Sprintf("lokt unlock --force %s  (remove corrupted lock)", name),
@@ -1583,7 +3288,7 @@ func cmdWhy(args []string) int {
 
 	if lf != nil {
 		age := lf.Age().Truncate(time.Second)
-		pidStatus := pidLivenessFromLock(lf)
+		pidStatus := pidLiveness(lf)
 
 		// Self-held check
 		isSelf := lf.Owner == me.Owner && lf.Host == me.Host && lf.PID == me.PID
@@ -1629,10 +3334,14 @@ func cmdWhy(args []string) int {
 					fmt.Sprintf("lokt unlock --break-stale %s", name),
 					fmt.Sprintf("lokt lock --wait %s  (auto-prunes expired locks)", name),
 				)
-			case staleResult.Stale && staleResult.Reason == stale.ReasonDeadPID:
-				reason.Type = "dead_pid"
-				reason.Message = fmt.Sprintf("Held by %s@%s (PID %d, dead) for %s", lf.Owner, lf.Host, lf.PID, age)
-				reason.HolderStaleReason = string(stale.ReasonDeadPID)
+			case staleResult.Stale && staleResult.Reason.HolderGone():
+				reason.Type = string(staleResult.Reason)
+				if staleResult.Reason == stale.ReasonRecycledPID {
+					reason.Message = fmt.Sprintf("Held by %s@%s (PID %d, reused by another process) for %s", lf.Owner, lf.Host, lf.PID, age)
+				} else {
+					reason.Message = fmt.Sprintf("Held by %s@%s (PID %d, dead) for %s", lf.Owner, lf.Host, lf.PID, age)
+				}
+				reason.HolderStaleReason = string(staleResult.Reason)
 				suggestions = append(suggestions,
 					fmt.Sprintf("lokt unlock --break-stale %s", name),
 					fmt.Sprintf("lokt lock --wait %s  (auto-prunes dead locks)", name),
@@ -1654,6 +3363,9 @@ func cmdWhy(args []string) int {
 					fmt.Sprintf("lokt unlock --force %s  (break-glass)", name),
 				)
 			}
+			if reason.HolderStaleReason != "" {
+				reason.HolderStaleText = stale.Reason(reason.HolderStaleReason).Description()
+			}
 			reasons = append(reasons, reason)
 		}
 	}
@@ -1716,7 +3428,7 @@ func whyPrintText(name string, reasons []whyReason, suggestions []string) {
 			fmt.Printf("    Age:   %s\n", time.Duration(r.HolderAgeSec)*time.Second)
 		case "corrupted":
 			fmt.Printf("  CORRUPTED lock file\n")
-			fmt.Printf("    Lock file contains invalid JSON\n")
+			fmt.Printf("    %s\n", r.Message)
 		default:
 			label := "HELD"
 			switch r.Type {
@@ -1754,32 +3466,33 @@ func whyPrintText(name string, reasons []whyReason, suggestions []string) {
 	}
 }
 
-// pidLivenessFromLock returns "alive", "dead", or "unknown" based on PID status.
-// Uses lockfile.Lock (from the lockfile package) instead of the local lockFile type.
-func pidLivenessFromLock(lf *lockfile.Lock) string {
-	hostname, err := os.Hostname()
-	if err != nil || hostname != lf.Host {
-		return "unknown"
-	}
-	if stale.IsProcessAlive(lf.PID) {
-		return "alive"
-	}
-	return "dead"
-}
-
 // doctorOutput is the JSON structure for doctor command output.
 type doctorOutput struct {
+	Schema          int                  `json:"schema"`
 	ProtocolVersion int                  `json:"protocol_version"`
 	RootMethod      string               `json:"root_method"`
 	RootPath        string               `json:"root_path"`
+	RootSkipped     []string             `json:"root_skipped,omitempty"` // system scope locations not usable
+	Identity        identityOutput       `json:"identity"`
 	Checks          []doctor.CheckResult `json:"checks"`
 	Overall         doctor.Status        `json:"overall"`
+	Fixed           []doctor.Fixed       `json:"fixed"` // repairs made by --fix
 }
 
 func cmdDoctor(args []string) int {
 	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
 	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	outputPath := fs.String("output", "", "Write report to file atomically (- for stdout)")
+	probeWebhooks := fs.Bool("probe-webhooks", false, "Send a HEAD request to every configured webhook URL")
+	fix := fs.Bool("fix", false, "Remove corrupted, empty and dead-holder lock files and move legacy freezes")
+	torture := fs.Bool("torture", false, "Run worker processes against a scratch lock and check they never overlap")
+	duration := fs.Duration("duration", 30*time.Second, "How long --torture runs")
+	procs := fs.Int("procs", 8, "How many --torture worker processes")
 	_ = fs.Parse(args)
+	if *duration <= 0 || *procs < 1 {
+		fmt.Fprintln(os.Stderr, "error: --duration and --procs must be positive")
+		return ExitUsage
+	}
 
 	// Discover root with method
 	rootPath, method, err := root.FindWithMethod()
@@ -1788,45 +3501,92 @@ func cmdDoctor(args []string) int {
 		return ExitError
 	}
 
+	// Repair first, so the checks report what is left
+	fixed := []doctor.Fixed{}
+	var fixErrs []error
+	if *fix {
+		if code := checkWritable(rootPath, ""); code != ExitOK {
+			return code
+		}
+		fixed, fixErrs = doctor.Fix(rootPath, doctor.ScanIntegrity(rootPath), newAuditor(rootPath))
+		if fixed == nil {
+			fixed = []doctor.Fixed{}
+		}
+	}
+
 	// Run all health checks
 	results := []doctor.CheckResult{
 		doctor.CheckWritable(rootPath),
-		doctor.CheckClock(),
+		checkRootAmbiguity(),
+		doctor.CheckClock(rootPath, skewGrace(rootPath)),
 		doctor.CheckLegacyFreezes(rootPath),
+		doctor.CheckVersions(rootPath),
+		checkSigning(rootPath),
+		doctor.CheckConfig(rootPath),
+		doctor.CheckPolicy(rootPath),
+		checkEventHook(rootPath),
+	}
+	results = append(results, doctor.CheckIntegrity(doctor.ScanIntegrity(rootPath))...)
+	if *probeWebhooks {
+		results = append(results, checkWebhooks(rootPath))
+	}
+	if *torture {
+		if code := checkWritable(rootPath, ""); code != ExitOK {
+			return code
+		}
+		results = append(results, runTorture(rootPath, *duration, *procs))
+	}
+	if len(fixErrs) > 0 {
+		results = append(results, doctor.CheckResult{Name: "fix", Status: doctor.StatusFail, Message: errors.Join(fixErrs...).Error()})
 	}
 
 	overall := doctor.Overall(results)
+	out := newOutputSink(*outputPath)
+	skipped := skippedSystemRoots(method)
 
 	if *jsonOutput {
 		output := doctorOutput{
+			Schema:          statusSchema,
 			ProtocolVersion: lockfile.CurrentLockfileVersion,
 			RootMethod:      method.String(),
 			RootPath:        rootPath,
+			RootSkipped:     skipped,
+			Identity:        currentIdentity(),
 			Checks:          results,
 			Overall:         overall,
+			Fixed:           fixed,
 		}
 		data, _ := json.MarshalIndent(output, "", "  ")
-		fmt.Println(string(data))
+		fmt.Fprintln(out, string(data))
 	} else {
 		// Text output
-		fmt.Println("lokt doctor")
-		fmt.Println()
-		fmt.Printf("Root:        %s (via %s)\n", filepath.Base(rootPath), methodDescription(method))
-		fmt.Printf("Path:        %s\n", rootPath)
-		fmt.Println()
-		fmt.Println("Checks:")
+		fmt.Fprintln(out, "lokt doctor")
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Root:        %s (via %s)\n", filepath.Base(rootPath), methodDescription(method))
+		fmt.Fprintf(out, "Path:        %s\n", rootPath)
+		id := currentIdentity()
+		fmt.Fprintf(out, "Identity:    %s@%s (%s)\n", id.Owner, id.Host, ownerOrigin(id))
+		for _, s := range skipped {
+			fmt.Fprintf(out, "Skipped:     %s\n", s)
+		}
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Checks:")
 		for _, r := range results {
-			printCheckResult(r)
+			printCheckResult(out, r)
 		}
-		fmt.Println()
-		fmt.Printf("Result: %s\n", overallDescription(overall))
+		if *fix {
+			fmt.Fprintln(out)
+			printFixed(out, fixed)
+		}
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Result: %s\n", overallDescription(overall))
 	}
 
 	// Exit code: 1 if any check failed, 0 otherwise (warnings don't fail)
 	if overall == doctor.StatusFail {
-		return ExitError
+		return out.finish(ExitError)
 	}
-	return ExitOK
+	return out.finish(ExitOK)
 }
 
 // methodDescription returns a human-readable description of the discovery method.
@@ -1838,13 +3598,20 @@ func methodDescription(m root.DiscoveryMethod) string {
 		return "git common dir"
 	case root.MethodLocalDir:
 		return ".lokt/ fallback"
+	case root.MethodUserScope:
+		return "user scope"
+	case root.MethodSystemScope:
+		if os.Getenv(root.EnvSystemRoot) != "" {
+			return "system scope, LOKT_SYSTEM_ROOT env"
+		}
+		return "system scope"
 	default:
 		return "unknown"
 	}
 }
 
 // printCheckResult prints a single check result in text format.
-func printCheckResult(r doctor.CheckResult) {
+func printCheckResult(w io.Writer, r doctor.CheckResult) {
 	var marker string
 	switch r.Status {
 	case doctor.StatusOK:
@@ -1857,18 +3624,51 @@ func printCheckResult(r doctor.CheckResult) {
 
 	// Map check names to display names
 	displayNames := map[string]string{
-		"writable":   "Directory writable",
-		"network_fs": "Network filesystem",
-		"clock":      "Clock sanity",
+		"writable":             "Directory writable",
+		"root_ambiguity":       "Root ambiguity",
+		"network_fs":           "Network filesystem",
+		"clock":                "Clock sanity",
+		"config":               "Config file",
+		"policy":               "Policy file",
+		"event_hook":           "Event hook",
+		"webhooks":             "Webhooks",
+		"legacy_freezes":       "Legacy freezes",
+		"lockfile_versions":    "Lockfile versions",
+		"signing":              "Lock file signing",
+		"corrupt_files":        "Corrupted files",
+		"empty_files":          "Empty files",
+		"unsupported_versions": "Unsupported versions",
+		"invalid_fields":       "Invalid fields",
+		"dead_pid_locks":       "Dead-holder locks",
+		"dangling_symlinks":    "Dangling symlinks",
+		"misplaced_locks":      "Misplaced locks",
+		"fix":                  "Repairs",
+		"torture":              "Multi-process torture",
 	}
 	displayName := displayNames[r.Name]
 	if displayName == "" {
 		displayName = r.Name
 	}
 
-	fmt.Printf("  %-6s %s\n", marker, displayName)
+	fmt.Fprintf(w, "  %-6s %s\n", marker, displayName)
 	if r.Message != "" {
-		fmt.Printf("         %s\n", r.Message)
+		fmt.Fprintf(w, "         %s\n", r.Message)
+	}
+}
+
+// printFixed lists the repairs made by doctor --fix.
+func printFixed(w io.Writer, fixed []doctor.Fixed) {
+	if len(fixed) == 0 {
+		fmt.Fprintln(w, "Fixed: nothing to repair")
+		return
+	}
+	fmt.Fprintln(w, "Fixed:")
+	for _, f := range fixed {
+		kind := "lock"
+		if f.Freeze {
+			kind = "freeze"
+		}
+		fmt.Fprintf(w, "  %s %s %s (%s: %s)\n", f.Action, kind, f.Name, f.Kind, f.Path)
 	}
 }
 
@@ -1893,6 +3693,31 @@ type guardedScript struct {
 	Path    string // relative path to the script (e.g., "./scripts/build.sh")
 	Lock    string // lock name from the guard invocation
 	Command string // the guarded command (everything after --)
+
+	// FromHistory marks entries found in the audit log rather than in a
+	// script. They have no Path, and Command is empty unless the acquire
+	// event recorded a cmdline.
+	FromHistory bool
+}
+
+// useThis returns the markdown for what an agent should run.
+func (s guardedScript) useThis() string {
+	if !s.FromHistory {
+		return "`" + s.Path + "`"
+	}
+	cmd := s.Command
+	if cmd == "" {
+		cmd = "<cmd>"
+	}
+	return "`lokt guard " + s.Lock + " -- " + cmd + "`"
+}
+
+// notThis returns the markdown for the raw command an agent should avoid.
+func (s guardedScript) notThis() string {
+	if s.Command == "" {
+		return "(previously used)"
+	}
+	return "`" + s.Command + "`"
 }
 
 // guardLineRegexp matches lines containing "lokt guard ... -- <command>".
@@ -1903,7 +3728,24 @@ var guardLineRegexp = regexp.MustCompile(`lokt\s+guard\s+(.+?)\s+--\s+(.+)`)
 func cmdPrime(args []string) int {
 	fs := flag.NewFlagSet("prime", flag.ExitOnError)
 	format := fs.String("format", "", "Output format: claude-md, cursorrules, windsurfrules, copilot, clinerules, aider")
+	noHistory := fs.Bool("no-history-discovery", false, "Don't add lock names found in the recent audit log")
+	jsonOutput := fs.Bool("json", false, "Output guarded operations and current status as JSON")
+	write := fs.Bool("write", false, "Install the --format snippet into its file in the project (without --format, update every installed one)")
+	check := fs.Bool("check", false, "Like --write, but only report files that are out of date (exit 1); change nothing")
 	_ = fs.Parse(args)
+	if *jsonOutput && *format != "" {
+		fmt.Fprintln(os.Stderr, "error: --json and --format are mutually exclusive")
+		return ExitUsage
+	}
+	if *write && *check || (*write || *check) && *jsonOutput {
+		fmt.Fprintln(os.Stderr, "error: --write, --check and --json are mutually exclusive")
+		return ExitUsage
+	}
+	if (*write || *check) && *format != "" && primeTargets[*format].path == "" {
+		fmt.Fprintf(os.Stderr, "error: unknown format %q\n", *format)
+		fmt.Fprintf(os.Stderr, "supported formats: %s\n", strings.Join(primeFormats, ", "))
+		return ExitUsage
+	}
 
 	rootDir, err := root.Find()
 	if err != nil {
@@ -1912,12 +3754,23 @@ func cmdPrime(args []string) int {
 		return ExitError
 	}
 
+	if *write || *check {
+		return cmdPrimeWrite(rootDir, *format, *check)
+	}
+
 	me := identity.Current()
 	scripts := discoverGuardedScripts(rootDir)
+	if !*noHistory {
+		scripts = append(scripts, discoverHistoryLocks(rootDir, scripts, time.Now())...)
+	}
 	locks := scanCurrentLocks(rootDir)
 
 	if *format != "" {
-		return renderFormat(*format, scripts, me)
+		return renderFormat(os.Stdout, *format, scripts, me)
+	}
+	if *jsonOutput {
+		renderPrimeJSON(scripts, locks, me)
+		return ExitOK
 	}
 
 	// Default: dynamic markdown for hook injection
@@ -1940,7 +3793,7 @@ func renderDefaultPrime(scripts []guardedScript, locks []primeLockInfo, me ident
 		fmt.Println("| Operation | Use this | NOT this |")
 		fmt.Println("|-----------|----------|----------|")
 		for _, s := range scripts {
-			fmt.Printf("| %s | `%s` | `%s` |\n", s.Lock, s.Path, s.Command)
+			fmt.Printf("| %s | %s | %s |\n", s.Lock, s.useThis(), s.notThis())
 		}
 	} else {
 		fmt.Println("## Guarded Operations")
@@ -1948,7 +3801,7 @@ func renderDefaultPrime(scripts []guardedScript, locks []primeLockInfo, me ident
 		fmt.Println("No wrapper scripts detected. Wrap mutating commands with `lokt guard`:")
 		fmt.Println()
 		fmt.Println("    lokt guard build --ttl 5m -- make build")
-		fmt.Println("    lokt guard git-push --ttl 2m -- git pull --rebase && git push")
+		fmt.Println("    lokt guard git-push --ttl 2m --shell -- 'git pull --rebase && git push'")
 	}
 	fmt.Println()
 
@@ -1956,6 +3809,7 @@ func renderDefaultPrime(scripts []guardedScript, locks []primeLockInfo, me ident
 	fmt.Println("## If a command fails with \"lock held by another\"")
 	fmt.Println()
 	fmt.Println("Another agent is running the same operation. Do NOT retry immediately.")
+	fmt.Println("- The error says when to try again (\"try again in ~4m\"; `retry_after_sec` in --json output). Wait at least that long")
 	fmt.Println("- If the task can wait: move to other work and come back later")
 	fmt.Println("- If urgent: tell the user the resource is locked")
 	fmt.Println()
@@ -1986,153 +3840,230 @@ func renderDefaultPrime(scripts []guardedScript, locks []primeLockInfo, me ident
 			}
 			if l.Expired {
 				status += " [EXPIRED]"
+			} else if l.Eval.Outlook == lock.OutlookReclaimable {
+				status += " [DEAD]"
 			}
-			fmt.Printf("- **%s** held by %s@%s for %s%s\n", l.Name, l.Owner, l.Host, l.Age, status)
+			if !l.needsAdvice() {
+				fmt.Printf("- **%s** held by %s@%s for %s%s\n", l.Name, l.Owner, l.Host, l.Age, status)
+				continue
+			}
+			fmt.Printf("- **%s** held by %s@%s for %s%s — %s\n", l.Name, l.Owner, l.Host, l.Age, status, l.Eval.Outlook.Description())
+			fmt.Printf("  - %s\n", l.advice(scripts))
+		}
+	}
+}
+
+// primeJSON is the output of prime --json.
+type primeJSON struct {
+	Owner   string             `json:"owner"`
+	Host    string             `json:"host"`
+	Guarded []primeGuardedJSON `json:"guarded"`
+	Locks   []primeLockJSON    `json:"locks"`
+}
+
+type primeGuardedJSON struct {
+	Lock    string `json:"lock"`
+	Path    string `json:"path,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+type primeLockJSON struct {
+	Name           string `json:"name"`
+	Owner          string `json:"owner"`
+	Host           string `json:"host"`
+	Age            string `json:"age"`
+	Expired        bool   `json:"expired"`
+	Freeze         bool   `json:"freeze,omitempty"`
+	Outlook        string `json:"outlook,omitempty"` // lock.Outlook; regular locks only
+	Reason         string `json:"reason,omitempty"`
+	RetryAfterSec  int    `json:"retry_after_sec,omitempty"`
+	Recommendation string `json:"recommendation,omitempty"`
+}
+
+func renderPrimeJSON(scripts []guardedScript, locks []primeLockInfo, me identity.Identity) {
+	out := primeJSON{Owner: me.Owner, Host: me.Host, Guarded: []primeGuardedJSON{}, Locks: []primeLockJSON{}}
+	for _, s := range scripts {
+		out.Guarded = append(out.Guarded, primeGuardedJSON{Lock: s.Lock, Path: s.Path, Command: s.Command})
+	}
+	for _, l := range locks {
+		j := primeLockJSON{
+			Name: l.Name, Owner: l.Owner, Host: l.Host, Age: l.Age,
+			Expired: l.Expired, Freeze: l.Freeze,
+			Outlook:       string(l.Eval.Outlook),
+			Reason:        string(l.Eval.Reason),
+			RetryAfterSec: int(l.Eval.RetryAfter.Seconds()),
 		}
+		if l.needsAdvice() {
+			j.Recommendation = l.advice(scripts)
+		}
+		out.Locks = append(out.Locks, j)
 	}
+	data, _ := json.MarshalIndent(out, "", "  ")
+	fmt.Println(string(data))
 }
 
-// renderFormat outputs a static snippet for a specific agent tool config file.
-func renderFormat(format string, scripts []guardedScript, me identity.Identity) int {
+// renderFormat writes a static snippet for a specific agent tool config file.
+func renderFormat(w io.Writer, format string, scripts []guardedScript, me identity.Identity) int {
 	switch format {
 	case "claude-md":
-		renderClaudeMD(scripts, me)
+		renderClaudeMD(w, scripts, me)
 	case "cursorrules":
-		renderCursorRules(scripts, me)
+		renderCursorRules(w, scripts, me)
 	case "windsurfrules":
-		renderWindsurfRules(scripts, me)
+		renderWindsurfRules(w, scripts, me)
 	case "copilot":
-		renderCopilot(scripts, me)
+		renderCopilot(w, scripts, me)
 	case "clinerules":
-		renderClineRules(scripts, me)
+		renderClineRules(w, scripts, me)
 	case "aider":
-		renderAider(scripts)
+		renderAider(w, scripts)
 	default:
 		fmt.Fprintf(os.Stderr, "error: unknown format %q\n", format)
-		fmt.Fprintln(os.Stderr, "supported formats: claude-md, cursorrules, windsurfrules, copilot, clinerules, aider")
+		fmt.Fprintf(os.Stderr, "supported formats: %s\n", strings.Join(primeFormats, ", "))
 		return ExitUsage
 	}
 	return ExitOK
 }
 
-func renderClaudeMD(scripts []guardedScript, me identity.Identity) {
-	fmt.Println("## Concurrent Operations (Lokt)")
-	fmt.Println()
-	fmt.Println("This project uses lokt for lock coordination. Multiple agents work in this repo.")
-	fmt.Println()
-	renderScriptTable(scripts)
-	fmt.Println()
-	fmt.Println("### If a command fails with \"lock held by another\"")
-	fmt.Println()
-	fmt.Println("Another agent is running the same operation. Do NOT retry immediately.")
-	fmt.Println("- If the task can wait: move to other work and come back later")
-	fmt.Println("- If urgent: inform the user that the resource is locked")
-	fmt.Println()
-	fmt.Println("### Lock diagnostics")
-	fmt.Println()
-	fmt.Println("- `lokt status` — see who holds what")
-	fmt.Println("- `lokt why <name>` — explain why a lock can't be acquired")
+func renderClaudeMD(w io.Writer, scripts []guardedScript, me identity.Identity) {
+	fmt.Fprintln(w, "## Concurrent Operations (Lokt)")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "This project uses lokt for lock coordination. Multiple agents work in this repo.")
+	fmt.Fprintln(w)
+	renderScriptTable(w, scripts)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "### If a command fails with \"lock held by another\"")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Another agent is running the same operation. Do NOT retry immediately.")
+	fmt.Fprintln(w, "- The error says when to try again (\"try again in ~4m\"; `retry_after_sec` in --json output). Wait at least that long")
+	fmt.Fprintln(w, "- If the task can wait: move to other work and come back later")
+	fmt.Fprintln(w, "- If urgent: inform the user that the resource is locked")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "### Lock diagnostics")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "- `lokt status` — see who holds what")
+	fmt.Fprintln(w, "- `lokt why <name>` — explain why a lock can't be acquired")
 }
 
-func renderCursorRules(scripts []guardedScript, me identity.Identity) {
-	fmt.Println("# Lokt Lock Coordination")
-	fmt.Println()
-	fmt.Println("This project uses lokt for lock coordination. Multiple agents share this workspace.")
-	fmt.Println()
+func renderCursorRules(w io.Writer, scripts []guardedScript, me identity.Identity) {
+	fmt.Fprintln(w, "# Lokt Lock Coordination")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "This project uses lokt for lock coordination. Multiple agents share this workspace.")
+	fmt.Fprintln(w)
 	if len(scripts) > 0 {
-		fmt.Println("MANDATORY: Use wrapper scripts for all mutating shared operations:")
+		fmt.Fprintln(w, "MANDATORY: Use wrapper scripts for all mutating shared operations:")
 		for _, s := range scripts {
-			fmt.Printf("- ALWAYS use `%s` instead of `%s`\n", s.Path, s.Command)
+			if s.Command == "" {
+				fmt.Fprintf(w, "- ALWAYS use %s for %s operations\n", s.useThis(), s.Lock)
+				continue
+			}
+			fmt.Fprintf(w, "- ALWAYS use %s instead of %s\n", s.useThis(), s.notThis())
 		}
 	} else {
-		fmt.Println("MANDATORY: Wrap mutating shared operations with `lokt guard`:")
-		fmt.Println("- `lokt guard build --ttl 5m -- make build`")
-		fmt.Println("- `lokt guard git-push --ttl 2m -- git pull --rebase && git push`")
-	}
-	fmt.Println()
-	fmt.Println("If a command fails with \"lock held by another\", do NOT retry immediately.")
-	fmt.Println("Move to other work and come back later, or tell the user the resource is locked.")
-	fmt.Println()
-	fmt.Println("Lock diagnostics: `lokt status` or `lokt why <name>`")
+		fmt.Fprintln(w, "MANDATORY: Wrap mutating shared operations with `lokt guard`:")
+		fmt.Fprintln(w, "- `lokt guard build --ttl 5m -- make build`")
+		fmt.Fprintln(w, "- `lokt guard git-push --ttl 2m --shell -- 'git pull --rebase && git push'`")
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "If a command fails with \"lock held by another\", do NOT retry immediately.")
+	fmt.Fprintln(w, "Wait at least as long as the error's \"try again in\" hint (`retry_after_sec` in --json output).")
+	fmt.Fprintln(w, "Move to other work and come back later, or tell the user the resource is locked.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Lock diagnostics: `lokt status` or `lokt why <name>`")
 }
 
-func renderWindsurfRules(scripts []guardedScript, _ identity.Identity) {
+func renderWindsurfRules(w io.Writer, scripts []guardedScript, _ identity.Identity) {
 	// Ultra-compact: must stay well under 2000 chars to leave room for other rules
-	fmt.Println("# Lokt Lock Coordination")
-	fmt.Println()
+	fmt.Fprintln(w, "# Lokt Lock Coordination")
+	fmt.Fprintln(w)
 	if len(scripts) > 0 {
-		fmt.Println("Use wrapper scripts, not raw commands:")
+		fmt.Fprintln(w, "Use wrapper scripts, not raw commands:")
 		for _, s := range scripts {
-			fmt.Printf("- `%s` (not `%s`)\n", s.Path, s.Command)
+			if s.Command == "" {
+				fmt.Fprintf(w, "- %s\n", s.useThis())
+				continue
+			}
+			fmt.Fprintf(w, "- %s (not %s)\n", s.useThis(), s.notThis())
 		}
 	} else {
-		fmt.Println("Wrap mutating commands: `lokt guard <name> --ttl 5m -- <cmd>`")
+		fmt.Fprintln(w, "Wrap mutating commands: `lokt guard <name> --ttl 5m -- <cmd>`")
 	}
-	fmt.Println()
-	fmt.Println("If \"lock held by another\": move to other work, do not retry.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "If \"lock held by another\": move to other work; retry only after the \"try again in\" hint.")
 }
 
-func renderCopilot(scripts []guardedScript, me identity.Identity) {
+func renderCopilot(w io.Writer, scripts []guardedScript, me identity.Identity) {
 	// Same structure as claude-md, GitHub Copilot uses markdown
-	renderClaudeMD(scripts, me)
+	renderClaudeMD(w, scripts, me)
 }
 
-func renderClineRules(scripts []guardedScript, me identity.Identity) {
-	fmt.Println("---")
-	fmt.Println("description: Lokt lock coordination rules")
-	fmt.Println("---")
-	fmt.Println()
-	fmt.Println("# Lokt Lock Coordination")
-	fmt.Println()
-	fmt.Println("This project uses lokt for lock coordination. Multiple agents share this workspace.")
-	fmt.Println()
-	renderScriptTable(scripts)
-	fmt.Println()
-	fmt.Println("If a command fails with \"lock held by another\", do NOT retry immediately.")
-	fmt.Println("Move to other work and come back later, or tell the user the resource is locked.")
-	fmt.Println()
-	fmt.Println("Lock diagnostics: `lokt status` or `lokt why <name>`")
+func renderClineRules(w io.Writer, scripts []guardedScript, me identity.Identity) {
+	fmt.Fprintln(w, "---")
+	fmt.Fprintln(w, "description: Lokt lock coordination rules")
+	fmt.Fprintln(w, "---")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "# Lokt Lock Coordination")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "This project uses lokt for lock coordination. Multiple agents share this workspace.")
+	fmt.Fprintln(w)
+	renderScriptTable(w, scripts)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "If a command fails with \"lock held by another\", do NOT retry immediately.")
+	fmt.Fprintln(w, "Wait at least as long as the error's \"try again in\" hint (`retry_after_sec` in --json output).")
+	fmt.Fprintln(w, "Move to other work and come back later, or tell the user the resource is locked.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Lock diagnostics: `lokt status` or `lokt why <name>`")
 }
 
-func renderAider(scripts []guardedScript) {
+func renderAider(w io.Writer, scripts []guardedScript) {
 	// YAML format for .aider.conf.yml
 	if len(scripts) > 0 {
-		fmt.Println("# Lokt lock coordination - use wrapper scripts")
+		fmt.Fprintln(w, "# Lokt lock coordination - use wrapper scripts")
 		for _, s := range scripts {
+			if s.FromHistory {
+				continue // no wrapper script to point lint-cmd/test-cmd at
+			}
 			// Aider only supports lint-cmd and test-cmd, map what we can
 			switch {
 			case strings.Contains(s.Lock, "lint") || strings.Contains(s.Lock, "fmt"):
-				fmt.Printf("lint-cmd: %s\n", s.Path)
+				fmt.Fprintf(w, "lint-cmd: %s\n", s.Path)
 			case strings.Contains(s.Lock, "test"):
-				fmt.Printf("test-cmd: %s\n", s.Path)
+				fmt.Fprintf(w, "test-cmd: %s\n", s.Path)
 			}
 		}
-		fmt.Println()
-		fmt.Println("# Other guarded operations (use in terminal):")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "# Other guarded operations (use in terminal):")
 		for _, s := range scripts {
-			fmt.Printf("# %s -> %s\n", s.Command, s.Path)
+			switch {
+			case !s.FromHistory:
+				fmt.Fprintf(w, "# %s -> %s\n", s.Command, s.Path)
+			case s.Command != "":
+				fmt.Fprintf(w, "# %s -> lokt guard %s -- %s\n", s.Command, s.Lock, s.Command)
+			default:
+				fmt.Fprintf(w, "# %s -> lokt guard %s -- <cmd> (previously used)\n", s.Lock, s.Lock)
+			}
 		}
 	} else {
-		fmt.Println("# Lokt lock coordination")
-		fmt.Println("# Wrap mutating commands with: lokt guard <name> --ttl 5m -- <cmd>")
+		fmt.Fprintln(w, "# Lokt lock coordination")
+		fmt.Fprintln(w, "# Wrap mutating commands with: lokt guard <name> --ttl 5m -- <cmd>")
 	}
 }
 
-// renderScriptTable outputs a markdown table of wrapper scripts.
-func renderScriptTable(scripts []guardedScript) {
+// renderScriptTable writes a markdown table of wrapper scripts.
+func renderScriptTable(w io.Writer, scripts []guardedScript) {
 	if len(scripts) > 0 {
-		fmt.Println("### MANDATORY: Use wrapper scripts, not raw commands")
-		fmt.Println()
-		fmt.Println("| Operation | Use this | NOT this |")
-		fmt.Println("|-----------|----------|----------|")
+		fmt.Fprintln(w, "### MANDATORY: Use wrapper scripts, not raw commands")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "| Operation | Use this | NOT this |")
+		fmt.Fprintln(w, "|-----------|----------|----------|")
 		for _, s := range scripts {
-			fmt.Printf("| %s | `%s` | `%s` |\n", s.Lock, s.Path, s.Command)
+			fmt.Fprintf(w, "| %s | %s | %s |\n", s.Lock, s.useThis(), s.notThis())
 		}
 	} else {
-		fmt.Println("### Wrap mutating commands with lokt guard")
-		fmt.Println()
-		fmt.Println("    lokt guard build --ttl 5m -- make build")
-		fmt.Println("    lokt guard git-push --ttl 2m -- git pull --rebase && git push")
+		fmt.Fprintln(w, "### Wrap mutating commands with lokt guard")
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "    lokt guard build --ttl 5m -- make build")
+		fmt.Fprintln(w, "    lokt guard git-push --ttl 2m --shell -- 'git pull --rebase && git push'")
 	}
 }
 
@@ -2176,6 +4107,64 @@ func discoverGuardedScripts(rootDir string) []guardedScript {
 	return scripts
 }
 
+// History discovery bounds: only recent acquisitions count, and the table
+// stays short enough to read.
+const (
+	historyDiscoveryWindow = 7 * 24 * time.Hour
+	historyDiscoveryMax    = 10
+)
+
+// discoverHistoryLocks returns lock names acquired in the last
+// historyDiscoveryWindow that no script in known already covers, most
+// recently used first. This catches guards run from Makefiles, package.json
+// or CI config, which the script scanner doesn't parse. The command comes
+// from the acquire event's cmdline extra when present.
+func discoverHistoryLocks(rootDir string, known []guardedScript, now time.Time) []guardedScript {
+	seen := make(map[string]bool, len(known))
+	for _, s := range known {
+		seen[s.Lock] = true
+	}
+
+	since := now.Add(-historyDiscoveryWindow)
+	lastUsed := make(map[string]time.Time)
+	cmdlines := make(map[string]string)
+	_ = audit.ScanAll(rootDir, since, func(e *audit.Event, _ []byte) bool {
+		if e.Event != audit.EventAcquire || e.Timestamp.Before(since) || seen[e.Name] {
+			return true
+		}
+		if lockfile.ValidateName(e.Name) != nil {
+			return true
+		}
+		if !e.Timestamp.Before(lastUsed[e.Name]) {
+			lastUsed[e.Name] = e.Timestamp
+			if cmd, ok := e.Extra["cmdline"].(string); ok && cmd != "" {
+				cmdlines[e.Name] = cmd
+			}
+		}
+		return true
+	})
+
+	found := make([]guardedScript, 0, len(lastUsed))
+	for name := range lastUsed {
+		cmd := cmdlines[name]
+		if r := []rune(cmd); len(r) > 60 {
+			cmd = string(r[:57]) + "..."
+		}
+		found = append(found, guardedScript{Lock: name, Command: cmd, FromHistory: true})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		ti, tj := lastUsed[found[i].Lock], lastUsed[found[j].Lock]
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return found[i].Lock < found[j].Lock
+	})
+	if len(found) > historyDiscoveryMax {
+		found = found[:historyDiscoveryMax]
+	}
+	return found
+}
+
 // findProjectRoot determines the project root from the lokt root directory.
 func findProjectRoot(rootDir string) string {
 	// If rootDir is .git/lokt/, project root is two levels up
@@ -2243,10 +4232,14 @@ func parseGuardedScript(path, projectRoot string) []guardedScript {
 
 // extractLockName finds the lock name from guard arguments.
 // The lock name is the first token that is not a flag (--xxx) and not a flag value.
-// Flags that take values: --ttl, --timeout.
+// Flags that take values: --ttl, --timeout, --poll-min, --poll-max,
+// --message (-m), --label.
 func extractLockName(args string) string {
 	tokens := strings.Fields(args)
-	flagsWithValue := map[string]bool{"--ttl": true, "--timeout": true}
+	flagsWithValue := map[string]bool{
+		"--ttl": true, "--timeout": true, "--poll-min": true, "--poll-max": true,
+		"--message": true, "-m": true, "--label": true,
+	}
 	skipNext := false
 
 	for _, tok := range tokens {
@@ -2279,59 +4272,76 @@ type primeLockInfo struct {
 	Age     string
 	Expired bool
 	Freeze  bool
+
+	// Eval predicts what acquiring the name would do; regular locks only.
+	Eval lock.Evaluation
+}
+
+// needsAdvice reports whether the entry is expired or its holder dead, so
+// agents get a recommendation rather than just a marker.
+func (l primeLockInfo) needsAdvice() bool {
+	return !l.Freeze && l.Eval.Outlook != "" && l.Eval.Outlook != lock.OutlookHeld
+}
+
+// advice is the recommendation line for an entry that needsAdvice: run the
+// guarded operation now, or when to try again.
+func (l primeLockInfo) advice(scripts []guardedScript) string {
+	if l.Eval.Outlook != lock.OutlookReclaimable {
+		return lock.FormatRetryAfter(l.Eval.RetryAfter)
+	}
+	run := "`lokt guard " + l.Name + " -- <cmd>`"
+	for _, s := range scripts {
+		if s.Lock == l.Name {
+			run = s.useThis()
+			break
+		}
+	}
+	return "safe to run " + run + " now"
 }
 
 func scanCurrentLocks(rootDir string) []primeLockInfo {
 	var locks []primeLockInfo
+	var retryDefault time.Duration
+	if cfg, err := config.Load(rootDir); err == nil {
+		retryDefault = time.Duration(cfg.RetryAfterDefault)
+	}
 
 	// Scan regular locks
-	locksDir := root.LocksPath(rootDir)
-	lockEntries, _ := os.ReadDir(locksDir)
-	for _, entry := range lockEntries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		if len(name) > 5 && name[len(name)-5:] == ".json" {
-			lockName := name[:len(name)-5]
-			path := root.LockFilePath(rootDir, lockName)
-			lf, err := readLockFile(path)
-			if err == nil {
-				age := time.Since(lf.AcquiredAt).Truncate(time.Second)
-				locks = append(locks, primeLockInfo{
-					Name:    lockName,
-					Owner:   lf.Owner,
-					Host:    lf.Host,
-					Age:     age.String(),
-					Expired: lf.IsExpired(),
-				})
-			}
+	lockNames, _ := root.LockNames(rootDir)
+	for _, lockName := range lockNames {
+		path := root.LockFilePath(rootDir, lockName)
+		lf, err := lockfile.Read(path)
+		if err == nil {
+			age := lf.Age().Truncate(time.Second)
+			locks = append(locks, primeLockInfo{
+				Name:    lockName,
+				Owner:   lf.Owner,
+				Host:    lf.Host,
+				Age:     age.String(),
+				Expired: lf.IsExpired(),
+				Eval:    lock.EvaluateLock(lf, retryDefault),
+			})
 		}
 	}
 
 	// Scan freezes
-	freezesDir := root.FreezesPath(rootDir)
-	freezeEntries, _ := os.ReadDir(freezesDir)
-	for _, entry := range freezeEntries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		if len(name) > 5 && name[len(name)-5:] == ".json" {
-			freezeName := name[:len(name)-5]
-			path := root.FreezeFilePath(rootDir, freezeName)
-			lf, err := readLockFile(path)
-			if err == nil {
-				age := time.Since(lf.AcquiredAt).Truncate(time.Second)
-				locks = append(locks, primeLockInfo{
-					Name:    freezeName,
-					Owner:   lf.Owner,
-					Host:    lf.Host,
-					Age:     age.String(),
-					Expired: lf.IsExpired(),
-					Freeze:  true,
-				})
+	freezeNames, _ := root.Names(root.FreezesPath(rootDir))
+	for _, freezeName := range freezeNames {
+		path := root.FreezeFilePath(rootDir, freezeName)
+		lf, err := lockfile.Read(path)
+		if err == nil {
+			if lf.Pattern {
+				freezeName = lf.Name // not the file of the pattern under _patterns/
 			}
+			age := lf.Age().Truncate(time.Second)
+			locks = append(locks, primeLockInfo{
+				Name:    freezeName,
+				Owner:   lf.Owner,
+				Host:    lf.Host,
+				Age:     age.String(),
+				Expired: lf.IsExpired(),
+				Freeze:  true,
+			})
 		}
 	}
 
@@ -11,6 +11,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
 )
 
 func TestTailAuditLog_OutputsNewEvents(t *testing.T) {
@@ -35,14 +37,14 @@ func TestTailAuditLog_OutputsNewEvents(t *testing.T) {
 
 	done := make(chan int)
 	go func() {
-		done <- tailAuditLog(ctx, auditPath, "")
+		done <- tailAuditLog(ctx, auditPath, auditFilter{}, "")
 	}()
 
 	// Give tailer time to start and seek to end
 	time.Sleep(50 * time.Millisecond)
 
 	// Write an event
-	event := auditEvent{
+	event := audit.Event{
 		Timestamp: time.Now(),
 		Event:     "acquire",
 		Name:      "test-lock",
@@ -94,13 +96,13 @@ func TestTailAuditLog_NameFilter(t *testing.T) {
 
 	done := make(chan int)
 	go func() {
-		done <- tailAuditLog(ctx, auditPath, "wanted-lock")
+		done <- tailAuditLog(ctx, auditPath, auditFilter{names: []string{"wanted-lock"}}, "")
 	}()
 
 	time.Sleep(50 * time.Millisecond)
 
 	// Write two events: one matching filter, one not
-	events := []auditEvent{
+	events := []audit.Event{
 		{Timestamp: time.Now(), Event: "acquire", Name: "unwanted-lock", Owner: "alice", Host: "h1", PID: 1},
 		{Timestamp: time.Now(), Event: "acquire", Name: "wanted-lock", Owner: "bob", Host: "h2", PID: 2},
 	}
@@ -128,6 +130,53 @@ func TestTailAuditLog_NameFilter(t *testing.T) {
 	}
 }
 
+func TestTailAuditLog_EventOwnerFilterTable(t *testing.T) {
+	dir := t.TempDir()
+	auditPath := filepath.Join(dir, "audit.log")
+	if err := os.WriteFile(auditPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	done := make(chan int)
+	filter := auditFilter{events: []string{"deny", "force-break"}, owners: []string{"bob"}}
+	go func() {
+		done <- tailAuditLog(ctx, auditPath, filter, auditFormatTable)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	events := []audit.Event{
+		{Timestamp: time.Now(), Event: "acquire", Name: "build", Owner: "bob", Host: "h", PID: 1},
+		{Timestamp: time.Now(), Event: "deny", Name: "build", Owner: "alice", Host: "h", PID: 2},
+		{Timestamp: time.Now(), Event: "force-break", Name: "build", Owner: "bob", Host: "h", PID: 3},
+	}
+	f, _ := os.OpenFile(auditPath, os.O_APPEND|os.O_WRONLY, 0644)
+	for _, e := range events {
+		data, _ := json.Marshal(e)
+		_, _ = f.Write(append(data, '\n'))
+	}
+	_ = f.Close()
+
+	<-done
+
+	_ = w.Close()
+	os.Stdout = oldStdout
+	var buf bytes.Buffer
+	_, _ = io.Copy(&buf, r)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "TIME") || !strings.Contains(lines[1], "force-break") {
+		t.Errorf("output = %q, want the header and bob's force-break only", buf.String())
+	}
+}
+
 func TestTailAuditLog_GracefulShutdown(t *testing.T) {
 	dir := t.TempDir()
 	auditPath := filepath.Join(dir, "audit.log")
@@ -142,7 +191,7 @@ func TestTailAuditLog_GracefulShutdown(t *testing.T) {
 
 	done := make(chan int)
 	go func() {
-		done <- tailAuditLog(ctx, auditPath, "")
+		done <- tailAuditLog(ctx, auditPath, auditFilter{}, "")
 	}()
 
 	// Let it start
@@ -171,7 +220,7 @@ func TestTailAuditLog_WaitsForFileCreation(t *testing.T) {
 
 	done := make(chan int)
 	go func() {
-		done <- tailAuditLog(ctx, auditPath, "")
+		done <- tailAuditLog(ctx, auditPath, auditFilter{}, "")
 	}()
 
 	// Verify tailer is waiting (file doesn't exist)
@@ -211,7 +260,7 @@ func TestTailAuditLog_DetectsTruncation(t *testing.T) {
 	// truncate + write happen between poll cycles (poll detects size < offset).
 	var initial []byte
 	for i := range 5 {
-		ev := auditEvent{
+		ev := audit.Event{
 			Timestamp: time.Now(),
 			Event:     "acquire",
 			Name:      fmt.Sprintf("initial-%d", i),
@@ -237,7 +286,7 @@ func TestTailAuditLog_DetectsTruncation(t *testing.T) {
 
 	done := make(chan int)
 	go func() {
-		done <- tailAuditLog(ctx, auditPath, "")
+		done <- tailAuditLog(ctx, auditPath, auditFilter{}, "")
 	}()
 
 	time.Sleep(100 * time.Millisecond)
@@ -248,7 +297,7 @@ func TestTailAuditLog_DetectsTruncation(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Write new content after truncation
-	newEvent := auditEvent{
+	newEvent := audit.Event{
 		Timestamp: time.Now(),
 		Event:     "release",
 		Name:      "after-truncate",
@@ -275,6 +324,125 @@ func TestTailAuditLog_DetectsTruncation(t *testing.T) {
 	}
 }
 
+func TestTailAuditLog_FollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	auditPath := filepath.Join(dir, "audit.log")
+	if err := os.WriteFile(auditPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	appendEvent := func(name string) {
+		data, _ := json.Marshal(audit.Event{Timestamp: time.Now(), Event: "acquire", Name: name, Owner: "alice", Host: "h1", PID: 1})
+		f, err := os.OpenFile(auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Write(append(data, '\n'))
+		_ = f.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	done := make(chan int)
+	go func() {
+		done <- tailAuditLog(ctx, auditPath, auditFilter{}, "")
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Rotate between polls: the last event before the rename and the
+	// first one in the new file must both be printed.
+	appendEvent("before-rotate")
+	if err := os.Rename(auditPath, auditPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendEvent("after-rotate")
+
+	<-done
+
+	_ = w.Close()
+	os.Stdout = oldStdout
+	var buf bytes.Buffer
+	_, _ = io.Copy(&buf, r)
+	output := buf.String()
+
+	for _, name := range []string{"before-rotate", "after-rotate"} {
+		if strings.Count(output, name) != 1 {
+			t.Errorf("output should contain %q once, got: %s", name, output)
+		}
+	}
+}
+
+func TestTailAuditLogSince_HistoryThenFollow(t *testing.T) {
+	dir := t.TempDir()
+	auditPath := filepath.Join(dir, "audit.log")
+	line := func(name string, at time.Time) []byte {
+		data, _ := json.Marshal(audit.Event{Timestamp: at, Event: "acquire", Name: name, Owner: "alice", Host: "h1", PID: 1})
+		return append(data, '\n')
+	}
+	appendTo := func(path string, data []byte) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Write(data)
+		_ = f.Close()
+	}
+	now := time.Now()
+	appendTo(auditPath+".1", append(line("too-old", now.Add(-time.Hour)), line("rotated", now.Add(-5*time.Minute))...))
+	// The last line is still being written when the history is read
+	half := line("split", now)
+	appendTo(auditPath, append(line("live", now.Add(-time.Minute)), half[:10]...))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	done := make(chan int)
+	go func() {
+		done <- tailAuditLogSince(ctx, dir, auditFilter{since: now.Add(-10 * time.Minute), names: []string{"rotated", "live", "split", "after-rotate"}}, "")
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	appendTo(auditPath, half[10:])
+	appendTo(auditPath, line("filtered-out", now))
+	time.Sleep(300 * time.Millisecond)
+	// Rotation to a smaller file, which must be followed from its start
+	if err := os.Rename(auditPath+".1", auditPath+".2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(auditPath, auditPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendTo(auditPath, line("after-rotate", now))
+
+	<-done
+
+	_ = w.Close()
+	os.Stdout = oldStdout
+	var buf bytes.Buffer
+	_, _ = io.Copy(&buf, r)
+	output := buf.String()
+
+	for _, name := range []string{"rotated", "live", "split", "after-rotate"} {
+		if strings.Count(output, `"name":"`+name+`"`) != 1 {
+			t.Errorf("output should contain %q once, got: %s", name, output)
+		}
+	}
+	for _, name := range []string{"too-old", "filtered-out"} {
+		if strings.Contains(output, name) {
+			t.Errorf("output should not contain %q, got: %s", name, output)
+		}
+	}
+}
+
 func TestTailAuditLog_SkipsMalformedLines(t *testing.T) {
 	dir := t.TempDir()
 	auditPath := filepath.Join(dir, "audit.log")
@@ -294,7 +462,7 @@ func TestTailAuditLog_SkipsMalformedLines(t *testing.T) {
 
 	done := make(chan int)
 	go func() {
-		done <- tailAuditLog(ctx, auditPath, "")
+		done <- tailAuditLog(ctx, auditPath, auditFilter{}, "")
 	}()
 
 	time.Sleep(50 * time.Millisecond)
@@ -302,7 +470,7 @@ func TestTailAuditLog_SkipsMalformedLines(t *testing.T) {
 	// Write malformed line followed by valid event
 	f, _ = os.OpenFile(auditPath, os.O_APPEND|os.O_WRONLY, 0644)
 	_, _ = f.WriteString("this is not valid json\n")
-	event := auditEvent{
+	event := audit.Event{
 		Timestamp: time.Now(),
 		Event:     "acquire",
 		Name:      "valid-event",
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/doctor"
+	"github.com/nikolasavic/lokt/internal/notify"
+	"github.com/nikolasavic/lokt/pkg/lokt"
+)
+
+// Webhook dispatchers, event hooks (and clients owning them) created during
+// this invocation. main waits for them before exiting so a short command
+// (lock, unlock) doesn't cut its own notifications off; each delivery is
+// bounded by notify.Timeout, each hook run by hooks.timeout.
+var (
+	notifiersMu sync.Mutex
+	notifiers   []interface{ Wait() }
+)
+
+// newClient returns the library client for rootDir. Its webhooks are waited
+// on before exit like newAuditor's. lock (of one name), unlock, renew,
+// freeze and unfreeze go through it; guard and run, which supervise the
+// command through internal/guard, lock --batch and --take-over-from, and
+// status, which reports corrupt, unsupported and badly signed files the
+// client skips, use the internal packages directly.
+func newClient(rootDir string) *lokt.Client {
+	c := lokt.New(rootDir)
+	addNotifier(c)
+	return c
+}
+
+// newAuditor returns the audit writer for rootDir, wired to fire the
+// per-lock webhooks configured in config.json and the event hook. A missing
+// or broken config just means no webhooks or hook; commands that care about
+// config report it.
+func newAuditor(rootDir string) *audit.Writer {
+	w := audit.NewWriter(rootDir)
+	cfg, err := config.Load(rootDir)
+	if err != nil {
+		return w
+	}
+	w.SetRotation(auditRotation(cfg.Audit))
+	if d := notify.New(rootDir, cfg); d != nil {
+		addNotifier(d)
+		w.OnEmit(d.Notify)
+	}
+	if h := notify.NewHook(rootDir, cfg); h != nil {
+		addNotifier(h)
+		w.OnEmit(h.Run)
+	}
+	return w
+}
+
+// addNotifier registers d to be waited on before exit.
+func addNotifier(d interface{ Wait() }) {
+	notifiersMu.Lock()
+	notifiers = append(notifiers, d)
+	notifiersMu.Unlock()
+}
+
+// auditRotation converts the config's audit section to a rotation policy.
+func auditRotation(c config.AuditConfig) audit.RotatePolicy {
+	return audit.RotatePolicy{
+		MaxSize:  int64(c.MaxSize),
+		MaxAge:   time.Duration(c.MaxAge),
+		Keep:     c.Keep,
+		Compress: c.Compress,
+	}
+}
+
+// waitNotifiers blocks until every webhook started by this process has been
+// delivered or timed out.
+func waitNotifiers() {
+	notifiersMu.Lock()
+	pending := notifiers
+	notifiers = nil
+	notifiersMu.Unlock()
+	for _, d := range pending {
+		d.Wait()
+	}
+}
+
+// checkWebhooks runs the doctor connectivity probe against every webhook in
+// the root's config.
+func checkWebhooks(rootDir string) doctor.CheckResult {
+	cfg, err := config.Load(rootDir)
+	if err != nil {
+		return doctor.CheckResult{Name: "webhooks", Status: doctor.StatusWarn, Message: err.Error()}
+	}
+	return doctor.CheckWebhooks(cfg.NotifyURLs(), notify.Probe, notify.ReadState(rootDir).WebhookFailures)
+}
+
+// checkEventHook reports on the root's event hook and the failures recorded
+// for it.
+func checkEventHook(rootDir string) doctor.CheckResult {
+	path := notify.HookPath(rootDir)
+	_, err := os.Stat(path)
+	s := notify.ReadState(rootDir)
+	return doctor.CheckEventHook(path, err == nil, notify.HookExecutable(path), s.HookFailures, s.HookDropped)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/notify"
+)
+
+// writeNotifyConfig points the given transitions of lock name at url.
+func writeNotifyConfig(t *testing.T, rootDir, name, url string, transitions ...string) {
+	t.Helper()
+	targets := make(map[string]string)
+	for _, tr := range transitions {
+		targets[tr] = url
+	}
+	data, err := json.Marshal(config.Config{Locks: map[string]config.LockPolicy{name: {Notify: targets}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(rootDir, config.FileName), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotify_LockUnlockFireWebhooks(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	var mu sync.Mutex
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var p notify.Payload
+		_ = json.Unmarshal(body, &p)
+		mu.Lock()
+		got = append(got, p.Transition+":"+p.Name)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	writeNotifyConfig(t, rootDir, "deploy", srv.URL, config.TransitionAcquired, config.TransitionReleased)
+
+	for _, args := range [][]string{{"deploy"}, {"build"}} {
+		if _, stderr, code := captureCmd(cmdLock, args); code != ExitOK {
+			t.Fatalf("lock %v: exit %d: %s", args, code, stderr)
+		}
+	}
+	if _, stderr, code := captureCmd(cmdUnlock, []string{"deploy"}); code != ExitOK {
+		t.Fatalf("unlock: exit %d: %s", code, stderr)
+	}
+	waitNotifiers()
+
+	// Deliveries run concurrently: their order of arrival isn't fixed.
+	slices.Sort(got)
+	if strings.Join(got, ",") != "acquired:deploy,released:deploy" {
+		t.Errorf("webhooks = %v, want acquired and released for deploy only", got)
+	}
+}
+
+func TestNotify_FailureDoesNotFailCommand(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	writeNotifyConfig(t, rootDir, "deploy", srv.URL, config.TransitionAcquired)
+
+	_, stderr, code := captureCmd(cmdLock, []string{"deploy"})
+	waitNotifiers()
+	if code != ExitOK {
+		t.Errorf("webhook failure must not change the exit code, got %d", code)
+	}
+	if stderr != "" {
+		t.Errorf("webhook failure must not be surfaced, got stderr %q", stderr)
+	}
+	if n := notify.ReadState(rootDir).WebhookFailures; n != 1 {
+		t.Errorf("webhook_failures = %d, want 1", n)
+	}
+}
+
+func TestCmdDoctor_ProbeWebhooks(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	writeNotifyConfig(t, rootDir, "deploy", srv.URL, config.TransitionForceBroken)
+
+	stdout, _, code := captureCmd(cmdDoctor, []string{"--probe-webhooks"})
+	if code != ExitOK || !strings.Contains(stdout, "1 webhook(s) reachable") {
+		t.Errorf("reachable webhook: exit %d, output:\n%s", code, stdout)
+	}
+
+	srv.Close()
+	stdout, _, code = captureCmd(cmdDoctor, []string{"--probe-webhooks"})
+	if code != ExitOK {
+		t.Errorf("unreachable webhook should only warn, got exit %d", code)
+	}
+	if want := fmt.Sprintf("%s unreachable", srv.URL); !strings.Contains(stdout, want) {
+		t.Errorf("expected %q in output:\n%s", want, stdout)
+	}
+
+	// Without the flag no network probe happens.
+	stdout, _, _ = captureCmd(cmdDoctor, nil)
+	if strings.Contains(stdout, "webhook") {
+		t.Errorf("webhooks should only be probed behind --probe-webhooks:\n%s", stdout)
+	}
+}
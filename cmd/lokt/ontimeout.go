@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// onTimeoutLimit bounds a guard --on-timeout command, so a hung notifier
+// can't hold up the job it reports on.
+const onTimeoutLimit = time.Minute
+
+// blockingHolder returns who holds name: the exclusive holder, else the
+// longest-standing shared holder. Nil if nobody could be read (the lock was
+// released right after the wait gave up).
+func blockingHolder(rootDir, name string) *lockfile.Lock {
+	if lf, err := lockfile.Read(root.LockFilePath(rootDir, name)); err == nil {
+		return lf
+	}
+	holders := lock.SharedHolders(rootDir, name)
+	if len(holders) == 0 {
+		return nil
+	}
+	return slices.MinFunc(holders, func(a, b *lockfile.Lock) int { return a.AcquiredAt.Compare(b.AcquiredAt) })
+}
+
+// timeoutHookEnv describes the holder a wait for name timed out on. The
+// holder variables are empty when holder is nil.
+func timeoutHookEnv(name string, holder *lockfile.Lock) []string {
+	var owner, pid, age string
+	if holder != nil {
+		owner = holder.Owner
+		pid = strconv.Itoa(holder.PID)
+		age = strconv.Itoa(int(holder.Age().Seconds()))
+	}
+	return []string{
+		"LOKT_LOCK_NAME=" + name,
+		"LOKT_HOLDER_OWNER=" + owner,
+		"LOKT_HOLDER_PID=" + pid,
+		"LOKT_HOLDER_AGE_SEC=" + age,
+	}
+}
+
+// runTimeoutHook runs the guard --on-timeout command through the shell after
+// a wait for name timed out. Its outcome is reported but never changes
+// guard's exit code.
+func runTimeoutHook(command, name string, holder *lockfile.Lock) {
+	if command == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), onTimeoutLimit)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command) //nolint:gosec // G204: the command is the user's own flag
+	cmd.Env = append(os.Environ(), timeoutHookEnv(name, holder)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("killed after %s", onTimeoutLimit)
+		}
+		fmt.Fprintf(os.Stderr, "warning: --on-timeout command failed: %v\n", err)
+	}
+}
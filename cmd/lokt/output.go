@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// outputSink is where a command writes its primary output. With no --output
+// (or "--output -") writes go straight to stdout. With a path, output is
+// buffered and committed atomically by finish, so a failed command or write
+// never leaves a partial file behind.
+type outputSink struct {
+	path string
+	buf  bytes.Buffer
+}
+
+// newOutputSink returns a sink for the given --output value.
+func newOutputSink(path string) *outputSink {
+	if path == "-" {
+		path = ""
+	}
+	return &outputSink{path: path}
+}
+
+// Write implements io.Writer.
+func (s *outputSink) Write(p []byte) (int, error) {
+	if s.path == "" {
+		return os.Stdout.Write(p)
+	}
+	return s.buf.Write(p)
+}
+
+// finish commits buffered output to the destination file (temp file + rename
+// in the same directory, mode 0644) and prints a one-line confirmation.
+// It returns code unchanged on success and ExitError if the write fails.
+// A command that failed without producing output writes nothing.
+func (s *outputSink) finish(code int) int {
+	if s.path == "" {
+		return code
+	}
+	if code != ExitOK && s.buf.Len() == 0 {
+		return code
+	}
+	if err := lockfile.WriteFileAtomic(s.path, s.buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "error: writing output: %v\n", err)
+		return ExitError
+	}
+	fmt.Printf("wrote %s (%d bytes)\n", s.path, s.buf.Len())
+	return code
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestOutputSink_Stdout(t *testing.T) {
+	for _, path := range []string{"", "-"} {
+		stdout, _, code := captureCmd(func(_ []string) int {
+			out := newOutputSink(path)
+			_, _ = out.Write([]byte("hello\n"))
+			return out.finish(ExitOK)
+		}, nil)
+		if code != ExitOK || stdout != "hello\n" {
+			t.Errorf("path %q: got %q (exit %d), want hello on stdout", path, stdout, code)
+		}
+	}
+}
+
+func TestOutputSink_AtomicReplace(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "out.json")
+	if err := os.WriteFile(dest, []byte("old contents that are longer\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, code := captureCmd(func(_ []string) int {
+		out := newOutputSink(dest)
+		_, _ = out.Write([]byte("new\n"))
+		return out.finish(ExitOK)
+	}, nil)
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	if !strings.HasPrefix(stdout, "wrote "+dest) || strings.Count(stdout, "\n") != 1 {
+		t.Errorf("expected one-line confirmation, got %q", stdout)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new\n" {
+		t.Errorf("file = %q, want %q", data, "new\n")
+	}
+	info, _ := os.Stat(dest)
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the destination file, got %d entries", len(entries))
+	}
+}
+
+func TestOutputSink_ReadOnlyDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(dir, 0700) })
+	dest := filepath.Join(dir, "out.txt")
+
+	stdout, stderr, code := captureCmd(func(_ []string) int {
+		out := newOutputSink(dest)
+		_, _ = out.Write([]byte("data\n"))
+		return out.finish(ExitOK)
+	}, nil)
+	if code != ExitError {
+		t.Errorf("expected exit %d, got %d", ExitError, code)
+	}
+	if stdout != "" {
+		t.Errorf("expected no confirmation on failure, got %q", stdout)
+	}
+	if !strings.Contains(stderr, "writing output") {
+		t.Errorf("expected write error, got %q", stderr)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("expected no files left behind, got %d entries", len(entries))
+	}
+}
+
+func TestOutputSink_FailedCommandWritesNothing(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "out.txt")
+	_, _, code := captureCmd(func(_ []string) int {
+		return newOutputSink(dest).finish(ExitNotFound)
+	}, nil)
+	if code != ExitNotFound {
+		t.Errorf("expected exit %d, got %d", ExitNotFound, code)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("expected no output file, stat err = %v", err)
+	}
+}
+
+func TestStatus_OutputFile(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", Owner: "alice", Host: "h", PID: 1, AcquiredAt: time.Now(),
+	})
+	dest := filepath.Join(t.TempDir(), "status.json")
+
+	stdout, _, code := captureCmd(cmdStatus, []string{"--json", "--output", dest})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	if strings.Contains(stdout, "alice") {
+		t.Errorf("status output leaked to stdout: %s", stdout)
+	}
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outputs []statusOutput
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		t.Fatalf("invalid JSON in output file: %v\n%s", err, data)
+	}
+	if len(outputs) != 1 || outputs[0].Name != "build" {
+		t.Errorf("unexpected outputs: %+v", outputs)
+	}
+}
+
+func TestAuditAndDoctor_OutputFile(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	writeAuditEvents(t, rootDir,
+		map[string]any{"ts": time.Now(), "event": "acquire", "name": "build", "owner": "alice", "host": "h", "pid": 1},
+	)
+	dir := t.TempDir()
+
+	auditDest := filepath.Join(dir, "audit.ndjson")
+	if _, _, code := captureCmd(cmdAudit, []string{"--since", "1h", "--output", auditDest}); code != ExitOK {
+		t.Fatalf("audit: expected exit %d, got %d", ExitOK, code)
+	}
+	if data, _ := os.ReadFile(auditDest); !strings.Contains(string(data), `"name":"build"`) {
+		t.Errorf("audit output file missing event: %s", data)
+	}
+
+	doctorDest := filepath.Join(dir, "doctor.txt")
+	_, _, _ = captureCmd(cmdDoctor, []string{"--output", doctorDest})
+	if data, _ := os.ReadFile(doctorDest); !strings.Contains(string(data), "lokt doctor") {
+		t.Errorf("doctor output file missing report: %s", data)
+	}
+
+	_, _, code := captureCmd(cmdAudit, []string{"--tail", "--output", auditDest})
+	if code != ExitUsage {
+		t.Errorf("audit --tail --output: expected exit %d, got %d", ExitUsage, code)
+	}
+}
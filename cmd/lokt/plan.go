@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/guard"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/plan"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func cmdPlan(args []string) int {
+	if len(args) < 1 || args[0] != "run" {
+		planUsage()
+		return ExitUsage
+	}
+	return cmdPlanRun(args[1:])
+}
+
+func planUsage() {
+	fmt.Fprintln(os.Stderr, "usage: lokt plan run [--parallel n] [--timeout duration] [--results path|-] <plan.json|->")
+}
+
+// cmdPlanRun runs a plan file (see plan.Parse): each entry's command under
+// its lock, --parallel at a time, with output tagged by lock name. It exits
+// 0 if every entry succeeded or was skipped as allowed, 1 if any failed,
+// and 128+signal if a signal cancelled the plan.
+func cmdPlanRun(args []string) int {
+	fs := flag.NewFlagSet("plan run", flag.ContinueOnError)
+	parallel := fs.Int("parallel", 1, "Run up to this many entries at once")
+	timeout := fs.Duration("timeout", 0, "Maximum time each entry waits for its lock (default: no limit)")
+	results := fs.String("results", "", "Write the results JSON to this file (- for stdout; command output then goes to stderr)")
+	if err := fs.Parse(interspersed(fs, args)); err != nil || fs.NArg() != 1 {
+		planUsage()
+		return ExitUsage
+	}
+	if *parallel < 1 {
+		fmt.Fprintln(os.Stderr, "error: --parallel must be at least 1")
+		return ExitUsage
+	}
+	if *timeout < 0 {
+		fmt.Fprintln(os.Stderr, "error: --timeout must be positive (e.g., 5m)")
+		return ExitUsage
+	}
+	entries, err := readPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if code := checkWritable(rootDir, entries[0].Name); code != ExitOK {
+		return code
+	}
+
+	var stdout io.Writer = os.Stdout
+	if *results == "-" {
+		stdout = os.Stderr // keep stdout for the results
+	}
+	g := guard.Options{
+		RootDir: rootDir,
+		// TTL is each entry's own
+		Acquire: lock.AcquireOptions{
+			Auditor:           newAuditor(rootDir),
+			RetryAfterDefault: retryAfterDefault(rootDir),
+			NoAdaptive:        !adaptiveBackoff(rootDir),
+			ExclusionGroups:   exclusionGroups(rootDir),
+			Retry:             waitRetryPolicy(rootDir),
+			SkewGrace:         skewGrace(rootDir),
+			Flock:             flockLocks(rootDir),
+			RespectFreeze:     true,
+		},
+		Stdout: stdout,
+		Stderr: os.Stderr,
+	}
+
+	out, sig := plan.Run(context.Background(), entries, plan.Options{
+		Guard:       g,
+		Parallel:    *parallel,
+		WaitTimeout: *timeout,
+		OnDone:      func(r plan.Result) { fmt.Fprintln(os.Stderr, planResultLine(r)) },
+	})
+
+	code := ExitOK
+	for _, r := range out {
+		if !r.OK() {
+			code = ExitError
+		}
+	}
+	if s, ok := sig.(syscall.Signal); ok {
+		code = 128 + int(s)
+	}
+	if *results != "" {
+		data, _ := json.MarshalIndent(out, "", "  ")
+		data = append(data, '\n')
+		if *results == "-" {
+			_, _ = os.Stdout.Write(data)
+		} else if err := lockfile.WriteFileAtomic(*results, data, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "error: writing results: %v\n", err)
+			return ExitError
+		}
+	}
+	return code
+}
+
+// readPlan reads and validates a plan from stdin ("-") or a file.
+func readPlan(src string) ([]plan.Entry, error) {
+	if src == "-" {
+		return plan.Parse(os.Stdin)
+	}
+	f, err := os.Open(src) //nolint:gosec // G304: user-supplied plan file is intended
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return plan.Parse(f)
+}
+
+// planResultLine describes how a plan entry ended, tagged like its output.
+func planResultLine(r plan.Result) string {
+	tag := "[" + r.Name + "] "
+	took := (time.Duration(r.DurationMS) * time.Millisecond).String()
+	switch {
+	case r.Skipped:
+		return fmt.Sprintf("%sskipped: held by %s@%s (pid %d)", tag, r.Holder.Owner, r.Holder.Host, r.Holder.PID)
+	case r.ExitCode != nil && r.Error != "":
+		return fmt.Sprintf("%sexited %d after %s: %s", tag, *r.ExitCode, took, r.Error)
+	case r.ExitCode != nil:
+		return fmt.Sprintf("%sexited %d after %s", tag, *r.ExitCode, took)
+	}
+	return fmt.Sprintf("%snot run: %s", tag, r.Error)
+}
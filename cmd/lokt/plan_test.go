@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanRun(t *testing.T) {
+	setupTestRoot(t)
+	dir := t.TempDir()
+	planFile := filepath.Join(dir, "plan.json")
+	if err := os.WriteFile(planFile, []byte(`[
+		{"name": "build", "ttl": "1m", "cmd": "sh", "args": ["-c", "echo built"]},
+		{"name": "test", "cmd": "sh", "args": ["-c", "exit 4"]}
+	]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resultsFile := filepath.Join(dir, "results.json")
+
+	stdout, stderr, code := captureCmd(cmdPlan, []string{"run", planFile, "--parallel", "2", "--results", resultsFile})
+	if code != ExitError {
+		t.Errorf("plan run: exit %d, want %d (test failed)", code, ExitError)
+	}
+	if !strings.Contains(stdout, "[build] built") || !strings.Contains(stderr, "[test] exited 4") {
+		t.Errorf("plan run: stdout %q, stderr %q", stdout, stderr)
+	}
+	data, err := os.ReadFile(resultsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []struct {
+		Name     string `json:"name"`
+		Acquired bool   `json:"acquired"`
+		ExitCode *int   `json:"exit_code"`
+	}
+	if err := json.Unmarshal(data, &results); err != nil || len(results) != 2 {
+		t.Fatalf("results %s: %v", data, err)
+	}
+	if r := results[0]; r.Name != "build" || !r.Acquired || r.ExitCode == nil || *r.ExitCode != 0 {
+		t.Errorf("results[0] = %+v", r)
+	}
+	if r := results[1]; r.Name != "test" || r.ExitCode == nil || *r.ExitCode != 4 {
+		t.Errorf("results[1] = %+v", r)
+	}
+
+	for _, args := range [][]string{
+		{"run"},
+		{"start", planFile},
+		{"run", "--parallel", "0", planFile},
+		{"run", filepath.Join(dir, "missing.json")},
+	} {
+		if _, _, code := captureCmd(cmdPlan, args); code != ExitUsage {
+			t.Errorf("plan %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
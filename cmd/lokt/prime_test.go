@@ -1,12 +1,14 @@
 package main
 
 import (
+	"encoding/json"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/nikolasavic/lokt/internal/lockfile"
 )
@@ -721,6 +723,74 @@ func TestCmdPrime_DefaultOutput_ExpiredLock(t *testing.T) {
 	}
 }
 
+func TestCmdPrime_DefaultOutput_ExpiredAdvice(t *testing.T) {
+	_, locksDir := setupPrimeTestRoot(t)
+	hostname, _ := os.Hostname()
+	old := time.Now().Add(-10 * time.Minute)
+
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Name: "build", Owner: "alice", Host: hostname, PID: 999999999, AcquiredAt: old, TTLSec: 60,
+	})
+	writeLockJSON(t, locksDir, "deploy.json", &lockfile.Lock{
+		Name: "deploy", Owner: "bob", Host: hostname, PID: os.Getpid(), AcquiredAt: old, TTLSec: 180,
+	})
+	writeLockJSON(t, locksDir, "report.json", &lockfile.Lock{
+		Name: "report", Owner: "cron", Host: "server", PID: 1234, AcquiredAt: old, TTLSec: 60,
+	})
+	writeLockJSON(t, locksDir, "test.json", &lockfile.Lock{
+		Name: "test", Owner: "carol", Host: hostname, PID: 999999999, AcquiredAt: time.Now(),
+	})
+
+	stdout, _, code := captureCmd(cmdPrime, []string{"--no-history-discovery"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	for _, want := range []string{
+		"**build** held by alice@" + hostname + " for 10m0s [EXPIRED] — reclaimable (holder process dead)\n  - safe to run `lokt guard build -- <cmd>` now",
+		"**deploy** held by bob@" + hostname + " for 10m0s [EXPIRED] — holder still running, likely to renew\n  - try again in ~3m",
+		"**report** held by cron@server for 10m0s [EXPIRED] — cross-host, cannot verify\n  - try again in ~1m",
+		"**test** held by carol@" + hostname + " for 0s [DEAD] — reclaimable (holder process dead)",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in output, got: %s", want, stdout)
+		}
+	}
+}
+
+func TestCmdPrime_JSON(t *testing.T) {
+	_, locksDir := setupPrimeTestRoot(t)
+	hostname, _ := os.Hostname()
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Name: "build", Owner: "alice", Host: hostname, PID: 999999999, AcquiredAt: time.Now(),
+	})
+	writeLockJSON(t, locksDir, "deploy.json", &lockfile.Lock{
+		Name: "deploy", Owner: "bob", Host: "server", PID: 1, AcquiredAt: time.Now().Add(-10 * time.Minute), TTLSec: 60,
+	})
+
+	stdout, _, code := captureCmd(cmdPrime, []string{"--json", "--no-history-discovery"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	var out primeJSON
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("unmarshal: %v\n%s", err, stdout)
+	}
+	if len(out.Locks) != 2 {
+		t.Fatalf("locks = %+v, want 2", out.Locks)
+	}
+	build, deploy := out.Locks[0], out.Locks[1]
+	if build.Outlook != "reclaimable" || build.Reason != "dead_pid" || build.RetryAfterSec != 0 || !strings.HasPrefix(build.Recommendation, "safe to run") {
+		t.Errorf("build = %+v", build)
+	}
+	if deploy.Outlook != "cross_host" || deploy.Reason != "expired" || deploy.RetryAfterSec != 60 || deploy.Recommendation != "try again in ~1m" {
+		t.Errorf("deploy = %+v", deploy)
+	}
+
+	if _, _, code := captureCmd(cmdPrime, []string{"--json", "--format", "aider"}); code != ExitUsage {
+		t.Errorf("--json with --format: exit %d, want %d", code, ExitUsage)
+	}
+}
+
 func TestCmdPrime_DefaultOutput_FrozenLock(t *testing.T) {
 	rootDir, _ := setupPrimeTestRoot(t)
 
@@ -768,6 +838,9 @@ func TestCmdPrime_DefaultOutput_IdentityWithLoktOwner(t *testing.T) {
 func TestCmdPrime_DefaultOutput_IdentityFallbackToOSUser(t *testing.T) {
 	setupPrimeTestRoot(t)
 	t.Setenv("LOKT_OWNER", "") // Clear LOKT_OWNER to force OS fallback
+	for _, ci := range []string{"GITHUB_ACTIONS", "GITLAB_CI", "BUILDKITE", "JENKINS_URL"} {
+		t.Setenv(ci, "") // and the CI job owner, on a CI runner
+	}
 
 	stdout, _, code := captureCmd(cmdPrime, nil)
 	if code != ExitOK {
@@ -806,6 +879,9 @@ func TestCmdPrime_DefaultOutput_Sections(t *testing.T) {
 			t.Errorf("expected section %q in output, got: %s", section, stdout)
 		}
 	}
+	if !strings.Contains(stdout, "retry_after_sec") {
+		t.Error("expected the failure section to teach the retry hint")
+	}
 }
 
 // --- Format flag tests ---
@@ -1060,6 +1136,135 @@ func TestCmdPrime_FormatFlag_WithScriptsTable(t *testing.T) {
 	}
 }
 
+// --- history discovery tests ---
+
+// setupPrimeHistory creates a project with a build.sh wrapper script and an
+// audit log naming build (covered by the script), deploy (with cmdline),
+// migrate (no cmdline), and an old lock outside the discovery window.
+func setupPrimeHistory(t *testing.T) {
+	t.Helper()
+	loktRoot, _ := setupPrimeTestRoot(t)
+	scriptsDir := filepath.Join(filepath.Dir(loktRoot), "scripts")
+	if err := os.MkdirAll(scriptsDir, 0750); err != nil {
+		t.Fatalf("mkdir scripts: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(scriptsDir, "build.sh"),
+		[]byte("#!/bin/bash\nlokt guard build -- make build\n"), 0600); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	now := time.Now()
+	writeAuditEvents(t, loktRoot,
+		map[string]any{"ts": now.Add(-30 * 24 * time.Hour), "event": "acquire", "name": "ancient", "owner": "a", "host": "h", "pid": 1},
+		map[string]any{"ts": now.Add(-2 * time.Hour), "event": "acquire", "name": "deploy", "owner": "a", "host": "h", "pid": 1,
+			"extra": map[string]any{"cmdline": "make deploy"}},
+		map[string]any{"ts": now.Add(-time.Hour), "event": "acquire", "name": "build", "owner": "a", "host": "h", "pid": 1},
+		map[string]any{"ts": now.Add(-time.Hour), "event": "deny", "name": "denied-only", "owner": "a", "host": "h", "pid": 1},
+		map[string]any{"ts": now.Add(-time.Minute), "event": "acquire", "name": "migrate", "owner": "a", "host": "h", "pid": 1},
+	)
+}
+
+func TestDiscoverHistoryLocks(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	now := time.Now()
+	var events []map[string]any
+	for i := 0; i < historyDiscoveryMax+5; i++ {
+		events = append(events, map[string]any{
+			"ts": now.Add(time.Duration(i) * time.Second), "event": "acquire",
+			"name": "lock-" + string(rune('a'+i)), "owner": "a", "host": "h", "pid": 1,
+		})
+	}
+	writeAuditEvents(t, rootDir, events...)
+
+	found := discoverHistoryLocks(rootDir, []guardedScript{{Lock: "lock-o"}}, now.Add(time.Minute))
+	if len(found) != historyDiscoveryMax {
+		t.Fatalf("expected list capped at %d, got %d", historyDiscoveryMax, len(found))
+	}
+	if found[0].Lock != "lock-n" {
+		t.Errorf("expected most recent uncovered lock first, got %q", found[0].Lock)
+	}
+	for _, s := range found {
+		if s.Lock == "lock-o" {
+			t.Error("lock covered by a script should not be rediscovered")
+		}
+		if !s.FromHistory {
+			t.Errorf("%s: FromHistory = false", s.Lock)
+		}
+	}
+}
+
+func TestDiscoverHistoryLocks_TruncatesByRune(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	now := time.Now()
+	cmdline := "./deploy.sh " + strings.Repeat("é", 60)
+	writeAuditEvents(t, rootDir, map[string]any{
+		"ts": now, "event": "acquire", "name": "deploy", "owner": "a", "host": "h", "pid": 1,
+		"extra": map[string]any{"cmdline": cmdline},
+	})
+
+	found := discoverHistoryLocks(rootDir, nil, now.Add(time.Minute))
+	if len(found) != 1 {
+		t.Fatalf("expected 1 lock, got %d", len(found))
+	}
+	got := found[0].Command
+	if !utf8.ValidString(got) || utf8.RuneCountInString(got) != 60 || !strings.HasSuffix(got, "...") {
+		t.Errorf("Command = %q, want 57 runes of %q and ...", got, cmdline)
+	}
+}
+
+func TestCmdPrime_HistoryDiscovery_Default(t *testing.T) {
+	setupPrimeHistory(t)
+
+	stdout, _, code := captureCmd(cmdPrime, nil)
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	for _, row := range []string{
+		"| build | `./scripts/build.sh` | `make build` |",
+		"| deploy | `lokt guard deploy -- make deploy` | `make deploy` |",
+		"| migrate | `lokt guard migrate -- <cmd>` | (previously used) |",
+	} {
+		if !strings.Contains(stdout, row) {
+			t.Errorf("expected row %q, got:\n%s", row, stdout)
+		}
+	}
+	if strings.Count(stdout, "| build |") != 1 {
+		t.Errorf("build should appear once (script entry only), got:\n%s", stdout)
+	}
+	if strings.Contains(stdout, "ancient") || strings.Contains(stdout, "denied-only") {
+		t.Errorf("old and non-acquire events should be ignored, got:\n%s", stdout)
+	}
+	if strings.Index(stdout, "| migrate |") > strings.Index(stdout, "| deploy |") {
+		t.Errorf("history entries should be most recent first, got:\n%s", stdout)
+	}
+}
+
+func TestCmdPrime_HistoryDiscovery_ClaudeMD(t *testing.T) {
+	setupPrimeHistory(t)
+
+	stdout, _, code := captureCmd(cmdPrime, []string{"--format", "claude-md"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	for _, row := range []string{
+		"| build | `./scripts/build.sh` | `make build` |",
+		"| migrate | `lokt guard migrate -- <cmd>` | (previously used) |",
+		"| deploy | `lokt guard deploy -- make deploy` | `make deploy` |",
+	} {
+		if !strings.Contains(stdout, row) {
+			t.Errorf("expected row %q, got:\n%s", row, stdout)
+		}
+	}
+
+	stdout, _, _ = captureCmd(cmdPrime, []string{"--format", "claude-md", "--no-history-discovery"})
+	if strings.Contains(stdout, "deploy") || strings.Contains(stdout, "migrate") {
+		t.Errorf("--no-history-discovery should list scripts only, got:\n%s", stdout)
+	}
+	if !strings.Contains(stdout, "| build |") {
+		t.Errorf("script entry missing with --no-history-discovery, got:\n%s", stdout)
+	}
+}
+
 // --- Error handling tests ---
 
 func TestCmdPrime_NoLoktRoot(t *testing.T) {
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// primeRegion is the fenced block prime --write owns in a file: everything
+// between its begin and end lines is regenerated, everything outside is left
+// alone.
+type primeRegion struct {
+	begin string // the begin line; found by its prefix, up to the first ':'
+	end   string
+}
+
+var (
+	markdownRegion = primeRegion{
+		begin: "<!-- BEGIN lokt prime: generated by lokt prime --write; edits inside this block are overwritten -->",
+		end:   "<!-- END lokt prime -->",
+	}
+	yamlRegion = primeRegion{
+		begin: "# BEGIN lokt prime: generated by lokt prime --write; edits inside this block are overwritten",
+		end:   "# END lokt prime",
+	}
+)
+
+// primeTarget is where prime --write installs a format's snippet, relative
+// to the project root.
+type primeTarget struct {
+	path   string
+	region primeRegion
+}
+
+var primeTargets = map[string]primeTarget{
+	"claude-md":     {"CLAUDE.md", markdownRegion},
+	"cursorrules":   {".cursorrules", markdownRegion},
+	"windsurfrules": {".windsurfrules", markdownRegion},
+	"copilot":       {filepath.Join(".github", "copilot-instructions.md"), markdownRegion},
+	"clinerules":    {filepath.Join(".clinerules", "lokt.md"), markdownRegion},
+	"aider":         {".aider.conf.yml", yamlRegion},
+}
+
+// find returns the byte range of the region in data, from the start of its
+// begin line to past its end line. A begin without an end, or a second
+// region, is an error: the file was edited by hand and lokt can't tell what
+// it owns.
+func (r primeRegion) find(data string) (start, end int, ok bool, err error) {
+	beginPrefix, _, _ := strings.Cut(r.begin, ":")
+	start, end = -1, -1
+	off := 0
+	for _, line := range strings.SplitAfter(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, beginPrefix):
+			if start >= 0 {
+				return 0, 0, false, errors.New("more than one lokt prime block")
+			}
+			start = off
+		case trimmed == r.end:
+			if start < 0 || end >= 0 {
+				return 0, 0, false, errors.New("lokt prime block end without a begin")
+			}
+			end = off + len(line)
+		}
+		off += len(line)
+	}
+	if start >= 0 && end < 0 {
+		return 0, 0, false, errors.New("lokt prime block begin without an end")
+	}
+	return start, end, start >= 0, nil
+}
+
+// block returns body fenced as the region.
+func (r primeRegion) block(body string) string {
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	return r.begin + "\n" + body + r.end + "\n"
+}
+
+// primeInstallResult is what prime --write did, or --check found, for one
+// format.
+type primeInstallResult struct {
+	Path    string // relative to the project root
+	Existed bool   // the file was there before
+	Stale   bool   // the file's lokt block differs from the snippet (or is missing)
+	// Kept lists the keys of the aider snippet that the file already sets
+	// outside the lokt block, and that the block leaves to it.
+	Kept []string
+}
+
+// primeInstall brings the lokt block in format's file under projectRoot up
+// to date with snippet, creating the file if need be; with check, it only
+// reports whether the block is up to date. Content outside the block is
+// never changed. A symlinked file is updated where it points.
+func primeInstall(projectRoot, format, snippet string, check bool) (primeInstallResult, error) {
+	target := primeTargets[format]
+	res := primeInstallResult{Path: target.path}
+	path := filepath.Join(projectRoot, target.path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	var existing string
+	perm := os.FileMode(0644)
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path is a fixed name under the project root
+	switch {
+	case err == nil:
+		res.Existed, existing = true, string(data)
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return res, err
+	}
+
+	start, end, found, err := target.region.find(existing)
+	if err != nil {
+		return res, fmt.Errorf("%s: %w; fix or remove it by hand", target.path, err)
+	}
+
+	// The clinerules snippet opens with front matter, which only works at
+	// the top of the file: it goes above the block when lokt creates the
+	// file, and is the user's to keep after.
+	header, body := "", snippet
+	if format == "clinerules" {
+		header, body = splitFrontMatter(snippet)
+	}
+	if format == "aider" {
+		outside := existing
+		if found {
+			outside = existing[:start] + existing[end:]
+		}
+		body, res.Kept, err = mergeAiderSnippet(outside, body)
+		if err != nil {
+			return res, fmt.Errorf("%s: %w", target.path, err)
+		}
+	}
+
+	block := target.region.block(body)
+	var updated string
+	switch {
+	case found:
+		updated = existing[:start] + block + existing[end:]
+	case !res.Existed:
+		if header != "" {
+			header += "\n"
+		}
+		updated = header + block
+	default:
+		updated = existing
+		if updated != "" && !strings.HasSuffix(updated, "\n") {
+			updated += "\n"
+		}
+		if updated != "" {
+			updated += "\n"
+		}
+		updated += block
+	}
+	if format == "aider" {
+		if _, err := yamlTopKeys(updated); err != nil {
+			return res, fmt.Errorf("%s: merged file isn't valid: %w", target.path, err)
+		}
+	}
+
+	res.Stale = updated != existing
+	if check || !res.Stale {
+		return res, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil { //nolint:gosec // G301: project directories are shared like the repo
+		return res, err
+	}
+	return res, lockfile.WriteFileAtomic(path, []byte(updated), perm)
+}
+
+// installedPrimeFormats returns the formats whose file under projectRoot
+// already has a lokt block, in primeFormats order.
+func installedPrimeFormats(projectRoot string) []string {
+	var formats []string
+	for _, f := range primeFormats {
+		target := primeTargets[f]
+		data, err := os.ReadFile(filepath.Join(projectRoot, target.path)) //nolint:gosec // G304: fixed name under the project root
+		if err != nil {
+			continue
+		}
+		if _, _, found, _ := target.region.find(string(data)); found {
+			formats = append(formats, f)
+		}
+	}
+	return formats
+}
+
+// splitFrontMatter splits a leading "---" front matter block off s.
+func splitFrontMatter(s string) (front, body string) {
+	if !strings.HasPrefix(s, "---\n") {
+		return "", s
+	}
+	i := strings.Index(s[4:], "\n---\n")
+	if i < 0 {
+		return "", s
+	}
+	cut := 4 + i + len("\n---\n")
+	return s[:cut], strings.TrimLeft(s[cut:], "\n")
+}
+
+// cmdPrimeWrite implements prime --write and --check: for format, or every
+// format already installed when format is empty, it installs the snippet
+// into its file (see primeTargets) or checks that the file is up to date.
+// The snippet only lists wrapper scripts, never the audit log's locks, so it
+// is the same on every machine and --check can run in CI. --check exits 1
+// if any file is out of date.
+func cmdPrimeWrite(rootDir, format string, check bool) int {
+	projectRoot := findProjectRoot(rootDir)
+	formats := []string{format}
+	if format == "" {
+		formats = installedPrimeFormats(projectRoot)
+		if len(formats) == 0 {
+			fmt.Fprintln(os.Stderr, "error: no file in this project has a lokt prime block yet; pass --format to install one")
+			return ExitUsage
+		}
+	}
+
+	scripts := discoverGuardedScripts(rootDir)
+	me := identity.Current()
+	code := ExitOK
+	for _, f := range formats {
+		var buf bytes.Buffer
+		renderFormat(&buf, f, scripts, me)
+		res, err := primeInstall(projectRoot, f, buf.String(), check)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			code = ExitError
+			continue
+		}
+		for _, k := range res.Kept {
+			fmt.Fprintf(os.Stderr, "note: %s already sets %s outside the lokt block; left as is\n", res.Path, k)
+		}
+		switch {
+		case check && res.Stale:
+			fmt.Printf("out of date: %s (run: lokt prime --write --format %s)\n", res.Path, f)
+			code = ExitError
+		case check:
+			fmt.Printf("up to date: %s\n", res.Path)
+		case !res.Stale:
+			fmt.Printf("unchanged: %s\n", res.Path)
+		case res.Existed:
+			fmt.Printf("updated: %s\n", res.Path)
+		default:
+			fmt.Printf("created: %s\n", res.Path)
+		}
+	}
+	return code
+}
+
+// --- prime --write: .aider.conf.yml ---
+
+// mergeAiderSnippet fits the aider snippet to a file whose content outside
+// the lokt block is outside: YAML allows a key only once, so each key the
+// file already sets (and any the snippet repeats) is commented out in the
+// snippet rather than set again. It returns the keys left to the file.
+func mergeAiderSnippet(outside, snippet string) (string, []string, error) {
+	keys, err := yamlTopKeys(outside)
+	if err != nil {
+		return "", nil, fmt.Errorf("can't merge into it: %w", err)
+	}
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k.name] = true
+	}
+
+	var kept []string
+	lines := strings.SplitAfter(snippet, "\n")
+	for i, line := range lines {
+		if line == "" || line[0] == ' ' || line[0] == '#' || strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, _, err := yamlKeyOf(strings.TrimRight(line, "\r\n"))
+		if err != nil {
+			return "", nil, fmt.Errorf("snippet line %d: %w", i+1, err)
+		}
+		if !set[name] {
+			set[name] = true
+			continue
+		}
+		if containsKey(keys, name) && !slices.Contains(kept, name) {
+			kept = append(kept, name)
+		}
+		lines[i] = "# " + strings.TrimRight(line, "\r\n") + " (" + name + " is already set)\n"
+	}
+	return strings.Join(lines, ""), kept, nil
+}
+
+func containsKey(keys []yamlKey, name string) bool {
+	for _, k := range keys {
+		if k.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlKey is a top-level key of a YAML mapping and the line (from 1) it's
+// on.
+type yamlKey struct {
+	name string
+	line int
+}
+
+// yamlTopKeys parses the top level of a YAML document as a block mapping
+// and returns its keys, in order. It doesn't decode values, only follows
+// them far enough to know where each ends: indented lines (nested maps,
+// lists, block scalars) and multi-line flow collections and quoted scalars.
+// Anything other than one block mapping is an error, as is a key set twice.
+func yamlTopKeys(data string) ([]yamlKey, error) {
+	var keys []yamlKey
+	seen := make(map[string]bool)
+	var fl yamlFlow // the multi-line value being followed, if any
+	started, ended := false, false
+	for i, line := range strings.Split(data, "\n") {
+		n := i + 1
+		line = strings.TrimSuffix(line, "\r")
+		if fl.open() {
+			fl.scan(line)
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			if !started {
+				return nil, fmt.Errorf("line %d: indented before the first key", n)
+			}
+			continue
+		case ended:
+			return nil, fmt.Errorf("line %d: content after the end of the document", n)
+		case line == "---" || strings.HasPrefix(line, "--- #"):
+			if started {
+				return nil, fmt.Errorf("line %d: a second document", n)
+			}
+			continue
+		case line == "..." || strings.HasPrefix(line, "... #"):
+			ended = true
+			continue
+		case line[0] == '%':
+			if started {
+				return nil, fmt.Errorf("line %d: directive inside the document", n)
+			}
+			continue
+		case line[0] == '-' && (len(line) == 1 || line[1] == ' ' || line[1] == '\t'):
+			return nil, fmt.Errorf("line %d: a list, not a key: value mapping", n)
+		case line[0] == '?':
+			return nil, fmt.Errorf("line %d: complex keys aren't supported", n)
+		}
+
+		name, value, err := yamlKeyOf(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("line %d: key %q set twice", n, name)
+		}
+		seen[name], started = true, true
+		keys = append(keys, yamlKey{name: name, line: n})
+		if v := strings.TrimSpace(value); v != "" && strings.ContainsRune(`[{"'`, rune(v[0])) {
+			fl = yamlFlow{}
+			fl.scan(v)
+		}
+	}
+	if fl.open() {
+		return nil, errors.New("unterminated flow collection or quoted value at the end")
+	}
+	return keys, nil
+}
+
+// yamlKeyOf splits a top-level "key: value" line into the key, unquoted,
+// and what follows the colon.
+func yamlKeyOf(line string) (name, value string, err error) {
+	var rest string
+	switch line[0] {
+	case '"':
+		end := -1
+		for i := 1; i < len(line); i++ {
+			if line[i] == '\\' {
+				i++
+				continue
+			}
+			if line[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return "", "", errors.New("unterminated quoted key")
+		}
+		if name, err = strconv.Unquote(line[:end+1]); err != nil {
+			name = line[1:end]
+		}
+		rest = line[end+1:]
+	case '\'':
+		var b strings.Builder
+		end := -1
+		for i := 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+					continue
+				}
+				end = i
+				break
+			}
+			b.WriteByte(line[i])
+		}
+		if end < 0 {
+			return "", "", errors.New("unterminated quoted key")
+		}
+		name, rest = b.String(), line[end+1:]
+	default:
+		for i := 0; i < len(line); i++ {
+			if line[i] == '#' && i > 0 && (line[i-1] == ' ' || line[i-1] == '\t') {
+				break
+			}
+			if line[i] == ':' && (i+1 == len(line) || line[i+1] == ' ' || line[i+1] == '\t') {
+				name, rest = strings.TrimSpace(line[:i]), line[i:]
+				break
+			}
+		}
+		if name == "" {
+			return "", "", errors.New("expected key: value")
+		}
+	}
+	rest = strings.TrimLeft(rest, " \t")
+	if !strings.HasPrefix(rest, ":") || len(rest) > 1 && rest[1] != ' ' && rest[1] != '\t' {
+		return "", "", errors.New("expected ':' after the key")
+	}
+	return name, rest[1:], nil
+}
+
+// yamlFlow follows a flow collection or quoted scalar across lines.
+type yamlFlow struct {
+	depth int  // open [ and {
+	quote byte // the open quote, if inside a quoted scalar
+}
+
+func (f *yamlFlow) open() bool { return f.depth > 0 || f.quote != 0 }
+
+// scan advances f over one line of the value.
+func (f *yamlFlow) scan(s string) {
+	prev := byte(0) // the last non-space character outside quotes; 0 at a line start
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch f.quote {
+		case '"':
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				f.quote, prev = 0, c
+			}
+			continue
+		case '\'':
+			if c == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+				} else {
+					f.quote, prev = 0, c
+				}
+			}
+			continue
+		}
+		switch {
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return // a comment
+		case (c == '"' || c == '\'') && (prev == 0 || strings.IndexByte("[{,:", prev) >= 0):
+			f.quote = c // a quote only opens a scalar where one starts
+		case c == '[' || c == '{':
+			f.depth++
+		case c == ']' || c == '}':
+			f.depth--
+		}
+		if c != ' ' && c != '\t' {
+			prev = c
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrimeInstall(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "CLAUDE.md")
+
+	// Created
+	res, err := primeInstall(dir, "claude-md", "v1\n", false)
+	if err != nil || res.Existed || !res.Stale {
+		t.Fatalf("create: %+v, %v", res, err)
+	}
+	want := markdownRegion.block("v1\n")
+	if got := readFile(t, path); got != want {
+		t.Fatalf("created %q, want %q", got, want)
+	}
+
+	// Updated, keeping the user's content on both sides
+	if err := os.WriteFile(path, []byte("# Mine\n\n"+want+"\nmore of mine\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := primeInstall(dir, "claude-md", "v2\n", true); err != nil || !res.Stale {
+		t.Fatalf("check v2: %+v, %v; want stale", res, err)
+	}
+	if got := readFile(t, path); !strings.Contains(got, "v1") {
+		t.Fatalf("check changed the file: %q", got)
+	}
+	if res, err := primeInstall(dir, "claude-md", "v2\n", false); err != nil || !res.Existed || !res.Stale {
+		t.Fatalf("update: %+v, %v", res, err)
+	}
+	if got, want := readFile(t, path), "# Mine\n\n"+markdownRegion.block("v2\n")+"\nmore of mine\n"; got != want {
+		t.Errorf("updated %q, want %q", got, want)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("mode after update: %v, %v; want 0600 kept", info.Mode(), err)
+	}
+	if res, err := primeInstall(dir, "claude-md", "v2\n", true); err != nil || res.Stale {
+		t.Errorf("check after update: %+v, %v; want up to date", res, err)
+	}
+
+	// Appended to a file without a block
+	cursor := filepath.Join(dir, ".cursorrules")
+	if err := os.WriteFile(cursor, []byte("be nice"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primeInstall(dir, "cursorrules", "rules\n", false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFile(t, cursor), "be nice\n\n"+markdownRegion.block("rules\n"); got != want {
+		t.Errorf("appended %q, want %q", got, want)
+	}
+
+	// A block missing its end is left for the user to fix
+	if err := os.WriteFile(cursor, []byte(markdownRegion.begin+"\nrules\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primeInstall(dir, "cursorrules", "rules\n", false); err == nil {
+		t.Error("install over a block without an end succeeded, want an error")
+	}
+
+	// Front matter stays at the top of a new clinerules file, outside the block
+	if _, err := primeInstall(dir, "clinerules", "---\ndescription: x\n---\n\nbody\n", false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readFile(t, filepath.Join(dir, ".clinerules", "lokt.md")), "---\ndescription: x\n---\n\n"+markdownRegion.block("body\n"); got != want {
+		t.Errorf("clinerules %q, want %q", got, want)
+	}
+}
+
+func TestPrimeInstall_Aider(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".aider.conf.yml")
+	mine := "# my settings\nmodel: gpt-4\n\"lint-cmd\":\n  - make lint\nread: [CONVENTIONS.md,\n  docs/a.md]\n"
+	if err := os.WriteFile(path, []byte(mine), 0600); err != nil {
+		t.Fatal(err)
+	}
+	snippet := "# lokt\nlint-cmd: ./scripts/lint.sh\ntest-cmd: ./scripts/test.sh\ntest-cmd: ./scripts/test2.sh\n"
+	res, err := primeInstall(dir, "aider", snippet, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Kept) != 1 || res.Kept[0] != "lint-cmd" {
+		t.Errorf("kept %v, want [lint-cmd]", res.Kept)
+	}
+	got := readFile(t, path)
+	if !strings.HasPrefix(got, mine) {
+		t.Errorf("user content not kept: %q", got)
+	}
+	keys, err := yamlTopKeys(got)
+	if err != nil {
+		t.Fatalf("merged file: %v\n%s", err, got)
+	}
+	var names []string
+	for _, k := range keys {
+		names = append(names, k.name)
+	}
+	if strings.Join(names, " ") != "model lint-cmd read test-cmd" {
+		t.Errorf("merged keys %v", names)
+	}
+	if !strings.Contains(got, "# lint-cmd: ./scripts/lint.sh") || !strings.Contains(got, "# test-cmd: ./scripts/test2.sh") {
+		t.Errorf("repeated keys not commented out:\n%s", got)
+	}
+
+	// Rewriting is stable, and a file that isn't a mapping is refused
+	if res, err := primeInstall(dir, "aider", snippet, true); err != nil || res.Stale {
+		t.Errorf("check: %+v, %v; want up to date", res, err)
+	}
+	if err := os.WriteFile(path, []byte("- a\n- b\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := primeInstall(dir, "aider", snippet, false); err == nil {
+		t.Error("install into a YAML list succeeded, want an error")
+	}
+}
+
+func TestYamlTopKeys(t *testing.T) {
+	keys, err := yamlTopKeys(strings.Join([]string{
+		"%YAML 1.2",
+		"---",
+		"a: 1 # comment",
+		"'b''c': x",
+		"d: |",
+		"  e: not a key",
+		"",
+		"  # not a comment either",
+		"f: {g: 'h,",
+		"i: still h', j: [1,",
+		"2]}",
+		"k: it's plain",
+		"l:",
+		"  - m: 1",
+		"url: http://x",
+		"...",
+	}, "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, k := range keys {
+		names = append(names, k.name)
+	}
+	if got := strings.Join(names, " "); got != "a b'c d f k l url" {
+		t.Errorf("keys = %q", got)
+	}
+
+	for _, doc := range []string{
+		"- a\n",
+		"a: 1\na: 2\n",
+		"  a: 1\n",
+		"a: 1\n---\nb: 2\n",
+		"a: 1\n...\nb: 2\n",
+		"a: [1,\n",
+		"? a\n: 1\n",
+		"just text\n",
+	} {
+		if _, err := yamlTopKeys(doc); err == nil {
+			t.Errorf("yamlTopKeys(%q) succeeded, want an error", doc)
+		}
+	}
+}
+
+func TestCmdPrime_WriteCheck(t *testing.T) {
+	loktRoot, _ := setupPrimeTestRoot(t)
+	project := filepath.Dir(loktRoot)
+
+	if _, _, code := captureCmd(cmdPrime, []string{"--check"}); code != ExitUsage {
+		t.Errorf("--check with nothing installed: exit %d, want %d", code, ExitUsage)
+	}
+	if _, _, code := captureCmd(cmdPrime, []string{"--write", "--format", "bogus"}); code != ExitUsage {
+		t.Errorf("--write --format bogus: exit %d, want %d", code, ExitUsage)
+	}
+	if _, _, code := captureCmd(cmdPrime, []string{"--write", "--check", "--format", "aider"}); code != ExitUsage {
+		t.Errorf("--write --check: exit %d, want %d", code, ExitUsage)
+	}
+
+	stdout, stderr, code := captureCmd(cmdPrime, []string{"--write", "--format", "windsurfrules"})
+	if code != ExitOK || !strings.Contains(stdout, "created: .windsurfrules") {
+		t.Fatalf("--write: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if got := readFile(t, filepath.Join(project, ".windsurfrules")); !strings.Contains(got, "# Lokt Lock Coordination") {
+		t.Errorf(".windsurfrules = %q", got)
+	}
+	if stdout, _, code := captureCmd(cmdPrime, []string{"--check"}); code != ExitOK || !strings.Contains(stdout, "up to date: .windsurfrules") {
+		t.Errorf("--check: exit %d, stdout %q", code, stdout)
+	}
+
+	// A new wrapper script makes the installed block out of date
+	scripts := filepath.Join(project, "scripts")
+	if err := os.MkdirAll(scripts, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(scripts, "build.sh"), []byte("lokt guard build -- make build\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if stdout, _, code := captureCmd(cmdPrime, []string{"--check"}); code != ExitError || !strings.Contains(stdout, "out of date: .windsurfrules") {
+		t.Errorf("--check after a new script: exit %d, stdout %q; want %d", code, stdout, ExitError)
+	}
+	if stdout, _, code := captureCmd(cmdPrime, []string{"--write"}); code != ExitOK || !strings.Contains(stdout, "updated: .windsurfrules") {
+		t.Errorf("--write: exit %d, stdout %q", code, stdout)
+	}
+	if got := readFile(t, filepath.Join(project, ".windsurfrules")); !strings.Contains(got, "./scripts/build.sh") {
+		t.Errorf(".windsurfrules after update = %q", got)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// pruneOutput is the JSON form of lokt prune.
+type pruneOutput struct {
+	DryRun bool          `json:"dry_run,omitempty"`
+	Pruned []lock.Pruned `json:"pruned"`
+	Errors []string      `json:"errors,omitempty"`
+}
+
+// cmdPrune removes every stale lock and freeze (lock.Prune). Exit 1 if
+// anything could not be removed; with --dry-run, exit 6 if anything would
+// be.
+func cmdPrune(args []string) int {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Report what would be removed without removing it")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	olderThan := fs.Duration("older-than", 0, "Only prune locks and freezes acquired at least this long ago")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: lokt prune [--dry-run] [--json] [--older-than duration]")
+		return ExitUsage
+	}
+	if *olderThan < 0 {
+		fmt.Fprintln(os.Stderr, "error: --older-than must be positive (e.g., 24h)")
+		return ExitUsage
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if !*dryRun {
+		if code := checkWritable(rootDir, ""); code != ExitOK {
+			return code
+		}
+	}
+
+	pruned, errs := lock.Prune(rootDir, lock.PruneOptions{
+		DryRun:    *dryRun,
+		OlderThan: *olderThan,
+		SkewGrace: skewGrace(rootDir),
+		Auditor:   newAuditor(rootDir),
+	})
+	out := pruneOutput{DryRun: *dryRun, Pruned: pruned}
+	if out.Pruned == nil {
+		out.Pruned = []lock.Pruned{}
+	}
+	for _, err := range errs {
+		out.Errors = append(out.Errors, err.Error())
+	}
+
+	if *jsonOutput {
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printPrune(out)
+	}
+	switch {
+	case len(out.Errors) > 0:
+		return ExitError
+	case *dryRun && len(out.Pruned) > 0:
+		return ExitStale
+	}
+	return ExitOK
+}
+
+func printPrune(out pruneOutput) {
+	verb := "removed"
+	if out.DryRun {
+		verb = "would remove"
+	}
+	for _, p := range out.Pruned {
+		kind := "lock"
+		if p.Freeze {
+			kind = "freeze"
+		}
+		holder := ""
+		if p.Holder != nil {
+			holder = fmt.Sprintf(", held by %s@%s (pid %d)", p.Holder.Owner, p.Holder.Host, p.Holder.PID)
+		}
+		fmt.Printf("%s %s %s: %s%s\n", verb, kind, p.Name, p.Reason.Description(), holder)
+	}
+	for _, e := range out.Errors {
+		fmt.Fprintf(os.Stderr, "error: %s\n", e)
+	}
+	if len(out.Pruned) == 0 {
+		fmt.Println("nothing to prune")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestCmdPrune(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	host, _ := os.Hostname()
+	writeLockJSON(t, locksDir, "old.json", &lockfile.Lock{
+		Version: 1, Name: "old", Owner: "cron", Host: "server", PID: 1,
+		AcquiredAt: time.Now().Add(-time.Hour), TTLSec: 60,
+	})
+	writeLockJSON(t, locksDir, "mine.json", &lockfile.Lock{
+		Version: 1, Name: "mine", Owner: "me", Host: host, PID: os.Getpid(), AcquiredAt: time.Now(),
+	})
+
+	stdout, _, code := captureCmd(cmdPrune, []string{"--dry-run", "--json"})
+	if code != ExitStale {
+		t.Fatalf("prune --dry-run: exit %d, want %d", code, ExitStale)
+	}
+	var out pruneOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("unmarshal %q: %v", stdout, err)
+	}
+	if !out.DryRun || len(out.Pruned) != 1 || out.Pruned[0].Name != "old" || out.Pruned[0].Holder.Owner != "cron" {
+		t.Errorf("dry run = %+v, want only the expired lock", out)
+	}
+	if _, _, code := captureCmd(cmdPrune, []string{"--dry-run", "--older-than", "2h"}); code != ExitOK {
+		t.Errorf("prune --dry-run --older-than 2h: exit %d, want %d (nothing that old)", code, ExitOK)
+	}
+
+	stdout, _, code = captureCmd(cmdPrune, nil)
+	if code != ExitOK || !strings.Contains(stdout, "removed lock old: lock TTL has expired, held by cron@server (pid 1)") {
+		t.Errorf("prune: exit %d, stdout %q", code, stdout)
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "mine.json")); err != nil {
+		t.Errorf("a live lock was pruned: %v", err)
+	}
+	if stdout, _, code := captureCmd(cmdPrune, []string{"--dry-run"}); code != ExitOK || !strings.Contains(stdout, "nothing to prune") {
+		t.Errorf("second prune: exit %d, stdout %q", code, stdout)
+	}
+	if _, _, code := captureCmd(cmdPrune, []string{"--older-than", "-1h"}); code != ExitUsage {
+		t.Errorf("negative --older-than: exit %d, want %d", code, ExitUsage)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// relocateVerifyRounds bounds how many copy+compare passes relocation makes
+// before giving up on a root that keeps changing underneath it.
+const relocateVerifyRounds = 5
+
+// relocateSettle is how long relocation waits after quiescing the old root
+// so operations that resolved it just before the marker landed can finish.
+// Injectable for tests.
+var relocateSettle = 250 * time.Millisecond
+
+func cmdRelocate(args []string) int {
+	fset := flag.NewFlagSet("relocate", flag.ContinueOnError)
+	to := fset.String("to", "", "Directory to move the lock root to (must be empty or absent)")
+	redirect := fset.String("redirect", root.RedirectFollow, "How lokt treats the old path afterwards: follow or fail")
+	if err := fset.Parse(args); err != nil || *to == "" || fset.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: lokt relocate --to <dir> [--redirect follow|fail]")
+		return ExitUsage
+	}
+	if *redirect != root.RedirectFollow && *redirect != root.RedirectFail {
+		fmt.Fprintf(os.Stderr, "error: --redirect must be %q or %q\n", root.RedirectFollow, root.RedirectFail)
+		return ExitUsage
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if code := checkWritable(rootDir, ""); code != ExitOK {
+		return code
+	}
+	src, err := filepath.Abs(rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	dst, err := filepath.Abs(*to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if _, err := os.Stat(src); err != nil {
+		fmt.Fprintf(os.Stderr, "error: nothing to relocate: %v\n", err)
+		return ExitError
+	}
+	if err := checkRelocateTarget(src, dst); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+
+	files, err := relocateRoot(src, dst, *redirect)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: relocate: %v\n", err)
+		return ExitError
+	}
+
+	id := identity.Current()
+	audit.NewWriter(dst).Emit(&audit.Event{
+		Event:   audit.EventRelocate,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra: map[string]any{
+			"from":     src,
+			"to":       dst,
+			"files":    files,
+			"redirect": *redirect,
+		},
+	})
+	fmt.Printf("relocated %s -> %s (%d files, redirect: %s)\n", src, dst, files, *redirect)
+	return ExitOK
+}
+
+// checkRelocateTarget rejects destinations that overlap the current root or
+// already hold data.
+func checkRelocateTarget(src, dst string) error {
+	if src == dst {
+		return fmt.Errorf("%s is already the lock root", dst)
+	}
+	if within(src, dst) || within(dst, src) {
+		return fmt.Errorf("destination %s and root %s must not contain each other", dst, src)
+	}
+	entries, err := os.ReadDir(dst)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("destination %s: %w", dst, err)
+	case len(entries) > 0:
+		return fmt.Errorf("destination %s is not empty", dst)
+	}
+	return nil
+}
+
+// within reports whether path is inside dir.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// relocateRoot moves the lock root at src to dst without a maintenance window:
+//
+//  1. A "relocating" marker in src/meta.json quiesces the old root; every
+//     lokt operation that resolves it waits (root.Follow).
+//  2. All state is copied, then re-read and compared until a pass finds no
+//     differences, catching writes that raced the marker.
+//  3. The marker is flipped to "relocated", releasing the waiters onto dst
+//     (or failing them, with redirect "fail").
+//
+// The old root is otherwise left untouched. On error the marker is removed
+// and anything created at dst is deleted, so the old root stays live.
+// It returns the number of files copied.
+func relocateRoot(src, dst, redirect string) (files int, err error) {
+	meta := root.Meta{
+		RelocatedTo: dst,
+		State:       root.StateRelocating,
+		Redirect:    redirect,
+		StartedAt:   time.Now().UTC(),
+	}
+	if err := writeMeta(src, &meta); err != nil {
+		return 0, fmt.Errorf("quiesce %s: %w", src, err)
+	}
+
+	_, statErr := os.Stat(dst)
+	createdDst := errors.Is(statErr, fs.ErrNotExist)
+	defer func() {
+		if err != nil {
+			_ = os.Remove(root.MetaPath(src))
+			if createdDst {
+				_ = os.RemoveAll(dst)
+			}
+		}
+	}()
+
+	time.Sleep(relocateSettle)
+
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return 0, err
+	}
+	verified := false
+	for round := 0; round < relocateVerifyRounds && !verified; round++ {
+		var changed int
+		files, changed, err = syncTree(src, dst)
+		if err != nil {
+			return 0, err
+		}
+		verified = round > 0 && changed == 0
+	}
+	if !verified {
+		return 0, fmt.Errorf("%s kept changing during %d copy passes", src, relocateVerifyRounds)
+	}
+
+	relocatedAt := time.Now().UTC()
+	meta.State = root.StateRelocated
+	meta.RelocatedAt = &relocatedAt
+	if err := writeMeta(src, &meta); err != nil {
+		return 0, fmt.Errorf("write redirect marker: %w", err)
+	}
+	return files, nil
+}
+
+// skipRelocate reports whether rel belongs to the old location only: the
+// redirect marker, the audit sequence lock, and in-flight atomic-write temp
+// files.
+func skipRelocate(rel string) bool {
+	base := filepath.Base(rel)
+	return rel == root.MetaFile || rel == "audit.seq.lock" ||
+		(strings.HasPrefix(base, ".lock-") && strings.HasSuffix(base, ".tmp"))
+}
+
+// syncTree makes dst an exact copy of the regular files under src. Files are
+// compared by content; only differing files are (re)written, atomically, and
+// files no longer in src are removed from dst. It returns the number of files
+// in src and how many of them had to be written.
+func syncTree(src, dst string) (files, changed int, err error) {
+	seen := make(map[string]bool)
+	err = filepath.WalkDir(src, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if errors.Is(walkErr, fs.ErrNotExist) {
+				return nil // removed mid-walk (lock released); the next pass reconciles
+			}
+			return walkErr
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == "." || skipRelocate(rel) {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return nil //nolint:nilerr // vanished mid-walk
+		}
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path) //nolint:gosec // G304: walking our own root
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files++
+		seen[rel] = true
+		existing, err := os.ReadFile(target) //nolint:gosec // G304: mirror of our own root
+		if err == nil && bytes.Equal(existing, data) {
+			return nil
+		}
+		changed++
+		return lockfile.WriteFileAtomic(target, data, info.Mode().Perm())
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Drop files that disappeared from src since an earlier pass.
+	err = filepath.WalkDir(dst, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil || d.IsDir() {
+			return walkErr
+		}
+		rel, err := filepath.Rel(dst, path)
+		if err != nil {
+			return err
+		}
+		if !seen[rel] {
+			changed++
+			return os.Remove(path)
+		}
+		return nil
+	})
+	return files, changed, err
+}
+
+// writeMeta atomically writes the relocation marker for rootDir.
+func writeMeta(rootDir string, m *root.Meta) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return lockfile.WriteFileAtomic(root.MetaPath(rootDir), append(data, '\n'), 0644)
+}
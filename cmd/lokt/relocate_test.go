@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func noRelocateSettle(t *testing.T) {
+	t.Helper()
+	old := relocateSettle
+	relocateSettle = 0
+	t.Cleanup(func() { relocateSettle = old })
+}
+
+func TestRelocate_MovesActiveState(t *testing.T) {
+	noRelocateSettle(t)
+	src, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "mover")
+	dst := filepath.Join(t.TempDir(), "new-root")
+
+	// Active state: our own TTL lock, someone else's lock, a freeze, audit
+	// history and config.
+	if err := lock.Acquire(src, "mine", lock.AcquireOptions{TTL: time.Minute, Auditor: audit.NewWriter(src)}); err != nil {
+		t.Fatal(err)
+	}
+	writeLockJSON(t, locksDir, "theirs.json", &lockfile.Lock{
+		Version: 1, Name: "theirs", Owner: "alice", Host: "elsewhere", PID: 1, AcquiredAt: time.Now(),
+	})
+	if err := lock.Freeze(src, "deploy", lock.FreezeOptions{TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "config.json"), []byte(`{"retry_after_default":"2m"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr, code := captureCmd(cmdRelocate, []string{"--to", dst})
+	if code != ExitOK {
+		t.Fatalf("relocate: exit %d, stderr %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "relocated "+src+" -> "+dst) {
+		t.Errorf("unexpected output: %s", stdout)
+	}
+
+	// Every file arrived byte-for-byte.
+	for _, rel := range []string{"locks/mine.json", "locks/theirs.json", "freezes/deploy.json", "config.json"} {
+		want, err := os.ReadFile(filepath.Join(src, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dst, rel))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s not copied intact: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dst, root.MetaFile)); !os.IsNotExist(err) {
+		t.Error("the redirect marker must stay at the old root")
+	}
+
+	meta, err := root.ReadMeta(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.State != root.StateRelocated || meta.RelocatedTo != dst || meta.Redirect != root.RedirectFollow {
+		t.Errorf("unexpected marker: %+v", meta)
+	}
+
+	// Commands still pointed at the old root operate on the new one.
+	stdout, _, _ = captureCmd(cmdStatus, nil)
+	if !strings.Contains(stdout, "mine") || !strings.Contains(stdout, "theirs") {
+		t.Errorf("status via old root should list relocated locks:\n%s", stdout)
+	}
+	if _, _, code := captureCmd(cmdUnlock, []string{"mine"}); code != ExitOK {
+		t.Fatalf("unlock via old root: exit %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "locks", "mine.json")); !os.IsNotExist(err) {
+		t.Error("unlock should have released the lock at the new root")
+	}
+
+	events := readAuditLog(t, dst)
+	var sawAcquire, sawRelocate, sawRelease bool
+	for _, e := range events {
+		switch e.Event {
+		case audit.EventAcquire:
+			sawAcquire = true
+		case audit.EventRelocate:
+			sawRelocate = true
+		case audit.EventRelease:
+			sawRelease = sawRelocate
+		}
+	}
+	if !sawAcquire || !sawRelocate || !sawRelease {
+		t.Errorf("new audit log should hold the copied history, the relocate event, then the release: %+v", events)
+	}
+}
+
+func TestRelocate_RenewFollowsRedirect(t *testing.T) {
+	noRelocateSettle(t)
+	src, _ := setupTestRoot(t)
+	dst := filepath.Join(t.TempDir(), "new-root")
+
+	if err := lock.Acquire(src, "hb", lock.AcquireOptions{TTL: 2 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, code := captureCmd(cmdRelocate, []string{"--to", dst}); code != ExitOK {
+		t.Fatal("relocate failed")
+	}
+	before, err := lockfile.Read(root.LockFilePath(dst, "hb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A heartbeat still holding the old path renews at the new location.
+	time.Sleep(10 * time.Millisecond)
+	if err := lock.Renew(src, "hb", lock.RenewOptions{}); err != nil {
+		t.Fatalf("renew via old root: %v", err)
+	}
+	after, err := lockfile.Read(root.LockFilePath(dst, "hb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ExpiresAt.After(*before.ExpiresAt) {
+		t.Errorf("renew did not land at the new root: expires %v -> %v", before.ExpiresAt, after.ExpiresAt)
+	}
+	old, _ := lockfile.Read(root.LockFilePath(src, "hb"))
+	if old == nil || !old.ExpiresAt.Equal(*before.ExpiresAt) {
+		t.Error("the old root's copy should be left untouched")
+	}
+}
+
+func TestRelocate_RedirectFail(t *testing.T) {
+	noRelocateSettle(t)
+	src, locksDir := setupTestRoot(t)
+	dst := filepath.Join(t.TempDir(), "new-root")
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", Owner: "alice", Host: "h", PID: 1, AcquiredAt: time.Now(),
+	})
+
+	if _, stderr, code := captureCmd(cmdRelocate, []string{"--to", dst, "--redirect", "fail"}); code != ExitOK {
+		t.Fatalf("relocate: exit %d, %s", code, stderr)
+	}
+
+	_, stderr, code := captureCmd(cmdStatus, nil)
+	if code != ExitError || !strings.Contains(stderr, "relocated to "+dst) {
+		t.Errorf("status via old root: exit %d, stderr %q", code, stderr)
+	}
+	if err := lock.Renew(src, "build", lock.RenewOptions{}); err == nil {
+		t.Error("renew via a fail-mode old root should error")
+	}
+
+	t.Setenv("LOKT_ROOT", dst)
+	if stdout, _, code := captureCmd(cmdStatus, nil); code != ExitOK || !strings.Contains(stdout, "build") {
+		t.Errorf("status at new root: exit %d, %s", code, stdout)
+	}
+}
+
+func TestRelocate_AcquireDuringRelocationLandsAtNewRoot(t *testing.T) {
+	src, _ := setupTestRoot(t)
+	dst := filepath.Join(t.TempDir(), "new-root")
+	old := relocateSettle
+	relocateSettle = 200 * time.Millisecond
+	defer func() { relocateSettle = old }()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := relocateRoot(src, dst, root.RedirectFollow)
+		done <- err
+	}()
+	// Wait for the quiesce marker, then acquire through the old root.
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(root.MetaPath(src)); err == nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := lock.Acquire(src, "late", lock.AcquireOptions{}); err != nil {
+		t.Fatalf("acquire during relocation: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(root.LockFilePath(dst, "late")); err != nil {
+		t.Errorf("acquire should have waited and landed at the new root: %v", err)
+	}
+	if _, err := os.Stat(root.LockFilePath(src, "late")); !os.IsNotExist(err) {
+		t.Error("acquire must not write to the quiesced old root")
+	}
+}
+
+func TestRelocate_Validation(t *testing.T) {
+	src, _ := setupTestRoot(t)
+	occupied := t.TempDir()
+	if err := os.WriteFile(filepath.Join(occupied, "x"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		nil,
+		{"--to", filepath.Join(t.TempDir(), "d"), "--redirect", "sometimes"},
+		{"--to", src},
+		{"--to", filepath.Join(src, "inside")},
+		{"--to", occupied},
+	} {
+		if _, _, code := captureCmd(cmdRelocate, args); code != ExitUsage {
+			t.Errorf("relocate %v: expected exit %d, got %d", args, ExitUsage, code)
+		}
+	}
+	if _, err := os.Stat(root.MetaPath(src)); !os.IsNotExist(err) {
+		t.Error("rejected relocation must not leave a marker")
+	}
+}
+
+func TestRelocate_RollsBackOnFailure(t *testing.T) {
+	noRelocateSettle(t)
+	src, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", Owner: "alice", Host: "h", PID: 1, AcquiredAt: time.Now(),
+	})
+	// An unreadable file makes the copy fail part-way.
+	bad := filepath.Join(locksDir, "unreadable.json")
+	if err := os.WriteFile(bad, []byte("{}"), 0000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.ReadFile(bad); err == nil {
+		t.Skip("running as root; permissions are not enforced")
+	}
+	dst := filepath.Join(t.TempDir(), "new-root")
+
+	if _, _, code := captureCmd(cmdRelocate, []string{"--to", dst}); code != ExitError {
+		t.Fatalf("expected relocate to fail, got exit %d", code)
+	}
+	if _, err := os.Stat(root.MetaPath(src)); !os.IsNotExist(err) {
+		t.Error("failed relocation must remove the quiesce marker")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Error("failed relocation must remove the partial destination")
+	}
+}
+
+// TestRelocate_LiveGuard relocates while a guard with a heartbeat holds a
+// lock: the heartbeat must keep the lock alive at the new root and the
+// guard's final release must land there too.
+func TestRelocate_LiveGuard(t *testing.T) {
+	binary := buildBinary(t)
+	src := setupIntegrationRoot(t)
+	dst := filepath.Join(t.TempDir(), "new-root")
+	const name = "live"
+
+	guard := exec.Command(binary, "guard", "--ttl", "2s", name, "--", "sleep", "4")
+	guard.Env = []string{
+		"LOKT_ROOT=" + src,
+		"LOKT_OWNER=guard-agent",
+		"HOME=" + os.Getenv("HOME"),
+		"PATH=" + os.Getenv("PATH"),
+	}
+	if err := guard.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = guard.Process.Kill() }()
+
+	srcLock := root.LockFilePath(src, name)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(srcLock); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if _, err := os.Stat(srcLock); err != nil {
+		t.Fatal("guard never acquired the lock")
+	}
+
+	if _, stderr, code := runLokt(t, binary, src, "relocate", "--to", dst); code != ExitOK {
+		t.Fatalf("relocate: exit %d, %s", code, stderr)
+	}
+
+	// Past the original 2s TTL the lock must still be live at the new root.
+	time.Sleep(2500 * time.Millisecond)
+	lf, err := lockfile.Read(root.LockFilePath(dst, name))
+	if err != nil {
+		t.Fatalf("lock missing at new root: %v", err)
+	}
+	if lf.IsExpired() {
+		t.Errorf("heartbeat did not renew at the new root (expires %v)", lf.ExpiresAt)
+	}
+	if stdout, _, code := runLoktAs(t, binary, dst, "other", "lock", name); code != ExitLockHeld {
+		t.Errorf("lock at new root should still be held, exit %d: %s", code, stdout)
+	}
+
+	if err := guard.Wait(); err != nil {
+		t.Fatalf("guard: %v", err)
+	}
+	if _, err := os.Stat(root.LockFilePath(dst, name)); !os.IsNotExist(err) {
+		t.Error("guard release should have removed the lock at the new root")
+	}
+	var renewedAtDst bool
+	for _, e := range readAuditLog(t, dst) {
+		if e.Event == audit.EventRenew {
+			renewedAtDst = true
+		}
+	}
+	if !renewedAtDst {
+		t.Error("expected renew events in the new root's audit log")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestRenew(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "me")
+	if _, _, code := captureCmd(cmdLock, []string{"build", "--ttl", "2m"}); code != ExitOK {
+		t.Fatalf("lock: exit %d", code)
+	}
+
+	stdout, stderr, code := captureCmd(cmdRenew, []string{"build", "--ttl", "10m"})
+	if code != ExitOK {
+		t.Fatalf("renew: exit %d (stderr %q)", code, stderr)
+	}
+	if !strings.HasPrefix(stdout, `renewed lock "build", expires `) || !strings.Contains(stdout, "(in 10m0s)") {
+		t.Errorf("stdout = %q, want the new expiry", stdout)
+	}
+	lf, err := lockfile.Read(filepath.Join(locksDir, "build.json"))
+	if err != nil || lf.TTLSec != 600 {
+		t.Fatalf("lock after renew = %+v, %v; want TTL 600s", lf, err)
+	}
+
+	// Without --ttl the TTL is kept and only restarted.
+	if _, _, code := captureCmd(cmdRenew, []string{"build"}); code != ExitOK {
+		t.Fatalf("renew without --ttl: exit %d", code)
+	}
+	if lf, _ := lockfile.Read(filepath.Join(locksDir, "build.json")); lf == nil || lf.TTLSec != 600 {
+		t.Errorf("lock after plain renew = %+v, want TTL kept at 600s", lf)
+	}
+
+	renews := 0
+	for _, e := range readAuditLog(t, rootDir) {
+		if e.Event == audit.EventRenew && e.Name == "build" {
+			renews++
+		}
+	}
+	if renews != 2 {
+		t.Errorf("renew events = %d, want 2", renews)
+	}
+
+	t.Setenv("LOKT_OWNER", "other")
+	if _, stderr, code := captureCmd(cmdRenew, []string{"build"}); code != ExitNotOwner {
+		t.Errorf("renew by another owner: exit %d (stderr %q), want %d", code, stderr, ExitNotOwner)
+	}
+	if _, stderr, code := captureCmd(cmdRenew, []string{"missing"}); code != ExitNotFound || !strings.Contains(stderr, `lock "missing" not found`) {
+		t.Errorf("renew missing: exit %d (stderr %q), want %d", code, stderr, ExitNotFound)
+	}
+	if _, _, code := captureCmd(cmdRenew, nil); code != ExitUsage {
+		t.Errorf("renew without a name: exit %d, want %d", code, ExitUsage)
+	}
+}
+
+func TestRenew_Shared(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "me")
+	if _, _, code := captureCmd(cmdLock, []string{"--shared", "reports"}); code != ExitOK {
+		t.Fatalf("lock --shared: exit %d", code)
+	}
+	stdout, stderr, code := captureCmd(cmdRenew, []string{"reports", "--ttl", "5m"})
+	if code != ExitOK || !strings.Contains(stdout, "(in 5m0s)") {
+		t.Errorf("renew shared: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// reservationOutput is one reservation in lokt reserve --json and lokt
+// reservations --json.
+type reservationOutput struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`
+	CreatedBy string `json:"created_by"`
+	Host      string `json:"host"`
+	From      string `json:"from"`
+	Until     string `json:"until"`
+	Active    bool   `json:"active"` // the window has started
+	Reason    string `json:"reason,omitempty"`
+}
+
+func reservationOutputOf(r *lock.Reservation, now time.Time) reservationOutput {
+	return reservationOutput{
+		ID:        r.ID,
+		Name:      r.Name,
+		Owner:     r.Owner,
+		CreatedBy: r.CreatedBy,
+		Host:      r.Host,
+		From:      r.From.UTC().Format(time.RFC3339),
+		Until:     r.Until.UTC().Format(time.RFC3339),
+		Active:    !now.Before(r.From),
+		Reason:    r.Reason,
+	}
+}
+
+// parseWindowTime parses the --from or --until time of lokt reserve.
+func parseWindowTime(flagName, s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("--%s %q is not an RFC 3339 time (e.g., 2026-02-01T14:00:00Z)", flagName, s)
+	}
+	return t, nil
+}
+
+func cmdReserve(args []string) int {
+	fs := flag.NewFlagSet("reserve", flag.ExitOnError)
+	from := fs.String("from", "", "Start of the window, RFC 3339 (default: now)")
+	until := fs.String("until", "", "End of the window, RFC 3339 (required)")
+	owner := fs.String("owner", "", "Reserve for this owner (default: the current owner)")
+	reason := fs.String("reason", "", "What the window is for; shown to those it refuses")
+	jsonOutput := fs.Bool("json", false, "Output the reservation as JSON")
+	_ = fs.Parse(interspersed(fs, args))
+
+	if fs.NArg() != 1 || *until == "" {
+		fmt.Fprintln(os.Stderr, "usage: lokt reserve --until <time> [--from <time>] [--owner name] [--reason text] [--json] <name>")
+		return ExitUsage
+	}
+	name := fs.Arg(0)
+	var opts lock.ReserveOptions
+	var err error
+	if opts.Until, err = parseWindowTime("until", *until); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+	if *from != "" {
+		if opts.From, err = parseWindowTime("from", *from); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitUsage
+		}
+	}
+	if n := utf8.RuneCountInString(*reason); n > lockfile.MaxMessageLen {
+		fmt.Fprintf(os.Stderr, "error: --reason is %d characters, at most %d allowed\n", n, lockfile.MaxMessageLen)
+		return ExitUsage
+	}
+	opts.Owner, opts.Reason = *owner, *reason
+
+	rootDir, err := root.Find()
+	if err != nil {
+		reportError(name, err, "")
+		return ExitError
+	}
+	if code := checkWritable(rootDir, name); code != ExitOK {
+		return code
+	}
+	opts.SkewGrace = skewGrace(rootDir)
+	opts.Auditor = newAuditor(rootDir)
+
+	r, err := lock.Reserve(rootDir, name, opts)
+	if err != nil {
+		reportError(name, err, "")
+		if errors.Is(err, lock.ErrReserved) {
+			return ExitLockHeld
+		}
+		return ExitError
+	}
+	if *jsonOutput {
+		data, _ := json.MarshalIndent(reservationOutputOf(r, time.Now()), "", "  ")
+		fmt.Println(string(data))
+		return ExitOK
+	}
+	fmt.Printf("reserved %q for %s from %s to %s (id %s)\n",
+		name, r.Owner, r.From.Format(time.RFC3339), r.Until.Format(time.RFC3339), r.ID)
+	warnReservationHolder(rootDir, r)
+	return ExitOK
+}
+
+// warnReservationHolder warns if someone other than r's owner holds its
+// name: a reservation refuses new holds, but doesn't end this one.
+func warnReservationHolder(rootDir string, r *lock.Reservation) {
+	lf, err := lockfile.Read(root.LockFilePath(rootDir, r.Name))
+	if err != nil || lf.Owner == r.Owner {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "warning: %q is held by %s@%s, which the reservation doesn't end\n", r.Name, lf.Owner, lf.Host)
+}
+
+func cmdUnreserve(args []string) int {
+	fs := flag.NewFlagSet("unreserve", flag.ExitOnError)
+	id := fs.String("id", "", "Cancel only this reservation (default: all of yours)")
+	force := fs.Bool("force", false, "Cancel others' reservations too (break-glass)")
+	_ = fs.Parse(interspersed(fs, args))
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: lokt unreserve [--id id] [--force] <name>")
+		return ExitUsage
+	}
+	name := fs.Arg(0)
+	rootDir, err := root.Find()
+	if err != nil {
+		reportError(name, err, "")
+		return ExitError
+	}
+	if code := checkWritable(rootDir, name); code != ExitOK {
+		return code
+	}
+
+	cancelled, err := lock.Unreserve(rootDir, name, lock.UnreserveOptions{ID: *id, Force: *force, Auditor: newAuditor(rootDir)})
+	if err != nil {
+		switch {
+		case errors.Is(err, lock.ErrNotFound):
+			msg := fmt.Sprintf("error: no reservation of %q to cancel (lokt reservations lists them)", name)
+			if *id != "" {
+				msg = fmt.Sprintf("error: no reservation %s of %q", *id, name)
+			}
+			reportError(name, err, msg)
+			return ExitNotFound
+		case errors.Is(err, lock.ErrNotOwner):
+			reportError(name, err, "")
+			return ExitNotOwner
+		}
+		reportError(name, err, "")
+		return ExitError
+	}
+	for _, r := range cancelled {
+		fmt.Printf("cancelled reservation %s of %q for %s (%s to %s)\n",
+			r.ID, name, r.Owner, r.From.Format(time.RFC3339), r.Until.Format(time.RFC3339))
+	}
+	return ExitOK
+}
+
+// cmdReservations lists the reservations that haven't ended, of one name
+// or of all.
+func cmdReservations(args []string) int {
+	fs := flag.NewFlagSet("reservations", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	_ = fs.Parse(interspersed(fs, args))
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: lokt reservations [--json] [name]")
+		return ExitUsage
+	}
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	list, err := lock.Reservations(rootDir, fs.Arg(0), skewGrace(rootDir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	now := time.Now()
+	outputs := make([]reservationOutput, 0, len(list))
+	for _, r := range list {
+		outputs = append(outputs, reservationOutputOf(r, now))
+	}
+	if *jsonOutput {
+		data, _ := json.MarshalIndent(outputs, "", "  ")
+		fmt.Println(string(data))
+		return ExitOK
+	}
+	printReservations(os.Stdout, list, now)
+	return ExitOK
+}
+
+// printReservations prints reservations as lokt reservations does without
+// --json.
+func printReservations(w io.Writer, list []*lock.Reservation, now time.Time) {
+	if len(list) == 0 {
+		fmt.Fprintln(w, "no reservations")
+		return
+	}
+	fmt.Fprintf(w, "%-20s  %-16s  %-16s  %-22s  %-22s  %s\n", "NAME", "ID", "OWNER", "FROM", "UNTIL", "REASON")
+	for _, r := range list {
+		from := lock.FormatFreezeEnd(r.From, now)
+		if !now.Before(r.From) {
+			from = "now (active)"
+		}
+		fmt.Fprintf(w, "%-20s  %-16s  %-16s  %-22s  %-22s  %s\n",
+			r.Name, r.ID, r.Owner, from, lock.FormatFreezeEnd(r.Until, now), r.Reason)
+	}
+}
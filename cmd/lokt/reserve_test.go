@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReserve(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "alice")
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	stdout, stderr, code := captureCmd(cmdReserve, []string{"deploy", "--until", until, "--reason", "release"})
+	if code != ExitOK || !strings.Contains(stdout, `reserved "deploy" for alice`) {
+		t.Fatalf("reserve: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+
+	t.Setenv("LOKT_OWNER", "bob")
+	if _, stderr, code := captureCmd(cmdLock, []string{"deploy"}); code != ExitLockHeld || !strings.Contains(stderr, "reserved for alice") {
+		t.Errorf("lock by bob: exit %d, stderr %q; want %d", code, stderr, ExitLockHeld)
+	}
+	if _, stderr, code := captureCmd(cmdGuard, []string{"deploy", "--", "true"}); code != ExitLockHeld {
+		t.Errorf("guard by bob: exit %d, stderr %q; want %d", code, stderr, ExitLockHeld)
+	}
+	if _, _, code := captureCmd(cmdReserve, []string{"--until", until, "deploy"}); code != ExitLockHeld {
+		t.Errorf("overlapping reserve by bob: exit %d, want %d", code, ExitLockHeld)
+	}
+	if _, _, code := captureCmd(cmdUnreserve, []string{"deploy"}); code != ExitNotOwner {
+		t.Errorf("unreserve by bob: exit %d, want %d", code, ExitNotOwner)
+	}
+
+	t.Setenv("LOKT_OWNER", "alice")
+	if _, stderr, code := captureCmd(cmdLock, []string{"deploy"}); code != ExitOK {
+		t.Errorf("lock by alice: exit %d, stderr %q", code, stderr)
+	}
+	if _, _, code := captureCmd(cmdUnlock, []string{"deploy"}); code != ExitOK {
+		t.Errorf("unlock by alice: exit %d", code)
+	}
+
+	for _, args := range [][]string{
+		{"deploy"},                          // no --until
+		{"--until", "in an hour", "deploy"}, // not RFC 3339
+		{"--until", until, "--from", "soon", "deploy"},
+		{"--until", until},
+	} {
+		if _, _, code := captureCmd(cmdReserve, args); code != ExitUsage {
+			t.Errorf("reserve %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+
+	if _, _, code := captureCmd(cmdUnreserve, []string{"deploy"}); code != ExitOK {
+		t.Fatalf("unreserve by alice: exit %d", code)
+	}
+	if _, stderr, code := captureCmd(cmdUnreserve, []string{"deploy"}); code != ExitNotFound || !strings.Contains(stderr, "no reservation") {
+		t.Errorf("second unreserve: exit %d, stderr %q; want %d", code, stderr, ExitNotFound)
+	}
+}
+
+func TestReservations(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "alice")
+	if stdout, _, code := captureCmd(cmdReservations, nil); code != ExitOK || !strings.Contains(stdout, "no reservations") {
+		t.Errorf("reservations with none: exit %d, stdout %q", code, stdout)
+	}
+	now := time.Now()
+	for _, args := range [][]string{
+		{"--until", now.Add(time.Hour).Format(time.RFC3339), "deploy"},
+		{"--from", now.Add(2 * time.Hour).Format(time.RFC3339), "--until", now.Add(3 * time.Hour).Format(time.RFC3339), "--owner", "bob", "build"},
+	} {
+		if _, stderr, code := captureCmd(cmdReserve, args); code != ExitOK {
+			t.Fatalf("reserve %v: exit %d, stderr %q", args, code, stderr)
+		}
+	}
+
+	stdout, _, code := captureCmd(cmdReservations, nil)
+	if code != ExitOK || !strings.Contains(stdout, "now (active)") || !strings.Contains(stdout, "bob") {
+		t.Errorf("reservations: exit %d, stdout %q", code, stdout)
+	}
+
+	stdout, _, code = captureCmd(cmdReservations, []string{"build", "--json"})
+	var out []reservationOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil || code != ExitOK {
+		t.Fatalf("reservations --json: exit %d, %v: %q", code, err, stdout)
+	}
+	if len(out) != 1 || out[0].Owner != "bob" || out[0].CreatedBy != "alice" || out[0].Active {
+		t.Errorf("reservations --json build = %+v", out)
+	}
+
+	// alice made bob's reservation, so may cancel it.
+	if _, _, code := captureCmd(cmdUnreserve, []string{"build", "--id", out[0].ID}); code != ExitOK {
+		t.Errorf("unreserve build by its creator: exit %d", code)
+	}
+	if _, _, code := captureCmd(cmdReservations, []string{"a", "b"}); code != ExitUsage {
+		t.Errorf("reservations a b: exit %d, want %d", code, ExitUsage)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/policy"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// retryAfterDefault returns the configured retry hint for denials by holders
+// without a TTL (retry_after_default in config.json), or zero for the
+// built-in default. A broken config is reported but never fails the command.
+func retryAfterDefault(rootDir string) time.Duration {
+	cfg, err := config.Load(rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring config: %v\n", err)
+		return 0
+	}
+	return time.Duration(cfg.RetryAfterDefault)
+}
+
+// adaptiveBackoff reports whether --wait polling may slow down when many
+// processes wait for the same lock (adaptive_backoff in config.json,
+// default on). Config errors are already reported by retryAfterDefault.
+func adaptiveBackoff(rootDir string) bool {
+	cfg, err := config.Load(rootDir)
+	return err != nil || cfg.AdaptiveBackoffEnabled()
+}
+
+// flockLocks reports whether guards keep a flock on their lock files
+// (flock in config.json). Config errors are already reported by
+// retryAfterDefault.
+func flockLocks(rootDir string) bool {
+	cfg, err := config.Load(rootDir)
+	return err == nil && cfg.Flock
+}
+
+// exclusionGroups returns the configured exclusion groups (exclusion_groups
+// in config.json). Config errors are already reported by retryAfterDefault.
+func exclusionGroups(rootDir string) map[string][]string {
+	cfg, err := config.Load(rootDir)
+	if err != nil {
+		return nil
+	}
+	return cfg.ExclusionGroups
+}
+
+// defaultTTL returns the TTL for lock and guard on name when --ttl isn't
+// given: default_ttl of name's policy.json rule, else default_ttl in
+// config.json, else zero for none. An empty name (lock --batch) skips the
+// policy; each lock still gets its rule's default when acquired. Config
+// errors are already reported by retryAfterDefault, policy errors by the
+// acquisition.
+func defaultTTL(rootDir, name string) time.Duration {
+	if p, err := policy.Load(rootDir); err == nil && name != "" {
+		if _, rule, ok := p.Match(name); ok && rule.DefaultTTL > 0 {
+			return time.Duration(rule.DefaultTTL)
+		}
+	}
+	cfg, err := config.Load(rootDir)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(cfg.DefaultTTL)
+}
+
+// waitRetryPolicy returns the polling schedule for --wait: the default one,
+// capped at wait_poll_interval from config.json if set. Config errors are
+// already reported by retryAfterDefault.
+func waitRetryPolicy(rootDir string) lock.RetryPolicy {
+	cfg, err := config.Load(rootDir)
+	if err != nil || cfg.WaitPollInterval <= 0 {
+		return lock.RetryPolicy{}
+	}
+	p := lock.DefaultRetryPolicy
+	p.Max = time.Duration(cfg.WaitPollInterval)
+	p.Base = min(p.Base, p.Max)
+	return p
+}
+
+// skewGrace returns how long past expiry another host's lock must be before
+// it is broken or swept (clock_skew_grace in config.json, default 30s). A
+// broken config falls back to the default.
+func skewGrace(rootDir string) time.Duration {
+	cfg, err := config.Load(rootDir)
+	if err != nil {
+		return stale.DefaultSkewGrace
+	}
+	return cfg.EffectiveSkewGrace()
+}
+
+// watchInterval returns how often status --watch redraws when --interval
+// isn't given: watch_interval from config.json, else DefaultWatchInterval.
+func watchInterval(rootDir string) time.Duration {
+	cfg, err := config.Load(rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring config: %v\n", err)
+		return DefaultWatchInterval
+	}
+	if cfg.WatchInterval <= 0 {
+		return DefaultWatchInterval
+	}
+	return time.Duration(cfg.WatchInterval)
+}
+
+// flagGiven reports whether the flag name was set on the command line, as
+// opposed to left at its default.
+func flagGiven(fs *flag.FlagSet, name string) bool {
+	given := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			given = true
+		}
+	})
+	return given
+}
+
+// freezeRetryAfter returns the retry hint for the freeze on name, used when a
+// thaw wait times out. If the freeze has lifted in the meantime the hint is
+// lock.MinRetryAfter.
+func freezeRetryAfter(rootDir, name string) time.Duration {
+	var frozen *lock.FrozenError
+	if errors.As(lock.CheckFreeze(rootDir, name, nil), &frozen) {
+		return frozen.RetryAfter
+	}
+	return lock.MinRetryAfter
+}
+
+// lockTimeoutMessage is the error printed when --wait times out on name. lf
+// is the current holder, or nil if it could not be read; err is the wait's
+// error, a *lock.WaitError when it counted its attempts.
+func lockTimeoutMessage(name string, lf *lockfile.Lock, fallback time.Duration, note string, err error) string {
+	hint := lock.FormatRetryAfter(lock.RetryAfter(lf, fallback))
+	var waitErr *lock.WaitError
+	if errors.As(err, &waitErr) {
+		waited := waitErr.Waited.Round(time.Second)
+		if waited == 0 {
+			waited = waitErr.Waited.Round(time.Millisecond)
+		}
+		hint = fmt.Sprintf("gave up after %d attempts over %s; %s", waitErr.Attempts, waited, hint)
+	}
+	if lf == nil {
+		return fmt.Sprintf("error: timeout waiting for lock %q%s; %s", name, note, hint)
+	}
+	return fmt.Sprintf("error: timeout waiting for lock %q held by %s@%s (pid %d) for %s%s; %s",
+		name, lf.Owner, lf.Host, lf.PID, lf.Age().Truncate(time.Second), note, hint)
+}
+
+// checkPollFlags validates --poll-min and --poll-max (zero: not given).
+func checkPollFlags(pollMin, pollMax time.Duration, wait bool) error {
+	switch {
+	case (pollMin != 0 || pollMax != 0) && !wait:
+		return errors.New("--poll-min/--poll-max require --wait")
+	case pollMin < 0 || pollMax < 0:
+		return errors.New("--poll-min and --poll-max must be positive (e.g., 100ms, 30s)")
+	case pollMin > 0 && pollMax > 0 && pollMin > pollMax:
+		return fmt.Errorf("--poll-min %s exceeds --poll-max %s", pollMin, pollMax)
+	}
+	return nil
+}
+
+// withPollFlags applies --poll-min (the first interval) and --poll-max (the
+// cap) to the --wait schedule p. A --poll-min above the cap raises the cap
+// with it.
+func withPollFlags(p lock.RetryPolicy, pollMin, pollMax time.Duration) lock.RetryPolicy {
+	if pollMin == 0 && pollMax == 0 {
+		return p
+	}
+	if p.Base <= 0 && p.Max <= 0 {
+		p = lock.DefaultRetryPolicy
+	}
+	if pollMax > 0 {
+		p.Max = pollMax
+		p.Base = min(p.Base, p.Max)
+	}
+	if pollMin > 0 {
+		p.Base = pollMin
+		p.Max = max(p.Max, p.Base)
+	}
+	return p
+}
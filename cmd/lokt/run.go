@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/guard"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// runReleaseCmd is the hidden command lokt run --post-release starts to
+// release the lock once the command has exited.
+const runReleaseCmd = "_run-release"
+
+// cmdRun acquires a lock and then becomes the command (execve), so the
+// lock's PID is the command's own. See guard.Runner.Exec.
+func cmdRun(args []string) int {
+	dashIdx := -1
+	for i, arg := range args {
+		if arg == "--" {
+			dashIdx = i
+			break
+		}
+	}
+	if dashIdx == -1 || dashIdx == 0 || dashIdx == len(args)-1 {
+		fmt.Fprintln(os.Stderr, "usage: lokt run [flags] <name> -- <command...>")
+		return ExitUsage
+	}
+
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	ttl := fs.Duration("ttl", 0, "Lock TTL; not renewed, so it must cover the whole command")
+	wait := fs.Bool("wait", false, "Wait for lock to be free")
+	timeout := fs.Duration("timeout", 0, "Maximum time to wait (requires --wait)")
+	waitThaw := fs.Bool("wait-thaw", false, "Wait for an active freeze to lift instead of failing")
+	noAdaptive := fs.Bool("no-adaptive", false, "Don't slow polling when many others wait for the same lock")
+	pollMin := fs.Duration("poll-min", 0, "First --wait poll interval (default 50ms)")
+	pollMax := fs.Duration("poll-max", 0, "Longest --wait poll interval (default 2s or wait_poll_interval)")
+	postRelease := fs.Bool("post-release", false, "Start a small watcher that releases the lock when the command exits")
+	shell := fs.Bool("shell", false, "Run the command, given as one string, through $SHELL -c (or /bin/sh -c)")
+	fs.BoolVar(shell, "c", false, "Short for --shell")
+	message := fs.String("message", "", "What the lock is held for, shown to those it blocks")
+	fs.StringVar(message, "m", "", "Short for --message")
+	labels := labelFlag{}
+	fs.Var(labels, "label", "Attach a key=value label (repeatable)")
+	if err := fs.Parse(interspersed(fs, args[:dashIdx])); err != nil || fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: lokt run [flags] <name> -- <command...>")
+		return ExitUsage
+	}
+	name := fs.Arg(0)
+	cmdArgs := args[dashIdx+1:]
+	if *shell && len(cmdArgs) != 1 {
+		fmt.Fprintln(os.Stderr, "error: --shell takes the command as one quoted string, e.g. lokt run --shell build -- 'make build && make test'")
+		return ExitUsage
+	}
+	if *ttl < 0 {
+		fmt.Fprintln(os.Stderr, "error: TTL must be positive (e.g., 5m, 1h)")
+		return ExitUsage
+	}
+	if *timeout > 0 && !*wait && !*waitThaw {
+		fmt.Fprintln(os.Stderr, "error: --timeout requires --wait or --wait-thaw")
+		return ExitUsage
+	}
+	if *timeout < 0 {
+		fmt.Fprintln(os.Stderr, "error: --timeout must be positive (e.g., 5s, 1m)")
+		return ExitUsage
+	}
+	if err := checkPollFlags(*pollMin, *pollMax, *wait); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		reportError(name, err, "")
+		return ExitError
+	}
+
+	// No default TTL from config: nothing renews it, and a lock expiring
+	// under a command still running is the failure lokt run exists to avoid.
+	opts := lock.AcquireOptions{
+		TTL:               *ttl,
+		Auditor:           newAuditor(rootDir),
+		RetryAfterDefault: retryAfterDefault(rootDir),
+		NoAdaptive:        *noAdaptive || !adaptiveBackoff(rootDir),
+		ExclusionGroups:   exclusionGroups(rootDir),
+		Retry:             withPollFlags(waitRetryPolicy(rootDir), *pollMin, *pollMax),
+		Message:           *message,
+		Labels:            labels,
+		SkewGrace:         skewGrace(rootDir),
+		Session:           os.Getenv(lock.EnvLoktSession),
+	}
+	ctx := context.Background()
+	if *wait || *waitThaw {
+		var cancel context.CancelFunc
+		ctx, cancel = waitContext(*timeout, time.Time{})
+		defer cancel()
+	}
+
+	runner := guard.New(guard.Options{
+		RootDir:   rootDir,
+		Name:      name,
+		Command:   cmdArgs,
+		Shell:     *shell,
+		Acquire:   opts,
+		Wait:      *wait,
+		WaitThaw:  *waitThaw,
+		Inherited: guard.Inherited(rootDir, name, false),
+	}, guard.Hooks{
+		OnWaiting: func(stage guard.Stage, lk *lockfile.Lock) {
+			if stage == guard.StageFreeze {
+				reportThawWait(name, lk)
+			}
+		},
+		BeforeExec: func(lf *lockfile.Lock) error {
+			if *postRelease {
+				if err := startRunReleaser(rootDir, name, lf.LockID); err != nil {
+					return fmt.Errorf("start releaser: %w", err)
+				}
+			}
+			// Nothing runs after the exec: deliver the acquire event now.
+			waitNotifiers()
+			return nil
+		},
+		OnRelease: func(err error) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "warning: could not release lock %q: %v\n", name, err)
+			}
+		},
+	})
+
+	res, err := runner.Exec(ctx) // returns only on failure
+	switch {
+	case errors.Is(err, guard.ErrExecUnsupported):
+		fmt.Fprintf(os.Stderr, "error: lokt run: %v\n", err)
+		return ExitUsage
+	case res.Stage == guard.StageFreeze:
+		var frozen *lock.FrozenError
+		if errors.As(err, &frozen) {
+			reportError(name, err, "")
+			return exitFrozen()
+		}
+		return thawWaitExit(ctx, rootDir, name, err)
+	case res.Stage == guard.StageAcquire:
+		if errors.Is(err, context.DeadlineExceeded) {
+			lf, _ := lockfile.Read(root.LockFilePath(rootDir, name)) // nil if unreadable
+			reportError(name, &timeoutError{lf, lock.RetryAfter(lf, opts.RetryAfterDefault)},
+				lockTimeoutMessage(name, lf, opts.RetryAfterDefault, "", err))
+			return exitTimeout()
+		}
+		if errors.Is(err, lock.ErrDeadlock) {
+			reportError(name, err, "")
+			return ExitDeadlock
+		}
+		var held *lock.HeldError
+		if errors.As(err, &held) {
+			reportError(name, err, "")
+			return ExitLockHeld
+		}
+	case res.Stage == guard.StageStart:
+		reportError(name, err, fmt.Sprintf("error: failed to start command: %v", err))
+		return ExitError
+	}
+	reportError(name, err, "")
+	return ExitError
+}
+
+// startRunReleaser starts lokt _run-release for the lock lokt run is about
+// to hand to its command, detached so it outlives this process.
+func startRunReleaser(rootDir, name, lockID string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(self, runReleaseCmd, rootDir, name, lockID) //nolint:gosec // G204: our own executable
+	guard.Detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// cmdRunRelease implements the hidden "lokt _run-release <root> <name>
+// <lock_id>": wait for the holder of that acquisition to exit, then release
+// it.
+func cmdRunRelease(args []string) int {
+	if len(args) != 3 {
+		fmt.Fprintf(os.Stderr, "usage: lokt %s <root> <name> <lock_id>\n", runReleaseCmd)
+		return ExitUsage
+	}
+	rootDir, name, lockID := args[0], args[1], args[2]
+	if err := guard.ReleaseWhenGone(context.Background(), rootDir, name, lockID, newAuditor(rootDir)); err != nil {
+		fmt.Fprintf(os.Stderr, "error: release %q: %v\n", name, err)
+		return ExitError
+	}
+	return ExitOK
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestRun_Usage(t *testing.T) {
+	setupTestRoot(t)
+
+	for _, args := range [][]string{
+		{"build"},
+		{"--", "true"},
+		{"build", "--"},
+		{"--shell", "build", "--", "echo", "hi"},
+		{"--timeout", "5s", "build", "--", "true"},
+	} {
+		_, _, code := captureCmd(cmdRun, args)
+		if code != ExitUsage {
+			t.Errorf("args %v: expected exit %d, got %d", args, ExitUsage, code)
+		}
+	}
+}
+
+// TestIntegration_RunExecsUnderLock checks the command is the lock holder
+// itself and that --post-release frees the lock after it exits.
+func TestIntegration_RunExecsUnderLock(t *testing.T) {
+	binary := buildBinary(t)
+	rootDir := setupIntegrationRoot(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+
+	_, stderr, code := runLokt(t, binary, rootDir, "run", "--post-release", "--ttl", "5m", "deploy", "--",
+		"sh", "-c", `echo $$ > "$1"; exit 3`, "sh", pidFile)
+	if code != 3 {
+		t.Fatalf("run: exit %d, want the command's 3 (stderr: %s)", code, stderr)
+	}
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("command didn't run: %v", err)
+	}
+	cmdPID, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+
+	// The releaser notices the exit within its poll interval.
+	path := filepath.Join(rootDir, "locks", "deploy.json")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("lock still held after the command exited")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	audit, _ := os.ReadFile(filepath.Join(rootDir, "audit.log"))
+	if !strings.Contains(string(audit), `"pid":`+strconv.Itoa(cmdPID)) {
+		t.Errorf("expected the acquire recorded under the command's PID %d:\n%s", cmdPID, audit)
+	}
+}
+
+func TestIntegration_RunHeld(t *testing.T) {
+	binary := buildBinary(t)
+	rootDir := setupIntegrationRoot(t)
+	if err := lockfile.Write(filepath.Join(rootDir, "locks", "deploy.json"), &lockfile.Lock{
+		Version: 1, Name: "deploy", Owner: "someone-else", Host: "other-host", PID: 1, AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, code := runLokt(t, binary, rootDir, "run", "deploy", "--", "true")
+	if code != ExitLockHeld {
+		t.Errorf("run on a held lock: exit %d, want %d", code, ExitLockHeld)
+	}
+	// Flags may follow the name, as in the README.
+	_, _, code = runLokt(t, binary, rootDir, "run", "deploy", "--ttl", "30m", "--post-release", "--", "true")
+	if code != ExitLockHeld {
+		t.Errorf("run with flags after the name: exit %d, want %d", code, ExitLockHeld)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nikolasavic/lokt/internal/doctor"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// stripScopeFlag removes leading --scope flags ("--scope user" or
+// "--scope=user") from args and exports the last one as LOKT_SCOPE, so root
+// discovery here and in any lokt the command starts uses that scope.
+func stripScopeFlag(args []string) ([]string, error) {
+	for len(args) > 0 {
+		name, value, hasValue := strings.Cut(args[0], "=")
+		if name != "--scope" && name != "-scope" {
+			break
+		}
+		args = args[1:]
+		if !hasValue {
+			if len(args) == 0 {
+				return nil, errors.New("--scope needs a value: repo, user or system")
+			}
+			value, args = args[0], args[1:]
+		}
+		scope, err := root.ParseScope(value)
+		if err != nil {
+			return nil, fmt.Errorf("--scope: %w", err)
+		}
+		if err := os.Setenv(root.EnvLoktScope, string(scope)); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// stripRootFlag removes leading --root flags ("--root path" or
+// "--root=path") from args and exports the last one, made absolute, as
+// LOKT_ROOT, clearing LOKT_SCOPE so the root is used whatever the scope; a
+// later --scope still takes over. Any lokt the command starts uses the same
+// root, wherever it runs.
+func stripRootFlag(args []string) ([]string, error) {
+	for len(args) > 0 {
+		name, value, hasValue := strings.Cut(args[0], "=")
+		if name != "--root" && name != "-root" {
+			break
+		}
+		args = args[1:]
+		if !hasValue {
+			if len(args) == 0 {
+				return nil, errors.New("--root needs a directory")
+			}
+			value, args = args[0], args[1:]
+		}
+		if value == "" {
+			return nil, errors.New("--root needs a directory")
+		}
+		abs, err := filepath.Abs(value)
+		if err != nil {
+			return nil, fmt.Errorf("--root: %w", err)
+		}
+		if err := os.Setenv(root.EnvLoktRoot, abs); err != nil {
+			return nil, err
+		}
+		if err := os.Unsetenv(root.EnvLoktScope); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// warnRootAmbiguity warns on stderr if roots other than the one in use
+// hold locks or freezes (see root.Ambiguity). Best-effort: discovery
+// errors are left to the command to report.
+func warnRootAmbiguity() {
+	cands, err := root.FindAll()
+	if err != nil {
+		return
+	}
+	if err := root.Ambiguity(cands); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
+
+// checkRootAmbiguity is doctor's check of the roots discovery could use.
+func checkRootAmbiguity() doctor.CheckResult {
+	cands, err := root.FindAll()
+	if err != nil {
+		return doctor.CheckResult{Name: "root_ambiguity", Status: doctor.StatusWarn, Message: err.Error()}
+	}
+	return doctor.CheckRootAmbiguity(cands)
+}
+
+// skippedSystemRoots returns the system scope locations passed over to get
+// to the root in use, with the reason, for lokt doctor; nil unless method is
+// the system scope.
+func skippedSystemRoots(method root.DiscoveryMethod) []string {
+	if method != root.MethodSystemScope {
+		return nil
+	}
+	_, skipped, _ := root.SystemRoot()
+	var out []string
+	for _, s := range skipped {
+		out = append(out, fmt.Sprintf("%s: %v", s.Path, s.Err))
+	}
+	return out
+}
+
+// checkWritable reports a root that can't be changed (root.CheckWritable)
+// for a command on name about to change it and returns ExitReadOnly, or
+// returns ExitOK.
+func checkWritable(rootDir, name string) int {
+	if err := root.CheckWritable(rootDir); err != nil {
+		reportError(name, err, "")
+		return ExitReadOnly
+	}
+	return ExitOK
+}
+
+// stripReadOnlyFlag removes leading --read-only flags from args and turns
+// read-only mode on (LOKT_READ_ONLY, inherited by any lokt the command
+// starts) if there were any.
+func stripReadOnlyFlag(args []string) []string {
+	for len(args) > 0 && (args[0] == "--read-only" || args[0] == "-read-only") {
+		_ = os.Setenv(root.EnvReadOnly, "1")
+		args = args[1:]
+	}
+	return args
+}
@@ -0,0 +1,128 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func TestStripScopeFlag(t *testing.T) {
+	t.Setenv(root.EnvLoktScope, "")
+
+	args, err := stripScopeFlag([]string{"--scope", "user", "--scope=system", "lock", "gpu"})
+	if err != nil || !slices.Equal(args, []string{"lock", "gpu"}) {
+		t.Fatalf("stripScopeFlag() = %v, %v", args, err)
+	}
+	if got := os.Getenv(root.EnvLoktScope); got != "system" {
+		t.Errorf("LOKT_SCOPE = %q, want the last --scope", got)
+	}
+	if args, _ := stripScopeFlag([]string{"lock", "--scope", "user"}); len(args) != 3 {
+		t.Errorf("a --scope after the command was stripped: %v", args)
+	}
+	for _, bad := range [][]string{{"--scope"}, {"--scope=galaxy", "lock"}} {
+		if _, err := stripScopeFlag(bad); err == nil {
+			t.Errorf("stripScopeFlag(%v) should fail", bad)
+		}
+	}
+}
+
+func TestStripRootFlag(t *testing.T) {
+	t.Setenv(root.EnvLoktRoot, "")
+	t.Setenv(root.EnvLoktScope, "user")
+	dir := t.TempDir()
+
+	args, err := stripRootFlag([]string{"--root", "elsewhere", "--root=" + dir, "status"})
+	if err != nil || !slices.Equal(args, []string{"status"}) {
+		t.Fatalf("stripRootFlag() = %v, %v", args, err)
+	}
+	if got := os.Getenv(root.EnvLoktRoot); got != dir {
+		t.Errorf("LOKT_ROOT = %q, want the last --root", got)
+	}
+	if got, ok := os.LookupEnv(root.EnvLoktScope); ok {
+		t.Errorf("LOKT_SCOPE = %q, want it cleared", got)
+	}
+	if path, method, err := root.FindWithMethod(); err != nil || path != dir || method != root.MethodEnvVar {
+		t.Errorf("FindWithMethod() = %q, %v, %v; want %q via env", path, method, err, dir)
+	}
+
+	if _, err := stripRootFlag([]string{"--root", "rel"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := os.Getenv(root.EnvLoktRoot); !filepath.IsAbs(got) {
+		t.Errorf("LOKT_ROOT = %q, want an absolute path", got)
+	}
+	for _, bad := range [][]string{{"--root"}, {"--root=", "lock"}} {
+		if _, err := stripRootFlag(bad); err == nil {
+			t.Errorf("stripRootFlag(%v) should fail", bad)
+		}
+	}
+}
+
+func TestScope_SystemRootInitAndDoctor(t *testing.T) {
+	sysRoot := filepath.Join(t.TempDir(), "lokt")
+	if err := root.MkdirShared(sysRoot); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(root.EnvSystemRoot, sysRoot)
+	t.Setenv(root.EnvLoktScope, "system")
+	t.Setenv("LOKT_ROOT", t.TempDir()) // the scope wins
+
+	stdout, _, code := captureCmd(cmdInit, nil)
+	if code != ExitOK || !strings.Contains(stdout, "shared by all users") {
+		t.Fatalf("init: exit %d, output %q", code, stdout)
+	}
+	if fi, err := os.Stat(config.Path(sysRoot)); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("config.json in the system root: %v, %v; want 0644", fi, err)
+	}
+	if fi, err := os.Stat(root.LocksPath(sysRoot)); err != nil || fi.Mode().Perm() != 0777 {
+		t.Errorf("locks/ in the system root: %v, %v; want 0777", fi, err)
+	}
+
+	if _, _, code := captureCmd(cmdLock, []string{"gpu"}); code != ExitOK {
+		t.Fatalf("lock gpu: exit %d", code)
+	}
+	if fi, err := os.Stat(root.LockFilePath(sysRoot, "gpu")); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("lock file in the system root: %v, %v; want 0644", fi, err)
+	}
+
+	stdout, _, code = captureCmd(cmdDoctor, nil)
+	if code != ExitOK || !strings.Contains(stdout, "system scope, LOKT_SYSTEM_ROOT env") || !strings.Contains(stdout, sysRoot) {
+		t.Errorf("doctor: exit %d, output:\n%s", code, stdout)
+	}
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	if _, _, code := captureCmd(cmdLock, []string{"build"}); code != ExitOK {
+		t.Fatalf("lock build: exit %d", code)
+	}
+	if args := stripReadOnlyFlag([]string{"--read-only", "lock", "deploy"}); !slices.Equal(args, []string{"lock", "deploy"}) {
+		t.Fatalf("stripReadOnlyFlag() = %v", args)
+	}
+	t.Cleanup(func() { _ = os.Unsetenv(root.EnvReadOnly) })
+
+	_, stderr, code := captureCmd(cmdLock, []string{"deploy"})
+	if code != ExitReadOnly || !strings.Contains(stderr, "is read-only") {
+		t.Errorf("lock in read-only mode: exit %d, stderr %q; want %d", code, stderr, ExitReadOnly)
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "deploy.json")); !os.IsNotExist(err) {
+		t.Error("lock in read-only mode wrote a lock file")
+	}
+	if _, _, code := captureCmd(cmdUnlock, []string{"build"}); code != ExitReadOnly {
+		t.Errorf("unlock in read-only mode: exit %d, want %d", code, ExitReadOnly)
+	}
+	if stdout, _, code := captureCmd(cmdStatus, []string{"build"}); code != ExitOK || !strings.Contains(stdout, "build") {
+		t.Errorf("status in read-only mode: exit %d, output %q", code, stdout)
+	}
+	stdout, _, code := captureCmd(cmdDoctor, nil)
+	if code != ExitOK || !strings.Contains(stdout, "read-only mode") {
+		t.Errorf("doctor in read-only mode: exit %d, output %q; want a warning", code, stdout)
+	}
+}
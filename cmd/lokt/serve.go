@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/snapshot"
+)
+
+// serveShutdownTimeout bounds how long in-flight requests may take to drain
+// after SIGINT/SIGTERM.
+const serveShutdownTimeout = 5 * time.Second
+
+// servePageRefresh is the meta-refresh interval of the HTML status page.
+const servePageRefresh = 5
+
+// serveOptions configures the HTTP handler.
+type serveOptions struct {
+	AllowForce bool   // Register POST /api/force-release
+	ForceToken string // Bearer token required by force-release
+}
+
+func cmdServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("http", "", "Address to listen on (e.g., :8080, 127.0.0.1:8080)")
+	readOnly := fs.Bool("read-only", false, "Serve read-only endpoints only (the default)")
+	allowForce := fs.Bool("allow-force", false, "Enable POST /api/force-release (requires serve.force_token in config)")
+	if err := fs.Parse(args); err != nil || *addr == "" || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: lokt serve --http <addr> [--read-only | --allow-force]")
+		return ExitUsage
+	}
+	if *readOnly && *allowForce {
+		fmt.Fprintln(os.Stderr, "error: --read-only and --allow-force are mutually exclusive")
+		return ExitUsage
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	opts := serveOptions{AllowForce: *allowForce}
+	if *allowForce {
+		cfg, err := config.Load(rootDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+		if cfg.Serve.ForceToken == "" {
+			fmt.Fprintf(os.Stderr, "error: --allow-force requires serve.force_token in %s\n", config.Path(rootDir))
+			return ExitUsage
+		}
+		opts.ForceToken = cfg.Serve.ForceToken
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	srv := &http.Server{
+		Handler:           newServeHandler(rootDir, opts),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Serve(ln) }()
+	fmt.Printf("serving lock status on http://%s\n", ln.Addr())
+
+	select {
+	case err := <-errCh:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "error: shutdown: %v\n", err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+// newServeHandler returns the HTTP handler for lokt serve.
+func newServeHandler(rootDir string, opts serveOptions) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, _ *http.Request) {
+		servePage(w, snapshot.Capture(rootDir, time.Now()))
+	})
+	mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, snapshot.Capture(rootDir, time.Now()))
+	})
+	mux.HandleFunc("GET /api/audit", func(w http.ResponseWriter, r *http.Request) {
+		serveAudit(w, r, rootDir)
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		if _, err := os.Stat(root.LocksPath(rootDir)); err != nil && !os.IsNotExist(err) {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "error", "error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	if opts.AllowForce {
+		mux.HandleFunc("POST /api/force-release", func(w http.ResponseWriter, r *http.Request) {
+			serveForceRelease(w, r, rootDir, opts.ForceToken)
+		})
+	}
+	return mux
+}
+
+// serveAudit streams audit events as NDJSON, filtered by the since (default
+// 1h) and name query parameters, matching lokt audit --since.
+func serveAudit(w http.ResponseWriter, r *http.Request, rootDir string) {
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		since = "1h"
+	}
+	sinceTime, err := parseSince(since)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid since %q: %v", since, err)})
+		return
+	}
+	name := r.URL.Query().Get("name")
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	_ = audit.ScanAll(rootDir, sinceTime, func(e *audit.Event, line []byte) bool {
+		if e.Timestamp.Before(sinceTime) || (name != "" && e.Name != name) {
+			return true
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return false // client went away
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return r.Context().Err() == nil
+	})
+}
+
+// serveForceRelease is the break-glass endpoint: POST
+// /api/force-release?name=<lock> with "Authorization: Bearer <token>".
+func serveForceRelease(w http.ResponseWriter, r *http.Request, rootDir, token string) {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid or missing bearer token"})
+		return
+	}
+	name := r.URL.Query().Get("name")
+	err := lock.Release(rootDir, name, lock.ReleaseOptions{Force: true, Auditor: newAuditor(rootDir)})
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, map[string]string{"name": name, "status": "released"})
+	case errors.Is(err, lock.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"name": name, "error": err.Error()})
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"name": name, "error": err.Error()})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+var servePageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"age": func(e snapshot.Entry, now time.Time) string {
+		return now.Sub(e.AcquiredAt).Truncate(time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>lokt status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.3em 1em; border-bottom: 1px solid #ddd; }
+.flag { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>lokt status</h1>
+<p>{{.State.LockCount}} locks, {{.State.FreezeCount}} freezes as of {{.State.Timestamp.Format "2006-01-02 15:04:05Z07:00"}}</p>
+{{if .State.Locks}}
+<table>
+<tr><th>Name</th><th>Holder</th><th>PID</th><th>Age</th><th>Status</th></tr>
+{{range .State.Locks}}
+<tr><td>{{.Name}}</td><td>{{.Owner}}@{{.Host}}</td><td>{{.PID}}</td><td>{{age . $.State.Timestamp}}</td><td class="flag">{{if .Freeze}}FROZEN {{end}}{{if .IsExpiredAt $.State.Timestamp}}EXPIRED{{end}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>No locks held.</p>
+{{end}}
+</body>
+</html>
+`))
+
+func servePage(w http.ResponseWriter, st *snapshot.State) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = servePageTemplate.Execute(w, struct {
+		Refresh int
+		State   *snapshot.State
+	}{servePageRefresh, st})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/snapshot"
+)
+
+func serveRequest(t *testing.T, h http.Handler, method, target string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServe_StatusPageAndAPI(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	exp := time.Now().Add(-time.Minute)
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", Owner: "alice", Host: "h1", PID: 1, AcquiredAt: time.Now(),
+	})
+	writeLockJSON(t, locksDir, "old.json", &lockfile.Lock{
+		Version: 1, Name: "old", Owner: "bob", Host: "h2", PID: 2, AcquiredAt: time.Now().Add(-time.Hour),
+		TTLSec: 60, ExpiresAt: &exp,
+	})
+	h := newServeHandler(rootDir, serveOptions{})
+
+	rec := serveRequest(t, h, http.MethodGet, "/", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET / = %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{`http-equiv="refresh"`, "<td>build</td>", "alice@h1", "EXPIRED"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("status page missing %q:\n%s", want, body)
+		}
+	}
+
+	rec = serveRequest(t, h, http.MethodGet, "/api/status", nil)
+	var st snapshot.State
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatalf("invalid /api/status JSON: %v\n%s", err, rec.Body.String())
+	}
+	if st.LockCount != 2 || len(st.Locks) != 2 {
+		t.Errorf("expected 2 locks, got %+v", st)
+	}
+
+	rec = serveRequest(t, h, http.MethodGet, "/healthz", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ok"`) {
+		t.Errorf("GET /healthz = %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := serveRequest(t, h, http.MethodGet, "/nope", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /nope = %d, want 404", rec.Code)
+	}
+}
+
+func TestServe_Audit(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	writeAuditEvents(t, rootDir,
+		map[string]any{"ts": time.Now().Add(-3 * time.Hour), "event": "acquire", "name": "old", "owner": "a", "host": "h", "pid": 1},
+		map[string]any{"ts": time.Now().Add(-time.Minute), "event": "acquire", "name": "build", "owner": "a", "host": "h", "pid": 1},
+		map[string]any{"ts": time.Now().Add(-time.Minute), "event": "acquire", "name": "deploy", "owner": "a", "host": "h", "pid": 1},
+	)
+	h := newServeHandler(rootDir, serveOptions{})
+
+	rec := serveRequest(t, h, http.MethodGet, "/api/audit", nil)
+	if got := strings.Count(rec.Body.String(), "\n"); got != 2 {
+		t.Errorf("default since=1h: expected 2 events, got %d:\n%s", got, rec.Body.String())
+	}
+	rec = serveRequest(t, h, http.MethodGet, "/api/audit?since=24h&name=old", nil)
+	if !strings.Contains(rec.Body.String(), `"name":"old"`) || strings.Count(rec.Body.String(), "\n") != 1 {
+		t.Errorf("since=24h&name=old: unexpected body:\n%s", rec.Body.String())
+	}
+	if rec := serveRequest(t, h, http.MethodGet, "/api/audit?since=bogus", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad since: got %d, want 400", rec.Code)
+	}
+}
+
+func TestServe_ForceRelease(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "stuck.json", &lockfile.Lock{
+		Version: 1, Name: "stuck", Owner: "someone-else", Host: "h", PID: 1, AcquiredAt: time.Now(),
+	})
+	lockPath := filepath.Join(locksDir, "stuck.json")
+
+	readOnly := newServeHandler(rootDir, serveOptions{})
+	if rec := serveRequest(t, readOnly, http.MethodPost, "/api/force-release?name=stuck", nil); rec.Code == http.StatusOK {
+		t.Error("force-release must not exist without --allow-force")
+	}
+
+	h := newServeHandler(rootDir, serveOptions{AllowForce: true, ForceToken: "s3cret"})
+	for _, auth := range []string{"", "Bearer wrong", "s3cret"} {
+		rec := serveRequest(t, h, http.MethodPost, "/api/force-release?name=stuck", map[string]string{"Authorization": auth})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("auth %q: got %d, want 401", auth, rec.Code)
+		}
+	}
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Fatal("lock must survive unauthorized requests")
+	}
+
+	auth := map[string]string{"Authorization": "Bearer s3cret"}
+	if rec := serveRequest(t, h, http.MethodPost, "/api/force-release?name=stuck", auth); rec.Code != http.StatusOK {
+		t.Errorf("authorized force-release = %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Error("lock should have been force-released")
+	}
+	if rec := serveRequest(t, h, http.MethodPost, "/api/force-release?name=stuck", auth); rec.Code != http.StatusNotFound {
+		t.Errorf("second force-release = %d, want 404", rec.Code)
+	}
+	events := readAuditLog(t, rootDir)
+	if len(events) == 0 || events[len(events)-1].Event != "force-break" {
+		t.Errorf("expected force-break audit event, got %+v", events)
+	}
+}
+
+func TestServe_Usage(t *testing.T) {
+	setupTestRoot(t)
+	if _, _, code := captureCmd(cmdServe, nil); code != ExitUsage {
+		t.Errorf("no --http: expected exit %d, got %d", ExitUsage, code)
+	}
+	if _, _, code := captureCmd(cmdServe, []string{"--http", ":0", "--read-only", "--allow-force"}); code != ExitUsage {
+		t.Errorf("--read-only --allow-force: expected exit %d, got %d", ExitUsage, code)
+	}
+	_, stderr, code := captureCmd(cmdServe, []string{"--http", ":0", "--allow-force"})
+	if code != ExitUsage || !strings.Contains(stderr, "force_token") {
+		t.Errorf("--allow-force without token: exit %d, stderr %q", code, stderr)
+	}
+}
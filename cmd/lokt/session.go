@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+const sessionUsage = "usage: lokt session list [--json]\n" +
+	"       lokt session end <id> [--json]\n" +
+	"       lokt session gc [--json]"
+
+// sessionEndOutput is the --json form of one ended session.
+type sessionEndOutput struct {
+	Session  string   `json:"session"`
+	Released []string `json:"released"`
+}
+
+func cmdSession(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, sessionUsage)
+		return ExitUsage
+	}
+	fs := flag.NewFlagSet("session "+args[0], flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	if err := fs.Parse(args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, sessionUsage)
+		return ExitUsage
+	}
+	wantArgs := 0
+	if args[0] == "end" {
+		wantArgs = 1
+	}
+	if fs.NArg() != wantArgs || !slices.Contains([]string{"list", "end", "gc"}, args[0]) {
+		fmt.Fprintln(os.Stderr, sessionUsage)
+		return ExitUsage
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if args[0] != "list" {
+		if code := checkWritable(rootDir, ""); code != ExitOK {
+			return code
+		}
+	}
+	switch args[0] {
+	case "end":
+		return sessionEnd(rootDir, fs.Arg(0), *jsonOutput)
+	case "gc":
+		return sessionGC(rootDir, *jsonOutput)
+	}
+
+	sessions, err := lock.Sessions(rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if *jsonOutput {
+		data, _ := json.MarshalIndent(sessions, "", "  ")
+		fmt.Println(string(data))
+		return ExitOK
+	}
+	printSessions(os.Stdout, sessions, time.Now())
+	return ExitOK
+}
+
+// printSessions renders sessions as a table, one line each.
+func printSessions(w io.Writer, sessions []lock.SessionStatus, now time.Time) {
+	if len(sessions) == 0 {
+		fmt.Fprintln(w, "no sessions")
+		return
+	}
+	fmt.Fprintf(w, "%-20s  %-24s  %-5s  %8s  %s\n", "SESSION", "OWNER", "STATE", "AGE", "LOCKS")
+	for _, s := range sessions {
+		state := "dead"
+		if s.Live {
+			state = "live"
+		}
+		owner, age := "-", "-"
+		if s.Owner != "" {
+			owner = s.Owner + "@" + s.Host
+		}
+		if !s.Created.IsZero() {
+			age = fmtHold(now.Sub(s.Created))
+		}
+		names := make([]string, 0, len(s.Held))
+		for _, lf := range s.Held {
+			names = append(names, lf.Name)
+		}
+		locks := strings.Join(names, ", ")
+		if locks == "" {
+			locks = "-"
+		}
+		fmt.Fprintf(w, "%-20s  %-24s  %-5s  %8s  %s\n", s.ID, owner, state, age, locks)
+	}
+}
+
+// sessionEnd releases what session id holds.
+func sessionEnd(rootDir, id string, jsonOutput bool) int {
+	if err := lock.ValidateSessionID(id); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitUsage
+	}
+	released, err := lock.EndSession(rootDir, id, lock.ReleaseOptions{Auditor: newAuditor(rootDir)})
+	if errors.Is(err, lock.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "error: no session %q\n", id)
+		return ExitNotFound
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if released == nil {
+		released = []string{}
+	}
+	if jsonOutput {
+		data, _ := json.MarshalIndent(sessionEndOutput{Session: id, Released: released}, "", "  ")
+		fmt.Println(string(data))
+		return ExitOK
+	}
+	printSessionEnd(os.Stdout, id, released)
+	return ExitOK
+}
+
+// sessionGC ends the sessions nothing runs in any more.
+func sessionGC(rootDir string, jsonOutput bool) int {
+	ended, err := lock.GCSessions(rootDir, lock.ReleaseOptions{Auditor: newAuditor(rootDir)})
+	ids := make([]string, 0, len(ended))
+	for id := range ended {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	if jsonOutput {
+		out := make([]sessionEndOutput, 0, len(ids))
+		for _, id := range ids {
+			out = append(out, sessionEndOutput{Session: id, Released: append([]string{}, ended[id]...)})
+		}
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		if len(ids) == 0 {
+			fmt.Println("no dead sessions")
+		}
+		for _, id := range ids {
+			printSessionEnd(os.Stdout, id, ended[id])
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	return ExitOK
+}
+
+func printSessionEnd(w io.Writer, id string, released []string) {
+	if len(released) == 0 {
+		fmt.Fprintf(w, "ended session %q (held no locks)\n", id)
+		return
+	}
+	fmt.Fprintf(w, "ended session %q, released: %s\n", id, strings.Join(released, ", "))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+)
+
+func TestSession_LockListEnd(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	t.Setenv(lock.EnvLoktSession, "agent-1")
+
+	if _, _, code := captureCmd(cmdLock, []string{"build"}); code != ExitOK {
+		t.Fatalf("lock build (LOKT_SESSION): exit %d", code)
+	}
+	if _, _, code := captureCmd(cmdLock, []string{"deploy", "--session", "agent-2"}); code != ExitOK {
+		t.Fatalf("lock deploy --session: exit %d", code)
+	}
+
+	stdout, _, code := captureCmd(cmdSession, []string{"list", "--json"})
+	if code != ExitOK {
+		t.Fatalf("session list: exit %d", code)
+	}
+	var sessions []lock.SessionStatus
+	if err := json.Unmarshal([]byte(stdout), &sessions); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "agent-1" || len(sessions[0].Held) != 1 || !sessions[0].Live {
+		t.Errorf("session list = %+v", sessions)
+	}
+
+	stdout, _, code = captureCmd(cmdSession, []string{"end", "agent-1"})
+	if code != ExitOK || !strings.Contains(stdout, "released: build") {
+		t.Errorf("session end: exit %d, output %q", code, stdout)
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "build.json")); !os.IsNotExist(err) {
+		t.Error("session end left build locked")
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "deploy.json")); err != nil {
+		t.Error("session end released another session's lock")
+	}
+	if _, _, code := captureCmd(cmdSession, []string{"end", "agent-1"}); code != ExitNotFound {
+		t.Errorf("ending an ended session: exit %d, want %d", code, ExitNotFound)
+	}
+}
+
+func TestSession_Usage(t *testing.T) {
+	setupTestRoot(t)
+	for _, args := range [][]string{nil, {"bogus"}, {"end"}, {"list", "extra"}, {"end", "a/b"}} {
+		if _, _, code := captureCmd(cmdSession, args); code != ExitUsage {
+			t.Errorf("session %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+	if _, _, code := captureCmd(cmdLock, []string{"x", "--session", "bad id"}); code != ExitUsage {
+		t.Errorf("lock --session with an invalid ID: exit %d, want %d", code, ExitUsage)
+	}
+}
+
+func TestSession_GuardRegistersWhileRunning(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	sessionFile := filepath.Join(rootDir, "sessions", "ci-3.json")
+	out := filepath.Join(t.TempDir(), "seen")
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"--session", "ci-3", "build", "--", "cp", sessionFile, out})
+	if code != ExitOK {
+		t.Fatalf("guard: exit %d: %s", code, stderr)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil || !strings.Contains(string(data), `"build"`) {
+		t.Errorf("session file while guarded = %q, %v; want it to list build", data, err)
+	}
+	if _, err := os.Stat(sessionFile); !os.IsNotExist(err) {
+		t.Errorf("guard left its session registered after release: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+)
+
+func TestLock_Shared(t *testing.T) {
+	setupTestRoot(t)
+
+	for _, owner := range []string{"alice", "bob"} {
+		t.Setenv("LOKT_OWNER", owner)
+		stdout, stderr, code := captureCmd(cmdLock, []string{"--shared", "reports"})
+		if code != ExitOK {
+			t.Fatalf("lock --shared as %s: exit %d (stderr %q)", owner, code, stderr)
+		}
+		if stdout != "acquired shared lock \"reports\"\n" {
+			t.Errorf("stdout = %q", stdout)
+		}
+	}
+
+	t.Setenv("LOKT_OWNER", "carol")
+	_, stderr, code := captureCmd(cmdLock, []string{"reports"})
+	if code != ExitLockHeld || !strings.Contains(stderr, `held shared by 2 holder(s), oldest alice@`) {
+		t.Errorf("exclusive lock: exit %d, stderr %q; want held shared", code, stderr)
+	}
+	if _, _, code := captureCmd(cmdExists, []string{"reports"}); code != ExitOK {
+		t.Errorf("exists: exit %d, want %d", code, ExitOK)
+	}
+
+	stdout, _, _ := captureCmd(cmdStatus, nil)
+	if !strings.Contains(stdout, "reports               shared by 2: alice@") {
+		t.Errorf("status = %q, want the shared holders", stdout)
+	}
+	stdout, _, code = captureCmd(cmdStatus, []string{"reports", "--json"})
+	var out []statusOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil || code != ExitOK {
+		t.Fatalf("status reports --json: exit %d, %q: %v", code, stdout, err)
+	}
+	if len(out) != 2 || out[0].Owner != "alice" || out[0].Mode != "shared" || out[0].Holders != 2 {
+		t.Errorf("json = %+v", out)
+	}
+
+	if _, _, code := captureCmd(cmdUnlock, []string{"reports"}); code != ExitNotOwner {
+		t.Errorf("unlock by non-holder: exit %d, want %d", code, ExitNotOwner)
+	}
+	t.Setenv("LOKT_OWNER", "alice")
+	if _, stderr, code := captureCmd(cmdUnlock, []string{"reports"}); code != ExitOK {
+		t.Fatalf("unlock as alice: exit %d (stderr %q)", code, stderr)
+	}
+	t.Setenv("LOKT_OWNER", "bob")
+	if _, stderr, code := captureCmd(cmdUnlock, []string{"reports"}); code != ExitOK {
+		t.Fatalf("unlock as bob: exit %d (stderr %q)", code, stderr)
+	}
+	if _, _, code := captureCmd(cmdLock, []string{"reports"}); code != ExitOK {
+		t.Errorf("exclusive lock after shared holders left: exit %d", code)
+	}
+}
+
+func TestGuard_Shared(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "alice")
+	if _, _, code := captureCmd(cmdLock, []string{"--shared", "reports"}); code != ExitOK {
+		t.Fatalf("lock --shared: exit %d", code)
+	}
+
+	t.Setenv("LOKT_OWNER", "bob")
+	_, stderr, code := captureCmd(cmdGuard, []string{"--shared", "reports", "--", "true"})
+	if code != ExitOK {
+		t.Fatalf("guard --shared alongside a shared holder: exit %d (stderr %q)", code, stderr)
+	}
+	if holders := lock.SharedHolders(rootDir, "reports"); len(holders) != 1 || holders[0].Owner != "alice" {
+		t.Errorf("after guard, holders = %+v, want only alice's", holders)
+	}
+
+	_, stderr, code = captureCmd(cmdGuard, []string{"--shared", "--no-release", "reports", "--", "true"})
+	if code != ExitUsage || !strings.Contains(stderr, "--no-release cannot be combined with --shared") {
+		t.Errorf("--shared --no-release: exit %d, stderr %q; want usage error", code, stderr)
+	}
+}
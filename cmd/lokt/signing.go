@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/doctor"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// keyEnv holds lock file signing keys, taking the place of key_file in
+// config.json.
+const keyEnv = "LOKT_KEY"
+
+// signingKeys returns the lock file signing keys for rootDir ("" without a
+// root) and where they came from: LOKT_KEY, else key_file in config.json.
+// No keys and no error means signing is off.
+func signingKeys(rootDir string) (keys [][]byte, source string, err error) {
+	if s := os.Getenv(keyEnv); s != "" {
+		if keys = lockfile.ParseKeys(s); len(keys) == 0 {
+			return nil, keyEnv, fmt.Errorf("%s: no keys", keyEnv)
+		}
+		return keys, keyEnv, nil
+	}
+	if rootDir == "" {
+		return nil, "", nil
+	}
+	cfg, err := config.Load(rootDir)
+	if err != nil || cfg.KeyFile == "" {
+		return nil, "", nil // a broken config is doctor's to report
+	}
+	path := cfg.KeyFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rootDir, path)
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // G304: key_file is the operator's setting
+	if err != nil {
+		return nil, path, fmt.Errorf("key_file: %w", err)
+	}
+	if keys = lockfile.ParseKeys(string(data)); len(keys) == 0 {
+		return nil, path, fmt.Errorf("key_file %s: no keys", path)
+	}
+	return keys, path, nil
+}
+
+// configureSigning turns lock file signing on if keys are configured (see
+// signingKeys). Keys that are configured but can't be used are an error:
+// carrying on unsigned would quietly drop the protection asked for.
+func configureSigning() error {
+	rootDir, _ := root.Find()
+	keys, _, err := signingKeys(rootDir)
+	if err != nil {
+		return err
+	}
+	if err := lockfile.SetKeys(keys); err != nil {
+		return fmt.Errorf("signing keys: %w", err)
+	}
+	return nil
+}
+
+// checkSigning is lokt doctor's report on lock file signing.
+func checkSigning(rootDir string) doctor.CheckResult {
+	keys, source, err := signingKeys(rootDir)
+	if err == nil {
+		err = lockfile.SetKeys(keys) // as configureSigning did, or would have
+	}
+	return doctor.CheckSigning(rootDir, source, len(keys), err)
+}
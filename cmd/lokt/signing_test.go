@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+const testSigningKey = "0123456789abcdef0123456789abcdef"
+
+func TestSigningKeys(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	t.Setenv(keyEnv, "")
+	if keys, _, err := signingKeys(rootDir); keys != nil || err != nil {
+		t.Errorf("nothing configured: %d keys, %v; want signing off", len(keys), err)
+	}
+
+	if err := os.WriteFile(config.Path(rootDir), []byte(`{"key_file": "lokt.key"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := signingKeys(rootDir); err == nil {
+		t.Error("missing key_file: want an error")
+	}
+	keyPath := filepath.Join(rootDir, "lokt.key")
+	if err := os.WriteFile(keyPath, []byte("# current first\n"+testSigningKey+"\nold-key-old-key-old-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, source, err := signingKeys(rootDir)
+	if err != nil || len(keys) != 2 || source != keyPath {
+		t.Errorf("key_file: %d keys from %s, %v; want 2 from %s", len(keys), source, err, keyPath)
+	}
+
+	t.Setenv(keyEnv, testSigningKey)
+	if keys, source, err := signingKeys(rootDir); err != nil || len(keys) != 1 || source != keyEnv {
+		t.Errorf("LOKT_KEY: %d keys from %s, %v; want it to win", len(keys), source, err)
+	}
+}
+
+func TestSigning_Commands(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv(keyEnv, testSigningKey)
+	t.Cleanup(func() { _ = lockfile.SetKeys(nil) })
+	if _, _, code := captureCmd(cmdLock, []string{"old"}); code != ExitOK {
+		t.Fatalf("lock old: exit %d", code)
+	}
+	if err := configureSigning(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, code := captureCmd(cmdLock, []string{"new"}); code != ExitOK {
+		t.Fatalf("lock new: exit %d", code)
+	}
+
+	stdout, _, _ := captureCmd(cmdStatus, nil)
+	if !strings.Contains(stdout, "[UNSIGNED]") || strings.Count(stdout, "[UNSIGNED]") != 1 {
+		t.Errorf("status = %q, want old flagged unsigned", stdout)
+	}
+	stdout, _, _ = captureCmd(cmdStatus, []string{"--json"})
+	var outputs []statusOutput
+	if err := json.Unmarshal([]byte(stdout), &outputs); err != nil {
+		t.Fatalf("status --json: %v: %s", err, stdout)
+	}
+	for _, out := range outputs {
+		if want := map[string]string{"old": signatureUnsigned, "new": signatureValid}[out.Name]; out.Signature != want {
+			t.Errorf("status --json %s: signature %q, want %q", out.Name, out.Signature, want)
+		}
+	}
+
+	if _, stderr, code := captureCmd(cmdUnlock, []string{"old"}); code != ExitError || !strings.Contains(stderr, "unsigned") {
+		t.Errorf("unlock old: exit %d, stderr %q; want it refused", code, stderr)
+	}
+	if _, stderr, code := captureCmd(cmdRenew, []string{"--force", "old"}); code != ExitOK {
+		t.Errorf("renew --force old: exit %d, stderr %q", code, stderr)
+	}
+	for _, name := range []string{"old", "new"} {
+		if _, stderr, code := captureCmd(cmdUnlock, []string{name}); code != ExitOK {
+			t.Errorf("unlock %s: exit %d, stderr %q", name, code, stderr)
+		}
+	}
+}
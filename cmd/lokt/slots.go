@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// slotHolders returns the lock of each of the n slots of name, nil for a
+// free (or unreadable) one, and how many are held.
+func slotHolders(rootDir, name string, n int) ([]*lockfile.Lock, int) {
+	holders := make([]*lockfile.Lock, n)
+	used := 0
+	for k := range n {
+		if lf, _, err := readStatusLock(root.LockFilePath(rootDir, lock.SlotName(name, k))); err == nil {
+			holders[k] = lf
+			used++
+		}
+	}
+	return holders, used
+}
+
+// showSlots prints the slots of name, n of them, and the active freeze fz
+// on it if not nil. The JSON form is an array with one entry per held
+// slot, then one for the freeze, as for a shared lock.
+func showSlots(w io.Writer, rootDir, name string, n int, fz *lockfile.Lock, jsonOutput bool) int {
+	holders, used := slotHolders(rootDir, name, n)
+	if jsonOutput {
+		outputs := []statusOutput{}
+		grace := skewGrace(rootDir)
+		for k, lf := range holders {
+			if lf == nil {
+				continue
+			}
+			out := lockStatusOutput(root.LockFilePath(rootDir, lock.SlotName(name, k)), lf, grace)
+			out.SlotOf, out.Slots = name, n
+			outputs = append(outputs, out)
+		}
+		if fz != nil {
+			outputs = append(outputs, lockToStatusOutput(fz, true))
+		}
+		data, _ := json.MarshalIndent(outputs, "", "  ")
+		fmt.Fprintln(w, string(data))
+		return ExitOK
+	}
+	fmt.Fprintf(w, "name:     %s\n", name)
+	fmt.Fprintf(w, "slots:    %d/%d used\n", used, n)
+	for k, h := range holders {
+		label := fmt.Sprintf("slot %d:", k)
+		if h == nil {
+			fmt.Fprintf(w, "%-9s free\n", label)
+			continue
+		}
+		status := ""
+		if h.IsExpired() {
+			status = ", EXPIRED"
+		}
+		fmt.Fprintf(w, "%-9s %s@%s (pid %d, %s) for %s%s\n",
+			label, h.Owner, h.Host, h.PID, pidLiveness(h), h.Age().Truncate(time.Second), status)
+	}
+	if fz != nil {
+		showFreezeLine(w, fz)
+	}
+	return ExitOK
+}
+
+// showSlotsBrief prints the status listing's lines for the slots of name:
+// how many of the n are used, then a line per held slot.
+func showSlotsBrief(w io.Writer, rootDir, name string, n int) {
+	holders, used := slotHolders(rootDir, name, n)
+	fmt.Fprintf(w, "%-20s  %d/%d slots used\n", name, used, n)
+	for k, lf := range holders {
+		if lf != nil {
+			showLockBrief(w, rootDir, lock.SlotName(name, k), false)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/policy"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func TestGuard_Slots(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "alice")
+	if _, err := lock.AcquireSlot(rootDir, "itest", 2, lock.AcquireOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOKT_OWNER", "me")
+
+	stdout, stderr, code := captureCmd(cmdGuard, []string{"--slots", "2", "itest", "--", "sh", "-c", "echo $LOKT_GUARD_LOCK"})
+	if code != ExitOK || strings.TrimSpace(stdout) != "itest.slots/1" {
+		t.Errorf("guard --slots 2: exit %d, stdout %q, stderr %q; want itest.slots/1", code, stdout, stderr)
+	}
+	if _, stderr, code := captureCmd(cmdGuard, []string{"--slots", "3", "itest", "--", "true"}); code != ExitError || !strings.Contains(stderr, "has 2 slots, not 3") {
+		t.Errorf("guard --slots 3: exit %d, stderr %q; want the count mismatch", code, stderr)
+	}
+	for _, args := range [][]string{
+		{"--slots", "0", "itest", "--", "true"},
+		{"--slots", "2", "--shared", "itest", "--", "true"},
+		{"--slots", "2", "--locks", "a,b", "--", "true"},
+	} {
+		if _, _, code := captureCmd(cmdGuard, args); code != ExitUsage {
+			t.Errorf("guard %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+
+	stdout, _, _ = captureCmd(cmdStatus, nil)
+	if !strings.Contains(stdout, "itest                 1/2 slots used\nitest.slots/0         alice@") {
+		t.Errorf("status listing = %q", stdout)
+	}
+	stdout, _, code = captureCmd(cmdStatus, []string{"itest"})
+	if code != ExitOK || !strings.Contains(stdout, "slots:    1/2 used\nslot 0:   alice@") || !strings.Contains(stdout, "slot 1:   free") {
+		t.Errorf("status itest: exit %d, stdout %q", code, stdout)
+	}
+	stdout, _, _ = captureCmd(cmdStatus, []string{"--json", "--schema", "2"})
+	if !strings.Contains(stdout, `"slot_of": "itest"`) || !strings.Contains(stdout, `"slots": 2`) {
+		t.Errorf("status --json = %s", stdout)
+	}
+}
+
+func TestGuard_SlotsPolicyAndGroups(t *testing.T) {
+	rootDir := setupGroupRoot(t) // db-migrate held
+	if err := os.WriteFile(policy.Path(rootDir), []byte(`{"locks": {"db-restore": {"require_ttl": true}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"--slots", "2", "db-restore", "--", "true"})
+	if code != ExitError || !strings.Contains(stderr, "TTL is required") {
+		t.Errorf("guard --slots without --ttl: exit %d, stderr %q; want the policy's refusal", code, stderr)
+	}
+	_, stderr, code = captureCmd(cmdGuard, []string{"--slots", "2", "--ttl", "5m", "db-restore", "--", "true"})
+	if code != ExitLockHeld || !strings.Contains(stderr, `excluded by group "db"`) {
+		t.Errorf("guard --slots with db-migrate held: exit %d, stderr %q; want %d", code, stderr, ExitLockHeld)
+	}
+}
+
+func TestSlots_NamesAreReserved(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "alice")
+	if _, err := lock.AcquireSlot(rootDir, "itest", 1, lock.AcquireOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOKT_OWNER", "me")
+
+	if _, stderr, code := captureCmd(cmdLock, []string{"x.slots/0"}); code == ExitOK || !strings.Contains(stderr, "reserved for slots") {
+		t.Errorf("lock x.slots/0: exit %d, stderr %q; want it rejected", code, stderr)
+	}
+	if _, stderr, code := captureCmd(cmdUnlock, []string{"--force", "itest.slots/0"}); code == ExitOK || !strings.Contains(stderr, "reserved for slots") {
+		t.Errorf("unlock --force itest.slots/0: exit %d, stderr %q; want it rejected", code, stderr)
+	}
+	if lf, err := lockfile.Read(root.LockFilePath(rootDir, "itest.slots/0")); err != nil || lf.Owner != "alice" {
+		t.Errorf("slot 0 after the refused unlock = %+v, %v; want alice's", lf, err)
+	}
+}
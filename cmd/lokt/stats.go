@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stats"
+)
+
+// cmdStats summarizes contention per lock from the audit log.
+func cmdStats(args []string) int {
+	fset := flag.NewFlagSet("stats", flag.ContinueOnError)
+	since := fset.String("since", "", "Only count events since (duration or RFC3339)")
+	jsonOutput := fset.Bool("json", false, "Output in JSON format")
+	if err := fset.Parse(args); err != nil || fset.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: lokt stats [--since duration|ts] [--json]")
+		return ExitUsage
+	}
+	var sinceTime time.Time
+	if *since != "" {
+		t, err := parseSince(*since)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid --since value %q: %v\n", *since, err)
+			fmt.Fprintln(os.Stderr, "  expected duration (7d, 1h) or RFC3339 timestamp")
+			return ExitUsage
+		}
+		sinceTime = t
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	rep, err := stats.Collect(rootDir, sinceTime)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+
+	if *jsonOutput {
+		data, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(data))
+		return ExitOK
+	}
+	printStats(os.Stdout, rep)
+	return ExitOK
+}
+
+// printStats renders a stats report as a table, hottest locks first.
+func printStats(w io.Writer, rep *stats.Report) {
+	if len(rep.Locks) == 0 {
+		fmt.Fprintf(w, "no lock activity in %d audit event(s)\n", rep.Events)
+		return
+	}
+	fmt.Fprintf(w, "%-24s  %5s  %5s  %6s  %6s  %9s  %4s  %8s  %8s  %s\n",
+		"NAME", "ACQ", "DENY", "BREAKS", "FREEZE", "ABANDONED", "HELD", "AVG", "P95", "LONGEST")
+	for i := range rep.Locks {
+		s := &rep.Locks[i]
+		longest := "-"
+		if s.Released > 0 {
+			longest = fmt.Sprintf("%s (%s)", fmtHold(s.Longest()), s.LongestOwner)
+		}
+		fmt.Fprintf(w, "%-24s  %5d  %5d  %6d  %6d  %9d  %4d  %8s  %8s  %s\n",
+			s.Name, s.Acquisitions, s.Denials, s.ForceBreaks, s.Freezes, s.Abandoned, s.Held,
+			statsHold(s, s.AvgHold()), statsHold(s, s.P95Hold()), longest)
+	}
+	if rep.Since != nil {
+		fmt.Fprintf(w, "\n%d lock(s), %d audit event(s) since %s\n", len(rep.Locks), rep.Events, rep.Since.Local().Format(time.RFC3339))
+	} else {
+		fmt.Fprintf(w, "\n%d lock(s), %d audit event(s)\n", len(rep.Locks), rep.Events)
+	}
+}
+
+// statsHold formats a hold time column; "-" if s has no released holds.
+func statsHold(s *stats.LockStats, d time.Duration) string {
+	if s.Released == 0 {
+		return "-"
+	}
+	return fmtHold(d)
+}
+
+// fmtHold rounds a hold time for display: to the millisecond under a
+// second, to the second above.
+func fmtHold(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
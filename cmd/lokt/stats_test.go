@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/stats"
+)
+
+func TestStats_Usage(t *testing.T) {
+	setupTestRoot(t)
+
+	for _, args := range [][]string{{"extra"}, {"--since", "soon"}} {
+		_, _, code := captureCmd(cmdStats, args)
+		if code != ExitUsage {
+			t.Errorf("args %v: expected exit %d, got %d", args, ExitUsage, code)
+		}
+	}
+}
+
+func TestStats_TableAndJSON(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+
+	now := time.Now().UTC()
+	writeAuditEvents(t, rootDir,
+		map[string]any{"ts": now.Add(-30 * 24 * time.Hour), "event": "deny", "name": "ancient", "owner": "zed", "host": "h", "pid": 9},
+		map[string]any{"ts": now.Add(-20 * time.Minute), "event": "acquire", "name": "build", "lock_id": "b1", "owner": "alice", "host": "h", "pid": 1},
+		map[string]any{"ts": now.Add(-19 * time.Minute), "event": "deny", "name": "build", "owner": "bob", "host": "h", "pid": 2},
+		map[string]any{"ts": now.Add(-15 * time.Minute), "event": "release", "name": "build", "lock_id": "b1", "owner": "alice", "host": "h", "pid": 1},
+		map[string]any{"ts": now.Add(-10 * time.Minute), "event": "acquire", "name": "deploy", "lock_id": "d1", "owner": "carol", "host": "h", "pid": 3},
+	)
+
+	stdout, _, code := captureCmd(cmdStats, []string{"--since", "7d"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) < 3 || !strings.HasPrefix(lines[1], "build") || !strings.HasPrefix(lines[2], "deploy") {
+		t.Fatalf("expected build (denied) before deploy, got:\n%s", stdout)
+	}
+	if !strings.Contains(lines[1], "5m0s (alice)") {
+		t.Errorf("expected build's 5m hold by alice, got:\n%s", stdout)
+	}
+	if strings.Contains(stdout, "ancient") {
+		t.Errorf("event older than --since was counted:\n%s", stdout)
+	}
+
+	stdout, _, code = captureCmd(cmdStats, []string{"--json"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	var rep stats.Report
+	if err := json.Unmarshal([]byte(stdout), &rep); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if rep.Events != 5 || len(rep.Locks) != 3 {
+		t.Fatalf("expected 5 events over 3 locks, got %+v", rep)
+	}
+	for _, s := range rep.Locks {
+		if s.Name == "deploy" && s.Abandoned != 1 {
+			t.Errorf("deploy has no lock file left, expected it abandoned: %+v", s)
+		}
+	}
+}
+
+func TestStats_Empty(t *testing.T) {
+	setupTestRoot(t)
+
+	stdout, _, code := captureCmd(cmdStats, nil)
+	if code != ExitOK || !strings.Contains(stdout, "no lock activity") {
+		t.Errorf("exit %d, output %q", code, stdout)
+	}
+}
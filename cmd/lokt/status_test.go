@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"math"
 	"os"
 	"path/filepath"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/stale"
 )
 
 func TestStatus_ArgReorder(t *testing.T) {
@@ -192,6 +194,27 @@ func TestStatus_SpecificLock_JSON(t *testing.T) {
 	}
 }
 
+func TestPIDLiveness_RecycledPID(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil {
+		t.Skip("no hostname")
+	}
+	pid := os.Getpid()
+	start, err := stale.GetProcessStartTime(pid)
+	if err != nil {
+		t.Skipf("process start time unavailable: %v", err)
+	}
+
+	lf := &lockfile.Lock{Host: host, PID: pid, PIDStartNS: start}
+	if got := pidLiveness(lf); got != "alive" {
+		t.Errorf("matching start time: pidLiveness() = %q, want alive", got)
+	}
+	lf.PIDStartNS = start + 1
+	if got := pidLiveness(lf); got != "dead" {
+		t.Errorf("recycled PID: pidLiveness() = %q, want dead", got)
+	}
+}
+
 func TestStatus_SpecificLock_NotFound(t *testing.T) {
 	setupTestRoot(t)
 
@@ -229,6 +252,58 @@ func TestStatus_SpecificLock_WithTTL(t *testing.T) {
 	}
 }
 
+func TestStatus_SpecificLock_Renewed(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+
+	hostname, _ := os.Hostname()
+	renewed := time.Now().Add(-3 * time.Minute)
+	writeLockJSON(t, locksDir, "deploy.json", &lockfile.Lock{
+		Name:       "deploy",
+		Owner:      "ci",
+		Host:       hostname,
+		PID:        1,
+		AcquiredAt: renewed,
+		RenewedAt:  &renewed,
+		TTLSec:     600,
+	})
+
+	stdout, _, code := captureCmd(cmdStatus, []string{"deploy"})
+	if code != ExitOK || !strings.Contains(stdout, "last heartbeat 3m0s ago") {
+		t.Errorf("status: exit %d, stdout %s; want the last heartbeat", code, stdout)
+	}
+	stdout, _, _ = captureCmd(cmdStatus, []string{"--json", "deploy"})
+	var out statusOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil || out.RenewedAt != renewed.Format(time.RFC3339) {
+		t.Errorf("status --json: renewed_ts %q (%v), want %s", out.RenewedAt, err, renewed.Format(time.RFC3339))
+	}
+}
+
+// A lock from a newer lokt is listed with its version, not skipped.
+func TestStatus_UnsupportedVersion(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	data := fmt.Sprintf(`{"version": %d, "name": "deploy", "holder": {"owner": "ci"}}`, lockfile.CurrentLockfileVersion+1)
+	if err := os.WriteFile(filepath.Join(locksDir, "deploy.json"), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("%d (unsupported by this binary", lockfile.CurrentLockfileVersion+1)
+
+	for _, args := range [][]string{nil, {"deploy"}} {
+		stdout, _, code := captureCmd(cmdStatus, args)
+		if code != ExitOK || !strings.Contains(stdout, "deploy") || !strings.Contains(stdout, want) {
+			t.Errorf("status %v: exit %d, stdout %q; want %q", args, code, stdout, want)
+		}
+	}
+
+	stdout, _, _ := captureCmd(cmdStatus, []string{"--json"})
+	var outputs []statusOutput
+	if err := json.Unmarshal([]byte(stdout), &outputs); err != nil || len(outputs) != 1 {
+		t.Fatalf("status --json: %v: %s", err, stdout)
+	}
+	if out := outputs[0]; out.Name != "deploy" || out.Version != lockfile.CurrentLockfileVersion+1 || !out.Unsupported {
+		t.Errorf("status --json = %+v, want deploy marked unsupported", out)
+	}
+}
+
 func TestStatus_SpecificLock_Expired_Text(t *testing.T) {
 	_, locksDir := setupTestRoot(t)
 
@@ -611,3 +686,427 @@ func TestStatus_JSON_FreezeLock(t *testing.T) {
 		t.Errorf("expected name 'db', got %q", out[0].Name)
 	}
 }
+
+func TestStatus_SpecificLock_ExplicitAgent(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Name:          "build",
+		Owner:         "alice",
+		Host:          "ws",
+		PID:           1,
+		AgentID:       "session-a",
+		AgentExplicit: true,
+		AcquiredAt:    time.Now(),
+	})
+
+	stdout, _, _ := captureCmd(cmdStatus, []string{"build"})
+	if !strings.Contains(stdout, "agent:    session-a (LOKT_AGENT_ID)") {
+		t.Errorf("expected explicit agent line, got: %s", stdout)
+	}
+
+	stdout, _, _ = captureCmd(cmdStatus, []string{"--json", "build"})
+	var out statusOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("invalid JSON: %v\noutput: %s", err, stdout)
+	}
+	if out.AgentID != "session-a" || !out.AgentExplicit {
+		t.Errorf("agent_id = %q, agent_explicit = %v, want session-a, true", out.AgentID, out.AgentExplicit)
+	}
+}
+
+func TestStatus_SpecificLock_Frozen(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	freezesDir := filepath.Join(rootDir, "freezes")
+	if err := os.MkdirAll(freezesDir, 0700); err != nil {
+		t.Fatalf("mkdir freezes: %v", err)
+	}
+	writeLockJSON(t, freezesDir, "deploy.json", &lockfile.Lock{
+		Name:       "deploy",
+		Owner:      "ops",
+		Host:       "bastion",
+		PID:        1,
+		AcquiredAt: time.Now().Add(-30 * time.Second),
+		TTLSec:     600,
+	})
+
+	t.Run("only frozen", func(t *testing.T) {
+		stdout, _, code := captureCmd(cmdStatus, []string{"deploy"})
+		if code != ExitOK {
+			t.Fatalf("expected exit %d, got %d", ExitOK, code)
+		}
+		for _, want := range []string{"lock:     not held", "frozen:   by ops@bastion", "left [FROZEN]"} {
+			if !strings.Contains(stdout, want) {
+				t.Errorf("expected %q in output, got: %s", want, stdout)
+			}
+		}
+
+		stdout, _, _ = captureCmd(cmdStatus, []string{"--json", "deploy"})
+		var out statusOutput
+		if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+			t.Fatalf("invalid JSON: %v\noutput: %s", err, stdout)
+		}
+		if !out.Freeze || out.ExpiresAt == "" {
+			t.Errorf("expected a freeze with expires_at, got %+v", out)
+		}
+	})
+
+	t.Run("locked and frozen", func(t *testing.T) {
+		writeLockJSON(t, locksDir, "deploy.json", &lockfile.Lock{
+			Name:       "deploy",
+			Owner:      "alice",
+			Host:       "laptop",
+			PID:        1,
+			AcquiredAt: time.Now(),
+		})
+		stdout, _, code := captureCmd(cmdStatus, []string{"deploy"})
+		if code != ExitOK {
+			t.Fatalf("expected exit %d, got %d", ExitOK, code)
+		}
+		if !strings.Contains(stdout, "owner:    alice") || !strings.Contains(stdout, "frozen:   by ops@bastion") {
+			t.Errorf("expected lock and freeze in output, got: %s", stdout)
+		}
+
+		stdout, _, _ = captureCmd(cmdStatus, []string{"--json", "deploy"})
+		var out statusOutput
+		if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+			t.Fatalf("invalid JSON: %v\noutput: %s", err, stdout)
+		}
+		if out.Owner != "alice" || out.Freeze {
+			t.Errorf("expected alice's lock, got %+v", out)
+		}
+		if out.ActiveFreeze == nil || out.ActiveFreeze.Owner != "ops" || !out.ActiveFreeze.Freeze {
+			t.Errorf("expected active_freeze by ops, got %+v", out.ActiveFreeze)
+		}
+	})
+}
+
+func TestStatus_SpecificLock_PruneExpiredFreeze(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	freezesDir := filepath.Join(rootDir, "freezes")
+	if err := os.MkdirAll(freezesDir, 0700); err != nil {
+		t.Fatalf("mkdir freezes: %v", err)
+	}
+	writeLockJSON(t, freezesDir, "deploy.json", &lockfile.Lock{
+		Name:       "deploy",
+		Owner:      "ops",
+		Host:       "bastion",
+		PID:        1,
+		AcquiredAt: time.Now().Add(-10 * time.Minute),
+		TTLSec:     60,
+	})
+
+	stdout, _, code := captureCmd(cmdStatus, []string{"--prune-expired", "deploy"})
+	if code != ExitNotFound {
+		t.Errorf("expected exit %d, got %d", ExitNotFound, code)
+	}
+	if !strings.Contains(stdout, "pruned: deploy (expired freeze)") {
+		t.Errorf("expected prune message, got: %s", stdout)
+	}
+	if _, err := os.Stat(filepath.Join(freezesDir, "deploy.json")); !os.IsNotExist(err) {
+		t.Error("expected expired freeze file to be removed")
+	}
+}
+
+func TestStatus_JSON_LockIDAndAgentID(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+
+	hostname, _ := os.Hostname()
+	writeLockJSON(t, locksDir, "ids.json", &lockfile.Lock{
+		Version:    1,
+		Name:       "ids",
+		LockID:     "0123456789abcdef0123456789abcdef",
+		Owner:      "tester",
+		Host:       hostname,
+		PID:        1,
+		AgentID:    "agent-beef",
+		AcquiredAt: time.Now().Add(-10 * time.Second),
+		TTLSec:     300,
+	})
+
+	for _, args := range [][]string{{"--json", "ids"}, {"--json"}} {
+		stdout, _, code := captureCmd(cmdStatus, args)
+		if code != ExitOK {
+			t.Fatalf("args %v: expected exit %d, got %d", args, ExitOK, code)
+		}
+		var out statusOutput
+		if len(args) == 1 {
+			var list []statusOutput
+			if err := json.Unmarshal([]byte(stdout), &list); err != nil || len(list) != 1 {
+				t.Fatalf("args %v: invalid JSON list: %v\noutput: %s", args, err, stdout)
+			}
+			out = list[0]
+		} else if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+			t.Fatalf("args %v: invalid JSON: %v\noutput: %s", args, err, stdout)
+		}
+		if out.LockID != "0123456789abcdef0123456789abcdef" {
+			t.Errorf("args %v: lock_id = %q", args, out.LockID)
+		}
+		if out.AgentID != "agent-beef" {
+			t.Errorf("args %v: agent_id = %q", args, out.AgentID)
+		}
+	}
+}
+
+func TestStatus_ExpiryAgreesWithLockfile(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+
+	// expires_at is authoritative: acquired_ts+ttl_sec alone would say the lock
+	// is still live, but the stored expiry has passed. Status must agree with
+	// lockfile.Lock.IsExpired (which acquisition uses to break the lock).
+	past := time.Now().Add(-1 * time.Minute)
+	writeLockJSON(t, locksDir, "drift.json", &lockfile.Lock{
+		Version:    1,
+		Name:       "drift",
+		Owner:      "tester",
+		Host:       "remote-host",
+		PID:        1,
+		AcquiredAt: time.Now().Add(-10 * time.Second),
+		TTLSec:     3600,
+		ExpiresAt:  &past,
+	})
+
+	stdout, _, _ := captureCmd(cmdStatus, []string{"--json", "drift"})
+	var out statusOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("invalid JSON: %v\noutput: %s", err, stdout)
+	}
+	if !out.Expired {
+		t.Error("expected expired=true when expires_at is in the past")
+	}
+}
+
+func TestStatus_Namespaced(t *testing.T) {
+	setupTestRoot(t)
+	if _, _, code := captureCmd(cmdLock, []string{"team/frontend/build"}); code != ExitOK {
+		t.Fatalf("lock team/frontend/build: exit %d", code)
+	}
+
+	stdout, _, code := captureCmd(cmdStatus, nil)
+	if code != ExitOK || !strings.Contains(stdout, "team/frontend/build") {
+		t.Errorf("status: exit %d, stdout %q; want the namespaced lock listed", code, stdout)
+	}
+	if _, _, code := captureCmd(cmdUnlock, []string{"team/frontend/build"}); code != ExitOK {
+		t.Errorf("unlock team/frontend/build: exit %d", code)
+	}
+}
+
+func TestStatus_Stale(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	hostname, _ := os.Hostname()
+
+	if _, _, code := captureCmd(cmdStatus, []string{"--fail-if-stale"}); code != ExitOK {
+		t.Errorf("--fail-if-stale with no locks: exit %d, want %d", code, ExitOK)
+	}
+
+	writeLockJSON(t, locksDir, "live.json", &lockfile.Lock{
+		Name: "live", Owner: "alice", Host: hostname, PID: os.Getpid(),
+		AcquiredAt: time.Now(), TTLSec: 300,
+	})
+	writeLockJSON(t, locksDir, "expired.json", &lockfile.Lock{
+		Name: "expired", Owner: "bob", Host: "other-host", PID: 99999,
+		AcquiredAt: time.Now().Add(-time.Hour), TTLSec: 60,
+	})
+	writeLockJSON(t, locksDir, "dead.json", &lockfile.Lock{
+		Name: "dead", Owner: "carol", Host: hostname, PID: 999999999,
+		AcquiredAt: time.Now(),
+	})
+	if err := os.WriteFile(filepath.Join(locksDir, "corrupt.json"), []byte("{{{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, code := captureCmd(cmdStatus, []string{"--stale", "--json"})
+	if code != ExitOK {
+		t.Fatalf("--stale: exit %d, want %d", code, ExitOK)
+	}
+	var outs []statusOutput
+	if err := json.Unmarshal([]byte(stdout), &outs); err != nil {
+		t.Fatalf("invalid JSON: %v\noutput: %s", err, stdout)
+	}
+	got := map[string]string{}
+	for _, o := range outs {
+		got[o.Name] = o.StaleReason
+	}
+	want := map[string]string{"expired": "expired", "dead": "dead_pid", "corrupt": "corrupted"}
+	if len(got) != len(want) {
+		t.Errorf("stale locks = %v, want %v", got, want)
+	}
+	for name, reason := range want {
+		if got[name] != reason {
+			t.Errorf("%s: stale_reason = %q, want %q", name, got[name], reason)
+		}
+	}
+
+	stdout, _, code = captureCmd(cmdStatus, []string{"--fail-if-stale"})
+	if code != ExitStale {
+		t.Errorf("--fail-if-stale: exit %d, want %d", code, ExitStale)
+	}
+	if strings.Contains(stdout, "live") || !strings.Contains(stdout, "[DEAD_PID]") {
+		t.Errorf("--fail-if-stale output = %q, want only the stale locks", stdout)
+	}
+
+	if _, _, code := captureCmd(cmdStatus, []string{"--stale", "live"}); code != ExitUsage {
+		t.Errorf("--stale with a name: exit %d, want %d", code, ExitUsage)
+	}
+}
+
+func TestFreezeAll(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "oncall")
+
+	if _, _, code := captureCmd(cmdFreeze, []string{"--all", "--ttl", "30m", "deploy"}); code != ExitUsage {
+		t.Errorf("freeze --all with a name: exit %d, want %d", code, ExitUsage)
+	}
+	if stdout, _, code := captureCmd(cmdFreeze, []string{"--all", "--ttl", "30m"}); code != ExitOK || !strings.Contains(stdout, "all operations") {
+		t.Fatalf("freeze --all: exit %d, stdout %q", code, stdout)
+	}
+
+	_, stderr, code := captureCmd(cmdGuard, []string{"any-name", "--", "true"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "global freeze") {
+		t.Errorf("guard under a global freeze: exit %d, stderr %q", code, stderr)
+	}
+
+	stdout, _, _ := captureCmd(cmdStatus, nil)
+	if !strings.HasPrefix(stdout, "GLOBAL FREEZE") || strings.Contains(stdout, "__all__") {
+		t.Errorf("status = %q, want the global freeze as a banner only", stdout)
+	}
+
+	if _, _, code := captureCmd(cmdUnfreeze, []string{"--all"}); code != ExitOK {
+		t.Fatalf("unfreeze --all: exit %d", code)
+	}
+	if _, _, code := captureCmd(cmdUnfreeze, []string{"--all"}); code != ExitNotFound {
+		t.Errorf("second unfreeze --all: exit %d, want %d", code, ExitNotFound)
+	}
+	if _, _, code := captureCmd(cmdGuard, []string{"any-name", "--", "true"}); code != ExitOK {
+		t.Errorf("guard after unfreeze --all: exit %d", code)
+	}
+}
+
+func TestFreeze_UntilAndReason(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "oncall")
+	end := time.Now().Add(3 * time.Hour).UTC().Truncate(time.Second).Format(time.RFC3339)
+
+	for _, args := range [][]string{
+		{"--until", end, "--ttl", "1h", "deploy"},
+		{"--until", "2020-01-01T00:00:00Z", "deploy"},
+		{"--until", "tomorrow", "deploy"},
+		{"--ttl", "1h", "--reason", strings.Repeat("x", lockfile.MaxMessageLen+1), "deploy"},
+	} {
+		if _, _, code := captureCmd(cmdFreeze, args); code != ExitUsage {
+			t.Errorf("freeze %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+
+	// As documented: the flags after the name.
+	stdout, stderr, code := captureCmd(cmdFreeze, []string{"deploy", "--until", end, "--reason", "DB maintenance window"})
+	if code != ExitOK || !strings.Contains(stdout, "until "+end) {
+		t.Fatalf("freeze --until: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+
+	stdout, _, _ = captureCmd(cmdStatus, []string{"deploy"})
+	if !strings.Contains(stdout, "until:    "+end) || !strings.Contains(stdout, "reason:   DB maintenance window") {
+		t.Errorf("status = %q, want the end and the reason", stdout)
+	}
+
+	_, stderr, code = captureCmd(cmdGuard, []string{"deploy", "--", "true"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "UTC (") || !strings.Contains(stderr, ": DB maintenance window") {
+		t.Errorf("guard: exit %d, stderr %q, want the end and the reason", code, stderr)
+	}
+}
+
+func TestLock_MessageAndLabels(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "ci-runner-17")
+
+	if _, stderr, code := captureCmd(cmdLock, []string{"migrate", "-m", "schema migration #482", "--label", "pr=482", "--label", "team=db"}); code != ExitOK {
+		t.Fatalf("lock: exit %d, stderr %q", code, stderr)
+	}
+
+	stdout, _, _ := captureCmd(cmdStatus, []string{"migrate"})
+	if !strings.Contains(stdout, "message:  schema migration #482") || !strings.Contains(stdout, "labels:   pr=482,team=db") {
+		t.Errorf("status:\n%s\nwant the message and labels", stdout)
+	}
+	stdout, _, _ = captureCmd(cmdStatus, []string{"--json", "migrate"})
+	var out statusOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Message != "schema migration #482" || out.Labels["team"] != "db" {
+		t.Errorf("status --json = %+v, want the message and labels", out)
+	}
+
+	t.Setenv("LOKT_OWNER", "me")
+	_, stderr, code := captureCmd(cmdGuard, []string{"migrate", "--", "true"})
+	if code != ExitLockHeld || !strings.Contains(stderr, "held by ci-runner-17") || !strings.Contains(stderr, "doing: schema migration #482") {
+		t.Errorf("guard on the held lock: exit %d, stderr %q; want the holder's message", code, stderr)
+	}
+
+	if _, _, code := captureCmd(cmdGuard, []string{"--label", "no-equals", "other", "--", "true"}); code != ExitUsage {
+		t.Errorf("--label without =: exit %d, want %d", code, ExitUsage)
+	}
+}
+
+func TestStatus_Schema2(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	hostname, _ := os.Hostname()
+	writeLockJSON(t, locksDir, "live.json", &lockfile.Lock{
+		Version: 1, Name: "live", LockID: "id-live", Owner: "alice", AgentID: "a1", Host: hostname, PID: os.Getpid(),
+		AcquiredAt: time.Now(), TTLSec: 600,
+	})
+	writeLockJSON(t, locksDir, "expired.json", &lockfile.Lock{
+		Version: 1, Name: "expired", LockID: "id-old", Owner: "bob", Host: hostname, PID: os.Getpid(),
+		AcquiredAt: time.Now().Add(-time.Hour), TTLSec: 60,
+	})
+
+	// Without --schema: the bare array, and a deprecation notice.
+	stdout, stderr, code := captureCmd(cmdStatus, []string{"--json"})
+	var bare []statusOutput
+	if code != ExitOK || json.Unmarshal([]byte(stdout), &bare) != nil || len(bare) != 2 {
+		t.Fatalf("--json: exit %d, output %s", code, stdout)
+	}
+	if !strings.Contains(stderr, "--schema=2") {
+		t.Errorf("--json without --schema: stderr %q, want a deprecation notice", stderr)
+	}
+
+	var env struct {
+		Schema      int            `json:"schema"`
+		GeneratedAt string         `json:"generated_at"`
+		Locks       []statusOutput `json:"locks"`
+	}
+	stdout, stderr, code = captureCmd(cmdStatus, []string{"--json", "--schema", "2"})
+	if code != ExitOK || stderr != "" {
+		t.Fatalf("--schema 2: exit %d, stderr %q", code, stderr)
+	}
+	if err := json.Unmarshal([]byte(stdout), &env); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if _, err := time.Parse(time.RFC3339, env.GeneratedAt); env.Schema != 2 || err != nil || len(env.Locks) != 2 {
+		t.Fatalf("envelope = %+v", env)
+	}
+	for _, l := range env.Locks {
+		switch l.Name {
+		case "live":
+			if l.LockID != "id-live" || l.AgentID != "a1" || l.ExpiresAt == "" || l.RemainingSec < 590 || l.StaleReason != "" {
+				t.Errorf("live lock = %+v", l)
+			}
+		case "expired":
+			if l.RemainingSec != 0 || l.StaleReason != string(stale.ReasonExpired) {
+				t.Errorf("expired lock = %+v, want stale_reason expired", l)
+			}
+		}
+	}
+
+	// One lock has the same shape.
+	stdout, _, code = captureCmd(cmdStatus, []string{"live", "--json", "--schema=2"})
+	env.Locks = nil
+	if code != ExitOK || json.Unmarshal([]byte(stdout), &env) != nil || len(env.Locks) != 1 || env.Locks[0].Name != "live" {
+		t.Errorf("status live --schema=2: exit %d, output %s", code, stdout)
+	}
+
+	if _, _, code := captureCmd(cmdStatus, []string{"--schema", "2"}); code != ExitUsage {
+		t.Errorf("--schema without --json: exit %d, want %d", code, ExitUsage)
+	}
+	if _, _, code := captureCmd(cmdStatus, []string{"--json", "--schema", "3"}); code != ExitUsage {
+		t.Errorf("--schema 3: exit %d, want %d", code, ExitUsage)
+	}
+}
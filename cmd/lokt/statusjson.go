@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// statusSchema is the version of the status --json envelope (--schema=2)
+// and of doctor --json, raised when a field changes meaning or goes away.
+// New fields don't raise it.
+const statusSchema = 2
+
+// schema1Notice is printed on stderr by status --json without --schema.
+const schema1Notice = "note: status --json prints a bare array, which is deprecated; " +
+	"pass --schema=2 for the versioned envelope, the default from the next release on"
+
+// statusEnvelope is the status --json output with --schema=2: the locks of
+// the listing (or the one lock asked for) in an object naming the schema.
+type statusEnvelope struct {
+	Schema      int               `json:"schema"`
+	GeneratedAt string            `json:"generated_at"`
+	Locks       []json.RawMessage `json:"locks"`
+}
+
+// withStatusSchema returns render, a status --json view, producing schema:
+// unchanged for 1, the bare array (or object, for one lock); its locks in a
+// statusEnvelope for 2. A view that failed without output stays silent.
+func withStatusSchema(schema int, render func(io.Writer) int) func(io.Writer) int {
+	if schema < statusSchema {
+		return render
+	}
+	return func(w io.Writer) int {
+		var frame bytes.Buffer
+		code := render(&frame)
+		if code != ExitOK && frame.Len() == 0 {
+			return code
+		}
+		env := statusEnvelope{Schema: statusSchema, GeneratedAt: time.Now().UTC().Format(time.RFC3339)}
+		if err := json.Unmarshal(wrapJSONArray(frame.Bytes()), &env.Locks); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+		if env.Locks == nil {
+			env.Locks = []json.RawMessage{}
+		}
+		data, _ := json.MarshalIndent(env, "", "  ")
+		fmt.Fprintln(w, string(data))
+		return code
+	}
+}
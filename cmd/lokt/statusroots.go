@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// rootStatus is one root's entry in status --all-roots --json: its locks as
+// status --json lists them, or why it couldn't be read.
+type rootStatus struct {
+	Root  string            `json:"root"`
+	Locks []json.RawMessage `json:"locks"`
+	Error string            `json:"error,omitempty"`
+}
+
+// statusRootDirs returns the roots status --all-roots (all) or --roots
+// (list, comma-separated) covers, and the directory their labels are
+// relative to: the git worktree's top level, or the working directory.
+func statusRootDirs(all bool, list string) ([]string, string, error) {
+	base, err := root.WorktreeTop()
+	if err != nil {
+		return nil, "", err
+	}
+	if all {
+		roots, err := root.DiscoverAll(base, root.DefaultDiscoverDepth)
+		return roots, base, err
+	}
+	var roots []string
+	for _, r := range strings.Split(list, ",") {
+		if r = strings.TrimSpace(r); r == "" {
+			continue
+		}
+		abs, err := filepath.Abs(r)
+		if err != nil {
+			return nil, "", err
+		}
+		roots = append(roots, abs)
+	}
+	if len(roots) == 0 {
+		return nil, "", errors.New("--roots needs at least one directory")
+	}
+	return roots, base, nil
+}
+
+// statusRoots implements status --all-roots and --roots: the listing of
+// each root in rootDirs, in one table with the root first on each line, or
+// in JSON one rootStatus per root. A root that can't be read is reported in
+// its place without failing the others.
+func statusRoots(w io.Writer, rootDirs []string, base string, jsonOutput bool) int {
+	results := make([]rootStatus, 0, len(rootDirs))
+	for _, dir := range rootDirs {
+		results = append(results, queryRoot(dir))
+	}
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Fprintln(w, string(data))
+		return ExitOK
+	}
+	if len(results) == 0 {
+		fmt.Fprintf(w, "no lokt roots under %s\n", base)
+		return ExitOK
+	}
+	labels := make([]string, len(results))
+	width := 0
+	for i, r := range results {
+		labels[i] = rootLabel(base, r.Root)
+		width = max(width, len(labels[i]))
+	}
+	for i, r := range results {
+		var lines bytes.Buffer
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(&lines, "error: %s\n", r.Error)
+		default:
+			_ = statusRoot(&lines, r.Root, nil, false, false)
+		}
+		for _, line := range strings.Split(strings.TrimRight(lines.String(), "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(w, "%-*s  %s\n", width, labels[i], line)
+			}
+		}
+	}
+	return ExitOK
+}
+
+// queryRoot lists the locks of the root at dir (after any relocation), or
+// records why it can't.
+func queryRoot(dir string) rootStatus {
+	rs := rootStatus{Root: dir, Locks: []json.RawMessage{}}
+	followed, err := root.Follow(dir)
+	if err != nil {
+		rs.Error = err.Error()
+		return rs
+	}
+	rs.Root = followed
+	if info, err := os.Stat(followed); err != nil || !info.IsDir() {
+		if err == nil {
+			err = fmt.Errorf("%s is not a directory", followed)
+		}
+		rs.Error = err.Error()
+		return rs
+	}
+	if _, err := os.ReadDir(root.LocksPath(followed)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		rs.Error = err.Error()
+		return rs
+	}
+	var frame bytes.Buffer
+	if code := statusRoot(&frame, followed, nil, false, true); code != ExitOK {
+		rs.Error = fmt.Sprintf("status exited %d", code)
+		return rs
+	}
+	if err := json.Unmarshal(wrapJSONArray(frame.Bytes()), &rs.Locks); err != nil {
+		rs.Error = err.Error()
+	}
+	return rs
+}
+
+// rootLabel names rootDir for the table: relative to base if below it.
+func rootLabel(base, rootDir string) string {
+	if rel, err := filepath.Rel(base, rootDir); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return rootDir
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// setupRoots creates roots a/.lokt and b/.lokt, each holding one lock, in a
+// directory outside git and makes it the working directory.
+func setupRoots(t *testing.T) string {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, svc := range []string{"a", "b"} {
+		locksDir := filepath.Join(dir, svc, ".lokt", "locks")
+		if err := os.MkdirAll(locksDir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		writeLockJSON(t, locksDir, svc+"-build.json", &lockfile.Lock{
+			Version: 1, Name: svc + "-build", Owner: "alice", Host: "other-host", PID: 1, AcquiredAt: time.Now(),
+		})
+	}
+	orig, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(orig) })
+	t.Setenv("LOKT_ROOT", "")
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+	return dir
+}
+
+func TestStatus_AllRoots(t *testing.T) {
+	dir := setupRoots(t)
+
+	stdout, stderr, code := captureCmd(cmdStatus, []string{"--all-roots"})
+	if code != ExitOK {
+		t.Fatalf("exit %d, stderr %s", code, stderr)
+	}
+	for _, want := range []string{"a/.lokt  a-build", "b/.lokt  b-build"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout = %q, want a line %q", stdout, want)
+		}
+	}
+
+	stdout, _, _ = captureCmd(cmdStatus, []string{"--all-roots", "--json"})
+	var out []struct {
+		Root  string `json:"root"`
+		Locks []struct {
+			Name string `json:"name"`
+		} `json:"locks"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("--json: %v\n%s", err, stdout)
+	}
+	if len(out) != 2 || out[0].Root != filepath.Join(dir, "a", ".lokt") || len(out[0].Locks) != 1 || out[0].Locks[0].Name != "a-build" {
+		t.Errorf("--json = %+v, want one entry per root with its lock", out)
+	}
+}
+
+func TestStatus_RootsReportsErrorsInline(t *testing.T) {
+	setupRoots(t)
+
+	stdout, stderr, code := captureCmd(cmdStatus, []string{"--roots", "missing/.lokt,b/.lokt", "--json"})
+	if code != ExitOK {
+		t.Fatalf("exit %d, stderr %s; one bad root must not fail the rest", code, stderr)
+	}
+	var out []rootStatus
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out[0].Error == "" || out[1].Error != "" || len(out[1].Locks) != 1 {
+		t.Errorf("--json = %+v, want an error for missing/.lokt and b's lock", out)
+	}
+
+	stdout, _, _ = captureCmd(cmdStatus, []string{"--roots", "missing/.lokt,b/.lokt"})
+	if !strings.Contains(stdout, "missing/.lokt  error:") || !strings.Contains(stdout, "b-build") {
+		t.Errorf("stdout = %q, want the error in place and b's lock", stdout)
+	}
+
+	for _, args := range [][]string{
+		{"--all-roots", "--roots", "a"}, {"--all-roots", "a-build"}, {"--all-roots", "--stale"}, {"--roots", "a", "--watch"},
+	} {
+		if _, _, code := captureCmd(cmdStatus, args); code != ExitUsage {
+			t.Errorf("status %v: exit %d, want %d", args, code, ExitUsage)
+		}
+	}
+}
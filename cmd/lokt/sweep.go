@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// sweepOutput is the JSON form of lokt sweep.
+type sweepOutput struct {
+	DryRun  bool             `json:"dry_run,omitempty"`
+	Pruned  []lock.Prunable  `json:"pruned"`
+	Removed []lock.GCRemoval `json:"removed"`
+	Errors  []string         `json:"errors,omitempty"`
+}
+
+// cmdSweep runs the stale-lock sweep that otherwise happens opportunistically
+// before lock commands, then garbage-collects ancillary per-name state
+// (lock.GC). Exit 1 if anything could not be removed.
+func cmdSweep(args []string) int {
+	fs := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Report what would be removed without removing it")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	retention := fs.Duration("retention", 0, "Keep state of names used within this period (default: gc_retention or 168h)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "usage: lokt sweep [--dry-run] [--json] [--retention duration]")
+		return ExitUsage
+	}
+	if *retention < 0 {
+		fmt.Fprintln(os.Stderr, "error: --retention must be positive (e.g., 72h)")
+		return ExitUsage
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if !*dryRun {
+		if code := checkWritable(rootDir, ""); code != ExitOK {
+			return code
+		}
+	}
+	if *retention == 0 {
+		if cfg, err := config.Load(rootDir); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: ignoring config: %v\n", err)
+		} else {
+			*retention = time.Duration(cfg.GCRetention)
+		}
+	}
+
+	auditor := newAuditor(rootDir)
+	grace := skewGrace(rootDir)
+	out := sweepOutput{DryRun: *dryRun, Pruned: lock.FindPrunable(rootDir, grace)}
+	var errs []error
+	if !*dryRun {
+		_, errs = lock.PruneAllExpired(rootDir, auditor, grace)
+		_, resErrs := lock.PruneReservations(rootDir, grace)
+		errs = append(errs, resErrs...)
+	}
+	removed, gcErrs := lock.GC(rootDir, lock.GCOptions{Retention: *retention, DryRun: *dryRun, Auditor: auditor})
+	out.Removed = removed
+	for _, err := range append(errs, gcErrs...) {
+		out.Errors = append(out.Errors, err.Error())
+	}
+	if out.Pruned == nil {
+		out.Pruned = []lock.Prunable{}
+	}
+	if out.Removed == nil {
+		out.Removed = []lock.GCRemoval{}
+	}
+
+	if *jsonOutput {
+		data, _ := json.MarshalIndent(out, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printSweep(out)
+	}
+	if len(out.Errors) > 0 {
+		return ExitError
+	}
+	return ExitOK
+}
+
+func printSweep(out sweepOutput) {
+	verb := "removed"
+	if out.DryRun {
+		verb = "would remove"
+	}
+	for _, p := range out.Pruned {
+		kind := "lock"
+		if p.Freeze {
+			kind = "freeze"
+		}
+		fmt.Printf("%s %s %s (%s)\n", verb, kind, p.Name, p.Reason)
+	}
+	for _, r := range out.Removed {
+		fmt.Printf("%s %s (%s)\n", verb, r.Path, r.Reason)
+	}
+	for _, e := range out.Errors {
+		fmt.Fprintf(os.Stderr, "error: %s\n", e)
+	}
+	if len(out.Pruned) == 0 && len(out.Removed) == 0 {
+		fmt.Println("nothing to sweep")
+	}
+}
@@ -1,7 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
 )
 
 func TestSweepEnabled(t *testing.T) {
@@ -13,6 +20,7 @@ func TestSweepEnabled(t *testing.T) {
 		{"unlock", true},
 		{"status", true},
 		{"guard", true},
+		{"plan", true},
 		{"freeze", true},
 		{"unfreeze", true},
 		{"why", true},
@@ -54,3 +62,57 @@ func TestRunSweep_WithRoot(t *testing.T) {
 	// Should run without error even with empty locks dir
 	runSweep()
 }
+
+func TestCmdSweep(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "old.json", &lockfile.Lock{
+		Version: 1, Name: "old", Owner: "cron", Host: "server", PID: 1,
+		AcquiredAt: time.Now().Add(-time.Hour), TTLSec: 60,
+	})
+	marker := filepath.Join(rootDir, "waiters", "gone", "h.1.1")
+	if err := os.MkdirAll(filepath.Dir(marker), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(marker, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, code := captureCmd(cmdSweep, []string{"--dry-run", "--json"})
+	if code != ExitOK {
+		t.Fatalf("sweep --dry-run: exit %d", code)
+	}
+	var out sweepOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("unmarshal %q: %v", stdout, err)
+	}
+	if !out.DryRun || len(out.Pruned) != 1 || len(out.Removed) != 2 {
+		t.Errorf("dry run = %+v, want one stale lock and the waiter marker and dir", out)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("dry run removed the marker: %v", err)
+	}
+
+	stdout, _, code = captureCmd(cmdSweep, nil)
+	if code != ExitOK {
+		t.Fatalf("sweep: exit %d", code)
+	}
+	for _, want := range []string{"removed lock old (expired)", "removed waiters/gone/h.1.1 (inactive)", "removed waiters/gone/ (empty)"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout = %q, want %q", stdout, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "waiters", "gone")); !os.IsNotExist(err) {
+		t.Errorf("waiters/gone should be removed (stat: %v)", err)
+	}
+
+	if stdout, _, _ := captureCmd(cmdSweep, nil); !strings.Contains(stdout, "nothing to sweep") {
+		t.Errorf("second sweep = %q, want nothing to sweep", stdout)
+	}
+	if _, _, code := captureCmd(cmdSweep, []string{"extra"}); code != ExitUsage {
+		t.Errorf("positional arg: exit %d, want %d", code, ExitUsage)
+	}
+}
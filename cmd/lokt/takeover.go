@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+)
+
+// lockTakeover is lokt lock --take-over-from: replace owner's hold on name,
+// for failover, without stomping on whoever recovered the lock first.
+func lockTakeover(rootDir, name, owner string, force bool, opts lock.AcquireOptions, jsonOutput bool) int {
+	err := lock.AcquireIfHeldBy(rootDir, name, owner, lock.TakeoverOptions{AcquireOptions: opts, Force: force})
+	if err == nil {
+		if jsonOutput {
+			printLockAcquireJSON(name)
+		} else {
+			fmt.Printf("took over lock %q from %s\n", name, owner)
+		}
+		return ExitOK
+	}
+
+	if code := lockFrozen(name, err, jsonOutput); code != ExitOK {
+		return code
+	}
+	var (
+		held     *lock.HeldError
+		changed  *lock.HolderChangedError
+		notStale *lock.NotStaleError
+	)
+	switch {
+	case errors.Is(err, lock.ErrNotFound):
+		reportError(name, err, "")
+		return ExitNotFound
+	case errors.As(err, &held):
+		if jsonOutput {
+			printLockDenyJSON(name, held.Lock, held.RetryAfter)
+		} else {
+			reportError(name, err, "")
+		}
+		return ExitLockHeld
+	case errors.As(err, &changed):
+		if jsonOutput {
+			printLockDenyJSON(name, changed.Lock, lock.RetryAfter(changed.Lock, opts.RetryAfterDefault))
+		} else {
+			reportError(name, err, "")
+		}
+		return ExitLockHeld
+	case errors.As(err, &notStale):
+		if jsonOutput {
+			printLockDenyJSON(name, notStale.Lock, lock.RetryAfter(notStale.Lock, opts.RetryAfterDefault))
+		} else {
+			reportError(name, err, fmt.Sprintf("error: %v (--force-takeover to take it over anyway)", err))
+		}
+		return ExitLockHeld
+	}
+	reportError(name, err, "")
+	return ExitError
+}
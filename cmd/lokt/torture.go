@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/doctor"
+)
+
+// tortureWorkerCmd is the hidden command lokt doctor --torture starts its
+// workers with.
+const tortureWorkerCmd = "_torture-worker"
+
+// runTorture runs lokt doctor --torture on rootDir and reports it as a check.
+func runTorture(rootDir string, duration time.Duration, procs int) doctor.CheckResult {
+	self, err := os.Executable()
+	if err == nil {
+		var rep *doctor.TortureReport
+		rep, err = doctor.Torture(rootDir, doctor.TortureOptions{
+			Duration: duration,
+			Procs:    procs,
+			Command:  []string{self, tortureWorkerCmd},
+		})
+		if err == nil {
+			return doctor.CheckTorture(rep)
+		}
+	}
+	return doctor.CheckResult{Name: "torture", Status: doctor.StatusFail, Message: err.Error()}
+}
+
+// cmdTortureWorker implements the hidden "lokt _torture-worker <scratch>
+// <deadline>": one worker of lokt doctor --torture, which prints how many
+// times it held the lock.
+func cmdTortureWorker(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: lokt %s <scratch root> <deadline>\n", tortureWorkerCmd)
+		return ExitUsage
+	}
+	deadline, err := time.Parse(time.RFC3339Nano, args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid deadline: %v\n", err)
+		return ExitUsage
+	}
+	n, err := doctor.TortureWorker(args[0], deadline)
+	fmt.Println(n)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	return ExitOK
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/transfer"
+)
+
+// cmdExport writes the root's locks and freezes (and with --audit, its
+// audit log) as a tar.gz archive for lokt import.
+func cmdExport(args []string) int {
+	fset := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := fset.String("output", "", "Write the archive to file atomically (- for stdout)")
+	withAudit := fset.Bool("audit", false, "Include the audit log")
+	if err := fset.Parse(args); err != nil || fset.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: lokt export [--output file] [--audit]")
+		return ExitUsage
+	}
+	sink := newOutputSink(*output)
+	if sink.path == "" && isTerminal(os.Stdout) {
+		fmt.Fprintln(os.Stderr, "error: refusing to write an archive to a terminal; use --output file")
+		return ExitUsage
+	}
+
+	rootDir, err := root.Find()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	m, warnings, err := transfer.Export(sink, rootDir, transfer.ExportOptions{Audit: *withAudit, LoktVersion: version})
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: export: %v\n", err)
+		return ExitError // a partial archive is never committed
+	}
+	locks, freezes := 0, 0
+	for _, e := range m.Entries {
+		if e.Freeze {
+			freezes++
+		} else {
+			locks++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d lock(s), %d freeze(s), %d audit event(s) from %s\n", locks, freezes, m.AuditEvents, rootDir)
+	return sink.finish(ExitOK)
+}
+
+// cmdImport unpacks an archive from lokt export into a root. Exit 2 if a
+// newer lock or freeze at the destination was left in place.
+func cmdImport(args []string) int {
+	fset := flag.NewFlagSet("import", flag.ContinueOnError)
+	rootFlag := fset.String("root", "", "Root to import into (default: the root lokt would use here)")
+	force := fset.Bool("force", false, "Replace existing locks and freezes even if newer")
+	dryRun := fset.Bool("dry-run", false, "Report what would be imported without writing")
+	noAudit := fset.Bool("no-audit", false, "Leave an archived audit log out")
+	jsonOutput := fset.Bool("json", false, "Output in JSON format")
+	if err := fset.Parse(interspersed(fset, args)); err != nil || fset.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: lokt import <archive|-> [--root dir] [--force] [--dry-run] [--no-audit] [--json]")
+		return ExitUsage
+	}
+
+	rootDir, err := importRoot(*rootFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return ExitError
+	}
+	if !*dryRun {
+		if code := checkWritable(rootDir, ""); code != ExitOK {
+			return code
+		}
+	}
+	var in io.Reader = os.Stdin
+	archive := fset.Arg(0)
+	if archive != "-" {
+		f, err := os.Open(archive) //nolint:gosec // G304: the archive is named by the user
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return ExitError
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+
+	rep, err := transfer.Import(rootDir, in, transfer.ImportOptions{Force: *force, DryRun: *dryRun, NoAudit: *noAudit})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: import: %v\n", err)
+		return ExitError
+	}
+	if !*dryRun {
+		emitImportEvent(rootDir, archive, rep)
+	}
+
+	if *jsonOutput {
+		data, _ := json.MarshalIndent(rep, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printImport(os.Stdout, rootDir, rep, *dryRun)
+	}
+	if rep.Count(transfer.ActionConflict) > 0 {
+		return ExitLockHeld
+	}
+	return ExitOK
+}
+
+// importRoot resolves the destination of lokt import: --root (following a
+// relocation marker) or the discovered root.
+func importRoot(flagValue string) (string, error) {
+	if flagValue == "" {
+		return root.Find()
+	}
+	dir, err := filepath.Abs(flagValue)
+	if err != nil {
+		return "", err
+	}
+	dir, err = root.Follow(dir)
+	var relocated *root.RelocatedError
+	if errors.As(err, &relocated) {
+		return "", fmt.Errorf("%w; import into %s instead", err, relocated.To)
+	}
+	return dir, err
+}
+
+func printImport(w io.Writer, rootDir string, rep *transfer.Report, dryRun bool) {
+	m := rep.Manifest
+	fmt.Fprintf(w, "archive: %s from %s on %s (lokt %s)\n", m.CreatedAt.Local().Format("2006-01-02 15:04:05"), m.Root, m.Host, m.LoktVersion)
+	for _, r := range rep.Results {
+		kind := "lock"
+		if r.Freeze {
+			kind = "freeze"
+		}
+		line := fmt.Sprintf("%-9s %s %s", r.Action, kind, r.Name)
+		if r.Reason != "" {
+			line += ": " + r.Reason
+		}
+		if r.Action == transfer.ActionConflict {
+			line += " (--force replaces it)"
+		}
+		fmt.Fprintln(w, line)
+	}
+	switch {
+	case rep.AuditSkipped != "":
+		fmt.Fprintf(w, "audit log not imported: %s\n", rep.AuditSkipped)
+	case rep.AuditEvents > 0:
+		fmt.Fprintf(w, "audit log: %d event(s)\n", rep.AuditEvents)
+	}
+	verb := "imported into"
+	if dryRun {
+		verb = "would import into"
+	}
+	fmt.Fprintf(w, "%s %s: %d imported, %d replaced, %d unchanged, %d conflict(s), %d skipped\n",
+		verb, rootDir,
+		rep.Count(transfer.ActionImported), rep.Count(transfer.ActionReplaced), rep.Count(transfer.ActionUnchanged),
+		rep.Count(transfer.ActionConflict), rep.Count(transfer.ActionSkipped))
+}
+
+// emitImportEvent records an import in the destination's audit log, after
+// any imported events.
+func emitImportEvent(rootDir, archive string, rep *transfer.Report) {
+	id := identity.Current()
+	newAuditor(rootDir).Emit(&audit.Event{
+		Event:   audit.EventImport,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra: map[string]any{
+			"archive":      archive,
+			"source_root":  rep.Manifest.Root,
+			"source_host":  rep.Manifest.Host,
+			"imported":     rep.Count(transfer.ActionImported),
+			"replaced":     rep.Count(transfer.ActionReplaced),
+			"unchanged":    rep.Count(transfer.ActionUnchanged),
+			"conflicts":    rep.Count(transfer.ActionConflict),
+			"skipped":      rep.Count(transfer.ActionSkipped),
+			"audit_events": rep.AuditEvents,
+		},
+	})
+}
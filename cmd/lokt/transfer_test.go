@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/transfer"
+)
+
+func TestExportImport(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", LockID: "abc", Owner: "alice", Host: "old-host", PID: 1, AcquiredAt: time.Now(),
+	})
+	archive := filepath.Join(t.TempDir(), "state.tar.gz")
+
+	stdout, stderr, code := captureCmd(cmdExport, []string{"--output", archive, "--audit"})
+	if code != ExitOK {
+		t.Fatalf("export: exit %d, stderr %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "wrote "+archive) || !strings.Contains(stderr, "exported 1 lock(s), 0 freeze(s)") {
+		t.Errorf("unexpected export output: %s / %s", stdout, stderr)
+	}
+
+	dst := filepath.Join(t.TempDir(), "new-root")
+	// Flags may follow the archive, as in the README.
+	if _, stderr, code := captureCmd(cmdImport, []string{archive, "--root", dst, "--dry-run"}); code != ExitOK {
+		t.Fatalf("import --dry-run after the archive: exit %d, stderr %s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "locks", "build.json")); !os.IsNotExist(err) {
+		t.Fatalf("import --dry-run wrote the lock: %v", err)
+	}
+	stdout, stderr, code = captureCmd(cmdImport, []string{"--root", dst, archive})
+	if code != ExitOK {
+		t.Fatalf("import: exit %d, stderr %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "imported  lock build") || !strings.Contains(stdout, "1 imported, 0 replaced") {
+		t.Errorf("unexpected import output: %s", stdout)
+	}
+	lf, err := lockfile.Read(filepath.Join(dst, "locks", "build.json"))
+	if err != nil || lf.Owner != "alice" || lf.Host != "old-host" || lf.LockID != "abc" {
+		t.Fatalf("imported lock = %+v, %v; want alice's lock unchanged", lf, err)
+	}
+	var sawImport bool
+	_ = audit.ScanFile(audit.Path(dst), func(e *audit.Event, _ []byte) bool {
+		sawImport = sawImport || e.Event == audit.EventImport
+		return true
+	})
+	if !sawImport {
+		t.Error("no import event in the destination audit log")
+	}
+
+	// A newer lock at the destination is a conflict: exit 2, left alone.
+	writeLockJSON(t, filepath.Join(dst, "locks"), "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", LockID: "def", Owner: "carol", Host: "new-host", PID: 1, AcquiredAt: time.Now().Add(time.Minute),
+	})
+	stdout, _, code = captureCmd(cmdImport, []string{"--root", dst, "--json", archive})
+	if code != ExitLockHeld {
+		t.Fatalf("import over a newer lock: exit %d, want %d", code, ExitLockHeld)
+	}
+	var rep transfer.Report
+	if err := json.Unmarshal([]byte(stdout), &rep); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if len(rep.Results) != 1 || rep.Results[0].Action != transfer.ActionConflict {
+		t.Errorf("results = %+v, want one conflict", rep.Results)
+	}
+}
+
+func TestImport_Usage(t *testing.T) {
+	if _, _, code := captureCmd(cmdImport, nil); code != ExitUsage {
+		t.Errorf("import without an archive: exit %d, want %d", code, ExitUsage)
+	}
+	bad := filepath.Join(t.TempDir(), "bad.tar.gz")
+	if err := os.WriteFile(bad, []byte("not an archive"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := captureCmd(cmdImport, []string{"--root", t.TempDir(), bad}); code != ExitError || !strings.Contains(stderr, "unsupported archive format") {
+		t.Errorf("import of a non-archive: exit %d, stderr %q", code, stderr)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nikolasavic/lokt/internal/audit"
 	"github.com/nikolasavic/lokt/internal/lockfile"
 )
 
@@ -48,8 +49,8 @@ func TestUnlockOwner_NoMatches(t *testing.T) {
 	if code != ExitOK {
 		t.Fatalf("expected exit %d, got %d", ExitOK, code)
 	}
-	if !strings.Contains(stdout, "no locks matched") {
-		t.Errorf("stdout = %q, want 'no locks matched'", stdout)
+	if !strings.Contains(stdout, "no locks owned by nobody") {
+		t.Errorf("stdout = %q, want 'no locks owned by nobody'", stdout)
 	}
 }
 
@@ -161,15 +162,53 @@ func TestUnlock_MutualExclusion_OwnerAndAll(t *testing.T) {
 	}
 }
 
-func TestUnlock_MutualExclusion_ForceWithOwner(t *testing.T) {
-	setupTestRoot(t)
+func TestUnlockOwner_ForceRecordsBreak(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "operator")
 
-	_, stderr, code := captureCmd(cmdUnlock, []string{"--force", "--owner", "agent-1"})
-	if code != ExitUsage {
-		t.Fatalf("expected exit %d, got %d", ExitUsage, code)
+	writeLockJSON(t, locksDir, "lock-a.json", &lockfile.Lock{
+		Name: "lock-a", Owner: "departed", Host: "h", PID: 1, AcquiredAt: time.Now(),
+	})
+
+	stdout, _, code := captureCmd(cmdUnlock, []string{"--force", "--owner", "departed"})
+	if code != ExitOK || !strings.Contains(stdout, "released lock-a\n") {
+		t.Fatalf("unlock --force --owner: exit %d, stdout %q", code, stdout)
 	}
-	if !strings.Contains(stderr, "--force/--break-stale cannot be combined") {
-		t.Errorf("stderr = %q, want flag conflict error", stderr)
+	events := readAuditLog(t, rootDir)
+	if len(events) != 1 || events[0].Event != audit.EventForceBreak || events[0].Name != "lock-a" {
+		t.Errorf("audit = %+v, want one force-break for lock-a", events)
+	}
+}
+
+func TestUnlockAllMine(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "my-session")
+
+	for _, name := range []string{"a", "b"} {
+		writeLockJSON(t, locksDir, name+".json", &lockfile.Lock{
+			Name: name, Owner: "my-session", Host: "h", PID: 1, AcquiredAt: time.Now(),
+		})
+	}
+
+	stdout, _, code := captureCmd(cmdUnlock, []string{"--all-mine"})
+	if code != ExitOK {
+		t.Fatalf("expected exit %d, got %d", ExitOK, code)
+	}
+	if want := "released a\nreleased b\nreleased 2 lock(s)\n"; stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+	if events := readAuditLog(t, rootDir); len(events) != 2 || events[0].Event != audit.EventRelease {
+		t.Errorf("audit = %+v, want a release event per lock", events)
+	}
+
+	stdout, _, code = captureCmd(cmdUnlock, []string{"--all-mine"})
+	if code != ExitOK || !strings.Contains(stdout, "no locks owned by my-session") {
+		t.Errorf("second --all-mine: exit %d, stdout %q", code, stdout)
+	}
+
+	_, stderr, code := captureCmd(cmdUnlock, []string{"--all-mine", "--force"})
+	if code != ExitUsage || !strings.Contains(stderr, "cannot be combined") {
+		t.Errorf("--all-mine --force: exit %d, stderr %q; want a usage error", code, stderr)
 	}
 }
 
@@ -201,3 +240,95 @@ func TestUnlock_SingleLockStillWorks(t *testing.T) {
 		t.Errorf("stdout = %q, want released message", stdout)
 	}
 }
+
+func TestUnlock_SeveralNames(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "ci")
+	writeLockJSON(t, locksDir, "theirs.json", &lockfile.Lock{
+		Name: "theirs", Owner: "other", Host: "h", PID: 1, AcquiredAt: time.Now(),
+	})
+	for _, name := range []string{"a", "b"} {
+		if _, stderr, code := captureCmd(cmdLock, []string{name}); code != ExitOK {
+			t.Fatalf("lock %s: exit %d, stderr %q", name, code, stderr)
+		}
+	}
+
+	// Every name is tried; the failures decide the exit code
+	stdout, stderr, code := captureCmd(cmdUnlock, []string{"a", "theirs", "b"})
+	if code != ExitNotOwner || !strings.Contains(stdout, `released lock "a"`) || !strings.Contains(stdout, `released lock "b"`) || !strings.Contains(stderr, `"theirs" held by other`) {
+		t.Errorf("unlock a theirs b: exit %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if _, err := os.Stat(locksDir + "/theirs.json"); err != nil {
+		t.Error("someone else's lock must be left alone without --force")
+	}
+
+	stdout, _, code = captureCmd(cmdUnlock, []string{"--json", "--force", "theirs", "gone"})
+	if code != ExitNotFound {
+		t.Errorf("unlock --force theirs gone: exit %d, want %d", code, ExitNotFound)
+	}
+	var statuses []string
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		var r batchResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		statuses = append(statuses, r.Name+":"+r.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "theirs:released,gone:not_found" {
+		t.Errorf("--json results = %s", got)
+	}
+}
+
+func TestUnlock_FlagsAfterName(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "me")
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Name: "build", Owner: "other", Host: "h", PID: 1, AcquiredAt: time.Now(),
+	})
+	writeLockJSON(t, locksDir, "stale.json", &lockfile.Lock{
+		Name: "stale", Owner: "cron", Host: "h", PID: 1,
+		AcquiredAt: time.Now().Add(-10 * time.Minute), TTLSec: 60,
+	})
+
+	// As docs/agents.md and docs/patterns.md write them.
+	for _, args := range [][]string{{"build", "--force"}, {"stale", "--break-stale"}} {
+		stdout, stderr, code := captureCmd(cmdUnlock, args)
+		if code != ExitOK || !strings.Contains(stdout, `released lock "`+args[0]+`"`) {
+			t.Errorf("unlock %v: exit %d, stdout %q, stderr %q", args, code, stdout, stderr)
+		}
+	}
+}
+
+func TestUnlock_Prefix(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+	for _, name := range []string{"ci-1234-build", "ci-1234-test", "ci-5678-build", "freeze-ci-1234-x"} {
+		writeLockJSON(t, locksDir, name+".json", &lockfile.Lock{
+			Name: name, Owner: "ci", Host: "h", PID: 1, AcquiredAt: time.Now(),
+		})
+	}
+
+	if _, _, code := captureCmd(cmdUnlock, []string{"--prefix", "ci-1234-", "x"}); code != ExitUsage {
+		t.Errorf("--prefix with a name: exit %d, want %d", code, ExitUsage)
+	}
+	if _, _, code := captureCmd(cmdUnlock, []string{"--fail-if-none", "x"}); code != ExitUsage {
+		t.Errorf("--fail-if-none without --prefix: exit %d, want %d", code, ExitUsage)
+	}
+
+	stdout, stderr, code := captureCmd(cmdUnlock, []string{"--force", "--prefix", "ci-1234-"})
+	if code != ExitOK || strings.Count(stdout, "released lock") != 2 {
+		t.Fatalf("unlock --prefix: exit %d, stdout %q, stderr %q; want both ci-1234 locks released", code, stdout, stderr)
+	}
+	for _, name := range []string{"ci-5678-build", "freeze-ci-1234-x"} {
+		if _, err := os.Stat(locksDir + "/" + name + ".json"); err != nil {
+			t.Errorf("%s should be left alone: %v", name, err)
+		}
+	}
+
+	_, stderr, code = captureCmd(cmdUnlock, []string{"--prefix", "ci-1234-"})
+	if code != ExitOK || !strings.Contains(stderr, `no locks match prefix "ci-1234-"`) {
+		t.Errorf("unlock --prefix with no match: exit %d, stderr %q", code, stderr)
+	}
+	if _, _, code := captureCmd(cmdUnlock, []string{"--prefix", "ci-1234-", "--fail-if-none"}); code != ExitNotFound {
+		t.Errorf("--fail-if-none with no match: exit %d, want %d", code, ExitNotFound)
+	}
+}
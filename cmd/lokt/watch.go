@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultWatchInterval is how often status --watch re-renders.
+const DefaultWatchInterval = 2 * time.Second
+
+// clearScreen moves the cursor home and clears the terminal.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// watchStatus calls render every interval until ctx is done and writes each
+// frame to w. On a terminal every frame replaces the previous one; otherwise
+// frames follow each other under a header line. With jsonOutput each frame
+// is compacted onto one line (NDJSON). Each frame is rendered into a buffer
+// and written at once, so locks appearing or disappearing mid-render and
+// terminal resizes never leave a half-drawn screen.
+func watchStatus(ctx context.Context, w io.Writer, interval time.Duration, tty, jsonOutput bool, title string, render func(io.Writer) int) int {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var frame bytes.Buffer
+		if code := render(&frame); code != ExitOK {
+			return code
+		}
+
+		var out bytes.Buffer
+		header := fmt.Sprintf("Every %s: %s    %s", interval, title, time.Now().Format("15:04:05"))
+		switch {
+		case jsonOutput:
+			if err := json.Compact(&out, frame.Bytes()); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return ExitError
+			}
+			out.WriteByte('\n')
+		case tty:
+			out.WriteString(clearScreen + header + "\n\n")
+			out.Write(frame.Bytes())
+		default:
+			out.WriteString(header + "\n")
+			out.Write(frame.Bytes())
+			out.WriteByte('\n')
+		}
+		if _, err := w.Write(out.Bytes()); err != nil {
+			return ExitOK // reader went away (e.g. piped into head)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ExitOK
+		case <-ticker.C:
+		}
+	}
+}
+
+// wrapJSONArray returns a JSON object rendered by a status view as a
+// one-element array, and nothing (a lock just pruned) as an empty one, so
+// every status --watch --json line is an array.
+func wrapJSONArray(frame []byte) []byte {
+	t := bytes.TrimSpace(frame)
+	switch {
+	case len(t) == 0:
+		return []byte("[]")
+	case t[0] == '{':
+		return append(append([]byte("["), t...), ']')
+	}
+	return frame
+}
+
+// isTerminal reports whether f is a character device, e.g. an interactive
+// terminal rather than a pipe or file.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// watchTitle is the command line status --watch shows in its header.
+func watchTitle(args []string, group string) string {
+	parts := []string{"lokt status"}
+	if group != "" {
+		parts = append(parts, "--group", group)
+	}
+	return strings.Join(append(parts, args...), " ")
+}
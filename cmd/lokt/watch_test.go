@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// watchFrames runs watchStatus until it has rendered n frames.
+func watchFrames(t *testing.T, n int, tty, jsonOutput bool, render func(io.Writer) int) (string, int) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	frames := 0
+	counted := func(w io.Writer) int {
+		frames++
+		if frames == n {
+			cancel()
+		}
+		return render(w)
+	}
+	var buf bytes.Buffer
+	code := watchStatus(ctx, &buf, time.Millisecond, tty, jsonOutput, "lokt status", counted)
+	return buf.String(), code
+}
+
+func TestStatusWatch_NDJSON(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", Owner: "alice", Host: "h", PID: 1, AcquiredAt: time.Now(), TTLSec: 300,
+	})
+
+	out, code := watchFrames(t, 3, false, true, statusWatchRender(rootDir, nil, "", false, true))
+	if code != ExitOK {
+		t.Fatalf("exit %d", code)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want one per frame: %q", len(lines), out)
+	}
+	for _, line := range lines {
+		var locks []statusOutput
+		if err := json.Unmarshal([]byte(line), &locks); err != nil || len(locks) != 1 || locks[0].Name != "build" {
+			t.Errorf("line %q: %v, want an array with build", line, err)
+		}
+	}
+}
+
+func TestStatusWatch_NamedLockComesAndGoes(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	render := statusWatchRender(rootDir, []string{"build"}, "", false, true)
+
+	// Not held: an empty array, not an error.
+	out, code := watchFrames(t, 1, false, true, render)
+	if code != ExitOK || out != "[]\n" {
+		t.Errorf("not held: exit %d, %q", code, out)
+	}
+
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", Owner: "alice", Host: "h", PID: 1, AcquiredAt: time.Now(),
+	})
+	out, _ = watchFrames(t, 1, false, true, render)
+	var locks []statusOutput
+	if err := json.Unmarshal([]byte(out), &locks); err != nil || len(locks) != 1 || locks[0].Owner != "alice" {
+		t.Errorf("held: %q (%v), want a one-element array", out, err)
+	}
+
+	text := statusWatchRender(rootDir, []string{"gone"}, "", false, false)
+	if out, _ := watchFrames(t, 1, false, false, text); !strings.Contains(out, `lock "gone" not held`) {
+		t.Errorf("text, not held: %q", out)
+	}
+}
+
+func TestStatusWatch_Terminal(t *testing.T) {
+	rootDir, locksDir := setupTestRoot(t)
+	writeLockJSON(t, locksDir, "build.json", &lockfile.Lock{
+		Version: 1, Name: "build", Owner: "alice", Host: "h", PID: 1, AcquiredAt: time.Now(), TTLSec: 300,
+	})
+
+	out, _ := watchFrames(t, 2, true, false, statusWatchRender(rootDir, nil, "", false, false))
+	if strings.Count(out, clearScreen) != 2 {
+		t.Errorf("want each frame to redraw the screen: %q", out)
+	}
+	if !strings.Contains(out, "Every 1ms: lokt status") || !strings.Contains(out, "left") {
+		t.Errorf("frame = %q, want header and remaining TTL", out)
+	}
+}
+
+func TestStatusWatch_Usage(t *testing.T) {
+	setupTestRoot(t)
+	if _, _, code := captureCmd(cmdStatus, []string{"--watch", "--output", "x"}); code != ExitUsage {
+		t.Errorf("--watch --output: exit %d, want %d", code, ExitUsage)
+	}
+	if _, _, code := captureCmd(cmdStatus, []string{"--watch", "--interval", "0s"}); code != ExitUsage {
+		t.Errorf("--interval 0s: exit %d, want %d", code, ExitUsage)
+	}
+}
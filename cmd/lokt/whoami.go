@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// configureIdentity resolves owners from identity_sources in the root's
+// config.json, if it sets them. Best-effort: without a root or a valid
+// config the default order applies (doctor reports a broken config).
+func configureIdentity() {
+	rootDir, err := root.Find()
+	if err != nil {
+		return
+	}
+	if cfg, err := config.Load(rootDir); err == nil {
+		identity.UseSources(cfg.IdentitySources)
+	}
+}
+
+// identityOutput is the identity lokt acts as, for whoami --json and the
+// identity of doctor --json.
+type identityOutput struct {
+	Owner         string   `json:"owner"`
+	Source        string   `json:"source"` // "" if no source applied
+	Via           string   `json:"via,omitempty"`
+	Host          string   `json:"host"`
+	PID           int      `json:"pid"`
+	AgentID       string   `json:"agent_id"`
+	AgentExplicit bool     `json:"agent_id_explicit"`
+	Sources       []string `json:"sources"`
+}
+
+// currentIdentity describes identity.Current and how its owner was resolved.
+func currentIdentity() identityOutput {
+	id := identity.Current()
+	srcs := identity.Sources()
+	res := identity.Resolve(srcs...)
+	out := identityOutput{
+		Owner:         res.Owner,
+		Source:        string(res.Source),
+		Via:           res.Via,
+		Host:          id.Host,
+		PID:           id.PID,
+		AgentID:       id.AgentID,
+		AgentExplicit: id.AgentExplicit,
+	}
+	for _, s := range srcs {
+		out.Sources = append(out.Sources, string(s))
+	}
+	return out
+}
+
+// ownerOrigin says where an owner came from, as "via GitHub Actions".
+func ownerOrigin(id identityOutput) string {
+	if id.Source == "" {
+		return "no source applied"
+	}
+	return "via " + id.Via
+}
+
+// cmdWhoami prints the identity locks taken from here are recorded under,
+// to debug why an ownership or reentrancy check goes the way it does.
+func cmdWhoami(args []string) int {
+	fs := flag.NewFlagSet("whoami", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: lokt whoami [--json]")
+		return ExitUsage
+	}
+
+	id := currentIdentity()
+	if *jsonOutput {
+		data, _ := json.MarshalIndent(id, "", "  ")
+		fmt.Println(string(data))
+		return ExitOK
+	}
+	printIdentity(os.Stdout, id)
+	return ExitOK
+}
+
+// printIdentity prints id as whoami does.
+func printIdentity(w io.Writer, id identityOutput) {
+	agent := "generated for this process; set LOKT_AGENT_ID to share one"
+	if id.AgentExplicit {
+		agent = "from LOKT_AGENT_ID"
+	}
+	fmt.Fprintf(w, "owner:    %s (%s)\n", id.Owner, ownerOrigin(id))
+	fmt.Fprintf(w, "host:     %s\n", id.Host)
+	fmt.Fprintf(w, "pid:      %d (this lokt process)\n", id.PID)
+	fmt.Fprintf(w, "agent_id: %s (%s)\n", id.AgentID, agent)
+	fmt.Fprintf(w, "sources:  %s\n", strings.Join(id.Sources, ", "))
+}
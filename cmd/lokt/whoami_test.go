@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+)
+
+func TestWhoami(t *testing.T) {
+	setupTestRoot(t)
+	t.Setenv("LOKT_OWNER", "deployer")
+	t.Setenv("LOKT_AGENT_ID", "")
+
+	stdout, _, code := captureCmd(cmdWhoami, nil)
+	if code != ExitOK || !strings.Contains(stdout, "owner:    deployer (via LOKT_OWNER)") || !strings.Contains(stdout, "sources:  env, ci, user") {
+		t.Errorf("whoami: exit %d, stdout %q", code, stdout)
+	}
+
+	stdout, _, code = captureCmd(cmdWhoami, []string{"--json"})
+	var out identityOutput
+	if code != ExitOK || json.Unmarshal([]byte(stdout), &out) != nil {
+		t.Fatalf("whoami --json: exit %d, stdout %q", code, stdout)
+	}
+	if out.Owner != "deployer" || out.Source != "env" || out.PID != os.Getpid() || out.AgentID == "" || out.AgentExplicit {
+		t.Errorf("whoami --json = %+v", out)
+	}
+}
+
+func TestWhoami_IdentitySourcesFromConfig(t *testing.T) {
+	rootDir, _ := setupTestRoot(t)
+	if err := os.WriteFile(filepath.Join(rootDir, "config.json"), []byte(`{"identity_sources": ["ci", "env"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOKT_OWNER", "deployer")
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_PROJECT_PATH", "acme/api")
+	t.Setenv("CI_JOB_ID", "77")
+	configureIdentity()
+	defer identity.UseSources(nil)
+
+	stdout, _, _ := captureCmd(cmdWhoami, []string{"--json"})
+	var out identityOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil || out.Owner != "gitlab:acme/api#77" || out.Via != "GitLab CI" {
+		t.Errorf("whoami --json = %s, want the GitLab job ahead of LOKT_OWNER", stdout)
+	}
+
+	stdout, _, _ = captureCmd(cmdDoctor, nil)
+	if !strings.Contains(stdout, "Identity:    gitlab:acme/api#77@") || !strings.Contains(stdout, "(via GitLab CI)") {
+		t.Errorf("doctor doesn't say where the owner came from: %s", stdout)
+	}
+}
@@ -578,6 +578,9 @@ func TestWhy_DeadPID_JSON(t *testing.T) {
 	if out.Reasons[0].HolderStaleReason != "dead_pid" {
 		t.Errorf("expected stale_reason 'dead_pid', got %q", out.Reasons[0].HolderStaleReason)
 	}
+	if !strings.Contains(stdout, `"holder_stale_reason_text": "holder process is no longer running"`) {
+		t.Errorf("expected holder_stale_reason_text in JSON, got: %s", stdout)
+	}
 
 	found := false
 	for _, s := range out.Suggestions {
@@ -620,3 +623,34 @@ func TestWhy_SuggestionsIncludeLockName(t *testing.T) {
 // Placeholder test to verify the function signature compiles
 // and unused import is not an issue.
 var _ = fmt.Sprint // ensure fmt import used
+
+func TestWhy_RecycledPID_JSON(t *testing.T) {
+	_, locksDir := setupTestRoot(t)
+
+	hostname, _ := os.Hostname()
+	// Our own (alive) PID with a bogus start time simulates PID reuse.
+	writeLockJSON(t, locksDir, "reused.json", &lockfile.Lock{
+		Name:       "reused",
+		Owner:      "ghost",
+		Host:       hostname,
+		PID:        os.Getpid(),
+		PIDStartNS: 1,
+		AcquiredAt: time.Now().Add(-3 * time.Minute),
+	})
+
+	stdout, _, _ := captureCmd(cmdWhy, []string{"--json", "reused"})
+	var out whyOutput
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("invalid JSON: %v\noutput: %s", err, stdout)
+	}
+	if len(out.Reasons) != 1 {
+		t.Fatalf("expected 1 reason, got %d", len(out.Reasons))
+	}
+	r := out.Reasons[0]
+	if r.Type != "recycled_pid" || r.HolderStaleReason != "recycled_pid" {
+		t.Errorf("expected recycled_pid, got type=%q stale_reason=%q", r.Type, r.HolderStaleReason)
+	}
+	if r.HolderStaleText == "" {
+		t.Error("expected holder_stale_reason_text")
+	}
+}
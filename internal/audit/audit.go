@@ -7,28 +7,55 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/nikolasavic/lokt/internal/root"
 )
 
 // Event types for audit log entries.
 const (
-	EventAcquire       = "acquire"        // Lock successfully acquired
-	EventDeny          = "deny"           // Lock acquisition denied (held by another)
-	EventRelease       = "release"        // Lock released normally
-	EventForceBreak    = "force-break"    // Lock removed via --force
-	EventStaleBreak    = "stale-break"    // Lock removed via --break-stale
-	EventAutoPrune     = "auto-prune"     // Lock auto-removed (dead PID on same host)
-	EventCorruptBreak  = "corrupt-break"  // Lock removed (corrupted/malformed file)
-	EventRenew         = "renew"          // Lock TTL renewed (heartbeat)
-	EventFreeze        = "freeze"         // Freeze switch activated
-	EventUnfreeze      = "unfreeze"       // Freeze switch deactivated
-	EventForceUnfreeze = "force-unfreeze" // Freeze removed via --force
-	EventFreezeDeny    = "freeze-deny"    // Guard blocked by active freeze
+	EventAcquire        = "acquire"            // Lock successfully acquired
+	EventDeny           = "deny"               // Lock acquisition denied (held by another)
+	EventRelease        = "release"            // Lock released normally
+	EventForceBreak     = "force-break"        // Lock removed via --force
+	EventStaleBreak     = "stale-break"        // Lock removed via --break-stale
+	EventAutoPrune      = "auto-prune"         // Stale lock auto-removed by an acquirer (dead PID, or expired while waiting)
+	EventCorruptBreak   = "corrupt-break"      // Lock removed (corrupted/malformed file)
+	EventRenew          = "renew"              // Lock TTL renewed (heartbeat)
+	EventFreeze         = "freeze"             // Freeze switch activated
+	EventUnfreeze       = "unfreeze"           // Freeze switch deactivated
+	EventForceUnfreeze  = "force-unfreeze"     // Freeze removed via --force
+	EventFreezeDeny     = "freeze-deny"        // Guard blocked by active freeze
+	EventThawWait       = "thaw-wait"          // Guard waiting for an active freeze to lift
+	EventSeqReset       = "seq-reset"          // Sequence counter rebuilt from the log (counter file was lost)
+	EventRelocate       = "relocate"           // Lock root copied to a new location by lokt relocate
+	EventClockGap       = "clock-gap-detected" // Heartbeat resumed after a wall-clock gap (e.g. suspended host) and re-checked ownership
+	EventGC             = "gc"                 // Leftover ancillary state (waiters/, ...) removed by lokt sweep
+	EventRetain         = "retain"             // Guard exited but kept its lock for a follow-up step (guard --no-release)
+	EventDeadlock       = "deadlock"           // Wait aborted: the lock's holder waits, directly or through others, for a lock the waiter holds
+	EventLockLost       = "lock-lost"          // Guard found its lock gone, taken over or unrenewable while the command ran
+	EventSkip           = "skip"               // Guard skipped its command because the lock was held (guard --if-free)
+	EventFreezeMigrate  = "freeze-migrate"     // Legacy locks/freeze-<name>.json moved to freezes/ by lokt doctor --fix
+	EventWaitTimeout    = "wait-timeout"       // A --wait acquisition gave up when its timeout ran out
+	EventImport         = "import"             // Locks and freezes imported from a lokt export archive
+	EventLockVanished   = "lock-vanished"      // Guard found its lock file gone or replaced when it checked (before release, or on --verify-interval)
+	EventTakeover       = "takeover"           // Lock taken over from the holder named in lock --take-over-from; extra names the previous holder
+	EventAdopt          = "adopt"              // Handed-off lock (lock --handoff) rewritten to the process that holds it now; extra.previous_pid
+	EventGuardStart     = "guard-start"        // Guard started its command under the lock; extra.argv, extra.cwd, extra.child_pid
+	EventGuardEnd       = "guard-end"          // Guard's command exited; extra.exit_code, extra.duration_ms, extra.signal if one ended it
+	EventReserve        = "reserve"            // Name reserved for an owner in a time window; extra.reserved_for, extra.from, extra.until
+	EventUnreserve      = "unreserve"          // Reservation cancelled by its owner or whoever made it
+	EventForceUnreserve = "force-unreserve"    // Someone else's reservation cancelled via --force
+	EventReserveDeny    = "reserve-deny"       // Acquisition refused: the hold would overlap another owner's reservation
+	// Guard found its lock gone or taken over when it resumed after a
+	// wall-clock gap (a suspended host, a stopped guard); extra.gap_sec
+	EventLostSuspend = "lock-lost-after-suspend"
 )
 
 // Event represents a single audit log entry.
 // Each event is serialized as one JSON line in the audit log.
 type Event struct {
 	Timestamp time.Time      `json:"ts"`
+	Seq       uint64         `json:"seq,omitempty"` // Per-root sequence number; 0 if none was assigned
 	Event     string         `json:"event"`
 	Name      string         `json:"name"`
 	LockID    string         `json:"lock_id,omitempty"`
@@ -48,7 +75,9 @@ var openFileFn = os.OpenFile
 // Writer appends audit events to a JSONL file.
 // All writes are non-blocking: errors are logged to stderr, never returned.
 type Writer struct {
-	rootDir string
+	rootDir  string
+	hooks    []func(*Event)
+	rotation RotatePolicy
 }
 
 // NewWriter creates a Writer that will append to <rootDir>/audit.log.
@@ -56,14 +85,59 @@ func NewWriter(rootDir string) *Writer {
 	return &Writer{rootDir: rootDir}
 }
 
+// OnEmit registers fn to be called with every event after it has been
+// written. Hooks run synchronously on the emitting goroutine, so they must
+// hand slow work (network I/O) off rather than block the lock operation.
+func (w *Writer) OnEmit(fn func(*Event)) {
+	w.hooks = append(w.hooks, fn)
+}
+
 // Emit appends an event to the audit log.
 // This method never returns an error. If writing fails, the error is logged to stderr.
 // This ensures lock operations are never blocked by audit failures.
+//
+// Events are numbered with a per-root sequence (see seq.go). Numbering is
+// best-effort: if the counter can't be locked promptly the event is written
+// without a seq rather than waiting.
 func (w *Writer) Emit(e *Event) {
 	if e.Timestamp.IsZero() {
 		e.Timestamp = time.Now()
 	}
 
+	// A relocated root is followed so long-lived writers (guard heartbeats)
+	// log next to the locks they renew.
+	dir, err := root.Follow(w.rootDir)
+	if err != nil {
+		dir = w.rootDir
+	}
+
+	appendEvent(dir, e, w.rotation)
+	for _, fn := range w.hooks {
+		fn(e)
+	}
+}
+
+// appendEvent numbers e (when the sequence lock is available), writes it,
+// and rotates the log if p says it is due (see rotate.go).
+func appendEvent(dir string, e *Event, p RotatePolicy) {
+	unlock, err := lockSeqFn(dir, seqLockWait)
+	if err != nil {
+		write(dir, e)
+		return
+	}
+	// Hold the sequence lock across the append so file order matches seq
+	// order for every numbered event.
+	if marker := assignSeq(dir, e); marker != nil {
+		write(dir, marker)
+	}
+	write(dir, e)
+	compress := rotateIfDue(dir, p, time.Now())
+	unlock()
+	compressSegments(dir, compress)
+}
+
+// write appends one event as a JSON line to the audit log in rootDir.
+func write(rootDir string, e *Event) {
 	data, err := json.Marshal(e)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "lokt: audit marshal error: %v\n", err)
@@ -71,16 +145,20 @@ func (w *Writer) Emit(e *Event) {
 	}
 	data = append(data, '\n')
 
-	path := filepath.Join(w.rootDir, auditFileName)
+	path := filepath.Join(rootDir, auditFileName)
 
 	// O_APPEND is atomic on POSIX for writes smaller than PIPE_BUF (typically 4096 bytes).
 	// Our events are well under this limit.
-	f, err := openFileFn(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600) //nolint:gosec // G304: path is controlled
+	perm := root.SharedFilePerm(rootDir)
+	f, err := openFileFn(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, perm) //nolint:gosec // G304: path is controlled
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "lokt: audit open error: %v\n", err)
 		return
 	}
 	defer func() { _ = f.Close() }()
+	if perm != 0600 {
+		_ = f.Chmod(perm) // past the umask; fails harmlessly if another user made it
+	}
 
 	if _, err := f.Write(data); err != nil {
 		fmt.Fprintf(os.Stderr, "lokt: audit write error: %v\n", err)
@@ -172,6 +172,31 @@ func TestWriterSetsTimestampIfMissing(t *testing.T) {
 	}
 }
 
+func TestWriterOnEmitRunsAfterWrite(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir)
+
+	var seen []string
+	w.OnEmit(func(e *Event) {
+		// The event must already be on disk (and numbered) when hooks run.
+		data, err := os.ReadFile(filepath.Join(dir, "audit.log"))
+		if err != nil || !strings.Contains(string(data), `"name":"`+e.Name+`"`) {
+			t.Errorf("hook ran before %q was written: %v", e.Name, err)
+		}
+		if e.Seq == 0 {
+			t.Errorf("hook saw unnumbered event %q", e.Name)
+		}
+		seen = append(seen, e.Name)
+	})
+
+	w.Emit(&Event{Event: EventAcquire, Name: "a", Owner: "alice", Host: "h1", PID: 1})
+	w.Emit(&Event{Event: EventRelease, Name: "b", Owner: "alice", Host: "h1", PID: 1})
+
+	if strings.Join(seen, ",") != "a,b" {
+		t.Errorf("hook saw %v, want [a b]", seen)
+	}
+}
+
 func TestWriterHandlesMissingDirectory(t *testing.T) {
 	// Writer should not panic when directory doesn't exist.
 	// It logs to stderr but doesn't return an error.
@@ -303,3 +328,54 @@ func TestEventConstants(t *testing.T) {
 		t.Errorf("EventStaleBreak = %q, want %q", EventStaleBreak, "stale-break")
 	}
 }
+
+func TestScanFile(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir)
+	w.Emit(&Event{Event: EventAcquire, Name: "a"})
+	w.Emit(&Event{Event: EventRelease, Name: "a"})
+
+	// Append a malformed line and a blank line; both must be skipped.
+	f, err := os.OpenFile(Path(dir), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("not json\n\n")
+	_ = f.Close()
+	w.Emit(&Event{Event: EventAcquire, Name: "b"})
+
+	var names []string
+	err = ScanFile(Path(dir), func(e *Event, line []byte) bool {
+		if !strings.Contains(string(line), e.Event) {
+			t.Errorf("raw line %q does not match event %q", line, e.Event)
+		}
+		names = append(names, e.Event+":"+e.Name)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("ScanFile() error = %v", err)
+	}
+	want := "acquire:a,release:a,acquire:b"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("events = %s, want %s", got, want)
+	}
+}
+
+func TestScanFile_StopEarlyAndMissing(t *testing.T) {
+	dir := t.TempDir()
+	if err := ScanFile(Path(dir), func(*Event, []byte) bool { return true }); err != nil {
+		t.Errorf("ScanFile() on missing log error = %v, want nil", err)
+	}
+
+	w := NewWriter(dir)
+	w.Emit(&Event{Event: EventAcquire, Name: "a"})
+	w.Emit(&Event{Event: EventAcquire, Name: "b"})
+	count := 0
+	_ = ScanFile(Path(dir), func(*Event, []byte) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Errorf("callback calls = %d, want 1", count)
+	}
+}
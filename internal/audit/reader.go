@@ -0,0 +1,208 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxLineSize bounds a single audit line read by Scan. Events are well under
+// 4KB; the larger buffer only guards against hand-edited logs.
+const maxLineSize = 1024 * 1024
+
+// segmentSkew is how much older than a ScanAll cutoff a rotated segment's
+// last write may be and still be read. Events are timestamped by the hosts
+// that emit them, so one written just before the cutoff by a host whose clock
+// runs ahead can carry a timestamp after it.
+const segmentSkew = 5 * time.Minute
+
+// Path returns the path to the audit log for a root.
+func Path(rootDir string) string {
+	return filepath.Join(rootDir, auditFileName)
+}
+
+// Scan decodes JSONL audit events from r and calls fn for each one, passing
+// the decoded event and the raw line. Blank and malformed lines are skipped.
+// Scanning stops early when fn returns false.
+func Scan(r io.Reader, fn func(e *Event, line []byte) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+		if !fn(&e, line) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// ScanFile is Scan over the file at path. A missing file yields no events
+// and no error.
+func ScanFile(path string, fn func(e *Event, line []byte) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	return Scan(f, fn)
+}
+
+// ScanAll is Scan over the whole audit log of rootDir: the rotated segments,
+// oldest first, then audit.log (see rotate.go). Segments last written before
+// since can't hold later events and are skipped; a zero since reads them all.
+// Callers still filter events by time themselves.
+func ScanAll(rootDir string, since time.Time, fn func(e *Event, line []byte) bool) error {
+	files, err := openSegments(rootDir, since)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	for _, f := range files {
+		stop := false
+		err := scanOpen(f, func(e *Event, line []byte) bool {
+			if !fn(e, line) {
+				stop = true
+				return false
+			}
+			return true
+		})
+		if err != nil || stop {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanAllFollow is ScanAll for a caller that goes on to follow audit.log
+// (lokt audit --since --tail). It returns audit.log as it was opened for the
+// scan, nil if there was none, and the offset just past the last complete
+// line read from it: following that file from there, then whatever replaces
+// it, neither misses nor repeats an event written meanwhile. A last line
+// still being written is left for the follower. The caller closes live.
+func ScanAllFollow(rootDir string, since time.Time, fn func(e *Event, line []byte) bool) (live *os.File, offset int64, err error) {
+	files, err := openSegments(rootDir, since)
+	if err != nil {
+		return nil, 0, err
+	}
+	if n := len(files); n > 0 && files[n-1].Name() == Path(rootDir) {
+		live, files = files[n-1], files[:n-1]
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+	stop := false
+	for _, f := range files {
+		err := scanOpen(f, func(e *Event, line []byte) bool {
+			stop = !fn(e, line)
+			return !stop
+		})
+		if err != nil {
+			if live != nil {
+				_ = live.Close()
+			}
+			return nil, 0, err
+		}
+		if stop {
+			break
+		}
+	}
+	if live == nil {
+		return nil, 0, nil
+	}
+	r := bufio.NewReader(live)
+	for !stop {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			break // EOF, with any partial line left unread
+		}
+		offset += int64(len(line))
+		var e Event
+		if len(line) > 1 && json.Unmarshal(line[:len(line)-1], &e) == nil {
+			stop = !fn(&e, line[:len(line)-1])
+		}
+	}
+	if _, err := live.Seek(offset, io.SeekStart); err != nil {
+		_ = live.Close()
+		return nil, 0, err
+	}
+	return live, offset, nil
+}
+
+// openSegments opens the segments ScanAll reads. They are opened under the
+// sequence lock when it can be had, so a concurrent rotation can't shift a
+// segment between listing and opening it; once open, renames don't matter.
+func openSegments(rootDir string, since time.Time) ([]*os.File, error) {
+	if unlock, err := lockSeqFn(rootDir, seqLockWait); err == nil {
+		defer unlock()
+	}
+	segs, err := segments(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	var files []*os.File
+	for _, s := range segs {
+		if s.index > 0 && !since.IsZero() && s.modTime.Before(since.Add(-segmentSkew)) {
+			continue
+		}
+		f, err := os.Open(s.path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // pruned meanwhile
+		}
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// scanSegment is Scan over one segment, decompressing a gzipped one.
+func scanSegment(s segment, fn func(e *Event, line []byte) bool) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	return scanOpen(f, fn)
+}
+
+// scanOpen is Scan over an open segment file, gzipped or not.
+func scanOpen(f *os.File, fn func(e *Event, line []byte) bool) error {
+	var r io.Reader = f
+	if filepath.Ext(f.Name()) == ".gz" {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = zr.Close() }()
+		r = zr
+	}
+	return Scan(r, fn)
+}
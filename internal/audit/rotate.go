@@ -0,0 +1,308 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// Rotation.
+//
+// Once audit.log reaches a size or age limit, the writer that notices renames
+// it to audit.log.1 and the next event starts a fresh file. Older segments
+// shift up (audit.log.1 becomes audit.log.2, ...) and those beyond Keep are
+// deleted. Writers open the log with O_APPEND for every event, so one that
+// opened it just before the rename appends to audit.log.1 instead, which is
+// still read. Rotation happens under the sequence lock, so only one writer
+// rotates at a time and seq order still matches file order; where that lock
+// is unavailable (Windows) the log isn't rotated.
+//
+// With Compress, segments from audit.log.2 up are gzipped (audit.log.2.gz).
+// audit.log.1 stays plain because a late writer may still append to it.
+// Compression runs after the sequence lock is released, into a temp file
+// that replaces the segment only if it hasn't been shifted meanwhile.
+
+// DefaultRotateKeep is how many rotated segments are kept when
+// RotatePolicy.Keep is zero.
+const DefaultRotateKeep = 5
+
+// RotatePolicy configures audit log rotation. The zero value never rotates.
+type RotatePolicy struct {
+	MaxSize  int64         // rotate once audit.log is at least this many bytes
+	MaxAge   time.Duration // rotate once audit.log's first event is this old
+	Keep     int           // rotated segments to keep; zero means DefaultRotateKeep
+	Compress bool          // gzip segments from audit.log.2 up
+}
+
+// enabled reports whether p rotates at all.
+func (p RotatePolicy) enabled() bool {
+	return p.MaxSize > 0 || p.MaxAge > 0
+}
+
+func (p RotatePolicy) keep() int {
+	if p.Keep <= 0 {
+		return DefaultRotateKeep
+	}
+	return p.Keep
+}
+
+// SetRotation makes w rotate the audit log according to p.
+func (w *Writer) SetRotation(p RotatePolicy) {
+	w.rotation = p
+}
+
+// segment is one rotated audit log file.
+type segment struct {
+	path    string
+	index   int // 1 for audit.log.1; 0 for audit.log itself
+	gz      bool
+	modTime time.Time
+}
+
+// segments returns the audit log files of rootDir, oldest first: the
+// rotated segments by descending index, then audit.log if it exists. When a
+// segment exists both plain and gzipped (compression just finished), the
+// gzipped one is used.
+func segments(rootDir string) ([]segment, error) {
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	byIndex := make(map[int]segment)
+	for _, e := range entries {
+		idx, gz, ok := parseSegmentName(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		if prev, seen := byIndex[idx]; seen && prev.gz {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since ReadDir
+		}
+		byIndex[idx] = segment{path: filepath.Join(rootDir, e.Name()), index: idx, gz: gz, modTime: info.ModTime()}
+	}
+	out := make([]segment, 0, len(byIndex))
+	for _, s := range byIndex {
+		out = append(out, s)
+	}
+	// audit.log (index 0) is the newest, then .1, .2, ...
+	slices.SortFunc(out, func(a, b segment) int {
+		if a.index == 0 || b.index == 0 {
+			return a.index - b.index
+		}
+		return b.index - a.index
+	})
+	if len(out) > 0 && out[0].index == 0 {
+		out = append(out[1:], out[0])
+	}
+	return out, nil
+}
+
+// parseSegmentName recognizes audit.log, audit.log.<n> and audit.log.<n>.gz.
+func parseSegmentName(name string) (index int, gz, ok bool) {
+	if name == auditFileName {
+		return 0, false, true
+	}
+	rest, found := strings.CutPrefix(name, auditFileName+".")
+	if !found {
+		return 0, false, false
+	}
+	rest, gz = strings.CutSuffix(rest, ".gz")
+	n, err := strconv.Atoi(rest)
+	if err != nil || n < 1 || strconv.Itoa(n) != rest {
+		return 0, false, false
+	}
+	return n, gz, true
+}
+
+func segmentPath(rootDir string, index int, gz bool) string {
+	path := fmt.Sprintf("%s.%d", Path(rootDir), index)
+	if gz {
+		path += ".gz"
+	}
+	return path
+}
+
+// rotateIfDue rotates the audit log of rootDir if p says it is due. It must
+// be called with the sequence lock held. It returns the plain segments that
+// should now be compressed, for compressSegments after the lock is released.
+func rotateIfDue(rootDir string, p RotatePolicy, now time.Time) []string {
+	if !p.enabled() {
+		return nil
+	}
+	info, err := os.Stat(Path(rootDir))
+	if err != nil || info.Size() == 0 {
+		return nil
+	}
+	due := p.MaxSize > 0 && info.Size() >= p.MaxSize
+	if !due && p.MaxAge > 0 {
+		first, ok := firstEventTime(Path(rootDir))
+		due = ok && now.Sub(first) >= p.MaxAge
+	}
+	if !due {
+		return nil
+	}
+
+	segs, err := segments(rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lokt: audit rotate error: %v\n", err)
+		return nil
+	}
+	keep := p.keep()
+	// Oldest first, so shifting never overwrites a segment not yet moved.
+	for _, s := range segs {
+		if s.index == 0 {
+			continue
+		}
+		if s.index >= keep {
+			_ = os.Remove(s.path)
+			_ = os.Remove(segmentPath(rootDir, s.index, !s.gz)) // a leftover twin
+			continue
+		}
+		if err := os.Rename(s.path, segmentPath(rootDir, s.index+1, s.gz)); err != nil {
+			fmt.Fprintf(os.Stderr, "lokt: audit rotate error: %v\n", err)
+			return nil
+		}
+	}
+	if err := os.Rename(Path(rootDir), segmentPath(rootDir, 1, false)); err != nil {
+		fmt.Fprintf(os.Stderr, "lokt: audit rotate error: %v\n", err)
+		return nil
+	}
+	_ = lockfile.SyncDir(Path(rootDir))
+
+	if !p.Compress {
+		return nil
+	}
+	var plain []string
+	for i := 2; i <= keep; i++ {
+		path := segmentPath(rootDir, i, false)
+		if _, err := os.Stat(path); err == nil {
+			plain = append(plain, path)
+		}
+	}
+	return plain
+}
+
+// firstEventTime returns the timestamp of the first event in the log at path.
+func firstEventTime(path string) (time.Time, bool) {
+	f, err := os.Open(path) //nolint:gosec // G304: path is controlled
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer func() { _ = f.Close() }()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return time.Time{}, false
+	}
+	var e Event
+	if json.Unmarshal(line, &e) != nil || e.Timestamp.IsZero() {
+		return time.Time{}, false
+	}
+	return e.Timestamp, true
+}
+
+// compressSegments gzips each plain segment into a temp file, then, under
+// the sequence lock, swaps it in if the segment is still where it was.
+// Best-effort: a segment left plain is still read.
+func compressSegments(rootDir string, paths []string) {
+	for _, path := range paths {
+		if err := compressSegment(rootDir, path); err != nil {
+			fmt.Fprintf(os.Stderr, "lokt: audit compress error: %v\n", err)
+		}
+	}
+}
+
+func compressSegment(rootDir, path string) error {
+	src, err := os.Open(path) //nolint:gosec // G304: path is controlled
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(rootDir, filepath.Base(path)+".gz.tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	zw, _ := gzip.NewWriterLevel(tmp, gzip.BestSpeed)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	// Keep the segment's mtime: readers use it to skip old segments.
+	_ = os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime())
+
+	unlock, err := lockSeqFn(rootDir, time.Second)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if cur, err := os.Stat(path); err != nil || !os.SameFile(cur, info) || cur.Size() != info.Size() {
+		return nil // shifted or written to meanwhile; the next rotation retries
+	}
+	if err := os.Rename(tmp.Name(), path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// Prune deletes rotated segments of rootDir's audit log last written before
+// cutoff and returns their paths. audit.log itself is never removed.
+func Prune(rootDir string, cutoff time.Time) ([]string, error) {
+	// Under the sequence lock, so a concurrent rotation can't shift a newer
+	// segment into a name about to be removed.
+	unlock, err := lockSeqFn(rootDir, 5*time.Second)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("lock audit log: %w", err)
+	}
+	if unlock != nil {
+		defer unlock()
+	}
+	segs, err := segments(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, s := range segs {
+		if s.index == 0 || !s.modTime.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, err
+		}
+		removed = append(removed, s.path)
+	}
+	if len(removed) > 0 {
+		_ = lockfile.SyncDir(Path(rootDir))
+	}
+	return removed, nil
+}
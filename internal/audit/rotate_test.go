@@ -0,0 +1,263 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func scanAllEvents(t *testing.T, dir string, since time.Time) []*Event {
+	t.Helper()
+	var events []*Event
+	if err := ScanAll(dir, since, func(e *Event, _ []byte) bool {
+		events = append(events, e)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func segmentNames(t *testing.T, dir string) []string {
+	t.Helper()
+	segs, err := segments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range segs {
+		names = append(names, filepath.Base(s.path))
+	}
+	return names
+}
+
+func TestRotate_BySizeKeepsN(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir)
+	// Every event exceeds MaxSize, so each one rotates the log.
+	w.SetRotation(RotatePolicy{MaxSize: 1, Keep: 3})
+	for range 6 {
+		w.Emit(&Event{Event: EventAcquire, Name: "r", Owner: "a", Host: "h", PID: 1})
+	}
+
+	want := []string{"audit.log.3", "audit.log.2", "audit.log.1"}
+	if got := segmentNames(t, dir); !slices.Equal(got, want) {
+		t.Errorf("segments = %v, want %v", got, want)
+	}
+	events := scanAllEvents(t, dir, time.Time{})
+	var seqs []uint64
+	for _, e := range events {
+		seqs = append(seqs, e.Seq)
+	}
+	if !slices.Equal(seqs, []uint64{4, 5, 6}) {
+		t.Errorf("seqs across segments = %v, want the newest three in order", seqs)
+	}
+}
+
+func TestRotate_ByAge(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir)
+	w.SetRotation(RotatePolicy{MaxAge: time.Hour})
+	w.Emit(&Event{Timestamp: time.Now().Add(-2 * time.Hour), Event: EventAcquire, Name: "r"})
+	if got := segmentNames(t, dir); !slices.Equal(got, []string{"audit.log.1"}) {
+		t.Fatalf("segments = %v, want the old log rotated", got)
+	}
+	w.Emit(&Event{Event: EventRelease, Name: "r"})
+	w.Emit(&Event{Event: EventRelease, Name: "r"})
+	if got := segmentNames(t, dir); !slices.Equal(got, []string{"audit.log.1", "audit.log"}) {
+		t.Errorf("segments = %v, want a fresh log kept", got)
+	}
+}
+
+func TestRotate_Compress(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir)
+	w.SetRotation(RotatePolicy{MaxSize: 1, Keep: 3, Compress: true})
+	for range 4 {
+		w.Emit(&Event{Event: EventAcquire, Name: "r", Owner: "a", Host: "h", PID: 1})
+	}
+
+	want := []string{"audit.log.3.gz", "audit.log.2.gz", "audit.log.1"}
+	if got := segmentNames(t, dir); !slices.Equal(got, want) {
+		t.Errorf("segments = %v, want %v", got, want)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp*")); len(tmps) != 0 {
+		t.Errorf("temp files left behind: %v", tmps)
+	}
+	if events := scanAllEvents(t, dir, time.Time{}); len(events) != 3 || events[0].Seq != 2 {
+		t.Errorf("events = %d (first seq %d), want 3 read through gzip", len(events), events[0].Seq)
+	}
+}
+
+func TestRotate_ConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	const writers, perWriter = 6, 20
+
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := NewWriter(dir)
+			w.SetRotation(RotatePolicy{MaxSize: 2048, Keep: 100})
+			for range perWriter {
+				w.Emit(&Event{Event: EventAcquire, Name: "contended", Owner: "a", Host: "h", PID: 1})
+			}
+		}()
+	}
+	wg.Wait()
+
+	events := scanAllEvents(t, dir, time.Time{})
+	if len(events) != writers*perWriter {
+		t.Fatalf("events = %d, want %d", len(events), writers*perWriter)
+	}
+	var prev uint64
+	for _, e := range events {
+		if e.Seq == 0 {
+			continue
+		}
+		if e.Seq <= prev {
+			t.Errorf("seq %d read after %d", e.Seq, prev)
+		}
+		prev = e.Seq
+	}
+}
+
+func TestScanAll_SkipsOldSegments(t *testing.T) {
+	dir := t.TempDir()
+	write(dir, &Event{Timestamp: time.Now().Add(-48 * time.Hour), Event: EventAcquire, Name: "old"})
+	if err := os.Rename(Path(dir), segmentPath(dir, 1, false)); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-47 * time.Hour)
+	if err := os.Chtimes(segmentPath(dir, 1, false), old, old); err != nil {
+		t.Fatal(err)
+	}
+	write(dir, &Event{Timestamp: time.Now(), Event: EventAcquire, Name: "new"})
+
+	if events := scanAllEvents(t, dir, time.Time{}); len(events) != 2 {
+		t.Errorf("ScanAll(zero since) = %d events, want 2", len(events))
+	}
+	events := scanAllEvents(t, dir, time.Now().Add(-time.Hour))
+	if len(events) != 1 || events[0].Name != "new" {
+		t.Errorf("ScanAll(1h ago) = %+v, want only the current log", events)
+	}
+}
+
+func TestScanAllFollow(t *testing.T) {
+	dir := t.TempDir()
+	write(dir, &Event{Timestamp: time.Now(), Event: EventAcquire, Name: "rotated"})
+	if err := os.Rename(Path(dir), segmentPath(dir, 1, false)); err != nil {
+		t.Fatal(err)
+	}
+	write(dir, &Event{Timestamp: time.Now(), Event: EventAcquire, Name: "live"})
+	info, err := os.Stat(Path(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(Path(dir), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"event":"acq`) // still being written
+	_ = f.Close()
+
+	var names []string
+	live, offset, err := ScanAllFollow(dir, time.Time{}, func(e *Event, _ []byte) bool {
+		names = append(names, e.Name)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = live.Close() }()
+	if !slices.Equal(names, []string{"rotated", "live"}) {
+		t.Errorf("scanned %v, want [rotated live]", names)
+	}
+	if live.Name() != Path(dir) || offset != info.Size() {
+		t.Errorf("live = %s at %d, want audit.log at %d, before the partial line", live.Name(), offset, info.Size())
+	}
+
+	if live, _, err := ScanAllFollow(t.TempDir(), time.Time{}, func(*Event, []byte) bool { return true }); live != nil || err != nil {
+		t.Errorf("ScanAllFollow(no log) = %v, %v; want nil, nil", live, err)
+	}
+}
+
+func TestEmit_CounterRebuiltFromRotatedSegment(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir)
+	w.SetRotation(RotatePolicy{MaxSize: 1})
+	for range 3 {
+		w.Emit(&Event{Event: EventAcquire, Name: "x"})
+	}
+	if err := os.Remove(filepath.Join(dir, seqFileName)); err != nil {
+		t.Fatal(err)
+	}
+
+	// audit.log is gone after the last rotation; the counter resumes from
+	// the newest rotated segment.
+	w.Emit(&Event{Event: EventRelease, Name: "x"})
+	events := scanAllEvents(t, dir, time.Time{})
+	last := events[len(events)-1]
+	if last.Event != EventRelease || last.Seq != 5 {
+		t.Errorf("event after reset = %+v, want seq 5 after a seq-reset marker", last)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir)
+	w.SetRotation(RotatePolicy{MaxSize: 1, Keep: 5})
+	for range 3 {
+		w.Emit(&Event{Event: EventAcquire, Name: "p"})
+	}
+	w.SetRotation(RotatePolicy{})
+	w.Emit(&Event{Event: EventRelease, Name: "p"})
+
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	for _, i := range []int{2, 3} {
+		if err := os.Chtimes(segmentPath(dir, i, false), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chtimes(Path(dir), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := Prune(dir, time.Now().Add(-30*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("Prune() removed %v, want audit.log.3 and audit.log.2", removed)
+	}
+	if got := segmentNames(t, dir); !slices.Equal(got, []string{"audit.log.1", "audit.log"}) {
+		t.Errorf("segments after prune = %v, want audit.log kept regardless of age", got)
+	}
+}
+
+func TestParseSegmentName(t *testing.T) {
+	tests := []struct {
+		name  string
+		index int
+		gz    bool
+		ok    bool
+	}{
+		{"audit.log", 0, false, true},
+		{"audit.log.1", 1, false, true},
+		{"audit.log.12.gz", 12, true, true},
+		{"audit.log.0", 0, false, false},
+		{"audit.log.01", 0, false, false},
+		{"audit.log.1.gz.tmp123", 0, false, false},
+		{"audit.seq", 0, false, false},
+	}
+	for _, tt := range tests {
+		index, gz, ok := parseSegmentName(tt.name)
+		if index != tt.index || gz != tt.gz || ok != tt.ok {
+			t.Errorf("parseSegmentName(%q) = %d, %v, %v; want %d, %v, %v", tt.name, index, gz, ok, tt.index, tt.gz, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// Per-root sequence numbering.
+//
+// Timestamps from hosts sharing a root can tie or run backwards under clock
+// skew, so file order is the only reliable causal order and it is lost as
+// soon as events are merged or filtered. Each event therefore carries a seq
+// drawn from a counter file (audit.seq) that is read, incremented and
+// rewritten (temp+rename) under an flock on audit.seq.lock. Readers order by
+// (seq, ts) via Less.
+//
+// If the counter file is missing or unreadable, numbering resumes after the
+// highest seq found in the log and a seq-reset event records the gap.
+const (
+	seqFileName     = "audit.seq"
+	seqLockFileName = "audit.seq.lock"
+
+	// seqLockWait bounds how long Emit waits for the sequence lock before
+	// writing the event without a seq.
+	seqLockWait = 100 * time.Millisecond
+)
+
+// Injectable for testing lock contention.
+var lockSeqFn = lockSeq
+
+// assignSeq sets e.Seq to the next sequence number for rootDir and persists
+// the counter. It must be called with the sequence lock held. If the counter
+// had to be rebuilt from the log, it returns a seq-reset marker to be written
+// before e. On any counter error e is left unnumbered.
+func assignSeq(rootDir string, e *Event) *Event {
+	counterPath := filepath.Join(rootDir, seqFileName)
+
+	last, err := readSeq(counterPath)
+	var marker *Event
+	if err != nil {
+		last = maxSeqAll(rootDir)
+		if last > 0 {
+			host, _ := os.Hostname()
+			marker = &Event{
+				Timestamp: e.Timestamp,
+				Seq:       last + 1,
+				Event:     EventSeqReset,
+				Host:      host,
+				PID:       os.Getpid(),
+				Extra:     map[string]any{"previous_max_seq": last},
+			}
+			last++
+		}
+	}
+
+	next := last + 1
+	if err := lockfile.WriteFileAtomic(counterPath, []byte(strconv.FormatUint(next, 10)+"\n"), root.SharedFilePerm(rootDir)); err != nil {
+		fmt.Fprintf(os.Stderr, "lokt: audit seq error: %v\n", err)
+		return nil
+	}
+	e.Seq = next
+	return marker
+}
+
+// readSeq returns the last issued sequence number from the counter file.
+func readSeq(path string) (uint64, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path is controlled
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// MaxSeq returns the highest seq in the audit log at path, or 0 if there is
+// none.
+func MaxSeq(path string) uint64 {
+	var maxSeq uint64
+	_ = ScanFile(path, func(e *Event, _ []byte) bool {
+		if e.Seq > maxSeq {
+			maxSeq = e.Seq
+		}
+		return true
+	})
+	return maxSeq
+}
+
+// maxSeqAll is MaxSeq over the whole log, rotated segments included: the
+// highest seq in the newest segment that has any.
+func maxSeqAll(rootDir string) uint64 {
+	segs, err := segments(rootDir)
+	if err != nil {
+		return MaxSeq(Path(rootDir))
+	}
+	for _, s := range slices.Backward(segs) {
+		var maxSeq uint64
+		_ = scanSegment(s, func(e *Event, _ []byte) bool {
+			maxSeq = max(maxSeq, e.Seq)
+			return true
+		})
+		if maxSeq > 0 {
+			return maxSeq
+		}
+	}
+	return 0
+}
+
+// Less is the ordering key for audit events: by seq when both events carry
+// one, otherwise by timestamp.
+func Less(a, b *Event) bool {
+	if a.Seq != 0 && b.Seq != 0 && a.Seq != b.Seq {
+		return a.Seq < b.Seq
+	}
+	return a.Timestamp.Before(b.Timestamp)
+}
+
+// SortEvents orders events by Less, keeping file order for ties.
+func SortEvents(events []*Event) {
+	sort.SliceStable(events, func(i, j int) bool { return Less(events[i], events[j]) })
+}
+
+// ErrLogExists is returned by Seed when the root already has an audit log.
+var ErrLogExists = errors.New("audit log already exists")
+
+// Seed starts rootDir's audit log with lines carried over from another root
+// (lokt import) and resumes numbering after their highest seq, so events
+// emitted afterwards sort after them. It refuses a root that already has an
+// audit log (ErrLogExists): merging two numberings would scramble the order.
+// It returns the number of events written; malformed lines are dropped.
+func Seed(rootDir string, lines []byte) (int, error) {
+	unlock, err := lockSeqFn(rootDir, seqLockWait)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	if segs, err := segments(rootDir); err != nil {
+		return 0, err
+	} else if len(segs) > 0 {
+		return 0, ErrLogExists
+	}
+
+	var buf bytes.Buffer
+	var n int
+	var maxSeq uint64
+	err = Scan(bytes.NewReader(lines), func(e *Event, line []byte) bool {
+		buf.Write(line)
+		buf.WriteByte('\n')
+		n++
+		maxSeq = max(maxSeq, e.Seq)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if err := lockfile.WriteFileAtomic(Path(rootDir), buf.Bytes(), root.SharedFilePerm(rootDir)); err != nil {
+		return 0, err
+	}
+	counterPath := filepath.Join(rootDir, seqFileName)
+	if last, err := readSeq(counterPath); err == nil {
+		maxSeq = max(maxSeq, last)
+	}
+	counter := []byte(strconv.FormatUint(maxSeq, 10) + "\n")
+	if err := lockfile.WriteFileAtomic(counterPath, counter, root.SharedFilePerm(rootDir)); err != nil {
+		return n, err
+	}
+	return n, nil
+}
@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func readAllEvents(t *testing.T, dir string) []*Event {
+	t.Helper()
+	var events []*Event
+	if err := ScanFile(Path(dir), func(e *Event, _ []byte) bool {
+		events = append(events, e)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestEmit_AssignsSequentialSeq(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir)
+	for i := 0; i < 5; i++ {
+		w.Emit(&Event{Event: EventAcquire, Name: "seq", Owner: "a", Host: "h", PID: 1})
+	}
+
+	events := readAllEvents(t, dir)
+	for i, e := range events {
+		if e.Seq != uint64(i+1) {
+			t.Errorf("event %d: seq = %d, want %d", i, e.Seq, i+1)
+		}
+	}
+	if got, _ := readSeq(filepath.Join(dir, seqFileName)); got != 5 {
+		t.Errorf("counter = %d, want 5", got)
+	}
+	entries, _ := filepath.Glob(filepath.Join(dir, ".lock-*.tmp"))
+	if len(entries) != 0 {
+		t.Errorf("counter temp files left behind: %v", entries)
+	}
+}
+
+func TestEmit_ConcurrentWritersNoDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	const writers, perWriter = 8, 25
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := NewWriter(dir) // separate writers, as separate processes would be
+			for j := 0; j < perWriter; j++ {
+				w.Emit(&Event{Event: EventAcquire, Name: "contended", Owner: "a", Host: "h", PID: 1})
+			}
+		}()
+	}
+	wg.Wait()
+
+	events := readAllEvents(t, dir)
+	if len(events) != writers*perWriter {
+		t.Fatalf("expected %d events, got %d", writers*perWriter, len(events))
+	}
+	seen := make(map[uint64]bool)
+	var prev uint64
+	numbered := 0
+	for _, e := range events {
+		if e.Seq == 0 {
+			continue // lock wait exceeded; written unnumbered by design
+		}
+		numbered++
+		if seen[e.Seq] {
+			t.Errorf("duplicate seq %d", e.Seq)
+		}
+		seen[e.Seq] = true
+		if e.Seq <= prev {
+			t.Errorf("seq %d appears after %d in the file", e.Seq, prev)
+		}
+		prev = e.Seq
+	}
+	if numbered == 0 {
+		t.Error("expected at least some numbered events")
+	}
+}
+
+func TestEmit_LockContentionFallsBack(t *testing.T) {
+	dir := t.TempDir()
+	old := lockSeqFn
+	defer func() { lockSeqFn = old }()
+	lockSeqFn = func(string, time.Duration) (func(), error) {
+		return nil, errors.New("busy")
+	}
+
+	NewWriter(dir).Emit(&Event{Event: EventAcquire, Name: "busy", Owner: "a", Host: "h", PID: 1})
+	events := readAllEvents(t, dir)
+	if len(events) != 1 || events[0].Seq != 0 {
+		t.Errorf("expected one unnumbered event, got %+v", events)
+	}
+}
+
+func TestEmit_CounterDeletedResumesWithMarker(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		corrupt func(path string) error
+	}{
+		{"deleted", os.Remove},
+		{"corrupted", func(path string) error { return os.WriteFile(path, []byte("garbage"), 0600) }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w := NewWriter(dir)
+			for i := 0; i < 3; i++ {
+				w.Emit(&Event{Event: EventAcquire, Name: "x", Owner: "a", Host: "h", PID: 1})
+			}
+			if err := tc.corrupt(filepath.Join(dir, seqFileName)); err != nil {
+				t.Fatal(err)
+			}
+
+			w.Emit(&Event{Event: EventRelease, Name: "x", Owner: "a", Host: "h", PID: 1})
+			events := readAllEvents(t, dir)
+			if len(events) != 5 {
+				t.Fatalf("expected 5 events, got %d", len(events))
+			}
+			marker, last := events[3], events[4]
+			if marker.Event != EventSeqReset || marker.Seq != 4 {
+				t.Errorf("marker = %+v, want seq-reset with seq 4", marker)
+			}
+			if prev, _ := marker.Extra["previous_max_seq"].(float64); prev != 3 {
+				t.Errorf("previous_max_seq = %v, want 3", marker.Extra["previous_max_seq"])
+			}
+			if last.Event != EventRelease || last.Seq != 5 {
+				t.Errorf("event after reset = %+v, want release with seq 5", last)
+			}
+		})
+	}
+}
+
+func TestEmit_FirstUseNoMarker(t *testing.T) {
+	dir := t.TempDir()
+	// A log from before sequence numbers existed.
+	if err := os.WriteFile(Path(dir), []byte(`{"ts":"2026-01-01T00:00:00Z","event":"acquire","name":"x","owner":"a","host":"h","pid":1}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	NewWriter(dir).Emit(&Event{Event: EventRelease, Name: "x", Owner: "a", Host: "h", PID: 1})
+
+	events := readAllEvents(t, dir)
+	if len(events) != 2 || events[1].Seq != 1 {
+		t.Errorf("expected legacy event then seq 1 with no marker, got %+v", events)
+	}
+}
+
+func TestSortEvents(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []*Event{
+		{Seq: 3, Timestamp: base, Name: "c"},
+		{Seq: 1, Timestamp: base.Add(time.Second), Name: "a"}, // skewed clock
+		{Seq: 2, Timestamp: base, Name: "b"},
+	}
+	SortEvents(events)
+	for i, want := range []string{"a", "b", "c"} {
+		if events[i].Name != want {
+			t.Errorf("position %d = %s, want %s", i, events[i].Name, want)
+		}
+	}
+
+	unnumbered := []*Event{
+		{Timestamp: base.Add(time.Second), Name: "late"},
+		{Timestamp: base, Name: "early"},
+	}
+	SortEvents(unnumbered)
+	if unnumbered[0].Name != "early" {
+		t.Errorf("without seq, events should sort by timestamp: %s first", unnumbered[0].Name)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	src := t.TempDir()
+	w := NewWriter(src)
+	for i := 0; i < 3; i++ {
+		w.Emit(&Event{Event: EventAcquire, Name: "seed", Owner: "a", Host: "h", PID: 1})
+	}
+	lines, err := os.ReadFile(Path(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	n, err := Seed(dst, append(lines, []byte("not json\n")...))
+	if err != nil || n != 3 {
+		t.Fatalf("Seed() = %d, %v, want 3, nil", n, err)
+	}
+	// Numbering resumes after the seeded events.
+	NewWriter(dst).Emit(&Event{Event: EventRelease, Name: "seed", Owner: "a", Host: "h", PID: 1})
+	events := readAllEvents(t, dst)
+	if len(events) != 4 || events[3].Seq != 4 {
+		t.Fatalf("events after seeding = %d, last seq %d; want 4, 4", len(events), events[len(events)-1].Seq)
+	}
+
+	if _, err := Seed(dst, lines); !errors.Is(err, ErrLogExists) {
+		t.Errorf("Seed() into a root with a log: err = %v, want ErrLogExists", err)
+	}
+}
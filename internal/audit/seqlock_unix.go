@@ -0,0 +1,42 @@
+//go:build unix
+
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// lockSeq takes an exclusive flock on the root's sequence lock file, retrying
+// for up to wait. The returned function releases it.
+func lockSeq(rootDir string, wait time.Duration) (func(), error) {
+	perm := root.SharedFilePerm(rootDir)
+	f, err := os.OpenFile(filepath.Join(rootDir, seqLockFileName), os.O_CREATE|os.O_RDWR, perm) //nolint:gosec // G304: path is controlled
+	if err != nil {
+		return nil, err
+	}
+	if perm != 0600 {
+		_ = f.Chmod(perm)
+	}
+	fd := int(f.Fd()) //nolint:gosec // G115: file descriptors fit in int
+	deadline := time.Now().Add(wait)
+	for {
+		err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return func() {
+				_ = syscall.Flock(fd, syscall.LOCK_UN)
+				_ = f.Close()
+			}, nil
+		}
+		if !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			_ = f.Close()
+			return nil, err
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
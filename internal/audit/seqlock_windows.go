@@ -0,0 +1,13 @@
+//go:build windows
+
+package audit
+
+import (
+	"errors"
+	"time"
+)
+
+// lockSeq is not implemented on Windows; events are written without a seq.
+func lockSeq(_ string, _ time.Duration) (func(), error) {
+	return nil, errors.New("audit sequence lock not supported on windows")
+}
@@ -0,0 +1,381 @@
+// Package config loads optional per-root settings from <root>/config.json.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// FileName is the name of the config file inside the lokt root.
+const FileName = "config.json"
+
+// Snapshot defaults, applied when the config enables snapshots but leaves
+// the interval or retention unset.
+const (
+	DefaultSnapshotInterval  = 60 * time.Second
+	DefaultSnapshotRetention = 7 // days
+)
+
+// Duration is a time.Duration that unmarshals from a Go duration string
+// ("90s", "5m") or a plain number of seconds.
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+	var secs float64
+	if err := json.Unmarshal(data, &secs); err != nil {
+		return fmt.Errorf("invalid duration %s: expected string (e.g. \"5m\") or seconds", data)
+	}
+	*d = Duration(time.Duration(secs * float64(time.Second)))
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ByteSize is a size in bytes that unmarshals from a plain number or a
+// string with a unit suffix ("512KB", "100MB", "1GiB"). Units are powers of
+// 1024 with or without the "i".
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+	{"B", 1},
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("invalid size %s: expected bytes or a string (e.g. \"100MB\")", data)
+		}
+		*b = ByteSize(n)
+		return nil
+	}
+	num, mult := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, u := range byteUnits {
+		if rest, ok := strings.CutSuffix(num, u.suffix); ok {
+			num, mult = strings.TrimSpace(rest), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || num == "" {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = ByteSize(n * float64(mult))
+	return nil
+}
+
+// AuditConfig configures rotation of the audit log. Rotation is off unless
+// MaxSize or MaxAge is set.
+type AuditConfig struct {
+	// MaxSize rotates audit.log once it reaches this size.
+	MaxSize ByteSize `json:"max_size,omitempty"`
+	// MaxAge rotates audit.log once its first event is this old.
+	MaxAge Duration `json:"max_age,omitempty"`
+	// Keep is how many rotated files are kept. Zero means the built-in
+	// default (5).
+	Keep int `json:"keep,omitempty"`
+	// Compress gzips rotated files other than the newest.
+	Compress bool `json:"compress,omitempty"`
+}
+
+// SnapshotConfig configures the periodic state recorder.
+type SnapshotConfig struct {
+	Enabled       bool     `json:"enabled"`
+	Interval      Duration `json:"interval,omitempty"`
+	RetentionDays int      `json:"retention_days,omitempty"`
+}
+
+// EffectiveInterval returns the snapshot interval, applying the default.
+func (s SnapshotConfig) EffectiveInterval() time.Duration {
+	if s.Interval <= 0 {
+		return DefaultSnapshotInterval
+	}
+	return time.Duration(s.Interval)
+}
+
+// EffectiveRetentionDays returns the retention period in days, applying the default.
+func (s SnapshotConfig) EffectiveRetentionDays() int {
+	if s.RetentionDays <= 0 {
+		return DefaultSnapshotRetention
+	}
+	return s.RetentionDays
+}
+
+// ServeConfig configures the embedded HTTP status server.
+type ServeConfig struct {
+	// ForceToken is the bearer token required by the break-glass release
+	// endpoint. lokt serve --allow-force refuses to start without it.
+	ForceToken string `json:"force_token,omitempty"`
+}
+
+// DefaultHookTimeout bounds one run of the event hook when the config
+// leaves hooks.timeout unset.
+const DefaultHookTimeout = 5 * time.Second
+
+// HooksConfig configures the event hook, <root>/hooks/on-event: a command
+// run for each audit event of the listed types.
+type HooksConfig struct {
+	// Events are the audit event types the hook runs for. Unset means
+	// DefaultHookEvents; an empty list turns the hook off.
+	Events []string `json:"events,omitempty"`
+	// Timeout bounds one run of the hook. Zero means DefaultHookTimeout.
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// DefaultHookEvents returns the event types the hook runs for unless
+// hooks.events says otherwise: the ones someone usually wants to hear about.
+func DefaultHookEvents() []string {
+	return []string{audit.EventForceBreak, audit.EventCorruptBreak, audit.EventFreeze, audit.EventUnfreeze}
+}
+
+// EffectiveEvents returns the event types the hook runs for, applying the
+// default.
+func (h HooksConfig) EffectiveEvents() []string {
+	if h.Events == nil {
+		return DefaultHookEvents()
+	}
+	return h.Events
+}
+
+// EffectiveTimeout returns the hook timeout, applying the default.
+func (h HooksConfig) EffectiveTimeout() time.Duration {
+	if h.Timeout <= 0 {
+		return DefaultHookTimeout
+	}
+	return time.Duration(h.Timeout)
+}
+
+// Lock transitions that can trigger a per-lock webhook.
+const (
+	TransitionAcquired        = "acquired"
+	TransitionReleased        = "released"
+	TransitionForceBroken     = "force-broken"
+	TransitionFrozen          = "frozen"
+	TransitionExpiredObserved = "expired-observed"
+)
+
+// Transitions lists every valid notify key.
+func Transitions() []string {
+	return []string{TransitionAcquired, TransitionReleased, TransitionForceBroken, TransitionFrozen, TransitionExpiredObserved}
+}
+
+// LockPolicy holds settings that apply to a single lock name.
+type LockPolicy struct {
+	// Notify maps a transition name to the webhook URL that is POSTed
+	// when that transition happens to this lock.
+	Notify map[string]string `json:"notify,omitempty"`
+}
+
+// Config is the JSON structure of <root>/config.json.
+// Every field is optional; a missing file yields the zero Config.
+type Config struct {
+	Snapshot SnapshotConfig `json:"snapshot"`
+	Serve    ServeConfig    `json:"serve"`
+	Audit    AuditConfig    `json:"audit"`
+	Hooks    HooksConfig    `json:"hooks"`
+	// RetryAfterDefault is the retry hint given to callers denied by a
+	// holder without a TTL. Zero means the built-in default (60s).
+	RetryAfterDefault Duration `json:"retry_after_default,omitempty"`
+	// AdaptiveBackoff lets --wait polling stretch its backoff when many
+	// processes wait for the same lock. Unset means enabled.
+	AdaptiveBackoff *bool `json:"adaptive_backoff,omitempty"`
+	// GCRetention is how long a lock name must be unused before lokt sweep
+	// removes its leftover state. Zero means the built-in default (7 days).
+	GCRetention Duration `json:"gc_retention,omitempty"`
+	// DefaultTTL is the TTL lokt lock and lokt guard use when --ttl isn't
+	// given. Zero means no TTL.
+	DefaultTTL Duration `json:"default_ttl,omitempty"`
+	// WaitPollInterval caps the delay between polls of a --wait, before
+	// jitter and adaptive backoff. Zero means the built-in default (2s).
+	WaitPollInterval Duration `json:"wait_poll_interval,omitempty"`
+	// WatchInterval is how often lokt status --watch redraws when
+	// --interval isn't given. Zero means the built-in default (2s).
+	WatchInterval Duration `json:"watch_interval,omitempty"`
+	// ClockSkewGrace is how long past its expires_at another host's lock
+	// must be before waiters and sweeps break it, and how far ahead of this
+	// host's clock lock timestamps may be before lokt doctor warns. Zero
+	// means the built-in default (30s).
+	ClockSkewGrace Duration `json:"clock_skew_grace,omitempty"`
+	// ShardLocks spreads lock files over subdirectories of locks/ named by
+	// this many hex digits of a hash of the lock name (2: 256 of them), for
+	// roots with tens of thousands of locks. Zero keeps them all in locks/.
+	// Locks already in place stay readable where they are; lokt doctor
+	// --fix moves them. See root.ShardLevel.
+	ShardLocks int `json:"shard_locks,omitempty"`
+	// Flock has lokt guard keep an advisory flock(2) on its lock file on
+	// top of the O_EXCL create, as with guard --flock: belt and braces for
+	// filesystems whose O_EXCL can't be trusted. Off by default.
+	Flock bool `json:"flock,omitempty"`
+	// IdentitySources is the order lock owners are resolved in, from "env"
+	// (LOKT_OWNER), "ci" (the job of a recognized CI system) and "user"
+	// (the OS user); a source left out is skipped. Empty means
+	// identity.DefaultSources. See identity.Resolve.
+	IdentitySources []identity.Source `json:"identity_sources,omitempty"`
+	// CompatWriteVersion has lokt write lock files in this lockfile
+	// version instead of the newest it knows, so that an older lokt sharing
+	// the root can still read them. Zero means the newest. See
+	// lockfile.SetWriteVersion.
+	CompatWriteVersion int `json:"compat_write_version,omitempty"`
+	// KeyFile turns on lock file signing: the file, relative to the root
+	// unless absolute, holds the signing keys (see lockfile.ParseKeys).
+	// LOKT_KEY, if set, takes its place. Empty leaves signing off.
+	KeyFile string `json:"key_file,omitempty"`
+	// Locks holds per-lock policy, keyed by lock name.
+	Locks map[string]LockPolicy `json:"locks,omitempty"`
+	// ExclusionGroups maps a group name to lock names of which at most one
+	// may be held at a time, e.g. {"db-exclusive": ["db-migrate", "db-restore"]}.
+	ExclusionGroups map[string][]string `json:"exclusion_groups,omitempty"`
+}
+
+// EffectiveSkewGrace returns ClockSkewGrace, applying the default.
+func (c *Config) EffectiveSkewGrace() time.Duration {
+	if c.ClockSkewGrace <= 0 {
+		return stale.DefaultSkewGrace
+	}
+	return time.Duration(c.ClockSkewGrace)
+}
+
+// AdaptiveBackoffEnabled reports whether adaptive backoff is on.
+func (c *Config) AdaptiveBackoffEnabled() bool {
+	return c.AdaptiveBackoff == nil || *c.AdaptiveBackoff
+}
+
+// NotifyURLs returns every distinct webhook URL configured across all locks,
+// sorted.
+func (c *Config) NotifyURLs() []string {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, p := range c.Locks {
+		for _, u := range p.Notify {
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+	slices.Sort(urls)
+	return urls
+}
+
+// validate rejects settings that would otherwise be silently ignored.
+func (c *Config) validate() error {
+	if c.DefaultTTL < 0 {
+		return errors.New("default_ttl: must not be negative")
+	}
+	if c.WaitPollInterval < 0 {
+		return errors.New("wait_poll_interval: must not be negative")
+	}
+	if c.WatchInterval < 0 {
+		return errors.New("watch_interval: must not be negative")
+	}
+	if c.ClockSkewGrace < 0 {
+		return errors.New("clock_skew_grace: must not be negative")
+	}
+	if c.ShardLocks < 0 || c.ShardLocks > root.MaxShardLevel {
+		return fmt.Errorf("shard_locks: must be between 0 and %d", root.MaxShardLevel)
+	}
+	if err := identity.ValidateSources(c.IdentitySources); err != nil {
+		return fmt.Errorf("identity_sources: %w", err)
+	}
+	if c.CompatWriteVersion != 0 && !lockfile.Supported(c.CompatWriteVersion) {
+		return fmt.Errorf("compat_write_version: %d is not a lockfile version this lokt writes (supported: %v)",
+			c.CompatWriteVersion, lockfile.SupportedVersions())
+	}
+	if c.Audit.MaxSize < 0 || c.Audit.MaxAge < 0 || c.Audit.Keep < 0 {
+		return errors.New("audit: max_size, max_age and keep must not be negative")
+	}
+	if c.Hooks.Timeout < 0 {
+		return errors.New("hooks.timeout: must not be negative")
+	}
+	for _, e := range c.Hooks.Events {
+		if strings.TrimSpace(e) == "" {
+			return errors.New("hooks.events: empty event type")
+		}
+	}
+	for name, p := range c.Locks {
+		for t, u := range p.Notify {
+			if !slices.Contains(Transitions(), t) {
+				return fmt.Errorf("locks.%s.notify: unknown transition %q (want one of %s)",
+					name, t, strings.Join(Transitions(), ", "))
+			}
+			parsed, err := url.Parse(u)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("locks.%s.notify.%s: %q is not an http(s) URL", name, t, u)
+			}
+		}
+	}
+	for group, members := range c.ExclusionGroups {
+		if len(members) < 2 {
+			return fmt.Errorf("exclusion_groups.%s: needs at least two lock names", group)
+		}
+		for i, m := range members {
+			if err := lockfile.ValidateName(m); err != nil {
+				return fmt.Errorf("exclusion_groups.%s: %w", group, err)
+			}
+			if slices.Contains(members[:i], m) {
+				return fmt.Errorf("exclusion_groups.%s: %q listed twice", group, m)
+			}
+		}
+	}
+	return nil
+}
+
+// Path returns the path to the config file for a root.
+func Path(rootDir string) string {
+	return filepath.Join(rootDir, FileName)
+}
+
+// Load reads <rootDir>/config.json. A missing file is not an error and
+// returns an empty Config.
+func Load(rootDir string) (*Config, error) {
+	data, err := os.ReadFile(Path(rootDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", FileName, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", FileName, err)
+	}
+	return &cfg, nil
+}
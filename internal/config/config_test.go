@@ -0,0 +1,422 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+)
+
+func TestLoad_Missing(t *testing.T) {
+	cfg, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Snapshot.Enabled {
+		t.Error("snapshot should be disabled by default")
+	}
+}
+
+func TestLoad_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"snapshot": {"enabled": true, "interval": "30s", "retention_days": 3}}`
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !cfg.Snapshot.Enabled {
+		t.Error("expected snapshot enabled")
+	}
+	if got := cfg.Snapshot.EffectiveInterval(); got != 30*time.Second {
+		t.Errorf("interval = %v, want 30s", got)
+	}
+	if got := cfg.Snapshot.EffectiveRetentionDays(); got != 3 {
+		t.Errorf("retention = %d, want 3", got)
+	}
+}
+
+func TestLoad_Serve(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"serve": {"force_token": "s3cret"}}`
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Serve.ForceToken != "s3cret" {
+		t.Errorf("force_token = %q, want s3cret", cfg.Serve.ForceToken)
+	}
+}
+
+func TestLoad_RetryAfterDefault(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"retry_after_default": "2m"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := time.Duration(cfg.RetryAfterDefault); got != 2*time.Minute {
+		t.Errorf("retry_after_default = %v, want 2m", got)
+	}
+}
+
+func TestLoad_ClockSkewGrace(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.EffectiveSkewGrace(); got != 30*time.Second {
+		t.Errorf("default clock_skew_grace = %v, want 30s", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"clock_skew_grace": "2m"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = Load(dir); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.EffectiveSkewGrace(); got != 2*time.Minute {
+		t.Errorf("clock_skew_grace = %v, want 2m", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"clock_skew_grace": "-1s"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "clock_skew_grace") {
+		t.Errorf("Load() error = %v, want a clock_skew_grace error", err)
+	}
+}
+
+func TestLoad_ShardLocks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"shard_locks": 2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.ShardLocks != 2 {
+		t.Errorf("shard_locks = %d, want 2", cfg.ShardLocks)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"shard_locks": 5}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "shard_locks") {
+		t.Errorf("Load() error = %v, want a shard_locks error", err)
+	}
+}
+
+func TestLoad_CommandDefaults(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"default_ttl": "15m", "wait_poll_interval": "500ms", "watch_interval": 5}`
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if time.Duration(cfg.DefaultTTL) != 15*time.Minute || time.Duration(cfg.WaitPollInterval) != 500*time.Millisecond ||
+		time.Duration(cfg.WatchInterval) != 5*time.Second {
+		t.Errorf("defaults = %v, %v, %v", cfg.DefaultTTL, cfg.WaitPollInterval, cfg.WatchInterval)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"default_ttl": "-1m"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "default_ttl") {
+		t.Errorf("negative default_ttl: Load() error = %v", err)
+	}
+}
+
+func TestLoad_AdaptiveBackoff(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := Load(dir)
+	if err != nil || !cfg.AdaptiveBackoffEnabled() {
+		t.Fatalf("adaptive backoff should default to on (err %v)", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"adaptive_backoff": false}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = Load(dir); err != nil || cfg.AdaptiveBackoffEnabled() {
+		t.Errorf("adaptive_backoff: false should disable it (err %v)", err)
+	}
+}
+
+func TestLoad_LockNotify(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"locks": {
+		"deploy": {"notify": {"force-broken": "https://hooks.example/release", "acquired": "http://localhost:9000/x"}},
+		"build": {"notify": {"released": "https://hooks.example/release"}}
+	}}`
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.Locks["deploy"].Notify[TransitionForceBroken]; got != "https://hooks.example/release" {
+		t.Errorf("deploy force-broken URL = %q", got)
+	}
+	want := []string{"http://localhost:9000/x", "https://hooks.example/release"}
+	if got := cfg.NotifyURLs(); !slices.Equal(got, want) {
+		t.Errorf("NotifyURLs() = %v, want %v", got, want)
+	}
+}
+
+func TestLoad_LockNotifyInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"locks": {"deploy": {"notify": {"stolen": "https://hooks.example"}}}}`,
+		`{"locks": {"deploy": {"notify": {"acquired": "ftp://hooks.example"}}}}`,
+		`{"locks": {"deploy": {"notify": {"acquired": "hooks.example/x"}}}}`,
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(dir); err == nil {
+			t.Errorf("Load(%s): expected validation error", data)
+		}
+	}
+}
+
+func TestLoad_ExclusionGroups(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"exclusion_groups": {"db": ["db-migrate", "db-restore"]}}`
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.ExclusionGroups["db"]; !slices.Equal(got, []string{"db-migrate", "db-restore"}) {
+		t.Errorf("db members = %v", got)
+	}
+
+	for _, data := range []string{
+		`{"exclusion_groups": {"db": ["db-migrate"]}}`,
+		`{"exclusion_groups": {"db": ["db-migrate", "../etc"]}}`,
+		`{"exclusion_groups": {"db": ["db-migrate", "db-migrate"]}}`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(dir); err == nil {
+			t.Errorf("Load(%s): expected validation error", data)
+		}
+	}
+}
+
+func TestLoad_IdentitySources(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"identity_sources": ["ci", "user"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := []identity.Source{identity.SourceCI, identity.SourceUser}; !slices.Equal(cfg.IdentitySources, want) {
+		t.Errorf("IdentitySources = %v, want %v", cfg.IdentitySources, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"identity_sources": ["ldap"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "identity_sources") {
+		t.Errorf("Load() error = %v, want an identity_sources error", err)
+	}
+}
+
+func TestLoad_CompatWriteVersion(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"compat_write_version": 1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(dir)
+	if err != nil || cfg.CompatWriteVersion != 1 {
+		t.Fatalf("Load() = %+v, %v; want compat_write_version 1", cfg, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"compat_write_version": 99}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "compat_write_version") {
+		t.Errorf("Load() error = %v, want a compat_write_version error", err)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestSnapshotDefaults(t *testing.T) {
+	var s SnapshotConfig
+	if got := s.EffectiveInterval(); got != DefaultSnapshotInterval {
+		t.Errorf("interval = %v, want %v", got, DefaultSnapshotInterval)
+	}
+	if got := s.EffectiveRetentionDays(); got != DefaultSnapshotRetention {
+		t.Errorf("retention = %d, want %d", got, DefaultSnapshotRetention)
+	}
+}
+
+func TestDuration_Unmarshal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{`"5m"`, 5 * time.Minute, false},
+		{`90`, 90 * time.Second, false},
+		{`"bogus"`, 0, true},
+		{`true`, 0, true},
+	}
+	for _, tt := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(tt.in), &d)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && time.Duration(d) != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, want %v", tt.in, time.Duration(d), tt.want)
+		}
+	}
+}
+
+func TestDuration_Marshal(t *testing.T) {
+	data, err := json.Marshal(Duration(2 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"2m0s"` {
+		t.Errorf("Marshal = %s, want \"2m0s\"", data)
+	}
+}
+
+func TestByteSize_Unmarshal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{`1048576`, 1 << 20, false},
+		{`"100MB"`, 100 << 20, false},
+		{`"1GiB"`, 1 << 30, false},
+		{`"1.5k"`, 1536, false},
+		{`"512 B"`, 512, false},
+		{`"MB"`, 0, true},
+		{`"ten"`, 0, true},
+		{`true`, 0, true},
+	}
+	for _, tt := range tests {
+		var b ByteSize
+		err := json.Unmarshal([]byte(tt.in), &b)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && int64(b) != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, b, tt.want)
+		}
+	}
+}
+
+func TestLoad_Audit(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"audit": {"max_size": "10MB", "max_age": "24h", "keep": 3, "compress": true}}`
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := AuditConfig{MaxSize: 10 << 20, MaxAge: Duration(24 * time.Hour), Keep: 3, Compress: true}
+	if cfg.Audit != want {
+		t.Errorf("Audit = %+v, want %+v", cfg.Audit, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(`{"audit": {"keep": -1}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "audit") {
+		t.Errorf("Load() with negative keep error = %v, want it rejected", err)
+	}
+}
+
+func TestLoad_Hooks(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.Hooks.EffectiveEvents(); !slices.Equal(got, DefaultHookEvents()) {
+		t.Errorf("default events = %v, want %v", got, DefaultHookEvents())
+	}
+	if got := cfg.Hooks.EffectiveTimeout(); got != DefaultHookTimeout {
+		t.Errorf("default timeout = %v, want %v", got, DefaultHookTimeout)
+	}
+
+	data := `{"hooks": {"events": ["deny"], "timeout": "1s"}}`
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = Load(dir); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.Hooks.EffectiveEvents(); !slices.Equal(got, []string{"deny"}) {
+		t.Errorf("events = %v, want [deny]", got)
+	}
+	if got := cfg.Hooks.EffectiveTimeout(); got != time.Second {
+		t.Errorf("timeout = %v, want 1s", got)
+	}
+
+	// An explicit empty list turns the hook off
+	data = `{"hooks": {"events": []}}`
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = Load(dir); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.Hooks.EffectiveEvents(); len(got) != 0 {
+		t.Errorf("events = %v, want none", got)
+	}
+
+	for _, bad := range []string{`{"hooks": {"timeout": "-1s"}}`, `{"hooks": {"events": [""]}}`} {
+		if err := os.WriteFile(filepath.Join(dir, FileName), []byte(bad), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), "hooks.") {
+			t.Errorf("Load(%s) error = %v, want a hooks error", bad, err)
+		}
+	}
+}
@@ -2,11 +2,19 @@
 package doctor
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/policy"
+	"github.com/nikolasavic/lokt/internal/root"
 )
 
 // Status represents the result of a health check.
@@ -48,14 +56,50 @@ var (
 	removeFileFn  = os.Remove
 )
 
+// CheckRootAmbiguity warns if roots other than the one in use hold locks or
+// freezes (see root.Ambiguity); cands are as returned by root.FindAll.
+func CheckRootAmbiguity(cands []root.Candidate) CheckResult {
+	result := CheckResult{Name: "root_ambiguity", Status: StatusOK}
+	var amb *root.AmbiguityError
+	if errors.As(root.Ambiguity(cands), &amb) {
+		result.Status = StatusWarn
+		result.Message = strings.TrimPrefix(amb.Error(), "lock root ambiguity: ") +
+			"; pin one with --root or LOKT_ROOT, or move the other's locks"
+		return result
+	}
+	if len(cands) > 1 {
+		var others []string
+		for _, c := range cands[1:] {
+			others = append(others, fmt.Sprintf("%s (%s)", c.Path, c.Method))
+		}
+		result.Message = "also found: " + strings.Join(others, ", ")
+		if cands[0].Method == root.MethodEnvVar {
+			result.Message = "pinned by LOKT_ROOT; " + result.Message
+		}
+	}
+	return result
+}
+
 // CheckWritable verifies the directory is writable by creating a test file.
-// If the directory doesn't exist, it attempts to create it first.
+// If the directory doesn't exist, it attempts to create it first. A root
+// root.CheckWritable already finds read-only is reported without touching
+// it: a warning in read-only mode, which asked for it, a failure otherwise.
 func CheckWritable(dir string) CheckResult {
 	result := CheckResult{Name: "writable"}
 
+	var ro *root.ReadOnlyError
+	if err := root.CheckWritable(dir); errors.As(err, &ro) {
+		result.Status = StatusFail
+		if ro.Forced {
+			result.Status = StatusWarn
+		}
+		result.Message = err.Error()
+		return result
+	}
+
 	// Ensure directory exists
 	locksDir := filepath.Join(dir, "locks")
-	if err := os.MkdirAll(locksDir, 0700); err != nil {
+	if err := root.MkdirAll(dir, locksDir); err != nil {
 		result.Status = StatusFail
 		result.Message = fmt.Sprintf("cannot create directory: %v", err)
 		return result
@@ -109,9 +153,46 @@ func CheckWritable(dir string) CheckResult {
 }
 
 // CheckClock verifies the system clock is within a reasonable range.
-// Warns if year < 2020 (lokt didn't exist) or > 2100 (likely misconfigured).
-func CheckClock() CheckResult {
-	return checkClockYear(time.Now().Year())
+// Warns if year < 2020 (lokt didn't exist) or > 2100 (likely misconfigured),
+// or if a lock or freeze in dir was written more than grace ahead of the
+// local clock: another host's clock is ahead of this one, so the two
+// disagree about when locks expire.
+func CheckClock(dir string, grace time.Duration) CheckResult {
+	now := time.Now()
+	if result := checkClockYear(now.Year()); result.Status != StatusOK {
+		return result
+	}
+	return checkClockSkew(dir, grace, now)
+}
+
+// checkClockSkew compares now against the newest acquired_at in dir's locks
+// and freezes. Acquire and renew stamp acquired_at with the writer's clock,
+// so the newest one approximates that host's time.
+func checkClockSkew(dir string, grace time.Duration, now time.Time) CheckResult {
+	result := CheckResult{Name: "clock", Status: StatusOK}
+	var newest *lockfile.Lock
+	for _, base := range []string{root.LocksPath(dir), root.FreezesPath(dir)} {
+		names, _ := root.Names(base)
+		for _, name := range names {
+			lf, err := lockfile.Read(filepath.Join(base, filepath.FromSlash(name)+".json"))
+			if err != nil {
+				continue
+			}
+			if newest == nil || lf.AcquiredAt.After(newest.AcquiredAt) {
+				newest = lf
+			}
+		}
+	}
+	if newest == nil {
+		return result
+	}
+	if ahead := newest.AcquiredAt.Sub(now); ahead > grace {
+		result.Status = StatusWarn
+		result.Message = fmt.Sprintf(
+			"lock %q was written %s ahead of this clock by %s; clock skew beyond the %s grace (clock_skew_grace) can break live locks early",
+			newest.Name, ahead.Round(time.Second), newest.Host, grace)
+	}
+	return result
 }
 
 func checkClockYear(year int) CheckResult {
@@ -165,8 +246,196 @@ func CheckLegacyFreezes(dir string) CheckResult {
 
 	result.Status = StatusWarn
 	result.Message = fmt.Sprintf(
-		"%d legacy freeze file(s) in locks/ directory. These will expire via TTL. New freezes use freezes/ directory.",
+		"%d legacy freeze file(s) in locks/ directory. These will expire via TTL; lokt doctor --fix moves them to freezes/.",
 		count,
 	)
 	return result
 }
+
+// CheckVersions counts the lock and freeze files in dir by lockfile
+// version. It warns when they are of more than one version: lokt binaries
+// that write different versions share the root, and one that can't read
+// the other's files won't see those locks as held. The cure is for the
+// newer ones to write the oldest version (compat_write_version).
+func CheckVersions(dir string) CheckResult {
+	result := CheckResult{Name: "lockfile_versions", Status: StatusOK}
+	counts := make(map[int]int)
+	for _, base := range []string{root.LocksPath(dir), root.FreezesPath(dir)} {
+		names, _ := root.Names(base)
+		for _, name := range names {
+			v, err := lockfile.ReadVersion(filepath.Join(base, filepath.FromSlash(name)+".json"))
+			if err == nil {
+				counts[v]++
+			}
+		}
+	}
+	if len(counts) == 0 {
+		return result
+	}
+
+	versions := slices.Sorted(maps.Keys(counts))
+	parts := make([]string, len(versions))
+	for i, v := range versions {
+		parts[i] = fmt.Sprintf("version %d: %d", v, counts[v])
+		if !lockfile.Supported(v) {
+			parts[i] += " (unsupported by this lokt)"
+		}
+	}
+	census := strings.Join(parts, ", ")
+	if len(versions) == 1 {
+		result.Message = fmt.Sprintf("%s; this lokt writes version %d", census, lockfile.WriteVersion())
+		return result
+	}
+	result.Status = StatusWarn
+	result.Message = fmt.Sprintf(
+		"mixed lockfile versions (%s): lokt binaries of different versions share this root; set compat_write_version to %d in config.json (or upgrade them all) so each can read the others' locks",
+		census, versions[0])
+	return result
+}
+
+// CheckSigning reports on lock file signing: keysErr, keys that are
+// configured (from source) but can't be used, fails, since commands then
+// refuse to run; with no keys signing is off. With keys, it warns about
+// lock and freeze files in dir that are unsigned or badly signed, which
+// unlock and renew refuse without --force.
+func CheckSigning(dir, source string, keys int, keysErr error) CheckResult {
+	result := CheckResult{Name: "signing", Status: StatusOK}
+	if keysErr != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("%v; every command but doctor refuses to run until it is fixed", keysErr)
+		return result
+	}
+	if keys == 0 {
+		result.Message = "off (key_file in config.json or LOKT_KEY turns it on)"
+		return result
+	}
+
+	var unsigned, bad []string
+	total := 0
+	for _, base := range []string{root.LocksPath(dir), root.FreezesPath(dir)} {
+		names, _ := root.Names(base)
+		for _, name := range names {
+			lf, err := lockfile.Read(filepath.Join(base, filepath.FromSlash(name)+".json"))
+			switch {
+			case errors.Is(err, lockfile.ErrBadSignature):
+				bad = append(bad, name)
+			case err != nil:
+				continue
+			case lf.Unsigned():
+				unsigned = append(unsigned, name)
+			}
+			total++
+		}
+	}
+	result.Message = fmt.Sprintf("on: %d key(s) from %s", keys, source)
+	if len(unsigned) == 0 && len(bad) == 0 {
+		result.Message += fmt.Sprintf("; %d lock file(s), all signed", total)
+		return result
+	}
+	result.Status = StatusWarn
+	if len(unsigned) > 0 {
+		result.Message += fmt.Sprintf("; %d unsigned: %s (lokt renew --force signs your own; unlock and renew refuse them otherwise)",
+			len(unsigned), strings.Join(unsigned, ", "))
+	}
+	if len(bad) > 0 {
+		result.Message += fmt.Sprintf("; %d badly signed: %s (forged, or signed with a retired key; lokt unlock --force removes them)",
+			len(bad), strings.Join(bad, ", "))
+	}
+	return result
+}
+
+// CheckConfig reports whether <dir>/config.json exists and loads. A missing
+// config is fine (every setting has a default); one that doesn't load fails,
+// since commands then ignore all of its settings, exclusion groups included.
+func CheckConfig(dir string) CheckResult {
+	result := CheckResult{Name: "config", Status: StatusOK}
+
+	if _, err := os.Stat(config.Path(dir)); os.IsNotExist(err) {
+		result.Message = "no config.json; using built-in defaults (lokt init writes one)"
+		return result
+	}
+	if _, err := config.Load(dir); err != nil {
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("%v; commands ignore it until fixed", err)
+		return result
+	}
+	result.Message = config.Path(dir)
+	return result
+}
+
+// CheckPolicy reports whether <dir>/policy.json exists and loads, and which
+// patterns it has rules for. One that doesn't load fails: every lock and
+// freeze is refused until it is fixed.
+func CheckPolicy(dir string) CheckResult {
+	result := CheckResult{Name: "policy", Status: StatusOK}
+
+	p, err := policy.Load(dir)
+	switch {
+	case err != nil:
+		result.Status = StatusFail
+		result.Message = fmt.Sprintf("%v; locks and freezes are refused until fixed", err)
+	case len(p.Locks) == 0:
+		result.Message = "no policy.json rules"
+	default:
+		result.Message = fmt.Sprintf("%d rule(s): %s", len(p.Locks), strings.Join(p.Patterns(), ", "))
+	}
+	return result
+}
+
+// CheckEventHook reports on the event hook at path: whether it exists and
+// can run, and the failed runs and dropped events recorded since the
+// counters were last cleared. Like webhooks, the hook is best-effort, so
+// this never fails outright.
+func CheckEventHook(path string, present, executable bool, failures, dropped int) CheckResult {
+	result := CheckResult{Name: "event_hook", Status: StatusOK}
+
+	var problems []string
+	if present && !executable {
+		problems = append(problems, fmt.Sprintf("%s is not executable, so it never runs", path))
+	}
+	if failures > 0 {
+		problems = append(problems, fmt.Sprintf("%d failed run(s) recorded", failures))
+	}
+	if dropped > 0 {
+		problems = append(problems, fmt.Sprintf("%d event(s) dropped with too many runs in flight", dropped))
+	}
+
+	switch {
+	case len(problems) > 0:
+		result.Status = StatusWarn
+		result.Message = strings.Join(problems, "; ")
+	case !present:
+		result.Message = "no event hook"
+	default:
+		result.Message = path
+	}
+	return result
+}
+
+// CheckWebhooks probes each configured webhook URL and warns about any that
+// are unreachable, or about deliveries that have failed since the counter
+// was last cleared. Webhooks are best-effort, so this never fails outright.
+func CheckWebhooks(urls []string, probe func(string) error, failures int) CheckResult {
+	result := CheckResult{Name: "webhooks", Status: StatusOK}
+
+	var problems []string
+	for _, u := range urls {
+		if err := probe(u); err != nil {
+			problems = append(problems, fmt.Sprintf("%s unreachable: %v", u, err))
+		}
+	}
+	if failures > 0 {
+		problems = append(problems, fmt.Sprintf("%d delivery failure(s) recorded", failures))
+	}
+
+	switch {
+	case len(problems) > 0:
+		result.Status = StatusWarn
+		result.Message = strings.Join(problems, "; ")
+	case len(urls) == 0:
+		result.Message = "no webhooks configured"
+	default:
+		result.Message = fmt.Sprintf("%d webhook(s) reachable", len(urls))
+	}
+	return result
+}
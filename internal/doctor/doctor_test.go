@@ -1,11 +1,16 @@
 package doctor
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
 )
 
 func TestCheckWritable_Success(t *testing.T) {
@@ -42,7 +47,7 @@ func TestCheckWritable_NotWritable(t *testing.T) {
 }
 
 func TestCheckClock_ReasonableTime(t *testing.T) {
-	result := CheckClock()
+	result := CheckClock(t.TempDir(), 30*time.Second)
 	if result.Status != StatusOK {
 		t.Errorf("CheckClock() status = %v, want OK; message = %s", result.Status, result.Message)
 	}
@@ -275,6 +280,118 @@ func TestCheckWritable_RemoveError(t *testing.T) {
 	}
 }
 
+func TestCheckClockSkew(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(path string, acquired time.Time) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := lockfile.Write(path, &lockfile.Lock{Name: "x", Host: "fast-host", AcquiredAt: acquired}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if result := checkClockSkew(dir, 30*time.Second, now); result.Status != StatusOK {
+		t.Errorf("empty root: status = %v, want OK", result.Status)
+	}
+
+	write(root.LockFilePath(dir, "old"), now.Add(-time.Hour))
+	write(root.LockFilePath(dir, "team/near"), now.Add(10*time.Second))
+	if result := checkClockSkew(dir, 30*time.Second, now); result.Status != StatusOK {
+		t.Errorf("skew within grace: status = %v, want OK; message = %s", result.Status, result.Message)
+	}
+
+	// fast-host's clock is 2 minutes ahead of ours
+	write(root.FreezeFilePath(dir, "ahead"), now.Add(2*time.Minute))
+	result := checkClockSkew(dir, 30*time.Second, now)
+	if result.Status != StatusWarn {
+		t.Fatalf("skew beyond grace: status = %v, want Warn", result.Status)
+	}
+	if !strings.Contains(result.Message, "fast-host") || !strings.Contains(result.Message, "2m0s") {
+		t.Errorf("message = %q, want the host and the skew", result.Message)
+	}
+}
+
+func TestCheckVersions(t *testing.T) {
+	dir := t.TempDir()
+	if result := CheckVersions(dir); result.Status != StatusOK || result.Message != "" {
+		t.Errorf("empty root: %+v, want OK", result)
+	}
+
+	for _, path := range []string{root.LockFilePath(dir, "a"), root.LockFilePath(dir, "team/b"), root.FreezeFilePath(dir, "c")} {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := lockfile.Write(path, &lockfile.Lock{Version: 1, Name: "x", AcquiredAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result := CheckVersions(dir)
+	if result.Status != StatusOK || !strings.Contains(result.Message, "version 1: 3") {
+		t.Errorf("one version: %+v, want OK with the count", result)
+	}
+
+	// A newer lokt's lock next to ours
+	newer := lockfile.CurrentLockfileVersion + 1
+	data := fmt.Sprintf(`{"version": %d, "name": "d", "shape": "new"}`, newer)
+	if err := os.WriteFile(root.LockFilePath(dir, "d"), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result = CheckVersions(dir)
+	if result.Status != StatusWarn {
+		t.Fatalf("mixed versions: status = %v, want Warn", result.Status)
+	}
+	for _, want := range []string{fmt.Sprintf("version %d: 1 (unsupported", newer), "compat_write_version to 1"} {
+		if !strings.Contains(result.Message, want) {
+			t.Errorf("message = %q, want %q", result.Message, want)
+		}
+	}
+}
+
+func TestCheckSigning(t *testing.T) {
+	dir := t.TempDir()
+	if result := CheckSigning(dir, "", 0, nil); result.Status != StatusOK || !strings.Contains(result.Message, "off") {
+		t.Errorf("no keys: %+v, want OK and off", result)
+	}
+	if result := CheckSigning(dir, "/etc/lokt.key", 0, errors.New("key_file: missing")); result.Status != StatusFail {
+		t.Errorf("unusable keys: %+v, want Fail", result)
+	}
+
+	write := func(path string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := lockfile.Write(path, &lockfile.Lock{Version: 1, Name: "x", Owner: "alice", AcquiredAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(root.LockFilePath(dir, "old")) // before signing
+	if err := lockfile.SetKeys([][]byte{[]byte("0123456789abcdef0123456789abcdef")}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lockfile.SetKeys(nil) })
+	write(root.LockFilePath(dir, "signed"))
+	write(root.FreezeFilePath(dir, "forged"))
+	path := root.FreezeFilePath(dir, "forged")
+	data, _ := os.ReadFile(path)
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), "alice", "mallory", 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result := CheckSigning(dir, "LOKT_KEY", 1, nil)
+	if result.Status != StatusWarn {
+		t.Fatalf("status = %v, want Warn; message = %s", result.Status, result.Message)
+	}
+	for _, want := range []string{"1 key(s) from LOKT_KEY", "1 unsigned: old", "1 badly signed: forged"} {
+		if !strings.Contains(result.Message, want) {
+			t.Errorf("message = %q, want %q", result.Message, want)
+		}
+	}
+}
+
 func TestCheckClockYear_Past(t *testing.T) {
 	result := checkClockYear(2019)
 	if result.Status != StatusWarn {
@@ -336,3 +453,107 @@ func TestCheckLegacyFreezes_SubdirIgnored(t *testing.T) {
 			result.Status)
 	}
 }
+
+func TestCheckWebhooks(t *testing.T) {
+	probe := func(u string) error {
+		if u == "http://down" {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	if r := CheckWebhooks(nil, probe, 0); r.Status != StatusOK {
+		t.Errorf("no webhooks: status = %s", r.Status)
+	}
+	if r := CheckWebhooks([]string{"http://up"}, probe, 0); r.Status != StatusOK {
+		t.Errorf("reachable: status = %s (%s)", r.Status, r.Message)
+	}
+	r := CheckWebhooks([]string{"http://up", "http://down"}, probe, 3)
+	if r.Status != StatusWarn {
+		t.Errorf("unreachable: status = %s, want warn", r.Status)
+	}
+	for _, want := range []string{"http://down unreachable", "3 delivery failure(s)"} {
+		if !strings.Contains(r.Message, want) {
+			t.Errorf("message %q missing %q", r.Message, want)
+		}
+	}
+}
+
+func TestCheckEventHook(t *testing.T) {
+	if r := CheckEventHook("/r/hooks/on-event", false, false, 0, 0); r.Status != StatusOK || r.Message != "no event hook" {
+		t.Errorf("no hook: %+v", r)
+	}
+	if r := CheckEventHook("/r/hooks/on-event", true, true, 0, 0); r.Status != StatusOK {
+		t.Errorf("runnable hook: %+v", r)
+	}
+	r := CheckEventHook("/r/hooks/on-event", true, false, 2, 5)
+	if r.Status != StatusWarn {
+		t.Errorf("broken hook: status = %s, want warn", r.Status)
+	}
+	for _, want := range []string{"not executable", "2 failed run(s)", "5 event(s) dropped"} {
+		if !strings.Contains(r.Message, want) {
+			t.Errorf("message %q missing %q", r.Message, want)
+		}
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	if r := CheckConfig(dir); r.Status != StatusOK || !strings.Contains(r.Message, "no config.json") {
+		t.Errorf("missing config: %+v", r)
+	}
+
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"default_ttl": "5m"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if r := CheckConfig(dir); r.Status != StatusOK || r.Message != path {
+		t.Errorf("valid config: %+v", r)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"default_ttl": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if r := CheckConfig(dir); r.Status != StatusFail || !strings.Contains(r.Message, "parse config.json") {
+		t.Errorf("broken config: %+v", r)
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	dir := t.TempDir()
+	if r := CheckPolicy(dir); r.Status != StatusOK || !strings.Contains(r.Message, "no policy.json") {
+		t.Errorf("missing policy: %+v", r)
+	}
+
+	path := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(path, []byte(`{"locks": {"deploy-*": {"require_ttl": true}, "build": {}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if r := CheckPolicy(dir); r.Status != StatusOK || r.Message != "2 rule(s): build, deploy-*" {
+		t.Errorf("valid policy: %+v", r)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"locks": {"[": {}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if r := CheckPolicy(dir); r.Status != StatusFail || !strings.Contains(r.Message, "bad pattern") {
+		t.Errorf("broken policy: %+v", r)
+	}
+}
+
+func TestCheckRootAmbiguity(t *testing.T) {
+	git := root.Candidate{Path: "/r/.git/lokt", Method: root.MethodGit, Locks: 1}
+	local := root.Candidate{Path: "/r/sub/.lokt", Method: root.MethodLocalDir, Locks: 3}
+
+	r := CheckRootAmbiguity([]root.Candidate{git, local})
+	if r.Status != StatusWarn || !strings.Contains(r.Message, "/r/.git/lokt (git), but /r/sub/.lokt (local) also contains 3 locks") {
+		t.Errorf("occupied second root: %+v, want a warning naming both", r)
+	}
+	local.Locks = 0
+	if r := CheckRootAmbiguity([]root.Candidate{git, local}); r.Status != StatusOK || !strings.Contains(r.Message, "/r/sub/.lokt") {
+		t.Errorf("empty second root: %+v, want OK listing it", r)
+	}
+	if r := CheckRootAmbiguity([]root.Candidate{git}); r.Status != StatusOK || r.Message != "" {
+		t.Errorf("one root: %+v", r)
+	}
+}
@@ -0,0 +1,383 @@
+package doctor
+
+// This file checks the lock and freeze files themselves: ScanIntegrity finds
+// damaged and leftover entries, CheckIntegrity reports them per category,
+// and Fix repairs the ones that are safe to repair (lokt doctor --fix).
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// IssueKind is a category of problem found by ScanIntegrity. It doubles as
+// the name of the category's CheckResult.
+type IssueKind string
+
+const (
+	IssueCorrupt      IssueKind = "corrupt_files"        // not valid lock JSON, or not a lock (lockfile.Broken)
+	IssueEmpty        IssueKind = "empty_files"          // zero bytes for longer than emptyGrace
+	IssueUnsupported  IssueKind = "unsupported_versions" // written by a newer lokt
+	IssueInvalid      IssueKind = "invalid_fields"       // parses, but lockfile.Validate finds an error
+	IssueDeadPID      IssueKind = "dead_pid_locks"       // same-host holder gone (dead or recycled PID)
+	IssueLegacyFreeze IssueKind = "legacy_freezes"       // locks/freeze-<name>.json from before freezes/
+	IssueDangling     IssueKind = "dangling_symlinks"    // symlink to a missing file
+	IssueMisplaced    IssueKind = "misplaced_locks"      // not where shard_locks puts it (see root.ShardLevel)
+)
+
+// checkedKinds are the kinds CheckIntegrity reports, in order. Legacy
+// freezes have their own check (CheckLegacyFreezes).
+var checkedKinds = []IssueKind{IssueCorrupt, IssueEmpty, IssueUnsupported, IssueInvalid, IssueDeadPID, IssueDangling, IssueMisplaced}
+
+// emptyGrace is how long a zero-byte file may exist before it counts as
+// abandoned: a lock file is briefly empty while it is being created.
+const emptyGrace = time.Minute
+
+// Issue is one problem entry found by ScanIntegrity.
+type Issue struct {
+	Kind   IssueKind
+	Name   string // lock or freeze name; for a legacy freeze, without the prefix
+	Freeze bool   // under freezes/, or a legacy freeze
+	Path   string
+	Dest   string         // where the layout puts it (IssueMisplaced)
+	Lock   *lockfile.Lock // as read; nil if it didn't parse
+	Reason stale.Reason   // why the holder is gone (IssueDeadPID)
+}
+
+// Fixed is a repair made by Fix.
+type Fixed struct {
+	Kind   IssueKind `json:"kind"`
+	Name   string    `json:"name"`
+	Freeze bool      `json:"freeze,omitempty"`
+	Action string    `json:"action"` // "removed", "migrated" or "moved"
+	Path   string    `json:"path"`
+}
+
+// ScanIntegrity walks locks/ and freezes/ under dir and returns every entry
+// with a problem. Missing directories have none.
+func ScanIntegrity(dir string) []Issue {
+	var issues []Issue
+	now := time.Now()
+	level := root.ShardLevel(dir)
+	for _, freeze := range []bool{false, true} {
+		base := root.LocksPath(dir)
+		if freeze {
+			base = root.FreezesPath(dir)
+		}
+		_ = filepath.WalkDir(base, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+				return nil
+			}
+			rel, err := filepath.Rel(base, path)
+			if err != nil {
+				return nil
+			}
+			is := Issue{Name: filepath.ToSlash(strings.TrimSuffix(rel, ".json")), Freeze: freeze, Path: path}
+			// A top-level freeze-<name>.json in locks/ predates freezes/
+			legacy := !freeze && !strings.Contains(is.Name, "/") && strings.HasPrefix(is.Name, legacyFreezePrefix)
+			if legacy {
+				is.Name, is.Freeze = strings.TrimPrefix(is.Name, legacyFreezePrefix), true
+			}
+			if !freeze && !legacy {
+				is.Name = root.LockName(is.Name, level)
+			}
+			kind, ok := classifyEntry(&is, d.Type()&fs.ModeSymlink != 0, legacy, now)
+			if !ok && !freeze && !legacy && is.Lock != nil {
+				kind, ok = checkPlacement(&is, dir, filepath.ToSlash(rel), level)
+			}
+			if ok {
+				is.Kind = kind
+				issues = append(issues, is)
+			}
+			return nil
+		})
+	}
+	return issues
+}
+
+// checkPlacement reports IssueMisplaced if the healthy lock file at rel
+// (under locks/) isn't where the root's shard level puts it, setting
+// is.Name and is.Dest from the name recorded in the file. It must be the
+// file of that name in some layout: flat or sharded at any level.
+func checkPlacement(is *Issue, dir, rel string, level int) (IssueKind, bool) {
+	name := is.Lock.Name
+	stem := lockfile.FileStem(name)
+	found := rel == stem+".json"
+	for l := 1; l <= root.MaxShardLevel && !found; l++ {
+		found = rel == root.Shard(stem, l)+"/"+stem+".json"
+	}
+	if !found {
+		return "", false
+	}
+	dest := filepath.Join(root.LocksPath(dir), filepath.FromSlash(stem)+".json")
+	if level > 0 {
+		dest = root.ShardedLockFilePath(dir, name, level)
+	}
+	if dest == is.Path {
+		return "", false
+	}
+	is.Name, is.Dest = name, dest
+	return IssueMisplaced, true
+}
+
+// legacyFreezePrefix marks a freeze stored in locks/ (lock.FreezePrefix).
+const legacyFreezePrefix = "freeze-"
+
+// classifyEntry returns the problem with the file at is.Path (a symlink if
+// symlink is set), if any, filling in is.Lock and is.Reason.
+func classifyEntry(is *Issue, symlink, legacy bool, now time.Time) (IssueKind, bool) {
+	info, err := os.Stat(is.Path)
+	if err != nil {
+		if symlink && errors.Is(err, fs.ErrNotExist) {
+			return IssueDangling, true
+		}
+		return "", false
+	}
+	if info.Size() == 0 {
+		return IssueEmpty, now.Sub(info.ModTime()) >= emptyGrace
+	}
+	lf, err := lockfile.Read(is.Path)
+	switch {
+	case lockfile.Broken(err):
+		return IssueCorrupt, true
+	case errors.Is(err, lockfile.ErrUnsupportedVersion):
+		return IssueUnsupported, true
+	case err != nil:
+		return "", false
+	}
+	is.Lock = lf
+	if legacy {
+		return IssueLegacyFreeze, true
+	}
+	if lockfile.HasError(lockfile.Validate(lf)) {
+		return IssueInvalid, true
+	}
+	if is.Freeze {
+		return "", false // a freeze's PID is the freeze command's, long gone
+	}
+	if is.Reason = holderGone(lf); is.Reason != stale.ReasonNotStale {
+		return IssueDeadPID, true
+	}
+	return "", false
+}
+
+// holderGone returns stale.ReasonDeadPID or stale.ReasonRecycledPID if lf's
+// same-host holder no longer exists, whether or not its TTL has run out,
+// and stale.ReasonNotStale otherwise.
+func holderGone(lf *lockfile.Lock) stale.Reason {
+	// stale.Check reports expiry first; look past it at the holder
+	noTTL := *lf
+	noTTL.TTLSec, noTTL.ExpiresAt = 0, nil
+	if r := stale.Check(&noTTL).Reason; r.HolderGone() {
+		return r
+	}
+	return stale.ReasonNotStale
+}
+
+// CheckIntegrity reports issues as one CheckResult per category: OK if
+// there are none, otherwise a warning naming them and whether --fix can
+// repair them.
+func CheckIntegrity(issues []Issue) []CheckResult {
+	byKind := make(map[IssueKind][]string)
+	for _, is := range issues {
+		byKind[is.Kind] = append(byKind[is.Kind], entryLabel(is))
+	}
+	results := make([]CheckResult, 0, len(checkedKinds))
+	for _, kind := range checkedKinds {
+		result := CheckResult{Name: string(kind), Status: StatusOK}
+		if names := byKind[kind]; len(names) > 0 {
+			result.Status = StatusWarn
+			result.Message = fmt.Sprintf("%d %s: %s; %s", len(names), kindNoun(kind), strings.Join(names, ", "), kindAdvice(kind))
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// entryLabel names an issue's entry for messages, e.g. "freeze deploy".
+func entryLabel(is Issue) string {
+	if is.Freeze {
+		return "freeze " + is.Name
+	}
+	return is.Name
+}
+
+func kindNoun(kind IssueKind) string {
+	switch kind {
+	case IssueCorrupt:
+		return "corrupted file(s)"
+	case IssueEmpty:
+		return "empty file(s)"
+	case IssueUnsupported:
+		return "file(s) from a newer lokt"
+	case IssueInvalid:
+		return "file(s) with invalid fields"
+	case IssueDeadPID:
+		return "lock(s) whose holder is gone"
+	case IssueMisplaced:
+		return "lock file(s) outside the shard_locks layout"
+	case IssueDangling:
+		return "dangling symlink(s)"
+	}
+	return string(kind)
+}
+
+func kindAdvice(kind IssueKind) string {
+	switch kind {
+	case IssueUnsupported:
+		return "upgrade lokt to read them"
+	case IssueInvalid:
+		return "lokt inspect <name> shows what is wrong; fix or remove them by hand"
+	case IssueDangling:
+		return "remove or repoint them by hand"
+	case IssueMisplaced:
+		return "they still work where they are; lokt doctor --fix moves them"
+	}
+	return "lokt doctor --fix removes them"
+}
+
+// Fix makes the safe repairs for issues: it removes corrupted and empty
+// files and locks whose holder is gone, moves legacy freezes to freezes/
+// and misplaced lock files to where the shard level puts them. Files from a newer lokt, files with invalid fields and dangling symlinks are left alone.
+// Each file is re-checked just before it is touched, and each repair is
+// audited like the equivalent lock operation (corrupt-break, auto-prune,
+// freeze-migrate).
+//
+// It returns the repairs made and the errors of those that failed.
+func Fix(dir string, issues []Issue, auditor *audit.Writer) ([]Fixed, []error) {
+	var fixed []Fixed
+	var errs []error
+	id := identity.Current()
+	for _, is := range issues {
+		action, err := fixIssue(dir, is, auditor, id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", is.Path, err))
+		}
+		if action != "" {
+			fixed = append(fixed, Fixed{Kind: is.Kind, Name: is.Name, Freeze: is.Freeze, Action: action, Path: is.Path})
+		}
+	}
+	return fixed, errs
+}
+
+// fixIssue repairs one issue, returning what it did ("" if nothing).
+func fixIssue(dir string, is Issue, auditor *audit.Writer, id identity.Identity) (string, error) {
+	switch is.Kind {
+	case IssueCorrupt, IssueEmpty:
+		again := is
+		if kind, ok := classifyEntry(&again, false, false, time.Now()); !ok || kind != is.Kind {
+			return "", nil // rewritten meanwhile
+		}
+		if err := removeEntry(is.Path); err != nil {
+			return "", err
+		}
+		emitFixEvent(auditor, id, audit.EventCorruptBreak, is, stale.ReasonCorrupted)
+		return "removed", nil
+
+	case IssueDeadPID:
+		lf, err := lockfile.Read(is.Path)
+		if err != nil || lf.LockID != is.Lock.LockID || !lf.AcquiredAt.Equal(is.Lock.AcquiredAt) || holderGone(lf) == stale.ReasonNotStale {
+			return "", nil // re-acquired or released meanwhile
+		}
+		if err := removeEntry(is.Path); err != nil {
+			return "", err
+		}
+		emitFixEvent(auditor, id, audit.EventAutoPrune, is, is.Reason)
+		return "removed", nil
+
+	case IssueLegacyFreeze:
+		dest := root.FreezeFilePath(dir, is.Name)
+		if _, err := os.Lstat(dest); err == nil {
+			return "", nil // a current freeze takes precedence; leave both for a person
+		}
+		lf, err := lockfile.Read(is.Path)
+		if err != nil {
+			return "", nil
+		}
+		lf.Name = is.Name
+		if err := root.MkdirAll(dir, filepath.Dir(dest)); err != nil {
+			return "", err
+		}
+		if err := lockfile.Write(dest, lf); err != nil {
+			return "", err
+		}
+		if err := removeEntry(is.Path); err != nil {
+			return "", err
+		}
+		emitFixEvent(auditor, id, audit.EventFreezeMigrate, is, stale.ReasonNotStale)
+		return "migrated", nil
+
+	case IssueMisplaced:
+		lf, err := lockfile.Read(is.Path)
+		if err != nil || lf.LockID != is.Lock.LockID || !lf.AcquiredAt.Equal(is.Lock.AcquiredAt) {
+			return "", nil // released or re-acquired meanwhile
+		}
+		if err := root.MkdirAll(dir, filepath.Dir(is.Dest)); err != nil {
+			return "", err
+		}
+		// A link, unlike a rename, fails rather than replace a lock taken
+		// at the new place meanwhile; leave both for a person then.
+		if err := os.Link(is.Path, is.Dest); err != nil {
+			if os.IsExist(err) {
+				return "", nil
+			}
+			return "", err
+		}
+		_ = lockfile.SyncDir(is.Dest)
+		if err := removeEntry(is.Path); err != nil {
+			return "", err
+		}
+		return "moved", nil
+	}
+	return "", nil
+}
+
+// removeEntry removes path and syncs its directory. A file already gone is
+// not an error.
+func removeEntry(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_ = lockfile.SyncDir(path)
+	return nil
+}
+
+// emitFixEvent records a repair by Fix. Safe to call with nil auditor.
+func emitFixEvent(w *audit.Writer, id identity.Identity, event string, is Issue, reason stale.Reason) {
+	if w == nil {
+		return
+	}
+	extra := map[string]any{"source": "doctor"}
+	if reason != stale.ReasonNotStale {
+		extra["stale_reason"] = string(reason)
+		extra["stale_reason_text"] = reason.Description()
+	}
+	ev := &audit.Event{
+		Event:   event,
+		Name:    is.Name,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra:   extra,
+	}
+	if is.Lock != nil {
+		ev.LockID = is.Lock.LockID
+	}
+	if event == audit.EventAutoPrune {
+		extra["pruned_owner"] = is.Lock.Owner
+		extra["pruned_host"] = is.Lock.Host
+		extra["pruned_pid"] = is.Lock.PID
+	}
+	w.Emit(ev)
+}
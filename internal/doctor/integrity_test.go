@@ -0,0 +1,245 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// setupDamagedRoot creates one entry of every kind ScanIntegrity reports,
+// plus a healthy lock and freeze, under a fresh root.
+func setupDamagedRoot(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := root.EnsureDirs(dir); err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	old := time.Now().Add(-time.Hour)
+	write := func(path string, lf *lockfile.Lock) {
+		t.Helper()
+		if err := lockfile.Write(path, lf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	raw := func(path, data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(root.LockFilePath(dir, "healthy"), &lockfile.Lock{Version: 1, Name: "healthy", Owner: "me", Host: host, PID: os.Getpid(), AcquiredAt: time.Now()})
+	write(root.LockFilePath(dir, "dead"), &lockfile.Lock{Version: 1, Name: "dead", LockID: "d1", Owner: "gone", Host: host, PID: 999999999, AcquiredAt: old})
+	write(root.LockFilePath(dir, "remote"), &lockfile.Lock{Version: 1, Name: "remote", Owner: "far", Host: "other-host", PID: 999999999, AcquiredAt: old})
+	write(root.FreezeFilePath(dir, "frozen"), &lockfile.Lock{Version: 1, Name: "frozen", Owner: "me", Host: host, PID: 999999999, AcquiredAt: time.Now()})
+	write(root.LockFilePath(dir, "freeze-deploy"), &lockfile.Lock{Version: 1, Name: "freeze-deploy", Owner: "me", Host: host, PID: 999999999, AcquiredAt: time.Now()})
+	raw(root.LockFilePath(dir, "garbled"), "{not json")
+	raw(root.FreezeFilePath(dir, "blank"), "")
+	raw(root.LockFilePath(dir, "future"), `{"version": 99, "name": "future"}`)
+	write(root.LockFilePath(dir, "odd"), &lockfile.Lock{Version: 1, Name: "odd", Owner: "far", Host: "other-host", PID: 1, AcquiredAt: time.Now(), Mode: "exclusive"})
+	if err := os.Symlink(filepath.Join(dir, "missing.json"), root.LockFilePath(dir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	// In a shard, but the root isn't sharded.
+	stray := root.ShardedLockFilePath(dir, "stray", 2)
+	if err := os.MkdirAll(filepath.Dir(stray), 0700); err != nil {
+		t.Fatal(err)
+	}
+	write(stray, &lockfile.Lock{Version: 1, Name: "stray", Owner: "far", Host: "other-host", PID: 1, AcquiredAt: time.Now()})
+	return dir
+}
+
+func TestScanIntegrity(t *testing.T) {
+	dir := setupDamagedRoot(t)
+
+	got := map[string]IssueKind{}
+	for _, is := range ScanIntegrity(dir) {
+		got[entryLabel(is)] = is.Kind
+	}
+	want := map[string]IssueKind{
+		"dead":          IssueDeadPID,
+		"freeze deploy": IssueLegacyFreeze,
+		"garbled":       IssueCorrupt,
+		"freeze blank":  IssueEmpty,
+		"future":        IssueUnsupported,
+		"odd":           IssueInvalid,
+		"dangling":      IssueDangling,
+		"stray":         IssueMisplaced,
+	}
+	if len(got) != len(want) {
+		t.Errorf("ScanIntegrity() = %v, want %v", got, want)
+	}
+	for name, kind := range want {
+		if got[name] != kind {
+			t.Errorf("%s: kind %q, want %q", name, got[name], kind)
+		}
+	}
+
+	results := CheckIntegrity(ScanIntegrity(dir))
+	if len(results) != len(checkedKinds) {
+		t.Fatalf("CheckIntegrity() returned %d results, want %d", len(results), len(checkedKinds))
+	}
+	for _, r := range results {
+		if r.Status != StatusWarn || !strings.HasPrefix(r.Message, "1 ") {
+			t.Errorf("%s = %s %q, want a warning counting 1", r.Name, r.Status, r.Message)
+		}
+	}
+}
+
+func TestScanIntegrity_FreshEmptyFileIgnored(t *testing.T) {
+	dir := t.TempDir()
+	if err := root.EnsureDirs(dir); err != nil {
+		t.Fatal(err)
+	}
+	// Mid-creation: zero bytes, but only just
+	if err := os.WriteFile(root.LockFilePath(dir, "new"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if issues := ScanIntegrity(dir); len(issues) != 0 {
+		t.Errorf("ScanIntegrity() = %+v, want none", issues)
+	}
+	for _, r := range CheckIntegrity(nil) {
+		if r.Status != StatusOK {
+			t.Errorf("%s = %s with no issues", r.Name, r.Status)
+		}
+	}
+}
+
+func TestFix(t *testing.T) {
+	dir := setupDamagedRoot(t)
+
+	fixed, errs := Fix(dir, ScanIntegrity(dir), audit.NewWriter(dir))
+	if len(errs) != 0 {
+		t.Fatalf("Fix() errors = %v", errs)
+	}
+	actions := map[string]string{}
+	for _, f := range fixed {
+		actions[f.Name] = f.Action
+	}
+	want := map[string]string{"dead": "removed", "garbled": "removed", "blank": "removed", "deploy": "migrated", "stray": "moved"}
+	if len(actions) != len(want) {
+		t.Errorf("Fix() = %+v, want %v", fixed, want)
+	}
+	for name, action := range want {
+		if actions[name] != action {
+			t.Errorf("%s: action %q, want %q", name, actions[name], action)
+		}
+	}
+
+	// Ambiguous entries are left alone
+	for _, name := range []string{"healthy", "remote", "future"} {
+		if _, err := os.Stat(root.LockFilePath(dir, name)); err != nil {
+			t.Errorf("%s should be kept: %v", name, err)
+		}
+	}
+	if _, err := os.Lstat(root.LockFilePath(dir, "dangling")); err != nil {
+		t.Errorf("dangling symlink should be kept: %v", err)
+	}
+	lf, err := lockfile.Read(root.FreezeFilePath(dir, "deploy"))
+	if err != nil || lf.Name != "deploy" {
+		t.Errorf("migrated freeze = %+v, %v; want freezes/deploy.json named deploy", lf, err)
+	}
+	if _, err := os.Stat(root.LockFilePath(dir, "freeze-deploy")); !os.IsNotExist(err) {
+		t.Error("legacy freeze file should be gone after migration")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "locks", "stray.json")); err != nil {
+		t.Errorf("misplaced lock should be moved to the flat layout: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range []string{`"corrupt-break"`, `"auto-prune"`, `"freeze-migrate"`} {
+		if !strings.Contains(string(data), event) {
+			t.Errorf("audit log lacks %s event:\n%s", event, data)
+		}
+	}
+
+	// Nothing left to do the second time
+	if fixed, _ := Fix(dir, ScanIntegrity(dir), nil); len(fixed) != 0 {
+		t.Errorf("second Fix() = %+v, want nothing", fixed)
+	}
+}
+
+func TestFix_LegacyFreezeWithCurrentFreezeKept(t *testing.T) {
+	dir := setupDamagedRoot(t)
+	if err := lockfile.Write(root.FreezeFilePath(dir, "deploy"), &lockfile.Lock{Version: 1, Name: "deploy", Owner: "me", AcquiredAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	fixed, _ := Fix(dir, ScanIntegrity(dir), nil)
+	for _, f := range fixed {
+		if f.Kind == IssueLegacyFreeze {
+			t.Errorf("Fix() migrated %+v over a current freeze", f)
+		}
+	}
+	if _, err := os.Stat(root.LockFilePath(dir, "freeze-deploy")); err != nil {
+		t.Errorf("legacy freeze should be kept: %v", err)
+	}
+}
+
+func TestFix_MovesMisplacedLocks(t *testing.T) {
+	dir := t.TempDir()
+	if err := root.EnsureDirs(dir); err != nil {
+		t.Fatal(err)
+	}
+	lk := func(name string) *lockfile.Lock {
+		return &lockfile.Lock{Version: 1, Name: name, LockID: name + "-id", Owner: "far", Host: "other-host", PID: 1, AcquiredAt: time.Now()}
+	}
+	// Written before sharding was turned on.
+	for _, name := range []string{"build", "team/deploy"} {
+		path := root.LockFilePath(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := lockfile.Write(path, lk(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"shard_locks": 2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	issues := ScanIntegrity(dir)
+	if len(issues) != 2 || issues[0].Kind != IssueMisplaced {
+		t.Fatalf("ScanIntegrity() = %+v, want two misplaced locks", issues)
+	}
+	fixed, errs := Fix(dir, issues, nil)
+	if len(errs) > 0 || len(fixed) != 2 || fixed[0].Action != "moved" {
+		t.Fatalf("Fix() = %+v, %v", fixed, errs)
+	}
+	for _, name := range []string{"build", "team/deploy"} {
+		want := root.ShardedLockFilePath(dir, name, 2)
+		if got := root.LockFilePath(dir, name); got != want {
+			t.Errorf("LockFilePath(%q) = %q after --fix, want %q", name, got, want)
+		}
+		if lf, err := lockfile.Read(want); err != nil || lf.LockID != name+"-id" {
+			t.Errorf("moved lock %q: %+v, %v", name, lf, err)
+		}
+	}
+	if issues := ScanIntegrity(dir); len(issues) != 0 {
+		t.Errorf("ScanIntegrity() after --fix = %+v, want none", issues)
+	}
+
+	// Turning sharding off again moves them back.
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"shard_locks": 0}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if fixed, errs := Fix(dir, ScanIntegrity(dir), nil); len(errs) > 0 || len(fixed) != 2 {
+		t.Fatalf("Fix() back to flat = %+v, %v", fixed, errs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "locks", "team", "deploy.json")); err != nil {
+		t.Errorf("lock not moved back to the flat layout: %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+package doctor
+
+// This file is lokt doctor --torture: several processes contend for one
+// lock on the root's filesystem, each incrementing a shared counter only
+// while it holds the lock, to find out whether O_EXCL creation and rename
+// really exclude each other there (network and FUSE filesystems don't
+// always). Goroutines in one process can't test this: they share an owner,
+// so the second one re-acquires instead of being denied.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+const (
+	// tortureLock is the lock the workers contend for.
+	tortureLock = "torture"
+	// tortureCounter is the file, in the scratch root, they increment.
+	tortureCounter = "counter"
+)
+
+// TortureOptions configures Torture.
+type TortureOptions struct {
+	Duration time.Duration // how long the workers run
+	Procs    int           // how many worker processes
+	// Command starts a worker: Torture appends the scratch root and the
+	// deadline (RFC 3339) and runs it, expecting TortureWorker to be
+	// behind it (lokt _torture-worker).
+	Command []string
+}
+
+// TortureReport is the outcome of Torture.
+type TortureReport struct {
+	Procs        int           `json:"procs"`
+	Duration     time.Duration `json:"duration_ns"`
+	Acquisitions int           `json:"acquisitions"` // reported by the workers
+	Counter      int           `json:"counter"`      // the counter's final value
+	// Violations are the signs the lock failed to exclude: a counter that
+	// disagrees with Acquisitions, holds that overlap in the audit log,
+	// workers that failed.
+	Violations []string `json:"violations,omitempty"`
+}
+
+// Throughput returns the acquisitions per second.
+func (r *TortureReport) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Acquisitions) / r.Duration.Seconds()
+}
+
+// Torture runs opts.Procs workers against a scratch root created in
+// rootDir, so they exercise its filesystem without touching its locks or
+// audit log, and checks their work once all have exited. The scratch root
+// is removed afterwards. An error means the torture couldn't run; what it
+// found is in the report.
+func Torture(rootDir string, opts TortureOptions) (*TortureReport, error) {
+	if opts.Procs < 1 || opts.Duration <= 0 || len(opts.Command) == 0 {
+		return nil, errors.New("torture needs a duration, at least one process and a worker command")
+	}
+	if err := root.EnsureDirs(rootDir); err != nil {
+		return nil, fmt.Errorf("ensure dirs: %w", err)
+	}
+	scratch, err := os.MkdirTemp(rootDir, ".torture-")
+	if err != nil {
+		return nil, fmt.Errorf("create scratch root: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(scratch) }()
+	if err := os.WriteFile(filepath.Join(scratch, tortureCounter), []byte("0"), 0600); err != nil {
+		return nil, fmt.Errorf("create counter: %w", err)
+	}
+
+	start := time.Now()
+	deadline := start.Add(opts.Duration).Format(time.RFC3339Nano)
+	rep := &TortureReport{Procs: opts.Procs}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Procs; i++ {
+		args := append(append([]string{}, opts.Command[1:]...), scratch, deadline)
+		cmd := exec.Command(opts.Command[0], args...) //nolint:gosec // G204: our own executable
+		// A distinct agent ID per worker: under one owner they would
+		// re-acquire each other's lock instead of being denied.
+		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=torture-%d", identity.EnvLoktAgentID, i), lock.EnvLoktNoSweep+"=1")
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Start(); err != nil {
+			wg.Wait()
+			return nil, fmt.Errorf("start worker: %w", err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := cmd.Wait()
+			n, convErr := strconv.Atoi(strings.TrimSpace(stdout.String()))
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				rep.Violations = append(rep.Violations, fmt.Sprintf("worker %d: %v: %s", i, err, strings.TrimSpace(stderr.String())))
+			case convErr != nil:
+				rep.Violations = append(rep.Violations, fmt.Sprintf("worker %d: unexpected output %q", i, stdout.String()))
+			default:
+				rep.Acquisitions += n
+			}
+		}(i)
+	}
+	wg.Wait()
+	rep.Duration = time.Since(start)
+
+	counter, err := readCounter(scratch)
+	if err != nil {
+		rep.Violations = append(rep.Violations, err.Error())
+	}
+	rep.Counter = counter
+	if err == nil && counter != rep.Acquisitions {
+		rep.Violations = append(rep.Violations, fmt.Sprintf("counter is %d after %d acquisitions: increments were lost", counter, rep.Acquisitions))
+	}
+
+	var events []*audit.Event
+	err = audit.ScanAll(scratch, time.Time{}, func(e *audit.Event, _ []byte) bool {
+		if e.Name == tortureLock {
+			events = append(events, e)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	rep.Violations = append(rep.Violations, holdOverlaps(events)...)
+	return rep, nil
+}
+
+// holdOverlaps returns a description of every hold in events, given in log
+// order, that began before the one before it was released. The log's order
+// is the order of the appends, so it needs no clock; TortureWorker logs
+// each release while still holding the lock.
+func holdOverlaps(events []*audit.Event) []string {
+	var overlaps []string
+	held := ""
+	for _, e := range events {
+		switch e.Event {
+		case audit.EventAcquire:
+			if held != "" && held != e.LockID {
+				overlaps = append(overlaps, fmt.Sprintf("%s (%s) acquired while %s was held", e.LockID, e.AgentID, held))
+			}
+			held = e.LockID
+		case audit.EventRelease:
+			if e.LockID == held {
+				held = ""
+			}
+		}
+	}
+	return overlaps
+}
+
+// CheckTorture reports a TortureReport as a check: failed if it found any
+// violation, with the throughput in the message either way.
+func CheckTorture(rep *TortureReport) CheckResult {
+	result := CheckResult{Name: "torture", Status: StatusOK}
+	result.Message = fmt.Sprintf("%d acquisitions by %d processes in %s (%.0f/s)",
+		rep.Acquisitions, rep.Procs, rep.Duration.Truncate(time.Millisecond), rep.Throughput())
+	if len(rep.Violations) > 0 {
+		result.Status = StatusFail
+		result.Message += "; " + strings.Join(rep.Violations, "; ")
+	}
+	return result
+}
+
+// TortureWorker is one worker of Torture, run in its own process: until
+// deadline it acquires the lock in scratch, increments the counter with a
+// plain read and write that a second holder would garble, logs the release
+// and releases. It returns how many times it held the lock; an error means
+// it saw the lock fail (the counter unreadable, its lock taken over) or
+// couldn't go on.
+func TortureWorker(scratch string, deadline time.Time) (int, error) {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	auditor := audit.NewWriter(scratch)
+	id := identity.Current()
+	opts := lock.AcquireOptions{
+		Auditor:    auditor,
+		NoAdaptive: true,
+		Retry:      lock.RetryPolicy{Base: time.Millisecond, Max: 20 * time.Millisecond, Spread: 0.5},
+	}
+	n := 0
+	for ctx.Err() == nil {
+		err := lock.AcquireWithWait(ctx, scratch, tortureLock, opts)
+		if errors.Is(err, context.DeadlineExceeded) {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("acquire: %w", err)
+		}
+		lf, err := lockfile.Read(root.LockFilePath(scratch, tortureLock))
+		if err != nil {
+			return n, fmt.Errorf("read own lock: %w", err)
+		}
+		counter, err := readCounter(scratch)
+		if err != nil {
+			return n, err
+		}
+		if err := os.WriteFile(filepath.Join(scratch, tortureCounter), []byte(strconv.Itoa(counter+1)), 0600); err != nil {
+			return n, fmt.Errorf("write counter: %w", err)
+		}
+		n++
+		auditor.Emit(&audit.Event{
+			Event: audit.EventRelease, Name: tortureLock, LockID: lf.LockID,
+			Owner: id.Owner, Host: id.Host, PID: id.PID, AgentID: id.AgentID,
+		})
+		if err := lock.Release(scratch, tortureLock, lock.ReleaseOptions{LockID: lf.LockID}); err != nil {
+			return n, fmt.Errorf("release: %w", err)
+		}
+	}
+	return n, nil
+}
+
+// readCounter reads the counter in scratch.
+func readCounter(scratch string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(scratch, tortureCounter)) //nolint:gosec // G304: path is built from the lokt root
+	if err != nil {
+		return 0, fmt.Errorf("read counter: %w", err)
+	}
+	n, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("counter is garbled (%q): two holders wrote it at once", data)
+	}
+	return n, nil
+}
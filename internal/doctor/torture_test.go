@@ -0,0 +1,46 @@
+package doctor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+)
+
+func TestHoldOverlaps(t *testing.T) {
+	ev := func(event, lockID string) *audit.Event {
+		return &audit.Event{Event: event, Name: tortureLock, LockID: lockID}
+	}
+	clean := []*audit.Event{
+		ev(audit.EventAcquire, "a"), ev(audit.EventDeny, ""), ev(audit.EventRelease, "a"),
+		ev(audit.EventAcquire, "b"), ev(audit.EventRelease, "b"),
+	}
+	if got := holdOverlaps(clean); len(got) != 0 {
+		t.Errorf("holdOverlaps(sequential holds) = %v", got)
+	}
+	overlapping := []*audit.Event{
+		ev(audit.EventAcquire, "a"), ev(audit.EventAcquire, "b"),
+		ev(audit.EventRelease, "a"), ev(audit.EventRelease, "b"),
+	}
+	if got := holdOverlaps(overlapping); len(got) != 1 || !strings.Contains(got[0], "b ") {
+		t.Errorf("holdOverlaps(overlapping holds) = %v, want b reported", got)
+	}
+}
+
+func TestCheckTorture(t *testing.T) {
+	rep := &TortureReport{Procs: 4, Duration: 2 * time.Second, Acquisitions: 100, Counter: 100}
+	if r := CheckTorture(rep); r.Status != StatusOK || !strings.Contains(r.Message, "(50/s)") {
+		t.Errorf("CheckTorture(clean) = %+v", r)
+	}
+	rep.Violations = []string{"counter is 99 after 100 acquisitions: increments were lost"}
+	if r := CheckTorture(rep); r.Status != StatusFail || !strings.Contains(r.Message, "increments were lost") {
+		t.Errorf("CheckTorture(violation) = %+v", r)
+	}
+}
+
+func TestTorture_Usage(t *testing.T) {
+	if _, err := Torture(t.TempDir(), TortureOptions{Duration: time.Second}); err == nil {
+		t.Error("Torture without processes or a command should fail")
+	}
+}
@@ -0,0 +1,107 @@
+package guard
+
+import (
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+)
+
+const (
+	// maxAuditArgs and maxAuditArgLen bound the argv a guard-start event
+	// records, so a command line of generated file names doesn't bloat the
+	// audit log. Anything cut is flagged with extra.argv_truncated.
+	maxAuditArgs   = 64
+	maxAuditArgLen = 256
+)
+
+// emitChildStart records the command the run is about to hold the lock for:
+// a guard-start event with extra.argv, extra.cwd, extra.child_pid and, if
+// it may be retried, extra.attempt. Safe to call with a nil auditor.
+func emitChildStart(w *audit.Writer, o Options, lockID string, argv []string, pid, attempt int) {
+	if w == nil {
+		return
+	}
+	args, truncated := auditArgv(argv)
+	extra := map[string]any{
+		"argv":      args,
+		"child_pid": pid,
+	}
+	if truncated {
+		extra["argv_truncated"] = true
+	}
+	if cwd := o.Dir; cwd != "" {
+		extra["cwd"] = cwd
+	} else if cwd, err := os.Getwd(); err == nil {
+		extra["cwd"] = cwd
+	}
+	if len(o.Also) > 0 {
+		extra["also"] = o.Also
+	}
+	if o.Retry > 0 {
+		extra["attempt"] = attempt
+	}
+	emitChildEvent(w, audit.EventGuardStart, o, lockID, extra)
+}
+
+// emitChildEnd records how the command ended: a guard-end event with
+// extra.exit_code, extra.duration_ms (from start to exit, wall-clock),
+// extra.attempt as for guard-start and, if a signal ended it, extra.signal.
+// Safe to call with a nil auditor.
+func emitChildEnd(w *audit.Writer, o Options, lockID string, res Result, sig os.Signal, ran time.Duration, attempt int) {
+	if w == nil {
+		return
+	}
+	extra := map[string]any{
+		"exit_code":   res.ExitCode,
+		"duration_ms": ran.Milliseconds(),
+	}
+	if sig != nil {
+		extra["signal"] = sig.String()
+	}
+	if res.Signal != nil {
+		extra["forwarded"] = true
+	}
+	if o.Retry > 0 {
+		extra["attempt"] = attempt
+	}
+	emitChildEvent(w, audit.EventGuardEnd, o, lockID, extra)
+}
+
+// emitChildEvent emits event for the run's lock, as this process.
+func emitChildEvent(w *audit.Writer, event string, o Options, lockID string, extra map[string]any) {
+	id := identity.Current()
+	w.Emit(&audit.Event{
+		Event:   event,
+		Name:    o.Name,
+		LockID:  lockID,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra:   extra,
+	})
+}
+
+// auditArgv returns argv bounded by maxAuditArgs and maxAuditArgLen, each
+// argument valid UTF-8, and whether anything was cut.
+func auditArgv(argv []string) ([]string, bool) {
+	truncated := len(argv) > maxAuditArgs
+	argv = argv[:min(len(argv), maxAuditArgs)]
+	out := make([]string, len(argv))
+	for i, arg := range argv {
+		arg = strings.ToValidUTF8(arg, "\uFFFD")
+		if len(arg) > maxAuditArgLen {
+			cut := maxAuditArgLen
+			for cut > 0 && !utf8.RuneStart(arg[cut]) {
+				cut--
+			}
+			arg, truncated = arg[:cut]+"…", true
+		}
+		out[i] = arg
+	}
+	return out, truncated
+}
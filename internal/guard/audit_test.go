@@ -0,0 +1,97 @@
+//go:build unix
+
+package guard
+
+import (
+	"context"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lock"
+)
+
+// childEvents runs command under a guard on a fresh root and returns its
+// guard-start and guard-end events.
+func childEvents(t *testing.T, command []string, hooks Hooks, sigs <-chan os.Signal) (start, end *audit.Event) {
+	t.Helper()
+	rootDir := setupRoot(t)
+	dir := t.TempDir()
+	_, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: command, Dir: dir, Signals: sigs,
+		Acquire: lock.AcquireOptions{Auditor: audit.NewWriter(rootDir)},
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	var acquired string
+	err = audit.ScanFile(audit.Path(rootDir), func(e *audit.Event, _ []byte) bool {
+		switch e.Event {
+		case audit.EventAcquire:
+			acquired = e.LockID
+		case audit.EventGuardStart:
+			start = e
+		case audit.EventGuardEnd:
+			end = e
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start == nil || end == nil {
+		t.Fatalf("guard-start %v, guard-end %v; want both logged", start, end)
+	}
+	if start.LockID != acquired || end.LockID != acquired || start.Extra["cwd"] != dir {
+		t.Errorf("guard-start %+v, guard-end %+v; want lock_id %s and cwd %s", start, end, acquired, dir)
+	}
+	return start, end
+}
+
+func TestRun_AuditsChildFailure(t *testing.T) {
+	start, end := childEvents(t, []string{"sh", "-c", "exit 3", "arg"}, Hooks{}, nil)
+	if argv, _ := start.Extra["argv"].([]any); len(argv) != 4 || argv[2] != "exit 3" {
+		t.Errorf("guard-start argv = %v, want the command line", start.Extra["argv"])
+	}
+	if pid, _ := start.Extra["child_pid"].(float64); pid <= 0 {
+		t.Errorf("guard-start child_pid = %v", start.Extra["child_pid"])
+	}
+	if end.Extra["exit_code"] != float64(3) || end.Extra["signal"] != nil {
+		t.Errorf("guard-end extra = %v, want exit_code 3 and no signal", end.Extra)
+	}
+	if _, ok := end.Extra["duration_ms"].(float64); !ok {
+		t.Errorf("guard-end extra = %v, want duration_ms", end.Extra)
+	}
+}
+
+func TestRun_AuditsChildSignal(t *testing.T) {
+	// Killed by a signal nobody forwarded
+	_, end := childEvents(t, []string{"sh", "-c", "kill -KILL $$"}, Hooks{}, nil)
+	if end.Extra["exit_code"] != float64(128+int(syscall.SIGKILL)) || end.Extra["signal"] != syscall.SIGKILL.String() || end.Extra["forwarded"] != nil {
+		t.Errorf("guard-end extra = %v, want SIGKILL", end.Extra)
+	}
+
+	// Stopped by a signal forwarded to it
+	sigs := make(chan os.Signal, 1)
+	hooks := Hooks{OnChildStart: func(int) { sigs <- syscall.SIGTERM }}
+	_, end = childEvents(t, []string{"sleep", "10"}, hooks, sigs)
+	if end.Extra["exit_code"] != float64(128+int(syscall.SIGTERM)) || end.Extra["signal"] != syscall.SIGTERM.String() || end.Extra["forwarded"] != true {
+		t.Errorf("guard-end extra = %v, want a forwarded SIGTERM", end.Extra)
+	}
+}
+
+func TestAuditArgv(t *testing.T) {
+	if got, cut := auditArgv([]string{"make", "all"}); cut || strings.Join(got, " ") != "make all" {
+		t.Errorf("auditArgv = %q, %v; want it unchanged", got, cut)
+	}
+	long := strings.Repeat("é", maxAuditArgLen)
+	got, cut := auditArgv(append([]string{"rm", long, "\xff"}, make([]string, maxAuditArgs)...))
+	if !cut || len(got) != maxAuditArgs {
+		t.Fatalf("auditArgv: %d args, truncated %v; want %d, true", len(got), cut, maxAuditArgs)
+	}
+	if len(got[1]) > maxAuditArgLen+len("…") || !strings.HasSuffix(got[1], "é…") || got[2] != "�" {
+		t.Errorf("auditArgv = %q, %q; want the long argument cut on a rune and invalid UTF-8 replaced", got[1], got[2])
+	}
+}
@@ -0,0 +1,78 @@
+package guard
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// Environment variables a Runner sets on its child to describe the lock it
+// holds, so scripts can log the lock_id or hand it to a sub-process.
+const (
+	EnvLock      = "LOKT_GUARD_LOCK"
+	EnvLockID    = "LOKT_GUARD_LOCK_ID"
+	EnvTTLSec    = "LOKT_GUARD_TTL_SEC"
+	EnvRoot      = "LOKT_GUARD_ROOT"
+	EnvExpiresAt = "LOKT_GUARD_EXPIRES_AT" // RFC 3339 as of acquisition (renewals extend it); unset without a TTL
+)
+
+// envPrefix is shared by the variables above.
+const envPrefix = "LOKT_GUARD_"
+
+// lockEnv returns env (nil means this process's) with the variables above
+// describing lf, the lock held on name in rootDir. Any left from an
+// enclosing guard are replaced.
+func lockEnv(env []string, rootDir, name string, lf *lockfile.Lock) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	out := make([]string, 0, len(env)+5)
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, envPrefix) {
+			out = append(out, kv)
+		}
+	}
+	out = append(out, EnvLock+"="+name, EnvRoot+"="+rootDir)
+	if lf == nil {
+		return out
+	}
+	out = append(out, EnvLockID+"="+lf.LockID, EnvTTLSec+"="+strconv.Itoa(lf.TTLSec))
+	if lf.ExpiresAt != nil {
+		out = append(out, EnvExpiresAt+"="+lf.ExpiresAt.Format(time.RFC3339))
+	}
+	return out
+}
+
+// Inherited reports whether this process runs under a guard holding name in
+// rootDir (exclusively, or shared if shared is set): the LOKT_GUARD_
+// variables name that lock and it still carries their lock_id. A nested
+// guard for the same lock then runs its command under the enclosing hold
+// (Options.Inherited) instead of re-acquiring it.
+func Inherited(rootDir, name string, shared bool) bool {
+	if os.Getenv(EnvLock) != name {
+		return false
+	}
+	id := os.Getenv(EnvLockID)
+	if id == "" {
+		return false
+	}
+	dir, err := root.Follow(rootDir)
+	if err != nil {
+		return false
+	}
+	if shared {
+		for _, h := range lock.SharedHolders(dir, name) {
+			if h.LockID == id {
+				return true
+			}
+		}
+		return false
+	}
+	lf, err := lockfile.Read(root.LockFilePath(dir, name))
+	return err == nil && lf.LockID == id
+}
@@ -0,0 +1,129 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// ErrExecUnsupported is returned by Exec where a process can't replace
+// itself with another program (Windows).
+var ErrExecUnsupported = errors.New("exec is not supported on this platform; use lokt guard")
+
+// releasePoll is how often ReleaseWhenGone checks on the holder.
+var releasePoll = 250 * time.Millisecond
+
+// Exec is the lokt run counterpart of Run: it checks for a freeze and
+// acquires the lock like Run, then replaces this process with the command
+// (execve), so the lock's PID is the command's own and PID liveness tracks
+// the real worker. There is no heartbeat and nothing left to release the
+// lock: a TTL must cover the whole command, and the lock goes when its
+// holder is found dead (same host) or the TTL runs out, unless the
+// BeforeExec hook arranges a release (lokt run --post-release).
+//
+// Exec returns only if the command couldn't be started, having released
+// the lock. Also, IfFree, NoRelease, Retry and Slots are not supported.
+func (r *Runner) Exec(ctx context.Context) (Result, error) {
+	o := r.opts
+	res := Result{Stage: StageFreeze}
+	switch {
+	case !execSupported:
+		return res, ErrExecUnsupported
+	case len(o.Command) == 0:
+		return res, errors.New("no command to run")
+	case o.Shell && len(o.Command) != 1:
+		return res, errors.New("a shell command must be a single string")
+	case len(o.Also) > 0 || o.IfFree || o.NoRelease || o.Retry > 0 || o.Slots > 0:
+		return res, errors.New("exec doesn't support several locks, IfFree, NoRelease, Retry or slots")
+	}
+
+	var lf *lockfile.Lock
+	if !o.Inherited {
+		if err := r.checkFreeze(ctx, o.Name, &o, &res); err != nil {
+			return res, err
+		}
+		res.Stage = StageAcquire
+		if _, err := r.acquire(ctx, o); err != nil {
+			return res, err
+		}
+		if r.hooks.OnAcquired != nil {
+			r.hooks.OnAcquired()
+		}
+		lf, _ = lockfile.Read(root.LockFilePath(o.RootDir, o.Name))
+	}
+
+	res.Stage = StageStart
+	argv := o.Command
+	if o.Shell {
+		argv = shellArgv(o.Command[0])
+	}
+	env := o.Env
+	if !o.Inherited {
+		env = lockEnv(env, o.RootDir, o.Name, lf)
+	} else if env == nil {
+		env = os.Environ()
+	}
+	var err error
+	if r.hooks.BeforeExec != nil && lf != nil {
+		err = r.hooks.BeforeExec(lf)
+	}
+	if err == nil && o.Dir != "" {
+		err = os.Chdir(o.Dir)
+	}
+	if err == nil {
+		err = execve(argv, env) // returns only on failure
+	}
+	if !o.Inherited {
+		relErr := lock.Release(o.RootDir, o.Name, lock.ReleaseOptions{Auditor: o.Acquire.Auditor})
+		if r.hooks.OnRelease != nil {
+			r.hooks.OnRelease(relErr)
+		}
+	}
+	return res, err
+}
+
+// ReleaseWhenGone waits until the holder of lockID on name has exited, then
+// releases the lock (lokt run --post-release). It returns nil without
+// releasing anything if the lock is released or taken over first, and
+// ctx's error if ctx ends the wait.
+func ReleaseWhenGone(ctx context.Context, rootDir, name, lockID string, auditor *audit.Writer) error {
+	path := root.LockFilePath(rootDir, name)
+	for {
+		lf, err := lockfile.Read(path)
+		if err != nil || lf.LockID != lockID {
+			return nil // released, replaced, or no longer ours to judge
+		}
+		if holderGone(lf) {
+			err := lock.Release(rootDir, name, lock.ReleaseOptions{Auditor: auditor, LockID: lockID})
+			if errors.Is(err, lock.ErrNotFound) || errors.Is(err, lock.ErrLockStolen) {
+				return nil
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(releasePoll):
+		}
+	}
+}
+
+// holderGone reports whether lf's process has exited, or its PID now
+// belongs to another process.
+func holderGone(lf *lockfile.Lock) bool {
+	if !stale.IsProcessAlive(lf.PID) {
+		return true
+	}
+	if lf.PIDStartNS == 0 {
+		return false
+	}
+	startNS, err := stale.GetProcessStartTime(lf.PID)
+	return err == nil && startNS != lf.PIDStartNS
+}
@@ -0,0 +1,120 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func TestExec_StartFailureReleases(t *testing.T) {
+	if !execSupported {
+		t.Skip("no exec on this platform")
+	}
+	rootDir := setupRoot(t)
+	rec := &recorder{}
+	hooks := rec.hooks()
+	var before *lockfile.Lock
+	hooks.BeforeExec = func(lf *lockfile.Lock) error {
+		before = lf
+		return nil
+	}
+
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{filepath.Join(rootDir, "no-such-command")},
+	}, hooks).Exec(context.Background())
+	if err == nil || res.Stage != StageStart {
+		t.Fatalf("Exec() = %+v, %v; want start failure", res, err)
+	}
+	if before == nil || before.PID != os.Getpid() {
+		t.Errorf("BeforeExec got %+v, want the lock naming this process", before)
+	}
+	if got := strings.Join(rec.list(), " "); got != "acquired release" {
+		t.Errorf("hooks = %q, want %q", got, "acquired release")
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "build")); !os.IsNotExist(err) {
+		t.Error("lock should be released when the command can't be started")
+	}
+}
+
+func TestExec_BeforeExecErrorReleases(t *testing.T) {
+	if !execSupported {
+		t.Skip("no exec on this platform")
+	}
+	rootDir := setupRoot(t)
+	boom := errors.New("boom")
+	_, err := New(Options{RootDir: rootDir, Name: "build", Command: []string{"true"}},
+		Hooks{BeforeExec: func(*lockfile.Lock) error { return boom }}).Exec(context.Background())
+	if !errors.Is(err, boom) {
+		t.Fatalf("Exec() error = %v, want the hook's error", err)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "build")); !os.IsNotExist(err) {
+		t.Error("lock should be released when BeforeExec fails")
+	}
+}
+
+func TestExec_Held(t *testing.T) {
+	if !execSupported {
+		t.Skip("no exec on this platform")
+	}
+	rootDir := setupRoot(t)
+	writeHolder(t, rootDir, "build")
+
+	res, err := New(Options{RootDir: rootDir, Name: "build", Command: []string{"true"}}, Hooks{}).Exec(context.Background())
+	var held *lock.HeldError
+	if !errors.As(err, &held) || res.Stage != StageAcquire {
+		t.Fatalf("Exec() = %+v, %v; want a HeldError at acquire", res, err)
+	}
+}
+
+func TestReleaseWhenGone(t *testing.T) {
+	rootDir := setupRoot(t)
+	releasePoll = 10 * time.Millisecond
+	t.Cleanup(func() { releasePoll = 250 * time.Millisecond })
+
+	child := exec.Command("sleep", "0.2")
+	if err := child.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	go func() { _ = child.Wait() }() // reap it, or it lingers as a zombie
+	host, _ := os.Hostname()
+	if err := lockfile.Write(root.LockFilePath(rootDir, "build"), &lockfile.Lock{
+		Version: 1, Name: "build", LockID: "run-1", Owner: "someone", Host: host, PID: child.Process.Pid, AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ReleaseWhenGone(ctx, rootDir, "build", "run-1", audit.NewWriter(rootDir)); err != nil {
+		t.Fatalf("ReleaseWhenGone() error = %v", err)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "build")); !os.IsNotExist(err) {
+		t.Error("lock should be released once its holder exited")
+	}
+	data, _ := os.ReadFile(audit.Path(rootDir))
+	if !strings.Contains(string(data), `"event":"release"`) {
+		t.Errorf("expected a release event, got %s", data)
+	}
+}
+
+func TestReleaseWhenGone_TakenOver(t *testing.T) {
+	rootDir := setupRoot(t)
+	writeHolder(t, rootDir, "build") // a different acquisition, no lock ID
+
+	if err := ReleaseWhenGone(context.Background(), rootDir, "build", "run-1", nil); err != nil {
+		t.Fatalf("ReleaseWhenGone() error = %v", err)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "build")); err != nil {
+		t.Errorf("another holder's lock was released: %v", err)
+	}
+}
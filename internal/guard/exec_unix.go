@@ -0,0 +1,26 @@
+//go:build unix
+
+package guard
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+const execSupported = true
+
+// execve replaces this process with argv, looked up in PATH, keeping its
+// PID. It returns only on failure.
+func execve(argv, env []string) error {
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, argv, env)
+}
+
+// Detach starts cmd in a session of its own, so a process that outlives
+// this one (lokt run's releaser) is out of reach of the terminal's signals.
+func Detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package guard
+
+import "os/exec"
+
+const execSupported = false
+
+// execve is not available: Windows can't replace a process's image.
+func execve(_, _ []string) error {
+	return ErrExecUnsupported
+}
+
+// Detach leaves cmd as it is; Exec, the only user, is not supported.
+func Detach(*exec.Cmd) {}
@@ -0,0 +1,605 @@
+// Package guard runs a command while holding a lock. A Runner checks for a
+// freeze (optionally waiting for it to lift), acquires the lock (optionally
+// waiting for the holder), renews it on a heartbeat while the child runs,
+// forwards SIGINT/SIGTERM to the child, and releases the lock once the child
+// is gone.
+//
+// lokt guard is a thin adapter over Runner: it turns flags into Options,
+// prints progress from Hooks, and maps the Result to an exit code.
+package guard
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// Stage identifies how far a run got.
+type Stage string
+
+const (
+	StageFreeze  Stage = "freeze"  // checking for, or waiting out, a freeze
+	StageAcquire Stage = "acquire" // acquiring, or waiting for, the lock
+	StageStart   Stage = "start"   // starting the child
+	StageChild   Stage = "child"   // the child ran and has exited
+)
+
+// LostPolicy says what happens to the child when the heartbeat finds the
+// lock is no longer held by this run.
+type LostPolicy string
+
+const (
+	LostWarn      LostPolicy = "warn"      // report it through OnLost; the child keeps running
+	LostTerminate LostPolicy = "terminate" // also send the child SIGTERM
+)
+
+// Options configures a Runner.
+type Options struct {
+	RootDir string
+	Name    string
+	Command []string // argv of the child; must not be empty
+	// Shell runs Command, then a single string, as a script through the
+	// user's shell ($SHELL -c, else /bin/sh -c; cmd /C on Windows), so
+	// pipes, && and redirections all run under the lock.
+	Shell bool
+
+	// Acquire is passed to lock.Acquire / lock.AcquireWithWait. Its TTL
+	// also enables the heartbeat, and its Auditor receives renew and
+	// release events too. ThawWait is filled in by the Runner.
+	Acquire  lock.AcquireOptions
+	Wait     bool // wait for the holder to release instead of failing
+	WaitThaw bool // wait for an active freeze to lift instead of failing
+	// IfFree skips the run instead of failing when the lock is held
+	// (lock.TryAcquire): Run returns no error and Result.Skipped. Not
+	// supported with Wait.
+	IfFree bool
+	// Inherited means an enclosing guard already holds the lock (see
+	// Inherited): Run only runs the child, leaving the freeze check,
+	// acquisition, heartbeat and release to the enclosing guard.
+	Inherited bool
+	// Also lists more locks to hold for the run alongside Name. All are
+	// acquired or none (lock.AcquireMany, which holds none of them while
+	// waiting), each is renewed on its own heartbeat, and all are released
+	// together. The LOKT_GUARD_ variables describe Name. Not supported
+	// with IfFree, Inherited or NoRelease.
+	Also []string
+	// Slots, if set, makes Name a name of that many slots
+	// (lock.AcquireSlot): freezes are checked on Name, and the run takes
+	// whichever slot is free, waiting with Wait for one to free up, then
+	// holds it as it would Name. Result.Slot names it. Not supported with
+	// Also, Inherited or Acquire.Shared.
+	Slots int
+
+	// Env is the child's environment; nil inherits this process's. The
+	// LOKT_GUARD_ variables (EnvLock, ...) are added to it.
+	Env []string
+	// Dir is the child's working directory; empty inherits this process's.
+	Dir string
+	// Child stdio, as for exec.Cmd: nil means the null device.
+	Stdin          io.Reader
+	Stdout, Stderr io.Writer
+	// TagOutput prefixes each line the child writes to Stdout and Stderr
+	// with "[<Name>] " (see LineWriter), keeping the two streams apart,
+	// and OutputLog, if set, also receives both as written, untagged.
+	// Either has the output copied through pipes, closed on anything the
+	// child leaves running a few seconds after it exits. Run only: Exec
+	// hands the process over.
+	TagOutput bool
+	OutputLog io.Writer
+
+	// Signals delivers signals to forward to the child. Nil subscribes to
+	// SIGINT and SIGTERM once the lock is held. On Unix the child runs in a
+	// process group of its own, unless stdin is a terminal, and signals go
+	// to the whole group, so its descendants (a compiler under make, a
+	// server a script backgrounded) stop with it rather than outlive the
+	// lock.
+	Signals <-chan os.Signal
+	// KillTimeout is how long the child's process group gets to exit after
+	// a forwarded signal before it is killed (SIGKILL); zero waits for the
+	// child and leaves the rest of the group alone.
+	KillTimeout time.Duration
+
+	// MaxRenewGap is the longest wall-clock gap between successful
+	// renewals the heartbeat accepts before re-verifying that it still
+	// holds the lock; zero means the TTL.
+	MaxRenewGap time.Duration
+	// OnLost applies when that verification fails; empty means LostWarn.
+	OnLost LostPolicy
+	// StrictTTL also counts the lock as lost when a renewal finds it gone
+	// or held by someone else, or after three renewals in a row fail, so
+	// the TTL can't run out unnoticed while the child runs.
+	StrictTTL bool
+	// KillGrace is how long the child's process group gets to exit after
+	// LostTerminate's SIGTERM before it is killed; zero waits for the child.
+	KillGrace time.Duration
+	// VerifyInterval, if set, checks this often while the child runs that
+	// every lock file is still there as acquired (lock.Verify); one found
+	// gone or replaced is handled under OnLost like a lost lock. The check
+	// is made once before release in any case (see Result.Vanished).
+	VerifyInterval time.Duration
+
+	// NoRelease keeps the lock, marked retained (lock.Retain), when the
+	// child exits 0. Any other outcome, including a forwarded signal or a
+	// lost lock, still releases it. Not supported with Acquire.Shared.
+	NoRelease bool
+
+	// Retry re-runs the command up to this many more times when it exits
+	// non-zero, waiting RetryDelay before each re-run, all under the one
+	// hold: the heartbeat and VerifyInterval checks carry on between
+	// attempts and no one else gets the lock in between. An attempt killed
+	// by a signal, one whose exit code is in NoRetryOn, or one after which
+	// the lock is found lost or vanished is not retried, and a signal
+	// during the delay ends the run at once. Each attempt is audited as its
+	// own guard-start/guard-end pair, with extra.attempt. Stdin is shared
+	// by the attempts, so a reader other than a terminal or file may have
+	// nothing left for a re-run. Run only.
+	Retry      int
+	RetryDelay time.Duration
+	NoRetryOn  []int
+}
+
+// Hooks are optional callbacks for each phase of a run. They are called
+// synchronously; OnRenew and OnRenewFailed from the heartbeat goroutine,
+// the rest from the goroutine calling Run.
+type Hooks struct {
+	// OnWaiting is called when a wait begins. At StageFreeze lk is the
+	// active freeze, reported again whenever it is replaced, including one
+	// placed while waiting for the lock (Acquire.RespectFreeze); at
+	// StageAcquire it is the holder when polling starts.
+	OnWaiting     func(stage Stage, lk *lockfile.Lock)
+	OnAcquired    func()
+	OnRenew       func()
+	OnRenewFailed func(err error)
+	// OnClockGap is called when the heartbeat resumes after a gap longer
+	// than MaxRenewGap, or sees the wall clock jump by more than a
+	// heartbeat interval, and OnLost if it then finds the lock taken over
+	// or gone. The heartbeat stops after OnLost.
+	OnClockGap func(gap time.Duration)
+	OnLost     func(err error)
+	// OnVanished is called when a lock file is found gone or replaced by
+	// another acquisition (Result.Vanished).
+	OnVanished   func(err error)
+	OnChildStart func(pid int)
+	// OnRetry is called when attempt (from 1) ended as res and the command
+	// will be run again after Options.RetryDelay.
+	OnRetry func(attempt int, res Result)
+	// OnChildExit is called with the final Result before the lock is
+	// released.
+	OnChildExit func(res Result)
+	OnRelease   func(err error)
+	// OnRetain replaces OnRelease when NoRelease keeps the lock.
+	OnRetain func(err error)
+	// BeforeExec is called by Exec with the lock as acquired, just before
+	// this process is replaced by the command. An error aborts the run and
+	// releases the lock.
+	BeforeExec func(lf *lockfile.Lock) error
+}
+
+// Result describes how a run ended.
+type Result struct {
+	Stage    Stage
+	ThawWait time.Duration
+	// ExitCode is the child's exit code (as exec.ExitError.ExitCode), or
+	// 128+signal when a forwarded signal ended the run. Only meaningful at
+	// StageChild.
+	ExitCode int
+	Signal   os.Signal // the forwarded signal, if one ended the run
+	Lost     error     // set if the heartbeat found the lock no longer held
+	// Vanished is set if a lock file was gone or replaced when checked,
+	// before release or on VerifyInterval: the command (git clean -xfd,
+	// say) may have deleted the lock root. Such a lock isn't released, and
+	// a lock-vanished event is logged.
+	Vanished error
+	Retained bool // the lock was kept (Options.NoRelease)
+	// Skipped is the holder's denial when IfFree skipped the run; the
+	// child never started.
+	Skipped *lock.HeldError
+	// Attempts is how many times the child was started (Options.Retry);
+	// the other fields describe the last attempt.
+	Attempts int
+	// Slot is the lock name of the slot held (Options.Slots).
+	Slot string
+}
+
+// Runner runs one command under one lock (or, with Options.Also, several).
+type Runner struct {
+	opts  Options
+	hooks Hooks
+}
+
+// New returns a Runner for opts.
+func New(opts Options, hooks Hooks) *Runner {
+	return &Runner{opts: opts, hooks: hooks}
+}
+
+// Run acquires the lock, runs the child and releases (or, with NoRelease,
+// retains) the lock. ctx bounds
+// the freeze and lock waits only; once the child has started it runs to
+// completion unless a signal is forwarded to it.
+//
+// The error is non-nil when the run stopped before the child exited
+// normally; Result.Stage says where. Lock errors come back unwrapped
+// (*lock.FrozenError, *lock.HeldError, *lock.WaitError) so callers can map
+// them.
+func (r *Runner) Run(ctx context.Context) (Result, error) {
+	o := r.opts
+	res := Result{Stage: StageFreeze}
+	if len(o.Command) == 0 {
+		return res, errors.New("no command to run")
+	}
+	if o.Shell && len(o.Command) != 1 {
+		return res, errors.New("a shell command must be a single string")
+	}
+	if len(o.Also) > 0 && (o.IfFree || o.Inherited || o.NoRelease) {
+		return res, errors.New("several locks cannot be combined with IfFree, Inherited or NoRelease")
+	}
+	if o.Slots > 0 && (len(o.Also) > 0 || o.Inherited || o.Acquire.Shared) {
+		return res, errors.New("slots cannot be combined with several locks, Inherited or Shared")
+	}
+
+	if !o.Inherited {
+		for _, name := range o.names() {
+			if err := r.checkFreeze(ctx, name, &o, &res); err != nil {
+				return res, err
+			}
+		}
+	}
+
+	res.Stage = StageAcquire
+	switch {
+	case o.Inherited:
+		// Held, renewed and released by the enclosing guard
+	case o.IfFree && o.Slots > 0:
+		slot, tr, err := lock.TrySlot(o.RootDir, o.Name, o.Slots, o.Acquire)
+		if err != nil {
+			return res, err
+		}
+		if !tr.Acquired {
+			res.Skipped = tr.Held
+			return res, nil
+		}
+		o.Name, res.Slot = slot, slot
+	case o.IfFree:
+		tr, err := lock.TryAcquire(o.RootDir, o.Name, o.Acquire)
+		if err != nil {
+			return res, err
+		}
+		if !tr.Acquired {
+			res.Skipped = tr.Held
+			return res, nil
+		}
+	default:
+		name, err := r.acquire(ctx, o)
+		if err != nil {
+			return res, err
+		}
+		if o.Slots > 0 {
+			o.Name, res.Slot = name, name
+		}
+	}
+	if r.hooks.OnAcquired != nil && !o.Inherited {
+		r.hooks.OnAcquired()
+	}
+
+	// The acquisitions to verify before release
+	lockIDs := map[string]string{}
+	if !o.Inherited {
+		for _, name := range o.names() {
+			lockIDs[name] = heldLockID(o.RootDir, name, o.Acquire.Shared)
+		}
+	}
+
+	// stopHeartbeat cancels the heartbeat and waits for it to exit, so no
+	// renewal can race the release below.
+	stopHeartbeat := func() {}
+	var lost chan error // nil, never ready, without a heartbeat
+	if o.Acquire.TTL > 0 && !o.Inherited {
+		heartbeatCtx, cancelHeartbeat := context.WithCancel(context.Background())
+		var heartbeats sync.WaitGroup
+		lost = make(chan error, len(o.names()))
+		for _, name := range o.names() {
+			lockID := lockIDs[name]
+			heartbeats.Add(1)
+			go func() {
+				defer heartbeats.Done()
+				r.heartbeat(heartbeatCtx, name, lockID, lost)
+			}()
+		}
+		stopHeartbeat = func() {
+			cancelHeartbeat()
+			heartbeats.Wait()
+		}
+	}
+
+	// stopVerify likewise stops the VerifyInterval checks.
+	stopVerify := func() {}
+	var vanished chan map[string]error // nil, never ready, without periodic checks
+	if o.VerifyInterval > 0 && !o.Inherited {
+		verifyCtx, cancelVerify := context.WithCancel(context.Background())
+		var verifier sync.WaitGroup
+		vanished = make(chan map[string]error, 1)
+		verifier.Add(1)
+		go func() {
+			defer verifier.Done()
+			watchVanished(verifyCtx, o.RootDir, o.VerifyInterval, lockIDs, vanished)
+		}()
+		stopVerify = func() {
+			cancelVerify()
+			verifier.Wait()
+		}
+	}
+
+	// Ensure release on all paths, always after the heartbeat has drained.
+	// Locks found vanished are left alone: what is there now isn't ours.
+	released := o.Inherited
+	var gone map[string]error
+	release := func() {
+		if released {
+			return
+		}
+		released = true
+		stopVerify()
+		stopHeartbeat()
+		var errs []error
+		for _, name := range o.names() {
+			if gone[name] != nil {
+				continue
+			}
+			errs = append(errs, lock.Release(o.RootDir, name, lock.ReleaseOptions{Auditor: o.Acquire.Auditor, Shared: o.Acquire.Shared}))
+		}
+		err := errors.Join(errs...)
+		if r.hooks.OnRelease != nil {
+			r.hooks.OnRelease(err)
+		}
+	}
+	defer release()
+
+	sigCh := o.Signals
+	if sigCh == nil {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(ch)
+		sigCh = ch
+	}
+
+	argv := o.Command
+	if o.Shell {
+		argv = shellArgv(o.Command[0])
+	}
+	lockID := lockIDs[o.Name]
+	if o.Inherited {
+		lockID = heldLockID(o.RootDir, o.Name, o.Acquire.Shared)
+	}
+
+	var err error
+attempts:
+	for res.Attempts = 1; ; res.Attempts++ {
+		res.Stage = StageStart
+		res.ExitCode = 0
+		child := exec.Command(argv[0], argv[1:]...) //nolint:gosec // G204: running the user's command is the point
+		group := ownGroup(child, o.Stdin)
+		// An inherited hold's variables are already set
+		child.Env = o.Env
+		if !o.Inherited {
+			child.Env = lockEnv(o.Env, o.RootDir, o.Name, heldLock(o.RootDir, o.Name, o.Acquire.Shared))
+		}
+		child.Dir = o.Dir
+		child.Stdin = o.Stdin
+		var flushOutput func()
+		var piped bool
+		child.Stdout, child.Stderr, flushOutput, piped = o.childOutput()
+		if piped {
+			child.WaitDelay = outputWaitDelay
+		}
+		if err := child.Start(); err != nil {
+			return res, err
+		}
+		started := time.Now()
+		emitChildStart(o.Acquire.Auditor, o, lockID, argv, child.Process.Pid, res.Attempts)
+		if r.hooks.OnChildStart != nil {
+			r.hooks.OnChildStart(child.Process.Pid)
+		}
+
+		res.Stage = StageChild
+		done := make(chan error, 1)
+		go func() { done <- child.Wait() }()
+
+		var killedBy os.Signal // the signal that ended the child, forwarded or not
+		for exited := false; !exited; {
+			select {
+			case sig := <-sigCh:
+				forward(child, group, sig, o.KillTimeout, done, &res)
+				exited = true
+			case res.Lost = <-lost:
+				lost = nil
+				if o.OnLost == LostTerminate {
+					forward(child, group, syscall.SIGTERM, o.KillGrace, done, &res)
+					exited = true
+				}
+			case gone = <-vanished:
+				vanished = nil
+				res.Vanished = r.reportVanished(o.names(), lockIDs, gone)
+				if o.OnLost == LostTerminate {
+					forward(child, group, syscall.SIGTERM, o.KillGrace, done, &res)
+					exited = true
+				}
+			case err = <-done:
+				var exitErr *exec.ExitError
+				switch {
+				case err == nil:
+				case errors.As(err, &exitErr):
+					res.ExitCode = exitCode(exitErr)
+					killedBy = exitSignal(exitErr)
+					err = nil
+				case errors.Is(err, exec.ErrWaitDelay):
+					err = nil // exited 0, but left its output pipes open
+				default:
+					res.ExitCode = 1
+				}
+				exited = true
+			}
+		}
+		ran := time.Since(started)
+		flushOutput()
+		if res.Lost == nil && res.Vanished == nil && !o.Inherited {
+			// The child may have deleted the lock, or the whole root, on its
+			// way out
+			if gone = vanishedLocks(o.RootDir, lockIDs); len(gone) > 0 {
+				res.Vanished = r.reportVanished(o.names(), lockIDs, gone)
+			}
+		}
+		if res.Signal != nil {
+			killedBy = res.Signal
+		}
+		emitChildEnd(o.Acquire.Auditor, o, lockID, res, killedBy, ran, res.Attempts)
+		if err != nil || killedBy != nil || !o.retryable(res) {
+			break
+		}
+
+		if r.hooks.OnRetry != nil {
+			r.hooks.OnRetry(res.Attempts, res)
+		}
+		delay := time.NewTimer(o.RetryDelay)
+		select {
+		case sig := <-sigCh:
+			delay.Stop()
+			res.Signal, res.ExitCode = sig, signalExitCode(sig)
+			break attempts
+		case res.Lost = <-lost:
+			delay.Stop()
+			break attempts
+		case gone = <-vanished:
+			delay.Stop()
+			res.Vanished = r.reportVanished(o.names(), lockIDs, gone)
+			break attempts
+		case <-delay.C:
+		}
+	}
+	stopVerify()
+	if r.hooks.OnChildExit != nil {
+		r.hooks.OnChildExit(res)
+	}
+	if o.NoRelease && !o.Inherited && err == nil && res.ExitCode == 0 && res.Signal == nil && res.Lost == nil && res.Vanished == nil {
+		stopHeartbeat()
+		rerr := lock.Retain(o.RootDir, o.Name, lock.RenewOptions{Auditor: o.Acquire.Auditor})
+		if r.hooks.OnRetain != nil {
+			r.hooks.OnRetain(rerr)
+		}
+		// If it couldn't be kept, release as usual
+		res.Retained, released = rerr == nil, rerr == nil
+	}
+	release()
+	return res, err
+}
+
+// retryable reports whether an attempt that ended as res, neither killed
+// by a signal nor failing to run, is to be run again.
+func (o Options) retryable(res Result) bool {
+	return res.Attempts <= o.Retry && res.ExitCode != 0 && res.Lost == nil && res.Vanished == nil &&
+		!slices.Contains(o.NoRetryOn, res.ExitCode)
+}
+
+// names returns every lock the run holds: Name, then Also.
+func (o Options) names() []string {
+	return append([]string{o.Name}, o.Also...)
+}
+
+// shellArgv returns the argv that runs script through the user's shell:
+// $SHELL -c, or defaultShell if $SHELL is unset.
+func shellArgv(script string) []string {
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return []string{sh, "-c", script}
+	}
+	return append(slices.Clone(defaultShell), script)
+}
+
+// checkFreeze fails with a *lock.FrozenError if name is frozen, or with
+// WaitThaw waits for the freeze to lift, adding the wait to res and o.
+func (r *Runner) checkFreeze(ctx context.Context, name string, o *Options, res *Result) error {
+	err := lock.CheckFreeze(o.RootDir, name, o.Acquire.Auditor)
+	if err == nil {
+		return nil
+	}
+	var frozen *lock.FrozenError
+	if !errors.As(err, &frozen) || !o.WaitThaw {
+		return err
+	}
+	waited, err := lock.WaitForThaw(ctx, o.RootDir, name, lock.ThawOptions{
+		Auditor: o.Acquire.Auditor,
+		OnChange: func(fz *lockfile.Lock) {
+			if r.hooks.OnWaiting != nil {
+				r.hooks.OnWaiting(StageFreeze, fz)
+			}
+		},
+	})
+	res.ThawWait += waited
+	o.Acquire.ThawWait = res.ThawWait
+	return err
+}
+
+// forward sends sig to the child, or with group its whole process group,
+// and waits for it to exit, killing what is left if that takes longer than
+// a non-zero grace. The run ends with 128 + the signal number (standard
+// Unix convention).
+func forward(child *exec.Cmd, group bool, sig os.Signal, grace time.Duration, done <-chan error, res *Result) {
+	stopChild(child.Process, group, sig, grace, done)
+	res.Signal, res.ExitCode = sig, signalExitCode(sig)
+}
+
+// signalExitCode is the exit code of a run ended by sig: 128 + the signal
+// number, or 1 for a signal without one.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+// acquire takes the lock (and any in o.Also, or with o.Slots one of the
+// slots), polling if o.Wait is set, and returns the name it holds.
+func (r *Runner) acquire(ctx context.Context, o Options) (string, error) {
+	switch {
+	case len(o.Also) > 0:
+		_, err := lock.AcquireMany(ctx, o.RootDir, o.names(), r.onWait(o.Acquire), o.Wait)
+		return o.Name, err
+	case o.Slots > 0 && o.Wait:
+		return lock.AcquireSlotWithWait(ctx, o.RootDir, o.Name, o.Slots, r.onWait(o.Acquire))
+	case o.Slots > 0:
+		return lock.AcquireSlot(o.RootDir, o.Name, o.Slots, o.Acquire)
+	case o.Wait:
+		return o.Name, lock.AcquireWithWait(ctx, o.RootDir, o.Name, r.onWait(o.Acquire))
+	}
+	return o.Name, lock.Acquire(o.RootDir, o.Name, o.Acquire)
+}
+
+// onWait returns acq with OnWait, and OnFrozen, also reporting the wait
+// through the OnWaiting hook.
+func (r *Runner) onWait(acq lock.AcquireOptions) lock.AcquireOptions {
+	if r.hooks.OnWaiting != nil {
+		prev := acq.OnWait
+		acq.OnWait = func(denied *lock.HeldError) {
+			if prev != nil {
+				prev(denied)
+			}
+			r.hooks.OnWaiting(StageAcquire, denied.Lock)
+		}
+		prevFrozen := acq.OnFrozen
+		acq.OnFrozen = func(fz *lock.FrozenError) {
+			if prevFrozen != nil {
+				prevFrozen(fz)
+			}
+			r.hooks.OnWaiting(StageFreeze, fz.Lock)
+		}
+	}
+	return acq
+}
@@ -0,0 +1,1086 @@
+package guard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// fakeTicker replaces newTicker for the test and returns the channel that
+// drives it plus the interval the heartbeat asked for. The suspend probe
+// never fires unless the test also calls fakeProbe.
+func fakeTicker(t *testing.T) (chan time.Time, *time.Duration) {
+	t.Helper()
+	ch := make(chan time.Time)
+	var asked time.Duration
+	orig := newTicker
+	newTicker = func(d time.Duration) (<-chan time.Time, func()) {
+		asked = d
+		return ch, func() {}
+	}
+	t.Cleanup(func() { newTicker = orig })
+	fakeProbeChan(t, nil)
+	return ch, &asked
+}
+
+// fakeProbe replaces newProbe for the test and returns the channel that
+// drives it.
+func fakeProbe(t *testing.T) chan time.Time {
+	t.Helper()
+	ch := make(chan time.Time)
+	fakeProbeChan(t, ch)
+	return ch
+}
+
+func fakeProbeChan(t *testing.T, ch chan time.Time) {
+	orig := newProbe
+	newProbe = func() (<-chan time.Time, func()) { return ch, func() {} }
+	t.Cleanup(func() { newProbe = orig })
+}
+
+// fakeClock replaces now for the test; advance moves it forward.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func useFakeClock(t *testing.T) *fakeClock {
+	t.Helper()
+	c := &fakeClock{t: time.Now().Round(0)}
+	orig := now
+	now = func() time.Time {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.t
+	}
+	t.Cleanup(func() { now = orig })
+	return c
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// recorder collects hook calls in order.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, s)
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func (r *recorder) hooks() Hooks {
+	return Hooks{
+		OnWaiting:     func(stage Stage, _ *lockfile.Lock) { r.add("waiting:" + string(stage)) },
+		OnAcquired:    func() { r.add("acquired") },
+		OnRenew:       func() { r.add("renew") },
+		OnRenewFailed: func(error) { r.add("renew-failed") },
+		OnChildStart:  func(int) { r.add("child-start") },
+		OnChildExit:   func(Result) { r.add("child-exit") },
+		OnRelease:     func(error) { r.add("release") },
+		OnRetain:      func(error) { r.add("retain") },
+	}
+}
+
+func setupRoot(t *testing.T) string {
+	t.Helper()
+	rootDir := t.TempDir()
+	if err := root.EnsureDirs(rootDir); err != nil {
+		t.Fatal(err)
+	}
+	return rootDir
+}
+
+func writeHolder(t *testing.T, rootDir, name string) {
+	t.Helper()
+	if err := lockfile.Write(root.LockFilePath(rootDir, name), &lockfile.Lock{
+		Version: 1, Name: name, Owner: "other", Host: "other-host", PID: os.Getpid(), AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun_ChildExitCodeAndHookOrder(t *testing.T) {
+	rootDir := setupRoot(t)
+	rec := &recorder{}
+	var heldDuringChild bool
+	hooks := rec.hooks()
+	hooks.OnChildExit = func(res Result) {
+		_, err := os.Stat(root.LockFilePath(rootDir, "build"))
+		heldDuringChild = err == nil
+		rec.add("child-exit")
+	}
+
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"sh", "-c", "exit 3"},
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Stage != StageChild || res.ExitCode != 3 || res.Signal != nil {
+		t.Errorf("Run() = %+v, want child exit 3", res)
+	}
+	want := "acquired child-start child-exit release"
+	if got := strings.Join(rec.list(), " "); got != want {
+		t.Errorf("hooks = %q, want %q", got, want)
+	}
+	if !heldDuringChild {
+		t.Error("OnChildExit should run before the lock is released")
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "build")); !os.IsNotExist(err) {
+		t.Error("lock should be released after the run")
+	}
+}
+
+func TestRun_NoRelease(t *testing.T) {
+	rootDir := setupRoot(t)
+	rec := &recorder{}
+	opts := Options{
+		RootDir: rootDir, Name: "deploy", Command: []string{"true"}, NoRelease: true,
+		Acquire: lock.AcquireOptions{Auditor: audit.NewWriter(rootDir)},
+	}
+
+	res, err := New(opts, rec.hooks()).Run(context.Background())
+	if err != nil || !res.Retained {
+		t.Fatalf("Run() = %+v, %v; want lock retained", res, err)
+	}
+	if got, want := strings.Join(rec.list(), " "), "acquired child-start child-exit retain"; got != want {
+		t.Errorf("hooks = %q, want %q", got, want)
+	}
+	lf, err := lockfile.Read(root.LockFilePath(rootDir, "deploy"))
+	if err != nil || !lf.Retained {
+		t.Fatalf("lock after run = %+v, %v; want retained", lf, err)
+	}
+
+	// A failing command releases as usual.
+	opts.Command = []string{"sh", "-c", "exit 1"}
+	res, _ = New(opts, Hooks{}).Run(context.Background())
+	if res.Retained {
+		t.Error("Run(exit 1) retained the lock")
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "deploy")); !os.IsNotExist(err) {
+		t.Error("lock should be released after a failing command")
+	}
+}
+
+func TestRun_Held(t *testing.T) {
+	rootDir := setupRoot(t)
+	writeHolder(t, rootDir, "build")
+	rec := &recorder{}
+
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"true"},
+	}, rec.hooks()).Run(context.Background())
+	var held *lock.HeldError
+	if !errors.As(err, &held) || res.Stage != StageAcquire {
+		t.Fatalf("Run() = %+v, %v; want HeldError at acquire", res, err)
+	}
+	if got := rec.list(); len(got) != 0 {
+		t.Errorf("no hooks should fire when the lock is held, got %v", got)
+	}
+}
+
+func TestRun_IfFreeSkips(t *testing.T) {
+	rootDir := setupRoot(t)
+	writeHolder(t, rootDir, "build")
+	rec := &recorder{}
+
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"true"}, IfFree: true,
+	}, rec.hooks()).Run(context.Background())
+	if err != nil || res.Skipped == nil || res.Skipped.Lock.Owner != "other" {
+		t.Fatalf("Run() = %+v, %v; want skipped for other's lock", res, err)
+	}
+	if got := rec.list(); len(got) != 0 {
+		t.Errorf("no hooks should fire on a skip, got %v", got)
+	}
+
+	res, err = New(Options{
+		RootDir: rootDir, Name: "free", Command: []string{"true"}, IfFree: true,
+	}, rec.hooks()).Run(context.Background())
+	if err != nil || res.Skipped != nil || res.Stage != StageChild {
+		t.Errorf("Run(free) = %+v, %v; want the command run", res, err)
+	}
+}
+
+func TestRun_ChildEnv(t *testing.T) {
+	rootDir := setupRoot(t)
+	out := filepath.Join(t.TempDir(), "env")
+	var lf *lockfile.Lock
+	hooks := Hooks{OnChildStart: func(int) {
+		lf, _ = lockfile.Read(root.LockFilePath(rootDir, "build"))
+	}}
+
+	_, err := New(Options{
+		RootDir: rootDir, Name: "build", Acquire: lock.AcquireOptions{TTL: time.Minute},
+		Command: []string{"sh", "-c", `echo "$LOKT_GUARD_LOCK $LOKT_GUARD_LOCK_ID $LOKT_GUARD_TTL_SEC $LOKT_GUARD_ROOT" > "$0"`, out},
+		Env:     []string{EnvLockID + "=outer", "PATH=" + os.Getenv("PATH")},
+	}, hooks).Run(context.Background())
+	if err != nil || lf == nil {
+		t.Fatalf("Run() error = %v, lock = %v", err, lf)
+	}
+	got, _ := os.ReadFile(out)
+	if want := "build " + lf.LockID + " 60 " + rootDir + "\n"; string(got) != want {
+		t.Errorf("child saw %q, want %q", got, want)
+	}
+}
+
+func TestInherited(t *testing.T) {
+	rootDir := setupRoot(t)
+	if err := lockfile.Write(root.LockFilePath(rootDir, "build"), &lockfile.Lock{
+		Version: 1, Name: "build", LockID: "abc", Owner: "other", Host: "other-host", PID: os.Getpid(), AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvLock, "build")
+	t.Setenv(EnvLockID, "abc")
+
+	if !Inherited(rootDir, "build", false) {
+		t.Error("Inherited(build) = false, want true")
+	}
+	if Inherited(rootDir, "deploy", false) {
+		t.Error("Inherited(deploy) = true for another lock")
+	}
+	t.Setenv(EnvLockID, "replaced")
+	if Inherited(rootDir, "build", false) {
+		t.Error("Inherited(build) = true after the lock changed hands")
+	}
+}
+
+func TestRun_InheritedLeavesLockAlone(t *testing.T) {
+	rootDir := setupRoot(t)
+	writeHolder(t, rootDir, "build")
+	before, _ := os.ReadFile(root.LockFilePath(rootDir, "build"))
+	rec := &recorder{}
+
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"true"}, Inherited: true,
+		Acquire: lock.AcquireOptions{TTL: time.Minute},
+	}, rec.hooks()).Run(context.Background())
+	if err != nil || res.Stage != StageChild || res.ExitCode != 0 {
+		t.Fatalf("Run() = %+v, %v; want the command run", res, err)
+	}
+	if got, want := strings.Join(rec.list(), " "), "child-start child-exit"; got != want {
+		t.Errorf("hooks = %q, want %q", got, want)
+	}
+	after, err := os.ReadFile(root.LockFilePath(rootDir, "build"))
+	if err != nil || string(after) != string(before) {
+		t.Errorf("lock after run = %s, %v; want it untouched", after, err)
+	}
+}
+
+func TestRun_SeveralLocks(t *testing.T) {
+	rootDir := setupRoot(t)
+	var heldDuringChild int
+	hooks := Hooks{OnChildStart: func(int) {
+		for _, name := range []string{"db-migrate", "asset-upload"} {
+			if _, err := os.Stat(root.LockFilePath(rootDir, name)); err == nil {
+				heldDuringChild++
+			}
+		}
+	}}
+	opts := Options{
+		RootDir: rootDir, Name: "db-migrate", Also: []string{"asset-upload"}, Command: []string{"true"},
+		Acquire: lock.AcquireOptions{TTL: time.Minute},
+	}
+
+	if res, err := New(opts, hooks).Run(context.Background()); err != nil || res.Stage != StageChild {
+		t.Fatalf("Run() = %+v, %v; want the command run", res, err)
+	}
+	if heldDuringChild != 2 {
+		t.Errorf("%d of 2 locks held while the command ran", heldDuringChild)
+	}
+	for _, name := range []string{"db-migrate", "asset-upload"} {
+		if _, err := os.Stat(root.LockFilePath(rootDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s should be released after the run", name)
+		}
+	}
+
+	// One held lock stops the run and leaves none of ours behind.
+	writeHolder(t, rootDir, "asset-upload")
+	res, err := New(opts, Hooks{}).Run(context.Background())
+	var held *lock.HeldError
+	if !errors.As(err, &held) || held.Lock.Name != "asset-upload" || res.Stage != StageAcquire {
+		t.Fatalf("Run() = %+v, %v; want HeldError for asset-upload", res, err)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "db-migrate")); !os.IsNotExist(err) {
+		t.Error("db-migrate should not be held after a failed acquisition")
+	}
+}
+
+func TestRun_Slots(t *testing.T) {
+	rootDir := setupRoot(t)
+	if err := os.MkdirAll(filepath.Join(rootDir, "locks", "itest.slots"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	writeHolder(t, rootDir, lock.SlotName("itest", 0))
+	opts := Options{
+		RootDir: rootDir, Name: "itest", Slots: 2, Command: []string{"sh", "-c", "echo $" + EnvLock},
+		Acquire: lock.AcquireOptions{TTL: time.Minute},
+	}
+	var out bytes.Buffer
+	opts.Stdout = &out
+
+	res, err := New(opts, Hooks{}).Run(context.Background())
+	env := strings.TrimSpace(out.String())
+	if err != nil || res.Slot != lock.SlotName("itest", 1) || env != res.Slot {
+		t.Fatalf("Run() = %+v, %v (%s=%q); want slot 1", res, err, EnvLock, env)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, res.Slot)); !os.IsNotExist(err) {
+		t.Error("the slot should be released after the run")
+	}
+
+	// Both slots held: held, or skipped with IfFree
+	writeHolder(t, rootDir, lock.SlotName("itest", 1))
+	_, err = New(opts, Hooks{}).Run(context.Background())
+	var full *lock.SlotsFullError
+	if !errors.As(err, &full) {
+		t.Errorf("Run() with all slots held = %v, want SlotsFullError", err)
+	}
+	opts.IfFree = true
+	if res, err := New(opts, Hooks{}).Run(context.Background()); err != nil || res.Skipped == nil {
+		t.Errorf("Run(IfFree) = %+v, %v; want skipped", res, err)
+	}
+}
+
+func TestRun_WaitTimesOut(t *testing.T) {
+	rootDir := setupRoot(t)
+	writeHolder(t, rootDir, "build")
+	rec := &recorder{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"true"}, Wait: true,
+	}, rec.hooks()).Run(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || res.Stage != StageAcquire {
+		t.Fatalf("Run() = %+v, %v; want deadline at acquire", res, err)
+	}
+	if got := strings.Join(rec.list(), " "); got != "waiting:acquire" {
+		t.Errorf("hooks = %q, want a single waiting:acquire", got)
+	}
+}
+
+func TestRun_Frozen(t *testing.T) {
+	rootDir := setupRoot(t)
+	if err := lock.Freeze(rootDir, "build", lock.FreezeOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := New(Options{RootDir: rootDir, Name: "build", Command: []string{"true"}}, Hooks{}).Run(context.Background())
+	var frozen *lock.FrozenError
+	if !errors.As(err, &frozen) || res.Stage != StageFreeze {
+		t.Fatalf("Run() = %+v, %v; want FrozenError at freeze", res, err)
+	}
+
+	rec := &recorder{}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	res, err = New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"true"}, WaitThaw: true,
+	}, rec.hooks()).Run(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || res.Stage != StageFreeze {
+		t.Fatalf("Run(WaitThaw) = %+v, %v; want deadline at freeze", res, err)
+	}
+	if got := strings.Join(rec.list(), " "); got != "waiting:freeze" {
+		t.Errorf("hooks = %q, want waiting:freeze", got)
+	}
+}
+
+func TestRun_StartFailureReleases(t *testing.T) {
+	rootDir := setupRoot(t)
+	rec := &recorder{}
+
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{filepath.Join(rootDir, "no-such-command")},
+	}, rec.hooks()).Run(context.Background())
+	if err == nil || res.Stage != StageStart {
+		t.Fatalf("Run() = %+v, %v; want start failure", res, err)
+	}
+	if got := strings.Join(rec.list(), " "); got != "acquired release" {
+		t.Errorf("hooks = %q, want %q", got, "acquired release")
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "build")); !os.IsNotExist(err) {
+		t.Error("lock should be released when the child fails to start")
+	}
+}
+
+func TestRun_ForwardsSignal(t *testing.T) {
+	rootDir := setupRoot(t)
+	sigs := make(chan os.Signal, 1)
+	hooks := Hooks{OnChildStart: func(int) { sigs <- syscall.SIGTERM }}
+
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"sleep", "10"}, Signals: sigs,
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Signal != syscall.SIGTERM || res.ExitCode != 128+int(syscall.SIGTERM) {
+		t.Errorf("Run() = %+v, want SIGTERM with exit %d", res, 128+int(syscall.SIGTERM))
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "build")); !os.IsNotExist(err) {
+		t.Error("lock should be released after a forwarded signal")
+	}
+}
+
+func TestRun_Shell(t *testing.T) {
+	rootDir := setupRoot(t)
+	out := filepath.Join(t.TempDir(), "out")
+	t.Setenv("SHELL", "")
+
+	// Every part of the compound command runs, under the lock
+	script := `echo one > "` + out + `" && test -f "$LOKT_GUARD_ROOT/locks/build.json" && echo two | tr a-z A-Z >> "` + out + `"; exit 7`
+	res, err := New(Options{RootDir: rootDir, Name: "build", Command: []string{script}, Shell: true}, Hooks{}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.ExitCode != 7 {
+		t.Errorf("ExitCode = %d, want the shell's 7", res.ExitCode)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "one\nTWO\n" {
+		t.Errorf("output = %q, want both commands' output", data)
+	}
+
+	// A shell killed by a signal reports 128 + the signal, as shells do
+	res, err = New(Options{RootDir: rootDir, Name: "build", Command: []string{"kill -TERM $$"}, Shell: true}, Hooks{}).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.ExitCode != 128+int(syscall.SIGTERM) {
+		t.Errorf("ExitCode = %d, want %d", res.ExitCode, 128+int(syscall.SIGTERM))
+	}
+
+	if _, err := New(Options{RootDir: rootDir, Name: "build", Command: []string{"echo", "hi"}, Shell: true}, Hooks{}).Run(context.Background()); err == nil {
+		t.Error("Run() with a multi-word shell command should fail")
+	}
+}
+
+// signalOnPID returns a Signals channel and hooks that send sig once the
+// child has written a descendant's PID to pidFile.
+func signalOnPID(pidFile string, sig os.Signal) (chan os.Signal, Hooks) {
+	sigs := make(chan os.Signal, 1)
+	return sigs, Hooks{OnChildStart: func(int) {
+		for range 100 {
+			if data, _ := os.ReadFile(pidFile); strings.HasSuffix(string(data), "\n") {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		sigs <- sig
+	}}
+}
+
+// assertGone fails unless the process whose PID is in pidFile exits
+// within a few seconds, killing it if not.
+func assertGone(t *testing.T, pidFile string) {
+	t.Helper()
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pid int
+	if _, err := fmt.Sscan(string(data), &pid); err != nil {
+		t.Fatalf("pid file %q: %v", data, err)
+	}
+	job, _ := os.FindProcess(pid)
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Signal(syscall.Signal(0)) == nil {
+		if time.Now().After(deadline) {
+			_ = job.Kill()
+			t.Fatal("the command's descendant outlived the forwarded signal")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRun_ShellSignalStopsPipeline(t *testing.T) {
+	rootDir := setupRoot(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	sigs, hooks := signalOnPID(pidFile, syscall.SIGTERM)
+
+	script := `sleep 30 & echo $! > "` + pidFile + `"; wait`
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{script}, Shell: true, Signals: sigs,
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Signal != syscall.SIGTERM {
+		t.Errorf("Run() = %+v, want SIGTERM", res)
+	}
+	assertGone(t, pidFile)
+}
+
+func TestRun_SignalReachesDescendants(t *testing.T) {
+	rootDir := setupRoot(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	sigs, hooks := signalOnPID(pidFile, syscall.SIGTERM)
+
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Signals: sigs,
+		Command: []string{"sh", "-c", `sleep 30 & echo $! > "` + pidFile + `"; wait`},
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.ExitCode != 128+int(syscall.SIGTERM) {
+		t.Errorf("ExitCode = %d, want %d", res.ExitCode, 128+int(syscall.SIGTERM))
+	}
+	assertGone(t, pidFile)
+}
+
+func TestRun_KillTimeoutEscalates(t *testing.T) {
+	rootDir := setupRoot(t)
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	sigs, hooks := signalOnPID(pidFile, syscall.SIGTERM)
+
+	// The grandchild ignores SIGTERM, so only the SIGKILL stops it
+	script := `(trap '' TERM; exec sleep 30) & echo $! > "` + pidFile + `"; wait`
+	start := time.Now()
+	_, err := New(Options{
+		RootDir: rootDir, Name: "build", Signals: sigs, KillTimeout: 300 * time.Millisecond,
+		Command: []string{"sh", "-c", script},
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	assertGone(t, pidFile)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() took %v with a 300ms --kill-timeout", elapsed)
+	}
+}
+
+func TestHeartbeat_FakeClock(t *testing.T) {
+	ticks, asked := fakeTicker(t)
+	rootDir := setupRoot(t)
+	if err := lock.Acquire(rootDir, "build", lock.AcquireOptions{TTL: 10 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	renewed := make(chan string, 4)
+	r := New(Options{RootDir: rootDir, Name: "build", Acquire: lock.AcquireOptions{TTL: 10 * time.Second}}, Hooks{
+		OnRenew:       func() { renewed <- "ok" },
+		OnRenewFailed: func(error) { renewed <- "failed" },
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { defer close(done); r.heartbeat(ctx, r.opts.Name, "", make(chan error, 1)) }()
+
+	ticks <- time.Now()
+	if got := <-renewed; got != "ok" {
+		t.Errorf("first tick: %s, want ok", got)
+	}
+	if *asked != 5*time.Second {
+		t.Errorf("heartbeat interval = %v, want TTL/2", *asked)
+	}
+
+	// A lock that vanished underneath is reported, and the heartbeat keeps going.
+	if err := os.Remove(root.LockFilePath(rootDir, "build")); err != nil {
+		t.Fatal(err)
+	}
+	ticks <- time.Now()
+	if got := <-renewed; got != "failed" {
+		t.Errorf("tick after removal: %s, want failed", got)
+	}
+	ticks <- time.Now()
+	if got := <-renewed; got != "failed" {
+		t.Errorf("heartbeat should survive a failure, got %s", got)
+	}
+
+	cancel()
+	<-done
+	select {
+	case got := <-renewed:
+		t.Errorf("no hook should fire after shutdown, got %s", got)
+	default:
+	}
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	tests := []struct{ ttl, want time.Duration }{
+		{10 * time.Second, 5 * time.Second},
+		{time.Second, minHeartbeatInterval},
+		{100 * time.Millisecond, minHeartbeatInterval},
+	}
+	for _, tt := range tests {
+		if got := HeartbeatInterval(tt.ttl); got != tt.want {
+			t.Errorf("HeartbeatInterval(%v) = %v, want %v", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+// takeOver replaces the lock with another host's acquisition, as after the
+// lock expired during a suspend and someone else acquired it.
+func takeOver(t *testing.T, rootDir, name string) {
+	t.Helper()
+	if err := lockfile.Write(root.LockFilePath(rootDir, name), &lockfile.Lock{
+		Version: 1, Name: name, LockID: "their-id", Owner: "other", Host: "other-host",
+		PID: 4242, AcquiredAt: time.Now(), TTLSec: 60,
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeartbeat_ClockGapLost(t *testing.T) {
+	ticks, _ := fakeTicker(t)
+	clock := useFakeClock(t)
+	rootDir := setupRoot(t)
+	if err := lock.Acquire(rootDir, "build", lock.AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	hooks := rec.hooks()
+	var gapSeen time.Duration
+	renewed := make(chan struct{}, 1)
+	hooks.OnRenew = func() { rec.add("renew"); renewed <- struct{}{} }
+	hooks.OnClockGap = func(gap time.Duration) { gapSeen = gap; rec.add("gap") }
+	hooks.OnLost = func(error) { rec.add("lost") }
+	r := New(Options{RootDir: rootDir, Name: "build", Acquire: lock.AcquireOptions{
+		TTL: time.Minute, Auditor: audit.NewWriter(rootDir),
+	}}, hooks)
+	lost := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.heartbeat(context.Background(), r.opts.Name, heldLockID(rootDir, "build", false), lost)
+	}()
+
+	clock.advance(30 * time.Second)
+	ticks <- time.Now()
+	<-renewed
+	// Suspended for 40 minutes; someone else took the expired lock.
+	clock.advance(40 * time.Minute)
+	takeOver(t, rootDir, "build")
+	ticks <- time.Now()
+
+	if err := <-lost; !errors.Is(err, lock.ErrLockStolen) {
+		t.Errorf("lost = %v, want ErrLockStolen", err)
+	}
+	<-done // the heartbeat stops once the lock is lost
+	if gapSeen != 40*time.Minute {
+		t.Errorf("gap = %v, want 40m", gapSeen)
+	}
+	if got := strings.Join(rec.list(), " "); got != "renew gap lost" {
+		t.Errorf("hooks = %q, want %q", got, "renew gap lost")
+	}
+	lf, err := lockfile.Read(root.LockFilePath(rootDir, "build"))
+	if err != nil || lf.LockID != "their-id" {
+		t.Errorf("the new holder's lock must not be overwritten: %+v, %v", lf, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootDir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"event":"clock-gap-detected"`) || !strings.Contains(string(data), `"gap_sec":2400`) {
+		t.Errorf("expected a clock-gap-detected event with the gap, audit log:\n%s", data)
+	}
+	if !strings.Contains(string(data), `"event":"lock-lost-after-suspend"`) || strings.Contains(string(data), `"event":"lock-lost"`) {
+		t.Errorf("expected a lock-lost-after-suspend event, audit log:\n%s", data)
+	}
+}
+
+func TestHeartbeat_SuspendProbe(t *testing.T) {
+	fakeTicker(t)
+	probes := fakeProbe(t)
+	clock := useFakeClock(t)
+	rootDir := setupRoot(t)
+	if err := lock.Acquire(rootDir, "build", lock.AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	hooks := rec.hooks()
+	renewed := make(chan struct{}, 1)
+	hooks.OnRenew = func() { rec.add("renew"); renewed <- struct{}{} }
+	hooks.OnClockGap = func(time.Duration) { rec.add("gap") }
+	hooks.OnLost = func(error) { rec.add("lost") }
+	r := New(Options{RootDir: rootDir, Name: "build", Acquire: lock.AcquireOptions{
+		TTL: time.Minute, Auditor: audit.NewWriter(rootDir),
+	}}, hooks)
+	lost := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.heartbeat(context.Background(), r.opts.Name, heldLockID(rootDir, "build", false), lost)
+	}()
+
+	// A probe a second after the last one: nothing to do.
+	clock.advance(time.Second)
+	probes <- time.Now()
+	// 45s between probes is more than the 30s interval: renew at once,
+	// without waiting for a tick.
+	clock.advance(45 * time.Second)
+	probes <- time.Now()
+	<-renewed
+	// Suspended for 10 minutes; someone else took the expired lock.
+	clock.advance(10 * time.Minute)
+	takeOver(t, rootDir, "build")
+	probes <- time.Now()
+
+	if err := <-lost; !errors.Is(err, lock.ErrLockStolen) {
+		t.Errorf("lost = %v, want ErrLockStolen", err)
+	}
+	<-done
+	if got := strings.Join(rec.list(), " "); got != "gap renew gap lost" {
+		t.Errorf("hooks = %q, want %q", got, "gap renew gap lost")
+	}
+	data, err := os.ReadFile(filepath.Join(rootDir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"event":"lock-lost-after-suspend"`) || !strings.Contains(string(data), `"gap_sec":600`) {
+		t.Errorf("expected a lock-lost-after-suspend event with the gap, audit log:\n%s", data)
+	}
+}
+
+func TestHeartbeat_ClockGapStillHeld(t *testing.T) {
+	ticks, _ := fakeTicker(t)
+	clock := useFakeClock(t)
+	rootDir := setupRoot(t)
+	if err := lock.Acquire(rootDir, "build", lock.AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	hooks := rec.hooks()
+	renewed := make(chan struct{}, 1)
+	hooks.OnRenew = func() { rec.add("renew"); renewed <- struct{}{} }
+	hooks.OnClockGap = func(time.Duration) { rec.add("gap") }
+	hooks.OnLost = func(error) { rec.add("lost") }
+	r := New(Options{RootDir: rootDir, Name: "build", Acquire: lock.AcquireOptions{TTL: time.Minute},
+		MaxRenewGap: 5 * time.Minute}, hooks)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.heartbeat(ctx, r.opts.Name, heldLockID(rootDir, "build", false), make(chan error, 1))
+	}()
+
+	// Longer than the TTL but within MaxRenewGap: no check.
+	clock.advance(2 * time.Minute)
+	ticks <- time.Now()
+	<-renewed
+	// Past MaxRenewGap, but nobody took the lock: verify, then keep renewing.
+	clock.advance(10 * time.Minute)
+	ticks <- time.Now()
+	<-renewed
+	cancel()
+	<-done
+
+	if got := strings.Join(rec.list(), " "); got != "renew gap renew" {
+		t.Errorf("hooks = %q, want %q", got, "renew gap renew")
+	}
+}
+
+func TestRun_LostTerminatesChild(t *testing.T) {
+	ticks, _ := fakeTicker(t)
+	clock := useFakeClock(t)
+	rootDir := setupRoot(t)
+
+	hooks := Hooks{OnChildStart: func(int) {
+		go func() {
+			clock.advance(time.Hour)
+			takeOver(t, rootDir, "build")
+			ticks <- time.Now()
+		}()
+	}}
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"sleep", "10"},
+		Acquire: lock.AcquireOptions{TTL: time.Minute}, OnLost: LostTerminate,
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !errors.Is(res.Lost, lock.ErrLockStolen) || res.Signal != syscall.SIGTERM {
+		t.Errorf("Run() = %+v, want lost and SIGTERM", res)
+	}
+	// Release must not remove the new holder's lock.
+	lf, err := lockfile.Read(root.LockFilePath(rootDir, "build"))
+	if err != nil || lf.LockID != "their-id" {
+		t.Errorf("the new holder's lock must survive the release: %+v, %v", lf, err)
+	}
+}
+
+func TestRun_StrictTTLForceReleased(t *testing.T) {
+	ticks, _ := fakeTicker(t)
+	rootDir := setupRoot(t)
+
+	hooks := Hooks{OnChildStart: func(int) {
+		go func() {
+			if err := lock.Release(rootDir, "build", lock.ReleaseOptions{Force: true}); err != nil {
+				t.Error(err)
+			}
+			ticks <- time.Now()
+		}()
+	}}
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"sleep", "10"},
+		Acquire:   lock.AcquireOptions{TTL: time.Minute, Auditor: audit.NewWriter(rootDir)},
+		StrictTTL: true, OnLost: LostTerminate, KillGrace: time.Second,
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !errors.Is(res.Lost, lock.ErrLockLost) || res.Signal != syscall.SIGTERM {
+		t.Errorf("Run() = %+v, want lost and SIGTERM", res)
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootDir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"event":"lock-lost"`) || !strings.Contains(string(data), `"action":"terminate"`) {
+		t.Errorf("expected a lock-lost event, audit log:\n%s", data)
+	}
+}
+
+func TestRun_VanishedBeforeRelease(t *testing.T) {
+	rootDir := setupRoot(t)
+	var vanished error
+	hooks := Hooks{OnVanished: func(err error) { vanished = err }}
+
+	// The command cleans up the way git clean -xfd would
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"rm", "-rf", root.LocksPath(rootDir)},
+		Acquire: lock.AcquireOptions{Auditor: audit.NewWriter(rootDir)},
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !errors.Is(res.Vanished, lock.ErrLockLost) || res.ExitCode != 0 {
+		t.Errorf("Run() = %+v, want the lock reported vanished", res)
+	}
+	if !errors.Is(vanished, lock.ErrLockLost) {
+		t.Errorf("OnVanished got %v", vanished)
+	}
+	data, err := os.ReadFile(filepath.Join(rootDir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"event":"lock-vanished"`) {
+		t.Errorf("expected a lock-vanished event, audit log:\n%s", data)
+	}
+}
+
+func TestRun_VerifyIntervalTerminates(t *testing.T) {
+	ticks, asked := fakeTicker(t)
+	rootDir := setupRoot(t)
+
+	hooks := Hooks{OnChildStart: func(int) {
+		go func() {
+			takeOver(t, rootDir, "build")
+			ticks <- time.Now()
+		}()
+	}}
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"sleep", "10"},
+		VerifyInterval: 5 * time.Second, OnLost: LostTerminate, KillGrace: time.Second,
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if *asked != 5*time.Second {
+		t.Errorf("verify interval = %v, want 5s", *asked)
+	}
+	if !errors.Is(res.Vanished, lock.ErrLockStolen) || res.Signal != syscall.SIGTERM {
+		t.Errorf("Run() = %+v, want vanished and SIGTERM", res)
+	}
+	lf, err := lockfile.Read(root.LockFilePath(rootDir, "build"))
+	if err != nil || lf.LockID != "their-id" {
+		t.Errorf("the new holder's lock must survive the release: %+v, %v", lf, err)
+	}
+}
+
+func TestHeartbeat_StrictTTLRepeatedFailures(t *testing.T) {
+	ticks, _ := fakeTicker(t)
+	rootDir := setupRoot(t)
+	if err := lock.Acquire(rootDir, "build", lock.AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	// Unreadable, but not gone: renewals fail without proving the lock lost.
+	if err := os.WriteFile(root.LockFilePath(rootDir, "build"), []byte("{{{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &recorder{}
+	hooks := rec.hooks()
+	hooks.OnLost = func(error) { rec.add("lost") }
+	r := New(Options{RootDir: rootDir, Name: "build", Acquire: lock.AcquireOptions{TTL: time.Minute},
+		StrictTTL: true}, hooks)
+	lost := make(chan error, 1)
+	done := make(chan struct{})
+	go func() { defer close(done); r.heartbeat(context.Background(), r.opts.Name, "", lost) }()
+
+	for range strictRenewFailures {
+		ticks <- time.Now()
+	}
+	if err := <-lost; !errors.Is(err, lock.ErrLockLost) {
+		t.Errorf("lost = %v, want ErrLockLost", err)
+	}
+	<-done
+	if got := strings.Join(rec.list(), " "); got != "renew-failed renew-failed renew-failed lost" {
+		t.Errorf("hooks = %q", got)
+	}
+}
+
+func TestRun_TagOutput(t *testing.T) {
+	rootDir := setupRoot(t)
+	orig := outputWaitDelay
+	outputWaitDelay = 200 * time.Millisecond
+	t.Cleanup(func() { outputWaitDelay = orig })
+
+	var stdout, stderr, log bytes.Buffer
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build",
+		Command: []string{"sh", "-c", `printf 'one\ntwo'; echo oops >&2; exit 4`},
+		Stdout:  &stdout, Stderr: &stderr, TagOutput: true, OutputLog: &log,
+	}, Hooks{}).Run(context.Background())
+	if err != nil || res.ExitCode != 4 {
+		t.Fatalf("Run() = %+v, %v; want exit 4", res, err)
+	}
+	if got, want := stdout.String(), "[build] one\n[build] two\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if got, want := stderr.String(), "[build] oops\n"; got != want {
+		t.Errorf("stderr = %q, want %q", got, want)
+	}
+	if got := log.String(); !strings.Contains(got, "one\ntwo") || !strings.Contains(got, "oops\n") || strings.Contains(got, "[build]") {
+		t.Errorf("log = %q, want the raw output", got)
+	}
+
+	// A background process holding the pipes doesn't keep the lock.
+	start := time.Now()
+	res, err = New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"sh", "-c", "sleep 5 & echo started"},
+		Stdout: &stdout, TagOutput: true,
+	}, Hooks{}).Run(context.Background())
+	if err != nil || res.ExitCode != 0 {
+		t.Errorf("Run() = %+v, %v; want exit 0", res, err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("Run took %s: waited for the background process's pipes", time.Since(start))
+	}
+}
+
+func TestRun_Retry(t *testing.T) {
+	rootDir := setupRoot(t)
+	count := filepath.Join(t.TempDir(), "count")
+	rec := &recorder{}
+	hooks := rec.hooks()
+	hooks.OnRetry = func(attempt int, res Result) { rec.add(fmt.Sprintf("retry:%d:%d", attempt, res.ExitCode)) }
+
+	// Fails twice, then succeeds
+	script := `n=$(($(cat ` + count + ` 2>/dev/null || echo 0) + 1)); echo $n > ` + count + `; [ $n -ge 3 ] || exit 7`
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{script}, Shell: true,
+		Acquire: lock.AcquireOptions{Auditor: audit.NewWriter(rootDir)},
+		Retry:   3, RetryDelay: time.Millisecond,
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Attempts != 3 || res.ExitCode != 0 {
+		t.Errorf("Run() = %+v, want success on attempt 3", res)
+	}
+	want := "acquired child-start retry:1:7 child-start retry:2:7 child-start child-exit release"
+	if got := strings.Join(rec.list(), " "); got != want {
+		t.Errorf("hooks = %q, want %q", got, want)
+	}
+
+	// One hold, each attempt audited under it
+	var events []string
+	lockIDs := map[string]bool{}
+	_ = audit.ScanFile(audit.Path(rootDir), func(e *audit.Event, _ []byte) bool {
+		ev := e.Event
+		if a, ok := e.Extra["attempt"]; ok {
+			ev += fmt.Sprint(":", a)
+		}
+		events = append(events, ev)
+		lockIDs[e.LockID] = true
+		return true
+	})
+	want = "acquire guard-start:1 guard-end:1 guard-start:2 guard-end:2 guard-start:3 guard-end:3 release"
+	if got := strings.Join(events, " "); got != want || len(lockIDs) != 1 {
+		t.Errorf("events = %q under %d lock IDs, want %q under one", got, len(lockIDs), want)
+	}
+}
+
+func TestRun_RetryStops(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		script    string
+		noRetryOn []int
+		attempts  int
+		exit      int
+	}{
+		{"retries exhausted", "exit 7", nil, 3, 7},
+		{"no-retry-on", "exit 7", []int{4, 7}, 1, 7},
+		{"signal-killed", "kill -KILL $$", nil, 1, 128 + int(syscall.SIGKILL)},
+		{"success", "true", nil, 1, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := New(Options{
+				RootDir: setupRoot(t), Name: "build", Command: []string{tc.script}, Shell: true,
+				Retry: 2, NoRetryOn: tc.noRetryOn,
+			}, Hooks{}).Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if res.Attempts != tc.attempts || res.ExitCode != tc.exit {
+				t.Errorf("Run() = %d attempts, exit %d; want %d, %d", res.Attempts, res.ExitCode, tc.attempts, tc.exit)
+			}
+		})
+	}
+}
+
+func TestRun_SignalDuringRetryDelay(t *testing.T) {
+	rootDir := setupRoot(t)
+	sigs := make(chan os.Signal, 1)
+	hooks := Hooks{OnRetry: func(int, Result) { sigs <- syscall.SIGINT }}
+
+	start := time.Now()
+	res, err := New(Options{
+		RootDir: rootDir, Name: "build", Command: []string{"false"}, Signals: sigs,
+		Retry: 3, RetryDelay: time.Minute,
+	}, hooks).Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if waited := time.Since(start); waited > 10*time.Second {
+		t.Errorf("Run() took %s; a signal should cut the retry delay short", waited)
+	}
+	if res.Attempts != 1 || res.Signal != syscall.SIGINT || res.ExitCode != 128+int(syscall.SIGINT) {
+		t.Errorf("Run() = %+v, want SIGINT after attempt 1", res)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "build")); !os.IsNotExist(err) {
+		t.Error("lock should be released after a signal during the retry delay")
+	}
+}
@@ -0,0 +1,263 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// minHeartbeatInterval keeps very short TTLs from renewing in a tight loop.
+const minHeartbeatInterval = 500 * time.Millisecond
+
+// newTicker returns a tick channel and its stop function. Injectable for
+// testing.
+var newTicker = func(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// suspendProbeInterval is how often the heartbeat reads the wall clock
+// between ticks. Tickers run on the monotonic clock, which stops while a
+// host is suspended, so the first tick after a resume can be a whole
+// interval late; the probe sees the jump within a second.
+const suspendProbeInterval = time.Second
+
+// newProbe returns the suspend probe's channel and its stop function.
+// Injectable for testing.
+var newProbe = func() (<-chan time.Time, func()) {
+	t := time.NewTicker(suspendProbeInterval)
+	return t.C, t.Stop
+}
+
+// now reads the wall clock with the monotonic reading stripped: the
+// monotonic clock stops while a host is suspended, which is exactly the gap
+// the heartbeat needs to see. Injectable for testing.
+var now = func() time.Time { return time.Now().Round(0) }
+
+// HeartbeatInterval is how often a lock with ttl is renewed: TTL/2, so a
+// single missed renewal doesn't let it expire, but at least
+// minHeartbeatInterval.
+func HeartbeatInterval(ttl time.Duration) time.Duration {
+	return max(ttl/2, minHeartbeatInterval)
+}
+
+// strictRenewFailures is how many renewals in a row may fail under
+// Options.StrictTTL before the lock counts as lost.
+const strictRenewFailures = 3
+
+// heartbeat renews the lock on name on every tick until ctx is done. Failures are
+// reported through OnRenewFailed but don't stop it: the child may still
+// finish before the lock expires. With StrictTTL they do: a renewal that
+// finds the lock gone or taken over, or strictRenewFailures failures in a
+// row, lose the lock.
+//
+// If a tick arrives more than MaxRenewGap after the last successful renewal
+// (a suspended laptop, a stopped VM), the lock may have expired and been
+// taken over in the meantime, so ownership of lockID is verified before
+// renewing. The same happens at once, without waiting for the tick, when
+// the wall clock jumps by more than an interval between two probes: the
+// host resumed, or the guard was continued after a SIGSTOP. A lost lock is
+// sent on lost and ends the heartbeat: renewing would overwrite the new
+// holder.
+func (r *Runner) heartbeat(ctx context.Context, name, lockID string, lost chan<- error) {
+	interval := HeartbeatInterval(r.opts.Acquire.TTL)
+	ticks, stop := newTicker(interval)
+	defer stop()
+	probes, stopProbe := newProbe()
+	defer stopProbe()
+
+	maxGap := r.opts.MaxRenewGap
+	if maxGap <= 0 {
+		maxGap = r.opts.Acquire.TTL
+	}
+	renewOpts := lock.RenewOptions{Auditor: r.opts.Acquire.Auditor, Shared: r.opts.Acquire.Shared}
+	lastRenew := now()
+	lastProbe := lastRenew
+	failures := 0
+
+	for {
+		var gap time.Duration // time without renewals to verify ownership after
+		select {
+		case <-ctx.Done():
+			return
+		case <-probes:
+			t := now()
+			jump := t.Sub(lastProbe)
+			lastProbe = t
+			if jump <= interval+suspendProbeInterval {
+				continue
+			}
+			gap = max(t.Sub(lastRenew), jump)
+		case <-ticks:
+			if g := now().Sub(lastRenew); g > maxGap {
+				gap = g
+			}
+		}
+		// A tick can be selected even though shutdown has begun; the lock
+		// may already be gone, so don't renew or warn.
+		if ctx.Err() != nil {
+			return
+		}
+		if gap > 0 {
+			if r.hooks.OnClockGap != nil {
+				r.hooks.OnClockGap(gap)
+			}
+			err := lock.CheckAfterGap(r.opts.RootDir, name, lockID, gap, renewOpts)
+			if errors.Is(err, lock.ErrLockStolen) || errors.Is(err, lock.ErrLockLost) {
+				r.lose(name, lockID, err, gap, renewOpts, lost)
+				return
+			}
+		}
+		err := lock.Renew(r.opts.RootDir, name, renewOpts)
+		if ctx.Err() != nil {
+			return // Shutting down; a failure is expected
+		}
+		switch {
+		case err != nil && r.hooks.OnRenewFailed != nil:
+			r.hooks.OnRenewFailed(err)
+		case err == nil:
+			lastRenew = now()
+			if r.hooks.OnRenew != nil {
+				r.hooks.OnRenew()
+			}
+		}
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		if lostErr := r.strictLost(name, err, failures); lostErr != nil {
+			r.lose(name, lockID, lostErr, 0, renewOpts, lost)
+			return
+		}
+	}
+}
+
+// strictLost returns the error that loses the lock on name under StrictTTL
+// after failures renewals in a row have failed, the last with err, or nil
+// to keep going.
+func (r *Runner) strictLost(name string, err error, failures int) error {
+	switch {
+	case !r.opts.StrictTTL:
+		return nil
+	case errors.Is(err, lock.ErrLockStolen) || errors.Is(err, lock.ErrLockLost):
+		return err
+	case errors.Is(err, lock.ErrNotFound):
+		return fmt.Errorf("%w: %w", lock.ErrLockLost, err)
+	case failures >= strictRenewFailures:
+		return fmt.Errorf("%w: %d renewals in a row failed, last: %v", lock.ErrLockLost, failures, err)
+	}
+	return nil
+}
+
+// lose reports the lock on name lost for err: a lock-lost audit event (or
+// lock-lost-after-suspend, if it was found lost after gap without
+// renewals), OnLost, and err on lost.
+func (r *Runner) lose(name, lockID string, err error, gap time.Duration, renewOpts lock.RenewOptions, lost chan<- error) {
+	policy := r.opts.OnLost
+	if policy == "" {
+		policy = LostWarn
+	}
+	if gap > 0 {
+		lock.ReportLostAfterSuspend(name, lockID, err, string(policy), gap, renewOpts)
+	} else {
+		lock.ReportLost(name, lockID, err, string(policy), renewOpts)
+	}
+	if r.hooks.OnLost != nil {
+		r.hooks.OnLost(err)
+	}
+	lost <- err
+}
+
+// heldLockID returns the lock_id of the lock (or shared hold) just acquired,
+// or "" if it can't be read (verification then falls back to owner, host
+// and pid).
+func heldLockID(rootDir, name string, shared bool) string {
+	if lf := heldLock(rootDir, name, shared); lf != nil {
+		return lf.LockID
+	}
+	return ""
+}
+
+// heldLock returns the lock (or this process's shared hold) on name, or nil
+// if it can't be read.
+func heldLock(rootDir, name string, shared bool) *lockfile.Lock {
+	dir, err := root.Follow(rootDir)
+	if err != nil {
+		return nil
+	}
+	if shared {
+		id := identity.Current()
+		for _, h := range lock.SharedHolders(dir, name) {
+			if h.Owner == id.Owner && h.Host == id.Host && h.PID == id.PID {
+				return h
+			}
+		}
+		return nil
+	}
+	lf, err := lockfile.Read(root.LockFilePath(dir, name))
+	if err != nil {
+		return nil
+	}
+	return lf
+}
+
+// vanishedLocks checks each lock in lockIDs (name to lock_id) against its
+// acquisition (lock.Verify) and returns those whose file is gone or now
+// belongs to another acquisition, with why. Other errors (an unreadable
+// file) are left to the release to report.
+func vanishedLocks(rootDir string, lockIDs map[string]string) map[string]error {
+	var gone map[string]error
+	for name, lockID := range lockIDs {
+		err := lock.Verify(rootDir, name, lockID)
+		if errors.Is(err, lock.ErrLockLost) || errors.Is(err, lock.ErrLockStolen) {
+			if gone == nil {
+				gone = map[string]error{}
+			}
+			gone[name] = err
+		}
+	}
+	return gone
+}
+
+// watchVanished runs vanishedLocks every interval until ctx is done or it
+// finds a lock gone, which it sends on vanished.
+func watchVanished(ctx context.Context, rootDir string, interval time.Duration, lockIDs map[string]string, vanished chan<- map[string]error) {
+	ticks, stop := newTicker(interval)
+	defer stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+			if gone := vanishedLocks(rootDir, lockIDs); len(gone) > 0 && ctx.Err() == nil {
+				vanished <- gone
+				return
+			}
+		}
+	}
+}
+
+// reportVanished logs a lock-vanished event for each of names in gone,
+// calls OnVanished, and returns the errors joined.
+func (r *Runner) reportVanished(names []string, lockIDs map[string]string, gone map[string]error) error {
+	opts := lock.RenewOptions{Auditor: r.opts.Acquire.Auditor}
+	var errs []error
+	for _, name := range names {
+		if err := gone[name]; err != nil {
+			lock.ReportVanished(name, lockIDs[name], err, opts)
+			errs = append(errs, err)
+		}
+	}
+	err := errors.Join(errs...)
+	if r.hooks.OnVanished != nil {
+		r.hooks.OnVanished(err)
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package guard
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// MaxTaggedLine is the longest line LineWriter buffers: a longer one is
+// written in pieces, tagged only before the first, so output without
+// newlines can't grow the buffer without bound.
+const MaxTaggedLine = 64 << 10
+
+// outputWaitDelay is how long the run waits, once the child has exited, for
+// its output pipes to close. A process the child left running in the
+// background may keep them open; after this the pipes are closed on it
+// rather than keeping the lock until it exits. Injectable for testing.
+var outputWaitDelay = 5 * time.Second
+
+// LineWriter writes each line written to it, prefixed, to another writer in
+// a single Write, so lines from several LineWriters on one terminal don't
+// interleave mid-line. A partial line is held until its newline arrives,
+// it reaches MaxTaggedLine, or Flush. It is not safe for concurrent use.
+type LineWriter struct {
+	w       io.Writer
+	prefix  []byte
+	buf     []byte
+	midLine bool // the start of the current line has been written
+}
+
+// NewLineWriter returns a LineWriter prefixing lines with prefix.
+func NewLineWriter(w io.Writer, prefix string) *LineWriter {
+	return &LineWriter{w: w, prefix: []byte(prefix)}
+}
+
+// Write implements io.Writer. It reports len(p) written unless writing a
+// complete line fails.
+func (l *LineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			l.buf = append(l.buf, p...)
+			if len(l.buf) >= MaxTaggedLine {
+				if err := l.emit(l.buf); err != nil {
+					return n - len(p), err
+				}
+				l.buf, l.midLine = l.buf[:0], true
+			}
+			break
+		}
+		line := p[:i+1]
+		if len(l.buf) > 0 {
+			line = append(l.buf, line...)
+		}
+		if err := l.emit(line); err != nil {
+			return n - len(p), err
+		}
+		p = p[i+1:]
+		l.buf, l.midLine = l.buf[:0], false
+	}
+	return n, nil
+}
+
+// Flush writes a pending partial line, ending it with a newline.
+func (l *LineWriter) Flush() error {
+	if len(l.buf) == 0 && !l.midLine {
+		return nil
+	}
+	err := l.emit(append(l.buf, '\n'))
+	l.buf, l.midLine = l.buf[:0], false
+	return err
+}
+
+// emit writes b, after the prefix unless it continues a line already
+// started.
+func (l *LineWriter) emit(b []byte) error {
+	if !l.midLine {
+		b = append(append(make([]byte, 0, len(l.prefix)+len(b)), l.prefix...), b...)
+	}
+	_, err := l.w.Write(b)
+	return err
+}
+
+// syncWriter serializes writes to w from the child's two output streams.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// childOutput returns the child's stdout and stderr per TagOutput and
+// OutputLog, and a flush for after it exits; piped is false if they are
+// Stdout and Stderr as given, so a file (a terminal) is inherited as is.
+// Otherwise exec.Cmd copies the child's output through pipes.
+func (o Options) childOutput() (stdout, stderr io.Writer, flush func(), piped bool) {
+	if !o.TagOutput && o.OutputLog == nil {
+		return o.Stdout, o.Stderr, func() {}, false
+	}
+	var log io.Writer
+	if o.OutputLog != nil {
+		log = &syncWriter{w: o.OutputLog}
+	}
+	var tagged []*LineWriter
+	wrap := func(w io.Writer) io.Writer {
+		if w != nil && o.TagOutput {
+			lw := NewLineWriter(w, "["+o.Name+"] ")
+			tagged = append(tagged, lw)
+			w = lw
+		}
+		switch {
+		case log == nil:
+			return w
+		case w == nil:
+			return log
+		}
+		return io.MultiWriter(w, log)
+	}
+	stdout, stderr = wrap(o.Stdout), wrap(o.Stderr)
+	return stdout, stderr, func() {
+		for _, lw := range tagged {
+			_ = lw.Flush()
+		}
+	}, true
+}
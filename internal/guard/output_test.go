@@ -0,0 +1,51 @@
+package guard
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	var buf bytes.Buffer
+	lw := NewLineWriter(&buf, "[x] ")
+
+	// Lines split across writes are tagged once; a partial line waits.
+	for _, s := range []string{"one\ntw", "o\n", "\nthr", "ee"} {
+		if n, err := lw.Write([]byte(s)); n != len(s) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if got, want := buf.String(), "[x] one\n[x] two\n[x] \n"; got != want {
+		t.Errorf("before Flush: %q, want %q", got, want)
+	}
+	if err := lw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "[x] one\n[x] two\n[x] \n[x] three\n"; got != want {
+		t.Errorf("after Flush: %q, want %q", got, want)
+	}
+	if err := lw.Flush(); err != nil || strings.Count(buf.String(), "\n") != 4 {
+		t.Errorf("second Flush wrote %q (%v), want nothing", buf.String(), err)
+	}
+
+	// A line past MaxTaggedLine goes out in pieces, tagged only once.
+	buf.Reset()
+	long := strings.Repeat("a", MaxTaggedLine+10)
+	_, _ = lw.Write([]byte(long))
+	if buf.Len() != len("[x] ")+len(long) {
+		t.Errorf("long line: %d bytes written before its newline, want all of it", buf.Len())
+	}
+	_, _ = lw.Write([]byte("b\nc\n"))
+	if got, want := buf.String(), "[x] "+long+"b\n[x] c\n"; got != want {
+		t.Errorf("long line: got %d bytes, want %d with one tag per line", len(got), len(want))
+	}
+
+	// A long line without an end is ended by Flush, without a new tag.
+	buf.Reset()
+	_, _ = lw.Write([]byte(long))
+	_ = lw.Flush()
+	if got := buf.String(); got != "[x] "+long+"\n" {
+		t.Errorf("flushed long line: %d bytes, want %d", len(got), len("[x] "+long+"\n"))
+	}
+}
@@ -0,0 +1,108 @@
+//go:build unix
+
+package guard
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// defaultShell runs a script when $SHELL is unset.
+var defaultShell = []string{"/bin/sh", "-c"}
+
+// groupPoll is how often stopChild checks whether the rest of the child's
+// process group has exited.
+const groupPoll = 50 * time.Millisecond
+
+// ownGroup puts cmd in a process group of its own and returns true, unless
+// stdin is a terminal: a background group reading the terminal would be
+// stopped (SIGTTIN), and in the terminal's foreground group Ctrl+C already
+// reaches every process.
+func ownGroup(cmd *exec.Cmd, stdin io.Reader) bool {
+	if f, ok := stdin.(*os.File); ok && isTerminal(f) {
+		return false
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return true
+}
+
+// isTerminal reports whether f is a character device other than the null
+// device, i.e. a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
+
+// stopChild passes sig on to the child, or with group to its process group,
+// and waits for it to exit. After a non-zero grace whatever is left is
+// killed: the child, or with group every process still in the group, even
+// once the child itself has exited.
+func stopChild(p *os.Process, group bool, sig os.Signal, grace time.Duration, done <-chan error) {
+	signalChild(p, group, sig)
+	if grace <= 0 {
+		<-done
+		return
+	}
+	deadline := time.NewTimer(grace)
+	defer deadline.Stop()
+	select {
+	case <-done:
+	case <-deadline.C:
+		signalChild(p, group, syscall.SIGKILL)
+		<-done
+		return
+	}
+	if !group {
+		return
+	}
+	poll := time.NewTicker(groupPoll)
+	defer poll.Stop()
+	for groupAlive(p.Pid) {
+		select {
+		case <-deadline.C:
+			_ = syscall.Kill(-p.Pid, syscall.SIGKILL)
+			return
+		case <-poll.C:
+		}
+	}
+}
+
+// signalChild sends sig to the child, or with group to its process group.
+// A child or group already gone (ESRCH) is not an error.
+func signalChild(p *os.Process, group bool, sig os.Signal) {
+	if s, ok := sig.(syscall.Signal); ok && group {
+		_ = syscall.Kill(-p.Pid, s)
+		return
+	}
+	_ = p.Signal(sig)
+}
+
+// groupAlive reports whether any process is left in process group pgid.
+func groupAlive(pgid int) bool {
+	return !errors.Is(syscall.Kill(-pgid, 0), syscall.ESRCH)
+}
+
+// exitCode returns the child's exit code, or 128 + the signal number if a
+// signal killed it (as a shell reports it).
+func exitCode(err *exec.ExitError) int {
+	if ws, ok := err.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return err.ExitCode()
+}
+
+// exitSignal returns the signal that killed the child, or nil if it exited.
+func exitSignal(err *exec.ExitError) os.Signal {
+	if ws, ok := err.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal()
+	}
+	return nil
+}
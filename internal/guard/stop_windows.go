@@ -0,0 +1,52 @@
+//go:build windows
+
+package guard
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// defaultShell runs a script when $SHELL is unset.
+var defaultShell = []string{"cmd", "/C"}
+
+// ownGroup leaves cmd in guard's process group: Windows has no group to
+// signal, and a new console process group would stop receiving Ctrl+C.
+func ownGroup(*exec.Cmd, io.Reader) bool {
+	return false
+}
+
+// exitCode returns the child's exit code.
+func exitCode(err *exec.ExitError) int {
+	return err.ExitCode()
+}
+
+// exitSignal returns nil: a Windows process isn't killed by a signal.
+func exitSignal(*exec.ExitError) os.Signal {
+	return nil
+}
+
+// killGrace is how long a child gets to exit on its own before it is
+// killed, unless the caller gives a grace.
+const killGrace = 10 * time.Second
+
+// stopChild stops the child on Windows, where a process can't be sent
+// SIGINT or SIGTERM. A console child gets the same Ctrl+C or close event
+// as guard and is given grace (zero: killGrace) to exit on its own;
+// os.Interrupt is tried too, though Windows doesn't implement it. After
+// that the child is killed.
+func stopChild(p *os.Process, _ bool, _ os.Signal, grace time.Duration, done <-chan error) {
+	_ = p.Signal(os.Interrupt)
+	if grace <= 0 {
+		grace = killGrace
+	}
+	select {
+	case <-done:
+		return
+	case <-time.After(grace):
+	}
+	_ = p.Kill()
+	<-done
+}
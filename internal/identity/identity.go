@@ -21,7 +21,9 @@ var (
 const EnvLoktOwner = "LOKT_OWNER"
 
 // EnvLoktAgentID overrides the auto-generated agent identifier.
-// When set, its value is used as-is. When empty or unset, an ID is
+// When set, its value is used as-is and names an agent session: every
+// process that inherits it counts as the same agent, and locks it takes are
+// reentrant only for that agent. When empty or unset, an ID is
 // auto-generated from the process PID and start time.
 const EnvLoktAgentID = "LOKT_AGENT_ID"
 
@@ -31,26 +33,26 @@ type Identity struct {
 	Host    string
 	PID     int
 	AgentID string
+	// AgentExplicit is set when AgentID came from LOKT_AGENT_ID rather
+	// than being generated for this process.
+	AgentExplicit bool
 }
 
 // Current returns the identity of the current process.
 func Current() Identity {
+	agentID, explicit := getAgentID()
 	return Identity{
-		Owner:   getOwner(),
-		Host:    getHost(),
-		PID:     os.Getpid(),
-		AgentID: getAgentID(),
+		Owner:         getOwner(),
+		Host:          getHost(),
+		PID:           os.Getpid(),
+		AgentID:       agentID,
+		AgentExplicit: explicit,
 	}
 }
 
+// getOwner resolves the owner from the sources set with UseSources.
 func getOwner() string {
-	if owner := os.Getenv(EnvLoktOwner); owner != "" {
-		return owner
-	}
-	if u, err := userCurrentFn(); err == nil {
-		return u.Username
-	}
-	return "unknown"
+	return Resolve(Sources()...).Owner
 }
 
 func getHost() string {
@@ -65,14 +67,16 @@ var (
 	autoAgentIDOnce sync.Once
 )
 
-func getAgentID() string {
+// getAgentID returns the agent ID and whether it was set with
+// LOKT_AGENT_ID.
+func getAgentID() (string, bool) {
 	if id := os.Getenv(EnvLoktAgentID); id != "" {
-		return id
+		return id, true
 	}
 	autoAgentIDOnce.Do(func() {
 		autoAgentID = generateAgentID()
 	})
-	return autoAgentID
+	return autoAgentID, false
 }
 
 // generateAgentID produces a short, deterministic ID from the current
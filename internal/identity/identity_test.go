@@ -39,6 +39,7 @@ func TestGetOwner_EnvOverride(t *testing.T) {
 
 func TestGetOwner_FallsBackToUsername(t *testing.T) {
 	t.Setenv(EnvLoktOwner, "")
+	clearCI(t)
 
 	owner := getOwner()
 
@@ -75,16 +76,19 @@ func TestCurrent_UsesEnvOwner(t *testing.T) {
 func TestGetAgentID_EnvOverride(t *testing.T) {
 	t.Setenv(EnvLoktAgentID, "builder-1")
 
-	id := getAgentID()
-	if id != "builder-1" {
-		t.Errorf("AgentID = %q, want %q", id, "builder-1")
+	id, explicit := getAgentID()
+	if id != "builder-1" || !explicit {
+		t.Errorf("getAgentID() = %q, %v, want %q, true", id, explicit, "builder-1")
 	}
 }
 
 func TestGetAgentID_EmptyEnvFallsToAutoGen(t *testing.T) {
 	t.Setenv(EnvLoktAgentID, "")
 
-	id := getAgentID()
+	id, explicit := getAgentID()
+	if explicit {
+		t.Error("a generated agent ID should not be explicit")
+	}
 	matched, err := regexp.MatchString(`^agent-[0-9a-f]{4}$`, id)
 	if err != nil {
 		t.Fatalf("regexp error: %v", err)
@@ -118,8 +122,8 @@ func TestCurrent_AgentIDFromEnv(t *testing.T) {
 	t.Setenv(EnvLoktAgentID, "deploy-agent")
 
 	id := Current()
-	if id.AgentID != "deploy-agent" {
-		t.Errorf("AgentID = %q, want %q", id.AgentID, "deploy-agent")
+	if id.AgentID != "deploy-agent" || !id.AgentExplicit {
+		t.Errorf("AgentID = %q (explicit %v), want %q from the environment", id.AgentID, id.AgentExplicit, "deploy-agent")
 	}
 }
 
@@ -138,6 +142,7 @@ func TestCurrent_AgentIDAutoGen(t *testing.T) {
 
 func TestGetOwner_UnknownFallback(t *testing.T) {
 	t.Setenv(EnvLoktOwner, "")
+	clearCI(t)
 
 	old := userCurrentFn
 	defer func() { userCurrentFn = old }()
@@ -0,0 +1,151 @@
+package identity
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Source is where Resolve can take the owner from.
+type Source string
+
+const (
+	SourceEnv  Source = "env"  // LOKT_OWNER
+	SourceCI   Source = "ci"   // the job of a recognized CI system
+	SourceUser Source = "user" // the OS user
+)
+
+// DefaultSources is the order owners are resolved in unless config.json
+// sets identity_sources.
+var DefaultSources = []Source{SourceEnv, SourceCI, SourceUser}
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = DefaultSources
+)
+
+// UseSources sets the sources Current resolves the owner from, in order;
+// none restores DefaultSources.
+func UseSources(s []Source) {
+	if len(s) == 0 {
+		s = DefaultSources
+	}
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources = slices.Clone(s)
+}
+
+// Sources returns the sources Current resolves the owner from.
+func Sources() []Source {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	return slices.Clone(sources)
+}
+
+// ValidateSources rejects unknown and repeated sources, as in
+// identity_sources in config.json.
+func ValidateSources(srcs []Source) error {
+	for i, s := range srcs {
+		if !slices.Contains(DefaultSources, s) {
+			return fmt.Errorf("unknown source %q (want env, ci or user)", s)
+		}
+		if slices.Contains(srcs[:i], s) {
+			return fmt.Errorf("%q listed twice", s)
+		}
+	}
+	return nil
+}
+
+// Resolution is an owner and where Resolve found it.
+type Resolution struct {
+	Owner  string
+	Source Source // "" if no source applied and Owner is "unknown"
+	// Via says which variable or CI system within Source it came from
+	// ("LOKT_OWNER", "GitHub Actions"), for lokt whoami and doctor.
+	Via string
+}
+
+// Resolve returns the owner from the first of sources (DefaultSources if
+// none) that yields one, or "unknown".
+//
+// The CI source tells jobs on a shared runner apart, where every job runs
+// as the same OS user and would otherwise share locks reentrantly. The
+// owner names the job: gha:owner/repo#<run id>.<job> on GitHub Actions
+// (matrix legs of one job share it; give them LOKT_OWNER),
+// gitlab:group/project#<job id>, buildkite:<pipeline>#<job id> and
+// jenkins:<BUILD_TAG without its jenkins- prefix>.
+func Resolve(srcs ...Source) Resolution {
+	if len(srcs) == 0 {
+		srcs = DefaultSources
+	}
+	for _, s := range srcs {
+		switch s {
+		case SourceEnv:
+			if owner := os.Getenv(EnvLoktOwner); owner != "" {
+				return Resolution{Owner: owner, Source: s, Via: EnvLoktOwner}
+			}
+		case SourceCI:
+			for _, ci := range ciSystems {
+				if owner := ci.owner(); owner != "" {
+					return Resolution{Owner: owner, Source: s, Via: ci.name}
+				}
+			}
+		case SourceUser:
+			if u, err := userCurrentFn(); err == nil {
+				return Resolution{Owner: u.Username, Source: s, Via: "OS user"}
+			}
+		}
+	}
+	return Resolution{Owner: "unknown"}
+}
+
+// ciSystems are the CI systems the CI source recognizes, each by a
+// variable only it sets.
+var ciSystems = []struct {
+	name  string
+	owner func() string
+}{
+	{"GitHub Actions", func() string {
+		if os.Getenv("GITHUB_ACTIONS") != "true" {
+			return ""
+		}
+		return ciOwner("gha", os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID"), os.Getenv("GITHUB_JOB"))
+	}},
+	{"GitLab CI", func() string {
+		if os.Getenv("GITLAB_CI") == "" {
+			return ""
+		}
+		return ciOwner("gitlab", os.Getenv("CI_PROJECT_PATH"), os.Getenv("CI_JOB_ID"), "")
+	}},
+	{"Buildkite", func() string {
+		if os.Getenv("BUILDKITE") == "" {
+			return ""
+		}
+		return ciOwner("buildkite", os.Getenv("BUILDKITE_PIPELINE_SLUG"), os.Getenv("BUILDKITE_JOB_ID"), "")
+	}},
+	{"Jenkins", func() string {
+		if os.Getenv("JENKINS_URL") == "" {
+			return ""
+		}
+		return ciOwner("jenkins", "", strings.TrimPrefix(os.Getenv("BUILD_TAG"), "jenkins-"), "")
+	}},
+}
+
+// ciOwner composes prefix:project#id.job, leaving out an empty project or
+// job; without an id there is no job to name and it returns "".
+func ciOwner(prefix, project, id, job string) string {
+	if id == "" {
+		return ""
+	}
+	owner := prefix + ":" + project
+	if project != "" {
+		owner += "#"
+	}
+	owner += id
+	if job != "" {
+		owner += "." + job
+	}
+	return owner
+}
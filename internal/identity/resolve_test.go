@@ -0,0 +1,96 @@
+package identity
+
+import (
+	"testing"
+)
+
+// clearCI unsets what the CI source recognizes, so tests see the same
+// owner on a CI runner as on a laptop.
+func clearCI(t *testing.T) {
+	t.Helper()
+	for _, v := range []string{"GITHUB_ACTIONS", "GITLAB_CI", "BUILDKITE", "JENKINS_URL"} {
+		t.Setenv(v, "")
+	}
+}
+
+func TestResolve_CI(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+		via  string
+	}{
+		{"github", map[string]string{
+			"GITHUB_ACTIONS": "true", "GITHUB_REPOSITORY": "acme/api", "GITHUB_RUN_ID": "4242", "GITHUB_JOB": "build",
+		}, "gha:acme/api#4242.build", "GitHub Actions"},
+		{"gitlab", map[string]string{
+			"GITLAB_CI": "true", "CI_PROJECT_PATH": "acme/api", "CI_JOB_ID": "77",
+		}, "gitlab:acme/api#77", "GitLab CI"},
+		{"buildkite", map[string]string{
+			"BUILDKITE": "true", "BUILDKITE_PIPELINE_SLUG": "api", "BUILDKITE_JOB_ID": "0190-ab",
+		}, "buildkite:api#0190-ab", "Buildkite"},
+		{"jenkins", map[string]string{
+			"JENKINS_URL": "https://ci.example/", "BUILD_TAG": "jenkins-api-main-12",
+		}, "jenkins:api-main-12", "Jenkins"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearCI(t)
+			t.Setenv(EnvLoktOwner, "")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got := Resolve()
+			if got.Owner != tt.want || got.Source != SourceCI || got.Via != tt.via {
+				t.Errorf("Resolve() = %+v, want %q from %s", got, tt.want, tt.via)
+			}
+
+			// LOKT_OWNER still wins, and the CI source can be left out
+			t.Setenv(EnvLoktOwner, "deployer")
+			if got := Resolve(); got.Owner != "deployer" || got.Source != SourceEnv {
+				t.Errorf("Resolve() with LOKT_OWNER = %+v", got)
+			}
+			if got := Resolve(SourceUser); got.Source != SourceUser {
+				t.Errorf("Resolve(user) = %+v, want the OS user", got)
+			}
+		})
+	}
+}
+
+func TestResolve_CIWithoutJob(t *testing.T) {
+	clearCI(t)
+	t.Setenv(EnvLoktOwner, "")
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("GITHUB_RUN_ID", "")
+	if got := Resolve(); got.Source != SourceUser {
+		t.Errorf("Resolve() = %+v, want the OS user when the CI job can't be named", got)
+	}
+}
+
+func TestUseSources(t *testing.T) {
+	clearCI(t)
+	t.Setenv(EnvLoktOwner, "from-env")
+	t.Setenv("GITLAB_CI", "true")
+	t.Setenv("CI_JOB_ID", "9")
+	defer UseSources(nil)
+
+	UseSources([]Source{SourceCI, SourceEnv})
+	if owner := Current().Owner; owner != "gitlab:9" {
+		t.Errorf("Owner = %q, want the CI job first", owner)
+	}
+	UseSources(nil)
+	if owner := Current().Owner; owner != "from-env" {
+		t.Errorf("Owner = %q after UseSources(nil), want LOKT_OWNER", owner)
+	}
+}
+
+func TestValidateSources(t *testing.T) {
+	if err := ValidateSources([]Source{SourceCI, SourceUser}); err != nil {
+		t.Errorf("ValidateSources() error = %v", err)
+	}
+	for _, bad := range [][]Source{{"ldap"}, {SourceEnv, SourceEnv}} {
+		if err := ValidateSources(bad); err == nil {
+			t.Errorf("ValidateSources(%q) succeeded, want an error", bad)
+		}
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/rand"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/nikolasavic/lokt/internal/audit"
@@ -23,79 +23,267 @@ var (
 
 // HeldError provides details about who holds a contested lock.
 type HeldError struct {
-	Lock *lockfile.Lock
+	Lock       *lockfile.Lock
+	RetryAfter time.Duration // Suggested wait before retrying; see RetryAfter
+	// Shared is the number of live shared holders when the lock is held in
+	// shared mode; Lock is then the oldest of them.
+	Shared int
 }
 
 func (e *HeldError) Error() string {
 	age := time.Since(e.Lock.AcquiredAt).Truncate(time.Second)
+	hint := ""
+	if e.RetryAfter > 0 {
+		hint = "; " + FormatRetryAfter(e.RetryAfter)
+	}
+	if e.Lock.Message != "" {
+		hint = ", doing: " + e.Lock.Message + hint
+	}
+	if e.Shared > 0 {
+		return fmt.Sprintf("lock %q held shared by %d holder(s), oldest %s@%s (pid %d) for %s%s",
+			e.Lock.Name, e.Shared, e.Lock.Owner, e.Lock.Host, e.Lock.PID, age, hint)
+	}
 	if e.Lock.AgentID != "" {
-		return fmt.Sprintf("lock %q held by %s (agent: %s)@%s (pid %d) for %s",
-			e.Lock.Name, e.Lock.Owner, e.Lock.AgentID, e.Lock.Host, e.Lock.PID, age)
+		return fmt.Sprintf("lock %q held by %s (agent: %s)@%s (pid %d) for %s%s",
+			e.Lock.Name, e.Lock.Owner, e.Lock.AgentID, e.Lock.Host, e.Lock.PID, age, hint)
 	}
-	return fmt.Sprintf("lock %q held by %s@%s (pid %d) for %s",
-		e.Lock.Name, e.Lock.Owner, e.Lock.Host, e.Lock.PID, age)
+	return fmt.Sprintf("lock %q held by %s@%s (pid %d) for %s%s",
+		e.Lock.Name, e.Lock.Owner, e.Lock.Host, e.Lock.PID, age, hint)
 }
 
 func (e *HeldError) Unwrap() error {
 	return ErrLockHeld
 }
 
+// WaitError is returned by AcquireWithWait when ctx ends before the lock is
+// acquired. It unwraps to ctx.Err().
+type WaitError struct {
+	Err      error         // ctx.Err()
+	Attempts int           // acquisition attempts made, the first included
+	Waited   time.Duration // time since the first attempt
+}
+
+func (e *WaitError) Error() string {
+	return fmt.Sprintf("%v: gave up after %d attempts over %s", e.Err, e.Attempts, e.Waited.Truncate(time.Millisecond))
+}
+
+func (e *WaitError) Unwrap() error {
+	return e.Err
+}
+
 // AcquireOptions configures lock acquisition.
 type AcquireOptions struct {
-	TTL     time.Duration
-	Auditor *audit.Writer // Optional audit writer for event logging
+	TTL      time.Duration
+	Auditor  *audit.Writer // Optional audit writer for event logging
+	ThawWait time.Duration // Time spent waiting for a freeze to lift; recorded on the acquire event
+	Retry    RetryPolicy   // Poll schedule for AcquireWithWait; zero value uses DefaultRetryPolicy
+	// RetryAfterDefault is the retry hint for denials by holders without a
+	// TTL; zero uses DefaultRetryAfter.
+	RetryAfterDefault time.Duration
+	// NoAdaptive keeps AcquireWithWait on Retry as given instead of
+	// stretching it when many processes wait for the same lock (see
+	// RetryPolicy.Adapt). For latency-critical callers.
+	NoAdaptive bool
+	// OnWait, if set, is called once by AcquireWithWait when the first
+	// attempt is denied and polling begins, with that denial.
+	OnWait func(denied *HeldError)
+	// OnProgress, if set, is called by AcquireWithWait and AcquireMany
+	// while they wait, after a denied attempt at most once per
+	// ProgressInterval (zero: DefaultProgressInterval), with the holder
+	// that denied it and the time waited so far.
+	OnProgress       func(holder *lockfile.Lock, waited time.Duration)
+	ProgressInterval time.Duration
+	// ExclusionGroups maps group names to lock names of which at most one
+	// may be held at a time (see exclusive.go). Nil disables the check.
+	ExclusionGroups map[string][]string
+	// Shared acquires a shared (read) hold, which coexists with other
+	// shared holds but not with an exclusive lock (see shared.go).
+	Shared bool
+	// Message and Labels are stored in the lock file for others to see
+	// (lockfile.Lock.Message, Labels), cleaned by lockfile.CleanMessage
+	// and lockfile.CleanLabels.
+	Message string
+	Labels  map[string]string
+	// SkewGrace is how long past expiry another host's lock must be before
+	// AcquireWithWait breaks it (stale.CheckWithGrace); zero breaks it at
+	// expiry. Others' reservations are widened by it on both ends. Callers
+	// pass config.json's clock_skew_grace.
+	SkewGrace time.Duration
+	// Flock has the holder keep an advisory flock on its lock file as
+	// well (see flock.go), until it releases the lock or exits; ignored
+	// for shared holds and where flock isn't available.
+	Flock bool
+	// Session registers the lock in that session (see session.go), for
+	// EndSession to release; ignored for shared holds.
+	Session string
+	// Path records the file the name was derived from (NameForPath) in the
+	// lock file.
+	Path string
+	// Handoff writes the lock retained (lockfile.Lock.Retained), so it
+	// outlives this process until the one that is to hold it calls Adopt;
+	// ignored for shared holds.
+	Handoff bool
+	// RespectFreeze has Acquire fail with a *FrozenError (CheckFreeze) if
+	// the name is frozen, and AcquireWithWait check again before every
+	// poll, so a freeze placed while it waits isn't defeated the moment the
+	// holder releases: it keeps waiting until the freeze is lifted or ctx
+	// ends. OnFrozen, if set, and a freeze-deny event report each freeze
+	// the wait runs into, once.
+	RespectFreeze bool
+	OnFrozen      func(freeze *FrozenError)
+
+	// waited is set by AcquireWithWait and AcquireMany on the attempts
+	// after a denial, for the acquire event.
+	waited waitStats
+	// slot marks the acquisition of one of AcquireSlot's slots, which
+	// checked the name they are slots of for its policy and reservations.
+	// It denies the same holder too, instead of refreshing its lock: slots
+	// are taken one per acquisition.
+	slot bool
+}
+
+// waitStats describes the wait behind an acquisition attempt.
+type waitStats struct {
+	since    time.Time // the first attempt
+	attempts int       // attempts made, this one included; 0 if there was no wait
 }
 
 // Acquire attempts to atomically acquire a lock.
-// Returns HeldError if the lock is already held.
+// Returns HeldError if the lock is already held, ConflictError if another
+// member of one of its exclusion groups is, or ReservedError if the hold
+// would overlap another owner's reservation (see reserve.go).
 func Acquire(rootDir, name string, opts AcquireOptions) error {
-	if err := lockfile.ValidateName(name); err != nil {
+	if opts.RespectFreeze {
+		if err := CheckFreeze(rootDir, name, opts.Auditor); err != nil {
+			return err
+		}
+	}
+	if len(opts.ExclusionGroups) == 0 {
+		return acquire(rootDir, name, opts)
+	}
+	return acquireExclusive(rootDir, name, opts)
+}
+
+// TryResult is the outcome of TryAcquire.
+type TryResult struct {
+	Acquired bool
+	// Held is the denial when the lock (or a member of its exclusion group)
+	// was held: acquiring would have meant waiting. Nil if Acquired.
+	Held *HeldError
+}
+
+// TryAcquire makes one acquisition attempt for callers that skip work
+// someone else is already doing. A held lock is not an error: it returns a
+// TryResult with Held set and records a skip event. Anything else that
+// stops the acquisition (an invalid name, a policy violation, I/O) is
+// returned as an error.
+func TryAcquire(rootDir, name string, opts AcquireOptions) (TryResult, error) {
+	err := Acquire(rootDir, name, opts)
+	if err == nil {
+		return TryResult{Acquired: true}, nil
+	}
+	var held *HeldError
+	if !errors.As(err, &held) {
+		return TryResult{}, err
+	}
+	emitSkipEvent(opts.Auditor, identity.Current(), name, held)
+	return TryResult{Held: held}, nil
+}
+
+// ensureDirsError is the error for a failure to create rootDir's
+// directories, wrapping a *root.ReadOnlyError if the root can't be written
+// at all.
+func ensureDirsError(rootDir string, err error) error {
+	if roErr := root.CheckWritable(rootDir); roErr != nil {
+		err = roErr
+	}
+	return fmt.Errorf("ensure dirs: %w", err)
+}
+
+// acquire is a single acquisition attempt.
+func acquire(rootDir, name string, opts AcquireOptions) error {
+	if err := validName(name, opts.slot); err != nil {
+		return err
+	}
+	opts.Message = lockfile.CleanMessage(opts.Message)
+	labels, err := lockfile.CleanLabels(opts.Labels)
+	if err != nil {
+		return err
+	}
+	opts.Labels = labels
+	if opts.Session != "" {
+		if err := ValidateSessionID(opts.Session); err != nil {
+			return err
+		}
+	}
+	rootDir, err = root.Follow(rootDir)
+	if err != nil {
 		return err
 	}
 
 	if err := root.EnsureDirs(rootDir); err != nil {
-		return fmt.Errorf("ensure dirs: %w", err)
+		return ensureDirsError(rootDir, err)
+	}
+	if !opts.slot {
+		if opts.TTL, err = policyTTL(rootDir, name, opts.TTL); err != nil {
+			return err
+		}
 	}
 
 	path := root.LockFilePath(rootDir, name)
+	create := root.CreateLockFilePath(rootDir, name)
 	id := identity.Current()
 
-	lock := &lockfile.Lock{
-		Version:    lockfile.CurrentLockfileVersion,
-		Name:       name,
-		LockID:     lockfile.GenerateLockID(),
-		Owner:      id.Owner,
-		Host:       id.Host,
-		PID:        id.PID,
-		AgentID:    id.AgentID,
-		AcquiredAt: time.Now(),
+	if !opts.slot {
+		if err := checkReservations(rootDir, name, id, opts.TTL, opts.SkewGrace, opts.Auditor); err != nil {
+			return err
+		}
 	}
-	if startNS, err := stale.GetProcessStartTime(id.PID); err == nil {
-		lock.PIDStartNS = startNS
+	if c := FindConflict(rootDir, name, opts.ExclusionGroups, opts.RetryAfterDefault); c != nil {
+		emitConflictDenyEvent(opts.Auditor, id, name, int(opts.TTL.Seconds()), c)
+		return c
 	}
-	if opts.TTL > 0 {
-		lock.TTLSec = int(opts.TTL.Seconds())
-		exp := lock.AcquiredAt.Add(time.Duration(lock.TTLSec) * time.Second)
-		lock.ExpiresAt = &exp
+	if opts.Shared {
+		return acquireShared(rootDir, name, opts, id)
+	}
+
+	lock := newLock(name, id, opts)
+	// Shared holders block an exclusive lock
+	if held := sharedHeld(rootDir, name, opts.Auditor, id, opts.RetryAfterDefault); held != nil {
+		emitDenyEvent(opts.Auditor, id, name, lock.TTLSec, held.Lock, held.RetryAfter)
+		return held
+	}
+
+	// A namespaced name ("team/web/build") lives in subdirectories
+	if err := root.MkdirAll(rootDir, filepath.Dir(create)); err != nil {
+		return ensureDirsError(rootDir, err)
+	}
+
+	// Try atomic create - fails if file exists. A lock file still at its
+	// flat location from before sharding exists too; it is only read and
+	// removed there, and the lock is created in its shard.
+	var f *os.File
+	err = os.ErrExist
+	if path == create {
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 	}
-	// Try atomic create - fails if file exists
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
 		if os.IsExist(err) {
 			// Lock exists - read it and check if stale
 			existing, readErr := lockfile.Read(path)
 			if readErr != nil {
-				if errors.Is(readErr, lockfile.ErrUnsupportedVersion) {
-					// Lock written by a newer lokt version; do not touch it
+				if errors.Is(readErr, lockfile.ErrUnsupportedVersion) || errors.Is(readErr, lockfile.ErrBadSignature) {
+					// Lock written by a newer lokt version, or forged; do not touch it
 					return readErr
 				}
-				if errors.Is(readErr, lockfile.ErrCorrupted) {
-					// Corrupted lock file — no valid holder, safe to remove
-					if removeErr := os.Remove(path); removeErr == nil {
-						_ = lockfile.SyncDir(path)
+				if lockfile.Broken(readErr) {
+					// Corrupted, oversized or not a lock (lockfile.Broken):
+					// no valid holder, safe to remove
+					if removed, _ := removeIfStill(path, stale.ReasonCorrupted, nil, stalePath); removed {
 						emitCorruptBreakEvent(opts.Auditor, id, name)
 
 						// Retry acquisition once
+						path = create
 						f2, retryErr := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 						if retryErr == nil {
 							_ = f2.Close()
@@ -106,13 +294,14 @@ func Acquire(rootDir, name string, opts AcquireOptions) error {
 				}
 				// File exists but unreadable (likely being written by another process)
 				// Return a synthetic HeldError so AcquireWithWait will retry
-				return &HeldError{Lock: &lockfile.Lock{Name: name}}
+				return &HeldError{Lock: &lockfile.Lock{Name: name}, RetryAfter: MinRetryAfter}
 			}
 
-			// Reentrant acquire: same owner refreshes the lock instead of failing.
-			// Owner match is by LOKT_OWNER string only (not PID/host), so the
-			// same agent identity on a different process or host can re-acquire.
-			if existing.Owner == id.Owner {
+			// Reentrant acquire: the same holder refreshes the lock instead of
+			// failing. The match is by owner (and explicit agent ID, if any),
+			// not PID/host, so the same identity on a different process or
+			// host can re-acquire.
+			if SameHolder(existing, id) && !opts.slot {
 				// Overwrite with fresh identity + timestamp + new TTL.
 				// Preserve the existing lock_id to maintain the correlation chain.
 				if existing.LockID != "" {
@@ -126,19 +315,28 @@ func Acquire(rootDir, name string, opts AcquireOptions) error {
 				if err := lockfile.Write(path, lock); err != nil {
 					return fmt.Errorf("refresh lock file: %w", err)
 				}
-				emitRenewEvent(opts.Auditor, id, name, lock.TTLSec, lock.LockID)
+				if lock.Flock {
+					takeFlock(path, lock)
+				} else {
+					dropFlock(path)
+				}
+				if lock.Session != "" {
+					registerSession(rootDir, lock.Session, name, id)
+				}
+				remaining, timed := renewRemaining(existing)
+				emitRenewEvent(opts.Auditor, id, name, lock.TTLSec, lock.LockID, remaining, timed)
 				return nil
 			}
 
 			// Auto-prune: if lock holder is dead (same host only), remove and retry once
-			result := stale.Check(existing)
-			if result.Stale && result.Reason == stale.ReasonDeadPID {
-				if removeErr := os.Remove(path); removeErr == nil {
-					_ = lockfile.SyncDir(path)
+			result := stale.CheckFile(path, existing, 0)
+			if result.Stale && result.Reason.HolderGone() {
+				if removed, _ := removeIfStill(path, result.Reason, existing, stalePath); removed {
 					// Emit auto-prune event with previous holder info
-					emitAutoPruneEvent(opts.Auditor, id, name, existing)
+					emitAutoPruneEvent(opts.Auditor, id, name, existing, result.Reason)
 
 					// Retry acquisition once
+					path = create
 					f2, retryErr := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 					if retryErr == nil {
 						_ = f2.Close()
@@ -156,8 +354,9 @@ func Acquire(rootDir, name string, opts AcquireOptions) error {
 			}
 
 			// Emit deny event
-			emitDenyEvent(opts.Auditor, id, name, lock.TTLSec, existing)
-			return &HeldError{Lock: existing}
+			retryAfter := RetryAfter(existing, opts.RetryAfterDefault)
+			emitDenyEvent(opts.Auditor, id, name, lock.TTLSec, existing, retryAfter)
+			return &HeldError{Lock: existing, RetryAfter: retryAfter}
 		}
 		return fmt.Errorf("create lock file: %w", err)
 	}
@@ -171,45 +370,89 @@ writeLock:
 		return fmt.Errorf("write lock file: %w", err)
 	}
 
+	// Second phase of the shared check: a shared holder that appeared
+	// since the check above wins, and this lock backs out.
+	if held := sharedHeld(rootDir, name, opts.Auditor, id, opts.RetryAfterDefault); held != nil {
+		_ = os.Remove(path)
+		_ = lockfile.SyncDir(path)
+		emitDenyEvent(opts.Auditor, id, name, lock.TTLSec, held.Lock, held.RetryAfter)
+		return held
+	}
+
+	// Second phase of exclusion: a member acquired since the check above
+	// wins, and this lock backs out.
+	if c := FindConflict(rootDir, name, opts.ExclusionGroups, opts.RetryAfterDefault); c != nil {
+		_, _ = removeOwnLock(path, lock)
+		return &errBackedOut{conflict: c}
+	}
+
+	takeFlock(path, lock)
+	if lock.Session != "" {
+		registerSession(rootDir, lock.Session, name, id)
+	}
+
 	// Emit acquire event
-	emitAcquireEvent(opts.Auditor, id, name, lock.TTLSec, lock.LockID)
+	emitAcquireEvent(opts.Auditor, id, lock, opts.ThawWait, opts.waited)
 
 	return nil
 }
 
-// Backoff parameters for AcquireWithWait polling.
-const (
-	baseInterval = 50 * time.Millisecond
-	maxInterval  = 2 * time.Second
-)
+// removeOwnLock removes the lock file at path if it is still lk's
+// acquisition (removeIfStill): if another acquirer has pruned it and
+// written its own lock since, a back-out must leave that one alone.
+func removeOwnLock(path string, lk *lockfile.Lock) (bool, error) {
+	return removeIfStill(path, stale.ReasonNotStale, lk, func(path string) (stale.Reason, *lockfile.Lock) {
+		current, _ := lockfile.Read(path)
+		return stale.ReasonNotStale, current
+	})
+}
 
-// backoffInterval calculates the next poll interval with exponential backoff and jitter.
-// Jitter is ±25% to desynchronize competing waiters.
-func backoffInterval(attempt int) time.Duration {
-	// Exponential backoff: base * 2^attempt, capped at maxInterval
-	// Use lookup table to avoid overflow concerns
-	multipliers := []time.Duration{1, 2, 4, 8, 16, 32, 64}
-	var multiplier time.Duration = 64 // default for attempt >= 6
-	if attempt < len(multipliers) {
-		multiplier = multipliers[attempt]
+// newLock returns the lock file content for a new acquisition of name by id.
+func newLock(name string, id identity.Identity, opts AcquireOptions) *lockfile.Lock {
+	lock := &lockfile.Lock{
+		Version:       lockfile.WriteVersion(),
+		Name:          name,
+		LockID:        lockfile.GenerateLockID(),
+		Owner:         id.Owner,
+		Host:          id.Host,
+		PID:           id.PID,
+		AgentID:       id.AgentID,
+		AgentExplicit: id.AgentExplicit,
+		AcquiredAt:    time.Now(),
+		Message:       opts.Message,
+		Labels:        opts.Labels,
+		Flock:         opts.Flock && flockSupported,
+		Session:       opts.Session,
+		Path:          opts.Path,
+		Retained:      opts.Handoff,
 	}
-
-	interval := baseInterval * multiplier
-	if interval > maxInterval {
-		interval = maxInterval
+	if startNS, err := stale.GetProcessStartTime(id.PID); err == nil {
+		lock.PIDStartNS = startNS
 	}
-
-	// Add jitter: multiply by 0.75 to 1.25
-	// Using math/rand is fine here - this is timing jitter, not security
-	jitter := 0.75 + rand.Float64()*0.5 //nolint:gosec // G404: jitter doesn't need crypto rand
-	return time.Duration(float64(interval) * jitter)
+	if opts.TTL > 0 {
+		lock.TTLSec = int(opts.TTL.Seconds())
+		exp := lock.AcquiredAt.Add(time.Duration(lock.TTLSec) * time.Second)
+		lock.ExpiresAt = &exp
+	}
+	return lock
 }
 
 // AcquireWithWait attempts to acquire a lock, polling until successful or context is cancelled.
-// Uses exponential backoff with jitter to avoid thundering herd.
+// Polls on opts.Retry (exponential backoff with jitter) to avoid thundering herd.
+// Unless opts.NoAdaptive is set, the waiter registers itself under
+// <root>/waiters/<name>/ and stretches its backoff cap when many others are
+// waiting too (RetryPolicy.Adapt); ctx still bounds the total wait.
+// While waiting it also records an intent under <root>/intents/<name>/ and
+// returns a *DeadlockError if the lock's holder waits, directly or through
+// other owners, for a lock this owner holds (see deadlock.go).
 // If the lock is held by a stale process (expired TTL or dead PID), it will be broken automatically.
-// Returns nil on successful acquisition, ctx.Err() on cancellation, or another error on failure.
+// With opts.RespectFreeze a freeze fails the first attempt, but one found
+// later only holds the wait up. A reservation for another owner fails the
+// wait whenever it is found: it doesn't end with its owner's hold.
+// Returns nil on successful acquisition, a *WaitError wrapping ctx.Err() on
+// cancellation, or another error on failure.
 func AcquireWithWait(ctx context.Context, rootDir, name string, opts AcquireOptions) error {
+	start := time.Now()
 	// First attempt without waiting
 	err := Acquire(rootDir, name, opts)
 	if err == nil {
@@ -217,99 +460,298 @@ func AcquireWithWait(ctx context.Context, rootDir, name string, opts AcquireOpti
 	}
 
 	var held *HeldError
-	if !errors.As(err, &held) {
-		return err // Non-held error (validation, permission, etc.), don't retry
+	if !waitable(err, &held) {
+		return err // Non-held error (validation, permission, a reservation), don't retry
+	}
+	if opts.OnWait != nil {
+		opts.OnWait(held)
+	}
+
+	var self *waiter
+	var wants *intent
+	dir, err := root.Follow(rootDir)
+	if err == nil {
+		if !opts.NoAdaptive {
+			// Best-effort: without a marker this waiter just isn't counted.
+			if self, err = registerWaiter(dir, name); err == nil {
+				defer self.remove()
+			}
+		}
+		// Best-effort too: without an intent this wait can't be part of a
+		// detected deadlock.
+		if wants, err = registerIntent(dir, name); err == nil {
+			defer wants.remove()
+		}
 	}
 
+	progress := newWaitProgress(opts, start)
+	freezes := newFreezeWatch(opts)
+	opts.RespectFreeze = false // freezes checks each poll from here on
+	policy := opts.Retry
 	attempt := 0
 	for {
-		interval := backoffInterval(attempt)
+		if self != nil {
+			self.touch()
+			if attempt%waiterRecount == 0 {
+				policy = opts.Retry.Adapt(self.others())
+			}
+		}
+		if wants != nil {
+			wants.touch()
+			if d := findDeadlock(dir, wants.lf, opts.ExclusionGroups); d != nil {
+				emitDeadlockEvent(opts.Auditor, identity.Current(), name, d)
+				return d
+			}
+		}
+		interval := policy.Interval(attempt)
 		attempt++
 
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			// Every interval started so far followed an attempt
+			waitErr := &WaitError{Err: ctx.Err(), Attempts: attempt, Waited: time.Since(start)}
+			if errors.Is(waitErr, context.DeadlineExceeded) {
+				emitWaitTimeoutEvent(opts.Auditor, identity.Current(), name, waitErr.Waited, attempt, held.Lock)
+			}
+			return waitErr
 		case <-time.After(interval):
+			if frozen, err := freezes.frozen(rootDir, name); err != nil {
+				return err
+			} else if frozen {
+				continue // don't take the lock from under the freeze
+			}
 			// Try to break stale locks before acquiring
-			_ = tryBreakStale(rootDir, name)
+			_ = tryBreakStale(rootDir, name, opts.Auditor, opts.SkewGrace)
 
+			opts.waited = waitStats{since: start, attempts: attempt + 1}
 			err := Acquire(rootDir, name, opts)
 			if err == nil {
 				return nil
 			}
-			if !errors.As(err, &held) {
+			if !waitable(err, &held) {
 				return err // Non-held error, don't retry
 			}
+			progress.report(held.Lock)
 			// Lock still held, continue polling with increased backoff
 		}
 	}
 }
 
-// tryBreakStale attempts to remove a lock if it's stale.
-// Returns true if the lock was removed, false otherwise.
-func tryBreakStale(rootDir, name string) bool {
-	path := root.LockFilePath(rootDir, name)
-	existing, err := lockfile.Read(path)
-	if err != nil {
-		// Corrupted lock file is unconditionally stale — remove it
-		if errors.Is(err, lockfile.ErrCorrupted) {
-			if os.Remove(path) != nil {
-				return false
-			}
-			_ = lockfile.SyncDir(path)
-			return true
-		}
-		return false
+// DefaultProgressInterval is how often a wait reports its progress when
+// AcquireOptions.ProgressInterval is zero.
+const DefaultProgressInterval = 15 * time.Second
+
+// waitProgress paces AcquireOptions.OnProgress over one wait.
+type waitProgress struct {
+	fn    func(holder *lockfile.Lock, waited time.Duration)
+	every time.Duration
+	start time.Time
+	next  time.Time
+}
+
+// newWaitProgress returns the progress reporter of a wait that started at
+// start; nil (reporting nothing) without opts.OnProgress.
+func newWaitProgress(opts AcquireOptions, start time.Time) *waitProgress {
+	if opts.OnProgress == nil {
+		return nil
+	}
+	every := opts.ProgressInterval
+	if every <= 0 {
+		every = DefaultProgressInterval
 	}
+	return &waitProgress{fn: opts.OnProgress, every: every, start: start, next: start.Add(every)}
+}
 
-	result := stale.Check(existing)
-	if !result.Stale {
-		return false
+// report passes on a denial by holder if an interval has passed since the
+// last report (or the start).
+func (p *waitProgress) report(holder *lockfile.Lock) {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	if now.Before(p.next) {
+		return
 	}
+	p.next = now.Add(p.every)
+	p.fn(holder, now.Sub(p.start))
+}
 
-	// Lock is stale, try to remove it
-	if err := os.Remove(path); err != nil {
+// tryBreakStale attempts to remove a lock if it's stale, giving another
+// host's lock grace past its expiry (stale.CheckWithGrace).
+// Returns true if the lock was removed, false otherwise. Removals are
+// audited (corrupt-break or auto-prune) so a waiter taking over from a
+// crashed holder leaves a record of why the old lock disappeared.
+func tryBreakStale(rootDir, name string, auditor *audit.Writer, grace time.Duration) bool {
+	path := root.LockFilePath(rootDir, name)
+	reason, existing := classifyStale(path, grace)
+	if reason == stale.ReasonNotStale {
 		return false
 	}
-	_ = lockfile.SyncDir(path)
+	// Renewed or replaced since it was read: not stale after all
+	removed, _ := removeIfStill(path, reason, existing, func(path string) (stale.Reason, *lockfile.Lock) {
+		return classifyStale(path, grace)
+	})
+	if !removed {
+		return false
+	}
+	if reason == stale.ReasonCorrupted {
+		emitCorruptBreakEvent(auditor, identity.Current(), name)
+	} else {
+		emitAutoPruneEvent(auditor, identity.Current(), name, existing, reason)
+	}
 	return true
 }
 
+// StaleReason reports why tryBreakStale would remove the lock on name:
+// stale.ReasonCorrupted, or the stale.Check reason (expired, dead_pid or
+// recycled_pid). It returns stale.ReasonNotStale if the lock isn't stale or
+// can't be read, and the lock itself unless it is corrupted.
+//
+// Monitoring uses it so that what it reports as stale is exactly what a
+// waiting acquire would break; pass the same grace (AcquireOptions.SkewGrace).
+func StaleReason(rootDir, name string, grace time.Duration) (stale.Reason, *lockfile.Lock) {
+	return classifyStale(root.LockFilePath(rootDir, name), grace)
+}
+
+// stalePath is classifyStale without a grace, as Acquire judges a holder.
+func stalePath(path string) (stale.Reason, *lockfile.Lock) {
+	return classifyStale(path, 0)
+}
+
+// classifyStale implements StaleReason for the lock file at path.
+func classifyStale(path string, grace time.Duration) (stale.Reason, *lockfile.Lock) {
+	existing, err := lockfile.Read(path)
+	if err != nil {
+		// Corrupted lock file is unconditionally stale
+		if lockfile.Broken(err) {
+			return stale.ReasonCorrupted, nil
+		}
+		return stale.ReasonNotStale, nil
+	}
+	if result := stale.CheckFile(path, existing, grace); result.Stale {
+		return result.Reason, existing
+	}
+	return stale.ReasonNotStale, existing
+}
+
 // emitAcquireEvent emits an acquire audit event. Safe to call with nil auditor.
-func emitAcquireEvent(w *audit.Writer, id identity.Identity, name string, ttlSec int, lockID string) {
+// A non-zero thawWait is recorded as extra.thaw_wait_ms, and an acquisition
+// that had to wait for the holder as extra.waited_ms and extra.attempts.
+func emitAcquireEvent(w *audit.Writer, id identity.Identity, lk *lockfile.Lock, thawWait time.Duration, waited waitStats) {
 	if w == nil {
 		return
 	}
+	extra := make(map[string]any)
+	if thawWait > 0 {
+		extra["thaw_wait_ms"] = thawWait.Milliseconds()
+	}
+	if waited.attempts > 0 {
+		extra["waited_ms"] = time.Since(waited.since).Milliseconds()
+		extra["attempts"] = waited.attempts
+	}
+	if lk.Mode != "" {
+		extra["mode"] = lk.Mode
+	}
+	if lk.Message != "" {
+		extra["message"] = lk.Message
+	}
+	if len(lk.Labels) > 0 {
+		extra["labels"] = lk.Labels
+	}
+	if lk.Session != "" {
+		extra["session"] = lk.Session
+	}
+	if len(extra) == 0 {
+		extra = nil
+	}
 	w.Emit(&audit.Event{
 		Event:   audit.EventAcquire,
+		Name:    lk.Name,
+		LockID:  lk.LockID,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		TTLSec:  lk.TTLSec,
+		Extra:   extra,
+	})
+}
+
+// emitDenyEvent emits a deny audit event with holder info. Safe to call with nil auditor.
+func emitDenyEvent(w *audit.Writer, id identity.Identity, name string, ttlSec int, holder *lockfile.Lock, retryAfter time.Duration) {
+	if w == nil {
+		return
+	}
+	extra := map[string]any{
+		"holder_owner":    holder.Owner,
+		"holder_host":     holder.Host,
+		"holder_pid":      holder.PID,
+		"retry_after_sec": int(retryAfter.Seconds()),
+	}
+	w.Emit(&audit.Event{
+		Event:   audit.EventDeny,
 		Name:    name,
-		LockID:  lockID,
 		Owner:   id.Owner,
 		Host:    id.Host,
 		PID:     id.PID,
 		AgentID: id.AgentID,
 		TTLSec:  ttlSec,
+		Extra:   extra,
 	})
 }
 
-// emitDenyEvent emits a deny audit event with holder info. Safe to call with nil auditor.
-func emitDenyEvent(w *audit.Writer, id identity.Identity, name string, ttlSec int, holder *lockfile.Lock) {
+// emitWaitTimeoutEvent records that a wait for name ran out of time after
+// attempts attempts over waited, with holder the last one seen. Safe to
+// call with nil auditor.
+func emitWaitTimeoutEvent(w *audit.Writer, id identity.Identity, name string, waited time.Duration, attempts int, holder *lockfile.Lock) {
 	if w == nil {
 		return
 	}
 	extra := map[string]any{
+		"waited_ms":    waited.Milliseconds(),
+		"attempts":     attempts,
 		"holder_owner": holder.Owner,
 		"holder_host":  holder.Host,
 		"holder_pid":   holder.PID,
 	}
+	if holder.LockID != "" {
+		extra["holder_lock_id"] = holder.LockID
+	}
+	if holder.Name != name {
+		extra["conflicting_lock"] = holder.Name
+	}
 	w.Emit(&audit.Event{
-		Event:   audit.EventDeny,
+		Event:   audit.EventWaitTimeout,
+		Name:    name,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra:   extra,
+	})
+}
+
+// emitSkipEvent records that TryAcquire found name held and the caller
+// skipped its work. Safe to call with nil auditor.
+func emitSkipEvent(w *audit.Writer, id identity.Identity, name string, held *HeldError) {
+	if w == nil {
+		return
+	}
+	extra := map[string]any{
+		"holder_owner": held.Lock.Owner,
+		"holder_host":  held.Lock.Host,
+		"holder_pid":   held.Lock.PID,
+	}
+	if held.Lock.Name != name {
+		extra["conflicting_lock"] = held.Lock.Name
+	}
+	w.Emit(&audit.Event{
+		Event:   audit.EventSkip,
 		Name:    name,
 		Owner:   id.Owner,
 		Host:    id.Host,
 		PID:     id.PID,
 		AgentID: id.AgentID,
-		TTLSec:  ttlSec,
 		Extra:   extra,
 	})
 }
@@ -327,20 +769,20 @@ func emitCorruptBreakEvent(w *audit.Writer, id identity.Identity, name string) {
 		Host:    id.Host,
 		PID:     id.PID,
 		AgentID: id.AgentID,
+		Extra:   staleReasonExtra(stale.ReasonCorrupted),
 	})
 }
 
 // emitAutoPruneEvent emits an auto-prune audit event. Safe to call with nil auditor.
 // Records that a stale lock (dead PID on same host) was automatically removed.
-func emitAutoPruneEvent(w *audit.Writer, id identity.Identity, name string, pruned *lockfile.Lock) {
+func emitAutoPruneEvent(w *audit.Writer, id identity.Identity, name string, pruned *lockfile.Lock, reason stale.Reason) {
 	if w == nil {
 		return
 	}
-	extra := map[string]any{
-		"pruned_owner": pruned.Owner,
-		"pruned_host":  pruned.Host,
-		"pruned_pid":   pruned.PID,
-	}
+	extra := staleReasonExtra(reason)
+	extra["pruned_owner"] = pruned.Owner
+	extra["pruned_host"] = pruned.Host
+	extra["pruned_pid"] = pruned.PID
 	w.Emit(&audit.Event{
 		Event:   audit.EventAutoPrune,
 		Name:    name,
@@ -352,3 +794,27 @@ func emitAutoPruneEvent(w *audit.Writer, id identity.Identity, name string, prun
 		Extra:   extra,
 	})
 }
+
+// staleReasonExtra returns audit extras carrying a stale reason as both its
+// stable identifier (stale_reason) and human sentence (stale_reason_text).
+func staleReasonExtra(r stale.Reason) map[string]any {
+	return map[string]any{
+		"stale_reason":      string(r),
+		"stale_reason_text": r.Description(),
+	}
+}
+
+// SameHolder reports whether lf was taken by the identity id for the purpose
+// of re-acquiring it: the owners match and, if either side ran under an
+// explicit LOKT_AGENT_ID, so do the agent IDs. Agent sessions sharing an OS
+// user therefore don't refresh each other's locks, while plain CLI use
+// (generated, per-process agent IDs) matches on owner alone.
+func SameHolder(lf *lockfile.Lock, id identity.Identity) bool {
+	if lf.Owner != id.Owner {
+		return false
+	}
+	if lf.AgentExplicit || id.AgentExplicit {
+		return lf.AgentExplicit == id.AgentExplicit && lf.AgentID == id.AgentID
+	}
+	return true
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -330,6 +331,119 @@ func TestAcquireWithWait_ContextCancellation(t *testing.T) {
 	if !errors.Is(err, context.DeadlineExceeded) {
 		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
 	}
+	var waitErr *WaitError
+	if !errors.As(err, &waitErr) || waitErr.Attempts < 2 || waitErr.Waited < 200*time.Millisecond {
+		t.Errorf("error = %#v, want a *WaitError counting several attempts over the 200ms", err)
+	}
+	if !strings.Contains(err.Error(), "gave up after") {
+		t.Errorf("Error() = %q, want the attempt count", err.Error())
+	}
+}
+
+func TestAcquireWithWait_ReportsProgress(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatalf("MkdirAll error = %v", err)
+	}
+	otherLock := &lockfile.Lock{
+		Name:       "progress-test",
+		Owner:      "other-owner",
+		Host:       "other-host",
+		PID:        99999,
+		AcquiredAt: time.Now(),
+	}
+	if err := lockfile.Write(filepath.Join(locksDir, "progress-test.json"), otherLock); err != nil {
+		t.Fatalf("Write lock error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	var reports []time.Duration
+	err := AcquireWithWait(ctx, root, "progress-test", AcquireOptions{
+		Retry:            RetryPolicy{Base: 10 * time.Millisecond, Max: 10 * time.Millisecond},
+		ProgressInterval: 100 * time.Millisecond,
+		OnProgress: func(holder *lockfile.Lock, waited time.Duration) {
+			if holder == nil || holder.Owner != "other-owner" {
+				t.Errorf("holder = %+v, want other-owner's lock", holder)
+			}
+			reports = append(reports, waited)
+		},
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	// Paced by the interval, not by the ~30 attempts.
+	if len(reports) < 1 || len(reports) > 3 {
+		t.Fatalf("got %d reports %v, want one per 100ms of the 300ms wait", len(reports), reports)
+	}
+	if reports[0] < 100*time.Millisecond {
+		t.Errorf("first report after %s, want one interval in", reports[0])
+	}
+}
+
+func TestAcquireWithWait_AuditsWait(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	holder := &lockfile.Lock{
+		Name: "wait-audit", LockID: "holder-id", Owner: "other-owner", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	}
+	if err := lockfile.Write(filepath.Join(locksDir, "wait-audit.json"), holder); err != nil {
+		t.Fatal(err)
+	}
+	opts := AcquireOptions{Auditor: audit.NewWriter(root)}
+	num := func(v any) float64 { f, _ := v.(float64); return f }
+
+	// Gives up: a wait-timeout event naming the holder
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if err := AcquireWithWait(ctx, root, "wait-audit", opts); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AcquireWithWait() error = %v, want deadline exceeded", err)
+	}
+	var timeout *audit.Event
+	for _, e := range readAuditEvents(t, root) {
+		if e.Event == audit.EventWaitTimeout {
+			timeout = &e
+		}
+	}
+	if timeout == nil {
+		t.Fatal("no wait-timeout event")
+	}
+	if timeout.Extra["holder_owner"] != "other-owner" || timeout.Extra["holder_lock_id"] != "holder-id" ||
+		num(timeout.Extra["waited_ms"]) < 150 || num(timeout.Extra["attempts"]) < 2 {
+		t.Errorf("wait-timeout extra = %v", timeout.Extra)
+	}
+
+	// Succeeds after waiting: the acquire event says for how long
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = Release(root, "wait-audit", ReleaseOptions{Force: true})
+	}()
+	if err := AcquireWithWait(context.Background(), root, "wait-audit", opts); err != nil {
+		t.Fatalf("AcquireWithWait() error = %v", err)
+	}
+	var acquired *audit.Event
+	for _, e := range readAuditEvents(t, root) {
+		if e.Event == audit.EventAcquire {
+			acquired = &e
+		}
+	}
+	if acquired == nil || num(acquired.Extra["waited_ms"]) < 100 || num(acquired.Extra["attempts"]) < 2 {
+		t.Errorf("acquire event = %+v, want waited_ms and attempts", acquired)
+	}
+
+	// An acquisition that didn't wait has neither
+	if err := AcquireWithWait(context.Background(), root, "no-wait", opts); err != nil {
+		t.Fatal(err)
+	}
+	events := readAuditEvents(t, root)
+	if last := events[len(events)-1]; last.Extra["waited_ms"] != nil || last.Extra["attempts"] != nil {
+		t.Errorf("immediate acquire extra = %v, want no wait fields", last.Extra)
+	}
 }
 
 func TestAcquireWithWait_BreaksExpiredLock(t *testing.T) {
@@ -437,43 +551,6 @@ func TestAcquireWithWait_PreservesTTL(t *testing.T) {
 	}
 }
 
-func TestBackoffInterval(t *testing.T) {
-	// Expected multipliers for each attempt
-	multipliers := []time.Duration{1, 2, 4, 8, 16, 32, 64}
-
-	// Test exponential growth
-	for attempt := 0; attempt < 10; attempt++ {
-		interval := backoffInterval(attempt)
-
-		// Calculate expected base interval
-		var multiplier time.Duration = 64 // capped at attempt >= 6
-		if attempt < len(multipliers) {
-			multiplier = multipliers[attempt]
-		}
-		expectedBase := baseInterval * multiplier
-		if expectedBase > maxInterval {
-			expectedBase = maxInterval
-		}
-
-		minExpected := time.Duration(float64(expectedBase) * 0.75)
-		maxExpected := time.Duration(float64(expectedBase) * 1.25)
-
-		if interval < minExpected || interval > maxExpected {
-			t.Errorf("attempt %d: interval %v outside expected range [%v, %v]",
-				attempt, interval, minExpected, maxExpected)
-		}
-	}
-
-	// After many attempts, should be capped at maxInterval (±jitter)
-	interval := backoffInterval(100)
-	if interval < time.Duration(float64(maxInterval)*0.75) {
-		t.Errorf("high attempt interval %v should be near maxInterval", interval)
-	}
-	if interval > time.Duration(float64(maxInterval)*1.25) {
-		t.Errorf("high attempt interval %v exceeds maxInterval with jitter", interval)
-	}
-}
-
 // readAuditEvents reads all events from the audit log file.
 func readAuditEvents(t *testing.T, rootDir string) []audit.Event {
 	t.Helper()
@@ -499,6 +576,75 @@ func readAuditEvents(t *testing.T, rootDir string) []audit.Event {
 	return events
 }
 
+func TestTryAcquire(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+	if err := os.MkdirAll(filepath.Join(root, "locks"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(filepath.Join(root, "locks", "busy.json"), &lockfile.Lock{
+		Version: 1, Name: "busy", Owner: "other-owner", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := TryAcquire(root, "busy", AcquireOptions{Auditor: auditor})
+	if err != nil || res.Acquired || res.Held == nil || res.Held.Lock.Owner != "other-owner" {
+		t.Fatalf("TryAcquire(held) = %+v, %v; want the holder and no error", res, err)
+	}
+	if res, err := TryAcquire(root, "free", AcquireOptions{Auditor: auditor}); err != nil || !res.Acquired {
+		t.Fatalf("TryAcquire(free) = %+v, %v; want acquired", res, err)
+	}
+	if _, err := TryAcquire(root, "../bad", AcquireOptions{}); err == nil {
+		t.Error("TryAcquire(invalid name) should be a hard error")
+	}
+
+	var skips int
+	for _, e := range readAuditEvents(t, root) {
+		if e.Event == audit.EventSkip {
+			skips++
+			if e.Name != "busy" || e.Extra["holder_owner"] != "other-owner" {
+				t.Errorf("skip event = %+v, want busy held by other-owner", e)
+			}
+		}
+	}
+	if skips != 1 {
+		t.Errorf("got %d skip events, want 1", skips)
+	}
+}
+
+func TestAcquire_Metadata(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+	opts := AcquireOptions{
+		Auditor: auditor,
+		Message: "schema\nmigration #482",
+		Labels:  map[string]string{"pr": "482"},
+	}
+	if err := Acquire(root, "migrate", opts); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	lf, err := lockfile.Read(filepath.Join(root, "locks", "migrate.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lf.Message != "schema migration #482" || lf.Labels["pr"] != "482" {
+		t.Errorf("lock file message %q, labels %v; want the cleaned message and the label", lf.Message, lf.Labels)
+	}
+	events := readAuditEvents(t, root)
+	if len(events) != 1 || events[0].Extra["message"] != lf.Message || events[0].Extra["labels"] == nil {
+		t.Errorf("acquire event = %+v, want the message and labels", events)
+	}
+
+	held := &HeldError{Lock: lf}
+	if !strings.Contains(held.Error(), "doing: schema migration #482") {
+		t.Errorf("HeldError = %q, want the holder's message", held.Error())
+	}
+	if err := Acquire(root, "other", AcquireOptions{Labels: map[string]string{"bad key": "x"}}); !errors.Is(err, lockfile.ErrInvalidLabel) {
+		t.Errorf("Acquire(bad label) error = %v, want ErrInvalidLabel", err)
+	}
+}
+
 func TestAcquireEmitsAuditEvent(t *testing.T) {
 	root := t.TempDir()
 	auditor := audit.NewWriter(root)
@@ -875,6 +1021,27 @@ func TestAcquire_AutoPrunesCorruptedLock(t *testing.T) {
 	}
 }
 
+func TestAcquire_AutoPrunesInvalidLockFiles(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		// JSON, but no lock: it used to block the name for good
+		"stray":     []byte(`{"version":1,"owner":"someone"}`),
+		"oversized": []byte(strings.Repeat(" ", lockfile.MaxFileSize+1)),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(locksDir, name+".json"), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := Acquire(root, name, AcquireOptions{}); err != nil {
+			t.Errorf("Acquire(%s) error = %v, want the file pruned", name, err)
+		}
+	}
+}
+
 func TestAcquire_CorruptedLockEmitsAuditEvent(t *testing.T) {
 	root := t.TempDir()
 	auditor := audit.NewWriter(root)
@@ -931,7 +1098,7 @@ func TestTryBreakStale_RemovesCorruptedLock(t *testing.T) {
 	}
 
 	// tryBreakStale should remove corrupted lock
-	removed := tryBreakStale(root, "corrupt-stale")
+	removed := tryBreakStale(root, "corrupt-stale", nil, 0)
 	if !removed {
 		t.Error("tryBreakStale() should return true for corrupted lock")
 	}
@@ -942,6 +1109,32 @@ func TestTryBreakStale_RemovesCorruptedLock(t *testing.T) {
 	}
 }
 
+func TestTryBreakStale_AuditsExpiredRemoval(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(-time.Second)
+	if err := lockfile.Write(filepath.Join(locksDir, "expired.json"), &lockfile.Lock{
+		Version: 1, Name: "expired", LockID: "crashed-id", Owner: "crashed", Host: "remote-host", PID: 1,
+		AcquiredAt: time.Now().Add(-time.Minute), TTLSec: 1, ExpiresAt: &exp,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !tryBreakStale(root, "expired", audit.NewWriter(root), 0) {
+		t.Fatal("tryBreakStale() should remove an expired lock")
+	}
+	events := readAuditEvents(t, root)
+	if len(events) != 1 || events[0].Event != audit.EventAutoPrune {
+		t.Fatalf("expected one auto-prune event, got %+v", events)
+	}
+	if events[0].LockID != "crashed-id" || events[0].Extra["stale_reason"] != "expired" || events[0].Extra["pruned_owner"] != "crashed" {
+		t.Errorf("unexpected auto-prune event: %+v", events[0])
+	}
+}
+
 // Reentrant acquire tests for lokt-skc
 
 func TestAcquire_ReentrantSameOwner(t *testing.T) {
@@ -1125,6 +1318,68 @@ func TestAcquire_ReentrantExpiredSameOwner(t *testing.T) {
 	}
 }
 
+func TestAcquire_ReentrantAgentSessions(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("LOKT_OWNER", "shared-user")
+
+	t.Setenv("LOKT_AGENT_ID", "session-a")
+	if err := Acquire(root, "sessions", AcquireOptions{}); err != nil {
+		t.Fatalf("Acquire() as session-a error = %v", err)
+	}
+	if err := Acquire(root, "sessions", AcquireOptions{}); err != nil {
+		t.Fatalf("re-Acquire() as session-a error = %v", err)
+	}
+
+	// Another session of the same owner must not refresh session-a's lock
+	t.Setenv("LOKT_AGENT_ID", "session-b")
+	var held *HeldError
+	if err := Acquire(root, "sessions", AcquireOptions{}); !errors.As(err, &held) {
+		t.Fatalf("Acquire() as session-b error = %v, want *HeldError", err)
+	}
+	if held.Lock.AgentID != "session-a" || !held.Lock.AgentExplicit {
+		t.Errorf("holder agent = %q (explicit %v), want session-a", held.Lock.AgentID, held.Lock.AgentExplicit)
+	}
+	if err := Check(root, "sessions", 0, nil); !errors.As(err, &held) {
+		t.Errorf("Check() as session-b error = %v, want *HeldError", err)
+	}
+
+	// Nor may a plain process of that owner
+	t.Setenv("LOKT_AGENT_ID", "")
+	if err := Acquire(root, "sessions", AcquireOptions{}); !errors.As(err, &held) {
+		t.Fatalf("Acquire() without LOKT_AGENT_ID error = %v, want *HeldError", err)
+	}
+}
+
+func TestSameHolder(t *testing.T) {
+	lf := func(agent string, explicit bool) *lockfile.Lock {
+		return &lockfile.Lock{Owner: "alice", AgentID: agent, AgentExplicit: explicit}
+	}
+	id := func(owner, agent string, explicit bool) identity.Identity {
+		return identity.Identity{Owner: owner, AgentID: agent, AgentExplicit: explicit}
+	}
+	tests := []struct {
+		name string
+		lf   *lockfile.Lock
+		id   identity.Identity
+		want bool
+	}{
+		{"generated IDs, same owner", lf("agent-1a2b", false), id("alice", "agent-3c4d", false), true},
+		{"different owner", lf("agent-1a2b", false), id("bob", "agent-1a2b", false), false},
+		{"same explicit agent", lf("ci-7", true), id("alice", "ci-7", true), true},
+		{"different explicit agent", lf("ci-7", true), id("alice", "ci-8", true), false},
+		{"explicit holder, generated caller", lf("ci-7", true), id("alice", "agent-3c4d", false), false},
+		{"generated holder, explicit caller", lf("agent-1a2b", false), id("alice", "ci-7", true), false},
+		{"lock from before agent IDs", lf("", false), id("alice", "agent-3c4d", false), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SameHolder(tt.lf, tt.id); got != tt.want {
+				t.Errorf("SameHolder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAcquire_ReentrantEmitsRenewAudit(t *testing.T) {
 	root := t.TempDir()
 	auditor := audit.NewWriter(root)
@@ -1440,3 +1695,126 @@ func TestLockID_UniquePerAcquisition(t *testing.T) {
 		t.Errorf("Different acquisitions should have different lock_ids, both got %q", id1)
 	}
 }
+
+// TestStaleReasonExtras_Golden pins the stale_reason / stale_reason_text
+// extras for every audit event that records why a lock was removed.
+func TestStaleReasonExtras_Golden(t *testing.T) {
+	hostname, _ := os.Hostname()
+	expired := time.Now().Add(-2 * time.Minute)
+	deadLock := func(name string) *lockfile.Lock {
+		return &lockfile.Lock{
+			Version: 1, Name: name, Owner: "departed", Host: hostname, PID: 999999,
+			AcquiredAt: expired, TTLSec: 60, ExpiresAt: &expired,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		event  string
+		reason string
+		text   string
+		run    func(t *testing.T, rootDir string, auditor *audit.Writer)
+	}{
+		{
+			name: "auto-prune", event: audit.EventAutoPrune,
+			reason: "dead_pid", text: "holder process is no longer running",
+			run: func(t *testing.T, rootDir string, auditor *audit.Writer) {
+				lk := deadLock("a")
+				lk.TTLSec, lk.ExpiresAt = 0, nil
+				writeLock(t, filepath.Join(rootDir, "locks"), "a", lk)
+				if err := Acquire(rootDir, "a", AcquireOptions{Auditor: auditor}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "stale-break", event: audit.EventStaleBreak,
+			reason: "expired", text: "lock TTL has expired",
+			run: func(t *testing.T, rootDir string, auditor *audit.Writer) {
+				writeLock(t, filepath.Join(rootDir, "locks"), "a", deadLock("a"))
+				if err := Release(rootDir, "a", ReleaseOptions{BreakStale: true, Auditor: auditor}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "sweep", event: audit.EventAutoPrune,
+			reason: "dead_pid", text: "holder process is no longer running",
+			run: func(t *testing.T, rootDir string, auditor *audit.Writer) {
+				writeLock(t, filepath.Join(rootDir, "locks"), "a", deadLock("a"))
+				PruneAllExpired(rootDir, auditor, 0)
+			},
+		},
+		{
+			name: "corrupt-break", event: audit.EventCorruptBreak,
+			reason: "corrupted", text: "lock file is corrupted or unreadable",
+			run: func(t *testing.T, rootDir string, auditor *audit.Writer) {
+				path := filepath.Join(rootDir, "locks", "a.json")
+				if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+					t.Fatal(err)
+				}
+				if err := Release(rootDir, "a", ReleaseOptions{BreakStale: true, Auditor: auditor}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rootDir := setupSweepRoot(t)
+			tc.run(t, rootDir, audit.NewWriter(rootDir))
+
+			var found bool
+			for _, e := range readAuditEvents(t, rootDir) {
+				if e.Event != tc.event {
+					continue
+				}
+				found = true
+				if e.Extra["stale_reason"] != tc.reason {
+					t.Errorf("stale_reason = %v, want %q", e.Extra["stale_reason"], tc.reason)
+				}
+				if e.Extra["stale_reason_text"] != tc.text {
+					t.Errorf("stale_reason_text = %v, want %q", e.Extra["stale_reason_text"], tc.text)
+				}
+			}
+			if !found {
+				t.Fatalf("no %s event emitted", tc.event)
+			}
+		})
+	}
+}
+
+func TestAcquire_Namespaced(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("LOKT_OWNER", "agent-ns")
+
+	for _, name := range []string{"team/frontend/build", "team/deploy"} {
+		if err := Acquire(root, name, AcquireOptions{}); err != nil {
+			t.Fatalf("Acquire(%q) error = %v", name, err)
+		}
+	}
+	lf, err := lockfile.Read(filepath.Join(root, "locks", "team", "frontend", "build.json"))
+	if err != nil || lf.Name != "team/frontend/build" {
+		t.Fatalf("nested lock file = %+v, %v", lf, err)
+	}
+	t.Setenv("LOKT_OWNER", "agent-other")
+	var held *HeldError
+	if err := Acquire(root, "team/deploy", AcquireOptions{}); err == nil {
+		t.Error("Acquire(team/deploy) by another owner should fail")
+	} else if !errors.As(err, &held) {
+		t.Errorf("Acquire(team/deploy) by another owner error = %v, want HeldError", err)
+	}
+	t.Setenv("LOKT_OWNER", "agent-ns")
+
+	if err := Release(root, "team/deploy", ReleaseOptions{}); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	released, err := ReleaseByOwner(root, "agent-ns", ReleaseOptions{})
+	if err != nil {
+		t.Fatalf("ReleaseByOwner() error = %v", err)
+	}
+	if len(released) != 1 || released[0] != "team/frontend/build" {
+		t.Errorf("ReleaseByOwner() = %v, want the nested lock", released)
+	}
+}
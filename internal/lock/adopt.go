@@ -0,0 +1,133 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// AdoptOptions configures Adopt.
+type AdoptOptions struct {
+	Auditor *audit.Writer // Optional audit writer for event logging
+	// PID is the process to hold the lock from now on. It must be running
+	// on this host, the host the lock was taken on.
+	PID int
+}
+
+// TokenMismatchError is returned by Adopt when the handoff token isn't the
+// lock's lock_id: the handed-off lock was released and the name taken
+// again, or the token is wrong.
+type TokenMismatchError struct {
+	Lock  *lockfile.Lock
+	Token string
+}
+
+func (e *TokenMismatchError) Error() string {
+	return fmt.Sprintf("lock %q is held by %s@%s as lock_id %s, not the handed-off %s",
+		e.Lock.Name, e.Lock.Owner, e.Lock.Host, e.Lock.LockID, e.Token)
+}
+
+func (e *TokenMismatchError) Unwrap() error {
+	return ErrNotOwner
+}
+
+// Adopt makes the process opts.PID the holder of name, a lock taken with
+// AcquireOptions.Handoff by a process that has since exited (lock
+// --handoff, in a systemd ExecStartPre). token is the lock_id the handoff
+// printed. The lock's pid and pid_start_ns are rewritten to opts.PID and
+// it is no longer retained, so from here on it is stale once that process
+// is gone, like any other. The rewrite is a Replace that re-checks the
+// token, and an adopt event records the previous PID.
+//
+// Returns the adopted lock, an error wrapping ErrNotFound if name isn't
+// held, a *TokenMismatchError if it is held under another lock_id, and an
+// error if the lock is from another host or opts.PID isn't running.
+func Adopt(rootDir, name, token string, opts AdoptOptions) (*lockfile.Lock, error) {
+	if err := lockfile.ValidateName(name); err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, errors.New("adopt needs the handoff token (the lock_id lock --handoff printed)")
+	}
+	if opts.PID <= 0 {
+		return nil, fmt.Errorf("invalid pid %d", opts.PID)
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	path := root.LockFilePath(rootDir, name)
+	current := func() (*lockfile.Lock, error) {
+		lk, err := lockfile.Read(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return nil, fmt.Errorf("%w: %q isn't held, there is nothing to adopt", ErrNotFound, name)
+		case err != nil:
+			return nil, fmt.Errorf("read lock: %w", err)
+		case lk.LockID != token:
+			return nil, &TokenMismatchError{Lock: lk, Token: token}
+		}
+		return lk, nil
+	}
+	prev, err := current()
+	if err != nil {
+		return nil, err
+	}
+	if hostname, err := os.Hostname(); err != nil || hostname != prev.Host {
+		return nil, fmt.Errorf("lock %q was taken on %s; adopt it from a process there", name, prev.Host)
+	}
+	if !stale.IsProcessAlive(opts.PID) {
+		return nil, fmt.Errorf("pid %d is not running on this host", opts.PID)
+	}
+
+	lk := *prev
+	lk.Version = lockfile.WriteVersion()
+	lk.PID = opts.PID
+	lk.PIDStartNS = 0
+	if startNS, err := stale.GetProcessStartTime(opts.PID); err == nil {
+		lk.PIDStartNS = startNS
+	}
+	lk.Retained = false
+	lk.Flock = false // a flock would have to be taken by the new holder
+	err = lockfile.Replace(path, &lk, func() error {
+		_, err := current()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	emitAdoptEvent(opts.Auditor, &lk, prev)
+	return &lk, nil
+}
+
+// emitAdoptEvent records that lk, handed off by prev's process, is now held
+// by lk.PID. Safe to call with nil auditor.
+func emitAdoptEvent(w *audit.Writer, lk, prev *lockfile.Lock) {
+	if w == nil {
+		return
+	}
+	id := identity.Current()
+	w.Emit(&audit.Event{
+		Event:   audit.EventAdopt,
+		Name:    lk.Name,
+		LockID:  lk.LockID,
+		Owner:   lk.Owner,
+		Host:    lk.Host,
+		PID:     lk.PID,
+		AgentID: lk.AgentID,
+		TTLSec:  lk.TTLSec,
+		Extra: map[string]any{
+			"previous_pid": prev.PID,
+			"adopted_by":   id.PID,
+		},
+	})
+}
@@ -0,0 +1,98 @@
+package lock
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// startDaemon starts a process to adopt locks, killed at cleanup.
+func startDaemon(t *testing.T) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("can't start a process to adopt the lock: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	return cmd
+}
+
+func TestAdopt(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := Acquire(rootDir, "svc", AcquireOptions{Handoff: true}); err != nil {
+		t.Fatal(err)
+	}
+	path := root.LockFilePath(rootDir, "svc")
+	handed, err := lockfile.Read(path)
+	if err != nil || !handed.Retained {
+		t.Fatalf("handed-off lock = %+v, %v; want it retained", handed, err)
+	}
+
+	daemon := startDaemon(t)
+	lk, err := Adopt(rootDir, "svc", handed.LockID, AdoptOptions{PID: daemon.Process.Pid, Auditor: audit.NewWriter(rootDir)})
+	if err != nil {
+		t.Fatalf("Adopt() error = %v", err)
+	}
+	got, err := lockfile.Read(path)
+	if err != nil || got.PID != daemon.Process.Pid || got.Retained || got.LockID != handed.LockID || got.Owner != handed.Owner {
+		t.Fatalf("adopted lock = %+v, %v; want pid %d, same lock_id and owner", got, err, daemon.Process.Pid)
+	}
+	if lk.PIDStartNS != got.PIDStartNS {
+		t.Errorf("returned lock %+v differs from the file %+v", lk, got)
+	}
+	if r := stale.Check(got); r.Stale {
+		t.Errorf("adopted lock is stale (%s) while its process runs", r.Reason)
+	}
+	events := readAuditEvents(t, rootDir)
+	if len(events) != 1 || events[0].Event != audit.EventAdopt || events[0].PID != daemon.Process.Pid ||
+		events[0].Extra["previous_pid"] != float64(handed.PID) {
+		t.Errorf("audit events = %+v, want one adopt naming the previous pid", events)
+	}
+
+	// Liveness now follows the adopting process.
+	_ = daemon.Process.Kill()
+	_ = daemon.Wait()
+	if r := stale.Check(got); r.Reason != stale.ReasonDeadPID {
+		t.Errorf("after the daemon exits: %+v, want dead_pid", r)
+	}
+	if _, err := Adopt(rootDir, "svc", handed.LockID, AdoptOptions{PID: daemon.Process.Pid}); err == nil {
+		t.Error("adopting for an exited process succeeded")
+	}
+}
+
+func TestAdopt_Refusals(t *testing.T) {
+	rootDir := t.TempDir()
+	daemon := startDaemon(t)
+	opts := AdoptOptions{PID: daemon.Process.Pid}
+
+	if _, err := Adopt(rootDir, "svc", "some-id", opts); !errors.Is(err, ErrNotFound) {
+		t.Errorf("not held: error = %v, want ErrNotFound", err)
+	}
+
+	if err := Acquire(rootDir, "svc", AcquireOptions{Handoff: true}); err != nil {
+		t.Fatal(err)
+	}
+	var mismatch *TokenMismatchError
+	if _, err := Adopt(rootDir, "svc", "wrong-id", opts); !errors.As(err, &mismatch) || !errors.Is(err, ErrNotOwner) {
+		t.Errorf("wrong token: error = %v, want a *TokenMismatchError", err)
+	}
+	if _, err := Adopt(rootDir, "svc", "", opts); err == nil {
+		t.Error("empty token accepted")
+	}
+
+	plantHolder(t, rootDir, "remote", "agent-a", "a-id", false)
+	if _, err := Adopt(rootDir, "remote", "a-id", opts); err == nil {
+		t.Error("adopted a lock taken on another host")
+	}
+	if lf, _ := lockfile.Read(root.LockFilePath(rootDir, "remote")); lf == nil || lf.PID != 99999 {
+		t.Errorf("refused adopt changed the lock: %+v", lf)
+	}
+}
@@ -22,9 +22,9 @@ type corruptionCase struct {
 	name    string
 	content []byte
 	// isAutoRecoverable means Acquire auto-prunes and succeeds.
-	// When false, the corruption is not detected as ErrCorrupted
-	// (e.g., empty file, valid-JSON-wrong-schema) and Acquire returns
-	// a HeldError instead.
+	// When false, the corruption is not detected as lockfile.Broken
+	// (an empty file, which may be mid-write) and Acquire returns a
+	// HeldError instead.
 	isAutoRecoverable bool
 }
 
@@ -58,8 +58,8 @@ var corruptionCases = []corruptionCase{
 	{
 		name:    "wrong_schema",
 		content: []byte(`{"foo":"bar","baz":42}`), // valid JSON, zero-value Lock
-		// Parses into Lock with all zero values — treated as held, not corrupted.
-		isAutoRecoverable: false,
+		// No name, pid or acquired_ts — ErrInvalidSchema, pruned like corruption.
+		isAutoRecoverable: true,
 	},
 }
 
@@ -178,7 +178,7 @@ func TestChaos_TryBreakStale_NoPanic(t *testing.T) {
 			}
 
 			// Must not panic.
-			removed := tryBreakStale(root, lockName)
+			removed := tryBreakStale(root, lockName, nil, 0)
 
 			if tc.isAutoRecoverable {
 				if !removed {
@@ -292,8 +292,9 @@ func TestChaos_Release_CorruptedAudit(t *testing.T) {
 }
 
 // TestChaos_WrongSchema_Details verifies the specific behavior for
-// valid-JSON-wrong-schema: it parses into a zero-value Lock, which is
-// treated as an active lock (not corrupted).
+// valid-JSON-wrong-schema: it is ErrInvalidSchema, not ErrCorrupted, and
+// Acquire prunes it rather than treating it as held (which blocked the
+// name until someone force-unlocked it).
 func TestChaos_WrongSchema_Details(t *testing.T) {
 	root := t.TempDir()
 	locksDir := filepath.Join(root, "locks")
@@ -307,20 +308,17 @@ func TestChaos_WrongSchema_Details(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err := Acquire(root, "wrong-schema", AcquireOptions{})
-
-	// Should get HeldError because the zero-value Lock is treated as held.
-	var held *HeldError
-	if !errors.As(err, &held) {
-		t.Fatalf("Expected HeldError, got: %v", err)
+	if _, err := lockfile.Read(path); !errors.Is(err, lockfile.ErrInvalidSchema) || errors.Is(err, lockfile.ErrCorrupted) {
+		t.Fatalf("Read() error = %v, want ErrInvalidSchema only", err)
 	}
 
-	// The HeldError should contain a lock with zero values (no owner, no PID).
-	if held.Lock.Owner != "" {
-		t.Errorf("Lock.Owner = %q, want empty", held.Lock.Owner)
+	auditor := audit.NewWriter(root)
+	if err := Acquire(root, "wrong-schema", AcquireOptions{Auditor: auditor}); err != nil {
+		t.Fatalf("Acquire() error = %v, want the file pruned", err)
 	}
-	if held.Lock.PID != 0 {
-		t.Errorf("Lock.PID = %d, want 0", held.Lock.PID)
+	events := readAuditEvents(t, root)
+	if len(events) != 2 || events[0].Event != audit.EventCorruptBreak {
+		t.Errorf("audit events = %+v, want corrupt-break then acquire", events)
 	}
 }
 
@@ -767,7 +765,7 @@ func TestChaos_Sweep_PermDenied(t *testing.T) {
 	t.Cleanup(func() { _ = os.Chmod(locksDir, 0700) })
 
 	// PruneAllExpired should not panic.
-	pruned, errs := PruneAllExpired(root, nil)
+	pruned, errs := PruneAllExpired(root, nil, 0)
 
 	// Should report the lock was found but couldn't be removed.
 	// The exact behavior depends on whether ReadDir or Remove fails first.
@@ -0,0 +1,139 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// Check reports whether the current identity could acquire name right now,
+// without acquiring it. It returns nil if acquisition would succeed, a
+// *FrozenError if the name is frozen, a *ReservedError if it is reserved for
+// another owner right now, a *ConflictError if another member of one of its
+// exclusion groups is held, or a *HeldError if another owner holds it.
+//
+// Check is strictly read-only: it never prunes expired or dead holders and
+// emits no audit events. Holders that Acquire (or the pre-command sweep)
+// would remove — expired TTL, dead or recycled PID on this host — count as
+// free, as does a lock already held by the same owner (reentrant acquire).
+func Check(rootDir, name string, retryDefault time.Duration, groups map[string][]string) error {
+	if err := lockfile.ValidateName(name); err != nil {
+		return err
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return err
+	}
+
+	freeze, _, err := readFreezeFile(rootDir, name)
+	switch {
+	case err == nil && !freeze.IsExpired():
+		return &FrozenError{Lock: freeze, RetryAfter: RetryAfter(freeze, 0)}
+	case errors.Is(err, lockfile.ErrUnsupportedVersion), errors.Is(err, lockfile.ErrBadSignature):
+		return err // fail safe, as CheckFreeze does
+	}
+	if freeze, err := patternFrozen(rootDir, name); freeze != nil || err != nil {
+		if err != nil {
+			return err
+		}
+		return &FrozenError{Lock: freeze, RetryAfter: RetryAfter(freeze, 0)}
+	}
+	if err := reservedNow(rootDir, name, identity.Current(), 0); err != nil {
+		return err
+	}
+	if c := FindConflict(rootDir, name, groups, retryDefault); c != nil {
+		return c
+	}
+
+	existing, err := lockfile.Read(root.LockFilePath(rootDir, name))
+	switch {
+	case os.IsNotExist(err):
+		if held := sharedHeldError(liveSharedHolders(rootDir, name), retryDefault); held != nil {
+			return held
+		}
+		return nil
+	case lockfile.Broken(err):
+		return nil // Acquire removes corrupted and invalid lock files
+	case err != nil:
+		return err
+	}
+
+	if SameHolder(existing, identity.Current()) || existing.IsExpired() {
+		return nil
+	}
+	if result := stale.Check(existing); result.Stale && result.Reason.HolderGone() {
+		return nil
+	}
+	return &HeldError{Lock: existing, RetryAfter: RetryAfter(existing, retryDefault)}
+}
+
+// Outlook predicts what happens to an existing holder when someone tries to
+// acquire its name. The string values appear in JSON output and are stable.
+type Outlook string
+
+const (
+	// OutlookHeld: a live holder within its TTL; the caller must wait.
+	OutlookHeld Outlook = "held"
+	// OutlookReclaimable: the holder process is dead (same host), so the
+	// next acquire removes the lock.
+	OutlookReclaimable Outlook = "reclaimable"
+	// OutlookHolderRunning: the TTL has elapsed but the holder process is
+	// still running and will likely renew or release soon.
+	OutlookHolderRunning Outlook = "holder_running"
+	// OutlookCrossHost: the TTL has elapsed and the holder is on another
+	// host, so whether it is still running can't be verified.
+	OutlookCrossHost Outlook = "cross_host"
+)
+
+// Description returns a short human-readable form of the outlook.
+func (o Outlook) Description() string {
+	switch o {
+	case OutlookReclaimable:
+		return "reclaimable (holder process dead)"
+	case OutlookHolderRunning:
+		return "holder still running, likely to renew"
+	case OutlookCrossHost:
+		return "cross-host, cannot verify"
+	default:
+		return "held"
+	}
+}
+
+// Evaluation is the result of EvaluateLock.
+type Evaluation struct {
+	Outlook Outlook
+	// Reason is the staleness evaluation behind the outlook: why the lock
+	// is reclaimable, or ReasonExpired for an overrunning holder.
+	Reason stale.Reason
+	// RetryAfter is how long to wait before trying again; zero when the
+	// lock is reclaimable.
+	RetryAfter time.Duration
+}
+
+// EvaluateLock applies the staleness evaluation used by acquisition to an
+// existing holder and predicts the outcome. Unlike stale.Check it looks at
+// the holder process even when the TTL has elapsed, to tell a dead holder
+// from one that is merely overrunning. An overrunning holder gets one more
+// TTL (capped at MaxRetryAfter) to renew before callers try again. Read-only.
+func EvaluateLock(lf *lockfile.Lock, retryDefault time.Duration) Evaluation {
+	live := *lf
+	live.TTLSec, live.ExpiresAt = 0, nil
+	holder := stale.Check(&live)
+
+	switch {
+	case holder.Reason.HolderGone():
+		return Evaluation{Outlook: OutlookReclaimable, Reason: holder.Reason}
+	case !lf.IsExpired():
+		return Evaluation{Outlook: OutlookHeld, Reason: holder.Reason, RetryAfter: RetryAfter(lf, retryDefault)}
+	}
+	grace := min(max(time.Duration(lf.TTLSec)*time.Second, MinRetryAfter), MaxRetryAfter)
+	if holder.Reason == stale.ReasonUnknown {
+		return Evaluation{Outlook: OutlookCrossHost, Reason: stale.ReasonExpired, RetryAfter: grace}
+	}
+	return Evaluation{Outlook: OutlookHolderRunning, Reason: stale.ReasonExpired, RetryAfter: grace}
+}
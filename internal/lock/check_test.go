@@ -0,0 +1,116 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+func TestCheck(t *testing.T) {
+	t.Setenv("LOKT_OWNER", "me")
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(10 * time.Minute)
+	other := func(lk lockfile.Lock) *lockfile.Lock {
+		lk.Name = "deploy"
+		lk.Owner = "someone-else"
+		lk.Host = "other-host"
+		lk.PID = 99999
+		lk.AcquiredAt = time.Now().Add(-time.Hour)
+		return &lk
+	}
+
+	tests := []struct {
+		name   string
+		lock   *lockfile.Lock
+		freeze *lockfile.Lock
+		want   error
+	}{
+		{"free", nil, nil, nil},
+		{"held by another owner", other(lockfile.Lock{}), nil, ErrLockHeld},
+		{"held by me", &lockfile.Lock{Name: "deploy", Owner: "me", Host: "other-host", PID: 99999, AcquiredAt: time.Now()}, nil, nil},
+		{"expired holder", other(lockfile.Lock{TTLSec: 30, ExpiresAt: &past}), nil, nil},
+		{"frozen", nil, other(lockfile.Lock{TTLSec: 600, ExpiresAt: &future}), ErrFrozen},
+		{"expired freeze", nil, other(lockfile.Lock{TTLSec: 30, ExpiresAt: &past}), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := setupSweepRoot(t)
+			if tt.lock != nil {
+				writeLock(t, filepath.Join(rootDir, "locks"), "deploy", tt.lock)
+			}
+			if tt.freeze != nil {
+				writeLock(t, filepath.Join(rootDir, "freezes"), "deploy", tt.freeze)
+			}
+
+			err := Check(rootDir, "deploy", 0, nil)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Check() = %v, want %v", err, tt.want)
+			}
+
+			// Read-only: nothing pruned, nothing audited.
+			if tt.lock != nil {
+				if _, err := os.Stat(filepath.Join(rootDir, "locks", "deploy.json")); err != nil {
+					t.Errorf("Check must not remove the lock file: %v", err)
+				}
+			}
+			if tt.freeze != nil {
+				if _, err := os.Stat(filepath.Join(rootDir, "freezes", "deploy.json")); err != nil {
+					t.Errorf("Check must not remove the freeze file: %v", err)
+				}
+			}
+			if events := readSweepAuditEvents(t, rootDir); len(events) != 0 {
+				t.Errorf("Check must not emit audit events, got %+v", events)
+			}
+		})
+	}
+}
+
+func TestCheck_HeldCarriesRetryHint(t *testing.T) {
+	t.Setenv("LOKT_OWNER", "me")
+	rootDir := setupSweepRoot(t)
+	writeLock(t, filepath.Join(rootDir, "locks"), "deploy", &lockfile.Lock{
+		Name: "deploy", Owner: "other", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+
+	var held *HeldError
+	if err := Check(rootDir, "deploy", 2*time.Minute, nil); !errors.As(err, &held) || held.RetryAfter != 2*time.Minute {
+		t.Errorf("expected HeldError with the configured 2m hint, got %v", err)
+	}
+}
+
+func TestEvaluateLock(t *testing.T) {
+	host, _ := os.Hostname()
+	long := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name        string
+		lf          lockfile.Lock
+		wantOutlook Outlook
+		wantReason  stale.Reason
+		wantRetry   time.Duration
+	}{
+		{"live holder", lockfile.Lock{Host: host, PID: os.Getpid(), TTLSec: 300}, OutlookHeld, stale.ReasonNotStale, 5 * time.Minute},
+		{"live cross-host", lockfile.Lock{Host: "other-host", PID: 1}, OutlookHeld, stale.ReasonUnknown, DefaultRetryAfter},
+		{"dead holder", lockfile.Lock{Host: host, PID: 999999999, TTLSec: 300}, OutlookReclaimable, stale.ReasonDeadPID, 0},
+		{"expired, dead holder", lockfile.Lock{Host: host, PID: 999999999, TTLSec: 60, AcquiredAt: long}, OutlookReclaimable, stale.ReasonDeadPID, 0},
+		{"expired, holder running", lockfile.Lock{Host: host, PID: os.Getpid(), TTLSec: 180, AcquiredAt: long}, OutlookHolderRunning, stale.ReasonExpired, 3 * time.Minute},
+		{"expired, cross-host", lockfile.Lock{Host: "other-host", PID: 1, TTLSec: 3600, AcquiredAt: long.Add(-time.Hour)}, OutlookCrossHost, stale.ReasonExpired, MaxRetryAfter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := tt.lf
+			lf.Name, lf.Owner = "build", "other"
+			if lf.AcquiredAt.IsZero() {
+				lf.AcquiredAt = time.Now()
+			}
+			got := EvaluateLock(&lf, 0)
+			if got.Outlook != tt.wantOutlook || got.Reason != tt.wantReason || got.RetryAfter != tt.wantRetry {
+				t.Errorf("EvaluateLock() = %+v, want {%s %s %v}", got, tt.wantOutlook, tt.wantReason, tt.wantRetry)
+			}
+		})
+	}
+}
@@ -568,7 +568,7 @@ func TestSweep_SkipsSubdirectories(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	pruned, errs := PruneAllExpired(root, nil)
+	pruned, errs := PruneAllExpired(root, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0", pruned)
 	}
@@ -704,7 +704,7 @@ func TestSweep_ExpiredTTL_RecycledPID_SameHost(t *testing.T) {
 		ExpiresAt:  &expired,
 	})
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 1 {
 		t.Errorf("pruned = %d, want 1 (expired + recycled PID)", pruned)
 	}
@@ -738,7 +738,7 @@ func TestSweep_ExpiredTTL_SameHost_LivePID_MatchingStartTime(t *testing.T) {
 		ExpiresAt:  &expired,
 	})
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0 (same process still alive)", pruned)
 	}
@@ -909,7 +909,7 @@ func TestSweep_ReadDirError(t *testing.T) {
 	}
 	t.Cleanup(func() { _ = os.Chmod(locksDir, 0700) })
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0", pruned)
 	}
@@ -942,7 +942,7 @@ func TestSweep_RemoveFails(t *testing.T) {
 	}
 	t.Cleanup(func() { _ = os.Chmod(locksDir, 0700) })
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0 (remove should fail)", pruned)
 	}
@@ -1107,7 +1107,7 @@ func TestTryBreakStale_CorruptedRemoveFails(t *testing.T) {
 	}
 	t.Cleanup(func() { _ = os.Chmod(locksDir, 0700) })
 
-	result := tryBreakStale(root, "broken")
+	result := tryBreakStale(root, "broken", nil, 0)
 	if result {
 		t.Error("tryBreakStale() should return false when remove fails")
 	}
@@ -1144,7 +1144,7 @@ func TestTryBreakStale_StaleRemoveFails(t *testing.T) {
 	}
 	t.Cleanup(func() { _ = os.Chmod(locksDir, 0700) })
 
-	result := tryBreakStale(root, "stale-lock")
+	result := tryBreakStale(root, "stale-lock", nil, 0)
 	if result {
 		t.Error("tryBreakStale() should return false when remove fails")
 	}
@@ -0,0 +1,233 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// Deadlock detection. While AcquireWithWait waits, it keeps an intent
+// record, <root>/intents/<name>/<host>.<pid>.<nanos>.json, saying which
+// owner waits for which lock since when. On every poll it follows the
+// wait-for graph from the lock it wants: that lock's holders, the locks
+// those owners wait for, their holders, and so on. Getting back to its own
+// owner means no one in the cycle can ever proceed. Only the waiter that
+// started waiting last gives up, with a DeadlockError, so the others get
+// their locks once it releases what it holds.
+//
+// Intents are refreshed on every poll like waiter markers: ones not
+// refreshed within waiterFresh are ignored, and ones older than
+// waiterAbandoned or whose process is gone are removed when read, so a
+// crashed waiter never causes a false positive.
+
+// ErrDeadlock is the sentinel a DeadlockError unwraps to.
+var ErrDeadlock = errors.New("deadlock")
+
+// WaitEdge is one step of a wait-for cycle: Waiter waits for Lock, which
+// Holder holds. Waiter and Holder are owners.
+type WaitEdge struct {
+	Waiter string `json:"waiter"`
+	Lock   string `json:"lock"`
+	Holder string `json:"holder"`
+}
+
+// DeadlockError is returned by AcquireWithWait when the lock's holder waits,
+// directly or through other owners, for a lock the caller's owner holds.
+type DeadlockError struct {
+	Cycle []WaitEdge // starts with the caller's own wait
+}
+
+func (e *DeadlockError) Error() string {
+	steps := make([]string, len(e.Cycle))
+	for i, s := range e.Cycle {
+		steps[i] = fmt.Sprintf("%s waits for %q held by %s", s.Waiter, s.Lock, s.Holder)
+	}
+	return "deadlock: " + strings.Join(steps, ", ")
+}
+
+func (e *DeadlockError) Unwrap() error { return ErrDeadlock }
+
+// intent is one waiting process's intent record.
+type intent struct {
+	path string
+	lf   *lockfile.Lock
+}
+
+// registerIntent records that this process waits for name from now on.
+func registerIntent(rootDir, name string) (*intent, error) {
+	id := identity.Current()
+	lf := &lockfile.Lock{
+		Version:       lockfile.WriteVersion(),
+		Name:          name,
+		Owner:         id.Owner,
+		Host:          id.Host,
+		PID:           id.PID,
+		AgentID:       id.AgentID,
+		AgentExplicit: id.AgentExplicit,
+		AcquiredAt:    time.Now(),
+	}
+	if startNS, err := stale.GetProcessStartTime(id.PID); err == nil {
+		lf.PIDStartNS = startNS
+	}
+	dir := root.IntentDirPath(rootDir, name)
+	if err := root.MkdirAll(rootDir, dir); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s.%d.%d.json", id.Host, id.PID, lf.AcquiredAt.UnixNano()))
+	if err := lockfile.Write(path, lf); err != nil {
+		return nil, err
+	}
+	return &intent{path: path, lf: lf}, nil
+}
+
+// touch marks the intent as still current. Errors are ignored: a missing
+// refresh only makes this wait invisible to others.
+func (in *intent) touch() {
+	now := time.Now()
+	_ = os.Chtimes(in.path, now, now)
+}
+
+// remove withdraws the intent.
+func (in *intent) remove() {
+	_ = os.Remove(in.path)
+}
+
+// waitIntents returns, per owner and lock name, when the owner's earliest
+// live intent on that lock started. Abandoned intents and ones whose
+// process is gone are removed.
+func waitIntents(rootDir string, now time.Time) map[string]map[string]time.Time {
+	out := make(map[string]map[string]time.Time)
+	names, _ := root.NameDirs(filepath.Join(rootDir, root.IntentsDir))
+	for _, name := range names {
+		dir := root.IntentDirPath(rootDir, name)
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			path := filepath.Join(dir, e.Name())
+			info, err := e.Info()
+			if err != nil || e.IsDir() {
+				continue // removed since ReadDir
+			}
+			if age := now.Sub(info.ModTime()); age > waiterAbandoned {
+				_ = os.Remove(path)
+				continue
+			} else if age > waiterFresh {
+				continue
+			}
+			lf, err := lockfile.Read(path)
+			if err != nil {
+				continue // being written
+			}
+			if stale.Check(lf).Stale {
+				_ = os.Remove(path)
+				continue
+			}
+			if out[lf.Owner] == nil {
+				out[lf.Owner] = make(map[string]time.Time)
+			}
+			if since, ok := out[lf.Owner][lf.Name]; !ok || lf.AcquiredAt.Before(since) {
+				out[lf.Owner][lf.Name] = lf.AcquiredAt
+			}
+		}
+	}
+	return out
+}
+
+// holderOwners returns the owners keeping name from being acquired: its
+// live exclusive holder, its live shared holders, and the holders of held
+// members of its exclusion groups. Read-only.
+func holderOwners(rootDir, name string, groups map[string][]string) []string {
+	var owners []string
+	add := func(n string) {
+		if lk, err := lockfile.Read(root.LockFilePath(rootDir, n)); err == nil && !stale.Check(lk).Stale {
+			owners = append(owners, lk.Owner)
+		}
+		for _, h := range liveSharedHolders(rootDir, n) {
+			owners = append(owners, h.Owner)
+		}
+	}
+	add(name)
+	for _, members := range groupMembers(groups, name) {
+		for _, m := range members {
+			add(m)
+		}
+	}
+	slices.Sort(owners)
+	return slices.Compact(owners)
+}
+
+// findDeadlock returns the wait-for cycle through self's wait, or nil if
+// there is none or another waiter in it started waiting later and so is
+// the one to give up.
+func findDeadlock(rootDir string, self *lockfile.Lock, groups map[string][]string) *DeadlockError {
+	intents := waitIntents(rootDir, time.Now())
+	visited := map[string]bool{self.Owner: true}
+
+	var walk func(waiter, name string, path []WaitEdge) []WaitEdge
+	walk = func(waiter, name string, path []WaitEdge) []WaitEdge {
+		for _, h := range holderOwners(rootDir, name, groups) {
+			if h == waiter {
+				continue // locks are reentrant per owner
+			}
+			next := append(slices.Clip(path), WaitEdge{Waiter: waiter, Lock: name, Holder: h})
+			if h == self.Owner {
+				return next
+			}
+			if visited[h] {
+				continue
+			}
+			visited[h] = true
+			waits := make([]string, 0, len(intents[h]))
+			for n := range intents[h] {
+				waits = append(waits, n)
+			}
+			slices.Sort(waits) // deterministic report when several cycle
+			for _, n := range waits {
+				if c := walk(h, n, next); c != nil {
+					return c
+				}
+			}
+		}
+		return nil
+	}
+
+	cycle := walk(self.Owner, self.Name, nil)
+	if cycle == nil {
+		return nil
+	}
+	for _, e := range cycle[1:] {
+		since := intents[e.Waiter][e.Lock]
+		if since.After(self.AcquiredAt) || (since.Equal(self.AcquiredAt) && e.Waiter > self.Owner) {
+			return nil // e.Waiter gives up instead
+		}
+	}
+	return &DeadlockError{Cycle: cycle}
+}
+
+// emitDeadlockEvent emits a deadlock audit event. Safe to call with nil auditor.
+func emitDeadlockEvent(w *audit.Writer, id identity.Identity, name string, d *DeadlockError) {
+	if w == nil {
+		return
+	}
+	w.Emit(&audit.Event{
+		Event:   audit.EventDeadlock,
+		Name:    name,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra: map[string]any{
+			"holder_owner": d.Cycle[0].Holder,
+			"cycle":        d.Cycle,
+		},
+	})
+}
@@ -0,0 +1,144 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// plantIntent records that owner waits for name since since, with the
+// given mtime, as another process's AcquireWithWait would.
+func plantIntent(t *testing.T, rootDir, owner, host string, pid int, name string, since, mtime time.Time) string {
+	t.Helper()
+	dir := root.IntentDirPath(rootDir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s.%d.%d.json", host, pid, since.UnixNano()))
+	lf := &lockfile.Lock{Version: 1, Name: name, Owner: owner, Host: host, PID: pid, AcquiredAt: since}
+	if err := lockfile.Write(path, lf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func holdAs(t *testing.T, rootDir, owner, name string) {
+	t.Helper()
+	writeLock(t, filepath.Join(rootDir, "locks"), name, &lockfile.Lock{
+		Version: 1, Name: name, Owner: owner, Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	})
+}
+
+func TestAcquireWithWait_Deadlock(t *testing.T) {
+	earlier := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, rootDir string)
+		want  []WaitEdge
+	}{
+		{
+			name: "direct",
+			setup: func(t *testing.T, rootDir string) {
+				holdAs(t, rootDir, "bob", "cache")
+				plantIntent(t, rootDir, "bob", "other-host", 99999, "db", earlier, time.Now())
+			},
+			want: []WaitEdge{{"me", "cache", "bob"}, {"bob", "db", "me"}},
+		},
+		{
+			name: "through a third owner",
+			setup: func(t *testing.T, rootDir string) {
+				holdAs(t, rootDir, "bob", "cache")
+				holdAs(t, rootDir, "carol", "queue")
+				plantIntent(t, rootDir, "bob", "other-host", 99999, "queue", earlier, time.Now())
+				plantIntent(t, rootDir, "carol", "other-host", 99998, "db", earlier, time.Now())
+			},
+			want: []WaitEdge{{"me", "cache", "bob"}, {"bob", "queue", "carol"}, {"carol", "db", "me"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LOKT_OWNER", "me")
+			rootDir := setupSweepRoot(t)
+			if err := Acquire(rootDir, "db", AcquireOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(t, rootDir)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err := AcquireWithWait(ctx, rootDir, "cache", AcquireOptions{Auditor: audit.NewWriter(rootDir), NoAdaptive: true})
+			var dl *DeadlockError
+			if !errors.As(err, &dl) || !errors.Is(err, ErrDeadlock) {
+				t.Fatalf("AcquireWithWait() error = %v, want DeadlockError", err)
+			}
+			if !slices.Equal(dl.Cycle, tt.want) {
+				t.Errorf("cycle = %+v, want %+v", dl.Cycle, tt.want)
+			}
+
+			var deadlocks int
+			for _, e := range readAuditEvents(t, rootDir) {
+				if e.Event == audit.EventDeadlock && e.Name == "cache" && e.Extra["holder_owner"] == "bob" {
+					deadlocks++
+				}
+			}
+			if deadlocks != 1 {
+				t.Errorf("deadlock events = %d, want 1", deadlocks)
+			}
+			if entries, _ := os.ReadDir(root.IntentDirPath(rootDir, "cache")); len(entries) != 0 {
+				t.Errorf("waiter should remove its intent on return, %d entries left", len(entries))
+			}
+		})
+	}
+}
+
+func TestAcquireWithWait_DeadlockOlderWaiterKeepsWaiting(t *testing.T) {
+	t.Setenv("LOKT_OWNER", "me")
+	rootDir := setupSweepRoot(t)
+	if err := Acquire(rootDir, "db", AcquireOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	holdAs(t, rootDir, "bob", "cache")
+	// bob started waiting after us, so bob is the one to give up.
+	later := time.Now().Add(time.Hour)
+	plantIntent(t, rootDir, "bob", "other-host", 99999, "db", later, time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := AcquireWithWait(ctx, rootDir, "cache", AcquireOptions{NoAdaptive: true})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AcquireWithWait() error = %v, want to keep waiting until the deadline", err)
+	}
+}
+
+func TestWaitIntents_IgnoresGoneWaiters(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	host, _ := os.Hostname()
+	now := time.Now()
+
+	live := plantIntent(t, rootDir, "alice", "other-host", 99999, "a", now, now)
+	dead := plantIntent(t, rootDir, "bob", host, 99999, "b", now, now)
+	quiet := plantIntent(t, rootDir, "carol", "other-host", 99998, "c", now, now.Add(-2*waiterFresh))
+	abandoned := plantIntent(t, rootDir, "dave", "other-host", 99997, "d", now, now.Add(-2*waiterAbandoned))
+
+	got := waitIntents(rootDir, now)
+	if len(got) != 1 || got["alice"]["a"].IsZero() {
+		t.Errorf("waitIntents() = %v, want only alice's", got)
+	}
+	for path, wantKept := range map[string]bool{live: true, dead: false, quiet: true, abandoned: false} {
+		if _, err := os.Stat(path); (err == nil) != wantKept {
+			t.Errorf("%s: kept = %v, want %v", filepath.Base(path), err == nil, wantKept)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package lock
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// Exclusion groups (lock families) are sets of names of which at most one
+// may be held at a time. Acquire enforces them in two phases: members are
+// checked before the lock file is created, and again after it is written.
+// If a conflict appeared in between (another member acquired concurrently),
+// the new lock is removed again and the attempt retried, so two members
+// can never both be held even when acquired in the same instant: whichever
+// process writes second is guaranteed to see the first in its re-check.
+const (
+	conflictRetries = 3
+	conflictBackoff = 20 * time.Millisecond // base; jittered so racers don't collide again
+)
+
+// ConflictError is returned when name is free but another member of one of
+// its exclusion groups is held. It unwraps to the member's HeldError, so
+// callers that treat a held lock as "try again later" (AcquireWithWait,
+// exit code 2) handle conflicts the same way.
+type ConflictError struct {
+	Name  string     // the lock being acquired
+	Group string     // the exclusion group both belong to
+	Held  *HeldError // the conflicting member and its holder
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("lock %q excluded by group %q: %v", e.Name, e.Group, e.Held)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Held
+}
+
+// errBackedOut reports a conflict found by the post-write re-check; the
+// lock file has already been removed again.
+type errBackedOut struct {
+	conflict *ConflictError
+}
+
+func (e *errBackedOut) Error() string { return e.conflict.Error() }
+
+// groupMembers returns, for each group containing name, the group's other
+// members, keyed by group name.
+func groupMembers(groups map[string][]string, name string) map[string][]string {
+	var out map[string][]string
+	for group, members := range groups {
+		if !slices.Contains(members, name) {
+			continue
+		}
+		for _, m := range members {
+			if m == name {
+				continue
+			}
+			if out == nil {
+				out = make(map[string][]string)
+			}
+			out[group] = append(out[group], m)
+		}
+	}
+	return out
+}
+
+// FindConflict returns a ConflictError if another member of any exclusion
+// group containing name is held by a live, unexpired holder (exclusive or
+// shared), or nil.
+// Unreadable member files and stale holders don't count. Read-only.
+func FindConflict(rootDir, name string, groups map[string][]string, retryDefault time.Duration) *ConflictError {
+	others := groupMembers(groups, name)
+	if len(others) == 0 {
+		return nil
+	}
+	groupNames := make([]string, 0, len(others))
+	for g := range others {
+		groupNames = append(groupNames, g)
+	}
+	slices.Sort(groupNames) // deterministic report when several conflict
+
+	for _, g := range groupNames {
+		for _, m := range others[g] {
+			if held := memberHeld(rootDir, m, retryDefault); held != nil {
+				return &ConflictError{Name: name, Group: g, Held: held}
+			}
+		}
+	}
+	return nil
+}
+
+// memberHeld returns a HeldError if group member m is held, exclusively or
+// shared, by a live, unexpired holder.
+func memberHeld(rootDir, m string, retryDefault time.Duration) *HeldError {
+	lk, err := lockfile.Read(root.LockFilePath(rootDir, m))
+	if err != nil || lk.IsExpired() {
+		return sharedHeldError(liveSharedHolders(rootDir, m), retryDefault)
+	}
+	if r := stale.Check(lk); r.Stale && r.Reason.HolderGone() {
+		return sharedHeldError(liveSharedHolders(rootDir, m), retryDefault)
+	}
+	return &HeldError{Lock: lk, RetryAfter: RetryAfter(lk, retryDefault)}
+}
+
+// acquireExclusive runs acquire, retrying a bounded number of times when the
+// post-write re-check backed out because of a concurrent conflict.
+func acquireExclusive(rootDir, name string, opts AcquireOptions) error {
+	for attempt := 1; ; attempt++ {
+		err := acquire(rootDir, name, opts)
+		backedOut, ok := err.(*errBackedOut)
+		if !ok {
+			return err
+		}
+		if attempt == conflictRetries {
+			c := backedOut.conflict
+			emitConflictDenyEvent(opts.Auditor, identity.Current(), name, int(opts.TTL.Seconds()), c)
+			return c
+		}
+		time.Sleep(conflictBackoff + rand.N(conflictBackoff*time.Duration(attempt)))
+	}
+}
+
+// emitConflictDenyEvent records a denial caused by an exclusion group. Safe
+// to call with nil auditor.
+func emitConflictDenyEvent(w *audit.Writer, id identity.Identity, name string, ttlSec int, c *ConflictError) {
+	if w == nil {
+		return
+	}
+	holder := c.Held.Lock
+	w.Emit(&audit.Event{
+		Event:   audit.EventDeny,
+		Name:    name,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		TTLSec:  ttlSec,
+		Extra: map[string]any{
+			"conflicting_lock": holder.Name,
+			"exclusion_group":  c.Group,
+			"holder_owner":     holder.Owner,
+			"holder_host":      holder.Host,
+			"holder_pid":       holder.PID,
+			"retry_after_sec":  int(c.Held.RetryAfter.Seconds()),
+		},
+	})
+}
@@ -0,0 +1,188 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+var dbGroups = map[string][]string{"db": {"db-migrate", "db-restore", "db-vacuum"}}
+
+func otherHolder(name string) *lockfile.Lock {
+	return &lockfile.Lock{Version: 1, Name: name, Owner: "other-owner", Host: "other-host", PID: 99999, AcquiredAt: time.Now()}
+}
+
+func TestAcquire_ExclusionConflict(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	writeLock(t, filepath.Join(rootDir, "locks"), "db-migrate", otherHolder("db-migrate"))
+
+	err := Acquire(rootDir, "db-restore", AcquireOptions{Auditor: audit.NewWriter(rootDir), ExclusionGroups: dbGroups})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Acquire() error = %v, want ConflictError", err)
+	}
+	if conflict.Group != "db" || conflict.Held.Lock.Name != "db-migrate" {
+		t.Errorf("conflict = %+v, want group db held via db-migrate", conflict)
+	}
+	var held *HeldError
+	if !errors.As(err, &held) || !errors.Is(err, ErrLockHeld) {
+		t.Error("ConflictError should unwrap to HeldError and ErrLockHeld")
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "locks", "db-restore.json")); !os.IsNotExist(err) {
+		t.Errorf("denied lock file should not exist (stat: %v)", err)
+	}
+
+	events := readAuditEvents(t, rootDir)
+	if len(events) != 1 || events[0].Event != audit.EventDeny {
+		t.Fatalf("events = %+v, want one deny", events)
+	}
+	if got := events[0].Extra["conflicting_lock"]; got != "db-migrate" {
+		t.Errorf("conflicting_lock = %v, want db-migrate", got)
+	}
+	if got := events[0].Extra["exclusion_group"]; got != "db" {
+		t.Errorf("exclusion_group = %v, want db", got)
+	}
+
+	// Names outside the group, and the same call without groups, are unaffected.
+	if err := Acquire(rootDir, "cache", AcquireOptions{ExclusionGroups: dbGroups}); err != nil {
+		t.Errorf("Acquire(cache) error = %v", err)
+	}
+	if err := Acquire(rootDir, "db-restore", AcquireOptions{}); err != nil {
+		t.Errorf("Acquire without groups error = %v", err)
+	}
+}
+
+func TestAcquire_ExclusionIgnoresStaleMembers(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	locksDir := filepath.Join(rootDir, "locks")
+
+	expired := otherHolder("db-migrate")
+	expired.AcquiredAt = time.Now().Add(-time.Hour)
+	expired.TTLSec = 60
+	writeLock(t, locksDir, "db-migrate", expired)
+
+	host, _ := os.Hostname()
+	dead := otherHolder("db-vacuum")
+	dead.Host = host
+	dead.PID = 999999999
+	writeLock(t, locksDir, "db-vacuum", dead)
+
+	if err := Acquire(rootDir, "db-restore", AcquireOptions{ExclusionGroups: dbGroups}); err != nil {
+		t.Fatalf("Acquire() error = %v, want expired and dead members ignored", err)
+	}
+	if err := Check(rootDir, "db-migrate", 0, dbGroups); !errors.As(err, new(*ConflictError)) {
+		t.Errorf("Check() = %v, want ConflictError now db-restore is held", err)
+	}
+}
+
+// TestAcquire_ExclusionRace acquires every member of one group at the same
+// moment; the two-phase check must let at most one of them win. Each name is
+// taken once, since goroutines share an owner and would otherwise re-acquire.
+func TestAcquire_ExclusionRace(t *testing.T) {
+	var members []string
+	for i := range 8 {
+		members = append(members, fmt.Sprintf("member-%d", i))
+	}
+	groups := map[string][]string{"family": members}
+
+	for round := 0; round < 50; round++ {
+		rootDir := setupSweepRoot(t)
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		errs := make([]error, len(members))
+		for i, m := range members {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				errs[i] = Acquire(rootDir, m, AcquireOptions{ExclusionGroups: groups})
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		var held []string
+		for _, m := range members {
+			if _, err := os.Stat(filepath.Join(rootDir, "locks", m+".json")); err == nil {
+				held = append(held, m)
+			}
+		}
+		if len(held) > 1 {
+			t.Fatalf("round %d: %v held at once", round, held)
+		}
+		wins := 0
+		for i, err := range errs {
+			switch {
+			case err == nil:
+				wins++
+			case !errors.As(err, new(*ConflictError)):
+				t.Errorf("round %d: Acquire(%s) error = %v, want ConflictError", round, members[i], err)
+			}
+		}
+		if wins != len(held) {
+			t.Fatalf("round %d: %d acquires succeeded but %d members held", round, wins, len(held))
+		}
+	}
+}
+
+func TestRemoveOwnLock(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	path := filepath.Join(rootDir, "locks", "member.json")
+	mine := newLock("member", identity.Current(), AcquireOptions{})
+	theirs := newLock("member", identity.Current(), AcquireOptions{})
+	if err := lockfile.Write(path, theirs); err != nil {
+		t.Fatal(err)
+	}
+
+	// The file was replaced by another acquisition: backing out keeps it.
+	if removed, err := removeOwnLock(path, mine); removed || err != nil {
+		t.Fatalf("removeOwnLock(replaced) = %v, %v; want false", removed, err)
+	}
+	if lf, err := lockfile.Read(path); err != nil || lf.LockID != theirs.LockID {
+		t.Fatalf("lock after back-out = %v, %v; want the other acquisition's", lf, err)
+	}
+	if removed, err := removeOwnLock(path, theirs); !removed || err != nil {
+		t.Fatalf("removeOwnLock(own) = %v, %v; want true", removed, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("lock file still there after its own back-out: %v", err)
+	}
+}
+
+func TestAcquireWithWait_ExclusionConflict(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	writeLock(t, filepath.Join(rootDir, "locks"), "db-migrate", otherHolder("db-migrate"))
+
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		_ = Release(rootDir, "db-migrate", ReleaseOptions{Force: true})
+	}()
+
+	waited := false
+	opts := AcquireOptions{ExclusionGroups: dbGroups, OnWait: func(*HeldError) { waited = true }}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := AcquireWithWait(ctx, rootDir, "db-restore", opts); err != nil {
+		t.Fatalf("AcquireWithWait() error = %v", err)
+	}
+	if !waited {
+		t.Error("expected OnWait for the conflicting member")
+	}
+}
+
+func TestConflictError_Message(t *testing.T) {
+	err := &ConflictError{Name: "db-restore", Group: "db", Held: &HeldError{Lock: otherHolder("db-migrate")}}
+	want := fmt.Sprintf("lock %q excluded by group %q: %v", "db-restore", "db", err.Held)
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
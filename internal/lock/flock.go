@@ -0,0 +1,95 @@
+package lock
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// A holder that asks for it (AcquireOptions.Flock) keeps an advisory
+// flock(2) on its lock file on top of the O_EXCL create, for filesystems
+// whose O_EXCL can't be fully trusted (some NFS setups). Readers on the
+// holder's host take a held flock as proof the lock is live, whatever its
+// TTL or PID say (stale.CheckFile).
+//
+// Every write of a lock file replaces it (temp file and rename), and with
+// it the inode the flock was on, so the holder takes the flock again after
+// each rewrite (refreshFlock). A reader probing in between finds no flock
+// and falls back to the usual checks; the flock only ever adds liveness.
+var flocks = struct {
+	sync.Mutex
+	files map[string]*os.File // lock file path -> open, flocked file
+}{files: map[string]*os.File{}}
+
+// flockWait is how long holdFlock retries while a reader's probe holds a
+// shared flock on the file.
+const flockWait = 100 * time.Millisecond
+
+// takeFlock flocks the lock file at path that lk was just written to, if lk
+// asks for it. Where flock isn't available it degrades to O_EXCL alone,
+// rewriting the file without the flag so readers don't probe for it.
+func takeFlock(path string, lk *lockfile.Lock) {
+	if !lk.Flock || holdFlock(path, lk.LockID) {
+		return
+	}
+	lk.Flock = false
+	_ = lockfile.Write(path, lk)
+}
+
+// holdFlock flocks the lock file at path if it is still acquisition
+// lockID, keeping the file open until dropFlock; a flock this process held
+// on an earlier version of the file is let go. It reports whether it did.
+func holdFlock(path, lockID string) bool {
+	f, err := os.Open(path) //nolint:gosec // G304: path is built from the lokt root
+	if err != nil {
+		return false
+	}
+	if flockFile(f, flockWait) != nil || !holdsLockID(f, lockID) {
+		_ = f.Close()
+		return false
+	}
+	flocks.Lock()
+	defer flocks.Unlock()
+	if old := flocks.files[path]; old != nil {
+		_ = old.Close()
+	}
+	flocks.files[path] = f
+	return true
+}
+
+// holdsLockID reports whether the open lock file f is acquisition lockID:
+// the file at the path may have been replaced between the open and the
+// flock.
+func holdsLockID(f *os.File, lockID string) bool {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return false
+	}
+	lf, err := lockfile.Parse(data)
+	return err == nil && lf.LockID == lockID
+}
+
+// refreshFlock takes the flock on path again after a rewrite, if this
+// process held one on the file it replaced.
+func refreshFlock(path, lockID string) {
+	flocks.Lock()
+	_, held := flocks.files[path]
+	flocks.Unlock()
+	if held && !holdFlock(path, lockID) {
+		dropFlock(path)
+	}
+}
+
+// dropFlock closes the file this process keeps flocked at path, if any,
+// releasing the flock.
+func dropFlock(path string) {
+	flocks.Lock()
+	defer flocks.Unlock()
+	if f := flocks.files[path]; f != nil {
+		_ = f.Close()
+		delete(flocks.files, path)
+	}
+}
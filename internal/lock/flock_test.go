@@ -0,0 +1,76 @@
+//go:build unix
+
+package lock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+func TestFlock_HeldForTheLifeOfTheLock(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	path := root.LockFilePath(rootDir, "build")
+
+	if err := Acquire(rootDir, "build", AcquireOptions{TTL: time.Minute, Flock: true}); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	lf, err := lockfile.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lf.Flock || !stale.FlockHeld(path) {
+		t.Fatalf("flock = %v, held = %v; want both", lf.Flock, stale.FlockHeld(path))
+	}
+
+	// Renewing replaces the file; the flock follows it.
+	if err := Renew(rootDir, "build", RenewOptions{}); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if !stale.FlockHeld(path) {
+		t.Fatal("flock lost by the renewal")
+	}
+
+	// Held flock on this host: live, though its TTL says otherwise.
+	expired := *lf
+	past := time.Now().Add(-time.Minute)
+	expired.ExpiresAt = &past
+	if r := stale.CheckFile(path, &expired, 0); r.Stale {
+		t.Errorf("CheckFile() = %+v for a flocked lock, want not stale", r)
+	}
+
+	if err := Release(rootDir, "build", ReleaseOptions{}); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	flocks.Lock()
+	n := len(flocks.files)
+	flocks.Unlock()
+	if n != 0 {
+		t.Errorf("%d flocked files still open after release", n)
+	}
+}
+
+func TestFlock_NotRequested(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	path := root.LockFilePath(rootDir, "build")
+
+	if err := Acquire(rootDir, "build", AcquireOptions{}); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	lf, err := lockfile.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lf.Flock || stale.FlockHeld(path) {
+		t.Errorf("flock = %v, held = %v; want neither", lf.Flock, stale.FlockHeld(path))
+	}
+	// Without the flag, an expired lock is expired.
+	past := time.Now().Add(-time.Minute)
+	lf.ExpiresAt = &past
+	if r := stale.CheckFile(path, lf, 0); r.Reason != stale.ReasonExpired {
+		t.Errorf("CheckFile() = %+v, want expired", r)
+	}
+}
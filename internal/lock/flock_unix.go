@@ -0,0 +1,28 @@
+//go:build unix
+
+package lock
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// flockSupported reports whether holders can keep a flock on their lock
+// file (AcquireOptions.Flock).
+const flockSupported = true
+
+// flockFile takes an exclusive flock on f without blocking, retrying for up
+// to wait while someone else holds one.
+func flockFile(f *os.File, wait time.Duration) error {
+	fd := int(f.Fd()) //nolint:gosec // G115: file descriptors fit in int
+	deadline := time.Now().Add(wait)
+	for {
+		err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil || !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package lock
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// flockSupported is false: Windows has no flock(2), and lock files are
+// only ever created with O_EXCL.
+const flockSupported = false
+
+// flockFile is not implemented on Windows.
+func flockFile(_ *os.File, _ time.Duration) error {
+	return errors.New("flock not supported on windows")
+}
@@ -1,9 +1,13 @@
 package lock
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nikolasavic/lokt/internal/audit"
@@ -16,30 +20,51 @@ import (
 // FreezePrefix is prepended to the lock name for freeze locks.
 const FreezePrefix = "freeze-"
 
+// GlobalFreeze is the freeze name reserved for a global freeze: while
+// freezes/__all__.json is active every name is frozen, on top of any
+// freeze of its own.
+const GlobalFreeze = "__all__"
+
 // ErrFrozen is returned when a guard operation is blocked by an active freeze.
 var ErrFrozen = errors.New("operation frozen")
 
 // FrozenError provides details about the active freeze.
 type FrozenError struct {
-	Lock *lockfile.Lock
+	Lock       *lockfile.Lock
+	RetryAfter time.Duration // Suggested wait before retrying; see RetryAfter
 }
 
 func (e *FrozenError) Error() string {
 	age := time.Since(e.Lock.AcquiredAt).Truncate(time.Second)
 	remaining := ""
 	if rem := e.Lock.Remaining(); rem > 0 {
-		remaining = fmt.Sprintf(", %s remaining", rem.Truncate(time.Second))
+		end, _ := e.Lock.Expiry()
+		remaining = fmt.Sprintf(" until %s (%s remaining)", FormatFreezeEnd(end, time.Now()), rem.Truncate(time.Second))
+	}
+	if e.Lock.Message != "" {
+		remaining += ": " + e.Lock.Message
 	}
 	// Handle both new-style (clean name) and legacy (freeze-prefixed) names
 	displayName := e.Lock.Name
 	if IsFreezeLock(displayName) {
 		displayName = displayName[len(FreezePrefix):]
 	}
+	if e.RetryAfter > 0 {
+		remaining += "; " + FormatRetryAfter(e.RetryAfter)
+	}
+	switch {
+	case displayName == GlobalFreeze:
+		displayName = "all operations (global freeze)"
+	case e.Lock.Pattern:
+		displayName = "matching " + strconv.Quote(displayName)
+	default:
+		displayName = strconv.Quote(displayName)
+	}
 	if e.Lock.AgentID != "" {
-		return fmt.Sprintf("operation %q frozen by %s (agent: %s)@%s for %s%s",
+		return fmt.Sprintf("operation %s frozen by %s (agent: %s)@%s for %s%s",
 			displayName, e.Lock.Owner, e.Lock.AgentID, e.Lock.Host, age, remaining)
 	}
-	return fmt.Sprintf("operation %q frozen by %s@%s for %s%s",
+	return fmt.Sprintf("operation %s frozen by %s@%s for %s%s",
 		displayName, e.Lock.Owner, e.Lock.Host, age, remaining)
 }
 
@@ -47,60 +72,126 @@ func (e *FrozenError) Unwrap() error {
 	return ErrFrozen
 }
 
+// FormatFreezeEnd formats the end of a freeze for messages: the UTC time
+// of day if it is within a day of now, the date and time otherwise.
+func FormatFreezeEnd(end, now time.Time) string {
+	if end.Sub(now) < 24*time.Hour {
+		return end.UTC().Format("15:04 UTC")
+	}
+	return end.UTC().Format("2006-01-02 15:04 UTC")
+}
+
 // FreezeOptions configures freeze creation.
 type FreezeOptions struct {
-	TTL     time.Duration
+	TTL time.Duration
+	// Until, instead of TTL, is when the freeze ends (a change window);
+	// it must be in the future.
+	Until time.Time
+	// Reason says why the name is frozen. It is stored as the freeze's
+	// Message, cleaned by lockfile.CleanMessage, shown in FrozenError and
+	// recorded on the freeze event.
+	Reason  string
 	Auditor *audit.Writer
 }
 
-// Freeze creates a freeze lock for the given name.
-// TTL is required (must be > 0). The freeze blocks guard commands until
-// unfreeze or TTL expiry.
+// Freeze creates a freeze lock for the given name, or for every name if
+// name is GlobalFreeze.
+// A TTL (> 0) or an Until time is required, not both. The freeze blocks
+// guard commands until unfreeze or expiry.
 func Freeze(rootDir, name string, opts FreezeOptions) error {
+	if err := validateFreezeName(name); err != nil {
+		return err
+	}
+	return freeze(rootDir, name, false, opts)
+}
+
+// validateFreezeName is lockfile.ValidateName for the name of a freeze,
+// which can't be under root.FreezePatternsDir.
+func validateFreezeName(name string) error {
 	if err := lockfile.ValidateName(name); err != nil {
 		return err
 	}
+	if strings.HasPrefix(name, root.FreezePatternsDir+"/") {
+		return fmt.Errorf("%w: %s/ is reserved for pattern freezes (freeze --match)", lockfile.ErrInvalidName, root.FreezePatternsDir)
+	}
+	return nil
+}
+
+// freeze implements Freeze, and FreezeMatch with pattern, for a validated
+// name or pattern.
+func freeze(rootDir, name string, pattern bool, opts FreezeOptions) error {
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return err
+	}
+	if !opts.Until.IsZero() {
+		if opts.TTL != 0 {
+			return errors.New("freeze takes a TTL or an end time, not both")
+		}
+		if opts.TTL = time.Until(opts.Until); opts.TTL <= 0 {
+			return fmt.Errorf("freeze end %s is in the past", opts.Until.UTC().Format(time.RFC3339))
+		}
+	}
+	if opts.TTL, err = policyTTL(rootDir, name, opts.TTL); err != nil {
+		return err
+	}
 
 	if opts.TTL <= 0 {
 		return fmt.Errorf("freeze requires a TTL (e.g., --ttl 15m)")
 	}
 
 	if err := root.EnsureDirs(rootDir); err != nil {
-		return fmt.Errorf("ensure dirs: %w", err)
+		return ensureDirsError(rootDir, err)
 	}
 
 	path := root.FreezeFilePath(rootDir, name)
+	if pattern {
+		path = root.FreezePatternPath(rootDir, name)
+	}
 	id := identity.Current()
 
 	now := time.Now()
 	ttlSec := int(opts.TTL.Seconds())
 	exp := now.Add(time.Duration(ttlSec) * time.Second)
+	if !opts.Until.IsZero() {
+		// The end is what was asked for; the TTL rounds up to it.
+		exp = opts.Until
+		ttlSec = int((exp.Sub(now) + time.Second - 1) / time.Second)
+	}
 	lock := &lockfile.Lock{
-		Version:    lockfile.CurrentLockfileVersion,
-		Name:       name,
-		LockID:     lockfile.GenerateLockID(),
-		Owner:      id.Owner,
-		Host:       id.Host,
-		PID:        id.PID,
-		AgentID:    id.AgentID,
-		AcquiredAt: now,
-		TTLSec:     ttlSec,
-		ExpiresAt:  &exp,
+		Version:       lockfile.WriteVersion(),
+		Name:          name,
+		LockID:        lockfile.GenerateLockID(),
+		Owner:         id.Owner,
+		Host:          id.Host,
+		PID:           id.PID,
+		AgentID:       id.AgentID,
+		AgentExplicit: id.AgentExplicit,
+		AcquiredAt:    now,
+		TTLSec:        ttlSec,
+		ExpiresAt:     &exp,
+		Message:       lockfile.CleanMessage(opts.Reason),
+		Pattern:       pattern,
 	}
 	if startNS, err := stale.GetProcessStartTime(id.PID); err == nil {
 		lock.PIDStartNS = startNS
 	}
 
+	// A namespaced name ("team/web/build") lives in subdirectories
+	if err := root.MkdirAll(rootDir, filepath.Dir(path)); err != nil {
+		return ensureDirsError(rootDir, err)
+	}
+
 	// Atomic create
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
 		if os.IsExist(err) {
 			existing, readErr := lockfile.Read(path)
 			if readErr != nil {
-				if errors.Is(readErr, lockfile.ErrUnsupportedVersion) {
+				if errors.Is(readErr, lockfile.ErrUnsupportedVersion) || errors.Is(readErr, lockfile.ErrBadSignature) {
 					return readErr
 				}
-				if errors.Is(readErr, lockfile.ErrCorrupted) {
+				if lockfile.Broken(readErr) {
 					if removeErr := os.Remove(path); removeErr == nil {
 						_ = lockfile.SyncDir(path)
 						f2, retryErr := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
@@ -110,7 +201,7 @@ func Freeze(rootDir, name string, opts FreezeOptions) error {
 						}
 					}
 				}
-				return &HeldError{Lock: &lockfile.Lock{Name: name}}
+				return &HeldError{Lock: &lockfile.Lock{Name: name, Pattern: pattern}, RetryAfter: MinRetryAfter}
 			}
 
 			// If existing freeze is expired, remove and retry
@@ -125,7 +216,7 @@ func Freeze(rootDir, name string, opts FreezeOptions) error {
 				}
 			}
 
-			return &HeldError{Lock: existing}
+			return &HeldError{Lock: existing, RetryAfter: RetryAfter(existing, 0)}
 		}
 		return fmt.Errorf("create freeze file: %w", err)
 	}
@@ -138,7 +229,7 @@ writeLock:
 		return fmt.Errorf("write freeze file: %w", err)
 	}
 
-	emitFreezeEvent(opts.Auditor, id, name, lock.TTLSec, lock.LockID)
+	emitFreezeEvent(opts.Auditor, id, lock, !opts.Until.IsZero())
 	return nil
 }
 
@@ -154,16 +245,26 @@ type UnfreezeOptions struct {
 // Checks the new freezes/ directory first, then falls back to the legacy
 // locks/freeze-<name>.json location for backward compatibility.
 func Unfreeze(rootDir, name string, opts UnfreezeOptions) error {
-	if err := lockfile.ValidateName(name); err != nil {
+	if err := validateFreezeName(name); err != nil {
+		return err
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
 		return err
 	}
 
 	existing, path, err := readFreezeFile(rootDir, name)
+	return unfreezeFile(name, existing, path, err, opts)
+}
+
+// unfreezeFile implements Unfreeze and UnfreezeMatch for the freeze of name
+// (or pattern) read from path, with the error of reading it.
+func unfreezeFile(name string, existing *lockfile.Lock, path string, err error, opts UnfreezeOptions) error {
 	if err != nil {
 		if os.IsNotExist(err) {
 			return ErrNotFound
 		}
-		if errors.Is(err, lockfile.ErrUnsupportedVersion) {
+		if errors.Is(err, lockfile.ErrUnsupportedVersion) || errors.Is(err, lockfile.ErrBadSignature) {
 			if opts.Force {
 				if removeErr := os.Remove(path); removeErr != nil {
 					if os.IsNotExist(removeErr) {
@@ -176,7 +277,7 @@ func Unfreeze(rootDir, name string, opts UnfreezeOptions) error {
 			}
 			return fmt.Errorf("read freeze: %w", err)
 		}
-		if errors.Is(err, lockfile.ErrCorrupted) {
+		if lockfile.Broken(err) {
 			if opts.Force {
 				if removeErr := os.Remove(path); removeErr != nil {
 					if os.IsNotExist(removeErr) {
@@ -215,21 +316,45 @@ func Unfreeze(rootDir, name string, opts UnfreezeOptions) error {
 
 // CheckFreeze checks if a freeze is active for the given name.
 // Returns nil if no freeze is active (safe to proceed).
-// Returns FrozenError if an active, non-expired freeze exists.
+// Returns FrozenError if an active, non-expired freeze exists; a global
+// freeze (GlobalFreeze) is checked first and applies to every name, then
+// the name's own freeze, then the pattern freezes (FreezeMatch) matching it.
 // Auto-prunes expired freezes.
 // Checks the new freezes/ directory first, then falls back to the legacy
 // locks/freeze-<name>.json location for backward compatibility.
 func CheckFreeze(rootDir, name string, auditor *audit.Writer) error {
-	existing, path, err := readFreezeFile(rootDir, name)
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return err
+	}
+	if err := checkFreezeFile(rootDir, GlobalFreeze, name, auditor); err != nil || name == GlobalFreeze {
+		return err
+	}
+	if err := checkFreezeFile(rootDir, name, name, auditor); err != nil {
+		return err
+	}
+	return checkPatternFreezes(rootDir, name, auditor)
+}
+
+// checkFreezeFile is CheckFreeze for the freeze file of freezeName alone,
+// on behalf of name.
+func checkFreezeFile(rootDir, freezeName, name string, auditor *audit.Writer) error {
+	existing, path, err := readFreezeFile(rootDir, freezeName)
+	return activeFreeze(name, existing, path, err, auditor)
+}
+
+// activeFreeze is the CheckFreeze result on behalf of name for the freeze
+// existing read from path, with the error of reading it.
+func activeFreeze(name string, existing *lockfile.Lock, path string, err error, auditor *audit.Writer) error {
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil // No freeze
 		}
-		if errors.Is(err, lockfile.ErrUnsupportedVersion) {
-			// Freeze from newer lokt version — treat as active (fail safe)
+		if errors.Is(err, lockfile.ErrUnsupportedVersion) || errors.Is(err, lockfile.ErrBadSignature) {
+			// Freeze from newer lokt version, or forged — treat as active (fail safe)
 			return err
 		}
-		if errors.Is(err, lockfile.ErrCorrupted) {
+		if lockfile.Broken(err) {
 			// Corrupted freeze file — remove it
 			_ = os.Remove(path)
 			_ = lockfile.SyncDir(path)
@@ -248,8 +373,72 @@ func CheckFreeze(rootDir, name string, auditor *audit.Writer) error {
 	}
 
 	// Active freeze — emit deny event and return error
-	emitFreezeDenyEvent(auditor, name, existing, existing.LockID)
-	return &FrozenError{Lock: existing}
+	retryAfter := RetryAfter(existing, 0)
+	emitFreezeDenyEvent(auditor, name, existing, existing.LockID, retryAfter)
+	return &FrozenError{Lock: existing, RetryAfter: retryAfter}
+}
+
+// ThawOptions configures WaitForThaw.
+type ThawOptions struct {
+	Auditor *audit.Writer
+	// OnChange, if set, is called with the active freeze when waiting starts
+	// and again whenever it is replaced (e.g. by a new, longer freeze).
+	OnChange func(freeze *lockfile.Lock)
+	// Retry is the poll schedule; the zero value uses DefaultRetryPolicy.
+	Retry RetryPolicy
+}
+
+// WaitForThaw blocks until no active freeze exists for name, polling on
+// opts.Retry. Both the freezes/ and legacy locks/
+// locations are re-checked on every poll. A thaw-wait event is emitted when
+// the wait begins. Returns the time spent waiting, or ctx.Err() if the
+// context ends first.
+func WaitForThaw(ctx context.Context, rootDir, name string, opts ThawOptions) (time.Duration, error) {
+	start := time.Now()
+	var current *lockfile.Lock
+	attempt := 0
+	for {
+		err := CheckFreeze(rootDir, name, nil)
+		if err == nil {
+			return time.Since(start), nil
+		}
+		var frozen *FrozenError
+		if !errors.As(err, &frozen) {
+			return time.Since(start), err
+		}
+		if current == nil {
+			emitThawWaitEvent(opts.Auditor, name, frozen.Lock)
+		}
+		if current == nil || freezeReplaced(current, frozen.Lock) {
+			current = frozen.Lock
+			if opts.OnChange != nil {
+				opts.OnChange(current)
+			}
+		}
+
+		interval := opts.Retry.Interval(attempt)
+		attempt++
+		// Don't oversleep a freeze that is about to expire.
+		if rem := current.Remaining(); rem > 0 && rem < interval {
+			interval = rem
+		}
+		select {
+		case <-ctx.Done():
+			return time.Since(start), ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// freezeReplaced reports whether next is a different freeze than prev.
+func freezeReplaced(prev, next *lockfile.Lock) bool {
+	if prev.LockID != next.LockID || !prev.AcquiredAt.Equal(next.AcquiredAt) {
+		return true
+	}
+	if (prev.ExpiresAt == nil) != (next.ExpiresAt == nil) {
+		return true
+	}
+	return prev.ExpiresAt != nil && !prev.ExpiresAt.Equal(*next.ExpiresAt)
 }
 
 // readFreezeFile reads a freeze file, checking the new freezes/ directory first
@@ -282,22 +471,54 @@ func IsFreezeLock(name string) bool {
 	return len(name) > len(FreezePrefix) && name[:len(FreezePrefix)] == FreezePrefix
 }
 
-func emitFreezeEvent(w *audit.Writer, id identity.Identity, name string, ttlSec int, lockID string) {
+// emitFreezeEvent emits a freeze audit event for the freeze fz, with its
+// reason in extra.reason and, if it was set with an end time (until), that
+// time in extra.until.
+func emitFreezeEvent(w *audit.Writer, id identity.Identity, fz *lockfile.Lock, until bool) {
 	if w == nil {
 		return
 	}
+	var extra map[string]any
+	if fz.Message != "" || until {
+		extra = make(map[string]any)
+	}
+	if fz.Message != "" {
+		extra["reason"] = fz.Message
+	}
+	if until {
+		extra["until"] = fz.ExpiresAt.UTC().Format(time.RFC3339)
+	}
 	w.Emit(&audit.Event{
 		Event:   audit.EventFreeze,
-		Name:    name,
-		LockID:  lockID,
+		Name:    fz.Name,
+		LockID:  fz.LockID,
 		Owner:   id.Owner,
 		Host:    id.Host,
 		PID:     id.PID,
 		AgentID: id.AgentID,
-		TTLSec:  ttlSec,
+		TTLSec:  fz.TTLSec,
+		Extra:   globalFreezeExtra(fz, extra),
 	})
 }
 
+// globalFreezeExtra marks extra with "global": true for an event about the
+// global freeze, or "pattern": true for one about a pattern freeze,
+// allocating it if needed. Other freezes leave it as is.
+func globalFreezeExtra(fz *lockfile.Lock, extra map[string]any) map[string]any {
+	key := "global"
+	switch {
+	case fz.Pattern:
+		key = "pattern"
+	case fz.Name != GlobalFreeze:
+		return extra
+	}
+	if extra == nil {
+		extra = make(map[string]any)
+	}
+	extra[key] = true
+	return extra
+}
+
 func emitUnfreezeEvent(w *audit.Writer, lock *lockfile.Lock, force bool, lockID string) {
 	if w == nil {
 		return
@@ -321,10 +542,11 @@ func emitUnfreezeEvent(w *audit.Writer, lock *lockfile.Lock, force bool, lockID
 		PID:     id.PID,
 		AgentID: id.AgentID,
 		TTLSec:  lock.TTLSec,
+		Extra:   globalFreezeExtra(lock, nil),
 	})
 }
 
-func emitFreezeDenyEvent(w *audit.Writer, name string, freeze *lockfile.Lock, lockID string) {
+func emitFreezeDenyEvent(w *audit.Writer, name string, freeze *lockfile.Lock, lockID string, retryAfter time.Duration) {
 	if w == nil {
 		return
 	}
@@ -337,10 +559,85 @@ func emitFreezeDenyEvent(w *audit.Writer, name string, freeze *lockfile.Lock, lo
 		Host:    id.Host,
 		PID:     id.PID,
 		AgentID: id.AgentID,
-		Extra: map[string]any{
-			"freeze_owner": freeze.Owner,
-			"freeze_host":  freeze.Host,
-			"freeze_pid":   freeze.PID,
-		},
+		Extra: globalFreezeExtra(freeze, map[string]any{
+			"freeze_owner":    freeze.Owner,
+			"freeze_host":     freeze.Host,
+			"freeze_pid":      freeze.PID,
+			"retry_after_sec": int(retryAfter.Seconds()),
+		}),
 	})
 }
+
+func emitThawWaitEvent(w *audit.Writer, name string, freeze *lockfile.Lock) {
+	if w == nil {
+		return
+	}
+	id := identity.Current()
+	extra := map[string]any{
+		"freeze_owner": freeze.Owner,
+		"freeze_host":  freeze.Host,
+		"freeze_pid":   freeze.PID,
+	}
+	if rem := freeze.Remaining(); rem > 0 {
+		extra["freeze_remaining_sec"] = int(rem.Seconds())
+	}
+	w.Emit(&audit.Event{
+		Event:   audit.EventThawWait,
+		Name:    name,
+		LockID:  freeze.LockID,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra:   globalFreezeExtra(freeze, extra),
+	})
+}
+
+// freezeWatch is the freeze check of a wait with AcquireOptions.RespectFreeze.
+// A nil *freezeWatch (RespectFreeze unset) never finds a freeze.
+type freezeWatch struct {
+	opts AcquireOptions
+	last *lockfile.Lock // the freeze found by the previous check, if any
+}
+
+// newFreezeWatch returns the freeze check for a wait with opts.
+func newFreezeWatch(opts AcquireOptions) *freezeWatch {
+	if !opts.RespectFreeze {
+		return nil
+	}
+	return &freezeWatch{opts: opts}
+}
+
+// frozen reports whether any of names is frozen now, reporting a freeze
+// not seen by the previous check (freeze-deny event, OnFrozen). An error
+// other than a *FrozenError from CheckFreeze (a freeze from a newer lokt)
+// is returned.
+func (w *freezeWatch) frozen(rootDir string, names ...string) (bool, error) {
+	if w == nil {
+		return false, nil
+	}
+	var fz *FrozenError
+	name := ""
+	for _, n := range names {
+		err := CheckFreeze(rootDir, n, nil)
+		if errors.As(err, &fz) {
+			name = n
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	if fz == nil {
+		w.last = nil
+		return false, nil
+	}
+	if w.last == nil || freezeReplaced(w.last, fz.Lock) {
+		emitFreezeDenyEvent(w.opts.Auditor, name, fz.Lock, fz.Lock.LockID, fz.RetryAfter)
+		if w.opts.OnFrozen != nil {
+			w.opts.OnFrozen(fz)
+		}
+	}
+	w.last = fz.Lock
+	return true, nil
+}
@@ -1,14 +1,17 @@
 package lock
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/nikolasavic/lokt/internal/audit"
 	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
 )
 
 func TestFreeze(t *testing.T) {
@@ -52,6 +55,61 @@ func TestFreezeRequiresTTL(t *testing.T) {
 	}
 }
 
+func TestFreezeUntilWithReason(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+	end := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+
+	err := Freeze(root, "deploy", FreezeOptions{Until: end, Reason: "DB maintenance\nwindow", Auditor: auditor})
+	if err != nil {
+		t.Fatalf("Freeze() error = %v", err)
+	}
+	lf, err := lockfile.Read(filepath.Join(root, "freezes", "deploy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lf.ExpiresAt == nil || !lf.ExpiresAt.Equal(end) {
+		t.Errorf("ExpiresAt = %v, want %v", lf.ExpiresAt, end)
+	}
+	if lf.TTLSec < 7199 || lf.TTLSec > 7200 {
+		t.Errorf("TTLSec = %d, want the 2h left", lf.TTLSec)
+	}
+	if lf.Message != "DB maintenance window" {
+		t.Errorf("Message = %q, want the cleaned reason", lf.Message)
+	}
+
+	want := "until " + FormatFreezeEnd(end, time.Now())
+	if err := CheckFreeze(root, "deploy", nil); err == nil ||
+		!strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), ": DB maintenance window") {
+		t.Errorf("CheckFreeze() = %v, want the end (%s) and the reason", err, want)
+	}
+
+	events := readAuditEvents(t, root)
+	if len(events) != 1 || events[0].Extra["reason"] != "DB maintenance window" ||
+		events[0].Extra["until"] != end.UTC().Format(time.RFC3339) {
+		t.Errorf("freeze event = %+v, want extra.reason and extra.until", events)
+	}
+
+	for _, opts := range []FreezeOptions{
+		{Until: time.Now().Add(-time.Minute)},
+		{Until: end, TTL: time.Hour},
+	} {
+		if err := Freeze(root, "other", opts); err == nil {
+			t.Errorf("Freeze(%+v) succeeded, want an error", opts)
+		}
+	}
+}
+
+func TestFormatFreezeEnd(t *testing.T) {
+	now := time.Date(2026, 2, 1, 1, 0, 0, 0, time.UTC)
+	if got := FormatFreezeEnd(now.Add(5*time.Hour), now); got != "06:00 UTC" {
+		t.Errorf("same day: %q", got)
+	}
+	if got := FormatFreezeEnd(now.Add(48*time.Hour), now); got != "2026-02-03 01:00 UTC" {
+		t.Errorf("days ahead: %q", got)
+	}
+}
+
 func TestFreezeContention(t *testing.T) {
 	root := t.TempDir()
 
@@ -341,6 +399,195 @@ func TestCheckFreeze_DeadPIDFreezeStillBlocks(t *testing.T) {
 	}
 }
 
+func TestGlobalFreeze(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+
+	if err := Freeze(root, GlobalFreeze, FreezeOptions{TTL: 15 * time.Minute, Auditor: auditor}); err != nil {
+		t.Fatalf("Freeze(GlobalFreeze) error = %v", err)
+	}
+	for _, name := range []string{"deploy", "team/web/build"} {
+		err := CheckFreeze(root, name, auditor)
+		var frozen *FrozenError
+		if !errors.As(err, &frozen) || !strings.Contains(err.Error(), "global freeze") {
+			t.Errorf("CheckFreeze(%q) = %v, want a global FrozenError", name, err)
+		}
+	}
+
+	if err := Unfreeze(root, GlobalFreeze, UnfreezeOptions{Auditor: auditor}); err != nil {
+		t.Fatalf("Unfreeze(GlobalFreeze) error = %v", err)
+	}
+	if err := CheckFreeze(root, "deploy", nil); err != nil {
+		t.Errorf("CheckFreeze() after unfreeze = %v, want nil", err)
+	}
+
+	var kinds []string
+	for _, e := range readAuditEvents(t, root) {
+		if e.Extra["global"] != true {
+			t.Errorf("%s event not marked global: %+v", e.Event, e.Extra)
+		}
+		kinds = append(kinds, e.Event)
+	}
+	if got := strings.Join(kinds, " "); got != "freeze freeze-deny freeze-deny unfreeze" {
+		t.Errorf("events = %q", got)
+	}
+}
+
+func TestGlobalFreeze_NamedFreezeUnchanged(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+	if err := Freeze(root, "deploy", FreezeOptions{TTL: 15 * time.Minute, Auditor: auditor}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckFreeze(root, "build", nil); err != nil {
+		t.Errorf("CheckFreeze(build) = %v, want nil: a named freeze covers its own name only", err)
+	}
+	if err := CheckFreeze(root, "deploy", nil); err == nil || strings.Contains(err.Error(), "global") {
+		t.Errorf("CheckFreeze(deploy) = %v, want the named freeze", err)
+	}
+	for _, e := range readAuditEvents(t, root) {
+		if _, ok := e.Extra["global"]; ok {
+			t.Errorf("named %s event marked global", e.Event)
+		}
+	}
+}
+
+func TestFreezeMatch(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+	if err := Acquire(root, "deploy-api", AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := FreezeMatch(root, "deploy-*", FreezeOptions{TTL: 15 * time.Minute, Reason: "release", Auditor: auditor}); err != nil {
+		t.Fatalf("FreezeMatch() error = %v", err)
+	}
+	if names, err := MatchingNames(root, "deploy-*"); err != nil || len(names) != 1 || names[0] != "deploy-api" {
+		t.Errorf("MatchingNames() = %v, %v, want [deploy-api]", names, err)
+	}
+
+	// Names locked later are frozen too; * doesn't cross a namespace
+	for name, frozen := range map[string]bool{"deploy-web": true, "deploy-api": true, "deploy": false, "deploy-x/y": false, "build": false} {
+		err := CheckFreeze(root, name, auditor)
+		if !frozen {
+			if err != nil {
+				t.Errorf("CheckFreeze(%q) = %v, want nil", name, err)
+			}
+			continue
+		}
+		var fz *FrozenError
+		if !errors.As(err, &fz) || !strings.Contains(err.Error(), `operation matching "deploy-*" frozen`) {
+			t.Errorf("CheckFreeze(%q) = %v, want the pattern freeze", name, err)
+		}
+		if err := Check(root, name, 0, nil); !errors.As(err, &fz) {
+			t.Errorf("Check(%q) = %v, want a FrozenError", name, err)
+		}
+	}
+
+	if err := FreezeMatch(root, "deploy-*", FreezeOptions{TTL: time.Minute}); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("second FreezeMatch() = %v, want ErrLockHeld", err)
+	}
+	if err := Unfreeze(root, "deploy-*", UnfreezeOptions{}); err == nil {
+		t.Error("Unfreeze() of a pattern succeeded, want an invalid name")
+	}
+	if err := UnfreezeMatch(root, "deploy-*", UnfreezeOptions{Auditor: auditor}); err != nil {
+		t.Fatalf("UnfreezeMatch() error = %v", err)
+	}
+	if err := CheckFreeze(root, "deploy-web", nil); err != nil {
+		t.Errorf("CheckFreeze() after UnfreezeMatch = %v, want nil", err)
+	}
+	if err := UnfreezeMatch(root, "deploy-*", UnfreezeOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second UnfreezeMatch() = %v, want ErrNotFound", err)
+	}
+
+	var kinds []string
+	for _, e := range readAuditEvents(t, root) {
+		if e.Event == "acquire" {
+			continue
+		}
+		if e.Extra["pattern"] != true {
+			t.Errorf("%s event not marked pattern: %+v", e.Event, e.Extra)
+		}
+		kinds = append(kinds, e.Event)
+	}
+	if got := strings.Join(kinds, " "); got != "freeze freeze-deny freeze-deny unfreeze" {
+		t.Errorf("events = %q", got)
+	}
+}
+
+func TestFreezeMatch_Validates(t *testing.T) {
+	root := t.TempDir()
+	for _, pattern := range []string{"deploy", "dep[", "../*", "/deploy-*", "a b*", ""} {
+		if err := FreezeMatch(root, pattern, FreezeOptions{TTL: time.Minute}); !errors.Is(err, lockfile.ErrInvalidPattern) {
+			t.Errorf("FreezeMatch(%q) = %v, want ErrInvalidPattern", pattern, err)
+		}
+	}
+	if err := Freeze(root, "_patterns/x", FreezeOptions{TTL: time.Minute}); !errors.Is(err, lockfile.ErrInvalidName) {
+		t.Errorf("Freeze(_patterns/x) = %v, want ErrInvalidName", err)
+	}
+}
+
+func TestCheckFreeze_ExpiredPatternFreeze(t *testing.T) {
+	dir := t.TempDir()
+	if err := FreezeMatch(dir, "deploy-*", FreezeOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	path := root.FreezePatternPath(dir, "deploy-*")
+	fz, err := lockfile.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fz.AcquiredAt = time.Now().Add(-time.Hour)
+	fz.ExpiresAt = nil
+	if err := lockfile.Write(path, fz); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckFreeze(dir, "deploy-web", nil); err != nil {
+		t.Errorf("CheckFreeze() = %v, want nil for an expired pattern freeze", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expired pattern freeze not pruned: %v", err)
+	}
+}
+
+func TestActiveFreezes(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{GlobalFreeze, "deploy"} {
+		if err := Freeze(root, name, FreezeOptions{TTL: time.Minute}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := FreezeMatch(root, "web-*", FreezeOptions{TTL: time.Minute, Reason: "cutover"}); err != nil {
+		t.Fatal(err)
+	}
+	// A legacy freeze, and one shadowed by deploy's freeze in freezes/
+	for _, name := range []string{"build", "deploy"} {
+		legacy := &lockfile.Lock{Name: FreezePrefix + name, Owner: "alice", Host: "h", PID: 1, AcquiredAt: time.Now(), TTLSec: 900}
+		if err := lockfile.Write(filepath.Join(root, "locks", FreezePrefix+name+".json"), legacy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	freezes, err := ActiveFreezes(root)
+	if err != nil {
+		t.Fatalf("ActiveFreezes() error = %v", err)
+	}
+	var got []string
+	for _, fz := range freezes {
+		entry := fz.Name
+		if fz.Legacy {
+			entry += " (legacy)"
+		}
+		if fz.Lock.Pattern {
+			entry += " (pattern: " + fz.Lock.Message + ")"
+		}
+		got = append(got, entry)
+	}
+	want := "__all__, build (legacy), deploy, web-* (pattern: cutover)"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("ActiveFreezes() = %q, want %q", strings.Join(got, ", "), want)
+	}
+}
+
 func TestIsFreezeLock(t *testing.T) {
 	tests := []struct {
 		name string
@@ -711,6 +958,200 @@ func TestFreezeNoNamespaceCollision(t *testing.T) {
 	}
 }
 
+func TestWaitForThaw_Unfreeze(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+
+	if err := Freeze(root, "deploy", FreezeOptions{TTL: 15 * time.Minute}); err != nil {
+		t.Fatalf("Freeze() error = %v", err)
+	}
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		_ = Unfreeze(root, "deploy", UnfreezeOptions{})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	waited, err := WaitForThaw(ctx, root, "deploy", ThawOptions{Auditor: auditor})
+	if err != nil {
+		t.Fatalf("WaitForThaw() error = %v", err)
+	}
+	if waited < 100*time.Millisecond {
+		t.Errorf("waited = %v, want >= 100ms", waited)
+	}
+
+	events := readAuditEvents(t, root)
+	if len(events) != 1 || events[0].Event != audit.EventThawWait {
+		t.Fatalf("expected a single thaw-wait event, got %+v", events)
+	}
+	if events[0].Extra["freeze_owner"] == nil {
+		t.Error("thaw-wait event should record freeze_owner")
+	}
+}
+
+func TestWaitForThaw_NoFreeze(t *testing.T) {
+	root := t.TempDir()
+
+	waited, err := WaitForThaw(context.Background(), root, "deploy", ThawOptions{
+		OnChange: func(*lockfile.Lock) { t.Error("OnChange called without a freeze") },
+	})
+	if err != nil || waited > time.Second {
+		t.Errorf("WaitForThaw() = %v, %v; want immediate return", waited, err)
+	}
+}
+
+func TestWaitForThaw_ReplacedFreeze(t *testing.T) {
+	root := t.TempDir()
+	freezesDir := filepath.Join(root, "freezes")
+	if err := os.MkdirAll(freezesDir, 0750); err != nil {
+		t.Fatalf("MkdirAll error = %v", err)
+	}
+	path := filepath.Join(freezesDir, "deploy.json")
+	write := func(lockID string, ttl int) {
+		now := time.Now()
+		exp := now.Add(time.Duration(ttl) * time.Second)
+		lk := &lockfile.Lock{
+			Name: "deploy", LockID: lockID, Owner: "ops", Host: "h", PID: 1,
+			AcquiredAt: now, TTLSec: ttl, ExpiresAt: &exp,
+		}
+		if err := lockfile.Write(path, lk); err != nil {
+			t.Errorf("Write freeze error = %v", err)
+		}
+	}
+	write("first", 60)
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		write("second", 600)
+	}()
+
+	var seen []string
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := WaitForThaw(ctx, root, "deploy", ThawOptions{
+		OnChange: func(fz *lockfile.Lock) { seen = append(seen, fz.LockID) },
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForThaw() error = %v, want deadline exceeded", err)
+	}
+	if len(seen) != 2 || seen[0] != "first" || seen[1] != "second" {
+		t.Errorf("OnChange saw %v, want [first second]", seen)
+	}
+}
+
+func TestWaitForThaw_LegacyFreezeExpires(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatalf("MkdirAll error = %v", err)
+	}
+	// Legacy freeze with ~300ms left.
+	legacyFreeze := &lockfile.Lock{
+		Name:       "freeze-deploy",
+		Owner:      "alice",
+		Host:       "ci-host",
+		PID:        12345,
+		AcquiredAt: time.Now().Add(-59700 * time.Millisecond),
+		TTLSec:     60,
+	}
+	if err := lockfile.Write(filepath.Join(locksDir, "freeze-deploy.json"), legacyFreeze); err != nil {
+		t.Fatalf("Write legacy freeze error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := WaitForThaw(ctx, root, "deploy", ThawOptions{}); err != nil {
+		t.Fatalf("WaitForThaw() error = %v", err)
+	}
+}
+
+func TestAcquireRecordsThawWait(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+
+	if err := Acquire(root, "deploy", AcquireOptions{Auditor: auditor, ThawWait: 1500 * time.Millisecond}); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	events := readAuditEvents(t, root)
+	if len(events) != 1 || events[0].Event != audit.EventAcquire {
+		t.Fatalf("expected one acquire event, got %+v", events)
+	}
+	if got, _ := events[0].Extra["thaw_wait_ms"].(float64); got != 1500 {
+		t.Errorf("thaw_wait_ms = %v, want 1500", events[0].Extra["thaw_wait_ms"])
+	}
+}
+
+func TestAcquire_RespectFreeze(t *testing.T) {
+	root := t.TempDir()
+	if err := Freeze(root, "deploy", FreezeOptions{TTL: 15 * time.Minute}); err != nil {
+		t.Fatalf("Freeze() error = %v", err)
+	}
+	var frozen *FrozenError
+	if err := Acquire(root, "deploy", AcquireOptions{RespectFreeze: true}); !errors.As(err, &frozen) {
+		t.Fatalf("Acquire() error = %v, want *FrozenError", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "locks", "deploy.json")); !os.IsNotExist(err) {
+		t.Errorf("lock file after a frozen Acquire: %v", err)
+	}
+	// Without RespectFreeze a freeze is the caller's business, as before
+	if err := Acquire(root, "deploy", AcquireOptions{}); err != nil {
+		t.Errorf("Acquire() without RespectFreeze error = %v", err)
+	}
+}
+
+func TestAcquireWithWait_RespectFreeze(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatalf("MkdirAll error = %v", err)
+	}
+	holder := &lockfile.Lock{Name: "deploy", Owner: "other-owner", Host: "other-host", PID: 99999, AcquiredAt: time.Now()}
+	if err := lockfile.Write(filepath.Join(locksDir, "deploy.json"), holder); err != nil {
+		t.Fatalf("Write lock error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	onFrozen := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- AcquireWithWait(ctx, root, "deploy", AcquireOptions{
+			Auditor: auditor, RespectFreeze: true,
+			OnFrozen: func(*FrozenError) { onFrozen++ },
+		})
+	}()
+
+	// Frozen while waiting, then released: the wait must outlast the freeze
+	time.Sleep(100 * time.Millisecond)
+	if err := Freeze(root, "deploy", FreezeOptions{TTL: 15 * time.Minute}); err != nil {
+		t.Fatalf("Freeze() error = %v", err)
+	}
+	if err := Release(root, "deploy", ReleaseOptions{Force: true}); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("AcquireWithWait() returned %v while frozen", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+	if err := Unfreeze(root, "deploy", UnfreezeOptions{}); err != nil {
+		t.Fatalf("Unfreeze() error = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("AcquireWithWait() error = %v", err)
+	}
+
+	denies := 0
+	for _, e := range readAuditEvents(t, root) {
+		if e.Event == audit.EventFreezeDeny {
+			denies++
+		}
+	}
+	if denies != 1 || onFrozen != 1 {
+		t.Errorf("%d freeze-deny events, %d OnFrozen calls; want one of each for the one freeze", denies, onFrozen)
+	}
+}
+
 func containsStr(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsSubstring(s, substr))
 }
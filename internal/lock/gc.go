@@ -0,0 +1,246 @@
+package lock
+
+// This file provides garbage collection of ancillary per-name state: the
+// directories features keep next to locks/ (waiters/, ...) that outlive the
+// lock names they were created for.
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// DefaultGCRetention is how long a lock name must be absent from the audit
+// log before GC removes its leftover state.
+const DefaultGCRetention = 7 * 24 * time.Hour
+
+// Reasons a GC removal was made. The values appear in JSON output.
+const (
+	GCReasonInactive = "inactive" // name unused for the retention period, no live entries
+	GCReasonCap      = "cap"      // beyond the namespace's per-name cap
+	GCReasonEmpty    = "empty"    // empty per-name directory
+)
+
+// GCRule describes one ancillary namespace: a directory under the root with
+// one subdirectory per lock name. A feature that keeps per-name state
+// registers a rule in gcRules instead of pruning on its own.
+type GCRule struct {
+	// Namespace is the directory name under the root.
+	Namespace string
+	// Live reports whether an entry is still in use. Live entries are never
+	// removed, and a name with any live entry is left alone.
+	Live func(info fs.FileInfo, now time.Time) bool
+	// MaxPerName caps how many entries a name keeps; the oldest non-live
+	// entries beyond it are removed. Zero means no cap.
+	MaxPerName int
+}
+
+// gcRules is the namespace registry. Tests may extend it.
+var gcRules = []GCRule{
+	{
+		// Waiter markers are refreshed on every poll; older than
+		// waiterAbandoned means the waiter crashed (see waiters.go).
+		Namespace: root.WaitersDir,
+		Live: func(info fs.FileInfo, now time.Time) bool {
+			return now.Sub(info.ModTime()) < waiterAbandoned
+		},
+	},
+	{
+		// Wait intents are refreshed like waiter markers (see deadlock.go).
+		Namespace: root.IntentsDir,
+		Live: func(info fs.FileInfo, now time.Time) bool {
+			return now.Sub(info.ModTime()) < waiterAbandoned
+		},
+	},
+	{
+		// Reservations are pruned when they end (see reserve.go); GC
+		// only removes the empty directories they leave.
+		Namespace: root.ReservationsDir,
+		Live:      func(fs.FileInfo, time.Time) bool { return true },
+	},
+}
+
+// GCOptions configures GC.
+type GCOptions struct {
+	Retention time.Duration // zero means DefaultGCRetention
+	DryRun    bool          // report what would be removed, remove nothing
+	Auditor   *audit.Writer // receives one summarizing event, unless DryRun
+	Now       time.Time     // zero means time.Now()
+}
+
+// GCRemoval is one file or directory GC removed (or would remove).
+type GCRemoval struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Path      string `json:"path"` // relative to the root
+	Reason    string `json:"reason"`
+}
+
+// GC removes leftover ancillary state for lock names that are no longer in
+// use. It is conservative: names with a lock or freeze file, or with any
+// live entry, are never touched, and non-live entries are only removed
+// once the name hasn't appeared in the audit log for opts.Retention (apart
+// from entries beyond a namespace's cap). Empty per-name directories of
+// unheld names are removed. Best-effort: errors are collected and GC
+// continues.
+func GC(rootDir string, opts GCOptions) ([]GCRemoval, []error) {
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return nil, []error{err}
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	retention := opts.Retention
+	if retention <= 0 {
+		retention = DefaultGCRetention
+	}
+
+	var lastSeen map[string]time.Time
+	var removed []GCRemoval
+	var errs []error
+	for _, rule := range gcRules {
+		dir := filepath.Join(rootDir, rule.Namespace)
+		names, err := root.NameDirs(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		for _, name := range names {
+			if nameHeld(rootDir, name) {
+				continue
+			}
+			if lastSeen == nil {
+				if lastSeen, err = auditLastSeen(rootDir); err != nil {
+					return removed, append(errs, err)
+				}
+			}
+			active := now.Sub(lastSeen[name]) < retention
+			r, e := gcName(rule, rootDir, name, active, now, opts.DryRun)
+			removed = append(removed, r...)
+			errs = append(errs, e...)
+		}
+	}
+
+	if !opts.DryRun && len(removed) > 0 {
+		emitGCEvent(opts.Auditor, removed, retention)
+	}
+	return removed, errs
+}
+
+// gcName collects one name's directory within a namespace.
+func gcName(rule GCRule, rootDir, name string, active bool, now time.Time, dryRun bool) ([]GCRemoval, []error) {
+	dir := filepath.Join(rootDir, rule.Namespace, name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var dead []fs.FileInfo
+	files := 0
+	for _, e := range entries {
+		if e.IsDir() {
+			continue // a namespaced name's directory, collected on its own
+		}
+		files++
+		info, err := e.Info()
+		if err != nil {
+			continue // removed concurrently
+		}
+		if rule.Live != nil && rule.Live(info, now) {
+			return nil, nil
+		}
+		dead = append(dead, info)
+	}
+
+	var remove []fs.FileInfo
+	reason := GCReasonInactive
+	switch {
+	case !active:
+		remove = dead
+	case rule.MaxPerName > 0 && len(dead) > rule.MaxPerName:
+		slices.SortFunc(dead, func(a, b fs.FileInfo) int { return a.ModTime().Compare(b.ModTime()) })
+		remove, reason = dead[:len(dead)-rule.MaxPerName], GCReasonCap
+	}
+
+	var removed []GCRemoval
+	var errs []error
+	rel := func(p string) string { return filepath.ToSlash(filepath.Join(rule.Namespace, name, p)) }
+	for _, info := range remove {
+		if !dryRun {
+			if err := os.RemoveAll(filepath.Join(dir, info.Name())); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		removed = append(removed, GCRemoval{Namespace: rule.Namespace, Name: name, Path: rel(info.Name()), Reason: reason})
+	}
+
+	if files == len(removed) && files == len(entries) {
+		// Remove fails harmlessly if a waiter registered in the meantime.
+		if dryRun || os.Remove(dir) == nil {
+			removed = append(removed, GCRemoval{Namespace: rule.Namespace, Name: name, Path: rel("") + "/", Reason: GCReasonEmpty})
+		}
+	}
+	return removed, errs
+}
+
+// nameHeld reports whether name has a lock or freeze file.
+func nameHeld(rootDir, name string) bool {
+	for _, p := range []string{root.LockFilePath(rootDir, name), root.FreezeFilePath(rootDir, name)} {
+		if _, err := os.Lstat(p); err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return true // unreadable counts as held
+		}
+	}
+	return false
+}
+
+// auditLastSeen returns the time of the latest audit event for each name.
+func auditLastSeen(rootDir string) (map[string]time.Time, error) {
+	seen := make(map[string]time.Time)
+	err := audit.ScanAll(rootDir, time.Time{}, func(e *audit.Event, _ []byte) bool {
+		if e.Timestamp.After(seen[e.Name]) {
+			seen[e.Name] = e.Timestamp
+		}
+		return true
+	})
+	return seen, err
+}
+
+// emitGCEvent records one event summarizing a GC pass. Safe to call with
+// nil auditor.
+func emitGCEvent(w *audit.Writer, removed []GCRemoval, retention time.Duration) {
+	if w == nil {
+		return
+	}
+	byNamespace := make(map[string]int)
+	names := make(map[string]bool)
+	for _, r := range removed {
+		byNamespace[r.Namespace]++
+		names[r.Name] = true
+	}
+	id := identity.Current()
+	w.Emit(&audit.Event{
+		Event:   audit.EventGC,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra: map[string]any{
+			"removed":       len(removed),
+			"names":         len(names),
+			"namespaces":    byNamespace,
+			"retention_sec": int(retention.Seconds()),
+		},
+	})
+}
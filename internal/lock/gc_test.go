@@ -0,0 +1,142 @@
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// writeMarker creates an entry in namespace/name with the given age.
+func writeMarker(t *testing.T, rootDir, namespace, name, file string, age time.Duration) {
+	t.Helper()
+	dir := filepath.Join(rootDir, namespace, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, file)
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gcPaths(removed []GCRemoval) []string {
+	var out []string
+	for _, r := range removed {
+		out = append(out, r.Path+" "+r.Reason)
+	}
+	return out
+}
+
+func TestGC_Waiters(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	abandoned := waiterAbandoned + time.Minute
+
+	writeMarker(t, rootDir, "waiters", "gone", "h.1.1", abandoned)      // inactive: removed
+	writeMarker(t, rootDir, "waiters", "waiting", "h.2.2", time.Second) // live waiter: kept
+	writeMarker(t, rootDir, "waiters", "waiting", "h.3.3", abandoned)   // ...with its whole dir
+	writeMarker(t, rootDir, "waiters", "held", "h.4.4", abandoned)      // lock file exists: kept
+	writeMarker(t, rootDir, "waiters", "recent", "h.5.5", abandoned)    // used recently: kept
+	writeLock(t, filepath.Join(rootDir, "locks"), "held", otherHolder("held"))
+	if err := os.MkdirAll(filepath.Join(rootDir, "waiters", "empty"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	auditor := audit.NewWriter(rootDir)
+	auditor.Emit(&audit.Event{Event: audit.EventRelease, Name: "recent"})
+
+	removed, errs := GC(rootDir, GCOptions{Auditor: auditor})
+	if len(errs) != 0 {
+		t.Fatalf("GC() errors = %v", errs)
+	}
+	want := []string{"waiters/empty/ empty", "waiters/gone/h.1.1 inactive", "waiters/gone/ empty"}
+	if got := gcPaths(removed); !slices.Equal(got, want) {
+		t.Errorf("removed = %q, want %q", got, want)
+	}
+	for _, kept := range []string{"waiting/h.2.2", "waiting/h.3.3", "held/h.4.4", "recent/h.5.5"} {
+		if _, err := os.Stat(filepath.Join(rootDir, "waiters", kept)); err != nil {
+			t.Errorf("%s should be kept: %v", kept, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "waiters", "gone")); !os.IsNotExist(err) {
+		t.Errorf("waiters/gone should be removed (stat: %v)", err)
+	}
+
+	var gcEvents []audit.Event
+	for _, e := range readAuditEvents(t, rootDir) {
+		if e.Event == audit.EventGC {
+			gcEvents = append(gcEvents, e)
+		}
+	}
+	if len(gcEvents) != 1 || gcEvents[0].Extra["removed"] != float64(3) {
+		t.Errorf("gc events = %+v, want one summarizing 3 removals", gcEvents)
+	}
+
+	// A recent name ages out once the retention period passes.
+	removed, _ = GC(rootDir, GCOptions{Now: time.Now().Add(DefaultGCRetention + time.Hour)})
+	if got := gcPaths(removed); !slices.Contains(got, "waiters/recent/h.5.5 inactive") {
+		t.Errorf("after retention, removed = %q, want recent's marker", got)
+	}
+}
+
+func TestGC_DryRun(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	writeMarker(t, rootDir, "waiters", "gone", "h.1.1", waiterAbandoned+time.Minute)
+
+	removed, errs := GC(rootDir, GCOptions{DryRun: true, Auditor: audit.NewWriter(rootDir)})
+	if len(errs) != 0 || len(removed) != 2 {
+		t.Fatalf("GC(dry run) = %v, %v; want marker and dir reported", removed, errs)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "waiters", "gone", "h.1.1")); err != nil {
+		t.Errorf("dry run must not remove anything: %v", err)
+	}
+	if events := readAuditEvents(t, rootDir); len(events) != 0 {
+		t.Errorf("dry run must not emit events, got %+v", events)
+	}
+}
+
+func TestGC_Cap(t *testing.T) {
+	saved := gcRules
+	t.Cleanup(func() { gcRules = saved })
+	gcRules = []GCRule{{Namespace: "records", MaxPerName: 2}}
+
+	rootDir := setupSweepRoot(t)
+	for i, age := range []time.Duration{3 * time.Hour, time.Hour, 2 * time.Hour, time.Minute} {
+		writeMarker(t, rootDir, "records", "deploy", string(rune('a'+i)), age)
+	}
+	audit.NewWriter(rootDir).Emit(&audit.Event{Event: audit.EventAcquire, Name: "deploy"})
+
+	removed, _ := GC(rootDir, GCOptions{})
+	want := []string{"records/deploy/a cap", "records/deploy/c cap"}
+	if got := gcPaths(removed); !slices.Equal(got, want) {
+		t.Errorf("removed = %q, want the two oldest %q", got, want)
+	}
+}
+
+func TestFindPrunable(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	expired := otherHolder("old")
+	expired.AcquiredAt = time.Now().Add(-time.Hour)
+	expired.TTLSec = 60
+	writeLock(t, filepath.Join(rootDir, "locks"), "old", expired)
+	writeLock(t, filepath.Join(rootDir, "locks"), "live", otherHolder("live"))
+	writeLock(t, filepath.Join(rootDir, "freezes"), "frz", &lockfile.Lock{
+		Name: "frz", Owner: "x", Host: "other-host", PID: 1, AcquiredAt: time.Now().Add(-time.Hour), TTLSec: 60,
+	})
+
+	got := FindPrunable(rootDir, 0)
+	want := []Prunable{{Name: "old", Reason: "expired"}, {Name: "frz", Freeze: true, Reason: "expired"}}
+	if !slices.Equal(got, want) {
+		t.Errorf("FindPrunable() = %+v, want %+v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "locks", "old.json")); err != nil {
+		t.Errorf("FindPrunable must not remove: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package lock
+
+import (
+	"os"
+	"slices"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// Holders returns the live holders of name, exclusive first, then shared
+// oldest first; for GlobalFreeze, those of every name (see HoldersMatching
+// for a pattern freeze). It is what freeze
+// --wait-idle waits on: a freeze only stops new acquisitions, so a holder
+// that got in before it keeps running.
+//
+// Like Check it is read-only, and holders Acquire would remove (expired,
+// dead or recycled PID on this host, corrupted files) don't count. Unlike
+// Check, the caller's own holds do.
+func Holders(rootDir, name string) ([]*lockfile.Lock, error) {
+	if err := lockfile.ValidateName(name); err != nil {
+		return nil, err
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if name != GlobalFreeze {
+		return nameHolders(rootDir, name)
+	}
+	names, err := heldNames(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	return namesHolders(rootDir, names)
+}
+
+// HoldersMatching is Holders for every name pattern matches, what freeze
+// --match --wait-idle waits on.
+func HoldersMatching(rootDir, pattern string) ([]*lockfile.Lock, error) {
+	names, err := MatchingNames(rootDir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	rootDir, err = root.Follow(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	return namesHolders(rootDir, names)
+}
+
+// heldNames returns the names with a lock file or shared holders, sorted,
+// legacy freeze files left out.
+func heldNames(rootDir string) ([]string, error) {
+	names, err := root.LockNames(rootDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, n := range SharedNames(rootDir) {
+		if !slices.Contains(names, n) {
+			names = append(names, n)
+		}
+	}
+	slices.Sort(names)
+	return slices.DeleteFunc(names, IsFreezeLock), nil
+}
+
+// namesHolders is Holders for each of names in turn.
+func namesHolders(rootDir string, names []string) ([]*lockfile.Lock, error) {
+	var out []*lockfile.Lock
+	for _, n := range names {
+		holders, err := nameHolders(rootDir, n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, holders...)
+	}
+	return out, nil
+}
+
+// nameHolders implements Holders for a single name.
+func nameHolders(rootDir, name string) ([]*lockfile.Lock, error) {
+	var out []*lockfile.Lock
+	existing, err := lockfile.Read(root.LockFilePath(rootDir, name))
+	switch {
+	case err == nil:
+		if !existing.IsExpired() && !stale.Check(existing).Reason.HolderGone() {
+			out = append(out, existing)
+		}
+	case os.IsNotExist(err), lockfile.Broken(err):
+	default:
+		return nil, err
+	}
+	for _, h := range SharedHolders(rootDir, name) {
+		if !stale.Check(h).Stale {
+			out = append(out, h)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,58 @@
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestHolders(t *testing.T) {
+	root := t.TempDir()
+	if err := Acquire(root, "deploy", AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	for name, pid := range map[string]int{"gone": 999999, "team/web": os.Getpid()} {
+		path := filepath.Join(root, "locks", filepath.FromSlash(name)+".json")
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := lockfile.Write(path, &lockfile.Lock{Version: 1, Name: name, Owner: "other", Host: host, PID: pid, AcquiredAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "locks", "broken.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string][]string{
+		"deploy":     {"deploy"},
+		"gone":       nil, // dead holder: Acquire would remove it
+		"broken":     nil,
+		"free":       nil,
+		GlobalFreeze: {"deploy", "team/web"},
+	} {
+		holders, err := Holders(root, name)
+		if err != nil {
+			t.Fatalf("Holders(%q): %v", name, err)
+		}
+		var got []string
+		for _, h := range holders {
+			got = append(got, h.Name)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Holders(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	if err := Release(root, "deploy", ReleaseOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if holders, _ := Holders(root, "deploy"); len(holders) != 0 {
+		t.Errorf("Holders after release = %d, want none", len(holders))
+	}
+}
@@ -0,0 +1,164 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// ManyResult reports the outcome of AcquireMany.
+type ManyResult struct {
+	Names      []string // Sorted, de-duplicated names in acquisition order
+	Acquired   []string // Names held on return (empty after a rollback)
+	RolledBack []string // Names acquired by this call, then released after a later failure
+	Failed     string   // Name whose acquisition failed; "" on success
+	Attempts   int      // Passes over the set and polls of its blocker, the first pass included
+}
+
+// AcquireMany acquires every name with all-or-nothing semantics.
+//
+// Names are acquired in sorted order so that concurrent callers requesting
+// overlapping sets always contend in the same order. If any acquisition
+// fails, locks taken by this call are released again (locks the caller
+// already held beforehand are left in place) and the error for the failing
+// name is returned.
+//
+// With wait set, a held name doesn't stop the call: the locks taken so far
+// are released, and the whole set is tried again once the blocker looks
+// free, polling on opts.Retry until ctx ends (a *WaitError) or a waited-for
+// holder waits, directly or through others, for a lock this caller holds (a
+// *DeadlockError). No partial set is held while waiting, so two callers
+// each holding part of what the other needs can't block each other. Every
+// acquire and rollback release is audited as usual. With opts.RespectFreeze
+// a freeze of any of the names found while waiting holds the wait up, as in
+// AcquireWithWait.
+func AcquireMany(ctx context.Context, rootDir string, names []string, opts AcquireOptions, wait bool) (ManyResult, error) {
+	start := time.Now()
+	res := ManyResult{Names: sortedUnique(names)}
+	id := identity.Current()
+
+	err := res.attempt(rootDir, id, opts)
+	var held *HeldError
+	if err == nil || !wait || !waitable(err, &held) {
+		return res, err
+	}
+	if opts.OnWait != nil {
+		opts.OnWait(held)
+	}
+
+	progress := newWaitProgress(opts, start)
+	freezes := newFreezeWatch(opts)
+	opts.RespectFreeze = false // freezes checks each poll from here on
+
+	// Best-effort, as in AcquireWithWait: the intent follows the current
+	// blocker so deadlocks through it are still detected.
+	dir, dirErr := root.Follow(rootDir)
+	var wants *intent
+	defer func() {
+		if wants != nil {
+			wants.remove()
+		}
+	}()
+
+	for {
+		if dirErr == nil && (wants == nil || wants.lf.Name != res.Failed) {
+			if wants != nil {
+				wants.remove()
+			}
+			wants, _ = registerIntent(dir, res.Failed)
+		}
+		if wants != nil {
+			wants.touch()
+			if d := findDeadlock(dir, wants.lf, opts.ExclusionGroups); d != nil {
+				emitDeadlockEvent(opts.Auditor, identity.Current(), res.Failed, d)
+				return res, d
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			waitErr := &WaitError{Err: ctx.Err(), Attempts: res.Attempts, Waited: time.Since(start)}
+			if errors.Is(waitErr, context.DeadlineExceeded) {
+				emitWaitTimeoutEvent(opts.Auditor, identity.Current(), res.Failed, waitErr.Waited, res.Attempts, held.Lock)
+			}
+			return res, waitErr
+		case <-time.After(opts.Retry.Interval(res.Attempts - 1)):
+		}
+		if frozen, err := freezes.frozen(rootDir, res.Names...); err != nil {
+			return res, err
+		} else if frozen {
+			res.Attempts++
+			continue
+		}
+		// Don't churn through the rest of the set while the blocker is
+		// plainly still there.
+		_ = tryBreakStale(rootDir, res.Failed, opts.Auditor, opts.SkewGrace)
+		if heldByOther(rootDir, res.Failed, id, opts.SkewGrace) {
+			res.Attempts++
+			progress.report(held.Lock)
+			continue
+		}
+		opts.waited = waitStats{since: start, attempts: res.Attempts + 1}
+		if err = res.attempt(rootDir, id, opts); err == nil || !waitable(err, &held) {
+			return res, err
+		}
+		progress.report(held.Lock)
+	}
+}
+
+// attempt makes one pass over res.Names, rolling back on failure.
+func (res *ManyResult) attempt(rootDir string, id identity.Identity, opts AcquireOptions) error {
+	res.Attempts++
+	res.Acquired, res.RolledBack, res.Failed = nil, nil, ""
+
+	var taken []string // acquired by this call and not held before it
+	for _, name := range res.Names {
+		preHeld := false
+		if lf, err := lockfile.Read(root.LockFilePath(rootDir, name)); err == nil && SameHolder(lf, id) {
+			preHeld = true
+		}
+
+		if err := Acquire(rootDir, name, opts); err != nil {
+			res.Failed = name
+			for i := len(taken) - 1; i >= 0; i-- {
+				_ = Release(rootDir, taken[i], ReleaseOptions{Auditor: opts.Auditor, Shared: opts.Shared})
+				res.RolledBack = append(res.RolledBack, taken[i])
+			}
+			res.Acquired = nil
+			return err
+		}
+		res.Acquired = append(res.Acquired, name)
+		if !preHeld {
+			taken = append(taken, name)
+		}
+	}
+	return nil
+}
+
+// heldByOther reports whether name's lock file shows a live holder other
+// than id (SameHolder). Shared holds and exclusion-group conflicts aren't
+// seen: the caller just tries again.
+func heldByOther(rootDir, name string, id identity.Identity, grace time.Duration) bool {
+	reason, lf := classifyStale(root.LockFilePath(rootDir, name), grace)
+	return lf != nil && reason == stale.ReasonNotStale && !SameHolder(lf, id)
+}
+
+// sortedUnique returns a sorted copy of names with duplicates removed.
+func sortedUnique(names []string) []string {
+	out := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, n := range names {
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,175 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestAcquireMany_SortedAndDeduplicated(t *testing.T) {
+	root := t.TempDir()
+
+	res, err := AcquireMany(context.Background(), root, []string{"svc-c", "svc-a", "svc-b", "svc-a"}, AcquireOptions{}, false)
+	if err != nil {
+		t.Fatalf("AcquireMany() error = %v", err)
+	}
+	want := []string{"svc-a", "svc-b", "svc-c"}
+	if len(res.Acquired) != len(want) {
+		t.Fatalf("Acquired = %v, want %v", res.Acquired, want)
+	}
+	for i, name := range want {
+		if res.Acquired[i] != name || res.Names[i] != name {
+			t.Errorf("order[%d] = %q/%q, want %q", i, res.Names[i], res.Acquired[i], name)
+		}
+		if _, err := os.Stat(filepath.Join(root, "locks", name+".json")); err != nil {
+			t.Errorf("lock %s not held: %v", name, err)
+		}
+	}
+}
+
+func TestAcquireMany_RollbackOnHeld(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	// svc-b is held by someone else; svc-a was already ours before the batch.
+	if err := lockfile.Write(filepath.Join(locksDir, "svc-b.json"), &lockfile.Lock{
+		Version: 1, Name: "svc-b", Owner: "other-owner", Host: "other-host", PID: 1, AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Acquire(root, "svc-a", AcquireOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := AcquireMany(context.Background(), root, []string{"svc-c", "svc-b", "svc-a", "svc-0"}, AcquireOptions{}, false)
+	var held *HeldError
+	if !errors.As(err, &held) {
+		t.Fatalf("AcquireMany() error = %v, want HeldError", err)
+	}
+	if res.Failed != "svc-b" {
+		t.Errorf("Failed = %q, want svc-b", res.Failed)
+	}
+	if len(res.Acquired) != 0 {
+		t.Errorf("Acquired = %v, want none after rollback", res.Acquired)
+	}
+	if len(res.RolledBack) != 1 || res.RolledBack[0] != "svc-0" {
+		t.Errorf("RolledBack = %v, want [svc-0]", res.RolledBack)
+	}
+
+	if _, err := os.Stat(filepath.Join(locksDir, "svc-0.json")); !os.IsNotExist(err) {
+		t.Error("svc-0 should have been rolled back")
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "svc-a.json")); err != nil {
+		t.Error("pre-held svc-a must survive the rollback")
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "svc-c.json")); !os.IsNotExist(err) {
+		t.Error("svc-c should never have been attempted")
+	}
+}
+
+func TestAcquireMany_WaitTimeout(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(filepath.Join(locksDir, "svc-b.json"), &lockfile.Lock{
+		Version: 1, Name: "svc-b", Owner: "other-owner", Host: "other-host", PID: 1, AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	res, err := AcquireMany(ctx, root, []string{"svc-a", "svc-b"}, AcquireOptions{}, true)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AcquireMany() error = %v, want deadline exceeded", err)
+	}
+	if res.Failed != "svc-b" || len(res.RolledBack) != 1 {
+		t.Errorf("result = %+v, want svc-b failed and svc-a rolled back", res)
+	}
+}
+
+func TestAcquireMany_WaitHoldsNothingWhileBlocked(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	blocker := filepath.Join(locksDir, "svc-b.json")
+	if err := lockfile.Write(blocker, &lockfile.Lock{
+		Version: 1, Name: "svc-b", Owner: "other-owner", Host: "other-host", PID: 1, AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		res ManyResult
+		err error
+	}
+	done := make(chan result, 1)
+	opts := AcquireOptions{
+		Auditor: audit.NewWriter(root),
+		Retry:   RetryPolicy{Base: 10 * time.Millisecond, Max: 20 * time.Millisecond},
+	}
+	go func() {
+		res, err := AcquireMany(context.Background(), root, []string{"svc-b", "svc-a"}, opts, true)
+		done <- result{res, err}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(locksDir, "svc-a.json")); !os.IsNotExist(err) {
+		t.Error("svc-a should not be held while waiting for svc-b")
+	}
+	if err := os.Remove(blocker); err != nil {
+		t.Fatal(err)
+	}
+
+	var r result
+	select {
+	case r = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AcquireMany did not return after the blocker left")
+	}
+	if r.err != nil || len(r.res.Acquired) != 2 || r.res.Attempts < 2 {
+		t.Fatalf("AcquireMany() = %+v, %v; want both acquired after a retry", r.res, r.err)
+	}
+
+	var got []string
+	for _, e := range readAuditEvents(t, root) {
+		if e.Event == audit.EventAcquire || e.Event == audit.EventRelease {
+			got = append(got, e.Event+" "+e.Name)
+		}
+	}
+	want := []string{"acquire svc-a", "release svc-a", "acquire svc-a", "acquire svc-b"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("audit events = %v, want %v", got, want)
+	}
+}
+
+func TestAcquireMany_SharedRollback(t *testing.T) {
+	root := t.TempDir()
+	if err := Acquire(root, "svc-b", AcquireOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// svc-b is exclusively ours, but the shared pass below comes from
+	// another owner.
+	t.Setenv("LOKT_OWNER", "reader")
+
+	res, err := AcquireMany(context.Background(), root, []string{"svc-a", "svc-b"}, AcquireOptions{Shared: true}, false)
+	if !errors.Is(err, ErrLockHeld) || res.Failed != "svc-b" {
+		t.Fatalf("AcquireMany(shared) = %+v, %v; want svc-b held", res, err)
+	}
+	if got := SharedHolders(root, "svc-a"); len(got) != 0 {
+		t.Errorf("shared hold on svc-a survived the rollback: %v", got)
+	}
+}
@@ -0,0 +1,84 @@
+package lock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	// PathNamespace is the namespace of the names NameForPath derives.
+	PathNamespace = "path"
+	// pathPrefixLen bounds the readable part of a derived name, so the
+	// lock file's name stays far below filesystem limits however long the
+	// path's base name is.
+	pathPrefixLen = 48
+	// pathHashLen is how many hex digits of the path's SHA-256 a derived
+	// name ends in: 64 bits, ample to keep distinct paths apart.
+	pathHashLen = 16
+)
+
+// foldPathCase is set where the usual filesystems ignore case (macOS,
+// Windows): NameForPath then gives paths differing only in case, which name
+// the same file there, the same name. Injectable for testing.
+var foldPathCase = runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+
+// NameForPath returns the canonical lock name for the file at path, so
+// every script locking a per-file artifact agrees on one name:
+// "path/<base>-<hash>", where base is the path's base name reduced to the
+// characters a name allows and hash is taken from the cleaned absolute path
+// (relative paths are resolved against the working directory; symlinks
+// aren't followed, the file needn't exist). The hash alone tells paths
+// apart; base is only there to be read. Where filesystems ignore case the
+// path is lowercased before hashing.
+func NameForPath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path cannot be empty")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", path, err)
+	}
+	key := filepath.ToSlash(abs)
+	if foldPathCase {
+		key = strings.ToLower(key)
+	}
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])[:pathHashLen]
+	if base := pathNamePrefix(filepath.Base(abs)); base != "" {
+		return PathNamespace + "/" + base + "-" + hash, nil
+	}
+	return PathNamespace + "/" + hash, nil
+}
+
+// pathNamePrefix lowercases base and keeps what a name segment allows:
+// other characters become a hyphen, runs of hyphens or dots collapse to one
+// (".." is never allowed in a name), and leading and trailing ones are
+// dropped. The result is at most pathPrefixLen bytes and may be empty.
+func pathNamePrefix(base string) string {
+	var b strings.Builder
+	var last rune
+	for _, r := range strings.ToLower(base) {
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_':
+		case r == '.':
+			if last == '.' || last == '-' {
+				continue
+			}
+		default:
+			if last == '-' || last == '.' {
+				continue
+			}
+			r = '-'
+		}
+		b.WriteRune(r)
+		last = r
+		if b.Len() >= pathPrefixLen {
+			break
+		}
+	}
+	return strings.Trim(b.String(), ".-")
+}
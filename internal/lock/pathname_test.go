@@ -0,0 +1,93 @@
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestNameForPath(t *testing.T) {
+	dir := t.TempDir()
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+	if dir, err = os.Getwd(); err != nil { // TempDir may be behind a symlink
+		t.Fatal(err)
+	}
+	name := func(path string) string {
+		t.Helper()
+		n, err := NameForPath(path)
+		if err != nil {
+			t.Fatalf("NameForPath(%q): %v", path, err)
+		}
+		if err := lockfile.ValidateName(n); err != nil {
+			t.Errorf("NameForPath(%q) = %q, not a valid name: %v", path, n, err)
+		}
+		return n
+	}
+
+	abs := name(filepath.Join(dir, "cache", "pkg-abc123.tar"))
+	if !strings.HasPrefix(abs, "path/pkg-abc123.tar-") {
+		t.Errorf("name = %q, want the base name readable", abs)
+	}
+	for _, p := range []string{"cache/pkg-abc123.tar", "./cache/../cache//pkg-abc123.tar"} {
+		if got := name(p); got != abs {
+			t.Errorf("NameForPath(%q) = %q, want %q like the absolute path", p, got, abs)
+		}
+	}
+	if other := name(filepath.Join(dir, "other", "pkg-abc123.tar")); other == abs {
+		t.Error("the same base name in another directory got the same name")
+	}
+
+	// Bases a name can't hold still give valid names, kept apart by the hash.
+	for _, base := range []string{"pkg..tar", "Ünïcode file (1).tar", "...", "-.-", "a.json"} {
+		name(filepath.Join(dir, base))
+	}
+	if a, b := name(filepath.Join(dir, "a b")), name(filepath.Join(dir, "a:b")); a == b {
+		t.Errorf("%q and %q both map to %q", "a b", "a:b", a)
+	}
+	if got := name(string(filepath.Separator)); !strings.HasPrefix(got, PathNamespace+"/") {
+		t.Errorf("root directory: %q", got)
+	}
+	long := name(filepath.Join(dir, strings.Repeat("x", 300)))
+	if len(long) > len(PathNamespace)+1+pathPrefixLen+1+pathHashLen {
+		t.Errorf("name for a long base is %d bytes: %q", len(long), long)
+	}
+
+	if _, err := NameForPath(""); err == nil {
+		t.Error("empty path: want an error")
+	}
+}
+
+func TestNameForPath_Case(t *testing.T) {
+	dir := t.TempDir()
+	upper, lower := filepath.Join(dir, "Cache", "PKG.tar"), filepath.Join(dir, "cache", "pkg.tar")
+
+	// Where filesystems ignore case, both spellings are one file and one lock.
+	saved := foldPathCase
+	t.Cleanup(func() { foldPathCase = saved })
+	foldPathCase = true
+	a, _ := NameForPath(upper)
+	b, _ := NameForPath(lower)
+	if a != b {
+		t.Errorf("case-insensitive: %q and %q, want one name", a, b)
+	}
+
+	foldPathCase = false
+	a, _ = NameForPath(upper)
+	b, _ = NameForPath(lower)
+	if a == b {
+		t.Errorf("case-sensitive: both %q, want distinct names", a)
+	}
+	if !strings.HasPrefix(a, "path/pkg.tar-") {
+		t.Errorf("name = %q, want a lowercase prefix", a)
+	}
+}
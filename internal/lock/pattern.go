@@ -0,0 +1,191 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// FreezeMatch freezes every name pattern matches (path.Match syntax; see
+// lockfile.ValidatePattern), held now or not: the pattern itself is stored,
+// in root.FreezePatternsPath, so locks created later are frozen too. It
+// takes the same options as Freeze, and its freeze is removed with
+// UnfreezeMatch and the same pattern.
+func FreezeMatch(rootDir, pattern string, opts FreezeOptions) error {
+	if err := lockfile.ValidatePattern(pattern); err != nil {
+		return err
+	}
+	return freeze(rootDir, pattern, true, opts)
+}
+
+// UnfreezeMatch removes the pattern freeze on pattern, as Unfreeze removes
+// a freeze by name.
+func UnfreezeMatch(rootDir, pattern string, opts UnfreezeOptions) error {
+	if err := lockfile.ValidatePattern(pattern); err != nil {
+		return err
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return err
+	}
+	file := root.FreezePatternPath(rootDir, pattern)
+	existing, err := lockfile.Read(file)
+	return unfreezeFile(pattern, existing, file, err, opts)
+}
+
+// MatchingNames returns the names held now, exclusively or shared, that
+// pattern matches, sorted.
+func MatchingNames(rootDir, pattern string) ([]string, error) {
+	if err := lockfile.ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := heldNames(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(names, func(n string) bool {
+		ok, _ := path.Match(pattern, n)
+		return !ok
+	}), nil
+}
+
+// patternFreezeFile is one file of root.FreezePatternsPath as read.
+type patternFreezeFile struct {
+	lock *lockfile.Lock
+	path string
+	err  error
+}
+
+// readPatternFreezes reads every pattern freeze of rootDir, expired ones
+// included, in directory order.
+func readPatternFreezes(rootDir string) []patternFreezeFile {
+	dir := root.FreezePatternsPath(rootDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil // none, or unreadable: assume none
+	}
+	var out []patternFreezeFile
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		f := patternFreezeFile{path: filepath.Join(dir, e.Name())}
+		f.lock, f.err = lockfile.Read(f.path)
+		out = append(out, f)
+	}
+	return out
+}
+
+// matches reports whether f is a readable pattern freeze covering name.
+func (f patternFreezeFile) matches(name string) bool {
+	if f.err != nil || !f.lock.Pattern {
+		return false
+	}
+	ok, _ := path.Match(f.lock.Name, name)
+	return ok
+}
+
+// checkPatternFreezes is CheckFreeze for the pattern freezes alone.
+func checkPatternFreezes(rootDir, name string, auditor *audit.Writer) error {
+	for _, f := range readPatternFreezes(rootDir) {
+		if f.err == nil && !f.matches(name) {
+			continue
+		}
+		// Unreadable ones get CheckFreeze's treatment: a corrupted file
+		// is removed, one from a newer lokt freezes every name
+		if err := activeFreeze(name, f.lock, f.path, f.err, auditor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patternFrozen is Check's pattern freeze check: the active pattern freeze
+// matching name, if any, without pruning anything.
+func patternFrozen(rootDir, name string) (*lockfile.Lock, error) {
+	for _, f := range readPatternFreezes(rootDir) {
+		switch {
+		case errors.Is(f.err, lockfile.ErrUnsupportedVersion), errors.Is(f.err, lockfile.ErrBadSignature):
+			return nil, f.err // fail safe, as CheckFreeze does
+		case f.matches(name) && !f.lock.IsExpired():
+			return f.lock, nil
+		}
+	}
+	return nil, nil
+}
+
+// ActiveFreeze is a freeze ActiveFreezes found.
+type ActiveFreeze struct {
+	// Name is the frozen name (GlobalFreeze for the global freeze), or the
+	// pattern of a pattern freeze.
+	Name string
+	Lock *lockfile.Lock
+	Path string
+	// Legacy marks a freeze at locks/freeze-<name>.json, where freezes
+	// were kept before freezes/.
+	Legacy bool
+}
+
+// ActiveFreezes lists the unexpired freezes of rootDir, sorted by name: the
+// global freeze, freezes by name (legacy ones included) and pattern
+// freezes. Unreadable files are left out. Read-only.
+func ActiveFreezes(rootDir string) ([]ActiveFreeze, error) {
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := root.Names(root.FreezesPath(rootDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var out []ActiveFreeze
+	seen := make(map[string]bool)
+	add := func(name, file string, legacy bool) {
+		lf, err := lockfile.Read(file)
+		if err != nil || lf.IsExpired() {
+			return
+		}
+		if !legacy && lf.Name != "" {
+			name = lf.Name // not the stem of a name too long for a file name
+		}
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		out = append(out, ActiveFreeze{Name: name, Lock: lf, Path: file, Legacy: legacy})
+	}
+	for _, n := range names {
+		if !strings.HasPrefix(n, root.FreezePatternsDir+"/") {
+			add(n, root.FreezeFilePath(rootDir, n), false)
+		}
+	}
+	for _, f := range readPatternFreezes(rootDir) {
+		if f.err == nil && f.lock.Pattern && !f.lock.IsExpired() {
+			out = append(out, ActiveFreeze{Name: f.lock.Name, Lock: f.lock, Path: f.path})
+		}
+	}
+	// Legacy files are shadowed by a freeze of the same name in freezes/,
+	// as in CheckFreeze
+	lockNames, err := root.LockNames(rootDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, n := range lockNames {
+		if IsFreezeLock(n) {
+			add(n[len(FreezePrefix):], root.LockFilePath(rootDir, n), true)
+		}
+	}
+	slices.SortFunc(out, func(a, b ActiveFreeze) int { return strings.Compare(a.Name, b.Name) })
+	return out, nil
+}
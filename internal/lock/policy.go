@@ -0,0 +1,58 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/policy"
+)
+
+// ErrPolicy is returned when a lock or freeze breaks its policy.json rule.
+var ErrPolicy = errors.New("policy violation")
+
+// PolicyError provides details about a TTL rejected by policy.json.
+type PolicyError struct {
+	Name    string
+	Pattern string // the policy.json pattern whose rule applied
+	Reason  string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("lock %q: %s (policy.json rule %q)", e.Name, e.Reason, e.Pattern)
+}
+
+func (e *PolicyError) Unwrap() error {
+	return ErrPolicy
+}
+
+// policyTTL returns the TTL to use for name under <rootDir>/policy.json:
+// ttl itself, the rule's default_ttl if ttl is zero, or max_ttl if ttl
+// exceeds it (no TTL counts as exceeding it) and the rule clamps. It
+// returns a *PolicyError if the rule rejects the TTL, and an error if the
+// policy file can't be loaded, so a broken policy doesn't silently stop
+// being enforced.
+func policyTTL(rootDir, name string, ttl time.Duration) (time.Duration, error) {
+	p, err := policy.Load(rootDir)
+	if err != nil {
+		return 0, err
+	}
+	pattern, rule, ok := p.Match(name)
+	if !ok {
+		return ttl, nil
+	}
+	maxTTL := time.Duration(rule.MaxTTL)
+	if ttl == 0 {
+		ttl = time.Duration(rule.DefaultTTL)
+	}
+	over := maxTTL > 0 && (ttl == 0 || ttl > maxTTL)
+	switch {
+	case over && rule.ClampTTL:
+		return maxTTL, nil
+	case ttl == 0 && (rule.RequireTTL || over):
+		return 0, &PolicyError{Name: name, Pattern: pattern, Reason: "a TTL is required; pass --ttl"}
+	case over:
+		return 0, &PolicyError{Name: name, Pattern: pattern, Reason: fmt.Sprintf("TTL %s exceeds max_ttl %s", ttl, maxTTL)}
+	}
+	return ttl, nil
+}
@@ -0,0 +1,89 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/policy"
+)
+
+func TestAcquire_Policy(t *testing.T) {
+	root := t.TempDir()
+	data := `{"locks": {
+		"deploy-*": {"default_ttl": "30m", "max_ttl": "1h", "require_ttl": true},
+		"build":    {"max_ttl": "10m", "clamp_ttl": true}
+	}}`
+	if err := os.WriteFile(policy.Path(root), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ttlOf := func(name string) int {
+		t.Helper()
+		lf, err := lockfile.Read(filepath.Join(root, "locks", name+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lf.TTLSec
+	}
+
+	if err := Acquire(root, "deploy-web", AcquireOptions{}); err != nil {
+		t.Fatalf("Acquire(deploy-web) error = %v", err)
+	}
+	if got := ttlOf("deploy-web"); got != 1800 {
+		t.Errorf("TTL without --ttl = %ds, want default_ttl 1800", got)
+	}
+
+	var perr *PolicyError
+	err := Acquire(root, "deploy-api", AcquireOptions{TTL: 2 * time.Hour})
+	if !errors.As(err, &perr) || perr.Pattern != "deploy-*" || !errors.Is(err, ErrPolicy) {
+		t.Errorf("Acquire over max_ttl error = %v, want a PolicyError for deploy-*", err)
+	}
+
+	if err := Acquire(root, "build", AcquireOptions{}); err != nil {
+		t.Fatalf("Acquire(build) error = %v", err)
+	}
+	if got := ttlOf("build"); got != 600 {
+		t.Errorf("TTL of a clamped lock without one = %ds, want max_ttl 600", got)
+	}
+
+	if err := Acquire(root, "other", AcquireOptions{}); err != nil {
+		t.Fatalf("Acquire(other) error = %v", err)
+	}
+	if got := ttlOf("other"); got != 0 {
+		t.Errorf("TTL of an unmatched lock = %ds, want none", got)
+	}
+
+	if err := Freeze(root, "deploy-db", FreezeOptions{TTL: 3 * time.Hour}); !errors.As(err, &perr) {
+		t.Errorf("Freeze over max_ttl error = %v, want a PolicyError", err)
+	}
+	if err := Freeze(root, "deploy-db", FreezeOptions{}); err != nil {
+		t.Errorf("Freeze without a TTL error = %v, want default_ttl applied", err)
+	}
+}
+
+func TestAcquire_PolicyRequireTTL(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(policy.Path(root), []byte(`{"locks": {"db-*": {"require_ttl": true}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var perr *PolicyError
+	if err := Acquire(root, "db-migrate", AcquireOptions{}); !errors.As(err, &perr) {
+		t.Fatalf("Acquire without a TTL error = %v, want a PolicyError", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "locks", "db-migrate.json")); !os.IsNotExist(err) {
+		t.Errorf("rejected lock left a file: %v", err)
+	}
+	if err := Acquire(root, "db-migrate", AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Errorf("Acquire with a TTL error = %v", err)
+	}
+
+	if err := os.WriteFile(policy.Path(root), []byte(`{"locks": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Acquire(root, "anything", AcquireOptions{}); err == nil {
+		t.Error("Acquire with a broken policy.json should fail rather than ignore it")
+	}
+}
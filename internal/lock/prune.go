@@ -0,0 +1,138 @@
+package lock
+
+// This file provides Prune, the explicit clean-up behind lokt prune. Unlike
+// the opportunistic sweep (sweep.go), which only removes locks that are both
+// expired and abandoned, Prune removes everything a waiting acquire would
+// break (StaleReason), because someone asked for it.
+
+import (
+	"os"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// PruneOptions configures Prune.
+type PruneOptions struct {
+	// DryRun reports what would be removed without removing it or
+	// emitting events.
+	DryRun bool
+	// OlderThan only prunes locks and freezes acquired at least this long
+	// ago (corrupted files: last modified); zero means any age.
+	OlderThan time.Duration
+	// SkewGrace is how long past expiry another host's lock or freeze must
+	// be before it counts as expired (stale.CheckWithGrace).
+	SkewGrace time.Duration
+	Auditor   *audit.Writer
+}
+
+// Pruned is a lock or freeze Prune removed, or would remove.
+type Pruned struct {
+	Name   string       `json:"name"`
+	Freeze bool         `json:"freeze,omitempty"`
+	Reason stale.Reason `json:"reason"`
+	// Holder is the lock as it was; nil for a corrupted file.
+	Holder *lockfile.Lock `json:"holder,omitempty"`
+}
+
+// Prune removes every stale lock and freeze: locks whose TTL expired or
+// whose same-host holder is gone (dead or recycled PID), freezes whose TTL
+// expired, and corrupted files of either kind. Each removal emits an
+// auto-prune or corrupt-break event. A live lock is never removed: each file
+// is re-read just before removal and left alone if it changed.
+//
+// It returns what was removed (or, with DryRun, would be) and the errors of
+// removals that failed.
+func Prune(rootDir string, opts PruneOptions) ([]Pruned, []error) {
+	var out []Pruned
+	var errs []error
+	id := identity.Current()
+	now := time.Now()
+	for _, freeze := range []bool{false, true} {
+		names, err := sweepNames(rootDir, freeze)
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		for _, name := range names {
+			path := sweepPath(rootDir, name, freeze)
+			reason, lf := pruneReason(path, freeze, opts.SkewGrace)
+			if reason == stale.ReasonNotStale || !pruneOldEnough(path, lf, opts.OlderThan, now) {
+				continue
+			}
+			p := Pruned{Name: name, Freeze: freeze, Reason: reason, Holder: lf}
+			if opts.DryRun {
+				out = append(out, p)
+				continue
+			}
+			// The holder may have been replaced since it was classified
+			removed, err := removeIfStill(path, reason, lf, func(path string) (stale.Reason, *lockfile.Lock) {
+				return pruneReason(path, freeze, opts.SkewGrace)
+			})
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if !removed {
+				continue
+			}
+			out = append(out, p)
+			if lf == nil {
+				emitCorruptBreakEvent(opts.Auditor, id, name)
+			} else {
+				emitAutoPruneEvent(opts.Auditor, id, name, lf, reason)
+			}
+		}
+	}
+	return out, errs
+}
+
+// pruneReason classifies the lock or freeze file at path for Prune. A
+// freeze is stale only when expired or corrupted: its PID is the freeze
+// command's, which exits right away.
+func pruneReason(path string, freeze bool, grace time.Duration) (stale.Reason, *lockfile.Lock) {
+	reason, lf := classifyStale(path, grace)
+	if freeze && lf != nil {
+		if stale.CheckWithGrace(lf, grace).Reason == stale.ReasonExpired {
+			return stale.ReasonExpired, lf
+		}
+		return stale.ReasonNotStale, lf
+	}
+	return reason, lf
+}
+
+// pruneOldEnough reports whether the lock lf at path was acquired at least
+// olderThan before now. A corrupted file (nil lf) goes by its mtime.
+func pruneOldEnough(path string, lf *lockfile.Lock, olderThan time.Duration, now time.Time) bool {
+	if olderThan <= 0 {
+		return true
+	}
+	acquired := time.Time{}
+	if lf != nil {
+		acquired = lf.AcquiredAt
+	} else if info, err := os.Stat(path); err == nil {
+		acquired = info.ModTime()
+	}
+	return !acquired.IsZero() && now.Sub(acquired) >= olderThan
+}
+
+// sameLock reports whether a and b are the same acquisition (both nil for
+// a corrupted file).
+func sameLock(a, b *lockfile.Lock) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.SameAcquisition(b)
+}
+
+// removeIfStill removes the file at path if, as it is at that moment,
+// classify still finds it stale for reason and the same acquisition as lf
+// (lockfile.RemoveIf), so a lock renewed or re-acquired since it was
+// classified stays.
+func removeIfStill(path string, reason stale.Reason, lf *lockfile.Lock, classify func(path string) (stale.Reason, *lockfile.Lock)) (bool, error) {
+	return lockfile.RemoveIf(path, func(aside string) bool {
+		again, current := classify(aside)
+		return again == reason && sameLock(lf, current)
+	})
+}
@@ -0,0 +1,79 @@
+package lock
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+func TestPrune(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	locks := filepath.Join(rootDir, "locks")
+	freezes := filepath.Join(rootDir, "freezes")
+	host, _ := os.Hostname()
+	old := time.Now().Add(-2 * time.Hour)
+
+	writeLock(t, locks, "expired", &lockfile.Lock{Version: 1, Name: "expired", Owner: "a", Host: "other-host", PID: 1, AcquiredAt: old, TTLSec: 60})
+	writeLock(t, locks, "dead", &lockfile.Lock{Version: 1, Name: "dead", Owner: "a", Host: host, PID: 999999999, AcquiredAt: time.Now()})
+	writeLock(t, locks, "live", &lockfile.Lock{Version: 1, Name: "live", Owner: "a", Host: host, PID: os.Getpid(), AcquiredAt: old})
+	writeLock(t, locks, "remote", &lockfile.Lock{Version: 1, Name: "remote", Owner: "a", Host: "other-host", PID: 1, AcquiredAt: old})
+	if err := os.WriteFile(filepath.Join(locks, "corrupt.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(locks, "corrupt.json"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	// A freeze's PID is gone once lokt freeze returns; only expiry counts
+	writeLock(t, freezes, "thawed", &lockfile.Lock{Version: 1, Name: "thawed", Owner: "a", Host: host, PID: 999999999, AcquiredAt: old, TTLSec: 60})
+	writeLock(t, freezes, "frozen", &lockfile.Lock{Version: 1, Name: "frozen", Owner: "a", Host: host, PID: 999999999, AcquiredAt: old, TTLSec: 86400})
+
+	names := func(ps []Pruned) []string {
+		var out []string
+		for _, p := range ps {
+			out = append(out, p.Name)
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	dry, errs := Prune(rootDir, PruneOptions{DryRun: true, OlderThan: time.Hour})
+	if want := []string{"corrupt", "expired", "thawed"}; len(errs) != 0 || !slices.Equal(names(dry), want) {
+		t.Errorf("Prune(dry run, older than 1h) = %v, %v; want %v", names(dry), errs, want)
+	}
+	if _, err := os.Stat(filepath.Join(locks, "expired.json")); err != nil {
+		t.Errorf("dry run removed a lock: %v", err)
+	}
+
+	auditor := audit.NewWriter(rootDir)
+	pruned, errs := Prune(rootDir, PruneOptions{Auditor: auditor})
+	if want := []string{"corrupt", "dead", "expired", "thawed"}; len(errs) != 0 || !slices.Equal(names(pruned), want) {
+		t.Fatalf("Prune() = %v, %v; want %v", names(pruned), errs, want)
+	}
+	for _, p := range pruned {
+		if p.Name == "dead" && (p.Reason != stale.ReasonDeadPID || p.Holder == nil) {
+			t.Errorf("dead lock pruned as %+v, want dead_pid with its holder", p)
+		}
+	}
+	for _, name := range []string{"live", "remote"} {
+		if _, err := os.Stat(filepath.Join(locks, name+".json")); err != nil {
+			t.Errorf("%s lock was removed: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(freezes, "frozen.json")); err != nil {
+		t.Errorf("active freeze was removed: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, e := range readSweepAuditEvents(t, rootDir) {
+		counts[e.Event]++
+	}
+	if counts[audit.EventAutoPrune] != 3 || counts[audit.EventCorruptBreak] != 1 {
+		t.Errorf("audit events = %v, want 3 auto-prune and 1 corrupt-break", counts)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/nikolasavic/lokt/internal/audit"
 	"github.com/nikolasavic/lokt/internal/identity"
@@ -61,27 +60,49 @@ type ReleaseOptions struct {
 	Force      bool          // Skip ownership check (break-glass)
 	BreakStale bool          // Remove only if lock is stale (expired TTL or dead PID)
 	Auditor    *audit.Writer // Optional audit writer for event logging
+	// Shared releases a shared hold even if an exclusive lock exists too.
+	// Without it, a name with no lock file is released from its shared
+	// holders.
+	Shared bool
+	// LockID, if set, releases the lock only while it is still that
+	// acquisition, instead of checking the owner: lokt run's releaser frees
+	// the lock of a command it outlived this way.
+	LockID string
 }
 
 // Release removes a lock file.
 // Returns ErrNotFound if lock doesn't exist.
 // Returns NotOwnerError if caller doesn't own the lock (unless Force or BreakStale is set).
 // Returns NotStaleError if BreakStale is set but the lock is not stale.
+// A corrupted or invalid lock file (lockfile.Broken) has no holder to
+// check: Force and BreakStale remove it. While signing is on, an unsigned
+// lock file (lockfile.ErrUnsigned) or a badly signed one
+// (lockfile.ErrBadSignature) is only removed with Force.
 func Release(rootDir, name string, opts ReleaseOptions) error {
-	if err := lockfile.ValidateName(name); err != nil {
+	// A holder releases its own slot (guard --slots); no one breaks one
+	// by name.
+	if err := validName(name, !opts.Force && !opts.BreakStale); err != nil {
+		return err
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
 		return err
 	}
 
 	path := root.LockFilePath(rootDir, name)
 
+	if opts.Shared {
+		return releaseShared(rootDir, name, opts)
+	}
+
 	// Check if lock exists
 	existing, err := lockfile.Read(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return ErrNotFound
+			return releaseShared(rootDir, name, opts)
 		}
-		if errors.Is(err, lockfile.ErrUnsupportedVersion) {
-			// Lock from a newer lokt version — force can still remove
+		if errors.Is(err, lockfile.ErrUnsupportedVersion) || errors.Is(err, lockfile.ErrBadSignature) {
+			// Lock from a newer lokt version, or forged — force can still remove
 			if opts.Force {
 				if removeErr := os.Remove(path); removeErr != nil {
 					if os.IsNotExist(removeErr) {
@@ -94,8 +115,8 @@ func Release(rootDir, name string, opts ReleaseOptions) error {
 			}
 			return fmt.Errorf("read lock: %w", err)
 		}
-		if errors.Is(err, lockfile.ErrCorrupted) {
-			// Corrupted lock file — handle based on release mode
+		if lockfile.Broken(err) {
+			// Corrupted or invalid lock file (lockfile.Broken) — handle based on release mode
 			if opts.Force || opts.BreakStale {
 				if removeErr := os.Remove(path); removeErr != nil {
 					if os.IsNotExist(removeErr) {
@@ -107,21 +128,32 @@ func Release(rootDir, name string, opts ReleaseOptions) error {
 				emitCorruptBreakReleaseEvent(opts.Auditor, name)
 				return nil
 			}
-			return fmt.Errorf("lock %q has corrupted data: %w", name, err)
+			return fmt.Errorf("lock %q has corrupted data (--break-stale removes it): %w", name, err)
 		}
 		return fmt.Errorf("read lock: %w", err)
 	}
 
+	if existing.Unsigned() && !opts.Force {
+		return fmt.Errorf("%w: lock %q (signing is on; --force releases it anyway)", lockfile.ErrUnsigned, name)
+	}
+
 	// Handle different release modes
+	reason := stale.ReasonNotStale
 	switch {
 	case opts.Force:
 		// Force: skip all checks
 	case opts.BreakStale:
 		// BreakStale: only remove if lock is stale
-		result := stale.Check(existing)
+		result := stale.CheckFile(path, existing, 0)
 		if !result.Stale {
 			return &NotStaleError{Lock: existing, Reason: result.Reason}
 		}
+		reason = result.Reason
+	case opts.LockID != "":
+		if existing.LockID != opts.LockID {
+			return fmt.Errorf("%w: now held by %s@%s (pid %d, lock_id %s)",
+				ErrLockStolen, existing.Owner, existing.Host, existing.PID, existing.LockID)
+		}
 	default:
 		// Normal: check ownership
 		id := identity.Current()
@@ -137,12 +169,16 @@ func Release(rootDir, name string, opts ReleaseOptions) error {
 		}
 		return fmt.Errorf("remove lock: %w", err)
 	}
+	dropFlock(path)
 	if err := lockfile.SyncDir(path); err != nil {
 		return fmt.Errorf("sync directory: %w", err)
 	}
+	if existing.Session != "" {
+		deregisterSession(rootDir, existing.Session, name)
+	}
 
 	// Emit release event
-	emitReleaseEvent(opts.Auditor, existing, opts)
+	emitReleaseEvent(opts.Auditor, existing, opts, reason)
 
 	return nil
 }
@@ -152,8 +188,7 @@ func Release(rootDir, name string, opts ReleaseOptions) error {
 // Locks that are unreadable, corrupted, or owned by a different owner are skipped.
 // Returns an empty slice (not an error) if no locks match or the locks directory doesn't exist.
 func ReleaseByOwner(rootDir, owner string, opts ReleaseOptions) ([]string, error) {
-	locksDir := root.LocksPath(rootDir)
-	entries, err := os.ReadDir(locksDir)
+	names, err := root.LockNames(rootDir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
@@ -162,16 +197,7 @@ func ReleaseByOwner(rootDir, owner string, opts ReleaseOptions) ([]string, error
 	}
 
 	var released []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		if !strings.HasSuffix(name, ".json") {
-			continue
-		}
-		lockName := name[:len(name)-5]
-
+	for _, lockName := range names {
 		path := root.LockFilePath(rootDir, lockName)
 		lf, err := lockfile.Read(path)
 		if err != nil {
@@ -195,7 +221,7 @@ func ReleaseByOwner(rootDir, owner string, opts ReleaseOptions) ([]string, error
 		}
 		_ = lockfile.SyncDir(path)
 
-		emitReleaseEvent(opts.Auditor, lf, opts)
+		emitReleaseEvent(opts.Auditor, lf, opts, stale.ReasonNotStale)
 		released = append(released, lockName)
 	}
 
@@ -215,20 +241,30 @@ func emitCorruptBreakReleaseEvent(w *audit.Writer, name string) {
 		Host:    id.Host,
 		PID:     id.PID,
 		AgentID: id.AgentID,
+		Extra:   staleReasonExtra(stale.ReasonCorrupted),
 	})
 }
 
 // emitReleaseEvent emits the appropriate release audit event. Safe to call with nil auditor.
-func emitReleaseEvent(w *audit.Writer, lock *lockfile.Lock, opts ReleaseOptions) {
+// For stale breaks, reason is recorded in the event extras.
+func emitReleaseEvent(w *audit.Writer, lock *lockfile.Lock, opts ReleaseOptions, reason stale.Reason) {
 	if w == nil {
 		return
 	}
 
 	eventType := audit.EventRelease
+	var extra map[string]any
 	if opts.Force {
 		eventType = audit.EventForceBreak
 	} else if opts.BreakStale {
 		eventType = audit.EventStaleBreak
+		extra = staleReasonExtra(reason)
+	}
+	if lock.Mode != "" {
+		if extra == nil {
+			extra = make(map[string]any)
+		}
+		extra["mode"] = lock.Mode
 	}
 
 	id := identity.Current()
@@ -241,5 +277,6 @@ func emitReleaseEvent(w *audit.Writer, lock *lockfile.Lock, opts ReleaseOptions)
 		PID:     id.PID,
 		AgentID: id.AgentID,
 		TTLSec:  lock.TTLSec,
+		Extra:   extra,
 	})
 }
@@ -83,6 +83,32 @@ func TestReleaseNotOwner(t *testing.T) {
 	}
 }
 
+func TestReleaseByLockID(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0700); err != nil {
+		t.Fatalf("MkdirAll error = %v", err)
+	}
+	// Held under another owner: a lock ID match is enough to release it.
+	path := filepath.Join(locksDir, "run.json")
+	if err := lockfile.Write(path, &lockfile.Lock{
+		Name: "run", LockID: "abc", Owner: "someone-else", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatalf("Write lock error = %v", err)
+	}
+
+	err := Release(root, "run", ReleaseOptions{LockID: "xyz"})
+	if !errors.Is(err, ErrLockStolen) {
+		t.Fatalf("Release() with another lock ID error = %v, want ErrLockStolen", err)
+	}
+	if err := Release(root, "run", ReleaseOptions{LockID: "abc"}); err != nil {
+		t.Fatalf("Release() with the lock ID error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Lock file should be deleted")
+	}
+}
+
 func TestReleaseForce(t *testing.T) {
 	root := t.TempDir()
 
@@ -458,6 +484,28 @@ func TestReleaseBreakStale_CorruptedLock(t *testing.T) {
 	}
 }
 
+func TestReleaseBreakStale_InvalidSchema(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(locksDir, "stray.json")
+	if err := os.WriteFile(path, []byte(`{"version":1,"owner":"someone","pid":-5}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Release(root, "stray", ReleaseOptions{}); !errors.Is(err, lockfile.ErrInvalidSchema) {
+		t.Errorf("plain Release error = %v, want ErrInvalidSchema", err)
+	}
+	if err := Release(root, "stray", ReleaseOptions{BreakStale: true}); err != nil {
+		t.Fatalf("Release(BreakStale=true) error = %v, want nil for a file that isn't a lock", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("invalid lock file should be deleted after break-stale")
+	}
+}
+
 func TestReleaseForce_CorruptedLock(t *testing.T) {
 	root := t.TempDir()
 
@@ -731,3 +779,46 @@ func TestReleaseByOwner_SkipsNonJSONFiles(t *testing.T) {
 		t.Errorf("released = %v, want [real]", released)
 	}
 }
+
+// signWith turns lock file signing on with key for the rest of the test.
+func signWith(t *testing.T, key string) {
+	t.Helper()
+	if err := lockfile.SetKeys([][]byte{[]byte(key)}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = lockfile.SetKeys(nil) })
+}
+
+func TestRelease_Signing(t *testing.T) {
+	root := t.TempDir()
+	// Taken before signing was turned on
+	if err := Acquire(root, "unsigned", AcquireOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	signWith(t, "0123456789abcdef0123456789abcdef")
+	if err := Acquire(root, "forged", AcquireOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(root, "locks", "forged.json")
+	lf, _ := lockfile.Read(path)
+	lf.Owner = "mallory"
+	data, _ := json.Marshal(lf) // keeps the now wrong signature
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Release(root, "unsigned", ReleaseOptions{}); !errors.Is(err, lockfile.ErrUnsigned) {
+		t.Errorf("Release(unsigned) error = %v, want ErrUnsigned", err)
+	}
+	if err := Release(root, "forged", ReleaseOptions{BreakStale: true}); !errors.Is(err, lockfile.ErrBadSignature) {
+		t.Errorf("Release(forged) error = %v, want ErrBadSignature", err)
+	}
+	if err := Acquire(root, "forged", AcquireOptions{}); !errors.Is(err, lockfile.ErrBadSignature) {
+		t.Errorf("Acquire(forged) error = %v, want ErrBadSignature", err)
+	}
+	for _, name := range []string{"unsigned", "forged"} {
+		if err := Release(root, name, ReleaseOptions{Force: true}); err != nil {
+			t.Errorf("Release(%s, Force) error = %v", name, err)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package lock
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"time"
 
 	"github.com/nikolasavic/lokt/internal/audit"
@@ -13,32 +15,88 @@ import (
 // RenewOptions configures lock renewal.
 type RenewOptions struct {
 	Auditor *audit.Writer // Optional audit writer for event logging
+	Shared  bool          // renew this process's shared hold
+	TTL     time.Duration // if > 0, replaces the lock's TTL (ttl_sec and expires_at)
+	// MinRemaining, if set, skips the renewal (Renew returns nil without
+	// writing) while the lock has at least this long left, so an eager
+	// heartbeat doesn't rewrite the file every tick. A lock without a TTL,
+	// or one given a new TTL, is always renewed.
+	MinRemaining time.Duration
+
+	// AnyProcess accepts a lock held by the current owner from another
+	// process, as `lokt renew` after `lokt lock` needs. A lock held by
+	// another owner is then a *NotOwnerError rather than ErrLockStolen.
+	AnyProcess bool
+
+	// Force renews a lock file that is unsigned, or badly signed, while
+	// signing is on, which Renew otherwise refuses; the rewrite signs it.
+	// The owner is checked all the same.
+	Force bool
 }
 
 // ErrLockStolen is returned when the lock is now owned by someone else.
 var ErrLockStolen = fmt.Errorf("lock stolen")
 
-// Renew updates the lock's acquired timestamp to extend its TTL.
-// Returns an error if the lock doesn't exist or is owned by someone else.
+// Renew updates the lock's acquired timestamp to extend its TTL, and sets a
+// new TTL if opts.TTL is given. The renew event records how long the lock
+// had left (extra.remaining_ms). Returns an error wrapping ErrNotFound (and
+// fs.ErrNotExist) if the lock doesn't exist, and a *NotOwnerError if it is
+// held by someone else; without AnyProcess that error also wraps
+// ErrLockStolen, since this process held it. While signing is on, an
+// unsigned or badly signed lock file is an error wrapping
+// lockfile.ErrUnsigned or lockfile.ErrBadSignature unless opts.Force.
 func Renew(rootDir, name string, opts RenewOptions) error {
+	// Heartbeats hold the root path for the life of the guard; following a
+	// relocation here is what lets them keep renewing after lokt relocate.
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return err
+	}
+	if opts.Shared {
+		return renewShared(rootDir, name, opts)
+	}
+
 	path := root.LockFilePath(rootDir, name)
 
 	// Read current lock
 	existing, err := lockfile.Read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s has no lock file: %w", ErrNotFound, name, err)
+	}
+	if errors.Is(err, lockfile.ErrBadSignature) && opts.Force {
+		existing, err = lockfile.ReadWithOptions(path, lockfile.ReadOptions{NoVerify: true})
+	}
 	if err != nil {
 		return fmt.Errorf("read lock: %w", err)
 	}
+	if existing.Unsigned() && !opts.Force {
+		return fmt.Errorf("%w: lock %q (signing is on; --force renews and signs it)", lockfile.ErrUnsigned, name)
+	}
 
 	// Verify we still own it
 	id := identity.Current()
-	if existing.Owner != id.Owner || existing.Host != id.Host || existing.PID != id.PID {
-		return fmt.Errorf("%w: now owned by %s@%s (pid %d)",
-			ErrLockStolen, existing.Owner, existing.Host, existing.PID)
+	if opts.AnyProcess {
+		if !SameHolder(existing, id) {
+			return &NotOwnerError{Lock: existing, Current: id}
+		}
+	} else if existing.Owner != id.Owner || existing.Host != id.Host || existing.PID != id.PID {
+		dropFlock(path)
+		return fmt.Errorf("%w: now owned by %s@%s (pid %d): %w",
+			ErrLockStolen, existing.Owner, existing.Host, existing.PID, &NotOwnerError{Lock: existing, Current: id})
+	}
+	if !renewDue(existing, opts) {
+		return nil
 	}
 
 	// Update timestamp and version, then rewrite atomically
-	existing.Version = lockfile.CurrentLockfileVersion
+	remaining, timed := renewRemaining(existing)
+	existing.Version = lockfile.WriteVersion()
 	existing.AcquiredAt = time.Now()
+	existing.RenewedAt = &existing.AcquiredAt
+	if opts.TTL > 0 {
+		existing.TTLSec = int(opts.TTL.Seconds())
+	}
+	existing.ExpiresAt = nil
 	if existing.TTLSec > 0 {
 		exp := existing.AcquiredAt.Add(time.Duration(existing.TTLSec) * time.Second)
 		existing.ExpiresAt = &exp
@@ -46,18 +104,95 @@ func Renew(rootDir, name string, opts RenewOptions) error {
 	if err := lockfile.Write(path, existing); err != nil {
 		return fmt.Errorf("write lock: %w", err)
 	}
+	if existing.Flock {
+		refreshFlock(path, existing.LockID)
+	}
 
 	// Emit audit event on success
-	emitRenewEvent(opts.Auditor, id, name, existing.TTLSec, existing.LockID)
+	emitRenewEvent(opts.Auditor, id, name, existing.TTLSec, existing.LockID, remaining, timed)
+
+	return nil
+}
+
+// renewDue reports whether lk, about to be renewed with opts, needs it (see
+// RenewOptions.MinRemaining).
+func renewDue(lk *lockfile.Lock, opts RenewOptions) bool {
+	if opts.MinRemaining <= 0 || opts.TTL > 0 {
+		return true
+	}
+	if _, timed := lk.Expiry(); !timed {
+		return true
+	}
+	return lk.Remaining() < opts.MinRemaining
+}
+
+// renewRemaining returns how long lk has left before it is renewed, and
+// whether it has a TTL at all.
+func renewRemaining(lk *lockfile.Lock) (time.Duration, bool) {
+	_, timed := lk.Expiry()
+	return lk.Remaining(), timed
+}
+
+// Retain marks a lock held by this process as retained, so it survives the
+// process exiting (guard --no-release), and restarts its TTL. Like Renew it
+// returns ErrLockStolen if someone else holds the lock now. A retain event
+// records why the lock is still held.
+func Retain(rootDir, name string, opts RenewOptions) error {
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return err
+	}
+	path := root.LockFilePath(rootDir, name)
+	existing, err := lockfile.Read(path)
+	if err != nil {
+		return fmt.Errorf("read lock: %w", err)
+	}
+	id := identity.Current()
+	if existing.Owner != id.Owner || existing.Host != id.Host || existing.PID != id.PID {
+		return fmt.Errorf("%w: now owned by %s@%s (pid %d)",
+			ErrLockStolen, existing.Owner, existing.Host, existing.PID)
+	}
+
+	existing.Version = lockfile.WriteVersion()
+	existing.Retained = true
+	existing.Flock = false // the flock goes with this process
+	existing.AcquiredAt = time.Now()
+	existing.ExpiresAt = nil
+	if existing.TTLSec > 0 {
+		exp := existing.AcquiredAt.Add(time.Duration(existing.TTLSec) * time.Second)
+		existing.ExpiresAt = &exp
+	}
+	if err := lockfile.Write(path, existing); err != nil {
+		return fmt.Errorf("write lock: %w", err)
+	}
+	dropFlock(path)
 
+	if opts.Auditor != nil {
+		opts.Auditor.Emit(&audit.Event{
+			Event:   audit.EventRetain,
+			Name:    name,
+			LockID:  existing.LockID,
+			Owner:   id.Owner,
+			Host:    id.Host,
+			PID:     id.PID,
+			AgentID: id.AgentID,
+			TTLSec:  existing.TTLSec,
+		})
+	}
 	return nil
 }
 
 // emitRenewEvent emits a renew audit event. Safe to call with nil auditor.
-func emitRenewEvent(w *audit.Writer, id identity.Identity, name string, ttlSec int, lockID string) {
+// remaining, how long the lock had left, is recorded as extra.remaining_ms
+// if the lock was timed.
+func emitRenewEvent(w *audit.Writer, id identity.Identity, name string, ttlSec int, lockID string, remaining time.Duration, timed bool) {
 	if w == nil {
 		return
 	}
+	var extra map[string]any
+	if timed {
+		extra = map[string]any{"remaining_ms": remaining.Milliseconds()}
+	}
 	w.Emit(&audit.Event{
 		Event:   audit.EventRenew,
 		Name:    name,
@@ -67,5 +202,123 @@ func emitRenewEvent(w *audit.Writer, id identity.Identity, name string, ttlSec i
 		PID:     id.PID,
 		AgentID: id.AgentID,
 		TTLSec:  ttlSec,
+		Extra:   extra,
+	})
+}
+
+// ErrLockLost is returned by Verify when the lock file is gone.
+var ErrLockLost = errors.New("lock lost")
+
+// Verify checks that name is still held by this process and, if lockID is
+// set, by the same acquisition. Returns ErrLockStolen if someone else holds
+// it and ErrLockLost if no lock file exists.
+func Verify(rootDir, name, lockID string) error {
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return err
+	}
+	existing, err := lockfile.Read(root.LockFilePath(rootDir, name))
+	if errors.Is(err, fs.ErrNotExist) && lockID != "" {
+		// A shared hold lives in its own file
+		existing, err = lockfile.Read(root.SharedHolderPath(rootDir, name, lockID))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s has no lock file", ErrLockLost, name)
+	}
+	if err != nil {
+		return fmt.Errorf("read lock: %w", err)
+	}
+	id := identity.Current()
+	if existing.Owner != id.Owner || existing.Host != id.Host || existing.PID != id.PID ||
+		(lockID != "" && existing.LockID != lockID) {
+		return fmt.Errorf("%w: now held by %s@%s (pid %d, lock_id %s)",
+			ErrLockStolen, existing.Owner, existing.Host, existing.PID, existing.LockID)
+	}
+	return nil
+}
+
+// ReportLost records in a lock-lost event that a guard holding name (as
+// acquisition lockID) found it no longer held while its command ran. cause
+// says why; action is what the guard did about it ("warn" or "terminate").
+func ReportLost(name, lockID string, cause error, action string, opts RenewOptions) {
+	reportLost(audit.EventLockLost, name, lockID, map[string]any{"error": cause.Error(), "action": action}, opts)
+}
+
+// ReportLostAfterSuspend is ReportLost for a lock found lost when the guard
+// resumed after gap of wall-clock time without renewals (CheckAfterGap), as
+// a lock-lost-after-suspend event: the host slept or the guard was stopped
+// while someone else took the expired lock.
+func ReportLostAfterSuspend(name, lockID string, cause error, action string, gap time.Duration, opts RenewOptions) {
+	reportLost(audit.EventLostSuspend, name, lockID, map[string]any{
+		"error": cause.Error(), "action": action, "gap_sec": int(gap.Seconds()),
+	}, opts)
+}
+
+func reportLost(event, name, lockID string, extra map[string]any, opts RenewOptions) {
+	if opts.Auditor == nil {
+		return
+	}
+	id := identity.Current()
+	opts.Auditor.Emit(&audit.Event{
+		Event:   event,
+		Name:    name,
+		LockID:  lockID,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra:   extra,
 	})
 }
+
+// ReportVanished records in a lock-vanished event that a guard holding name
+// (as acquisition lockID) found its lock file gone or replaced by another
+// acquisition when it checked, typically because the command deleted the
+// lock root (git clean -xfd). cause is Verify's error. If the root is gone
+// the event only reaches the writer's hooks (webhooks, the event hook).
+func ReportVanished(name, lockID string, cause error, opts RenewOptions) {
+	if opts.Auditor == nil {
+		return
+	}
+	id := identity.Current()
+	opts.Auditor.Emit(&audit.Event{
+		Event:   audit.EventLockVanished,
+		Name:    name,
+		LockID:  lockID,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra:   map[string]any{"error": cause.Error()},
+	})
+}
+
+// CheckAfterGap is called by a heartbeat that noticed gap of wall-clock time
+// since its last successful renewal, longer than the TTL allows (typically a
+// suspended host). The lock may have expired and been taken over meanwhile,
+// so ownership is re-verified before any renewal, and a clock-gap-detected
+// event records the gap and the outcome. Returns Verify's error.
+func CheckAfterGap(rootDir, name, lockID string, gap time.Duration, opts RenewOptions) error {
+	err := Verify(rootDir, name, lockID)
+	if opts.Auditor != nil {
+		id := identity.Current()
+		extra := map[string]any{
+			"gap_sec": int(gap.Seconds()),
+			"held":    err == nil,
+		}
+		if err != nil {
+			extra["error"] = err.Error()
+		}
+		opts.Auditor.Emit(&audit.Event{
+			Event:   audit.EventClockGap,
+			Name:    name,
+			LockID:  lockID,
+			Owner:   id.Owner,
+			Host:    id.Host,
+			PID:     id.PID,
+			AgentID: id.AgentID,
+			Extra:   extra,
+		})
+	}
+	return err
+}
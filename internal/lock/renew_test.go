@@ -62,6 +62,9 @@ func TestRenew_Success(t *testing.T) {
 	if updated.TTLSec != initial.TTLSec {
 		t.Errorf("TTLSec changed: %d -> %d", initial.TTLSec, updated.TTLSec)
 	}
+	if initial.RenewedAt != nil || updated.RenewedAt == nil || !updated.RenewedAt.Equal(updated.AcquiredAt) {
+		t.Errorf("RenewedAt: initial %v, updated %v; want unset, then the renewal", initial.RenewedAt, updated.RenewedAt)
+	}
 }
 
 func TestRenew_NotFound(t *testing.T) {
@@ -114,6 +117,10 @@ func TestRenew_NotOwner(t *testing.T) {
 	if !errors.Is(err, ErrLockStolen) {
 		t.Errorf("Renew() error = %v, want ErrLockStolen", err)
 	}
+	var notOwner *NotOwnerError
+	if !errors.As(err, &notOwner) || notOwner.Lock.Owner != "someone-else" {
+		t.Errorf("Renew() error = %v, want a NotOwnerError naming the holder", err)
+	}
 }
 
 func TestRenew_DifferentHost(t *testing.T) {
@@ -227,6 +234,164 @@ func TestRenew_NilAuditorDoesNotPanic(t *testing.T) {
 	}
 }
 
+func TestRenew_AnyProcessNewTTL(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("LOKT_OWNER", "me")
+	hostname, _ := os.Hostname()
+	lf := &lockfile.Lock{
+		Version: 1, Name: "long", Owner: "me", Host: hostname, PID: 999999,
+		AcquiredAt: time.Now().Add(-time.Minute), TTLSec: 120,
+	}
+	if err := os.MkdirAll(filepath.Join(root, "locks"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(filepath.Join(root, "locks", "long.json"), lf); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Renew(root, "long", RenewOptions{}); !errors.Is(err, ErrLockStolen) {
+		t.Fatalf("Renew() from another process = %v, want ErrLockStolen", err)
+	}
+	if err := Renew(root, "long", RenewOptions{AnyProcess: true, TTL: 10 * time.Minute}); err != nil {
+		t.Fatalf("Renew(AnyProcess) error = %v", err)
+	}
+	got, err := lockfile.Read(filepath.Join(root, "locks", "long.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TTLSec != 600 || got.PID != 999999 || got.ExpiresAt == nil || time.Until(*got.ExpiresAt) < 9*time.Minute {
+		t.Errorf("renewed lock = %+v, want TTL 600s from now, holder unchanged", got)
+	}
+
+	t.Setenv("LOKT_OWNER", "someone-else")
+	var notOwner *NotOwnerError
+	if err := Renew(root, "long", RenewOptions{AnyProcess: true}); !errors.As(err, &notOwner) {
+		t.Errorf("Renew(AnyProcess) by another owner = %v, want NotOwnerError", err)
+	}
+}
+
+func TestRenew_NotFoundIsTyped(t *testing.T) {
+	err := Renew(t.TempDir(), "gone", RenewOptions{})
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Renew() of a missing lock = %v, want ErrNotFound wrapping fs.ErrNotExist", err)
+	}
+}
+
+func TestRenew_MinRemaining(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+	if err := Acquire(root, "hb", AcquireOptions{TTL: 10 * time.Minute}); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	path := filepath.Join(root, "locks", "hb.json")
+	before, _ := lockfile.Read(path)
+
+	// Nearly all of the TTL is left: nothing is written.
+	if err := Renew(root, "hb", RenewOptions{Auditor: auditor, MinRemaining: 5 * time.Minute}); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if after, _ := lockfile.Read(path); !after.AcquiredAt.Equal(before.AcquiredAt) {
+		t.Error("Renew() rewrote a lock with more than MinRemaining left")
+	}
+	if events := readRenewAuditEvents(t, root); len(events) != 0 {
+		t.Errorf("skipped renewal logged %d events", len(events))
+	}
+
+	// Less than MinRemaining left: renewed, with how long was left.
+	time.Sleep(10 * time.Millisecond)
+	if err := Renew(root, "hb", RenewOptions{Auditor: auditor, MinRemaining: 11 * time.Minute}); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if after, _ := lockfile.Read(path); !after.AcquiredAt.After(before.AcquiredAt) {
+		t.Error("Renew() didn't rewrite a lock with less than MinRemaining left")
+	}
+	events := readRenewAuditEvents(t, root)
+	if len(events) != 1 {
+		t.Fatalf("got %d renew events, want 1", len(events))
+	}
+	ms, ok := events[0].Extra["remaining_ms"].(float64)
+	if !ok || ms <= 9*60*1000 || ms > 10*60*1000 {
+		t.Errorf("remaining_ms = %v, want just under 10 minutes", events[0].Extra["remaining_ms"])
+	}
+
+	// A new TTL is applied whatever is left.
+	if err := Renew(root, "hb", RenewOptions{TTL: time.Hour, MinRemaining: time.Minute}); err != nil {
+		t.Fatalf("Renew() error = %v", err)
+	}
+	if after, _ := lockfile.Read(path); after.TTLSec != 3600 {
+		t.Errorf("TTLSec = %d after Renew(TTL: 1h), want 3600", after.TTLSec)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	root := t.TempDir()
+	if err := Acquire(root, "verify", AcquireOptions{TTL: 5 * time.Minute}); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	path := filepath.Join(root, "locks", "verify.json")
+	held, err := lockfile.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(root, "verify", held.LockID); err != nil {
+		t.Errorf("Verify(own lock) = %v, want nil", err)
+	}
+	if err := Verify(root, "verify", ""); err != nil {
+		t.Errorf("Verify(no lock_id) = %v, want nil", err)
+	}
+	if err := Verify(root, "verify", "someone-elses-id"); !errors.Is(err, ErrLockStolen) {
+		t.Errorf("Verify(other lock_id) = %v, want ErrLockStolen", err)
+	}
+
+	// Taken over by another host after expiry.
+	held.Host = "other-host"
+	if err := lockfile.Write(path, held); err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(root, "verify", held.LockID); !errors.Is(err, ErrLockStolen) {
+		t.Errorf("Verify(other host) = %v, want ErrLockStolen", err)
+	}
+
+	_ = os.Remove(path)
+	if err := Verify(root, "verify", held.LockID); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Verify(gone) = %v, want ErrLockLost", err)
+	}
+}
+
+func TestCheckAfterGap_AuditEvent(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+	if err := Acquire(root, "gap", AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	if err := CheckAfterGap(root, "gap", "", 40*time.Minute, RenewOptions{Auditor: auditor}); err != nil {
+		t.Errorf("CheckAfterGap(still held) = %v, want nil", err)
+	}
+	_ = os.Remove(filepath.Join(root, "locks", "gap.json"))
+	if err := CheckAfterGap(root, "gap", "", 40*time.Minute, RenewOptions{Auditor: auditor}); !errors.Is(err, ErrLockLost) {
+		t.Errorf("CheckAfterGap(gone) = %v, want ErrLockLost", err)
+	}
+
+	events := readRenewAuditEvents(t, root)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 audit events, got %d", len(events))
+	}
+	for i, wantHeld := range []bool{true, false} {
+		e := events[i]
+		if e.Event != audit.EventClockGap {
+			t.Errorf("event %d = %q, want %q", i, e.Event, audit.EventClockGap)
+		}
+		if gap, _ := e.Extra["gap_sec"].(float64); gap != 2400 {
+			t.Errorf("event %d gap_sec = %v, want 2400", i, e.Extra["gap_sec"])
+		}
+		if held, _ := e.Extra["held"].(bool); held != wantHeld {
+			t.Errorf("event %d held = %v, want %v", i, e.Extra["held"], wantHeld)
+		}
+	}
+}
+
 // readRenewAuditEvents reads all events from the audit log file.
 func readRenewAuditEvents(t *testing.T, rootDir string) []audit.Event {
 	t.Helper()
@@ -265,3 +430,70 @@ func containsStringImpl(s, substr string) bool {
 	}
 	return false
 }
+
+func TestRetain(t *testing.T) {
+	t.Setenv("LOKT_OWNER", "me")
+	rootDir := setupSweepRoot(t)
+	auditor := audit.NewWriter(rootDir)
+	if err := Acquire(rootDir, "deploy", AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Retain(rootDir, "deploy", RenewOptions{Auditor: auditor}); err != nil {
+		t.Fatalf("Retain() error = %v", err)
+	}
+	path := filepath.Join(rootDir, "locks", "deploy.json")
+	lf, err := lockfile.Read(path)
+	if err != nil || !lf.Retained || lf.ExpiresAt == nil {
+		t.Fatalf("retained lock = %+v, %v", lf, err)
+	}
+	events := readAuditEvents(t, rootDir)
+	if len(events) != 1 || events[0].Event != audit.EventRetain || events[0].TTLSec != 60 {
+		t.Errorf("events = %+v, want one retain event", events)
+	}
+
+	// The holder exiting doesn't make a retained lock reclaimable.
+	hostname, _ := os.Hostname()
+	lf.Host, lf.PID = hostname, 999999
+	writeLock(t, filepath.Join(rootDir, "locks"), "deploy", lf)
+	t.Setenv("LOKT_OWNER", "other")
+	var held *HeldError
+	if err := Acquire(rootDir, "deploy", AcquireOptions{}); !errors.As(err, &held) {
+		t.Errorf("Acquire(retained, dead holder) error = %v, want HeldError", err)
+	}
+
+	// Its owner takes it over, and the new lock is an ordinary one.
+	t.Setenv("LOKT_OWNER", "me")
+	if err := Acquire(rootDir, "deploy", AcquireOptions{}); err != nil {
+		t.Fatalf("Acquire(owner) error = %v", err)
+	}
+	if lf, _ := lockfile.Read(path); lf == nil || lf.Retained || lf.PID != os.Getpid() {
+		t.Errorf("re-acquired lock = %+v, want this process, not retained", lf)
+	}
+
+	t.Setenv("LOKT_OWNER", "other")
+	if err := Retain(rootDir, "deploy", RenewOptions{}); !errors.Is(err, ErrLockStolen) {
+		t.Errorf("Retain(other's) error = %v, want ErrLockStolen", err)
+	}
+}
+
+func TestRenew_Signing(t *testing.T) {
+	root := t.TempDir()
+	if err := Acquire(root, "build", AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	signWith(t, "0123456789abcdef0123456789abcdef")
+
+	if err := Renew(root, "build", RenewOptions{}); !errors.Is(err, lockfile.ErrUnsigned) {
+		t.Fatalf("Renew(unsigned) error = %v, want ErrUnsigned", err)
+	}
+	if err := Renew(root, "build", RenewOptions{Force: true}); err != nil {
+		t.Fatalf("Renew(Force) error = %v", err)
+	}
+	lf, err := lockfile.Read(filepath.Join(root, "locks", "build.json"))
+	if err != nil || lf.Unsigned() {
+		t.Errorf("after Renew(Force): %+v, %v; want it signed", lf, err)
+	}
+	if err := Renew(root, "build", RenewOptions{}); err != nil {
+		t.Errorf("Renew(signed) error = %v", err)
+	}
+}
@@ -0,0 +1,487 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// Reservations: a window set up ahead of time in which only one owner may
+// acquire a name ("deploy is mine from 14:00 to 15:00"). Each is a file
+// <root>/reservations/<name>/<id>.json. Acquire refuses anyone else whose
+// hold would overlap an active reservation, from now until now+TTL or
+// open-ended without a TTL, with a *ReservedError. A reservation doesn't
+// evict a holder already there, and a freeze wins over it: its owner is as
+// frozen as everyone else. Clocks are allowed to disagree by the skew grace
+// (AcquireOptions.SkewGrace), by which every window is widened on both ends
+// for others, and which a reservation outlives its end by before it is
+// pruned.
+
+// ErrReserved is returned when a name is reserved for another owner.
+var ErrReserved = errors.New("lock reserved")
+
+// Reservation is a reservation file.
+type Reservation struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`      // the one owner who may acquire the name in the window
+	CreatedBy string    `json:"created_by"` // who made it; Owner's, unless reserve --owner
+	Host      string    `json:"host"`
+	From      time.Time `json:"from"`
+	Until     time.Time `json:"until"`
+	CreatedAt time.Time `json:"created_ts"`
+	Reason    string    `json:"reason,omitempty"`
+
+	path string // the file it was read from
+}
+
+// overlaps reports whether a hold from start to end (zero: open-ended)
+// falls in r's window widened by grace.
+func (r *Reservation) overlaps(start, end time.Time, grace time.Duration) bool {
+	return start.Before(r.Until.Add(grace)) && (end.IsZero() || end.After(r.From.Add(-grace)))
+}
+
+// ended reports whether r's window, plus grace, is over at now.
+func (r *Reservation) ended(now time.Time, grace time.Duration) bool {
+	return !now.Before(r.Until.Add(grace))
+}
+
+// mayCancel reports whether owner may cancel r without force.
+func (r *Reservation) mayCancel(owner string) bool {
+	return owner == r.Owner || owner == r.CreatedBy
+}
+
+// ReservedError reports a reservation of a name for another owner. It
+// unwraps to ErrReserved and to a *HeldError for the reservation's owner,
+// lasting until the window ends, so callers treating it as a held lock
+// report and exit as they would for one; AcquireWithWait doesn't wait it
+// out, though.
+type ReservedError struct {
+	Name        string
+	Reservation *Reservation
+	held        *HeldError
+}
+
+func newReservedError(name string, r *Reservation, grace time.Duration) *ReservedError {
+	until := r.Until
+	holder := &lockfile.Lock{
+		Name:       name,
+		LockID:     r.ID,
+		Owner:      r.Owner,
+		Host:       r.Host,
+		AcquiredAt: r.CreatedAt,
+		ExpiresAt:  &until,
+		Message:    r.Reason,
+	}
+	retry := max(time.Until(r.Until.Add(grace)), MinRetryAfter)
+	return &ReservedError{Name: name, Reservation: r, held: &HeldError{Lock: holder, RetryAfter: retry}}
+}
+
+func (e *ReservedError) Error() string {
+	r := e.Reservation
+	now := time.Now()
+	var window string
+	if r.From.After(now) {
+		window = fmt.Sprintf("from %s to %s (starts in %s)",
+			FormatFreezeEnd(r.From, now), FormatFreezeEnd(r.Until, now), time.Until(r.From).Truncate(time.Second))
+	} else {
+		window = fmt.Sprintf("until %s (%s left)", FormatFreezeEnd(r.Until, now), max(time.Until(r.Until), 0).Truncate(time.Second))
+	}
+	msg := fmt.Sprintf("lock %q reserved for %s %s", e.Name, r.Owner, window)
+	if r.Reason != "" {
+		msg += ": " + r.Reason
+	}
+	return msg
+}
+
+func (e *ReservedError) Unwrap() []error {
+	return []error{ErrReserved, e.held}
+}
+
+// waitable reports whether err is a denial a wait can outlast, as a
+// *HeldError it sets held to: a reservation isn't one, since it lasts
+// its whole window whoever holds the lock meanwhile.
+func waitable(err error, held **HeldError) bool {
+	return !errors.Is(err, ErrReserved) && errors.As(err, held)
+}
+
+// reservationOwnerError reports a reservation Unreserve may not cancel
+// without force. It unwraps to ErrNotOwner.
+type reservationOwnerError struct {
+	Reservation *Reservation
+	Current     string
+}
+
+func (e *reservationOwnerError) Error() string {
+	return fmt.Sprintf("reservation %s of %q is %s's, not %s's (--force cancels it)",
+		e.Reservation.ID, e.Reservation.Name, e.Reservation.Owner, e.Current)
+}
+
+func (e *reservationOwnerError) Unwrap() error {
+	return ErrNotOwner
+}
+
+// ReserveOptions configures Reserve.
+type ReserveOptions struct {
+	// From and Until are the window; a zero From starts it now. Until must
+	// be in the future and after From.
+	From, Until time.Time
+	// Owner is who the name is reserved for; empty means the caller.
+	Owner string
+	// Reason says what the window is for, cleaned by
+	// lockfile.CleanMessage and shown in ReservedError.
+	Reason string
+	// SkewGrace is the clock skew tolerance (see above).
+	SkewGrace time.Duration
+	Auditor   *audit.Writer
+}
+
+// Reserve reserves name for opts.Owner in the window opts.From to
+// opts.Until and returns the reservation. It fails with a *ReservedError if
+// the window overlaps another owner's reservation; the same owner's
+// reservations may overlap.
+func Reserve(rootDir, name string, opts ReserveOptions) (*Reservation, error) {
+	if err := lockfile.ValidateName(name); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if opts.From.IsZero() {
+		opts.From = now
+	}
+	switch {
+	case !opts.Until.After(opts.From):
+		return nil, errors.New("reservation must end after it starts")
+	case !opts.Until.After(now):
+		return nil, fmt.Errorf("reservation end %s is in the past", opts.Until.UTC().Format(time.RFC3339))
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := root.EnsureDirs(rootDir); err != nil {
+		return nil, ensureDirsError(rootDir, err)
+	}
+
+	id := identity.Current()
+	r := &Reservation{
+		ID:        lockfile.GenerateLockID()[:16],
+		Name:      name,
+		Owner:     opts.Owner,
+		CreatedBy: id.Owner,
+		Host:      id.Host,
+		From:      opts.From.UTC(),
+		Until:     opts.Until.UTC(),
+		CreatedAt: now.UTC(),
+		Reason:    lockfile.CleanMessage(opts.Reason),
+	}
+	if r.Owner == "" {
+		r.Owner = id.Owner
+	}
+	if c := reservationConflict(rootDir, r, opts.SkewGrace, nil); c != nil {
+		return nil, newReservedError(name, c, opts.SkewGrace)
+	}
+
+	path := root.ReservationFilePath(rootDir, name, r.ID)
+	if err := root.MkdirAll(rootDir, filepath.Dir(path)); err != nil {
+		return nil, ensureDirsError(rootDir, err)
+	}
+	data, _ := json.MarshalIndent(r, "", "  ")
+	if err := lockfile.WriteFileAtomic(path, append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("write reservation: %w", err)
+	}
+
+	// Second phase, as for exclusion groups: of two overlapping
+	// reservations made at once, the earlier one stays.
+	if c := reservationConflict(rootDir, r, opts.SkewGrace, r); c != nil {
+		_ = os.Remove(path)
+		_ = lockfile.SyncDir(path)
+		return nil, newReservedError(name, c, opts.SkewGrace)
+	}
+	emitReserveEvent(opts.Auditor, audit.EventReserve, id, r)
+	return r, nil
+}
+
+// reservationConflict returns a reservation of r's name for another owner
+// whose window overlaps r's, or nil. With self set, only those made before
+// self (by creation time, then ID) count.
+func reservationConflict(rootDir string, r *Reservation, grace time.Duration, self *Reservation) *Reservation {
+	for _, o := range readReservations(root.ReservationDirPath(rootDir, r.Name)) {
+		if o.ID == r.ID || o.Owner == r.Owner || o.ended(time.Now(), grace) || !o.overlaps(r.From, r.Until, 0) {
+			continue
+		}
+		if self != nil && (o.CreatedAt.After(self.CreatedAt) || o.CreatedAt.Equal(self.CreatedAt) && o.ID > self.ID) {
+			continue
+		}
+		return o
+	}
+	return nil
+}
+
+// checkReservations is Acquire's reservation check: a *ReservedError if a
+// hold of name by id for ttl (zero: open-ended) overlaps another owner's
+// reservation. Ended reservations of name are pruned.
+func checkReservations(rootDir, name string, id identity.Identity, ttl, grace time.Duration, auditor *audit.Writer) error {
+	all := readReservations(root.ReservationDirPath(rootDir, name))
+	if len(all) == 0 {
+		return nil
+	}
+	now := time.Now()
+	var end time.Time
+	if ttl > 0 {
+		end = now.Add(ttl)
+	}
+	var blocking *Reservation
+	for _, r := range all {
+		if r.ended(now, grace) {
+			_ = os.Remove(r.path)
+			continue
+		}
+		if r.Owner != id.Owner && r.overlaps(now, end, grace) && (blocking == nil || r.From.Before(blocking.From)) {
+			blocking = r
+		}
+	}
+	if blocking == nil {
+		return nil
+	}
+	err := newReservedError(name, blocking, grace)
+	emitReserveDenyEvent(auditor, id, name, int(ttl.Seconds()), err)
+	return err
+}
+
+// reservedNow is Check's reservation check: read-only, and for a hold
+// starting now, whatever its length.
+func reservedNow(rootDir, name string, id identity.Identity, grace time.Duration) error {
+	now := time.Now()
+	for _, r := range readReservations(root.ReservationDirPath(rootDir, name)) {
+		if r.Owner != id.Owner && r.overlaps(now, now, grace) {
+			return newReservedError(name, r, grace)
+		}
+	}
+	return nil
+}
+
+// readReservations reads the reservation files in dir, sorted by start.
+// Unreadable files are left out.
+func readReservations(dir string) []*Reservation {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var out []*Reservation
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		if r, err := readReservation(filepath.Join(dir, e.Name())); err == nil {
+			out = append(out, r)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b *Reservation) int { return a.From.Compare(b.From) })
+	return out
+}
+
+// readReservation reads one reservation file.
+func readReservation(path string) (*Reservation, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path is controlled
+	if err != nil {
+		return nil, err
+	}
+	var r Reservation
+	if err := json.Unmarshal(data, &r); err != nil || r.ID == "" || r.Until.IsZero() {
+		return nil, fmt.Errorf("read %s: not a reservation", path)
+	}
+	r.path = path
+	return &r, nil
+}
+
+// Reservations lists the reservations of name, or of every name if name is
+// empty, that haven't ended (allowing grace), sorted by name, then start.
+// Read-only.
+func Reservations(rootDir, name string, grace time.Duration) ([]*Reservation, error) {
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	if name != "" {
+		if err := lockfile.ValidateName(name); err != nil {
+			return nil, err
+		}
+		dirs = []string{root.ReservationDirPath(rootDir, name)}
+	} else {
+		base := filepath.Join(rootDir, root.ReservationsDir)
+		names, err := root.NameDirs(base)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		for _, n := range names {
+			dirs = append(dirs, filepath.Join(base, filepath.FromSlash(n)))
+		}
+	}
+	now := time.Now()
+	var out []*Reservation
+	for _, dir := range dirs {
+		for _, r := range readReservations(dir) {
+			if !r.ended(now, grace) {
+				out = append(out, r)
+			}
+		}
+	}
+	slices.SortStableFunc(out, func(a, b *Reservation) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return a.From.Compare(b.From)
+	})
+	return out, nil
+}
+
+// PruneReservations removes every reservation that ended (allowing grace)
+// and returns how many it removed.
+func PruneReservations(rootDir string, grace time.Duration) (int, []error) {
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return 0, []error{err}
+	}
+	base := filepath.Join(rootDir, root.ReservationsDir)
+	names, err := root.NameDirs(base)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, []error{err}
+	}
+	now := time.Now()
+	var n int
+	var errs []error
+	for _, name := range names {
+		for _, r := range readReservations(filepath.Join(base, filepath.FromSlash(name))) {
+			if !r.ended(now, grace) {
+				continue
+			}
+			if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+				continue
+			}
+			n++
+		}
+	}
+	return n, errs
+}
+
+// UnreserveOptions configures Unreserve.
+type UnreserveOptions struct {
+	// ID cancels that reservation only; empty cancels every reservation of
+	// the name the caller may cancel (all of them, with Force).
+	ID string
+	// Force cancels reservations of other owners too.
+	Force   bool
+	Auditor *audit.Writer
+}
+
+// Unreserve cancels reservations of name, ended ones included, and returns
+// them. A reservation can be cancelled by its owner or whoever made it, or
+// by anyone with opts.Force; others' are an error wrapping ErrNotOwner. It
+// returns ErrNotFound if there is nothing to cancel.
+func Unreserve(rootDir, name string, opts UnreserveOptions) ([]*Reservation, error) {
+	if err := lockfile.ValidateName(name); err != nil {
+		return nil, err
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	id := identity.Current()
+	var cancelled []*Reservation
+	var denied *Reservation
+	for _, r := range readReservations(root.ReservationDirPath(rootDir, name)) {
+		if opts.ID != "" && r.ID != opts.ID {
+			continue
+		}
+		if !opts.Force && !r.mayCancel(id.Owner) {
+			denied = r
+			continue
+		}
+		if err := os.Remove(r.path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return cancelled, fmt.Errorf("remove reservation: %w", err)
+		}
+		_ = lockfile.SyncDir(r.path)
+		event := audit.EventUnreserve
+		if !r.mayCancel(id.Owner) {
+			event = audit.EventForceUnreserve
+		}
+		emitReserveEvent(opts.Auditor, event, id, r)
+		cancelled = append(cancelled, r)
+	}
+	if len(cancelled) == 0 && denied != nil {
+		return nil, &reservationOwnerError{Reservation: denied, Current: id.Owner}
+	}
+	if len(cancelled) == 0 {
+		return nil, ErrNotFound
+	}
+	return cancelled, nil
+}
+
+// emitReserveEvent records the reservation r being made or cancelled.
+// Safe to call with nil auditor.
+func emitReserveEvent(w *audit.Writer, event string, id identity.Identity, r *Reservation) {
+	if w == nil {
+		return
+	}
+	extra := map[string]any{
+		"reservation_id": r.ID,
+		"reserved_for":   r.Owner,
+		"from":           r.From.UTC().Format(time.RFC3339),
+		"until":          r.Until.UTC().Format(time.RFC3339),
+	}
+	if r.Reason != "" {
+		extra["reason"] = r.Reason
+	}
+	w.Emit(&audit.Event{
+		Event:   event,
+		Name:    r.Name,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		Extra:   extra,
+	})
+}
+
+// emitReserveDenyEvent records an acquisition refused by a reservation.
+// Safe to call with nil auditor.
+func emitReserveDenyEvent(w *audit.Writer, id identity.Identity, name string, ttlSec int, e *ReservedError) {
+	if w == nil {
+		return
+	}
+	w.Emit(&audit.Event{
+		Event:   audit.EventReserveDeny,
+		Name:    name,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		TTLSec:  ttlSec,
+		Extra: map[string]any{
+			"reservation_id":  e.Reservation.ID,
+			"reserved_for":    e.Reservation.Owner,
+			"from":            e.Reservation.From.UTC().Format(time.RFC3339),
+			"until":           e.Reservation.Until.UTC().Format(time.RFC3339),
+			"retry_after_sec": int(e.held.RetryAfter.Seconds()),
+		},
+	})
+}
@@ -0,0 +1,254 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// reserveFor reserves name for owner from now+from to now+until.
+func reserveFor(t *testing.T, root, name, owner string, from, until time.Duration) *Reservation {
+	t.Helper()
+	now := time.Now()
+	r, err := Reserve(root, name, ReserveOptions{Owner: owner, From: now.Add(from), Until: now.Add(until), Reason: "release"})
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	return r
+}
+
+func TestReserve_RefusesOtherOwner(t *testing.T) {
+	root := t.TempDir()
+	r := reserveFor(t, root, "deploy", "alice", 0, time.Hour)
+	if _, err := os.Stat(filepath.Join(root, "reservations", "deploy", r.ID+".json")); err != nil {
+		t.Fatalf("reservation file: %v", err)
+	}
+
+	t.Setenv("LOKT_OWNER", "bob")
+	err := Acquire(root, "deploy", AcquireOptions{TTL: time.Minute})
+	var reserved *ReservedError
+	if !errors.As(err, &reserved) {
+		t.Fatalf("Acquire() error = %v, want *ReservedError", err)
+	}
+	if reserved.Reservation.Owner != "alice" {
+		t.Errorf("Reservation.Owner = %q, want alice", reserved.Reservation.Owner)
+	}
+	if !strings.Contains(err.Error(), "reserved for alice") || !strings.HasSuffix(err.Error(), ": release") {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	// Callers treating it as a held lock see the reservation's owner.
+	var held *HeldError
+	if !errors.As(err, &held) || held.Lock.Owner != "alice" {
+		t.Errorf("errors.As(*HeldError) = %v", held)
+	}
+	if _, err := lockfile.Read(filepath.Join(root, "locks", "deploy.json")); err == nil {
+		t.Error("lock file written despite the reservation")
+	}
+
+	t.Setenv("LOKT_OWNER", "alice")
+	if err := Acquire(root, "deploy", AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Errorf("Acquire() by the owner error = %v", err)
+	}
+}
+
+func TestReserve_OverlapOfHold(t *testing.T) {
+	root := t.TempDir()
+	reserveFor(t, root, "deploy", "alice", time.Hour, 2*time.Hour)
+	t.Setenv("LOKT_OWNER", "bob")
+
+	// A hold that ends before the window starts is allowed.
+	if err := Acquire(root, "deploy", AcquireOptions{TTL: 10 * time.Minute}); err != nil {
+		t.Fatalf("Acquire() ending before the window error = %v", err)
+	}
+	if err := Release(root, "deploy", ReleaseOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// One that would run into it isn't, nor is one without a TTL.
+	if err := Acquire(root, "deploy", AcquireOptions{TTL: 90 * time.Minute}); !errors.Is(err, ErrReserved) {
+		t.Errorf("Acquire() into the window error = %v, want ErrReserved", err)
+	}
+	if err := Acquire(root, "deploy", AcquireOptions{}); !errors.Is(err, ErrReserved) {
+		t.Errorf("Acquire() open-ended error = %v, want ErrReserved", err)
+	}
+	// Other names aren't affected.
+	if err := Acquire(root, "build", AcquireOptions{}); err != nil {
+		t.Errorf("Acquire(build) error = %v", err)
+	}
+}
+
+func TestReserve_SkewGrace(t *testing.T) {
+	root := t.TempDir()
+	reserveFor(t, root, "deploy", "alice", 10*time.Minute, time.Hour)
+	t.Setenv("LOKT_OWNER", "bob")
+
+	// Ends 2m before the window: fine without grace, too close with 5m.
+	opts := AcquireOptions{TTL: 8 * time.Minute, SkewGrace: 5 * time.Minute}
+	if err := Acquire(root, "deploy", opts); !errors.Is(err, ErrReserved) {
+		t.Errorf("Acquire() within the grace error = %v, want ErrReserved", err)
+	}
+	opts.SkewGrace = 0
+	if err := Acquire(root, "deploy", opts); err != nil {
+		t.Errorf("Acquire() without grace error = %v", err)
+	}
+}
+
+func TestReserve_WaitDoesNotWait(t *testing.T) {
+	root := t.TempDir()
+	reserveFor(t, root, "deploy", "alice", 0, time.Hour)
+	t.Setenv("LOKT_OWNER", "bob")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	err := AcquireWithWait(ctx, root, "deploy", AcquireOptions{})
+	if !errors.Is(err, ErrReserved) {
+		t.Fatalf("AcquireWithWait() error = %v, want ErrReserved", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("AcquireWithWait() waited %v for a reservation", time.Since(start))
+	}
+}
+
+func TestReserve_FreezeWins(t *testing.T) {
+	root := t.TempDir()
+	reserveFor(t, root, "deploy", "alice", 0, time.Hour)
+	if err := Freeze(root, "deploy", FreezeOptions{TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("LOKT_OWNER", "alice")
+	err := Acquire(root, "deploy", AcquireOptions{RespectFreeze: true})
+	if !errors.Is(err, ErrFrozen) {
+		t.Errorf("Acquire() by the owner error = %v, want ErrFrozen", err)
+	}
+	if err := Check(root, "deploy", 0, nil); !errors.Is(err, ErrFrozen) {
+		t.Errorf("Check() error = %v, want ErrFrozen", err)
+	}
+}
+
+func TestReserve_Check(t *testing.T) {
+	root := t.TempDir()
+	reserveFor(t, root, "deploy", "alice", 0, time.Hour)
+
+	t.Setenv("LOKT_OWNER", "bob")
+	if err := Check(root, "deploy", 0, nil); !errors.Is(err, ErrReserved) {
+		t.Errorf("Check() by another owner error = %v, want ErrReserved", err)
+	}
+	t.Setenv("LOKT_OWNER", "alice")
+	if err := Check(root, "deploy", 0, nil); err != nil {
+		t.Errorf("Check() by the owner error = %v", err)
+	}
+}
+
+func TestReserve_Overlapping(t *testing.T) {
+	root := t.TempDir()
+	reserveFor(t, root, "deploy", "alice", time.Hour, 2*time.Hour)
+	now := time.Now()
+
+	_, err := Reserve(root, "deploy", ReserveOptions{Owner: "bob", From: now.Add(90 * time.Minute), Until: now.Add(3 * time.Hour)})
+	if !errors.Is(err, ErrReserved) {
+		t.Errorf("Reserve() overlapping error = %v, want ErrReserved", err)
+	}
+	// Adjacent windows and the same owner's overlapping ones are fine.
+	if _, err := Reserve(root, "deploy", ReserveOptions{Owner: "bob", From: now.Add(2 * time.Hour), Until: now.Add(3 * time.Hour)}); err != nil {
+		t.Errorf("Reserve() adjacent error = %v", err)
+	}
+	if _, err := Reserve(root, "deploy", ReserveOptions{Owner: "alice", From: now.Add(30 * time.Minute), Until: now.Add(90 * time.Minute)}); err != nil {
+		t.Errorf("Reserve() same owner error = %v", err)
+	}
+	list, err := Reservations(root, "deploy", 0)
+	if err != nil || len(list) != 3 {
+		t.Fatalf("Reservations() = %d, %v; want 3", len(list), err)
+	}
+	if !list[0].From.Before(list[1].From) {
+		t.Error("Reservations() not sorted by From")
+	}
+}
+
+func TestReserve_InvalidWindow(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	if _, err := Reserve(root, "deploy", ReserveOptions{From: now.Add(time.Hour), Until: now.Add(time.Minute)}); err == nil {
+		t.Error("Reserve() ending before it starts should fail")
+	}
+	if _, err := Reserve(root, "deploy", ReserveOptions{Until: now.Add(-time.Minute)}); err == nil {
+		t.Error("Reserve() ending in the past should fail")
+	}
+}
+
+func TestUnreserve(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+	r := reserveFor(t, root, "deploy", "alice", 0, time.Hour)
+
+	t.Setenv("LOKT_OWNER", "bob")
+	_, err := Unreserve(root, "deploy", UnreserveOptions{Auditor: auditor})
+	if !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("Unreserve() by another owner error = %v, want ErrNotOwner", err)
+	}
+	if _, err := Unreserve(root, "build", UnreserveOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Unreserve(build) error = %v, want ErrNotFound", err)
+	}
+
+	cancelled, err := Unreserve(root, "deploy", UnreserveOptions{Force: true, Auditor: auditor})
+	if err != nil || len(cancelled) != 1 || cancelled[0].ID != r.ID {
+		t.Fatalf("Unreserve(force) = %v, %v", cancelled, err)
+	}
+	if err := Acquire(root, "deploy", AcquireOptions{}); err != nil {
+		t.Errorf("Acquire() after unreserve error = %v", err)
+	}
+
+	events := readAuditEvents(t, root)
+	if len(events) == 0 || events[len(events)-1].Event != audit.EventForceUnreserve {
+		t.Errorf("last event = %v, want %s", events, audit.EventForceUnreserve)
+	}
+}
+
+func TestUnreserve_ByOwner(t *testing.T) {
+	root := t.TempDir()
+	reserveFor(t, root, "deploy", "alice", 0, time.Hour)
+	r := reserveFor(t, root, "deploy", "alice", 2*time.Hour, 3*time.Hour)
+
+	t.Setenv("LOKT_OWNER", "alice")
+	cancelled, err := Unreserve(root, "deploy", UnreserveOptions{ID: r.ID})
+	if err != nil || len(cancelled) != 1 {
+		t.Fatalf("Unreserve(id) = %v, %v", cancelled, err)
+	}
+	list, _ := Reservations(root, "deploy", 0)
+	if len(list) != 1 || list[0].ID == r.ID {
+		t.Errorf("Reservations() after unreserve = %v", list)
+	}
+}
+
+func TestPruneReservations(t *testing.T) {
+	root := t.TempDir()
+	r := reserveFor(t, root, "deploy", "alice", 0, time.Hour)
+	live := reserveFor(t, root, "deploy", "alice", 2*time.Hour, 3*time.Hour)
+
+	// End the first one a minute ago.
+	r.Until = time.Now().Add(-time.Minute)
+	data, _ := json.Marshal(r)
+	if err := os.WriteFile(filepath.Join(root, "reservations", "deploy", r.ID+".json"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the skew grace it is kept.
+	if n, errs := PruneReservations(root, 5*time.Minute); n != 0 || len(errs) != 0 {
+		t.Errorf("PruneReservations(grace) = %d, %v; want 0", n, errs)
+	}
+	if n, errs := PruneReservations(root, 0); n != 1 || len(errs) != 0 {
+		t.Errorf("PruneReservations() = %d, %v; want 1", n, errs)
+	}
+	list, _ := Reservations(root, "", 0)
+	if len(list) != 1 || list[0].ID != live.ID {
+		t.Errorf("Reservations() after prune = %v", list)
+	}
+}
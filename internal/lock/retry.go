@@ -0,0 +1,104 @@
+package lock
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy describes how wait loops poll a contended lock or an active
+// freeze. The interval for attempt n is Base*Multiplier^n, capped at Max,
+// then scaled by a jitter factor in [1-Spread, 1+Spread] to desynchronize
+// competing waiters.
+//
+// The zero value means DefaultRetryPolicy. Every wait loop in this package
+// (AcquireWithWait, WaitForThaw) consumes a RetryPolicy rather than its own
+// constants, so new loops should take one too.
+type RetryPolicy struct {
+	Base   time.Duration // First interval
+	Max    time.Duration // Interval cap before jitter
+	Spread float64       // Jitter as a fraction of the interval (0.25 = ±25%)
+	// Multiplier grows the interval after each attempt: 2 doubles it, 1
+	// polls every Base. Below 1 (including zero) means 2.
+	Multiplier float64
+	Rand       func() float64 // Jitter source returning [0, 1); nil uses math/rand
+}
+
+// DefaultRetryPolicy polls at 50ms, doubling up to 2s, with ±25% jitter.
+var DefaultRetryPolicy = RetryPolicy{
+	Base:   50 * time.Millisecond,
+	Max:    2 * time.Second,
+	Spread: 0.25,
+}
+
+// Adaptive backoff: when more than AdaptiveThreshold other processes are
+// waiting for the same lock, each waiter stretches its interval cap to
+//
+//	Max * others / AdaptiveThreshold, capped at AdaptiveMaxCeiling
+//
+// With 30 waiters on the default policy that is 2s*29/4 = 14.5s, cutting
+// aggregate polling on a shared filesystem from ~15 to ~2 reads/sec at the
+// cost of individual responsiveness that matters little in such a crowd.
+const (
+	AdaptiveThreshold  = 4
+	AdaptiveMaxCeiling = 15 * time.Second
+)
+
+// Adapt returns p with its cap stretched for the given number of other
+// waiters, per the formula above. A cap already above AdaptiveMaxCeiling is
+// never lowered.
+func (p RetryPolicy) Adapt(others int) RetryPolicy {
+	p = p.withDefaults()
+	if others <= AdaptiveThreshold {
+		return p
+	}
+	stretched := p.Max * time.Duration(others) / AdaptiveThreshold
+	if stretched > AdaptiveMaxCeiling {
+		stretched = AdaptiveMaxCeiling
+	}
+	if stretched > p.Max {
+		p.Max = stretched
+	}
+	return p
+}
+
+// withDefaults fills in DefaultRetryPolicy when p is unset. A custom Rand or
+// Multiplier is kept so callers can change those without restating the
+// timings.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.Base <= 0 && p.Max <= 0 {
+		r, m := p.Rand, p.Multiplier
+		p = DefaultRetryPolicy
+		p.Rand, p.Multiplier = r, m
+	}
+	if p.Max < p.Base {
+		p.Max = p.Base
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	return p
+}
+
+// Interval returns the poll interval for the given zero-based attempt.
+func (p RetryPolicy) Interval(attempt int) time.Duration {
+	p = p.withDefaults()
+
+	interval := p.Base
+	for i := 0; i < attempt && interval < p.Max && p.Multiplier > 1; i++ {
+		interval = time.Duration(float64(interval) * p.Multiplier)
+	}
+	if interval > p.Max {
+		interval = p.Max
+	}
+
+	if p.Spread <= 0 {
+		return interval
+	}
+	// Using math/rand is fine here - this is timing jitter, not security
+	r := p.Rand
+	if r == nil {
+		r = rand.Float64 //nolint:gosec // G404: jitter doesn't need crypto rand
+	}
+	jitter := 1 - p.Spread + r()*2*p.Spread
+	return time.Duration(float64(interval) * jitter)
+}
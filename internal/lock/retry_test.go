@@ -0,0 +1,121 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func fixedRand(v float64) func() float64 {
+	return func() float64 { return v }
+}
+
+func TestRetryPolicy_Interval(t *testing.T) {
+	p := RetryPolicy{Rand: fixedRand(0.5)} // midpoint: no jitter
+	want := []time.Duration{
+		50 * time.Millisecond,
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		1600 * time.Millisecond,
+		2 * time.Second,
+		2 * time.Second,
+	}
+	for attempt, w := range want {
+		if got := p.Interval(attempt); got != w {
+			t.Errorf("attempt %d: Interval() = %v, want %v", attempt, got, w)
+		}
+	}
+	if got := p.Interval(1000); got != 2*time.Second {
+		t.Errorf("attempt 1000: Interval() = %v, want cap of 2s", got)
+	}
+}
+
+func TestRetryPolicy_JitterBounds(t *testing.T) {
+	tests := []struct {
+		rand float64
+		want time.Duration
+	}{
+		{0, 75 * time.Millisecond},
+		{0.5, 100 * time.Millisecond},
+		{0.75, 112500 * time.Microsecond},
+	}
+	for _, tt := range tests {
+		p := RetryPolicy{Rand: fixedRand(tt.rand)}
+		if got := p.Interval(1); got != tt.want {
+			t.Errorf("rand %v: Interval(1) = %v, want %v", tt.rand, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicy_Custom(t *testing.T) {
+	p := RetryPolicy{Base: 10 * time.Millisecond, Max: 30 * time.Millisecond}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond}
+	for attempt, w := range want {
+		if got := p.Interval(attempt); got != w {
+			t.Errorf("attempt %d: Interval() = %v, want %v", attempt, got, w)
+		}
+	}
+}
+
+func TestRetryPolicy_Multiplier(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		multiplier float64
+		want       []time.Duration
+	}{
+		{1, []time.Duration{10 * ms, 10 * ms, 10 * ms}},
+		{3, []time.Duration{10 * ms, 30 * ms, 90 * ms, 100 * ms}},
+		{0, []time.Duration{10 * ms, 20 * ms, 40 * ms}}, // unset doubles
+	}
+	for _, tt := range tests {
+		p := RetryPolicy{Base: 10 * ms, Max: 100 * ms, Multiplier: tt.multiplier}
+		for attempt, w := range tt.want {
+			if got := p.Interval(attempt); got != w {
+				t.Errorf("Multiplier %v, attempt %d: Interval() = %v, want %v", tt.multiplier, attempt, got, w)
+			}
+		}
+	}
+}
+
+func TestAcquireWithWait_UsesRetryPolicy(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(filepath.Join(locksDir, "contended.json"), &lockfile.Lock{
+		Version: 1, Name: "contended", Owner: "other-owner", Host: "other-host", PID: os.Getpid(), AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var polls atomic.Int32
+	opts := AcquireOptions{Retry: RetryPolicy{
+		Base: time.Millisecond,
+		Max:  time.Millisecond,
+		Rand: func() float64 {
+			polls.Add(1)
+			return 0.5
+		},
+		Spread: 0.25,
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := AcquireWithWait(ctx, root, "contended", opts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AcquireWithWait() error = %v, want deadline exceeded", err)
+	}
+	// With the default 50ms base there would be at most a couple of polls.
+	if n := polls.Load(); n < 10 {
+		t.Errorf("expected the 1ms policy to drive many polls, got %d", n)
+	}
+}
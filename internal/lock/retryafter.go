@@ -0,0 +1,58 @@
+package lock
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// Retry hints for denied callers. Every denial surface (HeldError,
+// FrozenError, deny audit events, CLI JSON and timeout messages) derives its
+// hint from RetryAfter so they always agree.
+const (
+	// DefaultRetryAfter is the hint when the holder has no TTL and the
+	// caller has not configured a fallback.
+	DefaultRetryAfter = 60 * time.Second
+	// MaxRetryAfter caps the hint for long TTLs; a holder may release early.
+	MaxRetryAfter = 10 * time.Minute
+	// MinRetryAfter is the floor, used for expired or unreadable holders.
+	MinRetryAfter = time.Second
+)
+
+// RetryAfter returns how long a caller denied by holder (a lock or a freeze)
+// should wait before trying again: the holder's remaining TTL capped at
+// MaxRetryAfter, or fallback (DefaultRetryAfter if zero) when the holder has
+// no TTL. A nil or anonymous holder, such as a lock file caught mid-write,
+// yields MinRetryAfter. The result is rounded up to whole seconds.
+func RetryAfter(holder *lockfile.Lock, fallback time.Duration) time.Duration {
+	if holder == nil || holder.Owner == "" {
+		return MinRetryAfter
+	}
+	if fallback <= 0 {
+		fallback = DefaultRetryAfter
+	}
+
+	d := fallback
+	if holder.ExpiresAt != nil || holder.TTLSec > 0 {
+		d = min(holder.Remaining(), MaxRetryAfter)
+	}
+	d = max(d, MinRetryAfter)
+	if rem := d % time.Second; rem != 0 {
+		d += time.Second - rem
+	}
+	return d
+}
+
+// FormatRetryAfter renders a retry hint for humans, e.g. "try again in ~4m".
+// Minutes and hours are rounded up so the hint never undersells the wait.
+func FormatRetryAfter(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("try again in ~%ds", int((d+time.Second-1)/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("try again in ~%dm", int((d+time.Minute-1)/time.Minute))
+	default:
+		return fmt.Sprintf("try again in ~%dh", int((d+time.Hour-1)/time.Hour))
+	}
+}
@@ -0,0 +1,136 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func TestRetryAfter(t *testing.T) {
+	in := func(d time.Duration) *time.Time {
+		at := time.Now().Add(d)
+		return &at
+	}
+	tests := []struct {
+		name     string
+		holder   *lockfile.Lock
+		fallback time.Duration
+		want     time.Duration
+	}{
+		{"nil holder", nil, 0, MinRetryAfter},
+		{"anonymous holder", &lockfile.Lock{Name: "x"}, 0, MinRetryAfter},
+		{"no TTL uses default", &lockfile.Lock{Owner: "a"}, 0, DefaultRetryAfter},
+		{"no TTL uses configured fallback", &lockfile.Lock{Owner: "a"}, 5 * time.Minute, 5 * time.Minute},
+		{"remaining TTL", &lockfile.Lock{Owner: "a", TTLSec: 300, ExpiresAt: in(4*time.Minute - 500*time.Millisecond)}, 0, 4 * time.Minute},
+		{"long TTL capped", &lockfile.Lock{Owner: "a", TTLSec: 7200, ExpiresAt: in(2 * time.Hour)}, 0, MaxRetryAfter},
+		{"expired TTL", &lockfile.Lock{Owner: "a", TTLSec: 60, ExpiresAt: in(-time.Minute)}, 0, MinRetryAfter},
+		{"legacy TTL without expires_at", &lockfile.Lock{Owner: "a", TTLSec: 120, AcquiredAt: time.Now().Add(-time.Minute - 500*time.Millisecond)}, 0, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RetryAfter(tt.holder, tt.fallback); got != tt.want {
+				t.Errorf("RetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRetryAfter(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{time.Second, "try again in ~1s"},
+		{45 * time.Second, "try again in ~45s"},
+		{time.Minute, "try again in ~1m"},
+		{3*time.Minute + time.Second, "try again in ~4m"},
+		{90 * time.Minute, "try again in ~2h"},
+	}
+	for _, tt := range tests {
+		if got := FormatRetryAfter(tt.d); got != tt.want {
+			t.Errorf("FormatRetryAfter(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestAcquire_DenyCarriesRetryAfter(t *testing.T) {
+	root := t.TempDir()
+	locksDir := filepath.Join(root, "locks")
+	if err := os.MkdirAll(locksDir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(4 * time.Minute)
+	if err := lockfile.Write(filepath.Join(locksDir, "ttl.json"), &lockfile.Lock{
+		Name: "ttl", Owner: "other-owner", Host: "other-host", PID: 99999,
+		AcquiredAt: time.Now(), TTLSec: 300, ExpiresAt: &exp,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(filepath.Join(locksDir, "nottl.json"), &lockfile.Lock{
+		Name: "nottl", Owner: "other-owner", Host: "other-host", PID: 99999, AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	auditor := audit.NewWriter(root)
+
+	var held *HeldError
+	err := Acquire(root, "ttl", AcquireOptions{Auditor: auditor})
+	if !errors.As(err, &held) {
+		t.Fatalf("expected HeldError, got %v", err)
+	}
+	if held.RetryAfter != 4*time.Minute {
+		t.Errorf("TTL holder: RetryAfter = %v, want 4m", held.RetryAfter)
+	}
+	if !strings.Contains(err.Error(), "try again in ~4m") {
+		t.Errorf("message missing hint: %q", err.Error())
+	}
+
+	err = Acquire(root, "nottl", AcquireOptions{Auditor: auditor, RetryAfterDefault: 90 * time.Second})
+	if !errors.As(err, &held) || held.RetryAfter != 90*time.Second {
+		t.Errorf("no-TTL holder: expected configured 90s fallback, got %v", err)
+	}
+
+	events := readAuditEvents(t, root)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 deny events, got %d", len(events))
+	}
+	for i, want := range []float64{240, 90} {
+		if got, _ := events[i].Extra["retry_after_sec"].(float64); got != want {
+			t.Errorf("event %d retry_after_sec = %v, want %v", i, events[i].Extra["retry_after_sec"], want)
+		}
+	}
+}
+
+func TestCheckFreeze_FrozenCarriesRetryAfter(t *testing.T) {
+	root := t.TempDir()
+	auditor := audit.NewWriter(root)
+	if err := Freeze(root, "deploy", FreezeOptions{TTL: 2 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := CheckFreeze(root, "deploy", auditor)
+	var frozen *FrozenError
+	if !errors.As(err, &frozen) {
+		t.Fatalf("expected FrozenError, got %v", err)
+	}
+	if frozen.RetryAfter != 2*time.Minute {
+		t.Errorf("RetryAfter = %v, want 2m", frozen.RetryAfter)
+	}
+	if !strings.Contains(err.Error(), "try again in ~2m") {
+		t.Errorf("message missing hint: %q", err.Error())
+	}
+
+	events := readAuditEvents(t, root)
+	if len(events) != 1 || events[0].Event != audit.EventFreezeDeny {
+		t.Fatalf("expected one freeze-deny event, got %+v", events)
+	}
+	if got, _ := events[0].Extra["retry_after_sec"].(float64); got != 120 {
+		t.Errorf("retry_after_sec = %v, want 120", events[0].Extra["retry_after_sec"])
+	}
+}
@@ -0,0 +1,249 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// Session registry.
+//
+// A process acquiring with a session ID (LOKT_SESSION, lock/guard
+// --session) stamps the lock file with it and lists the name in
+// <root>/sessions/<id>.json. An orchestrator that killed an agent then
+// releases everything the agent held with one EndSession call, instead of
+// guessing names or waiting for auto-prune; it also separates agents that
+// share an owner string, which ReleaseByOwner can't.
+//
+// The registry file is an index, rewritten atomically without a lock, so two
+// processes of one session acquiring at the same moment can drop each
+// other's entry. The stamp in the lock file is what counts: EndSession and
+// Sessions also scan the locks for it, and release only locks still
+// stamped with the session.
+
+// EnvLoktSession is the session ID acquisitions register in by default.
+const EnvLoktSession = "LOKT_SESSION"
+
+// Session is a session's registry file.
+type Session struct {
+	ID      string    `json:"id"`
+	Owner   string    `json:"owner"`
+	Host    string    `json:"host"`
+	Created time.Time `json:"created_ts"`
+	Locks   []string  `json:"locks"`
+}
+
+// SessionStatus is a session as Sessions reports it.
+type SessionStatus struct {
+	Session
+	// Held are the locks still stamped with the session.
+	Held []*lockfile.Lock `json:"held"`
+	// Live is whether a holder of one of them may still be running: it is
+	// alive, or on another host and can't be checked.
+	Live bool `json:"live"`
+}
+
+// ValidateSessionID checks that id can name a registry file: one segment of
+// the characters allowed in lock names.
+func ValidateSessionID(id string) error {
+	if strings.Contains(id, "/") {
+		return fmt.Errorf("invalid session ID %q: must not contain /", id)
+	}
+	if err := lockfile.ValidateName(id); err != nil {
+		return fmt.Errorf("invalid session ID %q: %w", id, err)
+	}
+	return nil
+}
+
+// readSession reads id's registry file.
+func readSession(rootDir, id string) (*Session, error) {
+	data, err := os.ReadFile(root.SessionFilePath(rootDir, id))
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("session %q: %w", id, err)
+	}
+	s.ID = id
+	return &s, nil
+}
+
+// writeSession rewrites s's registry file, or removes it once it lists no
+// locks.
+func writeSession(rootDir string, s *Session) error {
+	path := root.SessionFilePath(rootDir, s.ID)
+	if len(s.Locks) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := root.MkdirAll(rootDir, filepath.Dir(path)); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return lockfile.WriteFileAtomic(path, append(data, '\n'), 0644)
+}
+
+// registerSession lists name in session id, creating its registry file for
+// id's owner. The lock itself is already stamped, so a failure only warns.
+func registerSession(rootDir, id, name string, who identity.Identity) {
+	s, err := readSession(rootDir, id)
+	if err != nil {
+		s = &Session{ID: id, Owner: who.Owner, Host: who.Host, Created: time.Now()}
+	}
+	if slices.Contains(s.Locks, name) {
+		return
+	}
+	s.Locks = append(s.Locks, name)
+	if err := writeSession(rootDir, s); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: could not register lock %q in session %q: %v\n", name, id, err)
+	}
+}
+
+// deregisterSession drops name from session id after its release.
+func deregisterSession(rootDir, id, name string) {
+	s, err := readSession(rootDir, id)
+	if err != nil {
+		return
+	}
+	s.Locks = slices.DeleteFunc(s.Locks, func(n string) bool { return n == name })
+	_ = writeSession(rootDir, s)
+}
+
+// sessionLocks returns the lock files stamped with a session, by session ID.
+func sessionLocks(rootDir string) map[string][]*lockfile.Lock {
+	names, _ := root.LockNames(rootDir)
+	held := make(map[string][]*lockfile.Lock)
+	for _, name := range names {
+		lf, err := lockfile.Read(root.LockFilePath(rootDir, name))
+		if err != nil || lf.Session == "" {
+			continue
+		}
+		held[lf.Session] = append(held[lf.Session], lf)
+	}
+	return held
+}
+
+// Sessions returns every session with a registry file or a lock stamped
+// with it, sorted by ID.
+func Sessions(rootDir string) ([]SessionStatus, error) {
+	held := sessionLocks(rootDir)
+	ids := make(map[string]bool, len(held))
+	for id := range held {
+		ids[id] = true
+	}
+	entries, err := os.ReadDir(filepath.Join(rootDir, root.SessionsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read sessions directory: %w", err)
+	}
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			ids[id] = true
+		}
+	}
+
+	out := make([]SessionStatus, 0, len(ids))
+	for id := range ids {
+		st := SessionStatus{Held: held[id]}
+		if s, err := readSession(rootDir, id); err == nil {
+			st.Session = *s
+		} else {
+			st.ID = id
+		}
+		if st.Held == nil {
+			st.Held = []*lockfile.Lock{}
+		}
+		for _, lf := range st.Held {
+			if !stale.Check(lf).Reason.HolderGone() {
+				st.Live = true
+			}
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// EndSession releases every lock stamped with session id, whoever is
+// running now: the agent that held them is presumed gone. If the registry
+// file names an owner, locks of another owner are left alone. It removes
+// the registry file and returns the names released; a lock that can't be
+// removed is reported on stderr and skipped, like ReleaseByOwner.
+func EndSession(rootDir, id string, opts ReleaseOptions) ([]string, error) {
+	if err := ValidateSessionID(id); err != nil {
+		return nil, err
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	s, err := readSession(rootDir, id)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var released []string
+	for _, lf := range sessionLocks(rootDir)[id] {
+		if s != nil && lf.Owner != s.Owner {
+			continue
+		}
+		path := root.LockFilePath(rootDir, lf.Name)
+		if err := os.Remove(path); err != nil {
+			if !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "warning: failed to remove lock %q: %v\n", lf.Name, err)
+			}
+			continue
+		}
+		dropFlock(path)
+		_ = lockfile.SyncDir(path)
+		emitReleaseEvent(opts.Auditor, lf, opts, stale.ReasonNotStale)
+		released = append(released, lf.Name)
+	}
+
+	if err := os.Remove(root.SessionFilePath(rootDir, id)); err != nil && !os.IsNotExist(err) {
+		return released, fmt.Errorf("remove session file: %w", err)
+	}
+	if s == nil && len(released) == 0 {
+		return nil, fmt.Errorf("session %q: %w", id, ErrNotFound)
+	}
+	return released, nil
+}
+
+// GCSessions ends every session that is not Live: its registry file is
+// removed and any lock still stamped with it, whose holder is dead, is
+// released. It returns the released lock names by session ID.
+func GCSessions(rootDir string, opts ReleaseOptions) (map[string][]string, error) {
+	sessions, err := Sessions(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	ended := make(map[string][]string)
+	var errs []error
+	for _, s := range sessions {
+		if s.Live {
+			continue
+		}
+		released, err := EndSession(rootDir, s.ID, opts)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			errs = append(errs, err)
+		}
+		ended[s.ID] = released
+	}
+	return ended, errors.Join(errs...)
+}
@@ -0,0 +1,150 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func TestSession_RegisterAndDeregister(t *testing.T) {
+	rootDir := t.TempDir()
+
+	for _, name := range []string{"build", "deploy"} {
+		if err := Acquire(rootDir, name, AcquireOptions{Session: "agent-7"}); err != nil {
+			t.Fatalf("Acquire(%s) error = %v", name, err)
+		}
+	}
+	s, err := readSession(rootDir, "agent-7")
+	if err != nil {
+		t.Fatalf("readSession() error = %v", err)
+	}
+	if !slices.Equal(s.Locks, []string{"build", "deploy"}) || s.Owner == "" {
+		t.Errorf("session = %+v, want build and deploy with an owner", s)
+	}
+	if lf, _ := lockfile.Read(root.LockFilePath(rootDir, "build")); lf == nil || lf.Session != "agent-7" {
+		t.Errorf("lock file not stamped with the session: %+v", lf)
+	}
+
+	if err := Release(rootDir, "build", ReleaseOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := readSession(rootDir, "agent-7"); s == nil || !slices.Equal(s.Locks, []string{"deploy"}) {
+		t.Errorf("after releasing build, session = %+v", s)
+	}
+	if err := Release(rootDir, "deploy", ReleaseOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root.SessionFilePath(rootDir, "agent-7")); !os.IsNotExist(err) {
+		t.Errorf("empty session file should be removed, stat err = %v", err)
+	}
+}
+
+func TestSession_InvalidID(t *testing.T) {
+	for _, id := range []string{"a/b", "..", "has space"} {
+		if err := Acquire(t.TempDir(), "x", AcquireOptions{Session: id}); err == nil {
+			t.Errorf("Acquire with session %q should fail", id)
+		}
+	}
+}
+
+func TestEndSession_ReleasesStampedLocks(t *testing.T) {
+	rootDir := t.TempDir()
+
+	if err := Acquire(rootDir, "gpu", AcquireOptions{Session: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Acquire(rootDir, "team/port", AcquireOptions{Session: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Acquire(rootDir, "other", AcquireOptions{Session: "s2"}); err != nil {
+		t.Fatal(err)
+	}
+	// Lost registry update: the stamp alone still ties the lock to s1.
+	s, _ := readSession(rootDir, "s1")
+	s.Locks = []string{"team/port"}
+	if err := writeSession(rootDir, s); err != nil {
+		t.Fatal(err)
+	}
+
+	released, err := EndSession(rootDir, "s1", ReleaseOptions{})
+	if err != nil {
+		t.Fatalf("EndSession() error = %v", err)
+	}
+	sort.Strings(released)
+	if !slices.Equal(released, []string{"gpu", "team/port"}) {
+		t.Errorf("released = %v, want gpu and team/port", released)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "other")); err != nil {
+		t.Errorf("another session's lock was touched: %v", err)
+	}
+	if _, err := os.Stat(root.SessionFilePath(rootDir, "s1")); !os.IsNotExist(err) {
+		t.Errorf("session file should be removed, stat err = %v", err)
+	}
+	if _, err := EndSession(rootDir, "s1", ReleaseOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ending an unknown session: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestEndSession_SkipsOtherOwners(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := Acquire(rootDir, "mine", AcquireOptions{Session: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	// Same session ID, but a lock of another owner
+	path := root.LockFilePath(rootDir, "theirs")
+	if err := lockfile.Write(path, &lockfile.Lock{
+		Name: "theirs", Owner: "someone-else", Host: "h", PID: 1, AcquiredAt: time.Now(), Session: "s1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	released, err := EndSession(rootDir, "s1", ReleaseOptions{})
+	if err != nil || !slices.Equal(released, []string{"mine"}) {
+		t.Errorf("EndSession() = %v, %v; want only mine", released, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("other owner's lock was released: %v", err)
+	}
+}
+
+func TestSessions_LivenessAndGC(t *testing.T) {
+	rootDir := t.TempDir()
+	host, _ := os.Hostname()
+	if err := Acquire(rootDir, "live-lock", AcquireOptions{Session: "live"}); err != nil {
+		t.Fatal(err)
+	}
+	// A session whose agent was killed: its holder PID is gone.
+	deadPath := root.LockFilePath(rootDir, "dead-lock")
+	if err := lockfile.Write(deadPath, &lockfile.Lock{
+		Name: "dead-lock", Owner: "agent", Host: host, PID: 999999999, AcquiredAt: time.Now(), Session: "dead",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	registerSession(rootDir, "dead", "dead-lock", identity.Identity{Owner: "agent", Host: host})
+
+	sessions, err := Sessions(rootDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "dead" || sessions[0].Live || !sessions[1].Live {
+		t.Fatalf("Sessions() = %+v, want dead (not live) and live", sessions)
+	}
+
+	ended, err := GCSessions(rootDir, ReleaseOptions{})
+	if err != nil {
+		t.Fatalf("GCSessions() error = %v", err)
+	}
+	if len(ended) != 1 || !slices.Equal(ended["dead"], []string{"dead-lock"}) {
+		t.Errorf("GCSessions() = %v, want only the dead session ended", ended)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "live-lock")); err != nil {
+		t.Errorf("live session's lock was released: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func setupShardedRoot(t *testing.T) string {
+	t.Helper()
+	rootDir := setupSweepRoot(t)
+	if err := os.WriteFile(filepath.Join(rootDir, "config.json"), []byte(`{"shard_locks": 2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return rootDir
+}
+
+func TestSharded_AcquireAndRelease(t *testing.T) {
+	rootDir := setupShardedRoot(t)
+
+	if err := Acquire(rootDir, "team/build", AcquireOptions{}); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	sharded := root.ShardedLockFilePath(rootDir, "team/build", 2)
+	if _, err := os.Stat(sharded); err != nil {
+		t.Fatalf("lock file not in its shard: %v", err)
+	}
+	// A lock from before sharding is still seen where it is.
+	writeLock(t, root.LocksPath(rootDir), "deploy", &lockfile.Lock{
+		Version: 1, Name: "deploy", Owner: "someone-else", Host: "other-host", PID: 1, AcquiredAt: time.Now(),
+	})
+	var held *HeldError
+	if err := Acquire(rootDir, "deploy", AcquireOptions{}); !errors.As(err, &held) {
+		t.Fatalf("Acquire() over a flat lock error = %v, want HeldError", err)
+	}
+
+	if err := Release(rootDir, "team/build", ReleaseOptions{}); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := os.Stat(sharded); !os.IsNotExist(err) {
+		t.Error("sharded lock file should be deleted")
+	}
+}
+
+func TestSharded_NamespaceIsNotAShard(t *testing.T) {
+	rootDir := setupShardedRoot(t)
+	if err := Acquire(rootDir, "job0", AcquireOptions{}); err != nil {
+		t.Fatalf("Acquire(job0) error = %v", err)
+	}
+	// The hex digits of job0's shard, as a namespace, are a lock of their own.
+	ns := strings.TrimPrefix(root.Shard("job0", 2), root.ShardPrefix) + "/job0"
+	t.Setenv("LOKT_OWNER", "someone-else")
+	if err := Acquire(rootDir, ns, AcquireOptions{}); err != nil {
+		t.Fatalf("Acquire(%q) error = %v", ns, err)
+	}
+	if lf, err := lockfile.Read(root.LockFilePath(rootDir, "job0")); err != nil || lf.Name != "job0" {
+		t.Errorf("job0's lock file = %+v, %v; want its own", lf, err)
+	}
+}
+
+func TestSharded_PrunedFlatLockIsRecreatedInShard(t *testing.T) {
+	rootDir := setupShardedRoot(t)
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("Cannot get hostname: %v", err)
+	}
+	writeLock(t, root.LocksPath(rootDir), "deploy", &lockfile.Lock{
+		Version: 1, Name: "deploy", Owner: "dead-process", Host: hostname, PID: 999999, AcquiredAt: time.Now(),
+	})
+
+	if err := Acquire(rootDir, "deploy", AcquireOptions{}); err != nil {
+		t.Fatalf("Acquire() over a dead flat lock error = %v", err)
+	}
+	flat := filepath.Join(root.LocksPath(rootDir), "deploy.json")
+	if _, err := os.Stat(flat); !os.IsNotExist(err) {
+		t.Errorf("flat lock file still there (stat: %v)", err)
+	}
+	sharded := root.ShardedLockFilePath(rootDir, "deploy", 2)
+	if lf, err := lockfile.Read(sharded); err != nil || lf.PID != os.Getpid() {
+		t.Errorf("sharded lock = %+v, %v; want ours", lf, err)
+	}
+	if root.LockFilePath(rootDir, "deploy") != sharded {
+		t.Error("LockFilePath() doesn't find the new lock")
+	}
+}
+
+func TestSharded_ReleaseByOwnerAndSweep(t *testing.T) {
+	rootDir := setupShardedRoot(t)
+	for _, name := range []string{"a", "b", "ns/c"} {
+		if err := Acquire(rootDir, name, AcquireOptions{}); err != nil {
+			t.Fatalf("Acquire(%q) error = %v", name, err)
+		}
+	}
+	expired := &lockfile.Lock{
+		Version: 1, Name: "old", Owner: "gone", Host: "other-host", PID: 1, TTLSec: 1,
+		AcquiredAt: time.Now().Add(-time.Hour),
+	}
+	path := root.ShardedLockFilePath(rootDir, "old", 2)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(path, expired); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, errs := PruneAllExpired(rootDir, nil, 0); n != 1 || len(errs) > 0 {
+		t.Errorf("PruneAllExpired() = %d, %v; want the expired sharded lock", n, errs)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expired sharded lock should be swept")
+	}
+
+	released, err := ReleaseByOwner(rootDir, identity.Current().Owner, ReleaseOptions{})
+	if err != nil {
+		t.Fatalf("ReleaseByOwner() error = %v", err)
+	}
+	sort.Strings(released)
+	if len(released) != 3 || released[0] != "a" || released[2] != "ns/c" {
+		t.Errorf("released = %v, want a, b, ns/c", released)
+	}
+}
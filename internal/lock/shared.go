@@ -0,0 +1,362 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// Shared (read) locks. Each shared holder has its own file,
+// <root>/shared/<name>/<lock_id>.json, so any number can coexist, while the
+// exclusive lock stays locks/<name>.json. The two modes exclude each other
+// in two phases, like exclusion groups: each side checks for the other
+// before writing its file and again after, and backs out if the other
+// appeared in between. Stale holders (expired, dead or recycled PID) are
+// pruned one by one, so a crashed reader doesn't block writers.
+
+// ModeShared is lockfile.Lock.Mode for a shared holder.
+const ModeShared = "shared"
+
+// SharedHolders returns the readable holder files of name in shared mode,
+// stale ones included, oldest first. Read-only.
+func SharedHolders(rootDir, name string) []*lockfile.Lock {
+	dir := root.SharedDirPath(rootDir, name)
+	entries, _ := os.ReadDir(dir)
+	var out []*lockfile.Lock
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		lf, err := lockfile.Read(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue // being written, or released meanwhile
+		}
+		out = append(out, lf)
+	}
+	slices.SortFunc(out, func(a, b *lockfile.Lock) int { return a.AcquiredAt.Compare(b.AcquiredAt) })
+	return out
+}
+
+// SharedNames returns the names that have shared holder files, sorted.
+func SharedNames(rootDir string) []string {
+	dirs, _ := root.NameDirs(filepath.Join(rootDir, root.SharedDir))
+	var names []string
+	for _, name := range dirs {
+		if len(SharedHolders(rootDir, name)) > 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// sharedHeld prunes stale shared holders of name and returns a HeldError
+// describing the live ones, or nil if there are none.
+func sharedHeld(rootDir, name string, auditor *audit.Writer, id identity.Identity, retryDefault time.Duration) *HeldError {
+	var live []*lockfile.Lock
+	for _, h := range SharedHolders(rootDir, name) {
+		if r := stale.Check(h); r.Stale {
+			path := root.SharedHolderPath(rootDir, name, h.LockID)
+			if os.Remove(path) == nil {
+				_ = lockfile.SyncDir(path)
+				emitAutoPruneEvent(auditor, id, name, h, r.Reason)
+			}
+			continue
+		}
+		live = append(live, h)
+	}
+	return sharedHeldError(live, retryDefault)
+}
+
+// liveSharedHolders returns name's shared holders that aren't stale.
+// Read-only.
+func liveSharedHolders(rootDir, name string) []*lockfile.Lock {
+	var live []*lockfile.Lock
+	for _, h := range SharedHolders(rootDir, name) {
+		if !stale.Check(h).Stale {
+			live = append(live, h)
+		}
+	}
+	return live
+}
+
+// sharedHeldError describes live shared holders (oldest first) as a
+// HeldError, or returns nil if there are none.
+func sharedHeldError(live []*lockfile.Lock, retryDefault time.Duration) *HeldError {
+	if len(live) == 0 {
+		return nil
+	}
+	var retryAfter time.Duration
+	for _, h := range live {
+		retryAfter = max(retryAfter, RetryAfter(h, retryDefault))
+	}
+	return &HeldError{Lock: live[0], RetryAfter: retryAfter, Shared: len(live)}
+}
+
+// exclusiveHeld returns a HeldError if name is held exclusively, or nil.
+// A holder that is gone is pruned, as Acquire does.
+func exclusiveHeld(rootDir, name string, auditor *audit.Writer, id identity.Identity, retryDefault time.Duration) *HeldError {
+	path := root.LockFilePath(rootDir, name)
+	existing, err := lockfile.Read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		// Being written, or unreadable: treat as held so waiters retry
+		return &HeldError{Lock: &lockfile.Lock{Name: name}, RetryAfter: MinRetryAfter}
+	}
+	if r := stale.Check(existing); r.Stale && r.Reason.HolderGone() {
+		if os.Remove(path) == nil {
+			_ = lockfile.SyncDir(path)
+			emitAutoPruneEvent(auditor, id, name, existing, r.Reason)
+			return nil
+		}
+	}
+	return &HeldError{Lock: existing, RetryAfter: RetryAfter(existing, retryDefault)}
+}
+
+// acquireShared is acquire for opts.Shared. Holding name shared again from
+// the same process refreshes its holder file.
+func acquireShared(rootDir, name string, opts AcquireOptions, id identity.Identity) error {
+	ttlSec := int(opts.TTL.Seconds())
+	if held := exclusiveHeld(rootDir, name, opts.Auditor, id, opts.RetryAfterDefault); held != nil {
+		emitDenyEvent(opts.Auditor, id, name, ttlSec, held.Lock, held.RetryAfter)
+		return held
+	}
+
+	if own := ownSharedHolder(SharedHolders(rootDir, name), id, true); own != nil {
+		remaining, timed := renewRemaining(own)
+		touchHolder(own, ttlSec)
+		own.Message, own.Labels = opts.Message, opts.Labels
+		if err := lockfile.Write(root.SharedHolderPath(rootDir, name, own.LockID), own); err != nil {
+			return fmt.Errorf("refresh shared lock: %w", err)
+		}
+		emitRenewEvent(opts.Auditor, id, name, own.TTLSec, own.LockID, remaining, timed)
+		return nil
+	}
+
+	lf := &lockfile.Lock{
+		Version:       lockfile.WriteVersion(),
+		Name:          name,
+		LockID:        lockfile.GenerateLockID(),
+		Owner:         id.Owner,
+		Host:          id.Host,
+		PID:           id.PID,
+		AgentID:       id.AgentID,
+		AgentExplicit: id.AgentExplicit,
+		Mode:          ModeShared,
+		Message:       opts.Message,
+		Labels:        opts.Labels,
+		Path:          opts.Path,
+	}
+	if startNS, err := stale.GetProcessStartTime(id.PID); err == nil {
+		lf.PIDStartNS = startNS
+	}
+	touchHolder(lf, ttlSec)
+	path := root.SharedHolderPath(rootDir, name, lf.LockID)
+	// Retried once: a release or sweep removes the directory when it
+	// empties, possibly between the MkdirAll and the write.
+	for attempt := 0; ; attempt++ {
+		if err := root.MkdirAll(rootDir, root.SharedDirPath(rootDir, name)); err != nil {
+			return fmt.Errorf("ensure shared dir: %w", err)
+		}
+		err := lockfile.Write(path, lf)
+		if err == nil {
+			break
+		}
+		if attempt > 0 || !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("write shared lock: %w", err)
+		}
+	}
+
+	// Second phase: an exclusive lock or group conflict that appeared
+	// since the checks above wins, and this holder backs out.
+	backOut := func() {
+		_ = os.Remove(path)
+		_ = lockfile.SyncDir(path)
+	}
+	if held := exclusiveHeld(rootDir, name, opts.Auditor, id, opts.RetryAfterDefault); held != nil {
+		backOut()
+		emitDenyEvent(opts.Auditor, id, name, ttlSec, held.Lock, held.RetryAfter)
+		return held
+	}
+	if c := FindConflict(rootDir, name, opts.ExclusionGroups, opts.RetryAfterDefault); c != nil {
+		backOut()
+		return &errBackedOut{conflict: c}
+	}
+
+	emitAcquireEvent(opts.Auditor, id, lf, opts.ThawWait, opts.waited)
+	return nil
+}
+
+// touchHolder restarts lf's TTL of ttlSec from now.
+func touchHolder(lf *lockfile.Lock, ttlSec int) {
+	lf.AcquiredAt = time.Now()
+	lf.TTLSec = ttlSec
+	lf.ExpiresAt = nil
+	if ttlSec > 0 {
+		exp := lf.AcquiredAt.Add(time.Duration(ttlSec) * time.Second)
+		lf.ExpiresAt = &exp
+	}
+}
+
+// ownSharedHolder returns this process's holder among holders. Unless
+// exact, it falls back to the newest holder with the same owner, so a
+// `lokt lock --shared` can be released by a later `lokt unlock`.
+func ownSharedHolder(holders []*lockfile.Lock, id identity.Identity, exact bool) *lockfile.Lock {
+	var newest *lockfile.Lock
+	for _, h := range holders {
+		if h.Owner != id.Owner {
+			continue
+		}
+		if h.Host == id.Host && h.PID == id.PID {
+			return h
+		}
+		newest = h // holders are oldest first
+	}
+	if exact {
+		return nil
+	}
+	return newest
+}
+
+// renewShared is Renew for opts.Shared. With opts.AnyProcess it renews the
+// owner's newest hold, and reports ErrNotFound or a *NotOwnerError like
+// Release instead of ErrLockLost.
+func renewShared(rootDir, name string, opts RenewOptions) error {
+	id := identity.Current()
+	holders := SharedHolders(rootDir, name)
+	own := ownSharedHolder(holders, id, !opts.AnyProcess)
+	if own == nil {
+		switch {
+		case !opts.AnyProcess:
+			return fmt.Errorf("%w: %s has no shared hold by %s@%s (pid %d)", ErrLockLost, name, id.Owner, id.Host, id.PID)
+		case len(holders) == 0:
+			return ErrNotFound
+		default:
+			return &NotOwnerError{Lock: holders[0], Current: id}
+		}
+	}
+	if !renewDue(own, opts) {
+		return nil
+	}
+	remaining, timed := renewRemaining(own)
+	own.Version = lockfile.WriteVersion()
+	ttlSec := own.TTLSec
+	if opts.TTL > 0 {
+		ttlSec = int(opts.TTL.Seconds())
+	}
+	touchHolder(own, ttlSec)
+	own.RenewedAt = &own.AcquiredAt
+	if err := lockfile.Write(root.SharedHolderPath(rootDir, name, own.LockID), own); err != nil {
+		return fmt.Errorf("write lock: %w", err)
+	}
+	emitRenewEvent(opts.Auditor, id, name, own.TTLSec, own.LockID, remaining, timed)
+	return nil
+}
+
+// releaseShared is Release for a name held in shared mode. Normally it
+// removes the caller's own hold; Force removes every holder and BreakStale
+// every stale one.
+func releaseShared(rootDir, name string, opts ReleaseOptions) error {
+	holders := SharedHolders(rootDir, name)
+	if len(holders) == 0 {
+		return ErrNotFound
+	}
+
+	type removal struct {
+		lf     *lockfile.Lock
+		reason stale.Reason
+	}
+	var remove []removal
+	switch {
+	case opts.Force:
+		for _, h := range holders {
+			remove = append(remove, removal{h, stale.ReasonNotStale})
+		}
+	case opts.BreakStale:
+		for _, h := range holders {
+			if r := stale.Check(h); r.Stale {
+				remove = append(remove, removal{h, r.Reason})
+			}
+		}
+		if len(remove) == 0 {
+			return &NotStaleError{Lock: holders[0], Reason: stale.Check(holders[0]).Reason}
+		}
+	default:
+		id := identity.Current()
+		own := ownSharedHolder(holders, id, false)
+		if own == nil {
+			return &NotOwnerError{Lock: holders[0], Current: id}
+		}
+		remove = append(remove, removal{own, stale.ReasonNotStale})
+	}
+
+	for _, r := range remove {
+		path := root.SharedHolderPath(rootDir, name, r.lf.LockID)
+		if err := os.Remove(path); err != nil {
+			if os.IsNotExist(err) {
+				continue // released or pruned meanwhile
+			}
+			return fmt.Errorf("remove shared lock: %w", err)
+		}
+		_ = lockfile.SyncDir(path)
+		emitReleaseEvent(opts.Auditor, r.lf, opts, r.reason)
+	}
+	// Fails harmlessly while other holders remain
+	_ = os.Remove(root.SharedDirPath(rootDir, name))
+	return nil
+}
+
+// sweepShared removes shared holders PruneAllExpired would remove if they
+// were lock files (see checkStale).
+func sweepShared(rootDir string, auditor *audit.Writer, grace time.Duration) (int, []error) {
+	sharedDir := filepath.Join(rootDir, root.SharedDir)
+	names, err := root.NameDirs(sharedDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, []error{err}
+	}
+	id := identity.Current()
+	var pruned int
+	var errs []error
+	for _, name := range names {
+		dir := root.SharedDirPath(rootDir, name)
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			path := filepath.Join(dir, e.Name())
+			if e.IsDir() || !strings.HasSuffix(path, ".json") {
+				continue
+			}
+			reason, lf := checkStale(path, grace)
+			if reason == stale.ReasonNotStale {
+				continue
+			}
+			removed, err := removeIfStill(path, reason, lf, func(path string) (stale.Reason, *lockfile.Lock) {
+				return checkStale(path, grace)
+			})
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if !removed {
+				continue
+			}
+			pruned++
+			emitSweepEvent(auditor, id, name, reason, lf)
+		}
+		_ = os.Remove(dir) // once empty
+	}
+	return pruned, errs
+}
@@ -0,0 +1,180 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// writeSharedHolder adds a shared holder file for name.
+func writeSharedHolder(t *testing.T, rootDir string, lf *lockfile.Lock) {
+	t.Helper()
+	lf.Mode = ModeShared
+	if lf.LockID == "" {
+		lf.LockID = lockfile.GenerateLockID()
+	}
+	if err := os.MkdirAll(root.SharedDirPath(rootDir, lf.Name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(root.SharedHolderPath(rootDir, lf.Name, lf.LockID), lf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShared_Coexist(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	auditor := audit.NewWriter(rootDir)
+	writeSharedHolder(t, rootDir, otherHolder("reports"))
+
+	t.Setenv("LOKT_OWNER", "me")
+	if err := Acquire(rootDir, "reports", AcquireOptions{Shared: true, TTL: time.Minute, Auditor: auditor}); err != nil {
+		t.Fatalf("Acquire(shared) alongside a shared holder: %v", err)
+	}
+	if got := len(SharedHolders(rootDir, "reports")); got != 2 {
+		t.Fatalf("holders = %d, want 2", got)
+	}
+	// Again from this process refreshes its hold instead of adding one.
+	if err := Acquire(rootDir, "reports", AcquireOptions{Shared: true, TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(SharedHolders(rootDir, "reports")); got != 2 {
+		t.Errorf("holders after re-acquire = %d, want 2", got)
+	}
+
+	err := Acquire(rootDir, "reports", AcquireOptions{Auditor: auditor})
+	var held *HeldError
+	if !errors.As(err, &held) || held.Shared != 2 {
+		t.Fatalf("Acquire(exclusive) = %v, want HeldError with 2 shared holders", err)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "reports")); !os.IsNotExist(err) {
+		t.Error("a denied exclusive acquire must not leave a lock file")
+	}
+	if err := Check(rootDir, "reports", 0, nil); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("Check() = %v, want held", err)
+	}
+
+	events := readAuditEvents(t, rootDir)
+	if len(events) == 0 || events[0].Event != audit.EventAcquire || events[0].Extra["mode"] != ModeShared {
+		t.Errorf("first event = %+v, want acquire with mode shared", events)
+	}
+
+	if err := Release(rootDir, "reports", ReleaseOptions{}); err != nil {
+		t.Fatalf("Release(shared) error = %v", err)
+	}
+	holders := SharedHolders(rootDir, "reports")
+	if len(holders) != 1 || holders[0].Owner != "other-owner" {
+		t.Errorf("after release, holders = %+v, want only other-owner", holders)
+	}
+	var notOwner *NotOwnerError
+	if err := Release(rootDir, "reports", ReleaseOptions{}); !errors.As(err, &notOwner) {
+		t.Errorf("Release(other's shared) = %v, want NotOwnerError", err)
+	}
+	if err := Release(rootDir, "reports", ReleaseOptions{Force: true}); err != nil {
+		t.Fatalf("Release(force) error = %v", err)
+	}
+	if _, err := os.Stat(root.SharedDirPath(rootDir, "reports")); !os.IsNotExist(err) {
+		t.Error("shared dir should be removed with the last holder")
+	}
+	if err := Release(rootDir, "reports", ReleaseOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Release(none) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestShared_DeniedByExclusive(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	writeLock(t, filepath.Join(rootDir, "locks"), "data", otherHolder("data"))
+
+	err := Acquire(rootDir, "data", AcquireOptions{Shared: true})
+	var held *HeldError
+	if !errors.As(err, &held) || held.Lock.Owner != "other-owner" || held.Shared != 0 {
+		t.Fatalf("Acquire(shared) = %v, want HeldError by the exclusive holder", err)
+	}
+	if holders := SharedHolders(rootDir, "data"); len(holders) != 0 {
+		t.Errorf("a denied shared acquire left holders: %+v", holders)
+	}
+}
+
+func TestShared_StaleHoldersDontBlock(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	auditor := audit.NewWriter(rootDir)
+	hostname, _ := os.Hostname()
+
+	dead := otherHolder("data")
+	dead.Host, dead.PID = hostname, 999999
+	writeSharedHolder(t, rootDir, dead)
+	expired := otherHolder("data")
+	expired.AcquiredAt = time.Now().Add(-time.Hour)
+	expired.TTLSec = 60
+	writeSharedHolder(t, rootDir, expired)
+
+	if err := Acquire(rootDir, "data", AcquireOptions{Auditor: auditor}); err != nil {
+		t.Fatalf("Acquire(exclusive) over stale shared holders: %v", err)
+	}
+	if holders := SharedHolders(rootDir, "data"); len(holders) != 0 {
+		t.Errorf("stale holders should be pruned, got %+v", holders)
+	}
+	pruned := 0
+	for _, e := range readAuditEvents(t, rootDir) {
+		if e.Event == audit.EventAutoPrune {
+			pruned++
+		}
+	}
+	if pruned != 2 {
+		t.Errorf("auto-prune events = %d, want 2", pruned)
+	}
+}
+
+func TestShared_Sweep(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	expired := otherHolder("data")
+	expired.AcquiredAt = time.Now().Add(-time.Hour)
+	expired.TTLSec = 60
+	writeSharedHolder(t, rootDir, expired)
+	writeSharedHolder(t, rootDir, otherHolder("data"))
+
+	n, errs := PruneAllExpired(rootDir, nil, 0)
+	if n != 1 || len(errs) != 0 {
+		t.Fatalf("PruneAllExpired() = %d, %v; want the expired holder", n, errs)
+	}
+	if got := SharedNames(rootDir); len(got) != 1 || got[0] != "data" {
+		t.Errorf("SharedNames() = %v, want [data]", got)
+	}
+}
+
+// TestShared_RaceWithExclusive has shared and exclusive acquirers start
+// together; a writer and a reader must never both succeed.
+func TestShared_RaceWithExclusive(t *testing.T) {
+	for round := range 30 {
+		rootDir := setupSweepRoot(t)
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		results := make([]error, 5)
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				results[i] = Acquire(rootDir, "data", AcquireOptions{Shared: i > 0})
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		_, lockErr := os.Stat(root.LockFilePath(rootDir, "data"))
+		exclusive := lockErr == nil
+		shared := len(SharedHolders(rootDir, "data"))
+		if exclusive && shared > 0 {
+			t.Fatalf("round %d: exclusive lock and %d shared holders coexist (results %v)", round, shared, results)
+		}
+		if exclusive != (results[0] == nil) {
+			t.Fatalf("round %d: exclusive result %v but lock file present = %v", round, results[0], exclusive)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// Slots: a name that up to N holders may hold at once, a counting
+// semaphore. Slot k of name is the ordinary lock "<name>.slots/<k>", so
+// each slot has its own lock file, TTL, heartbeat, release and stale
+// handling; what AcquireSlot adds is picking a free one. The slot count is
+// fixed by the first acquirer and kept in <root>/slots/<name>.json, so
+// callers that disagree on it fail instead of each enforcing their own.
+
+// SlotsSuffix separates a name from its slot number in a slot's lock name.
+const SlotsSuffix = lockfile.SlotsSuffix
+
+// MaxSlots bounds the slot count of a name.
+const MaxSlots = 1024
+
+// ErrSlotCount is returned when a name is acquired with a slot count other
+// than the one it was created with.
+var ErrSlotCount = errors.New("slot count mismatch")
+
+// SlotCountError reports a slot count that differs from the name's.
+type SlotCountError struct {
+	Name string
+	Want int // the count asked for
+	Have int // the count the name was created with
+	Path string
+}
+
+func (e *SlotCountError) Error() string {
+	return fmt.Sprintf("%q has %d slots, not %d (to change the count, remove %s while no slot is held)",
+		e.Name, e.Have, e.Want, e.Path)
+}
+
+func (e *SlotCountError) Unwrap() error {
+	return ErrSlotCount
+}
+
+// SlotsFullError is returned when every slot of a name is held. It unwraps
+// to the denial that should end soonest, so errors.As finds a *HeldError
+// and errors.Is matches ErrLockHeld.
+type SlotsFullError struct {
+	Name       string
+	Held       []*HeldError // one per slot, in slot order
+	RetryAfter time.Duration
+}
+
+func (e *SlotsFullError) Error() string {
+	hint := ""
+	if e.RetryAfter > 0 {
+		hint = "; " + FormatRetryAfter(e.RetryAfter)
+	}
+	return fmt.Sprintf("all %d slots of %q are held%s", len(e.Held), e.Name, hint)
+}
+
+func (e *SlotsFullError) Unwrap() error {
+	return e.soonest()
+}
+
+// soonest returns the denial with the shortest retry hint.
+func (e *SlotsFullError) soonest() *HeldError {
+	var best *HeldError
+	for _, h := range e.Held {
+		if best == nil || h.RetryAfter < best.RetryAfter {
+			best = h
+		}
+	}
+	return best
+}
+
+// SlotName returns the lock name of slot k of name.
+func SlotName(name string, k int) string {
+	return name + SlotsSuffix + "/" + strconv.Itoa(k)
+}
+
+// SlotOf splits a slot's lock name into the name it is a slot of and its
+// number; ok is false if lockName isn't a slot.
+func SlotOf(lockName string) (name string, k int, ok bool) {
+	i := strings.LastIndex(lockName, SlotsSuffix+"/")
+	if i <= 0 {
+		return "", 0, false
+	}
+	num := lockName[i+len(SlotsSuffix)+1:]
+	k, err := strconv.Atoi(num)
+	if err != nil || k < 0 || strconv.Itoa(k) != num {
+		return "", 0, false
+	}
+	return lockName[:i], k, true
+}
+
+// validName is lockfile.ValidateName, except that with slot set the lock
+// name of a slot, which it rejects, is valid if the name the slot is of is.
+func validName(name string, slot bool) error {
+	if base, _, ok := SlotOf(name); ok && slot {
+		return lockfile.ValidateName(base)
+	}
+	return lockfile.ValidateName(name)
+}
+
+// slotsMeta is the content of a name's slots file.
+type slotsMeta struct {
+	Slots     int       `json:"slots"`
+	CreatedAt time.Time `json:"created_ts"`
+	Owner     string    `json:"owner,omitempty"`
+}
+
+// Slots returns the slot count of name, or 0 if it has none.
+func Slots(rootDir, name string) (int, error) {
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return 0, err
+	}
+	meta, err := readSlotsMeta(root.SlotsFilePath(rootDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return meta.Slots, nil
+}
+
+// readSlotsMeta reads a slots file, waiting briefly for one that was just
+// created to be written.
+func readSlotsMeta(path string) (slotsMeta, error) {
+	var meta slotsMeta
+	for try := 0; ; try++ {
+		data, err := os.ReadFile(path) //nolint:gosec // G304: path is controlled
+		if err != nil {
+			return meta, err
+		}
+		if err = json.Unmarshal(data, &meta); err == nil && meta.Slots > 0 {
+			return meta, nil
+		}
+		if len(data) > 0 || try == 20 {
+			return meta, fmt.Errorf("read %s: not a slots file", path)
+		}
+		time.Sleep(10 * time.Millisecond) // created, not written yet
+	}
+}
+
+// ensureSlots records n as the slot count of name if it has none yet, and
+// otherwise checks that it is n.
+func ensureSlots(rootDir, name string, n int) error {
+	if n < 1 || n > MaxSlots {
+		return fmt.Errorf("slot count %d out of range (1-%d)", n, MaxSlots)
+	}
+	path := root.SlotsFilePath(rootDir, name)
+	if err := root.MkdirAll(rootDir, filepath.Dir(path)); err != nil {
+		return ensureDirsError(rootDir, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644) //nolint:gosec // G304: path is controlled
+	if err == nil {
+		_ = f.Close()
+		data, _ := json.MarshalIndent(slotsMeta{Slots: n, CreatedAt: time.Now().UTC(), Owner: identity.Current().Owner}, "", "  ")
+		if err := lockfile.WriteFileAtomic(path, append(data, '\n'), 0644); err != nil {
+			_ = os.Remove(path)
+			return fmt.Errorf("write slots file: %w", err)
+		}
+		return nil
+	}
+	if !os.IsExist(err) {
+		return fmt.Errorf("create slots file: %w", err)
+	}
+	meta, err := readSlotsMeta(path)
+	if err != nil {
+		return err
+	}
+	if meta.Slots != n {
+		return &SlotCountError{Name: name, Want: n, Have: meta.Slots, Path: path}
+	}
+	return nil
+}
+
+// AcquireSlot acquires a free slot of name, one of n, and returns its lock
+// name, to renew and release as any other lock. The first caller fixes n;
+// a different n later is a *SlotCountError. If every slot is held it
+// returns a *SlotsFullError. A slot the caller already holds counts as held:
+// each acquisition takes a slot of its own. opts.RespectFreeze checks name
+// itself; shared holds aren't supported.
+func AcquireSlot(rootDir, name string, n int, opts AcquireOptions) (string, error) {
+	if opts.Shared {
+		return "", errors.New("slots can't be held shared")
+	}
+	if err := lockfile.ValidateName(name); err != nil {
+		return "", err
+	}
+	rootDir, err := root.Follow(rootDir)
+	if err != nil {
+		return "", err
+	}
+	if err := root.EnsureDirs(rootDir); err != nil {
+		return "", ensureDirsError(rootDir, err)
+	}
+	if err := ensureSlots(rootDir, name, n); err != nil {
+		return "", err
+	}
+	if opts.RespectFreeze {
+		if err := CheckFreeze(rootDir, name, opts.Auditor); err != nil {
+			return "", err
+		}
+		opts.RespectFreeze = false
+	}
+	if opts.TTL, err = policyTTL(rootDir, name, opts.TTL); err != nil {
+		return "", err
+	}
+	if err := checkSlotsName(rootDir, name, opts); err != nil {
+		return "", err
+	}
+	return attemptSlots(rootDir, name, n, opts)
+}
+
+// checkSlotsName checks name itself before its slots are tried: its
+// reservations and exclusion groups, which the slots' lock names aren't in.
+func checkSlotsName(rootDir, name string, opts AcquireOptions) error {
+	id := identity.Current()
+	if err := checkReservations(rootDir, name, id, opts.TTL, opts.SkewGrace, opts.Auditor); err != nil {
+		return err
+	}
+	if c := FindConflict(rootDir, name, opts.ExclusionGroups, opts.RetryAfterDefault); c != nil {
+		emitConflictDenyEvent(opts.Auditor, id, name, int(opts.TTL.Seconds()), c)
+		return c
+	}
+	return nil
+}
+
+// slotsDenial returns the denial a wait for a slot of name can outlast
+// behind err: the slot that should free up soonest, or the held member of
+// one of name's exclusion groups.
+func slotsDenial(err error) (*HeldError, bool) {
+	var full *SlotsFullError
+	var c *ConflictError
+	switch {
+	case errors.As(err, &full):
+		return full.soonest(), true
+	case errors.As(err, &c):
+		return c.Held, true
+	}
+	return nil, false
+}
+
+// attemptSlots makes one pass over the slots of name, taking the first one
+// that is free. The caller has applied name's policy and checked it
+// (checkSlotsName).
+func attemptSlots(rootDir, name string, n int, opts AcquireOptions) (string, error) {
+	opts.slot = true
+	opts.ExclusionGroups = nil
+	full := &SlotsFullError{Name: name}
+	for k := range n {
+		slot := SlotName(name, k)
+		// A live holder, whoever it is, keeps its slot: no point in an
+		// attempt, or in the deny event it would record.
+		if reason, lf := classifyStale(root.LockFilePath(rootDir, slot), opts.SkewGrace); lf != nil && reason == stale.ReasonNotStale {
+			full.Held = append(full.Held, &HeldError{Lock: lf, RetryAfter: RetryAfter(lf, opts.RetryAfterDefault)})
+			continue
+		}
+		err := Acquire(rootDir, slot, opts)
+		if err == nil {
+			return slot, nil
+		}
+		var held *HeldError
+		if !errors.As(err, &held) {
+			return "", err
+		}
+		full.Held = append(full.Held, held)
+	}
+	full.RetryAfter = full.soonest().RetryAfter
+	return "", full
+}
+
+// TrySlot is TryAcquire for AcquireSlot: with every slot held it returns a
+// TryResult with Held set to the slot that should free up soonest, and
+// records a skip event for name.
+func TrySlot(rootDir, name string, n int, opts AcquireOptions) (string, TryResult, error) {
+	slot, err := AcquireSlot(rootDir, name, n, opts)
+	if err == nil {
+		return slot, TryResult{Acquired: true}, nil
+	}
+	var full *SlotsFullError
+	if !errors.As(err, &full) {
+		return "", TryResult{}, err
+	}
+	held := full.soonest()
+	emitSkipEvent(opts.Auditor, identity.Current(), name, held)
+	return "", TryResult{Held: held}, nil
+}
+
+// AcquireSlotWithWait is AcquireSlot polling until a slot is free or ctx
+// ends, as AcquireWithWait does for a single lock: it counts as a waiter
+// for name, breaks stale slot locks, honors opts.RespectFreeze on name and
+// reports through OnWait and OnProgress. It returns the slot's lock name,
+// or a *WaitError wrapping ctx.Err().
+func AcquireSlotWithWait(ctx context.Context, rootDir, name string, n int, opts AcquireOptions) (string, error) {
+	start := time.Now()
+	slot, err := AcquireSlot(rootDir, name, n, opts)
+	held, waitable := slotsDenial(err)
+	if err == nil || !waitable {
+		return slot, err
+	}
+	if opts.OnWait != nil {
+		opts.OnWait(held)
+	}
+
+	rootDir, err = root.Follow(rootDir)
+	if err != nil {
+		return "", err
+	}
+	if opts.TTL, err = policyTTL(rootDir, name, opts.TTL); err != nil {
+		return "", err
+	}
+	var self *waiter
+	if !opts.NoAdaptive {
+		// Best-effort: without a marker this waiter just isn't counted.
+		if self, err = registerWaiter(rootDir, name); err == nil {
+			defer self.remove()
+		}
+	}
+
+	progress := newWaitProgress(opts, start)
+	freezes := newFreezeWatch(opts)
+	opts.RespectFreeze = false // freezes checks each poll from here on
+	policy := opts.Retry
+	attempt := 0
+	for {
+		if self != nil {
+			self.touch()
+			if attempt%waiterRecount == 0 {
+				policy = opts.Retry.Adapt(self.others())
+			}
+		}
+		interval := policy.Interval(attempt)
+		attempt++
+
+		select {
+		case <-ctx.Done():
+			waitErr := &WaitError{Err: ctx.Err(), Attempts: attempt, Waited: time.Since(start)}
+			if errors.Is(waitErr, context.DeadlineExceeded) {
+				emitWaitTimeoutEvent(opts.Auditor, identity.Current(), name, waitErr.Waited, attempt, held.Lock)
+			}
+			return "", waitErr
+		case <-time.After(interval):
+			if frozen, err := freezes.frozen(rootDir, name); err != nil {
+				return "", err
+			} else if frozen {
+				continue // don't take a slot from under the freeze
+			}
+			// A reservation of name made while waiting refuses it, as
+			// AcquireSlot does, and a held group member is waited out.
+			if err := checkSlotsName(rootDir, name, opts); err != nil {
+				if held, waitable = slotsDenial(err); !waitable {
+					return "", err
+				}
+				progress.report(held.Lock)
+				continue
+			}
+			for k := range n {
+				_ = tryBreakStale(rootDir, SlotName(name, k), opts.Auditor, opts.SkewGrace)
+			}
+
+			opts.waited = waitStats{since: start, attempts: attempt + 1}
+			slot, err := attemptSlots(rootDir, name, n, opts)
+			if err == nil {
+				return slot, nil
+			}
+			if held, waitable = slotsDenial(err); !waitable {
+				return "", err
+			}
+			progress.report(held.Lock)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/policy"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func TestSlotOf(t *testing.T) {
+	for _, tc := range []struct {
+		lockName string
+		name     string
+		k        int
+		ok       bool
+	}{
+		{"itest.slots/0", "itest", 0, true},
+		{"team/web/itest.slots/12", "team/web/itest", 12, true},
+		{SlotName("a.slots/1", 2), "a.slots/1", 2, true},
+		{"itest", "", 0, false},
+		{"itest.slots/", "", 0, false},
+		{"itest.slots/01", "", 0, false},
+		{"itest.slots/-1", "", 0, false},
+		{".slots/1", "", 0, false},
+	} {
+		name, k, ok := SlotOf(tc.lockName)
+		if name != tc.name || k != tc.k || ok != tc.ok {
+			t.Errorf("SlotOf(%q) = %q, %d, %v; want %q, %d, %v", tc.lockName, name, k, ok, tc.name, tc.k, tc.ok)
+		}
+	}
+}
+
+func TestAcquireSlot(t *testing.T) {
+	rootDir := t.TempDir()
+
+	// The same owner takes a slot of its own each time
+	var got []string
+	for range 3 {
+		slot, err := AcquireSlot(rootDir, "itest", 3, AcquireOptions{TTL: time.Minute})
+		if err != nil {
+			t.Fatalf("AcquireSlot() error = %v", err)
+		}
+		got = append(got, slot)
+	}
+	for k, slot := range got {
+		if slot != SlotName("itest", k) {
+			t.Errorf("acquisition %d took %q, want %q", k, slot, SlotName("itest", k))
+		}
+	}
+	if n, err := Slots(rootDir, "itest"); n != 3 || err != nil {
+		t.Errorf("Slots() = %d, %v; want 3", n, err)
+	}
+
+	_, err := AcquireSlot(rootDir, "itest", 3, AcquireOptions{})
+	var full *SlotsFullError
+	var held *HeldError
+	if !errors.As(err, &full) || len(full.Held) != 3 || !errors.As(err, &held) || !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("AcquireSlot() with all held = %v, want SlotsFullError with 3 holders", err)
+	}
+
+	// Release frees that slot only
+	if err := Release(rootDir, SlotName("itest", 1), ReleaseOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := AcquireSlot(rootDir, "itest", 3, AcquireOptions{}); err != nil || slot != SlotName("itest", 1) {
+		t.Errorf("AcquireSlot() after release = %q, %v; want slot 1", slot, err)
+	}
+
+	// The count is fixed by the first acquirer
+	_, err = AcquireSlot(rootDir, "itest", 2, AcquireOptions{})
+	var count *SlotCountError
+	if !errors.As(err, &count) || count.Have != 3 || count.Want != 2 || !errors.Is(err, ErrSlotCount) {
+		t.Errorf("AcquireSlot(2) = %v, want SlotCountError 3 vs 2", err)
+	}
+	if _, err := AcquireSlot(rootDir, "other", 0, AcquireOptions{}); err == nil {
+		t.Error("AcquireSlot(0) succeeded, want an error")
+	}
+	if n, err := Slots(rootDir, "other"); n != 0 || err != nil {
+		t.Errorf("Slots(other) = %d, %v; want 0", n, err)
+	}
+}
+
+func TestAcquireSlotWithWait(t *testing.T) {
+	rootDir := t.TempDir()
+	if _, err := AcquireSlot(rootDir, "itest", 1, AcquireOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// An expired holder of the other slot is broken while waiting
+	if err := ensureSlots(rootDir, "wide", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(rootDir, "locks", "wide.slots"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	for k := range 2 {
+		if err := lockfile.Write(root.LockFilePath(rootDir, SlotName("wide", k)), &lockfile.Lock{
+			Version: 1, Name: SlotName("wide", k), Owner: "other", Host: "other-host", PID: os.Getpid(),
+			AcquiredAt: time.Now().Add(-time.Hour), TTLSec: k + 1,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var waited bool
+	_, err := AcquireSlotWithWait(ctx, rootDir, "itest", 1, AcquireOptions{OnWait: func(*HeldError) { waited = true }})
+	var waitErr *WaitError
+	if !errors.As(err, &waitErr) || !errors.Is(err, context.DeadlineExceeded) || !waited {
+		t.Errorf("AcquireSlotWithWait() on a full name = %v (OnWait %v), want a timed-out WaitError", err, waited)
+	}
+
+	slot, err := AcquireSlotWithWait(context.Background(), rootDir, "wide", 2, AcquireOptions{})
+	if err != nil || slot != SlotName("wide", 0) {
+		t.Errorf("AcquireSlotWithWait() = %q, %v; want the first expired slot", slot, err)
+	}
+}
+
+func TestAcquireSlotWithWait_ReservedWhileWaiting(t *testing.T) {
+	rootDir := t.TempDir()
+	t.Setenv("LOKT_OWNER", "alice")
+	slot, err := AcquireSlot(rootDir, "deploy", 1, AcquireOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOKT_OWNER", "bob")
+
+	// alice reserves the name, then frees her slot.
+	errc := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, err := Reserve(rootDir, "deploy", ReserveOptions{Owner: "alice", Until: time.Now().Add(time.Hour)})
+		if err == nil {
+			err = os.Remove(root.LockFilePath(rootDir, slot))
+		}
+		errc <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = AcquireSlotWithWait(ctx, rootDir, "deploy", 1, AcquireOptions{})
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(err, ErrReserved) {
+		t.Errorf("AcquireSlotWithWait() error = %v, want ErrReserved", err)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, slot)); !os.IsNotExist(err) {
+		t.Errorf("slot taken despite the reservation (stat: %v)", err)
+	}
+}
+
+func TestAcquireSlot_Policy(t *testing.T) {
+	rootDir := t.TempDir()
+	data := `{"locks": {"itest": {"max_ttl": "10m", "require_ttl": true}}}`
+	if err := os.WriteFile(policy.Path(rootDir), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var perr *PolicyError
+	if _, err := AcquireSlot(rootDir, "itest", 2, AcquireOptions{}); !errors.As(err, &perr) {
+		t.Errorf("AcquireSlot() without a TTL error = %v, want PolicyError", err)
+	}
+	slot, err := AcquireSlot(rootDir, "itest", 2, AcquireOptions{TTL: 5 * time.Minute})
+	if err != nil {
+		t.Fatalf("AcquireSlot() error = %v", err)
+	}
+	if lf, err := lockfile.Read(root.LockFilePath(rootDir, slot)); err != nil || lf.TTLSec != 300 {
+		t.Errorf("slot lock = %+v, %v; want a 300s TTL", lf, err)
+	}
+}
+
+func TestAcquireSlot_ExclusionGroup(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	groups := map[string][]string{"ab": {"a", "b"}}
+	writeLock(t, filepath.Join(rootDir, "locks"), "a", otherHolder("a"))
+
+	var conflict *ConflictError
+	if _, err := AcquireSlot(rootDir, "b", 2, AcquireOptions{ExclusionGroups: groups}); !errors.As(err, &conflict) || conflict.Held.Lock.Name != "a" {
+		t.Fatalf("AcquireSlot(b) with a held error = %v, want ConflictError naming a", err)
+	}
+	// A wait waits the member out, as AcquireWithWait does.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = os.Remove(filepath.Join(rootDir, "locks", "a.json"))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if slot, err := AcquireSlotWithWait(ctx, rootDir, "b", 2, AcquireOptions{ExclusionGroups: groups}); err != nil || slot != SlotName("b", 0) {
+		t.Errorf("AcquireSlotWithWait(b) = %q, %v; want the first slot once a is released", slot, err)
+	}
+}
+
+func TestAcquireSlot_SlotNamesAreReserved(t *testing.T) {
+	rootDir := t.TempDir()
+	slot, err := AcquireSlot(rootDir, "itest", 1, AcquireOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Acquire(rootDir, "x.slots/0", AcquireOptions{}); !errors.Is(err, lockfile.ErrInvalidName) {
+		t.Errorf("Acquire(x.slots/0) error = %v, want ErrInvalidName", err)
+	}
+	if err := Release(rootDir, slot, ReleaseOptions{Force: true}); !errors.Is(err, lockfile.ErrInvalidName) {
+		t.Errorf("Release(%s, Force) error = %v, want ErrInvalidName", slot, err)
+	}
+	// Its holder releases it as any lock.
+	if err := Release(rootDir, slot, ReleaseOptions{}); err != nil {
+		t.Errorf("Release(%s) error = %v", slot, err)
+	}
+}
+
+func TestAcquireSlot_Frozen(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := Freeze(rootDir, "itest", FreezeOptions{TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := AcquireSlot(rootDir, "itest", 2, AcquireOptions{RespectFreeze: true})
+	var frozen *FrozenError
+	if !errors.As(err, &frozen) {
+		t.Errorf("AcquireSlot() on a frozen name = %v, want FrozenError", err)
+	}
+}
@@ -3,9 +3,8 @@
 package lock
 
 import (
-	"errors"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/nikolasavic/lokt/internal/audit"
 	"github.com/nikolasavic/lokt/internal/identity"
@@ -17,31 +16,37 @@ import (
 // EnvLoktNoSweep is the environment variable that disables opportunistic sweep.
 const EnvLoktNoSweep = "LOKT_NO_SWEEP"
 
-// PruneAllExpired scans the locks/ and freezes/ directories and removes any
-// lock that is definitively stale: expired TTL with dead PID on the same host,
+// PruneAllExpired scans the locks/ and freezes/ directories, and shared
+// holders, and removes any lock that is definitively stale: expired TTL with dead PID on the same host,
 // expired TTL on a cross-host lock (PID cannot be verified), or corrupted.
 // Dead PID alone does NOT trigger pruning — the lock/unlock scripting pattern
-// intentionally outlives the acquiring process.
+// intentionally outlives the acquiring process. A cross-host lock counts as
+// expired only once it is grace past its expiry, in case the clocks differ.
 // This is a best-effort operation — individual errors are collected but never
 // block the caller.
-func PruneAllExpired(rootDir string, auditor *audit.Writer) (int, []error) {
+func PruneAllExpired(rootDir string, auditor *audit.Writer, grace time.Duration) (int, []error) {
 	var total int
 	var errs []error
 
-	n, e := sweepDir(root.LocksPath(rootDir), rootDir, auditor)
+	n, e := sweepDir(rootDir, false, auditor, grace)
 	total += n
 	errs = append(errs, e...)
 
-	n, e = sweepDir(root.FreezesPath(rootDir), rootDir, auditor)
+	n, e = sweepDir(rootDir, true, auditor, grace)
+	total += n
+	errs = append(errs, e...)
+
+	n, e = sweepShared(rootDir, auditor, grace)
 	total += n
 	errs = append(errs, e...)
 
 	return total, errs
 }
 
-// sweepDir scans a single directory and removes stale .json lock files.
-func sweepDir(dir, rootDir string, auditor *audit.Writer) (int, []error) {
-	entries, err := os.ReadDir(dir)
+// sweepDir scans the locks (or, with freeze, the freezes) directory and
+// removes stale .json lock files.
+func sweepDir(rootDir string, freeze bool, auditor *audit.Writer, grace time.Duration) (int, []error) {
+	names, err := sweepNames(rootDir, freeze)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return 0, nil
@@ -53,29 +58,22 @@ func sweepDir(dir, rootDir string, auditor *audit.Writer) (int, []error) {
 	var pruned int
 	var errs []error
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		if !strings.HasSuffix(name, ".json") {
+	for _, lockName := range names {
+		path := sweepPath(rootDir, lockName, freeze)
+		reason, lf := checkStale(path, grace)
+		if reason == stale.ReasonNotStale {
 			continue
 		}
-		lockName := name[:len(name)-5]
 
-		path := dir + "/" + name
-		reason, lf := checkStale(path)
-		if reason == "" {
-			continue
+		removed, err := removeIfStill(path, reason, lf, func(path string) (stale.Reason, *lockfile.Lock) {
+			return checkStale(path, grace)
+		})
+		if err != nil {
+			errs = append(errs, err)
 		}
-
-		if err := os.Remove(path); err != nil {
-			if !os.IsNotExist(err) {
-				errs = append(errs, err)
-			}
-			continue
+		if !removed {
+			continue // renewed or replaced since it was read
 		}
-		_ = lockfile.SyncDir(path)
 		pruned++
 
 		emitSweepEvent(auditor, id, lockName, reason, lf)
@@ -84,58 +82,111 @@ func sweepDir(dir, rootDir string, auditor *audit.Writer) (int, []error) {
 	return pruned, errs
 }
 
-// checkStale reads a lock file and returns the stale reason (or "" if not stale).
+// sweepNames lists the locks, or with freeze the freezes, of rootDir.
+func sweepNames(rootDir string, freeze bool) ([]string, error) {
+	if freeze {
+		return root.Names(root.FreezesPath(rootDir))
+	}
+	return root.LockNames(rootDir)
+}
+
+// sweepPath returns the file of a name sweepNames listed.
+func sweepPath(rootDir, name string, freeze bool) string {
+	if freeze {
+		return root.FreezeFilePath(rootDir, name)
+	}
+	return root.LockFilePath(rootDir, name)
+}
+
+// Prunable is a lock or freeze PruneAllExpired would remove.
+type Prunable struct {
+	Name   string       `json:"name"`
+	Freeze bool         `json:"freeze,omitempty"`
+	Reason stale.Reason `json:"reason"`
+}
+
+// FindPrunable lists what PruneAllExpired would remove right now, without
+// removing anything or emitting events.
+func FindPrunable(rootDir string, grace time.Duration) []Prunable {
+	var out []Prunable
+	for _, freeze := range []bool{false, true} {
+		names, _ := sweepNames(rootDir, freeze)
+		for _, name := range names {
+			if reason, _ := checkStale(sweepPath(rootDir, name, freeze), grace); reason != stale.ReasonNotStale {
+				out = append(out, Prunable{Name: name, Freeze: freeze, Reason: reason})
+			}
+		}
+	}
+	return out
+}
+
+// checkStale reads a lock file and returns the stale reason (ReasonNotStale if
+// the sweep should leave it alone). Same-host prunes report the PID reason
+// (dead_pid or recycled_pid); expiry is implied since the sweep requires it.
 // Returns the lock for audit event emission; nil if the file was corrupted.
 //
 // The sweep is conservative: it requires BOTH expired TTL AND dead PID before
 // removing a same-host lock. Dead PID alone is not sufficient because the
 // lock/unlock scripting pattern intentionally outlives the acquiring process.
-// Cross-host expired locks are pruned since PID cannot be verified remotely.
-func checkStale(path string) (string, *lockfile.Lock) {
+// Cross-host expired locks are pruned since PID cannot be verified remotely,
+// once grace past their expiry.
+func checkStale(path string, grace time.Duration) (stale.Reason, *lockfile.Lock) {
 	lf, err := lockfile.Read(path)
 	if err != nil {
-		if errors.Is(err, lockfile.ErrCorrupted) {
-			return "corrupted", nil
+		if lockfile.Broken(err) {
+			return stale.ReasonCorrupted, nil
 		}
 		// Unsupported version, empty file, permission error — don't touch.
-		return "", nil
+		return stale.ReasonNotStale, nil
 	}
 
 	// Require expired TTL as minimum condition for sweep.
-	if !lf.IsExpired() {
-		return "", nil
+	hostname, _ := os.Hostname()
+	sameHost := hostname != "" && hostname == lf.Host
+	if sameHost {
+		grace = 0 // same clock
+	}
+	if !lf.ExpiredBeyond(grace) {
+		return stale.ReasonNotStale, nil
 	}
 
 	// Expired. On same host, also require dead PID.
-	hostname, _ := os.Hostname()
-	if hostname != "" && hostname == lf.Host {
+	if sameHost {
 		if stale.IsProcessAlive(lf.PID) {
 			// PID exists — check for recycling via start time.
 			if lf.PIDStartNS != 0 {
 				if start, err := stale.GetProcessStartTime(lf.PID); err == nil && start == lf.PIDStartNS {
-					return "", nil // Same process, still alive
+					return stale.ReasonNotStale, nil // Same process, still alive
 				}
 				// Different start time → PID recycled, original holder dead
-			} else {
-				return "", nil // Can't verify recycling, conservatively skip
+				return stale.ReasonRecycledPID, lf
 			}
+			return stale.ReasonNotStale, nil // Can't verify recycling, conservatively skip
 		}
-		// Dead or recycled PID + expired TTL → prune
-		return "expired+dead_pid", lf
+		// Dead PID + expired TTL → prune
+		return stale.ReasonDeadPID, lf
 	}
 
 	// Cross-host: can't verify PID; expired TTL alone justifies prune.
-	return string(stale.ReasonExpired), lf
+	return stale.ReasonExpired, lf
+}
+
+// sweepReason returns the legacy extra.sweep_reason value for a reason.
+// Kept for compatibility; new consumers should read extra.stale_reason.
+func sweepReason(r stale.Reason) string {
+	if r.HolderGone() {
+		return "expired+dead_pid"
+	}
+	return string(r)
 }
 
 // emitSweepEvent emits an auto-prune audit event for a swept lock.
-func emitSweepEvent(w *audit.Writer, id identity.Identity, name, reason string, lf *lockfile.Lock) {
+func emitSweepEvent(w *audit.Writer, id identity.Identity, name string, reason stale.Reason, lf *lockfile.Lock) {
 	if w == nil {
 		return
 	}
-	extra := map[string]any{
-		"sweep_reason": reason,
-	}
+	extra := staleReasonExtra(reason)
+	extra["sweep_reason"] = sweepReason(reason)
 	if lf != nil {
 		extra["pruned_owner"] = lf.Owner
 		extra["pruned_host"] = lf.Host
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -60,7 +61,7 @@ func readSweepAuditEvents(t *testing.T, rootDir string) []audit.Event {
 func TestSweep_EmptyDir(t *testing.T) {
 	rootDir := setupSweepRoot(t)
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0", pruned)
 	}
@@ -72,7 +73,7 @@ func TestSweep_EmptyDir(t *testing.T) {
 func TestSweep_NonExistentDir(t *testing.T) {
 	rootDir := t.TempDir() // no locks/ or freezes/ subdirs
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0", pruned)
 	}
@@ -98,7 +99,7 @@ func TestSweep_ExpiredTTL(t *testing.T) {
 	})
 
 	auditor := audit.NewWriter(rootDir)
-	pruned, errs := PruneAllExpired(rootDir, auditor)
+	pruned, errs := PruneAllExpired(rootDir, auditor, 0)
 	if pruned != 1 {
 		t.Errorf("pruned = %d, want 1", pruned)
 	}
@@ -124,6 +125,42 @@ func TestSweep_ExpiredTTL(t *testing.T) {
 	}
 }
 
+func TestSweep_CrossHostSkewGrace(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	locksDir := filepath.Join(rootDir, "locks")
+
+	// other-host's clock is 10s behind ours: its lock still has time left
+	// by its own clock but looks expired by ours.
+	skewed := time.Now().Add(-10 * time.Second)
+	writeLock(t, locksDir, "skewed", &lockfile.Lock{
+		Version: 1, Name: "skewed", Owner: "other", Host: "other-host", PID: 12345,
+		AcquiredAt: skewed.Add(-time.Minute), TTLSec: 60, ExpiresAt: &skewed,
+	})
+	long := time.Now().Add(-2 * time.Minute)
+	writeLock(t, locksDir, "expired", &lockfile.Lock{
+		Version: 1, Name: "expired", Owner: "other", Host: "other-host", PID: 12345,
+		AcquiredAt: long.Add(-time.Minute), TTLSec: 60, ExpiresAt: &long,
+	})
+
+	if got := FindPrunable(rootDir, 30*time.Second); len(got) != 1 || got[0].Name != "expired" {
+		t.Errorf("FindPrunable() = %+v, want only expired", got)
+	}
+	pruned, errs := PruneAllExpired(rootDir, nil, 30*time.Second)
+	if pruned != 1 || len(errs) != 0 {
+		t.Fatalf("pruned = %d, errs = %v; want 1 and none", pruned, errs)
+	}
+	if _, err := os.Stat(filepath.Join(locksDir, "skewed.json")); err != nil {
+		t.Errorf("lock within the skew grace was pruned: %v", err)
+	}
+
+	if tryBreakStale(rootDir, "skewed", nil, 30*time.Second) {
+		t.Error("tryBreakStale() broke a lock within the skew grace")
+	}
+	if !tryBreakStale(rootDir, "skewed", nil, 0) {
+		t.Error("tryBreakStale() without grace should break the expired lock")
+	}
+}
+
 func TestSweep_DeadPID_SameHost_NoTTL_Untouched(t *testing.T) {
 	rootDir := setupSweepRoot(t)
 	locksDir := filepath.Join(rootDir, "locks")
@@ -138,7 +175,7 @@ func TestSweep_DeadPID_SameHost_NoTTL_Untouched(t *testing.T) {
 		AcquiredAt: time.Now(),
 	})
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0 (dead PID alone should not trigger sweep)", pruned)
 	}
@@ -170,7 +207,7 @@ func TestSweep_ExpiredTTL_DeadPID_SameHost(t *testing.T) {
 	})
 
 	auditor := audit.NewWriter(rootDir)
-	pruned, errs := PruneAllExpired(rootDir, auditor)
+	pruned, errs := PruneAllExpired(rootDir, auditor, 0)
 	if pruned != 1 {
 		t.Errorf("pruned = %d, want 1", pruned)
 	}
@@ -208,7 +245,7 @@ func TestSweep_ExpiredTTL_LivePID_SameHost_Untouched(t *testing.T) {
 		ExpiresAt:  &expired,
 	})
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0 (expired but alive PID should not be swept)", pruned)
 	}
@@ -235,7 +272,7 @@ func TestSweep_LiveLock_Untouched(t *testing.T) {
 		AcquiredAt: time.Now(),
 	})
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0", pruned)
 	}
@@ -263,7 +300,7 @@ func TestSweep_CrossHost_NoTTL_Untouched(t *testing.T) {
 		// No TTL — intentionally permanent
 	})
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0", pruned)
 	}
@@ -276,6 +313,57 @@ func TestSweep_CrossHost_NoTTL_Untouched(t *testing.T) {
 	}
 }
 
+func TestSweep_RaceWithRenewal(t *testing.T) {
+	rootDir := setupSweepRoot(t)
+	locksDir := filepath.Join(rootDir, "locks")
+	path := filepath.Join(locksDir, "build.json")
+	past := time.Now().Add(-time.Minute)
+	lk := &lockfile.Lock{
+		Version: 1, Name: "build", LockID: "live", Owner: "other", Host: "other-host", PID: 12345,
+		AcquiredAt: past.Add(-time.Minute), TTLSec: 60, ExpiresAt: &past,
+	}
+
+	// Each round the lock has just expired when its holder renews it,
+	// while sweeps and waiters keep trying to break it. However they
+	// interleave, the renewal must survive.
+	for i := range 100 {
+		writeLock(t, locksDir, "build", lk)
+		renewed := *lk
+		exp := time.Now().Add(time.Minute)
+		renewed.ExpiresAt = &exp
+		// Renew writes a temp file and renames it over the lock; only the
+		// rename races, so have the file ready.
+		writeLock(t, locksDir, "renewed", &renewed)
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, _ = PruneAllExpired(rootDir, nil, 0)
+				_ = tryBreakStale(rootDir, "build", nil, 0)
+			}
+		}()
+		time.Sleep(time.Duration(i%20) * 10 * time.Microsecond)
+		if err := os.Rename(filepath.Join(locksDir, "renewed.json"), path); err != nil {
+			t.Fatal(err)
+		}
+		close(stop)
+		wg.Wait()
+
+		lf, err := lockfile.Read(path)
+		if err != nil || !lf.ExpiresAt.Equal(exp) {
+			t.Fatalf("round %d: lock after renewal = %+v, %v; the renewed lock was lost", i, lf, err)
+		}
+	}
+}
+
 func TestSweep_CorruptedFile(t *testing.T) {
 	rootDir := setupSweepRoot(t)
 	locksDir := filepath.Join(rootDir, "locks")
@@ -286,7 +374,7 @@ func TestSweep_CorruptedFile(t *testing.T) {
 	}
 
 	auditor := audit.NewWriter(rootDir)
-	pruned, errs := PruneAllExpired(rootDir, auditor)
+	pruned, errs := PruneAllExpired(rootDir, auditor, 0)
 	if pruned != 1 {
 		t.Errorf("pruned = %d, want 1", pruned)
 	}
@@ -314,7 +402,7 @@ func TestSweep_UnsupportedVersion_Untouched(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0", pruned)
 	}
@@ -343,7 +431,7 @@ func TestSweep_ExpiredFreeze(t *testing.T) {
 		ExpiresAt:  &expired,
 	})
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 1 {
 		t.Errorf("pruned = %d, want 1", pruned)
 	}
@@ -401,7 +489,7 @@ func TestSweep_MixedDirectory(t *testing.T) {
 		AcquiredAt: time.Now(),
 	})
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 1 {
 		t.Errorf("pruned = %d, want 1 (only expired cross-host lock)", pruned)
 	}
@@ -434,7 +522,7 @@ func TestSweep_NonJSONFiles_Skipped(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0", pruned)
 	}
@@ -452,7 +540,7 @@ func TestSweep_EmptyFile_Skipped(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	pruned, errs := PruneAllExpired(rootDir, nil)
+	pruned, errs := PruneAllExpired(rootDir, nil, 0)
 	if pruned != 0 {
 		t.Errorf("pruned = %d, want 0 (empty file should be skipped)", pruned)
 	}
@@ -483,7 +571,7 @@ func TestSweep_AuditEvents_IncludeHolderInfo(t *testing.T) {
 	})
 
 	auditor := audit.NewWriter(rootDir)
-	pruned, _ := PruneAllExpired(rootDir, auditor)
+	pruned, _ := PruneAllExpired(rootDir, auditor, 0)
 	if pruned != 1 {
 		t.Fatalf("pruned = %d, want 1", pruned)
 	}
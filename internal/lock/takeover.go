@@ -0,0 +1,179 @@
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// ErrHolderChanged is returned by AcquireIfHeldBy when the lock isn't held
+// by the owner it was to be taken from.
+var ErrHolderChanged = errors.New("lock holder changed")
+
+// HolderChangedError names who holds the lock instead of the expected owner.
+type HolderChangedError struct {
+	Lock     *lockfile.Lock
+	Expected string
+}
+
+func (e *HolderChangedError) Error() string {
+	return fmt.Sprintf("lock %q is held by %s@%s (pid %d, lock_id %s), not %s",
+		e.Lock.Name, e.Lock.Owner, e.Lock.Host, e.Lock.PID, e.Lock.LockID, e.Expected)
+}
+
+func (e *HolderChangedError) Unwrap() error {
+	return ErrHolderChanged
+}
+
+// TakeoverOptions configures AcquireIfHeldBy. The acquisition is made with
+// AcquireOptions, of which Shared and ExclusionGroups don't apply.
+type TakeoverOptions struct {
+	AcquireOptions
+	// Force takes the lock over from a holder that isn't stale.
+	Force bool
+}
+
+// Injectable for testing the races: called after the lock has been judged,
+// before the replacement is written.
+var takeoverJudgedHook = func() {}
+
+// AcquireIfHeldBy takes name over from expectedOwner, for failover: it
+// succeeds only while expectedOwner holds the lock and the hold is stale
+// (or opts.Force is set), so it never stomps on whoever recovered the lock
+// first. The new lock is written to a temporary file and renamed over the
+// old one after a last re-read confirms the same acquisition is still in
+// place, then read back to confirm the rename won. A takeover event records
+// both holders.
+//
+// Returns a *FrozenError if opts.RespectFreeze is set and name is frozen, a
+// *ReservedError if the hold would overlap another owner's reservation,
+// an error wrapping ErrNotFound if the lock isn't held, a
+// *HolderChangedError if someone else holds it (including a new
+// acquisition by expectedOwner), a *NotStaleError if it isn't stale and
+// Force is unset, and a *HeldError if another process replaced the lock in
+// the instant between the last check and the rename.
+func AcquireIfHeldBy(rootDir, name, expectedOwner string, opts TakeoverOptions) error {
+	if err := lockfile.ValidateName(name); err != nil {
+		return err
+	}
+	if expectedOwner == "" {
+		return errors.New("takeover needs the expected owner")
+	}
+	ao := opts.AcquireOptions
+	ao.Message = lockfile.CleanMessage(ao.Message)
+	labels, err := lockfile.CleanLabels(ao.Labels)
+	if err != nil {
+		return err
+	}
+	ao.Labels = labels
+	if ao.Session != "" {
+		if err := ValidateSessionID(ao.Session); err != nil {
+			return err
+		}
+	}
+	rootDir, err = root.Follow(rootDir)
+	if err != nil {
+		return err
+	}
+	if err := root.EnsureDirs(rootDir); err != nil {
+		return ensureDirsError(rootDir, err)
+	}
+	if ao.TTL, err = policyTTL(rootDir, name, ao.TTL); err != nil {
+		return err
+	}
+	if ao.RespectFreeze {
+		if err := CheckFreeze(rootDir, name, ao.Auditor); err != nil {
+			return err
+		}
+	}
+	if err := checkReservations(rootDir, name, identity.Current(), ao.TTL, ao.SkewGrace, ao.Auditor); err != nil {
+		return err
+	}
+
+	path := root.LockFilePath(rootDir, name)
+	prev, err := lockfile.Read(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%w: %q isn't held, there is nothing to take over", ErrNotFound, name)
+	case err != nil:
+		return fmt.Errorf("read lock: %w", err)
+	case prev.Owner != expectedOwner:
+		return &HolderChangedError{Lock: prev, Expected: expectedOwner}
+	}
+	reason := stale.ReasonNotStale
+	if result := stale.CheckFile(path, prev, ao.SkewGrace); result.Stale {
+		reason = result.Reason
+	} else if !opts.Force {
+		return &NotStaleError{Lock: prev, Reason: result.Reason}
+	}
+	takeoverJudgedHook()
+
+	id := identity.Current()
+	lock := newLock(name, id, ao)
+	err = lockfile.Replace(path, lock, func() error {
+		cur, err := lockfile.Read(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return fmt.Errorf("%w: %q was released before it could be taken over", ErrNotFound, name)
+		case err != nil:
+			return fmt.Errorf("read lock: %w", err)
+		case cur.LockID != prev.LockID || cur.Owner != prev.Owner:
+			return &HolderChangedError{Lock: cur, Expected: expectedOwner}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if got, err := lockfile.Read(path); err != nil || got.LockID != lock.LockID {
+		if err != nil {
+			return fmt.Errorf("read back lock: %w", err)
+		}
+		return &HeldError{Lock: got, RetryAfter: RetryAfter(got, ao.RetryAfterDefault)}
+	}
+
+	takeFlock(path, lock)
+	if prev.Session != "" {
+		deregisterSession(rootDir, prev.Session, name)
+	}
+	if lock.Session != "" {
+		registerSession(rootDir, lock.Session, name, id)
+	}
+	emitTakeoverEvent(ao.Auditor, id, lock, prev, reason, opts.Force)
+	return nil
+}
+
+// emitTakeoverEvent records that lk replaced prev. Safe to call with nil
+// auditor.
+func emitTakeoverEvent(w *audit.Writer, id identity.Identity, lk, prev *lockfile.Lock, reason stale.Reason, forced bool) {
+	if w == nil {
+		return
+	}
+	extra := map[string]any{
+		"previous_owner":   prev.Owner,
+		"previous_host":    prev.Host,
+		"previous_pid":     prev.PID,
+		"previous_lock_id": prev.LockID,
+		"forced":           forced,
+	}
+	if reason != stale.ReasonNotStale {
+		extra["stale_reason"] = string(reason)
+	}
+	w.Emit(&audit.Event{
+		Event:   audit.EventTakeover,
+		Name:    lk.Name,
+		LockID:  lk.LockID,
+		Owner:   id.Owner,
+		Host:    id.Host,
+		PID:     id.PID,
+		AgentID: id.AgentID,
+		TTLSec:  lk.TTLSec,
+		Extra:   extra,
+	})
+}
@@ -0,0 +1,161 @@
+package lock
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// plantHolder writes name's lock as held by owner, expired if expired.
+func plantHolder(t *testing.T, rootDir, name, owner, lockID string, expired bool) {
+	t.Helper()
+	lf := &lockfile.Lock{
+		Version: 1, Name: name, LockID: lockID, Owner: owner, Host: "other-host", PID: 99999,
+		AcquiredAt: time.Now().Add(-time.Hour), TTLSec: 60,
+	}
+	exp := time.Now().Add(time.Minute)
+	if expired {
+		exp = time.Now().Add(-time.Minute)
+	}
+	lf.ExpiresAt = &exp
+	if err := root.EnsureDirs(rootDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(root.LockFilePath(rootDir, name), lf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// onJudged runs fn in the window between judging the lock and replacing it.
+func onJudged(t *testing.T, fn func()) {
+	t.Helper()
+	takeoverJudgedHook = fn
+	t.Cleanup(func() { takeoverJudgedHook = func() {} })
+}
+
+func TestAcquireIfHeldBy_Stale(t *testing.T) {
+	rootDir := t.TempDir()
+	plantHolder(t, rootDir, "deploy", "agent-a", "a-id", true)
+
+	err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", TakeoverOptions{
+		AcquireOptions: AcquireOptions{TTL: time.Minute, Auditor: audit.NewWriter(rootDir)},
+	})
+	if err != nil {
+		t.Fatalf("AcquireIfHeldBy() error = %v", err)
+	}
+	lf, err := lockfile.Read(root.LockFilePath(rootDir, "deploy"))
+	if err != nil || lf.Owner != identity.Current().Owner || lf.LockID == "a-id" || lf.TTLSec != 60 {
+		t.Fatalf("lock after takeover = %+v, %v", lf, err)
+	}
+	events := readAuditEvents(t, rootDir)
+	if len(events) != 1 || events[0].Event != audit.EventTakeover || events[0].LockID != lf.LockID ||
+		events[0].Extra["previous_owner"] != "agent-a" || events[0].Extra["previous_lock_id"] != "a-id" ||
+		events[0].Extra["stale_reason"] != "expired" {
+		t.Errorf("audit events = %+v, want one takeover naming agent-a", events)
+	}
+}
+
+func TestAcquireIfHeldBy_Refusals(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", TakeoverOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("not held: error = %v, want ErrNotFound", err)
+	}
+
+	plantHolder(t, rootDir, "deploy", "agent-c", "c-id", true)
+	var changed *HolderChangedError
+	if err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", TakeoverOptions{}); !errors.As(err, &changed) || changed.Lock.Owner != "agent-c" {
+		t.Errorf("held by another: error = %v, want HolderChangedError naming agent-c", err)
+	}
+
+	plantHolder(t, rootDir, "deploy", "agent-a", "a-id", false)
+	var notStale *NotStaleError
+	if err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", TakeoverOptions{}); !errors.As(err, &notStale) {
+		t.Errorf("live holder: error = %v, want NotStaleError", err)
+	}
+	if err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", TakeoverOptions{Force: true}); err != nil {
+		t.Errorf("live holder with Force: error = %v", err)
+	}
+}
+
+func TestAcquireIfHeldBy_RespectFreeze(t *testing.T) {
+	rootDir := t.TempDir()
+	plantHolder(t, rootDir, "deploy", "agent-a", "a-id", true)
+	if err := Freeze(rootDir, "deploy", FreezeOptions{TTL: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := TakeoverOptions{AcquireOptions: AcquireOptions{RespectFreeze: true}}
+	if err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", opts); !errors.Is(err, ErrFrozen) {
+		t.Fatalf("frozen: error = %v, want ErrFrozen", err)
+	}
+	if lf, err := lockfile.Read(root.LockFilePath(rootDir, "deploy")); err != nil || lf.LockID != "a-id" {
+		t.Errorf("lock after a refused takeover = %+v, %v; want agent-a's", lf, err)
+	}
+	// Without RespectFreeze the freeze doesn't stop it, as with Acquire.
+	if err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", TakeoverOptions{}); err != nil {
+		t.Errorf("frozen, not respected: error = %v", err)
+	}
+}
+
+func TestAcquireIfHeldBy_Reserved(t *testing.T) {
+	rootDir := t.TempDir()
+	plantHolder(t, rootDir, "deploy", "agent-a", "a-id", true)
+	reserveFor(t, rootDir, "deploy", "alice", 0, time.Hour)
+
+	t.Setenv("LOKT_OWNER", "bob")
+	if err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", TakeoverOptions{Force: true}); !errors.Is(err, ErrReserved) {
+		t.Fatalf("reserved for another: error = %v, want ErrReserved", err)
+	}
+	if lf, err := lockfile.Read(root.LockFilePath(rootDir, "deploy")); err != nil || lf.LockID != "a-id" {
+		t.Errorf("lock after a refused takeover = %+v, %v; want agent-a's", lf, err)
+	}
+	t.Setenv("LOKT_OWNER", "alice")
+	if err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", TakeoverOptions{}); err != nil {
+		t.Errorf("by the reservation's owner: error = %v", err)
+	}
+}
+
+func TestAcquireIfHeldBy_ReleasedInBetween(t *testing.T) {
+	rootDir := t.TempDir()
+	plantHolder(t, rootDir, "deploy", "agent-a", "a-id", true)
+	onJudged(t, func() {
+		if err := os.Remove(root.LockFilePath(rootDir, "deploy")); err != nil {
+			t.Error(err)
+		}
+	})
+
+	err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", TakeoverOptions{})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("AcquireIfHeldBy() error = %v, want ErrNotFound", err)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "deploy")); !os.IsNotExist(err) {
+		t.Error("a takeover of a released lock must not acquire it")
+	}
+}
+
+func TestAcquireIfHeldBy_RecoveredInBetween(t *testing.T) {
+	rootDir := t.TempDir()
+	plantHolder(t, rootDir, "deploy", "agent-a", "a-id", true)
+	// agent-a's lock is released and agent-c recovers it meanwhile
+	onJudged(t, func() { plantHolder(t, rootDir, "deploy", "agent-c", "c-id", false) })
+
+	var changed *HolderChangedError
+	if err := AcquireIfHeldBy(rootDir, "deploy", "agent-a", TakeoverOptions{}); !errors.As(err, &changed) {
+		t.Fatalf("AcquireIfHeldBy() error = %v, want HolderChangedError", err)
+	}
+	lf, err := lockfile.Read(root.LockFilePath(rootDir, "deploy"))
+	if err != nil || lf.LockID != "c-id" {
+		t.Errorf("agent-c's lock must survive: %+v, %v", lf, err)
+	}
+	// So must a new acquisition by the same owner
+	onJudged(t, func() { plantHolder(t, rootDir, "deploy", "agent-c", "c-id-2", true) })
+	if err := AcquireIfHeldBy(rootDir, "deploy", "agent-c", TakeoverOptions{Force: true}); !errors.As(err, &changed) {
+		t.Errorf("re-acquired by the expected owner: error = %v, want HolderChangedError", err)
+	}
+}
@@ -0,0 +1,92 @@
+package lock
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// Waiter markers let AcquireWithWait see how crowded a lock is. Each waiter
+// keeps an empty file in <root>/waiters/<name>/ and refreshes its mtime on
+// every poll; markers not refreshed within waiterFresh are ignored, and ones
+// older than waiterAbandoned (crashed waiters) are removed when counted.
+const (
+	waiterFresh     = 30 * time.Second // > AdaptiveMaxCeiling with jitter
+	waiterAbandoned = 10 * time.Minute
+	// waiterRecount is how many polls pass between waiter counts, so
+	// counting doesn't add a directory read to every poll.
+	waiterRecount = 4
+)
+
+// waiter is one process's registration in a lock's waiter directory.
+type waiter struct {
+	dir  string
+	path string
+}
+
+// registerWaiter creates this process's marker for name.
+func registerWaiter(rootDir, name string) (*waiter, error) {
+	dir := root.WaiterDirPath(rootDir, name)
+	if err := root.MkdirAll(rootDir, dir); err != nil {
+		return nil, err
+	}
+	id := identity.Current()
+	path := filepath.Join(dir, fmt.Sprintf("%s.%d.%d", id.Host, id.PID, time.Now().UnixNano()))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) //nolint:gosec // G304: path is controlled
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return &waiter{dir: dir, path: path}, nil
+}
+
+// touch marks the waiter as still alive. Errors are ignored: a missing
+// refresh only makes this waiter invisible to others.
+func (w *waiter) touch() {
+	now := time.Now()
+	_ = os.Chtimes(w.path, now, now)
+}
+
+// remove deregisters the waiter.
+func (w *waiter) remove() {
+	_ = os.Remove(w.path)
+}
+
+// others counts live waiters for the same lock, excluding this one.
+func (w *waiter) others() int {
+	return countWaiters(w.dir, w.path, time.Now())
+}
+
+// countWaiters counts markers in dir refreshed within waiterFresh of now,
+// skipping self, and removes abandoned ones.
+func countWaiters(dir, self string, now time.Time) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		if path == self || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue // removed since ReadDir
+		}
+		switch age := now.Sub(info.ModTime()); {
+		case age <= waiterFresh:
+			n++
+		case age > waiterAbandoned:
+			_ = os.Remove(path)
+		}
+	}
+	return n
+}
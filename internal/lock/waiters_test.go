@@ -0,0 +1,173 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// plantWaiters creates n waiter markers for name with the given mtime.
+func plantWaiters(t *testing.T, rootDir, name string, n int, mtime time.Time) {
+	t.Helper()
+	dir := root.WaiterDirPath(rootDir, name)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("planted-%s.%d", mtime.Format("150405"), i))
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRetryPolicy_Adapt(t *testing.T) {
+	tests := []struct {
+		others int
+		want   time.Duration // cap after adapting the default 2s policy
+	}{
+		{0, 2 * time.Second},
+		{AdaptiveThreshold, 2 * time.Second},
+		{8, 4 * time.Second},
+		{20, 10 * time.Second},
+		{29, 14500 * time.Millisecond},
+		{100, AdaptiveMaxCeiling},
+	}
+	for _, tt := range tests {
+		p := RetryPolicy{}.Adapt(tt.others)
+		if p.Max != tt.want {
+			t.Errorf("Adapt(%d).Max = %v, want %v", tt.others, p.Max, tt.want)
+		}
+		if p.Base != DefaultRetryPolicy.Base {
+			t.Errorf("Adapt(%d) changed Base to %v", tt.others, p.Base)
+		}
+	}
+
+	// A cap already above the ceiling is left alone.
+	if p := (RetryPolicy{Base: time.Second, Max: time.Minute}).Adapt(100); p.Max != time.Minute {
+		t.Errorf("Adapt lowered a large cap to %v", p.Max)
+	}
+}
+
+func TestAdaptiveIntervals_PlantedWaiters(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		fresh, stale int
+		want         time.Duration // steady-state interval, no jitter
+	}{
+		{0, 0, 2 * time.Second},
+		{4, 20, 2 * time.Second}, // stale markers don't count
+		{8, 0, 4 * time.Second},
+		{30, 0, AdaptiveMaxCeiling},
+	}
+	for _, tt := range tests {
+		rootDir := t.TempDir()
+		plantWaiters(t, rootDir, "hot", tt.fresh, now)
+		plantWaiters(t, rootDir, "hot", tt.stale, now.Add(-2*waiterFresh))
+
+		self, err := registerWaiter(rootDir, "hot")
+		if err != nil {
+			t.Fatal(err)
+		}
+		others := self.others()
+		if others != tt.fresh {
+			t.Errorf("fresh=%d stale=%d: counted %d others", tt.fresh, tt.stale, others)
+		}
+		p := RetryPolicy{Rand: fixedRand(0.5)}.Adapt(others)
+		if got := p.Interval(100); got != tt.want {
+			t.Errorf("fresh=%d: steady interval = %v, want %v", tt.fresh, got, tt.want)
+		}
+		// Early attempts keep the normal fast start.
+		if got := p.Interval(0); got != DefaultRetryPolicy.Base {
+			t.Errorf("fresh=%d: first interval = %v, want %v", tt.fresh, got, DefaultRetryPolicy.Base)
+		}
+		self.remove()
+	}
+}
+
+func TestCountWaiters_RemovesAbandoned(t *testing.T) {
+	rootDir := t.TempDir()
+	now := time.Now()
+	plantWaiters(t, rootDir, "hot", 3, now.Add(-2*waiterAbandoned))
+	plantWaiters(t, rootDir, "hot", 2, now)
+
+	dir := root.WaiterDirPath(rootDir, "hot")
+	if n := countWaiters(dir, "", now); n != 2 {
+		t.Errorf("countWaiters() = %d, want 2", n)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("abandoned markers should be removed, %d entries left", len(entries))
+	}
+}
+
+func TestAcquireWithWait_AdaptiveHonorsTimeout(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootDir, "locks"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(root.LockFilePath(rootDir, "hot"), &lockfile.Lock{
+		Version: 1, Name: "hot", Owner: "other-owner", Host: "other-host", PID: os.Getpid(), AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// A crowd big enough to stretch the cap to the 15s ceiling.
+	plantWaiters(t, rootDir, "hot", 100, time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := AcquireWithWait(ctx, rootDir, "hot", AcquireOptions{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AcquireWithWait() = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("adaptive backoff overran the timeout: waited %v", elapsed)
+	}
+
+	entries, _ := os.ReadDir(root.WaiterDirPath(rootDir, "hot"))
+	if len(entries) != 100 {
+		t.Errorf("waiter should remove its own marker on return, %d entries left", len(entries))
+	}
+}
+
+func TestAcquireWithWait_NoAdaptive(t *testing.T) {
+	rootDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootDir, "locks"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(root.LockFilePath(rootDir, "hot"), &lockfile.Lock{
+		Version: 1, Name: "hot", Owner: "other-owner", Host: "other-host", PID: os.Getpid(), AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	plantWaiters(t, rootDir, "hot", 100, time.Now())
+
+	polls := 0
+	opts := AcquireOptions{NoAdaptive: true, Retry: RetryPolicy{
+		Base: time.Millisecond, Max: time.Millisecond, Spread: 0.25,
+		Rand: func() float64 { polls++; return 0.5 },
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_ = AcquireWithWait(ctx, rootDir, "hot", opts)
+
+	// Adapted, the 1ms cap would stretch to 25ms and allow only a few polls.
+	if polls < 10 {
+		t.Errorf("--no-adaptive should keep the 1ms cap despite the crowd, got %d polls", polls)
+	}
+	entries, _ := os.ReadDir(root.WaiterDirPath(rootDir, "hot"))
+	if len(entries) != 100 {
+		t.Errorf("NoAdaptive waiters should not register a marker, %d entries", len(entries))
+	}
+}
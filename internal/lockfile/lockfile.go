@@ -2,19 +2,25 @@
 package lockfile
 
 import (
+	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 )
 
-// CurrentLockfileVersion is the schema version written to all new lock files.
+// CurrentLockfileVersion is the newest schema version this lokt reads and
+// writes. New lock files get WriteVersion, which is this one unless
+// SetWriteVersion picked an older one.
 const CurrentLockfileVersion = 1
 
 // Injectable functions for testability.
@@ -25,17 +31,58 @@ var (
 
 // Lock represents the JSON structure of a lock file.
 type Lock struct {
-	Version    int        `json:"version"`
-	Name       string     `json:"name"`
-	LockID     string     `json:"lock_id,omitempty"`
-	Owner      string     `json:"owner"`
-	Host       string     `json:"host"`
-	PID        int        `json:"pid"`
-	PIDStartNS int64      `json:"pid_start_ns,omitempty"`
-	AgentID    string     `json:"agent_id,omitempty"`
-	AcquiredAt time.Time  `json:"acquired_ts"`
-	TTLSec     int        `json:"ttl_sec,omitempty"`
-	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Version    int    `json:"version"`
+	Name       string `json:"name"`
+	LockID     string `json:"lock_id,omitempty"`
+	Owner      string `json:"owner"`
+	Host       string `json:"host"`
+	PID        int    `json:"pid"`
+	PIDStartNS int64  `json:"pid_start_ns,omitempty"`
+	AgentID    string `json:"agent_id,omitempty"`
+	// AgentExplicit marks an AgentID set with LOKT_AGENT_ID (an agent
+	// session) rather than generated for the process. Only the same agent
+	// then re-acquires the lock (see lock.SameHolder).
+	AgentExplicit bool       `json:"agent_explicit,omitempty"`
+	AcquiredAt    time.Time  `json:"acquired_ts"`
+	TTLSec        int        `json:"ttl_sec,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	// RenewedAt is when the lock was last renewed (lokt renew, a guard's
+	// heartbeat); nil if it never was. A renewal also restarts AcquiredAt,
+	// the base of the TTL, so this only tells a renewed lock apart and
+	// shows a wedged heartbeat as an old renewal.
+	RenewedAt *time.Time `json:"renewed_ts,omitempty"`
+	// Retained marks a lock kept after its guard exited (guard --no-release),
+	// or handed off to a process yet to adopt it (lock --handoff).
+	// The holder PID is gone by design, so liveness isn't checked; the lock
+	// lasts until unlocked, re-acquired by its owner, or its TTL runs out.
+	Retained bool `json:"retained,omitempty"`
+	// Flock marks a holder that keeps an advisory flock(2) on this file
+	// while it runs (guard --flock). On the holder's host, a held flock
+	// means the lock is live even past its TTL; no flock proves nothing,
+	// since the holder takes it again after each rewrite of the file.
+	Flock bool `json:"flock,omitempty"`
+	// Mode is "shared" for one holder of a shared (read) lock; empty for
+	// an exclusive lock.
+	Mode string `json:"mode,omitempty"`
+	// Message says what the holder is doing (lock --message), and Labels
+	// are key=value pairs for tooling (lock --label). See CleanMessage
+	// and CleanLabels for their limits.
+	Message string            `json:"message,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	// Session is the session the holder registered the lock in
+	// (LOKT_SESSION; see lock.EndSession).
+	Session string `json:"session,omitempty"`
+	// Path is the cleaned absolute path of the file a name from
+	// lock.NameForPath stands for (lock --for-path).
+	Path string `json:"path,omitempty"`
+	// Pattern marks a pattern freeze (freeze --match): Name is then a
+	// path.Match pattern (see ValidatePattern) and the freeze covers every
+	// lock name it matches.
+	Pattern bool `json:"pattern,omitempty"`
+	// Signature is the hex HMAC-SHA256 of the rest of the lock, set by
+	// Write and Replace while signing keys are configured (see SetKeys)
+	// and checked by Read.
+	Signature string `json:"sig,omitempty"`
 }
 
 // GenerateLockID returns a 32-character random hex string for use as a lock
@@ -50,37 +97,41 @@ func GenerateLockID() string {
 	return hex.EncodeToString(b)
 }
 
-// IsExpired returns true if the lock has a TTL and it has elapsed.
-// Prefers the explicit ExpiresAt timestamp when present; falls back to
-// TTLSec arithmetic for lockfiles written before the expires_at field existed.
-func (l *Lock) IsExpired() bool {
+// Expiry returns when the lock expires and false if it has no TTL. The
+// ExpiresAt written at acquire and renew is authoritative; AcquiredAt +
+// TTLSec is only a fallback for lockfiles from before expires_at existed.
+func (l *Lock) Expiry() (time.Time, bool) {
 	if l.ExpiresAt != nil {
-		return time.Now().After(*l.ExpiresAt)
+		return *l.ExpiresAt, true
 	}
 	if l.TTLSec <= 0 {
-		return false
+		return time.Time{}, false
 	}
-	return time.Since(l.AcquiredAt) > time.Duration(l.TTLSec)*time.Second
+	return l.AcquiredAt.Add(time.Duration(l.TTLSec) * time.Second), true
+}
+
+// IsExpired returns true if the lock has a TTL and it has elapsed.
+func (l *Lock) IsExpired() bool {
+	return l.ExpiredBeyond(0)
+}
+
+// ExpiredBeyond reports whether the lock expired more than grace ago by
+// this host's clock. Decisions to break another host's lock use a grace
+// so that clock skew between the hosts can't make a live lock look
+// expired.
+func (l *Lock) ExpiredBeyond(grace time.Duration) bool {
+	exp, ok := l.Expiry()
+	return ok && time.Now().After(exp.Add(grace))
 }
 
 // Remaining returns the duration until the lock expires.
 // Returns zero if the lock has no TTL, is already expired, or has no expiry info.
 func (l *Lock) Remaining() time.Duration {
-	if l.ExpiresAt != nil {
-		rem := time.Until(*l.ExpiresAt)
-		if rem < 0 {
-			return 0
-		}
-		return rem
-	}
-	if l.TTLSec <= 0 {
-		return 0
-	}
-	rem := time.Duration(l.TTLSec)*time.Second - time.Since(l.AcquiredAt)
-	if rem < 0 {
+	exp, ok := l.Expiry()
+	if !ok {
 		return 0
 	}
-	return rem
+	return max(time.Until(exp), 0)
 }
 
 // Age returns the duration since the lock was acquired.
@@ -88,26 +139,96 @@ func (l *Lock) Age() time.Duration {
 	return time.Since(l.AcquiredAt)
 }
 
+// SameAcquisition reports whether l and o record the same acquisition: the
+// same lock_id, or without one (older lokt), the same acquired_ts. A
+// renewal keeps the acquisition; a new holder or re-acquire doesn't.
+func (l *Lock) SameAcquisition(o *Lock) bool {
+	if l.LockID != "" || o.LockID != "" {
+		return l.LockID == o.LockID
+	}
+	return l.AcquiredAt.Equal(o.AcquiredAt)
+}
+
 // ErrInvalidName is returned when a lock name fails validation.
 var ErrInvalidName = errors.New("invalid lock name")
 
+// ErrInvalidPattern is returned when a freeze pattern fails validation.
+var ErrInvalidPattern = errors.New("invalid pattern")
+
 // ErrCorrupted is returned when a lock file exists but contains malformed JSON.
 var ErrCorrupted = errors.New("corrupted lock file")
 
 // ErrUnsupportedVersion is returned when a lock file has a version newer than this binary supports.
 var ErrUnsupportedVersion = errors.New("unsupported lockfile version")
 
-// validNamePattern matches allowed lock name characters: alphanumeric, dots, hyphens, underscores.
+// ErrInvalidSchema is returned when a lock file is JSON but not a lock: a
+// required field (name, pid, acquired_ts) is missing or out of range, or,
+// with ReadOptions.Strict, a field is unknown. Unlike ErrCorrupted it may
+// be the work of a foreign tool rather than a torn write; see Broken.
+var ErrInvalidSchema = errors.New("invalid lock file schema")
+
+// MaxFileSize is the largest lock file Read accepts. Lock files are well
+// under 1KB; a larger file is classified ErrCorrupted without being read
+// into memory, so a stray multi-GB file can't exhaust status or sweeps.
+const MaxFileSize = 64 << 10
+
+// Broken reports whether err, from Read or Parse, means the file names no
+// holder at all (ErrCorrupted or ErrInvalidSchema), so that whoever wants
+// the lock may remove it. An empty file, which may be mid-write, isn't
+// broken.
+func Broken(err error) bool {
+	return errors.Is(err, ErrCorrupted) || errors.Is(err, ErrInvalidSchema)
+}
+
+// ReadOptions configures ReadWithOptions and ParseWithOptions.
+type ReadOptions struct {
+	// Strict rejects fields this version of lokt doesn't know with
+	// ErrInvalidSchema. Off by default, since a newer lokt may add fields
+	// without raising the version.
+	Strict bool
+	// NoVerify reads a lock file whose signature is bad instead of
+	// returning ErrBadSignature, for tools that show what it claims.
+	NoVerify bool
+}
+
+// SlotsSuffix ends the namespace segment of the lock name of a slot
+// ("<name>.slots/<k>", see lock.SlotName). No name has a segment ending in
+// it, so no one takes or releases a slot by name.
+const SlotsSuffix = ".slots"
+
+// validNamePattern matches allowed characters of one name segment:
+// alphanumeric, dots, hyphens, underscores.
 var validNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
 
+const (
+	// NameCharset describes the characters validNamePattern allows, for
+	// error messages. Anything else, spaces and non-ASCII letters
+	// included, is rejected rather than encoded: such names would compare
+	// differently on filesystems that normalize Unicode (macOS) and those
+	// that don't (Linux).
+	NameCharset = "ASCII letters, digits, '.', '_' and '-', with '/' between namespace segments"
+	// MaxNameBytes bounds a whole name, namespaces included, keeping the
+	// paths built from it well within the usual path length limits.
+	MaxNameBytes = 1024
+	// MaxStemBytes is the longest name segment stored as is in a file or
+	// directory name; see FileStem.
+	MaxStemBytes = 200
+	// stemHashLen is how many hex digits of a long segment's SHA-256 its
+	// stem ends in.
+	stemHashLen = 16
+)
+
 // ValidateName checks if a lock name is safe and valid.
 // Returns nil if valid, or an error describing the problem.
 //
 // Valid names:
-//   - Contain only alphanumeric characters, dots, hyphens, and underscores
-//   - Are not empty
-//   - Do not contain path traversal sequences (..)
-//   - Do not start with /
+//   - Are one segment ("deploy") or several separated by / ("team/frontend/build");
+//     each segment maps to a directory level under locks/
+//   - Segments contain only alphanumeric characters, dots, hyphens, and underscores
+//   - Are not empty and have no empty segments (no leading, trailing or double /)
+//   - Do not contain path traversal sequences (..) or "." segments
+//   - Have no segment but the last ending in .json, which would shadow a lock file
+//   - Have no segment ending in .slots (SlotsSuffix)
 func ValidateName(name string) error {
 	if name == "" {
 		return fmt.Errorf("%w: name cannot be empty", ErrInvalidName)
@@ -121,44 +242,282 @@ func ValidateName(name string) error {
 		return fmt.Errorf("%w: path traversal not allowed", ErrInvalidName)
 	}
 
-	if !validNamePattern.MatchString(name) {
-		return fmt.Errorf("%w: must contain only alphanumeric characters, dots, hyphens, and underscores", ErrInvalidName)
+	if len(name) > MaxNameBytes {
+		return fmt.Errorf("%w: %d bytes long, at most %d allowed", ErrInvalidName, len(name), MaxNameBytes)
 	}
 
+	segments := strings.Split(name, "/")
+	for i, seg := range segments {
+		switch {
+		case seg == "":
+			return fmt.Errorf("%w: empty segment in %q", ErrInvalidName, name)
+		case seg == ".":
+			return fmt.Errorf("%w: \".\" segment in %q", ErrInvalidName, name)
+		case !validNamePattern.MatchString(seg):
+			return fmt.Errorf("%w: %q contains %s; allowed are %s", ErrInvalidName, name, invalidChar(seg, validNamePattern), NameCharset)
+		case i < len(segments)-1 && strings.HasSuffix(seg, ".json"):
+			return fmt.Errorf("%w: namespace segment %q cannot end in .json", ErrInvalidName, seg)
+		case strings.HasSuffix(seg, SlotsSuffix):
+			return fmt.Errorf("%w: segment %q cannot end in %s, which is reserved for slots", ErrInvalidName, seg, SlotsSuffix)
+		}
+	}
+
+	return nil
+}
+
+// validPatternSegment matches the allowed characters of one segment of a
+// pattern: those of a name plus path.Match's *, ?, [, ] and ^.
+var validPatternSegment = regexp.MustCompile(`^[A-Za-z0-9._*?\[\]^-]+$`)
+
+// ValidatePattern checks a freeze pattern (freeze --match). A pattern uses
+// path.Match syntax: * and ? don't match /, so each namespace level is
+// matched separately ("team/*/build"). Apart from that syntax it is held
+// to ValidateName's rules, and it must have a wildcard: a plain name is
+// frozen by name.
+func ValidatePattern(pattern string) error {
+	if pattern == "" {
+		return fmt.Errorf("%w: pattern cannot be empty", ErrInvalidPattern)
+	}
+	if strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("%w: absolute paths not allowed", ErrInvalidPattern)
+	}
+	if strings.Contains(pattern, "..") {
+		return fmt.Errorf("%w: path traversal not allowed", ErrInvalidPattern)
+	}
+	if len(pattern) > MaxNameBytes {
+		return fmt.Errorf("%w: %d bytes long, at most %d allowed", ErrInvalidPattern, len(pattern), MaxNameBytes)
+	}
+	for _, seg := range strings.Split(pattern, "/") {
+		switch {
+		case seg == "":
+			return fmt.Errorf("%w: empty segment in %q", ErrInvalidPattern, pattern)
+		case seg == ".":
+			return fmt.Errorf("%w: \".\" segment in %q", ErrInvalidPattern, pattern)
+		case !validPatternSegment.MatchString(seg):
+			return fmt.Errorf("%w: %q contains %s; allowed are %s, and the wildcards * ? [ ]",
+				ErrInvalidPattern, pattern, invalidChar(seg, validPatternSegment), NameCharset)
+		}
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrInvalidPattern, pattern, err)
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return fmt.Errorf("%w: %q has no wildcard (* ? [...]); freeze the name itself", ErrInvalidPattern, pattern)
+	}
 	return nil
 }
 
+// invalidChar describes the first character of seg that segment (such as
+// validNamePattern) doesn't allow.
+func invalidChar(seg string, segment *regexp.Regexp) string {
+	for _, r := range seg {
+		if !(r < 0x80 && segment.MatchString(string(r))) {
+			return fmt.Sprintf("%q (%U)", r, r)
+		}
+	}
+	return "an invalid character"
+}
+
+// FileStem returns the on-disk form of a valid name, which files and
+// directories under the root are named after: each segment longer than
+// MaxStemBytes becomes its first bytes, "--" and part of its SHA-256, in
+// MaxStemBytes at most, so the file name stays within the 255 bytes most
+// filesystems allow. Shorter names are their own stem. A stem is a valid
+// name with itself as stem, so the stem listed from a directory finds the
+// same files as the name; the name itself is kept in the lock file.
+func FileStem(name string) string {
+	if len(name) <= MaxStemBytes {
+		return name
+	}
+	segments := strings.Split(name, "/")
+	for i, seg := range segments {
+		if len(seg) > MaxStemBytes {
+			sum := sha256.Sum256([]byte(seg))
+			segments[i] = seg[:MaxStemBytes-2-stemHashLen] + "--" + hex.EncodeToString(sum[:])[:stemHashLen]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
 // Read parses a lock file from the given path.
 func Read(path string) (*Lock, error) {
-	data, err := os.ReadFile(path) //nolint:gosec // Path is validated by caller
+	return ReadWithOptions(path, ReadOptions{})
+}
+
+// ReadWithOptions is Read with opts. A file over MaxFileSize is
+// ErrCorrupted; only that much of it is read.
+func ReadWithOptions(path string, opts ReadOptions) (*Lock, error) {
+	f, err := os.Open(path) //nolint:gosec // Path is validated by caller
 	if err != nil {
 		return nil, err
 	}
+	defer func() { _ = f.Close() }()
+	data, err := io.ReadAll(io.LimitReader(f, MaxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrCorrupted, MaxFileSize)
+	}
 	if len(data) == 0 {
 		// Empty file — likely a race (file created but not yet written).
 		// Return a generic error, not ErrCorrupted, so callers retry.
 		return nil, fmt.Errorf("empty lock file")
 	}
+	return ParseWithOptions(data, opts)
+}
+
+// Parse decodes lock file contents: ErrCorrupted if they aren't lock JSON,
+// ErrUnsupportedVersion if a newer lokt wrote them, ErrInvalidSchema if
+// they lack what every lock has, ErrBadSignature if they are signed but
+// not with a configured key.
+func Parse(data []byte) (*Lock, error) {
+	return ParseWithOptions(data, ReadOptions{})
+}
+
+// ParseWithOptions is Parse with opts.
+func ParseWithOptions(data []byte, opts ReadOptions) (*Lock, error) {
+	if len(data) > MaxFileSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrCorrupted, MaxFileSize)
+	}
 	var lock Lock
-	if err := json.Unmarshal(data, &lock); err != nil {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if opts.Strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(&lock); err != nil {
+		// encoding/json has no error type for an unknown field
+		if opts.Strict && strings.HasPrefix(err.Error(), "json: unknown field") {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+		}
 		return nil, fmt.Errorf("%w: %w", ErrCorrupted, err)
 	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: data after the lock object", ErrCorrupted)
+	}
 	if lock.Version > CurrentLockfileVersion {
 		return nil, fmt.Errorf("%w: version %d not supported (max: %d); upgrade lokt",
 			ErrUnsupportedVersion, lock.Version, CurrentLockfileVersion)
 	}
+	if err := lock.validate(); err != nil {
+		return nil, err
+	}
+	if !opts.NoVerify {
+		if err := verify(&lock); err != nil {
+			return nil, err
+		}
+	}
 	return &lock, nil
 }
 
+// validate checks the fields every lock file has.
+func (l *Lock) validate() error {
+	switch {
+	case l.Name == "":
+		return fmt.Errorf("%w: name is missing", ErrInvalidSchema)
+	case l.PID < 0:
+		return fmt.Errorf("%w: pid %d is negative", ErrInvalidSchema, l.PID)
+	case l.AcquiredAt.IsZero():
+		return fmt.Errorf("%w: acquired_ts is missing", ErrInvalidSchema)
+	}
+	return nil
+}
+
 // Write atomically writes a lock file to the given path.
 // Uses write-to-temp + rename for atomicity, with fsync for durability.
+// Lock files are 0644, as lock.Acquire creates them, so every user of a
+// shared root can see who holds what. The file is signed while signing
+// keys are configured; lock itself is left as it is.
 func Write(path string, lock *Lock) error {
-	data, err := json.MarshalIndent(lock, "", "  ")
+	data, err := marshal(lock)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(path, data, 0644, nil)
+}
+
+// marshal encodes lock as a lock file, signed with the first key if
+// signing is on.
+func marshal(lock *Lock) ([]byte, error) {
+	signed := *lock
+	if err := sign(&signed); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(&signed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Replace is Write with a last look: check is called once the new file is
+// written and synced, right before it is renamed over path, and an error
+// from it abandons the write. Keeping check to a re-read of path makes the
+// window in which path can change unnoticed as small as a rename allows.
+func Replace(path string, lock *Lock, check func() error) error {
+	data, err := marshal(lock)
 	if err != nil {
 		return err
 	}
-	data = append(data, '\n')
+	return writeAtomic(path, data, 0644, check)
+}
+
+// RemoveIf removes the lock file at path if remove, looking at the file as
+// it is at that moment, agrees, and reports whether it did. A decision to
+// remove a lock is made on an earlier read, and a renewal in between writes
+// a fresh file over the same path, so a plain remove could delete a live
+// lock. Instead the file is first renamed aside, to a temp name in the same
+// directory, and remove is given that path to re-read: whatever was at path
+// when it moved is what gets judged. A file written over path after the
+// move is left alone. If remove declines, the file is put back, unless path
+// has been recreated meanwhile, which is then the newer one.
+//
+// It returns false and no error if there is no file at path.
+func RemoveIf(path string, remove func(aside string) bool) (bool, error) {
+	tmp, err := createTempFn(filepath.Dir(path), ".lock-*.tmp")
+	if err != nil {
+		return false, err
+	}
+	aside := tmp.Name()
+	_ = tmp.Close()
+	if err := os.Rename(path, aside); err != nil {
+		_ = os.Remove(aside)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
 
+	if remove(aside) {
+		if err := os.Remove(aside); err != nil {
+			return false, err
+		}
+		_ = SyncDir(path)
+		return true, nil
+	}
+	// A hard link restores the file without replacing one created since
+	if err := os.Link(aside, path); err != nil && !os.IsExist(err) {
+		if _, statErr := os.Lstat(path); os.IsNotExist(statErr) {
+			// No hard links on this filesystem: a rename is the best left
+			_ = os.Rename(aside, path)
+		}
+	}
+	_ = os.Remove(aside)
+	_ = SyncDir(path)
+	return false, nil
+}
+
+// WriteFileAtomic writes data to path via temp file + rename in the same
+// directory, fsyncing the file and its directory. The file is created with
+// the given permissions. Readers never observe a partially written file, and
+// on failure no temp file is left behind.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	return writeAtomic(path, data, perm, nil)
+}
+
+// writeAtomic implements Write, Replace and WriteFileAtomic. A zero perm
+// keeps the temp file's default (0600) mode; check, if set, is Replace's.
+func writeAtomic(path string, data []byte, perm os.FileMode, check func() error) error {
 	dir := filepath.Dir(path)
 	tmp, err := createTempFn(dir, ".lock-*.tmp")
 	if err != nil {
@@ -174,27 +533,25 @@ func Write(path string, lock *Lock) error {
 	if _, err := tmp.Write(data); err != nil {
 		return err
 	}
+	if perm != 0 {
+		if err := tmp.Chmod(perm); err != nil {
+			return err
+		}
+	}
 	if err := tmp.Sync(); err != nil {
 		return err
 	}
 	if err := tmp.Close(); err != nil {
 		return err
 	}
+	if check != nil {
+		if err := check(); err != nil {
+			return err
+		}
+	}
 
 	if err := os.Rename(tmpPath, path); err != nil {
 		return err
 	}
 	return SyncDir(path)
 }
-
-// SyncDir fsyncs the parent directory of the given path to ensure
-// the directory entry (create, rename, or delete) is durably persisted.
-// Without this, a power loss could leave ghost or phantom entries.
-func SyncDir(path string) error {
-	dir, err := os.Open(filepath.Dir(path))
-	if err != nil {
-		return err
-	}
-	defer func() { _ = dir.Close() }()
-	return dir.Sync()
-}
@@ -3,8 +3,10 @@ package lockfile
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -176,6 +178,8 @@ func TestValidateName(t *testing.T) {
 		{"alphanumeric", "deploy123", false},
 		{"leading-dot", ".hidden", false},
 		{"complex-valid", "my-app_v1.2.3", false},
+		{"namespaced", "repo/frontend/build", false},
+		{"namespaced-dots", "team.a/v1.2/deploy", false},
 
 		// Invalid names
 		{"empty", "", true},
@@ -190,8 +194,18 @@ func TestValidateName(t *testing.T) {
 		{"ampersand", "foo&bar", true},
 		{"backtick", "foo`id`", true},
 		{"dollar", "foo$HOME", true},
-		{"slash", "foo/bar", true},
+		{"trailing-slash", "foo/", true},
+		{"double-slash", "foo//bar", true},
+		{"dot-segment", "foo/./bar", true},
+		{"json-namespace", "foo.json/bar", true},
+		{"slot", "itest.slots/0", true},
+		{"slots-last", "itest.slots", true},
 		{"backslash", "foo\\bar", true},
+		{"unicode", "déploy", true},
+		{"too-long", strings.Repeat("a", MaxNameBytes+1), true},
+
+		// Longer than a file name may be: stored under FileStem
+		{"long-segment", strings.Repeat("k", 300), false},
 	}
 
 	for _, tt := range tests {
@@ -599,6 +613,40 @@ func TestIsExpired_WithExpiresAt(t *testing.T) {
 	}
 }
 
+func TestExpiry_PrefersExpiresAt(t *testing.T) {
+	acquired := time.Now().Add(-time.Hour)
+	stamped := acquired.Add(2 * time.Hour)
+	// The writer's expires_at wins over acquired_at + ttl recomputed here.
+	lock := Lock{AcquiredAt: acquired, TTLSec: 60, ExpiresAt: &stamped}
+	if exp, ok := lock.Expiry(); !ok || !exp.Equal(stamped) {
+		t.Errorf("Expiry() = %v, %v; want %v, true", exp, ok, stamped)
+	}
+	if lock.IsExpired() {
+		t.Error("IsExpired() = true, want false: expires_at is in the future")
+	}
+
+	legacy := Lock{AcquiredAt: acquired, TTLSec: 60}
+	if exp, ok := legacy.Expiry(); !ok || !exp.Equal(acquired.Add(time.Minute)) {
+		t.Errorf("legacy Expiry() = %v, %v; want acquired_at + ttl", exp, ok)
+	}
+	if _, ok := (&Lock{AcquiredAt: acquired}).Expiry(); ok {
+		t.Error("Expiry() without a TTL should report no expiry")
+	}
+}
+
+func TestExpiredBeyond(t *testing.T) {
+	lock := Lock{ExpiresAt: timePtr(time.Now().Add(-10 * time.Second))}
+	if !lock.ExpiredBeyond(0) {
+		t.Error("ExpiredBeyond(0) = false for a lock expired 10s ago")
+	}
+	if lock.ExpiredBeyond(30 * time.Second) {
+		t.Error("ExpiredBeyond(30s) = true for a lock expired 10s ago")
+	}
+	if (&Lock{}).ExpiredBeyond(0) {
+		t.Error("ExpiredBeyond() = true for a lock without TTL")
+	}
+}
+
 func TestGenerateLockID(t *testing.T) {
 	id := GenerateLockID()
 	if len(id) != 32 {
@@ -754,3 +802,313 @@ func TestRemaining(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+
+	if err := WriteFileAtomic(path, []byte("first"), 0644); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+	if err := WriteFileAtomic(path, []byte("second"), 0644); err != nil {
+		t.Fatalf("WriteFileAtomic() replace error = %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Errorf("content = %q, want %q", data, "second")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the destination file, found %d entries", len(entries))
+	}
+}
+
+func TestRemoveIf(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "build.json")
+	write := func(lockID string) {
+		t.Helper()
+		if err := Write(path, &Lock{Name: "build", LockID: lockID, Owner: "o", Host: "h", PID: 1, AcquiredAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	judged := func(aside string) string {
+		lf, err := Read(aside)
+		if err != nil {
+			t.Fatalf("Read(aside) error = %v", err)
+		}
+		return lf.LockID
+	}
+
+	// Declined: the file is put back as it was
+	write("first")
+	if removed, err := RemoveIf(path, func(aside string) bool { return judged(aside) != "first" }); removed || err != nil {
+		t.Fatalf("RemoveIf() = %v, %v; want the file kept", removed, err)
+	}
+	if lf, err := Read(path); err != nil || lf.LockID != "first" {
+		t.Fatalf("after a declined RemoveIf: %v, %v", lf, err)
+	}
+
+	// Declined, but path rewritten meanwhile: the newer file stays
+	if removed, _ := RemoveIf(path, func(string) bool { write("second"); return false }); removed {
+		t.Fatal("RemoveIf() removed the file")
+	}
+	if lf, err := Read(path); err != nil || lf.LockID != "second" {
+		t.Fatalf("after a rewrite during RemoveIf: %v, %v; want the rewrite", lf, err)
+	}
+
+	// Agreed: removed; and then there is nothing left to remove
+	if removed, err := RemoveIf(path, func(aside string) bool { return judged(aside) == "second" }); !removed || err != nil {
+		t.Fatalf("RemoveIf() = %v, %v; want the file removed", removed, err)
+	}
+	if removed, err := RemoveIf(path, func(string) bool { t.Error("remove called without a file"); return true }); removed || err != nil {
+		t.Errorf("RemoveIf() on a missing file = %v, %v", removed, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("RemoveIf left %d entries behind", len(entries))
+	}
+}
+
+func TestSameAcquisition(t *testing.T) {
+	at := time.Now()
+	a := &Lock{LockID: "x", AcquiredAt: at}
+	if !a.SameAcquisition(&Lock{LockID: "x", AcquiredAt: at.Add(time.Minute)}) {
+		t.Error("a re-acquire under the same lock_id should be the same acquisition")
+	}
+	if a.SameAcquisition(&Lock{LockID: "y", AcquiredAt: at}) || a.SameAcquisition(&Lock{AcquiredAt: at}) {
+		t.Error("a different or missing lock_id should be a different acquisition")
+	}
+	if !(&Lock{AcquiredAt: at}).SameAcquisition(&Lock{AcquiredAt: at}) || (&Lock{AcquiredAt: at}).SameAcquisition(&Lock{AcquiredAt: at.Add(1)}) {
+		t.Error("without lock_id, acquired_ts should decide")
+	}
+}
+
+func TestCleanMessage(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"schema migration #482", "schema migration #482"},
+		{"  line one\nline two\r\n\tthree\x1b[31m ", "line one line two three [31m"},
+		{"\n\n", ""},
+	}
+	for _, tt := range tests {
+		if got := CleanMessage(tt.in); got != tt.want {
+			t.Errorf("CleanMessage(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	long := strings.Repeat("é", MaxMessageLen+10)
+	if got := CleanMessage(long); len([]rune(got)) != MaxMessageLen {
+		t.Errorf("CleanMessage(long) has %d runes, want %d", len([]rune(got)), MaxMessageLen)
+	}
+}
+
+func TestCleanLabels(t *testing.T) {
+	got, err := CleanLabels(map[string]string{"pr": "482", "job": "a\nb"})
+	if err != nil || got["pr"] != "482" || got["job"] != "a b" {
+		t.Errorf("CleanLabels() = %v, %v", got, err)
+	}
+	if got, err := CleanLabels(nil); got != nil || err != nil {
+		t.Errorf("CleanLabels(nil) = %v, %v; want nil", got, err)
+	}
+	for _, bad := range []map[string]string{
+		{"": "x"},
+		{"has space": "x"},
+		{strings.Repeat("k", MaxLabelKeyLen+1): "x"},
+	} {
+		if _, err := CleanLabels(bad); !errors.Is(err, ErrInvalidLabel) {
+			t.Errorf("CleanLabels(%v) error = %v, want ErrInvalidLabel", bad, err)
+		}
+	}
+	many := make(map[string]string)
+	for i := 0; i <= MaxLabels; i++ {
+		many[fmt.Sprintf("k%d", i)] = "v"
+	}
+	if _, err := CleanLabels(many); !errors.Is(err, ErrInvalidLabel) {
+		t.Errorf("CleanLabels(%d labels) error = %v, want ErrInvalidLabel", len(many), err)
+	}
+}
+
+func TestValidateName_NamesTheCharacter(t *testing.T) {
+	for name, want := range map[string]string{
+		"foo bar": "' ' (U+0020)",
+		"déploy":  "'é' (U+00E9)",
+	} {
+		err := ValidateName(name)
+		if err == nil || !strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), NameCharset) {
+			t.Errorf("ValidateName(%q) = %v, want it to name %s and the allowed characters", name, err, want)
+		}
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	for pattern, valid := range map[string]bool{
+		"deploy-*":       true,
+		"team/*/build":   true,
+		"db-[0-9]?":      true,
+		"web-[^a]*":      true,
+		"deploy":         false, // no wildcard
+		"dep[":           false, // malformed
+		"":               false,
+		"/deploy-*":      false,
+		"../*":           false,
+		"team//*":        false,
+		"deploy *":       false,
+		"deploy-{a,b}*":  false,
+		"./deploy-*":     false,
+		"deploy-*/x/../": false,
+	} {
+		err := ValidatePattern(pattern)
+		if (err == nil) != valid {
+			t.Errorf("ValidatePattern(%q) = %v, want valid %v", pattern, err, valid)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidPattern) {
+			t.Errorf("ValidatePattern(%q) = %v, want ErrInvalidPattern", pattern, err)
+		}
+	}
+}
+
+func TestFileStem(t *testing.T) {
+	if got := FileStem("team/deploy"); got != "team/deploy" {
+		t.Errorf("short name: FileStem = %q, want it unchanged", got)
+	}
+
+	long := strings.Repeat("k", 300)
+	stem := FileStem(long)
+	if len(stem) > MaxStemBytes || !strings.HasPrefix(stem, "kkk") || !strings.Contains(stem, "--") {
+		t.Errorf("FileStem(300 bytes) = %q (%d bytes), want a hashed stem of at most %d", stem, len(stem), MaxStemBytes)
+	}
+	if err := ValidateName(stem); err != nil {
+		t.Errorf("stem %q isn't a valid name: %v", stem, err)
+	}
+	if FileStem(stem) != stem {
+		t.Error("a stem should be its own stem")
+	}
+	if FileStem(long+"x") == stem {
+		t.Error("long names sharing a prefix got the same stem")
+	}
+
+	// Only the long segment is replaced; the namespace stays a directory.
+	if got := FileStem("team/" + long); got != "team/"+stem {
+		t.Errorf("FileStem(team/<long>) = %q, want team/%s", got, stem)
+	}
+}
+
+func TestRead_SizeLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.json")
+	data := append([]byte(`{"version":1,"name":"big","pid":1,"acquired_ts":"2026-01-01T00:00:00Z","message":"`),
+		strings.Repeat("x", MaxFileSize)...)
+	if err := os.WriteFile(path, append(data, `"}`...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); !errors.Is(err, ErrCorrupted) || !Broken(err) {
+		t.Errorf("Read(%d bytes) error = %v, want ErrCorrupted", len(data), err)
+	}
+}
+
+func TestParse_Schema(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"valid", `{"version":1,"name":"a","pid":1,"acquired_ts":"2026-01-01T00:00:00Z"}`, nil},
+		{"unknown field", `{"version":1,"name":"a","pid":1,"acquired_ts":"2026-01-01T00:00:00Z","future":true}`, nil},
+		{"missing name", `{"version":1,"pid":1,"acquired_ts":"2026-01-01T00:00:00Z"}`, ErrInvalidSchema},
+		{"negative pid", `{"version":1,"name":"a","pid":-1,"acquired_ts":"2026-01-01T00:00:00Z"}`, ErrInvalidSchema},
+		{"missing acquired_ts", `{"version":1,"name":"a","pid":1}`, ErrInvalidSchema},
+		{"not an object", `[1,2,3]`, ErrCorrupted},
+		{"trailing data", `{"version":1,"name":"a","pid":1,"acquired_ts":"2026-01-01T00:00:00Z"} {}`, ErrCorrupted},
+		{"newer version", `{"version":99}`, ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("Parse() error = %v, want %v", err, tt.want)
+			}
+			if tt.want == ErrInvalidSchema && errors.Is(err, ErrCorrupted) {
+				t.Errorf("invalid schema must not also be ErrCorrupted: %v", err)
+			}
+		})
+	}
+}
+
+func TestParse_Strict(t *testing.T) {
+	data := []byte(`{"version":1,"name":"a","pid":1,"acquired_ts":"2026-01-01T00:00:00Z","future":true}`)
+	if _, err := ParseWithOptions(data, ReadOptions{Strict: true}); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("strict: error = %v, want ErrInvalidSchema", err)
+	}
+	path := filepath.Join(t.TempDir(), "a.json")
+	if err := Write(path, &Lock{Version: 1, Name: "a", PID: 1, AcquiredAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadWithOptions(path, ReadOptions{Strict: true}); err != nil {
+		t.Errorf("strict read of a lock lokt wrote: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now().Round(0)
+	exp := now.Add(5 * time.Minute)
+	valid := Lock{
+		Version: CurrentLockfileVersion, Name: "build", LockID: GenerateLockID(), Owner: "alice", Host: "h", PID: 42,
+		AcquiredAt: now, TTLSec: 300, ExpiresAt: &exp,
+	}
+	if issues := Validate(&valid); len(issues) != 0 {
+		t.Fatalf("Validate(valid) = %v, want none", issues)
+	}
+
+	early, before := now.Add(time.Minute), now.Add(-time.Minute)
+	tests := []struct {
+		name  string
+		edit  func(l *Lock)
+		field string
+		sev   Severity
+	}{
+		{"newer version", func(l *Lock) { l.Version = CurrentLockfileVersion + 1 }, "version", SeverityError},
+		{"no version", func(l *Lock) { l.Version = 0 }, "version", SeverityWarning},
+		{"bad name", func(l *Lock) { l.Name = "../x" }, "name", SeverityError},
+		{"no lock_id", func(l *Lock) { l.LockID = "" }, "lock_id", SeverityWarning},
+		{"bad lock_id", func(l *Lock) { l.LockID = "XYZ" }, "lock_id", SeverityWarning},
+		{"no owner", func(l *Lock) { l.Owner = "" }, "owner", SeverityWarning},
+		{"negative pid", func(l *Lock) { l.PID = -1 }, "pid", SeverityError},
+		{"no acquired_ts", func(l *Lock) { l.AcquiredAt = time.Time{} }, "acquired_ts", SeverityError},
+		{"negative ttl", func(l *Lock) { l.TTLSec = -5 }, "ttl_sec", SeverityError},
+		{"expires before acquired", func(l *Lock) { l.ExpiresAt = &before }, "expires_at", SeverityError},
+		{"expires inconsistent", func(l *Lock) { l.ExpiresAt = &early }, "expires_at", SeverityWarning},
+		{"expires without ttl", func(l *Lock) { l.TTLSec = 0 }, "expires_at", SeverityWarning},
+		{"ttl without expires", func(l *Lock) { l.ExpiresAt = nil }, "expires_at", SeverityWarning},
+		{"unknown mode", func(l *Lock) { l.Mode = "exclusive" }, "mode", SeverityError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := valid
+			tt.edit(&l)
+			issues := Validate(&l)
+			if len(issues) != 1 || issues[0].Field != tt.field || issues[0].Severity != tt.sev {
+				t.Fatalf("Validate() = %v, want one %s on %s", issues, tt.sev, tt.field)
+			}
+			if HasError(issues) != (tt.sev == SeverityError) {
+				t.Errorf("HasError(%v) = %v", issues, HasError(issues))
+			}
+		})
+	}
+
+	// A freeze's TTL is rounded up to its end time
+	until := now.Add(90*time.Second + 300*time.Millisecond)
+	fz := valid
+	fz.TTLSec, fz.ExpiresAt = 91, &until
+	if issues := Validate(&fz); len(issues) != 0 {
+		t.Errorf("Validate(freeze with end time) = %v, want none", issues)
+	}
+}
@@ -0,0 +1,60 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Limits on the metadata a holder attaches to its lock, so lock files and
+// the audit lines that repeat them stay small.
+const (
+	MaxMessageLen    = 200 // runes
+	MaxLabels        = 16
+	MaxLabelKeyLen   = 64
+	MaxLabelValueLen = 128 // runes
+)
+
+// ErrInvalidLabel is returned for a label key that can't be stored.
+var ErrInvalidLabel = errors.New("invalid label")
+
+// CleanMessage returns s on one line: control characters (newlines
+// included) become spaces, runs of spaces collapse, and the result is
+// trimmed and cut to MaxMessageLen runes.
+func CleanMessage(s string) string {
+	return cleanText(s, MaxMessageLen)
+}
+
+// CleanLabels checks labels and returns a copy with each value cleaned like
+// a message and cut to MaxLabelValueLen runes, or nil if there are none.
+// Keys must be at most MaxLabelKeyLen alphanumerics, dots, hyphens and
+// underscores, and there may be at most MaxLabels of them.
+func CleanLabels(labels map[string]string) (map[string]string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	if len(labels) > MaxLabels {
+		return nil, fmt.Errorf("%w: at most %d labels allowed, got %d", ErrInvalidLabel, MaxLabels, len(labels))
+	}
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if len(k) > MaxLabelKeyLen || !validNamePattern.MatchString(k) {
+			return nil, fmt.Errorf("%w: key %q must be 1-%d alphanumeric characters, dots, hyphens, and underscores",
+				ErrInvalidLabel, k, MaxLabelKeyLen)
+		}
+		out[k] = cleanText(v, MaxLabelValueLen)
+	}
+	return out, nil
+}
+
+// cleanText is CleanMessage with a limit of maxLen runes.
+func cleanText(s string, maxLen int) string {
+	s = strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+	if r := []rune(s); len(r) > maxLen {
+		s = strings.TrimSpace(string(r[:maxLen]))
+	}
+	return s
+}
@@ -0,0 +1,132 @@
+package lockfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testKey    = "0123456789abcdef0123456789abcdef"
+	testOldKey = "fedcba9876543210fedcba9876543210"
+)
+
+// useKeys turns signing on with keys for the rest of the test.
+func useKeys(t *testing.T, keys ...string) {
+	t.Helper()
+	var ks [][]byte
+	for _, k := range keys {
+		ks = append(ks, []byte(k))
+	}
+	if err := SetKeys(ks); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = SetKeys(nil) })
+}
+
+func signTestLock(name string) *Lock {
+	return &Lock{Version: 1, Name: name, Owner: "alice", Host: "h1", PID: 42, AcquiredAt: time.Now(), TTLSec: 60}
+}
+
+func TestSign_RoundTrip(t *testing.T) {
+	useKeys(t, testKey)
+	path := filepath.Join(t.TempDir(), "build.json")
+	lk := signTestLock("build")
+	if err := Write(path, lk); err != nil {
+		t.Fatal(err)
+	}
+	if lk.Signature != "" {
+		t.Error("Write() changed the caller's lock")
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if got.Signature == "" || got.Unsigned() {
+		t.Errorf("Read() = %+v, want a signed lock", got)
+	}
+
+	// Rewriting the owner without the key breaks the signature
+	data, _ := os.ReadFile(path)
+	forged := strings.Replace(string(data), `"owner": "alice"`, `"owner": "mallory"`, 1)
+	if err := os.WriteFile(path, []byte(forged), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Read(forged) error = %v, want ErrBadSignature", err)
+	}
+	if lf, err := ReadWithOptions(path, ReadOptions{NoVerify: true}); err != nil || lf.Owner != "mallory" {
+		t.Errorf("ReadWithOptions(NoVerify) = %+v, %v; want what the file claims", lf, err)
+	}
+	if issues := Validate(&Lock{Name: "build", Owner: "mallory", AcquiredAt: time.Now(), Signature: "00"}); !HasError(issues) {
+		t.Errorf("Validate(bad signature) = %v, want an error", issues)
+	}
+}
+
+func TestSign_Unsigned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build.json")
+	if err := Write(path, signTestLock("build")); err != nil {
+		t.Fatal(err)
+	}
+	lf, err := Read(path)
+	if err != nil || lf.Signature != "" || lf.Unsigned() {
+		t.Fatalf("signing off: Read() = %+v, %v; want unsigned, and not flagged", lf, err)
+	}
+
+	// Signing turned on: still readable, but flagged
+	useKeys(t, testKey)
+	if lf, err = Read(path); err != nil || !lf.Unsigned() {
+		t.Errorf("signing on: Read() = %+v, %v; want it read and Unsigned", lf, err)
+	}
+}
+
+func TestSign_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build.json")
+	useKeys(t, testOldKey)
+	if err := Write(path, signTestLock("build")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new key signs, the old one still verifies
+	useKeys(t, testKey, testOldKey)
+	if _, err := Read(path); err != nil {
+		t.Errorf("Read() with the old key second: %v", err)
+	}
+	newPath := filepath.Join(filepath.Dir(path), "new.json")
+	if err := Write(newPath, signTestLock("new")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The old key retired
+	useKeys(t, testKey)
+	if _, err := Read(path); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Read() signed with a retired key: %v, want ErrBadSignature", err)
+	}
+	if _, err := Read(newPath); err != nil {
+		t.Errorf("Read() signed with the new key: %v", err)
+	}
+}
+
+func TestSetKeys_TooShort(t *testing.T) {
+	t.Cleanup(func() { _ = SetKeys(nil) })
+	if err := SetKeys([][]byte{[]byte("short")}); err == nil || Signing() {
+		t.Errorf("SetKeys(short) = %v, Signing() = %v; want an error and signing off", err, Signing())
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := ParseKeys("# rotated 2026-10\n  new-key  \n\nold-key,older-key\n")
+	var keys []string
+	for _, k := range got {
+		keys = append(keys, string(k))
+	}
+	if strings.Join(keys, " ") != "new-key old-key older-key" {
+		t.Errorf("ParseKeys() = %q", keys)
+	}
+	if ParseKeys(" \n# none\n") != nil {
+		t.Error("ParseKeys() of blanks and comments should be empty")
+	}
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// SyncDir fsyncs the parent directory of the given path to ensure
+// the directory entry (create, rename, or delete) is durably persisted.
+// Without this, a power loss could leave ghost or phantom entries.
+func SyncDir(path string) error {
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = dir.Close() }()
+	return dir.Sync()
+}
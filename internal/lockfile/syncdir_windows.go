@@ -0,0 +1,10 @@
+//go:build windows
+
+package lockfile
+
+// SyncDir is a no-op on Windows: a directory can't be opened for
+// FlushFileBuffers, and NTFS journals directory entries (create, rename,
+// delete) itself, so there is nothing further to flush.
+func SyncDir(_ string) error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package lockfile
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+	"unicode/utf8"
+)
+
+// Severity says how much an Issue matters.
+type Severity string
+
+const (
+	// SeverityError: lokt can't rely on the file as a lock.
+	SeverityError Severity = "error"
+	// SeverityWarning: usable, but not as this lokt writes it (an older
+	// lokt, or a tool writing lock files by hand).
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a problem Validate found with one field of a lock.
+type Issue struct {
+	Field    string   `json:"field"` // as named in the JSON
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	return i.Field + ": " + i.Message
+}
+
+// lockIDPattern matches the lock_id GenerateLockID writes.
+var lockIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// expiryTolerance is how far expires_at may be from acquired_ts + ttl_sec:
+// a freeze with an end time has its TTL rounded up to the second.
+const expiryTolerance = time.Second
+
+// Validate checks l field by field, beyond what Parse requires, and returns
+// every problem in field order, or none. It looks only at the file's
+// contents: whether the holder is alive is for stale.Check. l may come
+// from a plain json.Unmarshal, so that a file Parse rejects for its
+// version or schema can still be diagnosed.
+func Validate(l *Lock) []Issue {
+	var issues []Issue
+	add := func(field string, sev Severity, format string, args ...any) {
+		issues = append(issues, Issue{Field: field, Severity: sev, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case l.Version > CurrentLockfileVersion:
+		add("version", SeverityError, "%d is newer than this lokt supports (max %d); upgrade lokt", l.Version, CurrentLockfileVersion)
+	case l.Version < 0:
+		add("version", SeverityError, "%d is negative", l.Version)
+	case l.Version == 0:
+		add("version", SeverityWarning, "missing; read as version %d (written by an older lokt?)", CurrentLockfileVersion)
+	}
+
+	validate := ValidateName
+	if l.Pattern {
+		validate = ValidatePattern
+	}
+	if l.Name == "" {
+		add("name", SeverityError, "missing")
+	} else if err := validate(l.Name); err != nil {
+		add("name", SeverityError, "%v", err)
+	}
+
+	switch {
+	case l.LockID == "":
+		add("lock_id", SeverityWarning, "missing (written by an older lokt?); acquisitions are told apart by acquired_ts")
+	case !lockIDPattern.MatchString(l.LockID):
+		add("lock_id", SeverityWarning, "%q is not 32 lowercase hex digits", l.LockID)
+	}
+
+	if l.Owner == "" {
+		add("owner", SeverityWarning, "missing; only --force can release the lock")
+	}
+	if l.Host == "" {
+		add("host", SeverityWarning, "missing; the holder can't be checked for liveness")
+	}
+	switch {
+	case l.PID < 0:
+		add("pid", SeverityError, "%d is negative", l.PID)
+	case l.PID == 0:
+		add("pid", SeverityWarning, "missing; the holder can't be checked for liveness")
+	}
+	if l.PIDStartNS < 0 {
+		add("pid_start_ns", SeverityError, "%d is negative", l.PIDStartNS)
+	}
+
+	if l.AcquiredAt.IsZero() {
+		add("acquired_ts", SeverityError, "missing")
+	}
+	if l.TTLSec < 0 {
+		add("ttl_sec", SeverityError, "%d is negative", l.TTLSec)
+	}
+	if l.ExpiresAt != nil {
+		exp := *l.ExpiresAt
+		switch {
+		case !l.AcquiredAt.IsZero() && exp.Before(l.AcquiredAt):
+			add("expires_at", SeverityError, "%s is before acquired_ts %s", exp.Format(time.RFC3339), l.AcquiredAt.Format(time.RFC3339))
+		case l.TTLSec == 0:
+			add("expires_at", SeverityWarning, "set without ttl_sec; renewals won't keep it")
+		case l.TTLSec > 0 && !l.AcquiredAt.IsZero():
+			want := l.AcquiredAt.Add(time.Duration(l.TTLSec) * time.Second)
+			if d := exp.Sub(want); d > expiryTolerance || d < -expiryTolerance {
+				add("expires_at", SeverityWarning, "%s, but acquired_ts + ttl_sec is %s; expires_at wins",
+					exp.Format(time.RFC3339), want.Format(time.RFC3339))
+			}
+		}
+	} else if l.TTLSec > 0 {
+		add("expires_at", SeverityWarning, "missing (written by an older lokt?); acquired_ts + ttl_sec is used")
+	}
+
+	if l.Mode != "" && l.Mode != "shared" {
+		add("mode", SeverityError, "%q is not a mode (want shared, or none for exclusive)", l.Mode)
+	}
+	if n := utf8.RuneCountInString(l.Message); n > MaxMessageLen {
+		add("message", SeverityWarning, "%d characters long, at most %d are written", n, MaxMessageLen)
+	}
+	if _, err := CleanLabels(l.Labels); err != nil {
+		add("labels", SeverityWarning, "%v", err)
+	}
+	if err := verify(l); err != nil {
+		add("sig", SeverityError, "%v", err)
+	} else if l.Unsigned() {
+		add("sig", SeverityWarning, "missing while signing is on; unlock and renew refuse the lock without --force")
+	}
+	return issues
+}
+
+// HasError reports whether any of issues is a SeverityError.
+func HasError(issues []Issue) bool {
+	for _, i := range issues {
+		if i.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
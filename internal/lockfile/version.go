@@ -0,0 +1,74 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// MinLockfileVersion is the oldest schema version this lokt reads and can
+// write. A file without a version is read as this one.
+const MinLockfileVersion = 1
+
+// writeVersion is the version new lock files get; 0 means
+// CurrentLockfileVersion.
+var writeVersion atomic.Int32
+
+// SupportedVersions returns the schema versions this lokt reads and can
+// write, oldest first.
+func SupportedVersions() []int {
+	var vs []int
+	for v := MinLockfileVersion; v <= CurrentLockfileVersion; v++ {
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+// Supported reports whether this lokt reads and can write version v.
+func Supported(v int) bool {
+	return v >= MinLockfileVersion && v <= CurrentLockfileVersion
+}
+
+// WriteVersion returns the schema version lokt writes new and rewritten
+// lock files in: CurrentLockfileVersion unless SetWriteVersion chose
+// another.
+func WriteVersion() int {
+	if v := writeVersion.Load(); v != 0 {
+		return int(v)
+	}
+	return CurrentLockfileVersion
+}
+
+// SetWriteVersion makes lokt write lock files in version v, so that an
+// older lokt sharing the root can still read them (compat_write_version,
+// lokt --compat-write). 0 restores CurrentLockfileVersion. A version this
+// lokt doesn't support is ErrUnsupportedVersion.
+func SetWriteVersion(v int) error {
+	if v != 0 && !Supported(v) {
+		return fmt.Errorf("%w: cannot write version %d (supported: %v)", ErrUnsupportedVersion, v, SupportedVersions())
+	}
+	writeVersion.Store(int32(v)) //nolint:gosec // G115: v is a supported version
+	return nil
+}
+
+// ReadVersion returns the schema version of the lock file at path, reading
+// only that field, so that it works on files from any lokt. A file without
+// a version is MinLockfileVersion; one that isn't a JSON object is
+// ErrCorrupted.
+func ReadVersion(path string) (int, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path is a lock file under the root
+	if err != nil {
+		return 0, err
+	}
+	var v struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrCorrupted, err)
+	}
+	if v.Version == 0 {
+		return MinLockfileVersion, nil
+	}
+	return v.Version, nil
+}
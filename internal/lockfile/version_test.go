@@ -0,0 +1,105 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSupportedVersions(t *testing.T) {
+	vs := SupportedVersions()
+	if len(vs) == 0 || vs[0] != MinLockfileVersion || vs[len(vs)-1] != CurrentLockfileVersion {
+		t.Fatalf("SupportedVersions() = %v, want %d..%d", vs, MinLockfileVersion, CurrentLockfileVersion)
+	}
+	for _, v := range vs {
+		if !Supported(v) {
+			t.Errorf("Supported(%d) = false", v)
+		}
+	}
+	for _, v := range []int{MinLockfileVersion - 1, CurrentLockfileVersion + 1} {
+		if Supported(v) {
+			t.Errorf("Supported(%d) = true", v)
+		}
+	}
+}
+
+// Every version this lokt writes reads back as written, and ReadVersion
+// sees it; the next version is detected but not read.
+func TestVersions_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	for _, v := range append(SupportedVersions(), CurrentLockfileVersion+1) {
+		t.Run(fmt.Sprintf("v%d", v), func(t *testing.T) {
+			path := filepath.Join(dir, fmt.Sprintf("v%d.json", v))
+			want := &Lock{
+				Version: v, Name: "build", LockID: GenerateLockID(), Owner: "alice", Host: "h1", PID: 42,
+				AcquiredAt: time.Now().UTC().Truncate(time.Second), TTLSec: 300,
+			}
+			if err := Write(path, want); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := ReadVersion(path); err != nil || got != v {
+				t.Errorf("ReadVersion() = %d, %v; want %d", got, err, v)
+			}
+			got, err := Read(path)
+			if !Supported(v) {
+				if !errors.Is(err, ErrUnsupportedVersion) {
+					t.Errorf("Read() error = %v, want ErrUnsupportedVersion", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if got.Version != v || got.Name != want.Name || got.LockID != want.LockID || got.Owner != want.Owner ||
+				got.PID != want.PID || !got.AcquiredAt.Equal(want.AcquiredAt) || got.TTLSec != want.TTLSec {
+				t.Errorf("Read() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadVersion(t *testing.T) {
+	dir := t.TempDir()
+	noVersion := filepath.Join(dir, "old.json")
+	if err := os.WriteFile(noVersion, []byte(`{"name":"a"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ReadVersion(noVersion); err != nil || v != MinLockfileVersion {
+		t.Errorf("ReadVersion(no version) = %d, %v; want %d", v, err, MinLockfileVersion)
+	}
+
+	garbage := filepath.Join(dir, "garbage.json")
+	if err := os.WriteFile(garbage, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadVersion(garbage); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("ReadVersion(garbage) error = %v, want ErrCorrupted", err)
+	}
+	if _, err := ReadVersion(filepath.Join(dir, "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("ReadVersion(missing) error = %v, want not exist", err)
+	}
+}
+
+func TestSetWriteVersion(t *testing.T) {
+	t.Cleanup(func() { _ = SetWriteVersion(0) })
+	if WriteVersion() != CurrentLockfileVersion {
+		t.Fatalf("WriteVersion() = %d, want %d by default", WriteVersion(), CurrentLockfileVersion)
+	}
+	for _, v := range SupportedVersions() {
+		if err := SetWriteVersion(v); err != nil || WriteVersion() != v {
+			t.Errorf("SetWriteVersion(%d) = %v, WriteVersion() = %d", v, err, WriteVersion())
+		}
+	}
+	for _, v := range []int{-1, CurrentLockfileVersion + 1} {
+		if err := SetWriteVersion(v); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("SetWriteVersion(%d) = %v, want ErrUnsupportedVersion", v, err)
+		}
+	}
+	if err := SetWriteVersion(0); err != nil || WriteVersion() != CurrentLockfileVersion {
+		t.Errorf("SetWriteVersion(0) = %v, WriteVersion() = %d; want the newest", err, WriteVersion())
+	}
+}
@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/config"
+)
+
+// MaxHookRuns caps the hook processes one lokt process runs at a time.
+// Events arriving while that many are in flight are dropped, so an event
+// storm (a prune of hundreds of locks) can't fork hundreds of processes.
+const MaxHookRuns = 4
+
+// EnvHookEvent is set in the hook's environment to the event it runs for.
+// lokt commands started from the hook don't run it again, so a hook that
+// freezes or unlocks can't set itself off.
+const EnvHookEvent = "LOKT_HOOK_EVENT"
+
+// hookWaitDelay bounds how long a timed-out hook's output pipes are waited
+// on after it is killed.
+const hookWaitDelay = time.Second
+
+// Hook runs the event hook for audit events. The zero value is not usable;
+// construct with NewHook.
+type Hook struct {
+	rootDir string
+	path    string
+	events  []string
+	timeout time.Duration
+	slots   chan struct{}
+	wg      sync.WaitGroup
+}
+
+// HookPath returns the path of the event hook for a root,
+// <root>/hooks/on-event. When it exists and is executable it is run for
+// each audit event of the types listed in hooks.events, with the event as
+// JSON on stdin and its type as argv[1].
+func HookPath(rootDir string) string {
+	return filepath.Join(rootDir, "hooks", "on-event")
+}
+
+// NewHook returns a Hook for rootDir, or nil if there is no executable hook,
+// cfg lists no events for it, or this process was itself started by the
+// hook.
+func NewHook(rootDir string, cfg *config.Config) *Hook {
+	if cfg == nil || os.Getenv(EnvHookEvent) != "" {
+		return nil
+	}
+	events := cfg.Hooks.EffectiveEvents()
+	path := HookPath(rootDir)
+	if len(events) == 0 || !HookExecutable(path) {
+		return nil
+	}
+	return &Hook{
+		rootDir: rootDir,
+		path:    path,
+		events:  events,
+		timeout: cfg.Hooks.EffectiveTimeout(),
+		slots:   make(chan struct{}, MaxHookRuns),
+	}
+}
+
+// HookExecutable reports whether path is a regular file lokt can run. On
+// Windows, where there are no execute bits, any regular file counts.
+func HookExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0111 != 0
+}
+
+// Run starts the hook for e if its type is one the hook runs for. It does
+// not block; use Wait before exiting. Suitable for audit.Writer.OnEmit.
+func (h *Hook) Run(e *audit.Event) {
+	if !slices.Contains(h.events, e.Event) {
+		return
+	}
+	// Marshal now: the caller owns e once Run returns.
+	body, err := json.Marshal(e)
+	if err != nil {
+		recordHookFailure(h.rootDir, false)
+		return
+	}
+	select {
+	case h.slots <- struct{}{}:
+	default:
+		recordHookFailure(h.rootDir, true)
+		return
+	}
+	h.wg.Add(1)
+	go func() {
+		defer func() {
+			<-h.slots
+			h.wg.Done()
+		}()
+		if err := h.exec(e.Event, body); err != nil {
+			recordHookFailure(h.rootDir, false)
+		}
+	}()
+}
+
+// exec runs the hook once for an event of type event. A non-zero exit or a
+// timeout is a failure. The hook's output is discarded: it must not mix
+// with the command's own.
+func (h *Hook) exec(event string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, h.path, event) //nolint:gosec // G204: the hook is the root's own
+	cmd.Dir = h.rootDir
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(), EnvHookEvent+"="+event)
+	cmd.WaitDelay = hookWaitDelay
+	return cmd.Run()
+}
+
+// Wait blocks until every hook run started by Run has finished or timed
+// out.
+func (h *Hook) Wait() {
+	h.wg.Wait()
+}
@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/config"
+)
+
+// writeHook installs script as the event hook of root.
+func writeHook(t *testing.T, root, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hook scripts need a POSIX shell")
+	}
+	path := HookPath(root)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0700); err != nil { //nolint:gosec // G306: must be executable
+		t.Fatal(err)
+	}
+}
+
+func TestNewHook_None(t *testing.T) {
+	root := t.TempDir()
+	if h := NewHook(root, &config.Config{}); h != nil {
+		t.Error("NewHook() without hooks/on-event should be nil")
+	}
+
+	writeHook(t, root, "exit 0\n")
+	if err := os.Chmod(HookPath(root), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if h := NewHook(root, &config.Config{}); h != nil {
+		t.Error("NewHook() with a non-executable hook should be nil")
+	}
+	if err := os.Chmod(HookPath(root), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if h := NewHook(root, &config.Config{Hooks: config.HooksConfig{Events: []string{}}}); h != nil {
+		t.Error("NewHook() with no events should be nil")
+	}
+	t.Setenv(EnvHookEvent, audit.EventFreeze)
+	if h := NewHook(root, &config.Config{}); h != nil {
+		t.Error("NewHook() inside a hook run should be nil")
+	}
+}
+
+func TestHook_RunsForConfiguredEvents(t *testing.T) {
+	root := t.TempDir()
+	out := filepath.Join(root, "events.out")
+	writeHook(t, root, `{ echo "$1 $LOKT_HOOK_EVENT"; cat; echo; } >> "`+out+"\"\n")
+
+	h := NewHook(root, &config.Config{})
+	if h == nil {
+		t.Fatal("NewHook() = nil")
+	}
+	h.Run(&audit.Event{Event: audit.EventForceBreak, Name: "deploy", Owner: "alice"})
+	h.Run(&audit.Event{Event: audit.EventAcquire, Name: "deploy"}) // not a default event
+	h.Wait()
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook did not run: %v", err)
+	}
+	got := string(data)
+	if !strings.HasPrefix(got, "force-break force-break\n") {
+		t.Errorf("argv[1] and env should name the event, got %q", got)
+	}
+	if !strings.Contains(got, `"name":"deploy"`) || !strings.Contains(got, `"owner":"alice"`) {
+		t.Errorf("stdin should carry the event JSON, got %q", got)
+	}
+	if strings.Contains(got, "acquire") {
+		t.Errorf("hook ran for an event it isn't configured for: %q", got)
+	}
+	if s := ReadState(root); s.HookFailures != 0 || s.HookDropped != 0 {
+		t.Errorf("state = %+v, want no failures", s)
+	}
+}
+
+func TestHook_FailuresOnlyCounted(t *testing.T) {
+	root := t.TempDir()
+	writeHook(t, root, "exit 3\n")
+
+	h := NewHook(root, &config.Config{})
+	h.Run(&audit.Event{Event: audit.EventFreeze, Name: "deploy"})
+	h.Wait()
+
+	s := ReadState(root)
+	if s.HookFailures != 1 || s.LastHookFailure == nil {
+		t.Errorf("state = %+v, want 1 failure with a timestamp", s)
+	}
+}
+
+func TestHook_Timeout(t *testing.T) {
+	root := t.TempDir()
+	writeHook(t, root, "exec sleep 10\n")
+
+	h := NewHook(root, &config.Config{Hooks: config.HooksConfig{Timeout: config.Duration(100 * time.Millisecond)}})
+	start := time.Now()
+	h.Run(&audit.Event{Event: audit.EventFreeze, Name: "deploy"})
+	h.Wait()
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Wait() took %v; the hook should have been killed", elapsed)
+	}
+	if ReadState(root).HookFailures != 1 {
+		t.Error("a timed-out hook should count as a failure")
+	}
+}
+
+func TestHook_StormIsCapped(t *testing.T) {
+	root := t.TempDir()
+	out := filepath.Join(root, "runs.out")
+	writeHook(t, root, `echo run >> "`+out+`"; sleep 1`+"\n")
+
+	h := NewHook(root, &config.Config{})
+	const storm = 50
+	for range storm {
+		h.Run(&audit.Event{Event: audit.EventCorruptBreak, Name: "x"})
+	}
+	h.Wait()
+
+	data, _ := os.ReadFile(out)
+	if runs := strings.Count(string(data), "run"); runs != MaxHookRuns {
+		t.Errorf("hook ran %d times, want %d", runs, MaxHookRuns)
+	}
+	if s := ReadState(root); s.HookDropped != storm-MaxHookRuns {
+		t.Errorf("dropped = %d, want %d", s.HookDropped, storm-MaxHookRuns)
+	}
+}
@@ -0,0 +1,133 @@
+// Package notify delivers the per-lock webhooks configured under
+// locks.<name>.notify in config.json, and runs the event hook
+// <root>/hooks/on-event (see hook.go).
+//
+// Delivery is deliberately weak: each matching transition is POSTed once,
+// asynchronously, with a short timeout. Failures never reach the command
+// that caused the transition; they only bump a counter in the warn state
+// (see state.go) that lokt doctor reports.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/stale"
+)
+
+// Timeout bounds a single webhook delivery or probe.
+const Timeout = 2 * time.Second
+
+// Injectable for testing.
+var client = &http.Client{Timeout: Timeout}
+
+// Payload is the JSON body POSTed to a webhook: the audit event that
+// triggered it plus the transition name it matched.
+type Payload struct {
+	Transition string `json:"transition"`
+	*audit.Event
+}
+
+// Dispatcher fires webhooks for audit events. The zero value is not usable;
+// construct with New.
+type Dispatcher struct {
+	rootDir string
+	locks   map[string]config.LockPolicy
+	wg      sync.WaitGroup
+}
+
+// New returns a Dispatcher for the lock policies in cfg, or nil if no lock
+// has a notify target.
+func New(rootDir string, cfg *config.Config) *Dispatcher {
+	if cfg == nil || len(cfg.NotifyURLs()) == 0 {
+		return nil
+	}
+	return &Dispatcher{rootDir: rootDir, locks: cfg.Locks}
+}
+
+// Transition maps an audit event to the notify transition it represents,
+// or "" if it isn't one.
+func Transition(e *audit.Event) string {
+	switch e.Event {
+	case audit.EventAcquire:
+		return config.TransitionAcquired
+	case audit.EventRelease:
+		return config.TransitionReleased
+	case audit.EventForceBreak:
+		return config.TransitionForceBroken
+	case audit.EventFreeze:
+		return config.TransitionFrozen
+	case audit.EventAutoPrune, audit.EventStaleBreak:
+		if reason, _ := e.Extra["stale_reason"].(string); reason == string(stale.ReasonExpired) {
+			return config.TransitionExpiredObserved
+		}
+	}
+	return ""
+}
+
+// Notify starts delivery of e to the webhook configured for its lock and
+// transition, if any. It does not block; use Wait before exiting.
+// Suitable for audit.Writer.OnEmit.
+func (d *Dispatcher) Notify(e *audit.Event) {
+	t := Transition(e)
+	if t == "" {
+		return
+	}
+	url := d.locks[e.Name].Notify[t]
+	if url == "" {
+		return
+	}
+	// Marshal now: the caller owns e once Notify returns.
+	body, err := json.Marshal(Payload{Transition: t, Event: e})
+	if err != nil {
+		recordFailure(d.rootDir)
+		return
+	}
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		if err := post(url, body); err != nil {
+			recordFailure(d.rootDir)
+		}
+	}()
+}
+
+// Wait blocks until every delivery started by Notify has finished or timed
+// out.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// post delivers body to url once. Any non-2xx response is a failure.
+func post(url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body)) //nolint:gosec // G107: URL comes from the root's own config
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Probe checks that url is reachable with a HEAD request. Any HTTP response,
+// including an error status, counts as reachable: many webhook endpoints
+// reject HEAD but still accept the POST.
+func Probe(url string) error {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
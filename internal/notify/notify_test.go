@@ -0,0 +1,163 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/config"
+)
+
+// recorder is a webhook endpoint that keeps every payload it receives.
+type recorder struct {
+	mu       sync.Mutex
+	payloads []map[string]any
+	status   int
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	var p map[string]any
+	_ = json.Unmarshal(body, &p)
+	r.mu.Lock()
+	r.payloads = append(r.payloads, p)
+	r.mu.Unlock()
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+	}
+}
+
+func policy(name string, notify map[string]string) *config.Config {
+	return &config.Config{Locks: map[string]config.LockPolicy{name: {Notify: notify}}}
+}
+
+func TestTransition(t *testing.T) {
+	expired := map[string]any{"stale_reason": "expired"}
+	deadPID := map[string]any{"stale_reason": "dead_pid"}
+	tests := []struct {
+		event string
+		extra map[string]any
+		want  string
+	}{
+		{audit.EventAcquire, nil, config.TransitionAcquired},
+		{audit.EventRelease, nil, config.TransitionReleased},
+		{audit.EventForceBreak, nil, config.TransitionForceBroken},
+		{audit.EventFreeze, nil, config.TransitionFrozen},
+		{audit.EventAutoPrune, expired, config.TransitionExpiredObserved},
+		{audit.EventStaleBreak, expired, config.TransitionExpiredObserved},
+		{audit.EventAutoPrune, deadPID, ""},
+		{audit.EventDeny, nil, ""},
+		{audit.EventRenew, nil, ""},
+	}
+	for _, tt := range tests {
+		if got := Transition(&audit.Event{Event: tt.event, Extra: tt.extra}); got != tt.want {
+			t.Errorf("Transition(%s, %v) = %q, want %q", tt.event, tt.extra, got, tt.want)
+		}
+	}
+}
+
+func TestNew_NoTargets(t *testing.T) {
+	if d := New(t.TempDir(), &config.Config{}); d != nil {
+		t.Error("expected nil dispatcher without notify targets")
+	}
+	if d := New(t.TempDir(), policy("build", nil)); d != nil {
+		t.Error("expected nil dispatcher for a policy without notify")
+	}
+}
+
+func TestDispatcher_PostsMatchingTransition(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	d := New(t.TempDir(), policy("deploy", map[string]string{config.TransitionForceBroken: srv.URL}))
+	d.Notify(&audit.Event{Event: audit.EventAcquire, Name: "deploy", Owner: "alice"})            // no target for acquired
+	d.Notify(&audit.Event{Event: audit.EventForceBreak, Name: "build", Owner: "alice"})          // other lock
+	d.Notify(&audit.Event{Event: audit.EventForceBreak, Name: "deploy", Owner: "alice", Seq: 7}) // match
+	d.Wait()
+
+	if len(rec.payloads) != 1 {
+		t.Fatalf("expected 1 delivery, got %d: %v", len(rec.payloads), rec.payloads)
+	}
+	p := rec.payloads[0]
+	if p["transition"] != config.TransitionForceBroken || p["event"] != audit.EventForceBreak ||
+		p["name"] != "deploy" || p["owner"] != "alice" || p["seq"] != float64(7) {
+		t.Errorf("payload should mirror the audit event, got %v", p)
+	}
+}
+
+func TestDispatcher_FailuresOnlyCounted(t *testing.T) {
+	rec := &recorder{status: http.StatusInternalServerError}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadURL := dead.URL
+	dead.Close()
+
+	root := t.TempDir()
+	d := New(root, policy("deploy", map[string]string{
+		config.TransitionAcquired: srv.URL,
+		config.TransitionReleased: deadURL,
+	}))
+	d.Notify(&audit.Event{Event: audit.EventAcquire, Name: "deploy"})
+	d.Notify(&audit.Event{Event: audit.EventRelease, Name: "deploy"})
+	d.Wait()
+
+	if len(rec.payloads) != 1 {
+		t.Errorf("failed delivery must not be retried, got %d attempts", len(rec.payloads))
+	}
+	s := ReadState(root)
+	if s.WebhookFailures != 2 || s.LastWebhookFailure == nil {
+		t.Errorf("state = %+v, want 2 failures with a timestamp", s)
+	}
+}
+
+func TestDispatcher_Timeout(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { <-block }))
+	defer srv.Close()
+	defer close(block)
+
+	old := client
+	client = &http.Client{Timeout: 50 * time.Millisecond}
+	defer func() { client = old }()
+
+	root := t.TempDir()
+	d := New(root, policy("deploy", map[string]string{config.TransitionAcquired: srv.URL}))
+	start := time.Now()
+	d.Notify(&audit.Event{Event: audit.EventAcquire, Name: "deploy"})
+	if time.Since(start) > 40*time.Millisecond {
+		t.Error("Notify should not block on delivery")
+	}
+	d.Wait()
+
+	if ReadState(root).WebhookFailures != 1 {
+		t.Error("a timed-out delivery should be counted as a failure")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	var method string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer srv.Close()
+
+	if err := Probe(srv.URL); err != nil {
+		t.Errorf("Probe() = %v; any HTTP response counts as reachable", err)
+	}
+	if method != http.MethodHead {
+		t.Errorf("probe used %s, want HEAD", method)
+	}
+
+	srv.Close()
+	if err := Probe(srv.URL); err == nil {
+		t.Error("expected an error for an unreachable URL")
+	}
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// StateFile holds counters for best-effort side channels whose failures are
+// deliberately not reported by the command that hit them. lokt doctor reads
+// it so they are not silent forever.
+const StateFile = "warn-state.json"
+
+// State is the JSON structure of <root>/warn-state.json.
+type State struct {
+	WebhookFailures    int        `json:"webhook_failures"`
+	LastWebhookFailure *time.Time `json:"last_webhook_failure,omitempty"`
+	// HookFailures counts event hook runs that failed or timed out, and
+	// HookDropped events not handed to the hook because too many runs were
+	// already in flight.
+	HookFailures    int        `json:"hook_failures"`
+	HookDropped     int        `json:"hook_dropped"`
+	LastHookFailure *time.Time `json:"last_hook_failure,omitempty"`
+}
+
+// stateMu serializes read-modify-write of the state file within a process.
+// Concurrent processes may occasionally lose an increment; the counter is a
+// hint, not an exact tally.
+var stateMu sync.Mutex
+
+// StatePath returns the path to the warn state file for a root.
+func StatePath(rootDir string) string {
+	return filepath.Join(rootDir, StateFile)
+}
+
+// ReadState reads the warn state for a root. A missing or unreadable file
+// yields the zero State.
+func ReadState(rootDir string) State {
+	var s State
+	data, err := os.ReadFile(StatePath(rootDir)) //nolint:gosec // G304: path is controlled
+	if err == nil {
+		_ = json.Unmarshal(data, &s)
+	}
+	return s
+}
+
+// recordFailure bumps the webhook failure counter. Errors are ignored.
+func recordFailure(rootDir string) {
+	updateState(rootDir, func(s *State, now time.Time) {
+		s.WebhookFailures++
+		s.LastWebhookFailure = &now
+	})
+}
+
+// recordHookFailure bumps the event hook failure counter, or the dropped
+// counter if dropped is set. Errors are ignored.
+func recordHookFailure(rootDir string, dropped bool) {
+	updateState(rootDir, func(s *State, now time.Time) {
+		if dropped {
+			s.HookDropped++
+		} else {
+			s.HookFailures++
+		}
+		s.LastHookFailure = &now
+	})
+}
+
+// updateState applies fn to the warn state and writes it back. Errors are
+// ignored.
+func updateState(rootDir string, fn func(s *State, now time.Time)) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	s := ReadState(rootDir)
+	fn(&s, time.Now().UTC())
+	data, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	_ = lockfile.WriteFileAtomic(StatePath(rootDir), append(data, '\n'), 0600)
+}
@@ -0,0 +1,311 @@
+// Package plan runs a plan: a list of commands, each under a lock of its
+// own, several at a time (lokt plan run). Every entry is a guard.Runner, so
+// it gets what lokt guard gives one command: freeze checks, a heartbeat,
+// signal forwarding and a release as soon as its command exits. What plan
+// adds is the scheduling: bounded parallelism, tagged output from all the
+// commands on one terminal, cancellation of the entries still to come on a
+// signal, and a Result per entry.
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/guard"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// Entry is one task of a plan: run Cmd with Args under the lock Name.
+type Entry struct {
+	Name string          `json:"name"`
+	TTL  config.Duration `json:"ttl,omitempty"` // "5m" or seconds; renewed while Cmd runs
+	Cmd  string          `json:"cmd"`
+	Args []string        `json:"args,omitempty"`
+	// AllowSkipIfHeld skips the entry, as guard --if-free does, when its
+	// lock is held; otherwise it waits for the holder.
+	AllowSkipIfHeld bool `json:"allow_skip_if_held,omitempty"`
+}
+
+// ErrCancelled is the Result error of an entry a signal kept from running.
+var ErrCancelled = errors.New("cancelled")
+
+// Parse reads a plan, a JSON array of entries, and validates it: a typo
+// fails the plan before anything is acquired. Unknown fields are errors,
+// so is a name given twice (the second entry would wait on the first
+// forever, as the same process).
+func Parse(r io.Reader) ([]Entry, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var entries []Entry
+	if err := dec.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid plan: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("invalid plan: no entries")
+	}
+	seen := make(map[string]bool)
+	for i, e := range entries {
+		if err := lockfile.ValidateName(e.Name); err != nil {
+			return nil, fmt.Errorf("plan entry %d: %w", i, err)
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("plan entry %d: name %q appears twice", i, e.Name)
+		}
+		seen[e.Name] = true
+		if e.Cmd == "" {
+			return nil, fmt.Errorf("plan entry %d (%s): no cmd", i, e.Name)
+		}
+		if e.TTL < 0 {
+			return nil, fmt.Errorf("plan entry %d (%s): negative ttl", i, e.Name)
+		}
+	}
+	return entries, nil
+}
+
+// Holder is the holder of a lock that kept an entry from running.
+type Holder struct {
+	Owner      string    `json:"owner"`
+	Host       string    `json:"host"`
+	PID        int       `json:"pid"`
+	AgentID    string    `json:"agent_id,omitempty"`
+	AcquiredAt time.Time `json:"acquired_ts"`
+}
+
+// Result is how one entry ended.
+type Result struct {
+	Name     string `json:"name"`
+	Acquired bool   `json:"acquired"`
+	Skipped  bool   `json:"skipped,omitempty"` // held, and AllowSkipIfHeld
+	// ExitCode is the command's exit code, 128+signal if a forwarded
+	// signal ended it; nil if it never ran.
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Signal     string `json:"signal,omitempty"` // the signal forwarded to the command
+	DurationMS int64  `json:"duration_ms"`      // the command's run time
+	// Holder is set when the lock was held: the entry was skipped, or its
+	// wait timed out.
+	Holder *Holder `json:"holder,omitempty"`
+	// Error says why the entry didn't run, or what went wrong besides the
+	// command's exit code: a freeze, a wait that timed out, a lock lost
+	// while the command ran, ErrCancelled.
+	Error string `json:"error,omitempty"`
+}
+
+// OK reports whether the entry succeeded: its command exited 0, or it was
+// skipped as allowed.
+func (r Result) OK() bool {
+	return r.Skipped || r.Error == "" && r.ExitCode != nil && *r.ExitCode == 0
+}
+
+// Options configures Run.
+type Options struct {
+	// Guard is the template for every entry's guard.Runner: its RootDir,
+	// Acquire, Stdout, Stderr, OnLost and the rest apply to all entries.
+	// Name, Command, Acquire.TTL, Wait, IfFree and Signals are set per
+	// entry; output is always tagged with the entry's name, and stdin is
+	// the null device.
+	Guard guard.Options
+	// Parallel is how many entries run at once, in plan order; less than
+	// 1 means 1.
+	Parallel int
+	// WaitTimeout bounds each entry's wait for its lock; zero waits as
+	// long as it takes.
+	WaitTimeout time.Duration
+	// Signals delivers signals that cancel the plan: entries not yet
+	// started are not, waits are abandoned and running commands get the
+	// signal forwarded. Nil subscribes to SIGINT and SIGTERM.
+	Signals <-chan os.Signal
+	// OnDone, if set, is called as each entry finishes, one call at a
+	// time.
+	OnDone func(Result)
+}
+
+// Run runs entries, at most opts.Parallel at a time, and returns a Result
+// for each, in plan order, once all are done; each lock is released as its
+// entry finishes. sig is the signal that cancelled the plan, if one did.
+// ctx cancels the plan as a signal does.
+func Run(ctx context.Context, entries []Entry, opts Options) (results []Result, sig os.Signal) {
+	sigCh := opts.Signals
+	if sigCh == nil {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(ch)
+		sigCh = ch
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The channels of the entries under way, to forward signals to
+	var mu sync.Mutex
+	running := make(map[int]chan os.Signal)
+	stopSignals := make(chan struct{})
+	signalsDone := make(chan struct{})
+	go func() {
+		defer close(signalsDone)
+		for {
+			select {
+			case <-stopSignals:
+				return
+			case s := <-sigCh:
+				mu.Lock()
+				if sig == nil {
+					sig = s
+				}
+				cancel()
+				for _, ch := range running {
+					select {
+					case ch <- s:
+					default: // one is already on its way
+					}
+				}
+				mu.Unlock()
+			}
+		}
+	}()
+
+	stdout, stderr := opts.Guard.Stdout, opts.Guard.Stderr
+	if stdout != nil {
+		stdout = &lockedWriter{w: stdout}
+	}
+	if stderr != nil {
+		stderr = &lockedWriter{w: stderr}
+	}
+
+	results = make([]Result, len(entries))
+	var doneMu sync.Mutex
+	next := make(chan int)
+	var workers sync.WaitGroup
+	for range max(opts.Parallel, 1) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range next {
+				ch := make(chan os.Signal, 1)
+				mu.Lock()
+				cancelled := ctx.Err() != nil
+				if !cancelled {
+					running[i] = ch
+				}
+				mu.Unlock()
+				if cancelled {
+					results[i] = Result{Name: entries[i].Name, Error: ErrCancelled.Error()}
+				} else {
+					results[i] = runEntry(ctx, entries[i], opts, stdout, stderr, ch)
+					mu.Lock()
+					delete(running, i)
+					mu.Unlock()
+				}
+				if opts.OnDone != nil {
+					doneMu.Lock()
+					opts.OnDone(results[i])
+					doneMu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range entries {
+		next <- i
+	}
+	close(next)
+	workers.Wait()
+	close(stopSignals)
+	<-signalsDone
+	return results, sig
+}
+
+// runEntry runs e as a guard.Runner and describes how it ended.
+func runEntry(ctx context.Context, e Entry, opts Options, stdout, stderr io.Writer, signals <-chan os.Signal) Result {
+	o := opts.Guard
+	o.Name = e.Name
+	o.Command = append([]string{e.Cmd}, e.Args...)
+	o.Acquire.TTL = time.Duration(e.TTL)
+	o.IfFree, o.Wait = e.AllowSkipIfHeld, !e.AllowSkipIfHeld
+	o.Signals = signals
+	o.Stdin, o.Stdout, o.Stderr = nil, stdout, stderr
+	o.TagOutput = true
+
+	if opts.WaitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.WaitTimeout)
+		defer cancel()
+	}
+	var started time.Time
+	var ran time.Duration
+	res, err := guard.New(o, guard.Hooks{
+		OnChildStart: func(int) {
+			if started.IsZero() {
+				started = time.Now()
+			}
+		},
+		OnChildExit: func(guard.Result) { ran = time.Since(started) },
+	}).Run(ctx)
+
+	out := Result{Name: e.Name, Acquired: res.Stage == guard.StageStart || res.Stage == guard.StageChild}
+	if res.Stage == guard.StageChild {
+		code := res.ExitCode
+		out.ExitCode, out.DurationMS = &code, ran.Milliseconds()
+	}
+	if res.Signal != nil {
+		out.Signal = res.Signal.String()
+	}
+	var held *lock.HeldError
+	switch {
+	case res.Skipped != nil:
+		out.Skipped, out.Holder = true, holderOf(res.Skipped.Lock)
+	case errors.Is(err, context.Canceled):
+		out.Error = ErrCancelled.Error()
+	case errors.As(err, &held):
+		out.Holder, out.Error = holderOf(held.Lock), err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		out.Error = err.Error()
+		if lf := heldBy(o.RootDir, e.Name); lf != nil {
+			out.Holder = holderOf(lf)
+		}
+	case err != nil:
+		out.Error = err.Error()
+	case res.Lost != nil:
+		out.Error = "lock lost: " + res.Lost.Error()
+	case res.Vanished != nil:
+		out.Error = res.Vanished.Error()
+	}
+	return out
+}
+
+// heldBy returns a live holder of the lock on name, or nil if there is
+// none.
+func heldBy(rootDir, name string) *lockfile.Lock {
+	holders, err := lock.Holders(rootDir, name)
+	if err != nil || len(holders) == 0 {
+		return nil
+	}
+	return holders[0]
+}
+
+// holderOf describes the holder of lf.
+func holderOf(lf *lockfile.Lock) *Holder {
+	if lf == nil {
+		return nil
+	}
+	return &Holder{Owner: lf.Owner, Host: lf.Host, PID: lf.PID, AgentID: lf.AgentID, AcquiredAt: lf.AcquiredAt}
+}
+
+// lockedWriter serializes writes to w from the commands running at once.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,182 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/guard"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func setupRoot(t *testing.T) string {
+	t.Helper()
+	rootDir := t.TempDir()
+	if err := root.EnsureDirs(rootDir); err != nil {
+		t.Fatal(err)
+	}
+	return rootDir
+}
+
+// writeHolder makes name held by someone else, alive: the test process on
+// another host.
+func writeHolder(t *testing.T, rootDir, name string) {
+	t.Helper()
+	if err := lockfile.Write(root.LockFilePath(rootDir, name), &lockfile.Lock{
+		Version: 1, Name: name, Owner: "other", Host: "other-host", PID: os.Getpid(), AcquiredAt: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func sh(name, script string) Entry {
+	return Entry{Name: name, Cmd: "sh", Args: []string{"-c", script}}
+}
+
+func TestParse(t *testing.T) {
+	entries, err := Parse(strings.NewReader(`[
+		{"name": "build", "ttl": "5m", "cmd": "make", "args": ["all"]},
+		{"name": "docs", "ttl": 30, "cmd": "make", "allow_skip_if_held": true}
+	]`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(entries) != 2 || time.Duration(entries[0].TTL) != 5*time.Minute || time.Duration(entries[1].TTL) != 30*time.Second ||
+		entries[0].Args[0] != "all" || !entries[1].AllowSkipIfHeld {
+		t.Errorf("Parse() = %+v", entries)
+	}
+
+	for _, plan := range []string{
+		``,
+		`[]`,
+		`{"name": "build", "cmd": "make"}`,
+		`[{"name": "build", "cmd": "make", "timeout": "5m"}]`,
+		`[{"name": "../build", "cmd": "make"}]`,
+		`[{"name": "build"}]`,
+		`[{"name": "build", "cmd": "make", "ttl": "-5m"}]`,
+		`[{"name": "build", "cmd": "make"}, {"name": "build", "cmd": "make"}]`,
+	} {
+		if _, err := Parse(strings.NewReader(plan)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", plan)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	rootDir := setupRoot(t)
+	var stdout, stderr bytes.Buffer
+	aLock := root.LockFilePath(rootDir, "a")
+	results, sig := Run(context.Background(), []Entry{
+		sh("a", "test -e "+aLock+" && echo held"),
+		// a's lock is released before the next entry starts
+		sh("b", "test ! -e "+aLock+" && echo released >&2; exit 3"),
+		{Name: "c", Cmd: filepath.Join(t.TempDir(), "missing")},
+	}, Options{Guard: guard.Options{RootDir: rootDir, Stdout: &stdout, Stderr: &stderr}, Signals: make(chan os.Signal)})
+	if sig != nil {
+		t.Errorf("sig = %v, want none", sig)
+	}
+	if stdout.String() != "[a] held\n" || stderr.String() != "[b] released\n" {
+		t.Errorf("stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if a := results[0]; !a.Acquired || a.ExitCode == nil || *a.ExitCode != 0 || !a.OK() {
+		t.Errorf("a = %+v, want acquired and exit 0", a)
+	}
+	if b := results[1]; b.ExitCode == nil || *b.ExitCode != 3 || b.OK() {
+		t.Errorf("b = %+v, want exit 3", b)
+	}
+	if c := results[2]; c.ExitCode != nil || c.Error == "" || c.OK() {
+		t.Errorf("c = %+v, want an error and no exit code", c)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if _, err := os.Stat(root.LockFilePath(rootDir, name)); !os.IsNotExist(err) {
+			t.Errorf("lock %s not released: %v", name, err)
+		}
+	}
+}
+
+func TestRun_Parallel(t *testing.T) {
+	rootDir := setupRoot(t)
+	dir := t.TempDir()
+	// Each waits for the other to start: only done if both run at once.
+	meet := func(me, other string) string {
+		return "touch " + filepath.Join(dir, me) + "; i=0; while [ ! -e " + filepath.Join(dir, other) +
+			" ]; do i=$((i+1)); [ $i -gt 500 ] && exit 1; sleep 0.01; done"
+	}
+	var done []string
+	results, _ := Run(context.Background(), []Entry{sh("a", meet("a", "b")), sh("b", meet("b", "a"))}, Options{
+		Guard: guard.Options{RootDir: rootDir}, Parallel: 2, Signals: make(chan os.Signal),
+		OnDone: func(r Result) { done = append(done, r.Name) },
+	})
+	for _, r := range results {
+		if !r.OK() {
+			t.Errorf("%s = %+v, want both to meet", r.Name, r)
+		}
+	}
+	if len(done) != 2 {
+		t.Errorf("OnDone called for %v, want both", done)
+	}
+}
+
+func TestRun_Held(t *testing.T) {
+	rootDir := setupRoot(t)
+	writeHolder(t, rootDir, "docs")
+	writeHolder(t, rootDir, "build")
+
+	skip := Entry{Name: "docs", Cmd: "true", AllowSkipIfHeld: true}
+	results, _ := Run(context.Background(), []Entry{skip, {Name: "build", Cmd: "true"}}, Options{
+		Guard: guard.Options{RootDir: rootDir}, WaitTimeout: 100 * time.Millisecond, Signals: make(chan os.Signal),
+	})
+
+	if docs := results[0]; !docs.Skipped || docs.Acquired || docs.Holder == nil || docs.Holder.Owner != "other" || !docs.OK() {
+		t.Errorf("docs = %+v, want skipped with its holder", docs)
+	}
+	if build := results[1]; build.Acquired || build.Error == "" || build.Holder == nil || build.Holder.Owner != "other" || build.OK() {
+		t.Errorf("build = %+v, want a timed-out wait with its holder", build)
+	}
+}
+
+func TestRun_Signal(t *testing.T) {
+	rootDir := setupRoot(t)
+	started := filepath.Join(t.TempDir(), "started")
+	signals := make(chan os.Signal, 1)
+	go func() {
+		for {
+			if _, err := os.Stat(started); err == nil {
+				signals <- syscall.SIGINT
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	begin := time.Now()
+	results, sig := Run(context.Background(), []Entry{
+		sh("a", "touch "+started+"; sleep 10"),
+		{Name: "b", Cmd: "true"},
+	}, Options{Guard: guard.Options{RootDir: rootDir}, Signals: signals})
+	if time.Since(begin) > 5*time.Second {
+		t.Errorf("Run took %s; the signal should have stopped it", time.Since(begin))
+	}
+	if sig != syscall.SIGINT {
+		t.Errorf("sig = %v, want SIGINT", sig)
+	}
+	if a := results[0]; a.Signal == "" || a.ExitCode == nil || *a.ExitCode != 130 {
+		t.Errorf("a = %+v, want the SIGINT forwarded", a)
+	}
+	if b := results[1]; b.Acquired || b.Error != ErrCancelled.Error() {
+		t.Errorf("b = %+v, want cancelled", b)
+	}
+	if _, err := os.Stat(root.LockFilePath(rootDir, "a")); !os.IsNotExist(err) {
+		t.Errorf("lock a not released: %v", err)
+	}
+}
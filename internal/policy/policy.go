@@ -0,0 +1,129 @@
+// Package policy loads per-lock TTL rules from <root>/policy.json.
+//
+// The file maps lock name patterns to rules:
+//
+//	{"locks": {
+//	    "deploy-*": {"default_ttl": "30m", "max_ttl": "2h", "require_ttl": true},
+//	    "build":    {"default_ttl": "10m"}
+//	}}
+//
+// A pattern is an exact name or a path.Match glob; "*" doesn't cross the
+// "/" of a namespaced name, so "team/*" matches "team/build" but not
+// "team/web/build". An exact entry wins over globs; among matching globs
+// the longest pattern wins.
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/config"
+)
+
+// FileName is the name of the policy file inside the lokt root.
+const FileName = "policy.json"
+
+// Rule is the TTL policy for the names matching one pattern.
+type Rule struct {
+	// DefaultTTL is used when a lock or freeze is taken without a TTL.
+	DefaultTTL config.Duration `json:"default_ttl,omitempty"`
+	// MaxTTL is the longest TTL allowed. Longer ones are rejected, or
+	// shortened to MaxTTL with ClampTTL.
+	MaxTTL config.Duration `json:"max_ttl,omitempty"`
+	// RequireTTL rejects a lock without a TTL (after DefaultTTL).
+	RequireTTL bool `json:"require_ttl,omitempty"`
+	// ClampTTL shortens a TTL over MaxTTL instead of rejecting it.
+	ClampTTL bool `json:"clamp_ttl,omitempty"`
+}
+
+// Policy is the JSON structure of <root>/policy.json.
+type Policy struct {
+	// Locks maps a name pattern to its rule.
+	Locks map[string]Rule `json:"locks,omitempty"`
+}
+
+// Path returns the path to the policy file for a root.
+func Path(rootDir string) string {
+	return filepath.Join(rootDir, FileName)
+}
+
+// Load reads <rootDir>/policy.json. A missing file is not an error and
+// returns an empty Policy.
+func Load(rootDir string) (*Policy, error) {
+	data, err := os.ReadFile(Path(rootDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Policy{}, nil
+		}
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", FileName, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", FileName, err)
+	}
+	return &p, nil
+}
+
+// validate rejects patterns that can never match and contradictory rules.
+func (p *Policy) validate() error {
+	for pattern, r := range p.Locks {
+		if pattern == "" {
+			return errors.New("locks: empty pattern")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("locks.%s: bad pattern: %w", pattern, err)
+		}
+		if r.DefaultTTL < 0 || r.MaxTTL < 0 {
+			return fmt.Errorf("locks.%s: default_ttl and max_ttl must not be negative", pattern)
+		}
+		if r.MaxTTL > 0 && r.DefaultTTL > r.MaxTTL {
+			return fmt.Errorf("locks.%s: default_ttl %s exceeds max_ttl %s",
+				pattern, time.Duration(r.DefaultTTL), time.Duration(r.MaxTTL))
+		}
+	}
+	return nil
+}
+
+// Patterns returns the patterns of p, sorted.
+func (p *Policy) Patterns() []string {
+	patterns := make([]string, 0, len(p.Locks))
+	for pattern := range p.Locks {
+		patterns = append(patterns, pattern)
+	}
+	slices.Sort(patterns)
+	return patterns
+}
+
+// Match returns the rule for name and the pattern it came from, or false if
+// no pattern matches.
+func (p *Policy) Match(name string) (string, Rule, bool) {
+	if r, ok := p.Locks[name]; ok {
+		return name, r, true
+	}
+	best := ""
+	for pattern := range p.Locks {
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			continue // exact, and not name
+		}
+		if ok, _ := path.Match(pattern, name); !ok {
+			continue
+		}
+		if best == "" || len(pattern) > len(best) || (len(pattern) == len(best) && pattern < best) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return "", Rule{}, false
+	}
+	return best, p.Locks[best], true
+}
@@ -0,0 +1,86 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writePolicy(t *testing.T, dir, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad_Missing(t *testing.T) {
+	p, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if _, _, ok := p.Match("anything"); ok {
+		t.Error("an empty policy should match nothing")
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name, data, wantErr string
+	}{
+		{"syntax", `{"locks": `, "parse policy.json"},
+		{"bad pattern", `{"locks": {"deploy-[": {}}}`, "bad pattern"},
+		{"negative", `{"locks": {"x": {"max_ttl": "-1m"}}}`, "must not be negative"},
+		{"default over max", `{"locks": {"x": {"default_ttl": "2h", "max_ttl": "1h"}}}`, "exceeds max_ttl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePolicy(t, dir, tt.data)
+			if _, err := Load(dir); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	dir := t.TempDir()
+	writePolicy(t, dir, `{"locks": {
+		"deploy-*":      {"default_ttl": "30m"},
+		"deploy-prod-*": {"max_ttl": "1h"},
+		"deploy-prod-eu": {"require_ttl": true},
+		"team/*":        {"default_ttl": "5m"}
+	}}`)
+	p, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name, wantPattern string
+	}{
+		{"deploy-staging", "deploy-*"},
+		{"deploy-prod-us", "deploy-prod-*"},
+		{"deploy-prod-eu", "deploy-prod-eu"},
+		{"team/build", "team/*"},
+		{"team/web/build", ""},
+		{"build", ""},
+	}
+	for _, tt := range tests {
+		pattern, _, ok := p.Match(tt.name)
+		if pattern != tt.wantPattern || ok != (tt.wantPattern != "") {
+			t.Errorf("Match(%q) = %q, %v; want %q", tt.name, pattern, ok, tt.wantPattern)
+		}
+	}
+	if _, r, _ := p.Match("deploy-x"); time.Duration(r.DefaultTTL) != 30*time.Minute {
+		t.Errorf("deploy-x rule = %+v, want default_ttl 30m", r)
+	}
+
+	want := []string{"deploy-*", "deploy-prod-*", "deploy-prod-eu", "team/*"}
+	if got := p.Patterns(); !slices.Equal(got, want) {
+		t.Errorf("Patterns() = %v, want %v", got, want)
+	}
+}
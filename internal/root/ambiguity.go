@@ -0,0 +1,143 @@
+package root
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Candidate is a root that discovery could resolve to from here, with what
+// it holds.
+type Candidate struct {
+	Path    string
+	Method  DiscoveryMethod
+	Locks   int // lock files in it
+	Freezes int // freeze files in it
+}
+
+// Occupied reports whether c holds any locks or freezes.
+func (c Candidate) Occupied() bool {
+	return c.Locks > 0 || c.Freezes > 0
+}
+
+// content describes what c holds, as "3 locks and 1 freeze".
+func (c Candidate) content() string {
+	var parts []string
+	if c.Locks > 0 {
+		parts = append(parts, plural(c.Locks, "lock", "locks"))
+	}
+	if c.Freezes > 0 {
+		parts = append(parts, plural(c.Freezes, "freeze", "freezes"))
+	}
+	return strings.Join(parts, " and ")
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
+
+// FindAll returns the root Find resolves to, first, followed by the other
+// candidates of repository discovery that exist here: $LOKT_ROOT, the git
+// common dir's root and ./.lokt, in that order of precedence. Each is
+// followed (see Follow) and listed once, with the locks and freezes in it.
+// Under a user or system scope only the scope's root is returned.
+func FindAll() ([]Candidate, error) {
+	path, method, err := FindWithMethod()
+	if err != nil {
+		return nil, err
+	}
+	cands := []Candidate{newCandidate(path, method)}
+	if method == MethodUserScope || method == MethodSystemScope {
+		return cands, nil
+	}
+
+	var others []Candidate
+	if envRoot := os.Getenv(EnvLoktRoot); envRoot != "" {
+		others = append(others, Candidate{Path: envRoot, Method: MethodEnvVar})
+	}
+	if gitRoot, err := findGitRoot(); err == nil {
+		others = append(others, Candidate{Path: filepath.Join(gitRoot, "lokt"), Method: MethodGit})
+	}
+	if cwd, err := getwdFn(); err == nil {
+		others = append(others, Candidate{Path: filepath.Join(cwd, DirName), Method: MethodLocalDir})
+	}
+	for _, c := range others {
+		if c.Method == method {
+			continue // the root in use
+		}
+		info, err := os.Stat(c.Path)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		followed, err := Follow(c.Path)
+		if err != nil || containsRoot(cands, followed) {
+			continue
+		}
+		cands = append(cands, newCandidate(followed, c.Method))
+	}
+	return cands, nil
+}
+
+// newCandidate returns the candidate at path, counting its content.
+func newCandidate(path string, method DiscoveryMethod) Candidate {
+	c := Candidate{Path: path, Method: method}
+	locks, _ := LockNames(path)
+	freezes, _ := Names(FreezesPath(path))
+	c.Locks, c.Freezes = len(locks), len(freezes)
+	return c
+}
+
+// containsRoot reports whether path is one of cands' roots.
+func containsRoot(cands []Candidate, path string) bool {
+	info, err := os.Stat(path)
+	for _, c := range cands {
+		if filepath.Clean(c.Path) == filepath.Clean(path) {
+			return true
+		}
+		if other, err2 := os.Stat(c.Path); err == nil && err2 == nil && os.SameFile(info, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// AmbiguityError reports roots besides the one in use that hold locks or
+// freezes: a process discovering from elsewhere, or without git, would use
+// one of them, and locks taken there don't exclude those taken here.
+type AmbiguityError struct {
+	Used   Candidate
+	Others []Candidate
+}
+
+func (e *AmbiguityError) Error() string {
+	var others []string
+	for _, c := range e.Others {
+		others = append(others, fmt.Sprintf("%s (%s) also contains %s", c.Path, c.Method, c.content()))
+	}
+	return fmt.Sprintf("lock root ambiguity: using %s (%s), but %s",
+		e.Used.Path, e.Used.Method, strings.Join(others, ", and "))
+}
+
+// Ambiguity returns an *AmbiguityError if any of cands, as returned by
+// FindAll, besides the first holds locks or freezes, and nil otherwise. A
+// root pinned with LOKT_ROOT or a scope is never ambiguous: whoever pinned
+// it chose it.
+func Ambiguity(cands []Candidate) error {
+	if len(cands) == 0 || (cands[0].Method != MethodGit && cands[0].Method != MethodLocalDir) {
+		return nil
+	}
+	var others []Candidate
+	for _, c := range cands[1:] {
+		if c.Occupied() {
+			others = append(others, c)
+		}
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	return &AmbiguityError{Used: cands[0], Others: others}
+}
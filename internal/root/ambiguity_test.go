@@ -0,0 +1,80 @@
+package root
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindAll(t *testing.T) {
+	t.Setenv(EnvLoktRoot, "")
+	t.Setenv(EnvLoktScope, "")
+	repoDir := t.TempDir()
+	initGitRepo(t, repoDir)
+	subDir := filepath.Join(repoDir, "sub")
+	for _, dir := range []string{
+		filepath.Join(repoDir, ".git", "lokt", LocksDir),
+		filepath.Join(subDir, DirName, LocksDir, "team"),
+		filepath.Join(subDir, DirName, FreezesDir),
+	} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{
+		filepath.Join(subDir, DirName, LocksDir, "build.json"),
+		filepath.Join(subDir, DirName, LocksDir, "team", "web.json"),
+		filepath.Join(subDir, DirName, FreezesDir, "deploy.json"),
+	} {
+		if err := os.WriteFile(f, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer withWorkingDir(t, subDir)()
+
+	cands, err := FindAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cands) != 2 || cands[0].Method != MethodGit || cands[0].Occupied() {
+		t.Fatalf("FindAll() = %+v, want the empty git root first", cands)
+	}
+	if c := cands[1]; c.Method != MethodLocalDir || c.Locks != 2 || c.Freezes != 1 {
+		t.Errorf("second candidate = %+v, want ./.lokt with 2 locks and 1 freeze", c)
+	}
+
+	var amb *AmbiguityError
+	if err := Ambiguity(cands); !errors.As(err, &amb) || len(amb.Others) != 1 {
+		t.Fatalf("Ambiguity() = %v, want the .lokt root", err)
+	} else if !strings.Contains(err.Error(), "(local) also contains 2 locks and 1 freeze") {
+		t.Errorf("Ambiguity() = %q", err)
+	}
+
+	// Pinned, the same roots aren't ambiguous
+	t.Setenv(EnvLoktRoot, filepath.Join(subDir, DirName))
+	cands, err = FindAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cands) != 2 || cands[0].Method != MethodEnvVar || cands[1].Method != MethodGit {
+		t.Fatalf("FindAll() with LOKT_ROOT = %+v", cands)
+	}
+	if err := Ambiguity(cands); err != nil {
+		t.Errorf("Ambiguity() with LOKT_ROOT = %v, want nil", err)
+	}
+}
+
+func TestAmbiguity_Empty(t *testing.T) {
+	cands := []Candidate{
+		{Path: "/r/.git/lokt", Method: MethodGit, Locks: 4},
+		{Path: "/r/.lokt", Method: MethodLocalDir},
+	}
+	if err := Ambiguity(cands); err != nil {
+		t.Errorf("Ambiguity() = %v, want nil for an empty second root", err)
+	}
+	if err := Ambiguity(nil); err != nil {
+		t.Errorf("Ambiguity(nil) = %v", err)
+	}
+}
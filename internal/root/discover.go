@@ -0,0 +1,90 @@
+package root
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DefaultDiscoverDepth is how many directories below its starting point
+// DiscoverAll looks for .lokt roots.
+const DefaultDiscoverDepth = 6
+
+// skipDiscoverDirs are directories DiscoverAll doesn't descend into:
+// vendored and installed dependencies, which may ship .lokt directories of
+// their own, and git's directory, whose root DiscoverAll finds directly.
+var skipDiscoverDirs = []string{"vendor", "node_modules", ".git"}
+
+// WorktreeTop returns the top level of the git worktree containing the
+// working directory, or the working directory itself outside git.
+func WorktreeTop() (string, error) {
+	if out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output(); err == nil {
+		if top := strings.TrimSpace(string(out)); top != "" {
+			return filepath.Clean(top), nil
+		}
+	}
+	return getwdFn()
+}
+
+// DiscoverAll returns the roots found from dir: the git common dir's root
+// (<git common dir>/lokt) if dir is in a git worktree and that root exists,
+// then every .lokt directory at most maxDepth levels below dir, in lexical
+// order. Each is listed once, as found; callers Follow them. Directories
+// that can't be read are skipped, as are those in skipDiscoverDirs and the
+// insides of roots.
+func DiscoverAll(dir string, maxDepth int) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var roots []string
+	if gitDir, err := gitCommonDir(dir); err == nil {
+		if info, err := os.Stat(filepath.Join(gitDir, "lokt")); err == nil && info.IsDir() {
+			roots = append(roots, filepath.Join(gitDir, "lokt"))
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return fs.SkipDir // unreadable: leave it out
+		}
+		if !d.IsDir() || path == dir {
+			return nil
+		}
+		if d.Name() == DirName {
+			if !slices.Contains(roots, path) {
+				roots = append(roots, path)
+			}
+			return fs.SkipDir
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if slices.Contains(skipDiscoverDirs, d.Name()) || strings.Count(rel, string(filepath.Separator))+1 >= maxDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.SkipDir) {
+		return roots, err
+	}
+	return roots, nil
+}
+
+// gitCommonDir returns the git common dir of the worktree containing dir.
+func gitCommonDir(dir string) (string, error) {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return "", err
+	}
+	gitDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	return filepath.Clean(gitDir), nil
+}
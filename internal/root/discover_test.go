@@ -0,0 +1,69 @@
+package root
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDiscoverAll(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{
+		"svc/api/.lokt/locks",
+		"svc/web/.lokt",
+		".lokt",
+		"node_modules/pkg/.lokt",
+		"vendor/pkg/.lokt",
+		"a/b/c/d/e/f/.lokt", // 7 levels down
+		"svc/api/.lokt/nested/.lokt",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := DiscoverAll(dir, DefaultDiscoverDepth)
+	if err != nil {
+		t.Fatalf("DiscoverAll() error = %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, ".lokt"),
+		filepath.Join(dir, "svc/api/.lokt"),
+		filepath.Join(dir, "svc/web/.lokt"),
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("DiscoverAll() = %q, want %q", got, want)
+	}
+
+	deep, _ := DiscoverAll(dir, 7)
+	if !slices.Contains(deep, filepath.Join(dir, "a/b/c/d/e/f/.lokt")) {
+		t.Errorf("DiscoverAll(depth 7) = %q, want the root 7 levels down", deep)
+	}
+}
+
+func TestDiscoverAll_GitRoot(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir()) // as git reports it
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Command("git", "init", "-q", dir).Run(); err != nil {
+		t.Skipf("git unavailable: %v", err)
+	}
+	gitRoot := filepath.Join(dir, ".git", "lokt")
+	if err := os.MkdirAll(gitRoot, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "svc", ".lokt"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := DiscoverAll(filepath.Join(dir, "svc"), DefaultDiscoverDepth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != gitRoot || got[1] != filepath.Join(dir, "svc", ".lokt") {
+		t.Errorf("DiscoverAll() = %q, want the git root first, then svc/.lokt", got)
+	}
+}
@@ -0,0 +1,77 @@
+package root
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// EnvReadOnly set to anything but "" or "0" makes CheckWritable report every
+// root read-only, so nothing changes it (lokt --read-only, for inspection
+// scripts).
+const EnvReadOnly = "LOKT_READ_ONLY"
+
+// ErrReadOnly is matched by the error CheckWritable returns.
+var ErrReadOnly = errors.New("lokt root is read-only")
+
+// ReadOnlyError is a root that can't be written: mounted read-only, without
+// write permission, or read-only by request (Forced).
+type ReadOnlyError struct {
+	Root   string
+	Forced bool
+	Err    error // why writing failed; nil if Forced
+}
+
+func (e *ReadOnlyError) Error() string {
+	why := ""
+	if e.Forced {
+		why = " (read-only mode)"
+	} else if e.Err != nil {
+		why = fmt.Sprintf(" (%v)", e.Err)
+	}
+	return fmt.Sprintf("lokt root %s is read-only%s; status and audit queries are available but lock operations are not", e.Root, why)
+}
+
+func (e *ReadOnlyError) Unwrap() error { return ErrReadOnly }
+
+// ReadOnly reports whether read-only mode is forced through EnvReadOnly.
+func ReadOnly() bool {
+	v := os.Getenv(EnvReadOnly)
+	return v != "" && v != "0"
+}
+
+// CheckWritable returns a *ReadOnlyError if root can't be changed: read-only
+// mode is on, or root (or, while it doesn't exist yet, the directory it
+// would be created in) or its locks directory isn't writable. Commands
+// that change the root call it before starting, instead of failing part way
+// with whatever error the first write gets; it creates nothing.
+func CheckWritable(root string) error {
+	if ReadOnly() {
+		return &ReadOnlyError{Root: root, Forced: true}
+	}
+	if _, err := os.Stat(LocksPath(root)); err == nil {
+		if err := readOnlyErr(root, writable(LocksPath(root))); err != nil {
+			return err
+		}
+	}
+	dir := root
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return readOnlyErr(root, writable(dir))
+}
+
+// readOnlyErr returns a *ReadOnlyError for root if err says a directory of
+// it can't be written, nil otherwise.
+func readOnlyErr(root string, err error) error {
+	if errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS) {
+		return &ReadOnlyError{Root: root, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+//go:build unix
+
+package root
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckWritable(t *testing.T) {
+	t.Setenv(EnvReadOnly, "")
+	dir := t.TempDir()
+	if err := CheckWritable(dir); err != nil {
+		t.Errorf("CheckWritable(writable root) = %v", err)
+	}
+	if err := CheckWritable(filepath.Join(dir, "not", "yet", ".lokt")); err != nil {
+		t.Errorf("CheckWritable(missing root under a writable dir) = %v", err)
+	}
+}
+
+func TestCheckWritable_Forced(t *testing.T) {
+	t.Setenv(EnvReadOnly, "1")
+	dir := t.TempDir()
+	err := CheckWritable(dir)
+	var ro *ReadOnlyError
+	if !errors.As(err, &ro) || !ro.Forced || !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("CheckWritable() = %v, want a forced ReadOnlyError", err)
+	}
+	if !strings.Contains(err.Error(), "status and audit queries are available") {
+		t.Errorf("error = %q, want it to say what still works", err)
+	}
+	t.Setenv(EnvReadOnly, "0")
+	if err := CheckWritable(dir); err != nil {
+		t.Errorf("LOKT_READ_ONLY=0: CheckWritable() = %v", err)
+	}
+}
+
+func TestCheckWritable_NoPermission(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to any directory")
+	}
+	t.Setenv(EnvReadOnly, "")
+	parent := t.TempDir()
+	dir := filepath.Join(parent, ".lokt")
+	if err := os.MkdirAll(LocksPath(dir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(LocksPath(dir), 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chmod(LocksPath(dir), 0700) }()
+
+	var ro *ReadOnlyError
+	if err := CheckWritable(dir); !errors.As(err, &ro) || ro.Forced || ro.Root != dir {
+		t.Errorf("CheckWritable(read-only locks dir) = %v", err)
+	}
+
+	missing := filepath.Join(t.TempDir(), "ro")
+	if err := os.Mkdir(missing, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chmod(missing, 0700) }()
+	if err := CheckWritable(filepath.Join(missing, ".lokt")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("CheckWritable(missing root under a read-only dir) = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(missing, ".lokt")); !os.IsNotExist(err) {
+		t.Error("CheckWritable created the root")
+	}
+}
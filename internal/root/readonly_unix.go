@@ -0,0 +1,10 @@
+//go:build unix
+
+package root
+
+import "syscall"
+
+// writable reports whether this process may create files in dir.
+func writable(dir string) error {
+	return syscall.Access(dir, 0x2) // W_OK
+}
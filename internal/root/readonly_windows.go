@@ -0,0 +1,16 @@
+//go:build windows
+
+package root
+
+import "os"
+
+// writable reports whether this process may create files in dir, by
+// creating one.
+func writable(dir string) error {
+	f, err := os.CreateTemp(dir, ".lokt-probe-*")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,130 @@
+package root
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MetaFile holds root-level metadata. Today it only records relocation:
+// lokt relocate writes it at the old root so that processes still pointed
+// there (LOKT_ROOT, long-running guards) find the new location.
+const MetaFile = "meta.json"
+
+// Relocation states recorded in the meta file.
+const (
+	// StateRelocating quiesces the root while lokt relocate copies it.
+	// Follow waits for it to clear.
+	StateRelocating = "relocating"
+	// StateRelocated means the root now lives at RelocatedTo.
+	StateRelocated = "relocated"
+)
+
+// Redirect modes for a relocated root.
+const (
+	// RedirectFollow transparently uses the new root.
+	RedirectFollow = "follow"
+	// RedirectFail refuses to operate on the old root.
+	RedirectFail = "fail"
+)
+
+const (
+	// maxRedirects bounds chains of relocations (and catches cycles).
+	maxRedirects = 8
+	// relocationWait bounds how long Follow waits for an in-progress
+	// relocation before giving up.
+	relocationWait = 30 * time.Second
+	// staleRelocation is the age after which an unfinished relocation is
+	// assumed to have crashed and is ignored.
+	staleRelocation = 5 * time.Minute
+)
+
+// Injectable for testing.
+var (
+	relocationPoll = 20 * time.Millisecond
+	nowFn          = time.Now
+)
+
+// Meta is the JSON structure of <root>/meta.json.
+type Meta struct {
+	RelocatedTo string     `json:"relocated_to,omitempty"`
+	State       string     `json:"state,omitempty"`
+	Redirect    string     `json:"redirect,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	RelocatedAt *time.Time `json:"relocated_at,omitempty"`
+}
+
+// ErrRelocating is returned when an in-progress relocation does not finish
+// within the wait bound.
+var ErrRelocating = errors.New("lock root is being relocated")
+
+// RelocatedError is returned for a root relocated with RedirectFail.
+type RelocatedError struct {
+	From, To string
+}
+
+func (e *RelocatedError) Error() string {
+	return fmt.Sprintf("lock root %s was relocated to %s; set %s=%s", e.From, e.To, EnvLoktRoot, e.To)
+}
+
+// MetaPath returns the path to the meta file for a root.
+func MetaPath(root string) string {
+	return filepath.Join(root, MetaFile)
+}
+
+// ReadMeta reads <root>/meta.json. A missing file returns os.ErrNotExist.
+func ReadMeta(root string) (*Meta, error) {
+	data, err := os.ReadFile(MetaPath(root)) //nolint:gosec // G304: path is controlled
+	if err != nil {
+		return nil, err
+	}
+	var m Meta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", MetaFile, err)
+	}
+	return &m, nil
+}
+
+// Follow returns the root that dir currently resolves to. It follows
+// relocation markers written by lokt relocate, waits out a relocation in
+// progress, and returns a RelocatedError if the marker says to fail rather
+// than follow. A root without a marker resolves to itself.
+func Follow(dir string) (string, error) {
+	for hops := 0; hops < maxRedirects; hops++ {
+		m, err := waitRelocation(dir)
+		if err != nil {
+			return "", err
+		}
+		if m == nil || m.State != StateRelocated || m.RelocatedTo == "" {
+			return dir, nil
+		}
+		if m.Redirect == RedirectFail {
+			return "", &RelocatedError{From: dir, To: m.RelocatedTo}
+		}
+		dir = m.RelocatedTo
+	}
+	return "", fmt.Errorf("too many relocation redirects from %s", dir)
+}
+
+// waitRelocation reads the meta file of dir, polling while a relocation is
+// in progress. It returns nil when there is no (usable) marker.
+func waitRelocation(dir string) (*Meta, error) {
+	deadline := nowFn().Add(relocationWait)
+	for {
+		m, err := ReadMeta(dir)
+		if err != nil {
+			return nil, nil //nolint:nilerr // no readable marker: not relocated
+		}
+		if m.State != StateRelocating || nowFn().Sub(m.StartedAt) > staleRelocation {
+			return m, nil
+		}
+		if nowFn().After(deadline) {
+			return nil, fmt.Errorf("%w to %s (started %s); remove %s if the relocation was abandoned",
+				ErrRelocating, m.RelocatedTo, m.StartedAt.Format(time.RFC3339), MetaPath(dir))
+		}
+		time.Sleep(relocationPoll)
+	}
+}
@@ -0,0 +1,129 @@
+package root
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeMetaFile(t *testing.T, dir string, m Meta) {
+	t.Helper()
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(MetaPath(dir), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollow_NoMarker(t *testing.T) {
+	dir := t.TempDir()
+	got, err := Follow(dir)
+	if err != nil || got != dir {
+		t.Errorf("Follow() = %q, %v; want %q", got, err, dir)
+	}
+}
+
+func TestFollow_Chain(t *testing.T) {
+	a, b, c := t.TempDir(), t.TempDir(), t.TempDir()
+	writeMetaFile(t, a, Meta{RelocatedTo: b, State: StateRelocated, Redirect: RedirectFollow})
+	writeMetaFile(t, b, Meta{RelocatedTo: c, State: StateRelocated})
+
+	got, err := Follow(a)
+	if err != nil || got != c {
+		t.Errorf("Follow() = %q, %v; want %q", got, err, c)
+	}
+}
+
+func TestFollow_RedirectFail(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	writeMetaFile(t, a, Meta{RelocatedTo: b, State: StateRelocated, Redirect: RedirectFail})
+
+	_, err := Follow(a)
+	var relocated *RelocatedError
+	if !errors.As(err, &relocated) || relocated.To != b {
+		t.Fatalf("expected RelocatedError to %s, got %v", b, err)
+	}
+	if want := EnvLoktRoot + "=" + b; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q should tell the user to set %s", err, want)
+	}
+}
+
+func TestFollow_Cycle(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	writeMetaFile(t, a, Meta{RelocatedTo: b, State: StateRelocated})
+	writeMetaFile(t, b, Meta{RelocatedTo: a, State: StateRelocated})
+
+	if _, err := Follow(a); err == nil {
+		t.Error("expected an error for a relocation cycle")
+	}
+}
+
+func TestFollow_WaitsForRelocation(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	writeMetaFile(t, a, Meta{RelocatedTo: b, State: StateRelocating, StartedAt: time.Now()})
+
+	done, _ := json.Marshal(Meta{RelocatedTo: b, State: StateRelocated})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		// Swap atomically, as lokt relocate does, so Follow never sees a torn file.
+		tmp := MetaPath(a) + ".tmp"
+		_ = os.WriteFile(tmp, done, 0600)
+		_ = os.Rename(tmp, MetaPath(a))
+	}()
+
+	start := time.Now()
+	got, err := Follow(a)
+	if err != nil || got != b {
+		t.Fatalf("Follow() = %q, %v; want %q", got, err, b)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("Follow should have waited for the relocation to finish")
+	}
+}
+
+func TestFollow_RelocationTimeout(t *testing.T) {
+	a := t.TempDir()
+	writeMetaFile(t, a, Meta{RelocatedTo: "/elsewhere", State: StateRelocating, StartedAt: time.Now()})
+
+	// Jump the clock past the wait bound on the second read.
+	base := time.Now()
+	calls := 0
+	nowFn = func() time.Time {
+		calls++
+		if calls > 2 {
+			return base.Add(relocationWait + time.Second)
+		}
+		return base
+	}
+	defer func() { nowFn = time.Now }()
+
+	if _, err := Follow(a); !errors.Is(err, ErrRelocating) {
+		t.Errorf("expected ErrRelocating, got %v", err)
+	}
+}
+
+func TestFollow_AbandonedRelocationIgnored(t *testing.T) {
+	a := t.TempDir()
+	writeMetaFile(t, a, Meta{RelocatedTo: "/elsewhere", State: StateRelocating, StartedAt: time.Now().Add(-time.Hour)})
+
+	got, err := Follow(a)
+	if err != nil || got != a {
+		t.Errorf("Follow() = %q, %v; want the old root %q", got, err, a)
+	}
+}
+
+func TestFindWithMethod_FollowsRelocation(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	writeMetaFile(t, a, Meta{RelocatedTo: b, State: StateRelocated})
+	t.Setenv(EnvLoktRoot, a)
+
+	path, method, err := FindWithMethod()
+	if err != nil || path != b || method != MethodEnvVar {
+		t.Errorf("FindWithMethod() = %q, %v, %v; want %q via env", path, method, err, b)
+	}
+}
@@ -2,10 +2,17 @@
 package root
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
 )
 
 const (
@@ -13,6 +20,14 @@ const (
 	DirName     = ".lokt"
 	LocksDir    = "locks"
 	FreezesDir  = "freezes"
+	WaitersDir  = "waiters"
+	SharedDir   = "shared"
+	IntentsDir  = "intents"
+	SessionsDir = "sessions"
+	SlotsDir    = "slots"
+	// ReservationsDir holds reservations of names, one directory per name
+	// (see lock.Reserve).
+	ReservationsDir = "reservations"
 )
 
 // Injectable function for testability.
@@ -28,6 +43,10 @@ const (
 	MethodGit
 	// MethodLocalDir indicates root was set to .lokt/ in current directory.
 	MethodLocalDir
+	// MethodUserScope indicates the user scope root (LOKT_SCOPE=user).
+	MethodUserScope
+	// MethodSystemScope indicates the system scope root (LOKT_SCOPE=system).
+	MethodSystemScope
 )
 
 // String returns a human-readable name for the discovery method.
@@ -39,15 +58,22 @@ func (m DiscoveryMethod) String() string {
 		return "git"
 	case MethodLocalDir:
 		return "local"
+	case MethodUserScope:
+		return "user"
+	case MethodSystemScope:
+		return "system"
 	default:
 		return "unknown"
 	}
 }
 
 // Find locates the Lokt root directory using the following precedence:
+// 0. LOKT_SCOPE=user or system: that scope's root (see UserRoot, SystemRoot)
 // 1. LOKT_ROOT environment variable
 // 2. Git common dir (for worktree support): .git/lokt/
 // 3. .lokt/ in current working directory
+//
+// A root moved by lokt relocate resolves to its new location (see Follow).
 func Find() (string, error) {
 	path, _, err := FindWithMethod()
 	return path, err
@@ -56,6 +82,29 @@ func Find() (string, error) {
 // FindWithMethod locates the Lokt root directory and reports which method was used.
 // Returns the path, discovery method, and any error.
 func FindWithMethod() (string, DiscoveryMethod, error) {
+	path, method, err := discover()
+	if err != nil {
+		return path, method, err
+	}
+	path, err = Follow(path)
+	return path, method, err
+}
+
+func discover() (string, DiscoveryMethod, error) {
+	// 0. A machine-wide scope replaces repository discovery
+	scope, err := ParseScope(os.Getenv(EnvLoktScope))
+	if err != nil {
+		return "", MethodEnvVar, fmt.Errorf("%s: %w", EnvLoktScope, err)
+	}
+	switch scope {
+	case ScopeUser:
+		path, err := UserRoot()
+		return path, MethodUserScope, err
+	case ScopeSystem:
+		path, _, err := SystemRoot()
+		return path, MethodSystemScope, err
+	}
+
 	// 1. Check environment variable
 	if envRoot := os.Getenv(EnvLoktRoot); envRoot != "" {
 		return envRoot, MethodEnvVar, nil
@@ -95,12 +144,13 @@ func findGitRoot() (string, error) {
 	return gitDir, nil
 }
 
-// EnsureDirs creates the root, locks, and freezes directories if they don't exist.
+// EnsureDirs creates the root, locks, and freezes directories if they don't
+// exist, shared like the root if it is (see MkdirAll).
 func EnsureDirs(root string) error {
-	if err := os.MkdirAll(filepath.Join(root, LocksDir), 0700); err != nil {
+	if err := MkdirAll(root, filepath.Join(root, LocksDir)); err != nil {
 		return err
 	}
-	return os.MkdirAll(filepath.Join(root, FreezesDir), 0700)
+	return MkdirAll(root, filepath.Join(root, FreezesDir))
 }
 
 // LocksPath returns the path to the locks directory.
@@ -108,9 +158,91 @@ func LocksPath(root string) string {
 	return filepath.Join(root, LocksDir)
 }
 
-// LockFilePath returns the path to a specific lock file.
+// LockFilePath returns the path to a specific lock file. In a sharded root
+// (see ShardLevel) that is locks/@<shard>/<name>.json, unless the file is
+// still at its flat location from before sharding was turned on. That
+// location is only for reading and removing the old file: a new one is
+// created at CreateLockFilePath. Here and in the other paths named after a
+// lock, a name too long for a file name is replaced by its
+// lockfile.FileStem.
 func LockFilePath(root, name string) string {
-	return filepath.Join(root, LocksDir, name+".json")
+	flat := filepath.Join(root, LocksDir, lockfile.FileStem(name)+".json")
+	level := ShardLevel(root)
+	if level == 0 {
+		return flat
+	}
+	if _, err := os.Lstat(flat); err == nil {
+		return flat
+	}
+	return ShardedLockFilePath(root, name, level)
+}
+
+// CreateLockFilePath returns where a new lock file of name is created: its
+// place at the root's shard level, whatever LockFilePath finds.
+func CreateLockFilePath(root, name string) string {
+	return ShardedLockFilePath(root, name, ShardLevel(root))
+}
+
+// Names returns the names that have a <name>.json file under dir (such as
+// FreezesPath; see LockNames for LocksPath), in directory order. Namespaced names ("team/web/build")
+// live in subdirectories and are returned with / separators. The error is
+// from reading dir itself (os.ErrNotExist if it is missing); unreadable
+// subdirectories are skipped.
+func Names(dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".json") {
+			return nil
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			names = append(names, filepath.ToSlash(strings.TrimSuffix(rel, ".json")))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// NameDirs returns the per-name directories under dir (a namespace such as
+// WaitersDir), with / separators. A namespaced name's directory is nested in
+// its parents', so every directory is listed; children come before their
+// parents, letting a caller that removes empty ones clear a whole path in
+// one pass. Errors are as for Names.
+func NameDirs(dir string) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() || path == dir {
+			return nil
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	slices.SortStableFunc(names, comparePostorder) // WalkDir visits parents first
+	return names, err
+}
+
+// comparePostorder orders names by segment, a name after its descendants.
+func comparePostorder(a, b string) int {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := range min(len(as), len(bs)) {
+		if c := strings.Compare(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return len(bs) - len(as)
 }
 
 // FreezesPath returns the path to the freezes directory.
@@ -120,5 +252,68 @@ func FreezesPath(root string) string {
 
 // FreezeFilePath returns the path to a specific freeze file.
 func FreezeFilePath(root, name string) string {
-	return filepath.Join(root, FreezesDir, name+".json")
+	return filepath.Join(root, FreezesDir, lockfile.FileStem(name)+".json")
+}
+
+// FreezePatternsDir is the subdirectory of freezes/ holding pattern
+// freezes (lock.FreezeMatch), one file per pattern named after its hash:
+// a pattern's wildcards don't belong in a file name. No name under it can
+// be frozen by name.
+const FreezePatternsDir = "_patterns"
+
+// FreezePatternsPath returns the path to the pattern freezes directory.
+func FreezePatternsPath(root string) string {
+	return filepath.Join(root, FreezesDir, FreezePatternsDir)
+}
+
+// FreezePatternPath returns the path to the freeze file of a pattern.
+func FreezePatternPath(root, pattern string) string {
+	sum := sha256.Sum256([]byte(pattern))
+	return filepath.Join(FreezePatternsPath(root), hex.EncodeToString(sum[:16])+".json")
+}
+
+// SharedDirPath returns the directory holding the holder files of a lock
+// held in shared mode.
+func SharedDirPath(root, name string) string {
+	return filepath.Join(root, SharedDir, lockfile.FileStem(name))
+}
+
+// SharedHolderPath returns the path to one shared holder's file.
+func SharedHolderPath(root, name, lockID string) string {
+	return filepath.Join(root, SharedDir, lockfile.FileStem(name), lockID+".json")
+}
+
+// WaiterDirPath returns the directory holding the markers of processes
+// waiting for a specific lock.
+func WaiterDirPath(root, name string) string {
+	return filepath.Join(root, WaitersDir, lockfile.FileStem(name))
+}
+
+// SessionFilePath returns the path of a session's registry file (see
+// lock.EndSession).
+func SessionFilePath(root, id string) string {
+	return filepath.Join(root, SessionsDir, id+".json")
+}
+
+// SlotsFilePath returns the path of the file recording a name's slot count
+// (see lock.AcquireSlot).
+func SlotsFilePath(root, name string) string {
+	return filepath.Join(root, SlotsDir, lockfile.FileStem(name)+".json")
+}
+
+// ReservationDirPath returns the directory holding the reservations of a
+// specific lock (see lock.Reserve).
+func ReservationDirPath(root, name string) string {
+	return filepath.Join(root, ReservationsDir, lockfile.FileStem(name))
+}
+
+// ReservationFilePath returns the path of one reservation of a lock.
+func ReservationFilePath(root, name, id string) string {
+	return filepath.Join(ReservationDirPath(root, name), id+".json")
+}
+
+// IntentDirPath returns the directory holding the wait intents of processes
+// waiting for a specific lock (see lock.DeadlockError).
+func IntentDirPath(root, name string) string {
+	return filepath.Join(root, IntentsDir, lockfile.FileStem(name))
 }
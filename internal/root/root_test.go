@@ -17,6 +17,8 @@ func TestDiscoveryMethodString(t *testing.T) {
 		{MethodEnvVar, "env"},
 		{MethodGit, "git"},
 		{MethodLocalDir, "local"},
+		{MethodUserScope, "user"},
+		{MethodSystemScope, "system"},
 		{DiscoveryMethod(99), "unknown"},
 	}
 
@@ -351,3 +353,39 @@ func TestEnsureDirs_PermissionDenied(t *testing.T) {
 		t.Error("EnsureDirs() expected error for read-only parent, got nil")
 	}
 }
+
+func TestNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"build.json", "team/frontend/build.json", "team/deploy.json", "team/notes.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "empty"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := Names(dir)
+	if err != nil {
+		t.Fatalf("Names() error = %v", err)
+	}
+	if want := []string{"build", "team/deploy", "team/frontend/build"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("Names() = %v, want %v", names, want)
+	}
+
+	dirs, err := NameDirs(dir)
+	if err != nil {
+		t.Fatalf("NameDirs() error = %v", err)
+	}
+	if want := []string{"empty", "team/frontend", "team"}; strings.Join(dirs, ",") != strings.Join(want, ",") {
+		t.Errorf("NameDirs() = %v, want children before parents %v", dirs, want)
+	}
+
+	if _, err := Names(filepath.Join(dir, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Names(missing) error = %v, want ErrNotExist", err)
+	}
+}
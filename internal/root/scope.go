@@ -0,0 +1,185 @@
+package root
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// EnvLoktScope selects the scope of the root (see Scope); lokt --scope
+	// sets it for the command and everything it starts.
+	EnvLoktScope = "LOKT_SCOPE"
+	// EnvSystemRoot overrides where the system scope root lives. It is
+	// used as is, without falling back to another location.
+	EnvSystemRoot = "LOKT_SYSTEM_ROOT"
+	// envStateHome is the XDG base directory the user scope root lives in.
+	envStateHome = "XDG_STATE_HOME"
+)
+
+// Scope is which processes a root is shared by: those working in one
+// repository (the default), all of one user's, or every process on the
+// machine, for resources like a GPU or a port that don't belong to a
+// repository.
+type Scope string
+
+const (
+	ScopeRepo   Scope = "repo"
+	ScopeUser   Scope = "user"
+	ScopeSystem Scope = "system"
+)
+
+// SharedDirMode is the mode of a system scope root: writable by everyone,
+// with the sticky bit, like /tmp, so no user can remove or rename another's
+// top-level directories and files.
+const SharedDirMode = fs.ModeDir | fs.ModeSticky | 0777
+
+// ParseScope parses a --scope or LOKT_SCOPE value; "" is ScopeRepo.
+func ParseScope(s string) (Scope, error) {
+	switch sc := Scope(strings.ToLower(strings.TrimSpace(s))); sc {
+	case "":
+		return ScopeRepo, nil
+	case ScopeRepo, ScopeUser, ScopeSystem:
+		return sc, nil
+	}
+	return "", fmt.Errorf("invalid scope %q (want repo, user or system)", s)
+}
+
+// UserRoot returns the user scope root: lokt/ in $XDG_STATE_HOME, by default
+// ~/.local/state (%LocalAppData% on Windows).
+func UserRoot() (string, error) {
+	if dir := os.Getenv(envStateHome); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "lokt"), nil
+	}
+	dir, err := defaultStateHome()
+	if err != nil {
+		return "", fmt.Errorf("user scope: %w", err)
+	}
+	return filepath.Join(dir, "lokt"), nil
+}
+
+// SkippedRoot is a system scope location SystemRoot passed over, and why.
+type SkippedRoot struct {
+	Path string
+	Err  error
+}
+
+// Injectable for testing the fallbacks.
+var systemRootsFn = systemRootCandidates
+
+// SystemRoot returns the system scope root: $LOKT_SYSTEM_ROOT if set,
+// otherwise the first usable location of the platform's candidates
+// (/var/lock/lokt, then lokt/ in the temporary directory), creating it with
+// SharedDirMode if it is missing. A location is usable if this process can
+// create files in it; those it passed over are returned with the reason,
+// for lokt doctor to show.
+func SystemRoot() (string, []SkippedRoot, error) {
+	if dir := os.Getenv(EnvSystemRoot); dir != "" {
+		return dir, nil, nil
+	}
+	var skipped []SkippedRoot
+	var errs []error
+	for _, dir := range systemRootsFn() {
+		err := prepareShared(dir)
+		if err == nil {
+			return dir, skipped, nil
+		}
+		skipped = append(skipped, SkippedRoot{Path: dir, Err: err})
+		errs = append(errs, fmt.Errorf("%s: %w", dir, err))
+	}
+	return "", skipped, fmt.Errorf("no usable system scope root (set %s): %w", EnvSystemRoot, errors.Join(errs...))
+}
+
+// prepareShared makes sure dir exists, creating it with SharedDirMode (its
+// parent must exist), and that this process can create files in it.
+func prepareShared(dir string) error {
+	fi, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if err := MkdirShared(dir); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	case err != nil:
+		return err
+	case !fi.IsDir():
+		return fmt.Errorf("not a directory")
+	}
+	probe, err := os.CreateTemp(dir, ".lokt-probe-*")
+	if err != nil {
+		return err
+	}
+	_ = probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// MkdirShared creates dir with SharedDirMode, which the umask would
+// otherwise narrow. Where modes don't apply (Windows) it is a plain Mkdir.
+func MkdirShared(dir string) error {
+	if err := os.Mkdir(dir, SharedDirMode.Perm()); err != nil {
+		return err
+	}
+	if !sharedModes {
+		return nil
+	}
+	return os.Chmod(dir, SharedDirMode)
+}
+
+// Shared reports whether root is shared by several users: its directory
+// is group or world writable, as a system scope root is. Directories lokt
+// creates under a shared root take its permissions (see MkdirAll), and its
+// files are readable, and where they are appended to writable, by all.
+func Shared(root string) bool {
+	_, ok := sharedPerm(root)
+	return ok
+}
+
+// sharedPerm returns the mode for directories under a shared root: the
+// root's permissions and setgid bit, without the sticky bit, so every user
+// of the root can replace and remove lock files in them.
+func sharedPerm(root string) (fs.FileMode, bool) {
+	if !sharedModes {
+		return 0, false
+	}
+	fi, err := os.Stat(root)
+	if err != nil || fi.Mode().Perm()&0022 == 0 {
+		return 0, false
+	}
+	return fi.Mode().Perm() | fi.Mode()&fs.ModeSetgid, true
+}
+
+// SharedFilePerm returns the mode for a file under root that others append
+// to or rewrite (the audit log and its sequence files): 0666 in a shared
+// root, 0600 otherwise.
+func SharedFilePerm(root string) fs.FileMode {
+	if Shared(root) {
+		return 0666
+	}
+	return 0600
+}
+
+// MkdirAll creates dir, a directory under root, and any missing parents with
+// mode 0700, or in a shared root with the root's permissions (see Shared).
+func MkdirAll(root, dir string) error {
+	perm, ok := sharedPerm(root)
+	if !ok {
+		return os.MkdirAll(dir, 0700)
+	}
+	if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+		return nil
+	}
+	if parent := filepath.Dir(dir); parent != dir && parent != filepath.Clean(root) {
+		if err := MkdirAll(root, parent); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dir, perm.Perm()); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil // another process made it first
+		}
+		return err
+	}
+	return os.Chmod(dir, perm)
+}
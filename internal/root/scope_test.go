@@ -0,0 +1,150 @@
+//go:build unix
+
+package root
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseScope(t *testing.T) {
+	for in, want := range map[string]Scope{"": ScopeRepo, "repo": ScopeRepo, "User": ScopeUser, " system ": ScopeSystem} {
+		if got, err := ParseScope(in); err != nil || got != want {
+			t.Errorf("ParseScope(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseScope("machine"); err == nil {
+		t.Error("ParseScope(machine) should fail")
+	}
+}
+
+func TestFindWithMethod_UserScope(t *testing.T) {
+	state := t.TempDir()
+	t.Setenv(EnvLoktScope, "user")
+	t.Setenv(envStateHome, state)
+	t.Setenv(EnvLoktRoot, "/ignored/by/scope")
+
+	path, method, err := FindWithMethod()
+	if err != nil {
+		t.Fatalf("FindWithMethod() error = %v", err)
+	}
+	if want := filepath.Join(state, "lokt"); path != want || method != MethodUserScope {
+		t.Errorf("FindWithMethod() = %q, %v; want %q, user", path, method, want)
+	}
+}
+
+func TestFindWithMethod_InvalidScope(t *testing.T) {
+	t.Setenv(EnvLoktScope, "galaxy")
+	if _, _, err := FindWithMethod(); err == nil {
+		t.Error("expected an error for an invalid LOKT_SCOPE")
+	}
+}
+
+func TestSystemRoot_CreatesShared(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "lokt")
+	systemRootsFn = func() []string { return []string{dir} }
+	defer func() { systemRootsFn = systemRootCandidates }()
+	t.Setenv(EnvSystemRoot, "")
+	t.Setenv(EnvLoktScope, "system")
+
+	path, method, err := FindWithMethod()
+	if err != nil || path != dir || method != MethodSystemScope {
+		t.Fatalf("FindWithMethod() = %q, %v, %v; want %q, system", path, method, err, dir)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode() != SharedDirMode {
+		t.Errorf("system root mode = %v, want %v", fi.Mode(), SharedDirMode)
+	}
+	if !Shared(dir) {
+		t.Error("Shared() = false for the system root")
+	}
+}
+
+func TestSystemRoot_FallsBackWhenNotWritable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write anywhere")
+	}
+	tmp := t.TempDir()
+	readOnly := filepath.Join(tmp, "var-lock")
+	existing := filepath.Join(tmp, "taken")
+	for _, d := range []string{readOnly, existing} {
+		if err := os.Mkdir(d, 0500); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() { _ = os.Chmod(readOnly, 0700); _ = os.Chmod(existing, 0700) }()
+	fallback := filepath.Join(tmp, "fallback")
+	systemRootsFn = func() []string { return []string{filepath.Join(readOnly, "lokt"), existing, fallback} }
+	defer func() { systemRootsFn = systemRootCandidates }()
+	t.Setenv(EnvSystemRoot, "")
+
+	path, skipped, err := SystemRoot()
+	if err != nil {
+		t.Fatalf("SystemRoot() error = %v", err)
+	}
+	if path != fallback {
+		t.Errorf("SystemRoot() = %q, want fallback %q", path, fallback)
+	}
+	if len(skipped) != 2 || !errors.Is(skipped[0].Err, fs.ErrPermission) || !errors.Is(skipped[1].Err, fs.ErrPermission) {
+		t.Errorf("expected both unwritable candidates skipped with permission errors, got %+v", skipped)
+	}
+
+	// With no usable candidate at all, it fails naming each one.
+	systemRootsFn = func() []string { return []string{existing} }
+	if _, _, err := SystemRoot(); err == nil {
+		t.Error("expected an error with no writable candidate")
+	}
+}
+
+func TestSystemRoot_EnvOverride(t *testing.T) {
+	systemRootsFn = func() []string { t.Error("candidates consulted despite LOKT_SYSTEM_ROOT"); return nil }
+	defer func() { systemRootsFn = systemRootCandidates }()
+	t.Setenv(EnvSystemRoot, "/srv/locks")
+
+	if path, skipped, err := SystemRoot(); path != "/srv/locks" || skipped != nil || err != nil {
+		t.Errorf("SystemRoot() = %q, %v, %v", path, skipped, err)
+	}
+}
+
+func TestMkdirAll_SharedRoot(t *testing.T) {
+	rootDir := filepath.Join(t.TempDir(), "lokt")
+	if err := MkdirShared(rootDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnsureDirs(rootDir); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(rootDir, LocksDir, "team", "web")
+	if err := MkdirAll(rootDir, nested); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{LocksDir, FreezesDir, filepath.Join(LocksDir, "team"), filepath.Join(LocksDir, "team", "web")} {
+		fi, err := os.Stat(filepath.Join(rootDir, d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0777 || fi.Mode()&fs.ModeSticky != 0 {
+			t.Errorf("%s mode = %v, want 0777 without sticky", d, fi.Mode())
+		}
+	}
+
+	private := t.TempDir()
+	if err := os.Chmod(private, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := MkdirAll(private, filepath.Join(private, LocksDir)); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(filepath.Join(private, LocksDir)); fi.Mode().Perm() != 0700 || Shared(private) {
+		t.Errorf("private root: locks mode = %v, Shared = %v", fi.Mode(), Shared(private))
+	}
+	if SharedFilePerm(private) != 0600 || SharedFilePerm(rootDir) != 0666 {
+		t.Error("SharedFilePerm doesn't follow the root")
+	}
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package root
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// sharedModes is whether directory permissions can make a root shared.
+const sharedModes = true
+
+// systemRootCandidates returns where the system scope root may live, most
+// preferred first.
+func systemRootCandidates() []string {
+	return []string{"/var/lock/lokt", filepath.Join(os.TempDir(), "lokt")}
+}
+
+func defaultStateHome() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state"), nil
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package root
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// sharedModes is whether directory permissions can make a root shared.
+// Windows grants access through ACLs, which lokt leaves alone.
+const sharedModes = false
+
+// systemRootCandidates returns where the system scope root may live, most
+// preferred first.
+func systemRootCandidates() []string {
+	var dirs []string
+	if pd := os.Getenv("ProgramData"); pd != "" {
+		dirs = append(dirs, filepath.Join(pd, "lokt"))
+	}
+	return append(dirs, filepath.Join(os.TempDir(), "lokt"))
+}
+
+func defaultStateHome() (string, error) {
+	return os.UserCacheDir() // %LocalAppData%
+}
@@ -0,0 +1,117 @@
+package root
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+// MaxShardLevel is the largest shard_locks setting: 16^4 shard directories.
+const MaxShardLevel = 4
+
+// configFileName is config.FileName; config imports this package.
+const configFileName = "config.json"
+
+// shardSetting is a root's cached shard_locks, valid while config.json keeps
+// the size and modification time it was read at.
+type shardSetting struct {
+	size  int64
+	mod   time.Time
+	level int
+}
+
+var shardSettings sync.Map // root -> shardSetting
+
+// ShardLevel returns the shard_locks setting of root's config.json: how many
+// hex digits of a lock name's hash name the subdirectory of locks/ its file
+// lives in. 0, the default, keeps every lock file directly in locks/; so do
+// a missing or unreadable config and an out of range setting, which
+// config.Load rejects.
+func ShardLevel(root string) int {
+	path := filepath.Join(root, configFileName)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if v, ok := shardSettings.Load(root); ok {
+		if s := v.(shardSetting); s.size == fi.Size() && s.mod.Equal(fi.ModTime()) {
+			return s.level
+		}
+	}
+	var cfg struct {
+		ShardLocks int `json:"shard_locks"`
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path is built from the lokt root
+	if err != nil || json.Unmarshal(data, &cfg) != nil || cfg.ShardLocks < 0 || cfg.ShardLocks > MaxShardLevel {
+		cfg.ShardLocks = 0
+	}
+	shardSettings.Store(root, shardSetting{size: fi.Size(), mod: fi.ModTime(), level: cfg.ShardLocks})
+	return cfg.ShardLocks
+}
+
+// ShardPrefix starts the name of every shard directory. No name segment
+// can contain it (see lockfile.ValidateName), so a namespace never shares a
+// directory with a shard and no name leads to another's sharded file.
+const ShardPrefix = "@"
+
+// Shard returns the shard directory of name at level: ShardPrefix and the
+// first level hex digits of its FNV-1a hash, or "" at level 0.
+func Shard(name string, level int) string {
+	if level == 0 {
+		return ""
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return ShardPrefix + fmt.Sprintf("%08x", h.Sum32())[:level]
+}
+
+// ShardedLockFilePath returns the path of name's lock file in a root
+// sharded at level: locks/@<shard>/<name>.json, with name's
+// lockfile.FileStem. The shard is that of the stem, so a name and its stem
+// find the same file.
+func ShardedLockFilePath(root, name string, level int) string {
+	stem := lockfile.FileStem(name)
+	return filepath.Join(root, LocksDir, Shard(stem, level), stem+".json")
+}
+
+// LockName returns the name of the lock whose file is at rel under
+// LocksPath (with / separators, without .json) in a root sharded at level:
+// rel without its shard directory, or rel itself if it isn't in one.
+func LockName(rel string, level int) string {
+	if level == 0 {
+		return rel
+	}
+	shard, name, ok := strings.Cut(rel, "/")
+	if !ok || Shard(name, level) != shard {
+		return rel
+	}
+	return name
+}
+
+// LockNames returns the names of the lock files under LocksPath, in
+// directory order: those at the root's shard level and any left in the
+// flat layout, each once. Errors are as for Names.
+func LockNames(root string) ([]string, error) {
+	level := ShardLevel(root)
+	rels, err := Names(LocksPath(root))
+	if level == 0 {
+		return rels, err
+	}
+	seen := make(map[string]bool, len(rels))
+	names := rels[:0]
+	for _, rel := range rels {
+		name := LockName(rel, level)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, err
+}
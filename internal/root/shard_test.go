@@ -0,0 +1,128 @@
+package root
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func writeShardConfig(t testing.TB, dir, body string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, configFileName), []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func touchFile(t testing.TB, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShardLevel(t *testing.T) {
+	dir := t.TempDir()
+	if got := ShardLevel(dir); got != 0 {
+		t.Errorf("no config: ShardLevel() = %d, want 0", got)
+	}
+	writeShardConfig(t, dir, `{"shard_locks": 2}`)
+	if got := ShardLevel(dir); got != 2 {
+		t.Errorf("ShardLevel() = %d, want 2", got)
+	}
+	writeShardConfig(t, dir, `{"shard_locks": 3, "default_ttl": "5m"}`) // another size: not the cached one
+	if got := ShardLevel(dir); got != 3 {
+		t.Errorf("after rewrite: ShardLevel() = %d, want 3", got)
+	}
+	writeShardConfig(t, dir, `{"shard_locks": 9}`)
+	if got := ShardLevel(dir); got != 0 {
+		t.Errorf("out of range: ShardLevel() = %d, want 0", got)
+	}
+}
+
+func TestShard(t *testing.T) {
+	s := Shard("team/build", 4)
+	if len(s) != 5 || s[:1] != ShardPrefix || Shard("team/build", 2) != s[:3] {
+		t.Errorf("Shard() = %q, %q; want stable hex prefixes after %q", s, Shard("team/build", 2), ShardPrefix)
+	}
+	if Shard("team/build", 0) != "" {
+		t.Error("Shard() at level 0 should be empty")
+	}
+	// No name is another's sharded file.
+	if err := lockfile.ValidateName(Shard("job0", 2) + "/job0"); err == nil {
+		t.Error("a shard directory is a valid namespace")
+	}
+}
+
+func TestLockFilePath_Sharded(t *testing.T) {
+	dir := t.TempDir()
+	writeShardConfig(t, dir, `{"shard_locks": 2}`)
+
+	want := filepath.Join(dir, LocksDir, Shard("build", 2), "build.json")
+	if got := LockFilePath(dir, "build"); got != want {
+		t.Errorf("LockFilePath() = %q, want %q", got, want)
+	}
+	// A lock file from before sharding stays where it is.
+	flat := filepath.Join(dir, LocksDir, "build.json")
+	touchFile(t, flat)
+	if got := LockFilePath(dir, "build"); got != flat {
+		t.Errorf("LockFilePath() = %q, want the flat file %q", got, flat)
+	}
+}
+
+func TestLockNames_Sharded(t *testing.T) {
+	dir := t.TempDir()
+	writeShardConfig(t, dir, `{"shard_locks": 2}`)
+	for _, name := range []string{"build", "team/web/deploy"} {
+		touchFile(t, ShardedLockFilePath(dir, name, 2))
+	}
+	touchFile(t, filepath.Join(dir, LocksDir, "legacy.json"))
+	// Linked into its shard by doctor --fix, not yet removed from the old place.
+	touchFile(t, filepath.Join(dir, LocksDir, "build.json"))
+
+	names, err := LockNames(dir)
+	if err != nil {
+		t.Fatalf("LockNames() error = %v", err)
+	}
+	slices.Sort(names)
+	if want := []string{"build", "legacy", "team/web/deploy"}; !slices.Equal(names, want) {
+		t.Errorf("LockNames() = %v, want %v", names, want)
+	}
+	for _, name := range names {
+		if _, err := os.Stat(LockFilePath(dir, name)); err != nil {
+			t.Errorf("LockFilePath(%q) doesn't find the listed lock: %v", name, err)
+		}
+	}
+}
+
+// BenchmarkLockNames compares listing a root of 50k locks, flat and sharded
+// at the levels shard_locks allows.
+func BenchmarkLockNames(b *testing.B) {
+	const locks = 50000
+	for _, level := range []int{0, 1, 2, 3} {
+		b.Run(fmt.Sprintf("shard_locks=%d", level), func(b *testing.B) {
+			dir := b.TempDir()
+			writeShardConfig(b, dir, fmt.Sprintf(`{"shard_locks": %d}`, level))
+			for i := range locks {
+				name := fmt.Sprintf("build-branch-%d", i)
+				path := filepath.Join(dir, LocksDir, name+".json")
+				if level > 0 {
+					path = ShardedLockFilePath(dir, name, level)
+				}
+				touchFile(b, path)
+			}
+			b.ResetTimer()
+			for range b.N {
+				if names, err := LockNames(dir); err != nil || len(names) != locks {
+					b.Fatalf("LockNames() = %d names, %v", len(names), err)
+				}
+			}
+		})
+	}
+}
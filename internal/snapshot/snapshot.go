@@ -0,0 +1,373 @@
+// Package snapshot records periodic summaries of the lock root state and
+// reconstructs past states from those summaries plus the audit log.
+//
+// Snapshots are strictly observational: recording never blocks or fails a
+// lock operation, and nothing in the lock protocol reads them.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// DirName is the directory under the lokt root that holds snapshot files.
+const DirName = "history"
+
+const (
+	lastFileName = ".last-snapshot"
+	filePrefix   = "state-"
+	fileSuffix   = ".ndjson"
+	dayLayout    = "20060102"
+)
+
+// Entry is one held lock or freeze within a snapshot.
+type Entry struct {
+	Name       string     `json:"name"`
+	Owner      string     `json:"owner"`
+	Host       string     `json:"host"`
+	PID        int        `json:"pid"`
+	LockID     string     `json:"lock_id,omitempty"`
+	AgentID    string     `json:"agent_id,omitempty"`
+	AcquiredAt time.Time  `json:"acquired_ts"`
+	TTLSec     int        `json:"ttl_sec,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Freeze     bool       `json:"freeze,omitempty"`
+}
+
+// IsExpiredAt reports whether the entry's TTL had elapsed at the given time.
+func (e *Entry) IsExpiredAt(t time.Time) bool {
+	return e.ExpiresAt != nil && t.After(*e.ExpiresAt)
+}
+
+// State is a compact summary of the lock root at one instant.
+type State struct {
+	Timestamp   time.Time `json:"ts"`
+	LockCount   int       `json:"lock_count"`
+	FreezeCount int       `json:"freeze_count"`
+	Locks       []Entry   `json:"locks"`
+}
+
+// Dir returns the snapshot directory for a root.
+func Dir(rootDir string) string {
+	return filepath.Join(rootDir, DirName)
+}
+
+// dayFile returns the snapshot file for the UTC day containing t.
+func dayFile(rootDir string, t time.Time) string {
+	return filepath.Join(Dir(rootDir), filePrefix+t.UTC().Format(dayLayout)+fileSuffix)
+}
+
+// Capture reads the current locks/ and freezes/ directories into a State.
+// Unreadable or corrupted files are skipped.
+func Capture(rootDir string, now time.Time) *State {
+	st := &State{Timestamp: now.UTC(), Locks: []Entry{}}
+	st.Locks = append(st.Locks, captureDir(root.LocksPath(rootDir), false)...)
+	st.Locks = append(st.Locks, captureDir(root.FreezesPath(rootDir), true)...)
+	st.recount()
+	return st
+}
+
+func captureDir(dir string, isFreeze bool) []Entry {
+	names, _ := root.Names(dir)
+	var out []Entry
+	for _, name := range names {
+		lk, err := lockfile.Read(filepath.Join(dir, filepath.FromSlash(name)+".json"))
+		if err != nil {
+			continue
+		}
+		out = append(out, entryFromLock(lk, isFreeze))
+	}
+	return out
+}
+
+func entryFromLock(lk *lockfile.Lock, isFreeze bool) Entry {
+	return Entry{
+		Name:       lk.Name,
+		Owner:      lk.Owner,
+		Host:       lk.Host,
+		PID:        lk.PID,
+		LockID:     lk.LockID,
+		AgentID:    lk.AgentID,
+		AcquiredAt: lk.AcquiredAt,
+		TTLSec:     lk.TTLSec,
+		ExpiresAt:  lk.ExpiresAt,
+		Freeze:     isFreeze,
+	}
+}
+
+// recount refreshes the counters and sorts entries (locks before freezes, then by name).
+func (s *State) recount() {
+	sort.Slice(s.Locks, func(i, j int) bool {
+		if s.Locks[i].Freeze != s.Locks[j].Freeze {
+			return !s.Locks[i].Freeze
+		}
+		return s.Locks[i].Name < s.Locks[j].Name
+	})
+	s.LockCount, s.FreezeCount = 0, 0
+	for i := range s.Locks {
+		if s.Locks[i].Freeze {
+			s.FreezeCount++
+		} else {
+			s.LockCount++
+		}
+	}
+}
+
+// Record appends a snapshot of the current state to today's history file,
+// unless one was recorded less than interval ago. Files older than
+// retentionDays are pruned. Returns true if a snapshot was written.
+func Record(rootDir string, interval time.Duration, retentionDays int, now time.Time) (bool, error) {
+	dir := Dir(rootDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return false, err
+	}
+
+	lastPath := filepath.Join(dir, lastFileName)
+	if data, err := os.ReadFile(lastPath); err == nil {
+		if last, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data))); err == nil {
+			if now.Sub(last) < interval && !now.Before(last) {
+				return false, nil
+			}
+		}
+	}
+	// Claim the slot before capturing so concurrent commands don't all write.
+	if err := lockfile.WriteFileAtomic(lastPath, []byte(now.UTC().Format(time.RFC3339Nano)+"\n"), 0600); err != nil {
+		return false, err
+	}
+
+	data, err := json.Marshal(Capture(rootDir, now))
+	if err != nil {
+		return false, err
+	}
+	data = append(data, '\n')
+
+	f, err := os.OpenFile(dayFile(rootDir, now), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return false, err
+	}
+	_, werr := f.Write(data)
+	cerr := f.Close()
+	if werr != nil {
+		return false, werr
+	}
+	if cerr != nil {
+		return false, cerr
+	}
+
+	Prune(rootDir, retentionDays, now)
+	return true, nil
+}
+
+// Prune removes snapshot files for days older than retentionDays before now.
+// Errors are ignored; pruning is best-effort.
+func Prune(rootDir string, retentionDays int, now time.Time) {
+	cutoff := now.UTC().AddDate(0, 0, -retentionDays).Format(dayLayout)
+	for _, day := range listDays(rootDir) {
+		if day < cutoff {
+			_ = os.Remove(filepath.Join(Dir(rootDir), filePrefix+day+fileSuffix))
+		}
+	}
+}
+
+// listDays returns the YYYYMMDD stems of existing snapshot files, ascending.
+func listDays(rootDir string) []string {
+	entries, err := os.ReadDir(Dir(rootDir))
+	if err != nil {
+		return nil
+	}
+	var days []string
+	for _, de := range entries {
+		name := de.Name()
+		if de.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		days = append(days, strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix))
+	}
+	sort.Strings(days)
+	return days
+}
+
+// Nearest returns the latest snapshot taken at or before t, or nil if none exists.
+func Nearest(rootDir string, t time.Time) (*State, error) {
+	want := t.UTC().Format(dayLayout)
+	days := listDays(rootDir)
+	for i := len(days) - 1; i >= 0; i-- {
+		if days[i] > want {
+			continue
+		}
+		best, err := nearestInFile(filepath.Join(Dir(rootDir), filePrefix+days[i]+fileSuffix), t)
+		if err != nil {
+			return nil, err
+		}
+		if best != nil {
+			return best, nil
+		}
+	}
+	return nil, nil
+}
+
+func nearestInFile(path string, t time.Time) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var best *State
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		var st State
+		if err := json.Unmarshal([]byte(line), &st); err != nil {
+			continue
+		}
+		if st.Timestamp.After(t) {
+			continue
+		}
+		if best == nil || st.Timestamp.After(best.Timestamp) {
+			s := st
+			best = &s
+		}
+	}
+	return best, nil
+}
+
+// Reconstruction is the result of Reconstruct.
+type Reconstruction struct {
+	State *State `json:"state"`
+	// Base is the timestamp of the snapshot replay started from, or nil if
+	// no snapshot preceded the requested time and replay started from an
+	// empty root at the beginning of the audit log.
+	Base *time.Time `json:"base_snapshot_ts,omitempty"`
+	// Replayed is the number of audit events applied on top of the base.
+	Replayed int `json:"replayed_events"`
+}
+
+// Reconstruct renders the state of the root at time at by loading the nearest
+// earlier snapshot and replaying subsequent audit events up to at.
+func Reconstruct(rootDir string, at time.Time) (*Reconstruction, error) {
+	base, err := Nearest(rootDir, at)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Reconstruction{}
+	st := &State{Locks: []Entry{}}
+	var from time.Time
+	if base != nil {
+		st = base
+		from = base.Timestamp
+		ts := base.Timestamp
+		rec.Base = &ts
+	}
+
+	// Collect the window first so events are applied in (seq, ts) order
+	// rather than file order, which clock skew between hosts can scramble.
+	var events []*audit.Event
+	err = audit.ScanAll(rootDir, from, func(e *audit.Event, _ []byte) bool {
+		if e.Timestamp.After(from) && !e.Timestamp.After(at) {
+			events = append(events, e)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	audit.SortEvents(events)
+
+	r := newReplayer(st)
+	for _, e := range events {
+		if r.apply(e) {
+			rec.Replayed++
+		}
+	}
+
+	rec.State = r.state(at)
+	return rec, nil
+}
+
+// replayer applies audit events to a state, keyed by name per namespace.
+type replayer struct {
+	locks   map[string]Entry
+	freezes map[string]Entry
+}
+
+func newReplayer(st *State) *replayer {
+	r := &replayer{locks: map[string]Entry{}, freezes: map[string]Entry{}}
+	for _, e := range st.Locks {
+		if e.Freeze {
+			r.freezes[e.Name] = e
+		} else {
+			r.locks[e.Name] = e
+		}
+	}
+	return r
+}
+
+// apply updates the state for one event and reports whether it changed
+// anything the reconstruction tracks.
+func (r *replayer) apply(e *audit.Event) bool {
+	switch e.Event {
+	case audit.EventAcquire, audit.EventRenew, audit.EventTakeover:
+		r.locks[e.Name] = entryFromEvent(e, false)
+	case audit.EventRelease, audit.EventForceBreak, audit.EventStaleBreak,
+		audit.EventAutoPrune, audit.EventCorruptBreak:
+		delete(r.locks, e.Name)
+	case audit.EventFreeze:
+		r.freezes[e.Name] = entryFromEvent(e, true)
+	case audit.EventUnfreeze, audit.EventForceUnfreeze:
+		delete(r.freezes, e.Name)
+	default:
+		return false
+	}
+	return true
+}
+
+func entryFromEvent(e *audit.Event, isFreeze bool) Entry {
+	ent := Entry{
+		Name:       e.Name,
+		Owner:      e.Owner,
+		Host:       e.Host,
+		PID:        e.PID,
+		LockID:     e.LockID,
+		AgentID:    e.AgentID,
+		AcquiredAt: e.Timestamp,
+		TTLSec:     e.TTLSec,
+		Freeze:     isFreeze,
+	}
+	if e.TTLSec > 0 {
+		exp := e.Timestamp.Add(time.Duration(e.TTLSec) * time.Second)
+		ent.ExpiresAt = &exp
+	}
+	return ent
+}
+
+// state materializes the replayed maps. Freezes that had expired by at are
+// dropped since they no longer block anything; expired locks are kept
+// because they still occupy the name until something removes them.
+func (r *replayer) state(at time.Time) *State {
+	st := &State{Timestamp: at.UTC(), Locks: []Entry{}}
+	for _, e := range r.locks {
+		st.Locks = append(st.Locks, e)
+	}
+	for _, e := range r.freezes {
+		if e.IsExpiredAt(at) {
+			continue
+		}
+		st.Locks = append(st.Locks, e)
+	}
+	st.recount()
+	return st
+}
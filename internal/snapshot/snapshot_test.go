@@ -0,0 +1,230 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func writeLock(t *testing.T, rootDir, name string, isFreeze bool, acquired time.Time, ttl int) {
+	t.Helper()
+	if err := root.EnsureDirs(rootDir); err != nil {
+		t.Fatal(err)
+	}
+	lk := &lockfile.Lock{
+		Version:    1,
+		Name:       name,
+		Owner:      "alice",
+		Host:       "h1",
+		PID:        42,
+		AcquiredAt: acquired,
+		TTLSec:     ttl,
+	}
+	if ttl > 0 {
+		exp := acquired.Add(time.Duration(ttl) * time.Second)
+		lk.ExpiresAt = &exp
+	}
+	path := root.LockFilePath(rootDir, name)
+	if isFreeze {
+		path = root.FreezeFilePath(rootDir, name)
+	}
+	if err := lockfile.Write(path, lk); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeLock(t, dir, "build", false, now, 300)
+	writeLock(t, dir, "deploy", true, now, 600)
+
+	st := Capture(dir, now)
+	if st.LockCount != 1 || st.FreezeCount != 1 {
+		t.Fatalf("counts = %d/%d, want 1/1", st.LockCount, st.FreezeCount)
+	}
+	if st.Locks[0].Name != "build" || st.Locks[0].Freeze {
+		t.Errorf("first entry = %+v, want lock build", st.Locks[0])
+	}
+	if st.Locks[1].Name != "deploy" || !st.Locks[1].Freeze {
+		t.Errorf("second entry = %+v, want freeze deploy", st.Locks[1])
+	}
+}
+
+func TestRecord_Interval(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeLock(t, dir, "build", false, now, 0)
+
+	wrote, err := Record(dir, time.Minute, 7, now)
+	if err != nil || !wrote {
+		t.Fatalf("first Record() = %v, %v; want true, nil", wrote, err)
+	}
+	wrote, err = Record(dir, time.Minute, 7, now.Add(10*time.Second))
+	if err != nil || wrote {
+		t.Fatalf("burst Record() = %v, %v; want false, nil", wrote, err)
+	}
+	wrote, err = Record(dir, time.Minute, 7, now.Add(2*time.Minute))
+	if err != nil || !wrote {
+		t.Fatalf("later Record() = %v, %v; want true, nil", wrote, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, DirName, "state-20260301.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines int
+	for _, b := range data {
+		if b == '\n' {
+			lines++
+		}
+	}
+	if lines != 2 {
+		t.Errorf("expected 2 snapshot lines, got %d", lines)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	hist := filepath.Join(dir, DirName)
+	if err := os.MkdirAll(hist, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range []string{"20260101", "20260225", "20260301"} {
+		if err := os.WriteFile(filepath.Join(hist, "state-"+day+".ndjson"), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	Prune(dir, 7, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+
+	got := listDays(dir)
+	if len(got) != 2 || got[0] != "20260225" || got[1] != "20260301" {
+		t.Errorf("remaining days = %v, want [20260225 20260301]", got)
+	}
+}
+
+func TestNearest(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, ts := range []time.Time{t0, t0.Add(5 * time.Minute), t0.Add(24 * time.Hour)} {
+		if _, err := Record(dir, 0, 30, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st, err := Nearest(dir, t0.Add(7*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st == nil || !st.Timestamp.Equal(t0.Add(5*time.Minute)) {
+		t.Errorf("Nearest = %v, want snapshot at +5m", st)
+	}
+
+	st, err = Nearest(dir, t0.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st != nil {
+		t.Errorf("expected no snapshot before first, got %v", st.Timestamp)
+	}
+}
+
+func emit(t *testing.T, dir string, e audit.Event) {
+	t.Helper()
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(audit.Path(dir), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconstruct_SnapshotPlusEvents(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	writeLock(t, dir, "build", false, t0.Add(-time.Minute), 0)
+	if _, err := Record(dir, 0, 30, t0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Before the snapshot — must be ignored (already reflected in it).
+	emit(t, dir, audit.Event{Timestamp: t0.Add(-time.Minute), Event: audit.EventAcquire, Name: "build", Owner: "alice"})
+	emit(t, dir, audit.Event{Timestamp: t0.Add(1 * time.Minute), Event: audit.EventAcquire, Name: "test", Owner: "bob", TTLSec: 60})
+	emit(t, dir, audit.Event{Timestamp: t0.Add(2 * time.Minute), Event: audit.EventRelease, Name: "build", Owner: "alice"})
+	emit(t, dir, audit.Event{Timestamp: t0.Add(3 * time.Minute), Event: audit.EventFreeze, Name: "deploy", Owner: "ops", TTLSec: 600})
+	emit(t, dir, audit.Event{Timestamp: t0.Add(4 * time.Minute), Event: audit.EventDeny, Name: "test", Owner: "carol"})
+	// After the requested instant — must be ignored.
+	emit(t, dir, audit.Event{Timestamp: t0.Add(10 * time.Minute), Event: audit.EventRelease, Name: "test", Owner: "bob"})
+
+	rec, err := Reconstruct(dir, t0.Add(5*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Base == nil || !rec.Base.Equal(t0) {
+		t.Errorf("base = %v, want %v", rec.Base, t0)
+	}
+	if rec.Replayed != 3 {
+		t.Errorf("replayed = %d, want 3", rec.Replayed)
+	}
+	st := rec.State
+	if st.LockCount != 1 || st.FreezeCount != 1 {
+		t.Fatalf("counts = %d/%d, want 1/1: %+v", st.LockCount, st.FreezeCount, st.Locks)
+	}
+	if st.Locks[0].Name != "test" || st.Locks[0].Owner != "bob" {
+		t.Errorf("lock = %+v, want test held by bob", st.Locks[0])
+	}
+	if st.Locks[1].Name != "deploy" || !st.Locks[1].Freeze {
+		t.Errorf("freeze = %+v, want deploy", st.Locks[1])
+	}
+}
+
+func TestReconstruct_NoSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	emit(t, dir, audit.Event{Timestamp: t0, Event: audit.EventFreeze, Name: "deploy", Owner: "ops", TTLSec: 60})
+	emit(t, dir, audit.Event{Timestamp: t0, Event: audit.EventAcquire, Name: "build", Owner: "alice"})
+
+	rec, err := Reconstruct(dir, t0.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Base != nil {
+		t.Errorf("expected no base snapshot, got %v", rec.Base)
+	}
+	// The freeze expired after 60s, so only the lock remains.
+	if rec.State.LockCount != 1 || rec.State.FreezeCount != 0 {
+		t.Errorf("counts = %d/%d, want 1/0", rec.State.LockCount, rec.State.FreezeCount)
+	}
+}
+
+func TestReconstruct_OrdersBySeq(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	// Host B's clock runs ahead: its release (seq 2) is stamped after host
+	// A's re-acquire (seq 3) and lands later in the file. Replay must follow
+	// seq, leaving the lock held by alice.
+	emit(t, dir, audit.Event{Seq: 1, Timestamp: t0, Event: audit.EventAcquire, Name: "build", Owner: "bob"})
+	emit(t, dir, audit.Event{Seq: 3, Timestamp: t0.Add(time.Second), Event: audit.EventAcquire, Name: "build", Owner: "alice"})
+	emit(t, dir, audit.Event{Seq: 2, Timestamp: t0.Add(2 * time.Second), Event: audit.EventRelease, Name: "build", Owner: "bob"})
+
+	rec, err := Reconstruct(dir, t0.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.State.LockCount != 1 || rec.State.Locks[0].Owner != "alice" {
+		t.Errorf("expected build held by alice, got %+v", rec.State.Locks)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build unix
+
+package stale
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// FlockHeld reports whether a process holds a flock on the file at path, as
+// a holder that keeps one does (lockfile.Lock.Flock). It probes with a
+// shared flock that doesn't block and is dropped at once; false if the
+// file can't be opened or flock isn't supported there.
+func FlockHeld(path string) bool {
+	f, err := os.Open(path) //nolint:gosec // G304: path is built from the lokt root
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+	fd := int(f.Fd()) //nolint:gosec // G115: file descriptors fit in int
+	err = syscall.Flock(fd, syscall.LOCK_SH|syscall.LOCK_NB)
+	if err == nil {
+		_ = syscall.Flock(fd, syscall.LOCK_UN)
+		return false
+	}
+	return errors.Is(err, syscall.EWOULDBLOCK)
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package stale
+
+// FlockHeld always reports false on Windows, which has no flock(2); no
+// holder there keeps one.
+func FlockHeld(_ string) bool {
+	return false
+}
@@ -2,12 +2,52 @@
 
 package stale
 
+import (
+	"errors"
+	"syscall"
+)
+
+// processQueryLimitedInformation is PROCESS_QUERY_LIMITED_INFORMATION, the
+// narrowest access right that allows GetExitCodeProcess and
+// GetProcessTimes. Unlike PROCESS_QUERY_INFORMATION it is granted for
+// processes of other users, which the syscall package doesn't define.
+const processQueryLimitedInformation = 0x1000
+
+// stillActive is the STILL_ACTIVE exit code of a running process.
+const stillActive = 259
+
+// errInvalidParameter is ERROR_INVALID_PARAMETER, which OpenProcess returns
+// for a PID with no process.
+const errInvalidParameter syscall.Errno = 87
+
+// openProcess opens pid for querying.
+func openProcess(pid int) (syscall.Handle, error) {
+	if pid <= 0 {
+		return 0, errInvalidParameter
+	}
+	return syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+}
+
 // IsProcessAlive checks if a process with the given PID exists.
-// On Windows, we cannot easily check PID liveness without additional
-// dependencies, so we conservatively return true (assume alive).
-// Stale lock detection will rely on TTL expiry instead.
+// On Windows, opens the process and checks that it hasn't exited: a handle
+// keeps an exited process's PID from being reused, so OpenProcess alone
+// isn't enough.
+//
+// Returns true if the process exists but we may not query it
+// (ERROR_ACCESS_DENIED), mirroring EPERM on Unix.
 func IsProcessAlive(pid int) bool {
-	// Conservative: assume process is alive
-	// TTL expiry provides the safety net on Windows
-	return true
+	h, err := openProcess(pid)
+	if err != nil {
+		// ERROR_INVALID_PARAMETER means there is no such process
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+	}
+	defer func() { _ = syscall.CloseHandle(h) }()
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return true // the handle opened, so the process exists
+	}
+	// A process that exits with code 259 looks alive here until its last
+	// handle closes; TTL expiry covers that rare case.
+	return code == stillActive
 }
@@ -3,27 +3,70 @@ package stale
 
 import (
 	"os"
+	"time"
 
 	"github.com/nikolasavic/lokt/internal/lockfile"
 )
 
 // Reason describes why a lock is considered stale.
+//
+// The string values are stable identifiers. They appear in JSON output and
+// audit events, and tooling matches on them, so existing values must never be
+// renamed; new reasons may be added.
 type Reason string
 
 const (
-	ReasonExpired   Reason = "expired"   // TTL has elapsed
-	ReasonDeadPID   Reason = "dead_pid"  // Process no longer running
-	ReasonCorrupted Reason = "corrupted" // Lock file is malformed/unreadable
-	ReasonNotStale  Reason = ""          // Lock is not stale
-	ReasonUnknown   Reason = "unknown"   // Cannot determine (cross-host)
+	ReasonExpired     Reason = "expired"      // TTL has elapsed
+	ReasonDeadPID     Reason = "dead_pid"     // Process no longer running
+	ReasonRecycledPID Reason = "recycled_pid" // PID reused by a different process
+	ReasonCorrupted   Reason = "corrupted"    // Lock file is malformed/unreadable
+	ReasonNotStale    Reason = ""             // Lock is not stale
+	ReasonUnknown     Reason = "unknown"      // Cannot determine (cross-host)
 )
 
+// Reasons returns every stable reason identifier, excluding ReasonNotStale.
+func Reasons() []Reason {
+	return []Reason{ReasonExpired, ReasonDeadPID, ReasonRecycledPID, ReasonCorrupted, ReasonUnknown}
+}
+
+// Description returns the human-readable sentence for a reason.
+// Unlike the identifier, the wording may change between releases.
+func (r Reason) Description() string {
+	switch r {
+	case ReasonExpired:
+		return "lock TTL has expired"
+	case ReasonDeadPID:
+		return "holder process is no longer running"
+	case ReasonRecycledPID:
+		return "holder PID has been reused by a different process"
+	case ReasonCorrupted:
+		return "lock file is corrupted or unreadable"
+	case ReasonUnknown:
+		return "holder is on another host; PID liveness cannot be verified"
+	case ReasonNotStale:
+		return "holder process is alive"
+	default:
+		return string(r)
+	}
+}
+
+// HolderGone reports whether the reason means the holding process no longer
+// exists (dead or recycled PID).
+func (r Reason) HolderGone() bool {
+	return r == ReasonDeadPID || r == ReasonRecycledPID
+}
+
 // Result contains the staleness check result.
 type Result struct {
 	Stale  bool
 	Reason Reason
 }
 
+// DefaultSkewGrace is how long past its expires_at another host's lock
+// must be before CheckWithGrace callers break it, unless clock_skew_grace
+// in config.json says otherwise.
+const DefaultSkewGrace = 30 * time.Second
+
 // Check determines if a lock is stale.
 // A lock is stale if:
 // - TTL has expired, OR
@@ -31,14 +74,31 @@ type Result struct {
 //
 // For cross-host locks, PID cannot be verified so only TTL is checked.
 func Check(lock *lockfile.Lock) Result {
+	return CheckWithGrace(lock, 0)
+}
+
+// CheckWithGrace is Check, except that a lock written on another host
+// counts as expired only once it is grace past its expiry: the two clocks
+// may disagree by that much. Locks from this host use the exact expiry.
+func CheckWithGrace(lock *lockfile.Lock, grace time.Duration) Result {
+	hostname, err := os.Hostname()
+	sameHost := err == nil && hostname == lock.Host
+	if sameHost {
+		grace = 0
+	}
+
 	// Check TTL expiry first (works for any host)
-	if lock.IsExpired() {
+	if lock.ExpiredBeyond(grace) {
 		return Result{Stale: true, Reason: ReasonExpired}
 	}
 
+	// A retained lock outlives its holder on purpose
+	if lock.Retained {
+		return Result{Stale: false, Reason: ReasonNotStale}
+	}
+
 	// Check PID liveness (only meaningful on same host)
-	hostname, err := os.Hostname()
-	if err != nil || hostname != lock.Host {
+	if !sameHost {
 		// Cannot verify cross-host locks
 		return Result{Stale: false, Reason: ReasonUnknown}
 	}
@@ -54,10 +114,24 @@ func Check(lock *lockfile.Lock) Result {
 	if lock.PIDStartNS != 0 {
 		currentStart, err := GetProcessStartTime(lock.PID)
 		if err == nil && currentStart != lock.PIDStartNS {
-			return Result{Stale: true, Reason: ReasonDeadPID}
+			return Result{Stale: true, Reason: ReasonRecycledPID}
 		}
 		// err != nil → can't verify start time, fall through conservatively
 	}
 
 	return Result{Stale: false, Reason: ReasonNotStale}
 }
+
+// CheckFile is CheckWithGrace for the lock file at path, with one more
+// liveness signal: a lock from this host whose holder keeps a flock on the
+// file (lockfile.Lock.Flock) is not stale while the flock is held, even if
+// its TTL has run out.
+func CheckFile(path string, lock *lockfile.Lock, grace time.Duration) Result {
+	r := CheckWithGrace(lock, grace)
+	if r.Stale && lock.Flock {
+		if hostname, err := os.Hostname(); err == nil && hostname == lock.Host && FlockHeld(path) {
+			return Result{Stale: false, Reason: ReasonNotStale}
+		}
+	}
+	return r
+}
@@ -2,7 +2,6 @@ package stale
 
 import (
 	"os"
-	"runtime"
 	"testing"
 	"time"
 
@@ -129,11 +128,53 @@ func TestCheck_CrossHost_ExpiredTTL(t *testing.T) {
 	}
 }
 
-func TestCheck_RecycledPID(t *testing.T) {
-	if runtime.GOOS == "windows" {
-		t.Skip("start time not supported on Windows")
+func TestCheckWithGrace_CrossHostSkew(t *testing.T) {
+	// Written by a host whose clock runs behind ours: by our clock the lock
+	// expired 10s ago, which is within the skew grace.
+	exp := time.Now().Add(-10 * time.Second)
+	lock := &lockfile.Lock{
+		Name:       "test",
+		Host:       "definitely-not-this-host.example.com",
+		PID:        12345,
+		AcquiredAt: exp.Add(-time.Minute),
+		TTLSec:     60,
+		ExpiresAt:  &exp,
 	}
 
+	if r := CheckWithGrace(lock, DefaultSkewGrace); r.Reason == ReasonExpired {
+		t.Errorf("CheckWithGrace(30s) = %v, want not expired within the grace", r.Reason)
+	}
+	if r := CheckWithGrace(lock, 0); r.Reason != ReasonExpired {
+		t.Errorf("CheckWithGrace(0) = %v, want expired", r.Reason)
+	}
+
+	old := exp.Add(-time.Minute)
+	lock.ExpiresAt = &old
+	if r := CheckWithGrace(lock, DefaultSkewGrace); r.Reason != ReasonExpired {
+		t.Errorf("CheckWithGrace(30s) = %v, want expired beyond the grace", r.Reason)
+	}
+}
+
+func TestCheckWithGrace_SameHostIgnoresGrace(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skip("no hostname")
+	}
+	exp := time.Now().Add(-10 * time.Second)
+	lock := &lockfile.Lock{
+		Name:       "test",
+		Host:       hostname,
+		PID:        os.Getpid(),
+		AcquiredAt: exp.Add(-time.Minute),
+		TTLSec:     60,
+		ExpiresAt:  &exp,
+	}
+	if r := CheckWithGrace(lock, DefaultSkewGrace); r.Reason != ReasonExpired {
+		t.Errorf("CheckWithGrace() = %v, want expired: one clock needs no grace", r.Reason)
+	}
+}
+
+func TestCheck_RecycledPID(t *testing.T) {
 	hostname, err := os.Hostname()
 	if err != nil {
 		t.Skip("Cannot get hostname")
@@ -154,16 +195,12 @@ func TestCheck_RecycledPID(t *testing.T) {
 	if !result.Stale {
 		t.Error("Check should return stale for recycled PID (different start time)")
 	}
-	if result.Reason != ReasonDeadPID {
-		t.Errorf("Check should return ReasonDeadPID, got %v", result.Reason)
+	if result.Reason != ReasonRecycledPID {
+		t.Errorf("Check should return ReasonRecycledPID, got %v", result.Reason)
 	}
 }
 
 func TestCheck_SamePID_SameStartTime(t *testing.T) {
-	if runtime.GOOS == "windows" {
-		t.Skip("start time not supported on Windows")
-	}
-
 	hostname, err := os.Hostname()
 	if err != nil {
 		t.Skip("Cannot get hostname")
@@ -220,3 +257,31 @@ func TestCheck_NoPIDStartNS_Degradation(t *testing.T) {
 		t.Errorf("Check should return ReasonNotStale, got %v", result.Reason)
 	}
 }
+
+// TestReasons_StableIdentifiers pins the reason identifiers. They are a
+// compatibility surface for JSON and audit consumers: if this test fails,
+// an identifier was renamed or removed, which must not happen.
+func TestReasons_StableIdentifiers(t *testing.T) {
+	want := []string{"expired", "dead_pid", "recycled_pid", "corrupted", "unknown"}
+	got := Reasons()
+	if len(got) != len(want) {
+		t.Fatalf("Reasons() = %v, want %v", got, want)
+	}
+	for i, r := range got {
+		if string(r) != want[i] {
+			t.Errorf("Reasons()[%d] = %q, want %q", i, r, want[i])
+		}
+		if r.Description() == "" || r.Description() == string(r) {
+			t.Errorf("%q has no human description", r)
+		}
+	}
+}
+
+func TestReason_HolderGone(t *testing.T) {
+	for _, r := range Reasons() {
+		want := r == ReasonDeadPID || r == ReasonRecycledPID
+		if r.HolderGone() != want {
+			t.Errorf("%q.HolderGone() = %v, want %v", r, r.HolderGone(), want)
+		}
+	}
+}
@@ -2,15 +2,10 @@ package stale
 
 import (
 	"os"
-	"runtime"
 	"testing"
 )
 
 func TestGetProcessStartTime_CurrentProcess(t *testing.T) {
-	if runtime.GOOS == "windows" {
-		t.Skip("start time not supported on Windows")
-	}
-
 	pid := os.Getpid()
 	ns1, err := GetProcessStartTime(pid)
 	if err != nil {
@@ -31,10 +26,6 @@ func TestGetProcessStartTime_CurrentProcess(t *testing.T) {
 }
 
 func TestGetProcessStartTime_NonExistent(t *testing.T) {
-	if runtime.GOOS == "windows" {
-		t.Skip("start time not supported on Windows")
-	}
-
 	_, err := GetProcessStartTime(99999999)
 	if err == nil {
 		t.Error("GetProcessStartTime should return error for non-existent PID")
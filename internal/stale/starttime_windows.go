@@ -2,14 +2,30 @@
 
 package stale
 
-import "errors"
+import (
+	"errors"
+	"syscall"
+)
 
 // ErrStartTimeNotSupported is returned on platforms where process start time
 // cannot be retrieved.
 var ErrStartTimeNotSupported = errors.New("process start time not supported")
 
-// GetProcessStartTime is not supported on Windows.
-// Returns (0, ErrStartTimeNotSupported).
+// GetProcessStartTime returns the process creation time from
+// GetProcessTimes, in nanoseconds since the Unix epoch. Values are only
+// meaningful for same-host comparison.
+//
+// Returns (0, error) if the process doesn't exist or can't be queried.
 func GetProcessStartTime(pid int) (int64, error) {
-	return 0, ErrStartTimeNotSupported
+	h, err := openProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = syscall.CloseHandle(h) }()
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return 0, err
+	}
+	return creation.Nanoseconds(), nil
 }
@@ -0,0 +1,189 @@
+package stats
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+)
+
+// How an acquisition ended, as reported in Acquisition.EndReason.
+const (
+	EndReleased   = "released"    // released by its holder
+	EndForceBreak = "force-break" // removed with --force
+	EndStaleBreak = "stale-break" // removed as stale: --break-stale, auto-prune, corrupt file
+	EndAbandoned  = "abandoned"   // nothing in the log ends it and the lock is gone
+	EndHeld       = "held"        // still in place
+	EndTakenOver  = "taken-over"  // replaced by lock --take-over-from
+)
+
+// Acquisition is one hold of a lock (lokt history <name>): the acquire
+// event and everything the log records about it until it ended.
+type Acquisition struct {
+	Name     string    `json:"name"`
+	LockID   string    `json:"lock_id,omitempty"`
+	Owner    string    `json:"owner"`
+	Host     string    `json:"host"`
+	PID      int       `json:"pid"`
+	Start    time.Time `json:"start"`
+	Renewals int       `json:"renewals"`
+	// End is when the hold ended; nil if it is still held or the log
+	// doesn't say (abandoned).
+	End       *time.Time `json:"end,omitempty"`
+	EndReason string     `json:"end_reason"`
+	// EndedBy is who ended the hold when it wasn't the holder: the
+	// breaker, or the acquirer that pruned it.
+	EndedBy string `json:"ended_by,omitempty"`
+}
+
+// Duration returns how long the hold lasted: to End, to now if it is
+// still held, 0 if the end is unknown.
+func (a *Acquisition) Duration(now time.Time) time.Duration {
+	end := now
+	switch {
+	case a.End != nil:
+		end = *a.End
+	case a.EndReason != EndHeld:
+		return 0
+	}
+	if d := end.Sub(a.Start); d > 0 {
+		return d
+	}
+	return 0 // clocks of two hosts disagree
+}
+
+// Correlator groups a stream of audit events, in log order, into
+// acquisitions. Events are tied to their acquisition by lock ID; events
+// written before lock IDs existed go to the latest open acquisition of
+// the same name, and the next acquire of the name closes one without a
+// lock ID.
+type Correlator struct {
+	acqs []*Acquisition
+	open map[string]*Acquisition // by holdKey
+}
+
+// NewCorrelator returns an empty Correlator.
+func NewCorrelator() *Correlator {
+	return &Correlator{open: map[string]*Acquisition{}}
+}
+
+// Add applies one event. Events that don't belong to an acquisition, and
+// those whose acquire predates the events seen, are ignored.
+func (c *Correlator) Add(e *audit.Event) {
+	switch e.Event {
+	case audit.EventAcquire:
+		c.start(e)
+	case audit.EventTakeover:
+		// Ends the previous holder's acquisition and starts one
+		prev := *e
+		prev.LockID, _ = e.Extra["previous_lock_id"].(string)
+		c.end(&prev, EndTakenOver)
+		c.start(e)
+	case audit.EventRenew:
+		if a := c.lookup(e); a != nil {
+			a.Renewals++
+		}
+	case audit.EventRelease:
+		c.end(e, EndReleased)
+	case audit.EventForceBreak:
+		c.end(e, EndForceBreak)
+	case audit.EventStaleBreak, audit.EventAutoPrune, audit.EventCorruptBreak:
+		c.end(e, EndStaleBreak)
+	}
+}
+
+// start opens the acquisition e begins.
+func (c *Correlator) start(e *audit.Event) {
+	if prev := c.open["name:"+e.Name]; prev != nil {
+		// Without a lock ID, the last acquire must have ended by now.
+		prev.EndReason = EndAbandoned
+		delete(c.open, "name:"+e.Name)
+	}
+	a := &Acquisition{
+		Name: e.Name, LockID: e.LockID, Owner: e.Owner, Host: e.Host, PID: e.PID, Start: e.Timestamp,
+	}
+	c.acqs = append(c.acqs, a)
+	c.open[holdKey(e)] = a
+}
+
+// lookup returns the open acquisition e belongs to, or nil.
+func (c *Correlator) lookup(e *audit.Event) *Acquisition {
+	if a := c.open[holdKey(e)]; a != nil {
+		return a
+	}
+	if e.LockID != "" {
+		return nil
+	}
+	// An event without a lock ID ending a hold that has one (mixed
+	// versions): the latest open acquisition of the name.
+	var latest *Acquisition
+	for _, a := range c.open {
+		if a.Name == e.Name && (latest == nil || a.Start.After(latest.Start)) {
+			latest = a
+		}
+	}
+	return latest
+}
+
+func (c *Correlator) end(e *audit.Event, reason string) {
+	a := c.lookup(e)
+	if a == nil {
+		return
+	}
+	for key, o := range c.open {
+		if o == a {
+			delete(c.open, key)
+		}
+	}
+	ts := e.Timestamp
+	a.End, a.EndReason = &ts, reason
+	if e.Owner != a.Owner || reason != EndReleased {
+		a.EndedBy = e.Owner
+	}
+}
+
+// Acquisitions returns the acquisitions in the order they started.
+// Those no event ended are held if held has their lock ID (see
+// HeldLockIDs), abandoned otherwise. The Correlator is spent afterwards.
+func (c *Correlator) Acquisitions(held map[string]bool) []Acquisition {
+	for key, a := range c.open {
+		if held[key] {
+			a.EndReason = EndHeld
+		} else {
+			a.EndReason = EndAbandoned
+		}
+	}
+	c.open = map[string]*Acquisition{}
+	out := make([]Acquisition, 0, len(c.acqs))
+	for _, a := range c.acqs {
+		out = append(out, *a)
+	}
+	return out
+}
+
+// LockHistory reads rootDir's audit log, rotated segments included, and
+// returns the last limit acquisitions of name, oldest first (all of them if
+// limit is 0).
+func LockHistory(rootDir, name string, limit int) ([]Acquisition, error) {
+	var events []*audit.Event
+	err := audit.ScanAll(rootDir, time.Time{}, func(e *audit.Event, _ []byte) bool {
+		if e.Name == name {
+			events = append(events, e)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	audit.SortEvents(events)
+
+	c := NewCorrelator()
+	for _, e := range events {
+		c.Add(e)
+	}
+	acqs := c.Acquisitions(HeldLockIDs(rootDir))
+	if limit > 0 && len(acqs) > limit {
+		acqs = acqs[len(acqs)-limit:]
+	}
+	return acqs, nil
+}
@@ -0,0 +1,102 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+)
+
+func TestCorrelator_InterleavedLocks(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+	c := NewCorrelator()
+	for _, e := range []*audit.Event{
+		ev(at(0), audit.EventAcquire, "build", "b1", "alice"),
+		ev(at(1), audit.EventAcquire, "deploy", "d1", "bob"),
+		ev(at(2), audit.EventRenew, "build", "b1", "alice"),
+		ev(at(3), audit.EventRenew, "deploy", "d1", "bob"),
+		ev(at(4), audit.EventRenew, "build", "b1", "alice"),
+		ev(at(5), audit.EventRelease, "deploy", "d1", "bob"),
+		ev(at(6), audit.EventForceBreak, "build", "b1", "ops"),
+		ev(at(7), audit.EventAcquire, "build", "b2", "carol"),
+	} {
+		c.Add(e)
+	}
+
+	got := c.Acquisitions(map[string]bool{"b2": true})
+	if len(got) != 3 {
+		t.Fatalf("got %d acquisitions, want 3: %+v", len(got), got)
+	}
+	b1, d1, b2 := got[0], got[1], got[2]
+	if b1.LockID != "b1" || b1.Renewals != 2 || b1.EndReason != EndForceBreak || b1.EndedBy != "ops" ||
+		b1.Duration(t0) != 6*time.Minute {
+		t.Errorf("b1 = %+v", b1)
+	}
+	if d1.LockID != "d1" || d1.Renewals != 1 || d1.EndReason != EndReleased || d1.EndedBy != "" ||
+		d1.Duration(t0) != 4*time.Minute {
+		t.Errorf("d1 = %+v", d1)
+	}
+	if b2.EndReason != EndHeld || b2.End != nil || b2.Duration(at(10)) != 3*time.Minute {
+		t.Errorf("b2 = %+v, want held for 3m", b2)
+	}
+}
+
+func TestCorrelator_MissingEnds(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCorrelator()
+	for _, e := range []*audit.Event{
+		// Its acquire is outside the events seen: ignored.
+		ev(t0, audit.EventRelease, "build", "old", "alice"),
+		// Crashed, then pruned by the next acquirer.
+		ev(t0, audit.EventAcquire, "build", "b1", "alice"),
+		ev(t0.Add(time.Hour), audit.EventAutoPrune, "build", "b1", "bob"),
+		ev(t0.Add(time.Hour), audit.EventAcquire, "build", "b2", "bob"),
+		// Nothing ends b2 and its lock is gone.
+	} {
+		c.Add(e)
+	}
+
+	got := c.Acquisitions(nil)
+	if len(got) != 2 {
+		t.Fatalf("got %d acquisitions, want 2: %+v", len(got), got)
+	}
+	if got[0].EndReason != EndStaleBreak || got[0].EndedBy != "bob" {
+		t.Errorf("b1 = %+v, want a stale-break by bob", got[0])
+	}
+	if got[1].EndReason != EndAbandoned || got[1].End != nil || got[1].Duration(t0) != 0 {
+		t.Errorf("b2 = %+v, want abandoned with no known end", got[1])
+	}
+}
+
+func TestCorrelator_WithoutLockIDs(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := NewCorrelator()
+	for _, e := range []*audit.Event{
+		ev(t0, audit.EventAcquire, "build", "", "alice"),
+		ev(t0.Add(time.Minute), audit.EventRenew, "build", "", "alice"),
+		ev(t0.Add(2*time.Minute), audit.EventRelease, "build", "", "alice"),
+		// Never released: the next acquire closes it.
+		ev(t0.Add(3*time.Minute), audit.EventAcquire, "build", "", "bob"),
+		ev(t0.Add(9*time.Minute), audit.EventAcquire, "build", "", "carol"),
+		// A newer holder with a lock ID, released by an older client.
+		ev(t0.Add(10*time.Minute), audit.EventAcquire, "build", "x1", "dave"),
+		ev(t0.Add(12*time.Minute), audit.EventRelease, "build", "", "dave"),
+	} {
+		c.Add(e)
+	}
+
+	got := c.Acquisitions(nil)
+	if len(got) != 4 {
+		t.Fatalf("got %d acquisitions, want 4: %+v", len(got), got)
+	}
+	if a := got[0]; a.Owner != "alice" || a.Renewals != 1 || a.EndReason != EndReleased || a.Duration(t0) != 2*time.Minute {
+		t.Errorf("alice = %+v", a)
+	}
+	if got[1].EndReason != EndAbandoned || got[2].EndReason != EndAbandoned {
+		t.Errorf("bob, carol = %+v, %+v; want both abandoned", got[1], got[2])
+	}
+	if a := got[3]; a.LockID != "x1" || a.EndReason != EndReleased || a.Duration(t0) != 2*time.Minute {
+		t.Errorf("dave = %+v", a)
+	}
+}
@@ -0,0 +1,241 @@
+// Package stats summarizes lock contention from the audit log (lokt stats):
+// per lock, how often it was acquired, denied, broken and frozen, and how
+// long it was held.
+//
+// Hold times come from pairing each acquire event with the event that ended
+// the hold, by lock ID. Holds the holder never released (its process died
+// and the lock was broken as stale, or nothing in the log ends it) are
+// counted as abandoned and left out of the hold times.
+//
+// The same pairing, keeping each acquisition whole, gives one lock's
+// history (lokt history <name>): see Correlator.
+package stats
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// LockStats is the summary for one lock name.
+type LockStats struct {
+	Name         string `json:"name"`
+	Acquisitions int    `json:"acquisitions"`
+	Denials      int    `json:"denials"`
+	ForceBreaks  int    `json:"force_breaks"`
+	Freezes      int    `json:"freezes"`
+	// Released is the number of holds with a known hold time: released by
+	// the holder or force-broken.
+	Released int `json:"released"`
+	// Abandoned is the number of holds never released by their holder.
+	Abandoned int `json:"abandoned"`
+	// Held is the number of holds still in place at the end of the log.
+	Held         int    `json:"held"`
+	AvgHoldMS    int64  `json:"avg_hold_ms,omitempty"`
+	P95HoldMS    int64  `json:"p95_hold_ms,omitempty"`
+	LongestMS    int64  `json:"longest_hold_ms,omitempty"`
+	LongestOwner string `json:"longest_hold_owner,omitempty"`
+
+	holds []time.Duration
+}
+
+// AvgHold returns the average hold time, 0 without released holds.
+func (s *LockStats) AvgHold() time.Duration { return time.Duration(s.AvgHoldMS) * time.Millisecond }
+
+// P95Hold returns the 95th percentile hold time, 0 without released holds.
+func (s *LockStats) P95Hold() time.Duration { return time.Duration(s.P95HoldMS) * time.Millisecond }
+
+// Longest returns the longest hold time, 0 without released holds.
+func (s *LockStats) Longest() time.Duration { return time.Duration(s.LongestMS) * time.Millisecond }
+
+// Report is the result of a stats run.
+type Report struct {
+	Since  *time.Time  `json:"since,omitempty"`
+	Events int         `json:"events"` // audit events read
+	Locks  []LockStats `json:"locks"`
+}
+
+// hold is an acquisition waiting for the event that ends it.
+type hold struct {
+	name  string
+	owner string
+	since time.Time
+}
+
+// Reducer folds a stream of audit events, in log order, into per-lock
+// statistics.
+type Reducer struct {
+	locks map[string]*LockStats
+	open  map[string]hold // by holdKey
+	n     int
+}
+
+// NewReducer returns an empty Reducer.
+func NewReducer() *Reducer {
+	return &Reducer{locks: map[string]*LockStats{}, open: map[string]hold{}}
+}
+
+// holdKey pairs an acquisition with its end: the lock ID, or for events
+// written before lock IDs existed, the name.
+func holdKey(e *audit.Event) string {
+	if e.LockID != "" {
+		return e.LockID
+	}
+	return "name:" + e.Name
+}
+
+func (r *Reducer) lock(name string) *LockStats {
+	s, ok := r.locks[name]
+	if !ok {
+		s = &LockStats{Name: name}
+		r.locks[name] = s
+	}
+	return s
+}
+
+// Add applies one event. Events the summary doesn't use are ignored, as are
+// ends of holds acquired before the events seen (outside --since).
+func (r *Reducer) Add(e *audit.Event) {
+	r.n++
+	switch e.Event {
+	case audit.EventAcquire:
+		r.lock(e.Name).Acquisitions++
+		r.open[holdKey(e)] = hold{name: e.Name, owner: e.Owner, since: e.Timestamp}
+	case audit.EventTakeover:
+		// The previous holder's hold ends abandoned
+		prev := *e
+		prev.LockID, _ = e.Extra["previous_lock_id"].(string)
+		r.end(&prev, false)
+		r.lock(e.Name).Acquisitions++
+		r.open[holdKey(e)] = hold{name: e.Name, owner: e.Owner, since: e.Timestamp}
+	case audit.EventDeny:
+		r.lock(e.Name).Denials++
+	case audit.EventFreeze:
+		r.lock(e.Name).Freezes++
+	case audit.EventRelease:
+		r.end(e, true)
+	case audit.EventForceBreak:
+		r.lock(e.Name).ForceBreaks++
+		r.end(e, true)
+	case audit.EventStaleBreak, audit.EventAutoPrune, audit.EventCorruptBreak:
+		r.end(e, false)
+	}
+}
+
+// end closes the hold e ends. A released hold contributes its hold time;
+// one broken as stale is abandoned.
+func (r *Reducer) end(e *audit.Event, released bool) {
+	key := holdKey(e)
+	h, ok := r.open[key]
+	if !ok {
+		return
+	}
+	delete(r.open, key)
+	s := r.lock(h.name)
+	if !released {
+		s.Abandoned++
+		return
+	}
+	d := e.Timestamp.Sub(h.since)
+	if d < 0 { // clocks of two hosts disagree
+		d = 0
+	}
+	s.Released++
+	s.holds = append(s.holds, d)
+	if d > s.Longest() || s.LongestOwner == "" {
+		s.LongestMS, s.LongestOwner = d.Milliseconds(), h.owner
+	}
+}
+
+// Report finishes the summary, hottest locks first: most denials, then most
+// acquisitions. Holds no event ended are counted as held if held has their
+// lock ID (still in place), abandoned otherwise; held may be nil. The
+// Reducer is spent afterwards.
+func (r *Reducer) Report(held map[string]bool) *Report {
+	for key, h := range r.open {
+		if held[key] {
+			r.lock(h.name).Held++
+		} else {
+			r.lock(h.name).Abandoned++
+		}
+	}
+	r.open = map[string]hold{}
+
+	rep := &Report{Events: r.n, Locks: []LockStats{}}
+	for _, s := range r.locks {
+		if n := len(s.holds); n > 0 {
+			sort.Slice(s.holds, func(i, j int) bool { return s.holds[i] < s.holds[j] })
+			var sum time.Duration
+			for _, d := range s.holds {
+				sum += d
+			}
+			s.AvgHoldMS = (sum / time.Duration(n)).Milliseconds()
+			s.P95HoldMS = s.holds[(n*95+99)/100-1].Milliseconds() // nearest rank
+		}
+		rep.Locks = append(rep.Locks, *s)
+	}
+	sort.Slice(rep.Locks, func(i, j int) bool {
+		a, b := rep.Locks[i], rep.Locks[j]
+		if a.Denials != b.Denials {
+			return a.Denials > b.Denials
+		}
+		if a.Acquisitions != b.Acquisitions {
+			return a.Acquisitions > b.Acquisitions
+		}
+		return a.Name < b.Name
+	})
+	return rep
+}
+
+// Collect reads rootDir's audit log, rotated segments included, from since
+// (zero for all of it) and summarizes it. Holds whose lock is still in
+// place are reported as held rather than abandoned.
+func Collect(rootDir string, since time.Time) (*Report, error) {
+	var events []*audit.Event
+	err := audit.ScanAll(rootDir, since, func(e *audit.Event, _ []byte) bool {
+		if !e.Timestamp.Before(since) {
+			events = append(events, e)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	audit.SortEvents(events)
+
+	r := NewReducer()
+	for _, e := range events {
+		r.Add(e)
+	}
+	rep := r.Report(HeldLockIDs(rootDir))
+	if !since.IsZero() {
+		rep.Since = &since
+	}
+	return rep, nil
+}
+
+// HeldLockIDs returns the lock IDs of the locks and shared holds currently
+// in rootDir.
+func HeldLockIDs(rootDir string) map[string]bool {
+	held := make(map[string]bool)
+	for _, dir := range []string{root.LocksPath(rootDir), filepath.Join(rootDir, root.SharedDir)} {
+		names, _ := root.Names(dir)
+		for _, name := range names {
+			lf, err := lockfile.Read(filepath.Join(dir, filepath.FromSlash(name)+".json"))
+			if err != nil {
+				continue
+			}
+			if lf.LockID != "" {
+				held[lf.LockID] = true
+			} else {
+				held["name:"+lf.Name] = true
+			}
+		}
+	}
+	return held
+}
@@ -0,0 +1,140 @@
+package stats
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+)
+
+func ev(ts time.Time, event, name, lockID, owner string) *audit.Event {
+	return &audit.Event{Timestamp: ts, Event: event, Name: name, LockID: lockID, Owner: owner}
+}
+
+func byName(rep *Report) map[string]LockStats {
+	out := make(map[string]LockStats)
+	for _, s := range rep.Locks {
+		out[s.Name] = s
+	}
+	return out
+}
+
+func TestReducer_HoldTimes(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := NewReducer()
+	// Twenty builds held 1s..20s, released by their holders.
+	for i := 1; i <= 20; i++ {
+		id := "b" + string(rune('a'+i))
+		start := t0.Add(time.Duration(i) * time.Minute)
+		r.Add(ev(start, audit.EventAcquire, "build", id, "alice"))
+		r.Add(ev(start.Add(time.Duration(i)*time.Second), audit.EventRelease, "build", id, "alice"))
+	}
+	r.Add(ev(t0, audit.EventDeny, "build", "", "bob"))
+	r.Add(ev(t0, audit.EventRenew, "build", "bu", "alice")) // ignored
+
+	s := byName(r.Report(nil))["build"]
+	if s.Acquisitions != 20 || s.Released != 20 || s.Denials != 1 || s.Abandoned != 0 {
+		t.Errorf("counts = %+v", s)
+	}
+	if s.AvgHold() != 10500*time.Millisecond {
+		t.Errorf("avg = %v, want 10.5s", s.AvgHold())
+	}
+	if s.P95Hold() != 19*time.Second {
+		t.Errorf("p95 = %v, want 19s", s.P95Hold())
+	}
+	if s.Longest() != 20*time.Second || s.LongestOwner != "alice" {
+		t.Errorf("longest = %v by %q, want 20s by alice", s.Longest(), s.LongestOwner)
+	}
+}
+
+func TestReducer_UnmatchedEvents(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := NewReducer()
+	// A release whose acquire predates the window is ignored.
+	r.Add(ev(t0, audit.EventRelease, "deploy", "before", "alice"))
+	// The holder died; the next acquirer pruned its lock.
+	r.Add(ev(t0, audit.EventAcquire, "deploy", "crashed", "alice"))
+	r.Add(ev(t0.Add(time.Hour), audit.EventAutoPrune, "deploy", "crashed", "bob"))
+	// Force-broken after a minute: a hold with a known end.
+	r.Add(ev(t0.Add(2*time.Hour), audit.EventAcquire, "deploy", "stuck", "carol"))
+	r.Add(ev(t0.Add(2*time.Hour+time.Minute), audit.EventForceBreak, "deploy", "stuck", "ops"))
+	// Never released: one still held, one whose lock is gone.
+	r.Add(ev(t0.Add(3*time.Hour), audit.EventAcquire, "deploy", "live", "dave"))
+	r.Add(ev(t0.Add(3*time.Hour), audit.EventAcquire, "lint", "lost", "erin"))
+	r.Add(ev(t0, audit.EventFreeze, "deploy", "f1", "ops"))
+
+	got := byName(r.Report(map[string]bool{"live": true}))
+	d := got["deploy"]
+	if d.Acquisitions != 3 || d.Released != 1 || d.ForceBreaks != 1 || d.Abandoned != 1 || d.Held != 1 || d.Freezes != 1 {
+		t.Errorf("deploy = %+v", d)
+	}
+	if d.Longest() != time.Minute || d.LongestOwner != "carol" {
+		t.Errorf("deploy longest = %v by %q, want the force-broken hold", d.Longest(), d.LongestOwner)
+	}
+	if l := got["lint"]; l.Abandoned != 1 || l.Released != 0 || l.AvgHoldMS != 0 {
+		t.Errorf("lint = %+v, want one abandoned hold and no hold times", l)
+	}
+}
+
+func TestReducer_SortsHottestFirst(t *testing.T) {
+	t0 := time.Now()
+	r := NewReducer()
+	r.Add(ev(t0, audit.EventAcquire, "quiet", "q", "a"))
+	r.Add(ev(t0, audit.EventAcquire, "busy", "b1", "a"))
+	r.Add(ev(t0, audit.EventAcquire, "busy", "b2", "a"))
+	r.Add(ev(t0, audit.EventDeny, "contended", "", "b"))
+
+	rep := r.Report(nil)
+	var names []string
+	for _, s := range rep.Locks {
+		names = append(names, s.Name)
+	}
+	if len(names) != 3 || names[0] != "contended" || names[1] != "busy" || names[2] != "quiet" {
+		t.Errorf("order = %v, want contended, busy, quiet", names)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	rootDir := t.TempDir()
+	now := time.Now().UTC()
+	var lines []byte
+	for _, e := range []*audit.Event{
+		ev(now.Add(-48*time.Hour), audit.EventAcquire, "old", "o", "alice"),
+		ev(now.Add(-2*time.Hour), audit.EventAcquire, "build", "held", "alice"),
+		ev(now.Add(-time.Hour), audit.EventAcquire, "test", "t", "bob"),
+		ev(now.Add(-time.Hour+time.Minute), audit.EventRelease, "test", "t", "bob"),
+	} {
+		data, _ := json.Marshal(e)
+		lines = append(append(lines, data...), '\n')
+	}
+	if err := os.WriteFile(audit.Path(rootDir), lines, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(rootDir, "locks"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(filepath.Join(rootDir, "locks", "build.json"), &lockfile.Lock{
+		Name: "build", LockID: "held", Owner: "alice", AcquiredAt: now.Add(-2 * time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := Collect(rootDir, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	got := byName(rep)
+	if _, ok := got["old"]; ok || rep.Events != 3 {
+		t.Errorf("events before --since were counted: %d events, %+v", rep.Events, rep.Locks)
+	}
+	if b := got["build"]; b.Held != 1 || b.Abandoned != 0 {
+		t.Errorf("build = %+v, want one hold still in place", b)
+	}
+	if s := got["test"]; s.Released != 1 || s.AvgHold() != time.Minute {
+		t.Errorf("test = %+v, want one 1m hold", s)
+	}
+}
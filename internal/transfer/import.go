@@ -0,0 +1,226 @@
+package transfer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// Action is what Import did with one archived lock or freeze.
+type Action string
+
+const (
+	ActionImported  Action = "imported"  // nothing was there
+	ActionReplaced  Action = "replaced"  // an older lock (or, with Force, any) was overwritten
+	ActionUnchanged Action = "unchanged" // the same acquisition is already there
+	ActionConflict  Action = "conflict"  // a newer or unreadable lock is there; left alone
+	ActionSkipped   Action = "skipped"   // the archived file can't be used (see Reason)
+)
+
+// ImportOptions configures Import.
+type ImportOptions struct {
+	// Force replaces existing locks and freezes even when they are newer
+	// than the archived ones.
+	Force bool
+	// DryRun reports what would happen without writing anything.
+	DryRun bool
+	// NoAudit leaves an archived audit log out.
+	NoAudit bool
+}
+
+// Result is the outcome for one archived lock or freeze.
+type Result struct {
+	Name   string `json:"name"`
+	Freeze bool   `json:"freeze,omitempty"`
+	Action Action `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	// Existing is what the destination held before, for replaced and
+	// conflicting entries; nil if it didn't parse.
+	Existing *lockfile.Lock `json:"existing,omitempty"`
+}
+
+// Report is the outcome of Import.
+type Report struct {
+	Manifest *Manifest `json:"manifest"`
+	Results  []Result  `json:"results"`
+	// AuditEvents is the number of audit events imported.
+	AuditEvents int `json:"audit_events,omitempty"`
+	// AuditSkipped says why an archived audit log wasn't imported.
+	AuditSkipped string `json:"audit_skipped,omitempty"`
+}
+
+// Count returns the number of results with action a.
+func (r *Report) Count(a Action) int {
+	n := 0
+	for _, res := range r.Results {
+		if res.Action == a {
+			n++
+		}
+	}
+	return n
+}
+
+// Import unpacks an archive written by Export into rootDir, which is created
+// if missing. Each lock and freeze is written as archived unless the
+// destination already holds a newer one (a conflict; Force replaces it
+// anyway) or the archived file is from a newer lokt or damaged (skipped).
+// The archived audit log starts rootDir's log (audit.Seed); it is skipped if
+// rootDir already has one.
+//
+// The error is for an archive that can't be read at all; problems with
+// single entries are reported in their Result.
+func Import(rootDir string, r io.Reader, opts ImportOptions) (*Report, error) {
+	m, files, err := readArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	rep := &Report{Manifest: m, Results: []Result{}}
+	if !opts.DryRun {
+		if err := root.EnsureDirs(rootDir); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range m.Entries {
+		res := importEntry(rootDir, e, files, opts)
+		rep.Results = append(rep.Results, res)
+	}
+
+	if data, ok := files[auditName]; ok && !opts.NoAudit {
+		switch {
+		case opts.DryRun:
+			rep.AuditEvents = m.AuditEvents
+		default:
+			n, err := audit.Seed(rootDir, data)
+			switch {
+			case errors.Is(err, audit.ErrLogExists):
+				rep.AuditSkipped = "the destination already has an audit log"
+			case err != nil:
+				rep.AuditSkipped = err.Error()
+			}
+			rep.AuditEvents = n
+		}
+	}
+	return rep, nil
+}
+
+// importEntry imports one archived lock or freeze.
+func importEntry(rootDir string, e Entry, files map[string][]byte, opts ImportOptions) Result {
+	res := Result{Name: e.Name, Freeze: e.Freeze}
+	skip := func(format string, args ...any) Result {
+		res.Action, res.Reason = ActionSkipped, fmt.Sprintf(format, args...)
+		return res
+	}
+	if err := lockfile.ValidateName(e.Name); err != nil {
+		return skip("%v", err)
+	}
+	data, ok := files[e.member()]
+	if !ok {
+		return skip("missing from the archive")
+	}
+	lf, err := lockfile.Parse(data)
+	switch {
+	case errors.Is(err, lockfile.ErrUnsupportedVersion):
+		return skip("lockfile version %d is newer than this lokt supports (%d)", e.Version, lockfile.CurrentLockfileVersion)
+	case err != nil:
+		return skip("%v", err)
+	}
+
+	path := e.path(rootDir)
+	res.Action = ActionImported
+	existing, err := lockfile.Read(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		res.Action, res.Reason = ActionConflict, fmt.Sprintf("existing file unreadable: %v", err)
+	case existing.LockID != "" && existing.LockID == lf.LockID && !existing.AcquiredAt.Before(lf.AcquiredAt):
+		res.Action = ActionUnchanged
+		return res
+	case existing.AcquiredAt.After(lf.AcquiredAt):
+		res.Existing = existing
+		res.Action, res.Reason = ActionConflict, fmt.Sprintf("newer %s held by %s@%s", entryKind(e), existing.Owner, existing.Host)
+	default:
+		res.Existing = existing
+		res.Action = ActionReplaced
+	}
+	if res.Action == ActionConflict {
+		if !opts.Force {
+			return res
+		}
+		res.Action, res.Reason = ActionReplaced, "forced: "+res.Reason
+	}
+
+	if opts.DryRun {
+		return res
+	}
+	if err := root.MkdirAll(rootDir, filepath.Dir(path)); err != nil {
+		return skip("%v", err)
+	}
+	if err := lockfile.WriteFileAtomic(path, data, 0); err != nil {
+		return skip("%v", err)
+	}
+	return res
+}
+
+func entryKind(e Entry) string {
+	if e.Freeze {
+		return "freeze"
+	}
+	return "lock"
+}
+
+// readArchive reads an archive written by Export: its manifest, which must
+// come first, and every member by name.
+func readArchive(r io.Reader) (*Manifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrUnsupportedFormat, err)
+	}
+	defer func() { _ = gz.Close() }()
+	tr := tar.NewReader(gz)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, nil, fmt.Errorf("%w: no %s", ErrUnsupportedFormat, manifestName)
+	}
+	var m Manifest
+	if err := json.NewDecoder(io.LimitReader(tr, maxEntrySize)).Decode(&m); err != nil {
+		return nil, nil, fmt.Errorf("%w: bad %s: %w", ErrUnsupportedFormat, manifestName, err)
+	}
+	if m.FormatVersion < 1 || m.FormatVersion > FormatVersion {
+		return nil, nil, fmt.Errorf("%w: format version %d (this lokt reads up to %d); upgrade lokt",
+			ErrUnsupportedFormat, m.FormatVersion, FormatVersion)
+	}
+
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		src := io.Reader(tr)
+		if hdr.Name != auditName {
+			src = io.LimitReader(tr, maxEntrySize)
+		}
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read archive: %s: %w", hdr.Name, err)
+		}
+		files[hdr.Name] = data
+	}
+	return &m, files, nil
+}
@@ -0,0 +1,189 @@
+// Package transfer moves a lock root's state to another root through an
+// archive: Export packs the locks, freezes and optionally the audit log into
+// a tar.gz with a manifest, and Import unpacks it (lokt export, lokt import).
+//
+// Lock files travel byte for byte: ownership, lock IDs and timestamps are
+// never rewritten. Shared holds (shared/) and per-name waiter state are not
+// carried over.
+package transfer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// FormatVersion is the archive format this lokt writes and the newest it
+// reads.
+const FormatVersion = 1
+
+const (
+	manifestName = "manifest.json"
+	auditName    = "audit.log"
+
+	// maxEntrySize bounds a lock or freeze file read from an archive. Lock
+	// files are well under 4KB; the audit log has no bound.
+	maxEntrySize = 1 << 20
+)
+
+// ErrUnsupportedFormat is returned by Import for an archive written by a
+// newer lokt, or one that isn't a lokt export at all.
+var ErrUnsupportedFormat = errors.New("unsupported archive format")
+
+// Manifest describes an archive. It is the archive's first member.
+type Manifest struct {
+	FormatVersion int `json:"format_version"`
+	// LockfileVersion is the newest lock file version the exporter wrote.
+	LockfileVersion int       `json:"lockfile_version"`
+	LoktVersion     string    `json:"lokt_version,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	Host            string    `json:"host"` // where the export ran
+	Root            string    `json:"root"` // the exported root
+	Entries         []Entry   `json:"entries"`
+	// AuditEvents is the number of audit events archived; 0 without them.
+	AuditEvents int `json:"audit_events,omitempty"`
+}
+
+// Entry is one lock or freeze in an archive.
+type Entry struct {
+	Name    string `json:"name"`
+	Freeze  bool   `json:"freeze,omitempty"`
+	Version int    `json:"version"` // the lock file's own version
+	Owner   string `json:"owner"`
+	Host    string `json:"host"`
+}
+
+// member returns the entry's path inside the archive, the same as its path
+// under a root.
+func (e Entry) member() string {
+	dir := root.LocksDir
+	if e.Freeze {
+		dir = root.FreezesDir
+	}
+	return dir + "/" + e.Name + ".json"
+}
+
+// path returns the entry's file under rootDir.
+func (e Entry) path(rootDir string) string {
+	if e.Freeze {
+		return root.FreezeFilePath(rootDir, e.Name)
+	}
+	return root.LockFilePath(rootDir, e.Name)
+}
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// Audit includes the whole audit log, rotated segments too, as one
+	// audit.log member.
+	Audit bool
+	// LoktVersion is recorded in the manifest.
+	LoktVersion string
+}
+
+// Export writes the locks and freezes of rootDir to w as a tar.gz archive,
+// manifest first. Files that aren't lock JSON are left out, each with a
+// warning; files from a newer lokt are included (Import skips them where
+// they can't be read). It returns the manifest written and the warnings.
+func Export(w io.Writer, rootDir string, opts ExportOptions) (*Manifest, []string, error) {
+	host, _ := os.Hostname()
+	m := &Manifest{
+		FormatVersion:   FormatVersion,
+		LockfileVersion: lockfile.CurrentLockfileVersion,
+		LoktVersion:     opts.LoktVersion,
+		CreatedAt:       time.Now().UTC(),
+		Host:            host,
+		Root:            rootDir,
+		Entries:         []Entry{},
+	}
+	var warnings []string
+	files := make(map[string][]byte)
+	for _, freeze := range []bool{false, true} {
+		names, err := root.LockNames(rootDir)
+		if freeze {
+			names, err = root.Names(root.FreezesPath(rootDir))
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return nil, warnings, err
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			e := Entry{Name: name, Freeze: freeze}
+			data, err := os.ReadFile(e.path(rootDir))
+			if err != nil {
+				if !os.IsNotExist(err) { // not released meanwhile
+					warnings = append(warnings, fmt.Sprintf("%s: %v", e.member(), err))
+				}
+				continue
+			}
+			// Decode without lockfile.Parse's version check: a newer file
+			// still belongs in the archive.
+			var lf lockfile.Lock
+			if err := json.Unmarshal(data, &lf); err != nil {
+				warnings = append(warnings, fmt.Sprintf("%s: not lock JSON, left out", e.member()))
+				continue
+			}
+			e.Version, e.Owner, e.Host = lf.Version, lf.Owner, lf.Host
+			m.Entries = append(m.Entries, e)
+			files[e.member()] = data
+		}
+	}
+
+	var auditLog bytes.Buffer
+	if opts.Audit {
+		err := audit.ScanAll(rootDir, time.Time{}, func(_ *audit.Event, line []byte) bool {
+			auditLog.Write(line)
+			auditLog.WriteByte('\n')
+			m.AuditEvents++
+			return true
+		})
+		if err != nil {
+			return nil, warnings, fmt.Errorf("read audit log: %w", err)
+		}
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, warnings, err
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: m.CreatedAt, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := add(manifestName, append(manifest, '\n')); err != nil {
+		return nil, warnings, err
+	}
+	for _, e := range m.Entries {
+		if err := add(e.member(), files[e.member()]); err != nil {
+			return nil, warnings, err
+		}
+	}
+	if opts.Audit {
+		if err := add(auditName, auditLog.Bytes()); err != nil {
+			return nil, warnings, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, warnings, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, warnings, err
+	}
+	return m, warnings, nil
+}
@@ -0,0 +1,263 @@
+package transfer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+func writeLock(t *testing.T, path string, lf *lockfile.Lock) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := lockfile.Write(path, lf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testLock(name, owner string, acquired time.Time) *lockfile.Lock {
+	return &lockfile.Lock{
+		Version:    lockfile.CurrentLockfileVersion,
+		Name:       name,
+		LockID:     lockfile.GenerateLockID(),
+		Owner:      owner,
+		Host:       "old-host",
+		PID:        4242,
+		AcquiredAt: acquired,
+		TTLSec:     3600,
+	}
+}
+
+func export(t *testing.T, rootDir string, opts ExportOptions) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, warnings, err := Export(&buf, rootDir, opts); err != nil || len(warnings) > 0 {
+		t.Fatalf("Export() warnings %v, err %v", warnings, err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	now := time.Now().Truncate(time.Second)
+	writeLock(t, root.LockFilePath(src, "build"), testLock("build", "alice", now))
+	writeLock(t, root.LockFilePath(src, "team/web/deploy"), testLock("team/web/deploy", "bob", now))
+	writeLock(t, root.FreezeFilePath(src, "release"), testLock("release", "ops", now))
+	aw := audit.NewWriter(src)
+	aw.Emit(&audit.Event{Event: audit.EventAcquire, Name: "build", Owner: "alice", Host: "old-host", PID: 4242})
+	aw.Emit(&audit.Event{Event: audit.EventFreeze, Name: "release", Owner: "ops", Host: "old-host", PID: 4242})
+
+	archive := export(t, src, ExportOptions{Audit: true, LoktVersion: "1.2.3"})
+
+	dst := filepath.Join(t.TempDir(), "new-root")
+	rep, err := Import(dst, bytes.NewReader(archive), ImportOptions{})
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if rep.Manifest.LoktVersion != "1.2.3" || rep.Manifest.Root != src || rep.Manifest.AuditEvents != 2 {
+		t.Errorf("manifest = %+v", rep.Manifest)
+	}
+	if got := rep.Count(ActionImported); got != 3 {
+		t.Errorf("imported = %d, want 3 (results %+v)", got, rep.Results)
+	}
+
+	// Files arrive byte for byte: ownership is never rewritten.
+	for _, rel := range []string{"locks/build.json", "locks/team/web/deploy.json", "freezes/release.json"} {
+		want, err := os.ReadFile(filepath.Join(src, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dst, rel))
+		if err != nil {
+			t.Fatalf("%s not imported: %v", rel, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s differs after import", rel)
+		}
+	}
+
+	if rep.AuditEvents != 2 || rep.AuditSkipped != "" {
+		t.Errorf("audit events = %d (skipped %q), want 2", rep.AuditEvents, rep.AuditSkipped)
+	}
+	if got := audit.MaxSeq(audit.Path(dst)); got != 2 {
+		t.Errorf("imported audit log max seq = %d, want 2", got)
+	}
+
+	// Importing the same archive again changes nothing, and the audit log,
+	// now present, is left alone.
+	rep, err = Import(dst, bytes.NewReader(archive), ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rep.Count(ActionUnchanged); got != 3 {
+		t.Errorf("unchanged on re-import = %d, want 3 (results %+v)", got, rep.Results)
+	}
+	if rep.AuditSkipped == "" {
+		t.Error("re-import should skip the audit log")
+	}
+}
+
+func TestImport_NewerExistingConflicts(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	now := time.Now()
+	writeLock(t, root.LockFilePath(src, "newer"), testLock("newer", "alice", now.Add(-time.Hour)))
+	writeLock(t, root.LockFilePath(src, "older"), testLock("older", "alice", now))
+	archive := export(t, src, ExportOptions{})
+
+	newer := testLock("newer", "carol", now)
+	writeLock(t, root.LockFilePath(dst, "newer"), newer)
+	writeLock(t, root.LockFilePath(dst, "older"), testLock("older", "carol", now.Add(-time.Hour)))
+
+	rep, err := Import(dst, bytes.NewReader(archive), ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]Result)
+	for _, r := range rep.Results {
+		byName[r.Name] = r
+	}
+	if r := byName["newer"]; r.Action != ActionConflict || r.Existing == nil || r.Existing.Owner != "carol" {
+		t.Errorf("newer = %+v, want a conflict with carol's lock", r)
+	}
+	if r := byName["older"]; r.Action != ActionReplaced {
+		t.Errorf("older = %+v, want replaced", r)
+	}
+	if lf, _ := lockfile.Read(root.LockFilePath(dst, "newer")); lf == nil || lf.Owner != "carol" {
+		t.Errorf("conflicting lock was overwritten: %+v", lf)
+	}
+
+	rep, err = Import(dst, bytes.NewReader(archive), ImportOptions{Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Count(ActionConflict) != 0 {
+		t.Errorf("--force left conflicts: %+v", rep.Results)
+	}
+	if lf, _ := lockfile.Read(root.LockFilePath(dst, "newer")); lf == nil || lf.Owner != "alice" {
+		t.Errorf("forced import didn't replace the lock: %+v", lf)
+	}
+}
+
+func TestImport_DryRunWritesNothing(t *testing.T) {
+	src := t.TempDir()
+	writeLock(t, root.LockFilePath(src, "build"), testLock("build", "alice", time.Now()))
+	archive := export(t, src, ExportOptions{})
+
+	dst := filepath.Join(t.TempDir(), "new-root")
+	rep, err := Import(dst, bytes.NewReader(archive), ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Count(ActionImported) != 1 {
+		t.Errorf("results = %+v, want one imported", rep.Results)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("dry run created the root: %v", err)
+	}
+}
+
+func TestImport_SkipsUnsupportedVersion(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeLock(t, root.LockFilePath(src, "ok"), testLock("ok", "alice", time.Now()))
+	future := testLock("future", "alice", time.Now())
+	future.Version = lockfile.CurrentLockfileVersion + 1
+	writeLock(t, root.LockFilePath(src, "future"), future)
+	archive := export(t, src, ExportOptions{})
+
+	rep, err := Import(dst, bytes.NewReader(archive), ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rep.Results {
+		want := ActionImported
+		if r.Name == "future" {
+			want = ActionSkipped
+		}
+		if r.Action != want {
+			t.Errorf("%s: action %s (%s), want %s", r.Name, r.Action, r.Reason, want)
+		}
+	}
+	if _, err := os.Stat(root.LockFilePath(dst, "future")); !os.IsNotExist(err) {
+		t.Errorf("unsupported lock was written: %v", err)
+	}
+}
+
+func TestExport_LeavesOutCorrupted(t *testing.T) {
+	src := t.TempDir()
+	writeLock(t, root.LockFilePath(src, "ok"), testLock("ok", "alice", time.Now()))
+	if err := os.WriteFile(root.LockFilePath(src, "bad"), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	m, warnings, err := Export(&bytes.Buffer{}, src, ExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 1 || m.Entries[0].Name != "ok" {
+		t.Errorf("entries = %+v, want only ok", m.Entries)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %v, want one for the corrupted file", warnings)
+	}
+}
+
+// tarGz builds an archive from name, data pairs.
+func tarGz(members ...string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for i := 0; i+1 < len(members); i += 2 {
+		data := []byte(members[i+1])
+		_ = tw.WriteHeader(&tar.Header{Name: members[i], Mode: 0600, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		_, _ = tw.Write(data)
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	return buf.Bytes()
+}
+
+func TestImport_SkipsInvalidName(t *testing.T) {
+	dst := t.TempDir()
+	archive := tarGz(
+		manifestName, `{"format_version": 1, "entries": [{"name": "../escape", "version": 1}]}`,
+		"locks/../escape.json", `{"version": 1, "name": "escape", "owner": "x"}`,
+	)
+	rep, err := Import(dst, bytes.NewReader(archive), ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Results) != 1 || rep.Results[0].Action != ActionSkipped {
+		t.Fatalf("results = %+v, want one skipped", rep.Results)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "escape.json")); !os.IsNotExist(err) {
+		t.Errorf("entry escaped the locks directory: %v", err)
+	}
+}
+
+func TestImport_RejectsBadArchives(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"not gzip", []byte("plain text")},
+		{"no manifest", tarGz("locks/x.json", "{}")},
+		{"newer format", tarGz(manifestName, `{"format_version": 99}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Import(t.TempDir(), bytes.NewReader(tt.archive), ImportOptions{})
+			if !errors.Is(err, ErrUnsupportedFormat) {
+				t.Errorf("Import() error = %v, want ErrUnsupportedFormat", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,480 @@
+// Package lokt is the Go API for lokt locks, for programs that want to
+// acquire, release and inspect locks without running the lokt CLI.
+//
+// A Client works on one lock root, with the same on-disk format, audit log,
+// config.json settings (retry hints, adaptive backoff, exclusion groups,
+// webhooks) and identity (LOKT_OWNER, LOKT_AGENT_ID) as the CLI, so locks
+// taken through it are visible to and contend with lokt commands:
+//
+//	c, err := lokt.Find()
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Wait()
+//	if err := c.Acquire(ctx, "deploy", lokt.AcquireOptions{TTL: 10 * time.Minute, Wait: true}); err != nil {
+//		var held *lokt.HeldError
+//		if errors.As(err, &held) {
+//			log.Printf("deploy busy: %v", held)
+//		}
+//		return err
+//	}
+//	defer c.Release("deploy", lokt.ReleaseOptions{})
+//
+// Errors are the typed errors below; match them with errors.As or errors.Is.
+package lokt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nikolasavic/lokt/internal/audit"
+	"github.com/nikolasavic/lokt/internal/config"
+	"github.com/nikolasavic/lokt/internal/identity"
+	"github.com/nikolasavic/lokt/internal/lock"
+	"github.com/nikolasavic/lokt/internal/lockfile"
+	"github.com/nikolasavic/lokt/internal/notify"
+	"github.com/nikolasavic/lokt/internal/root"
+)
+
+// Lock is a lock or freeze file as stored in the root.
+type Lock = lockfile.Lock
+
+// Identity is who a lock is acquired as.
+type Identity = identity.Identity
+
+// Typed errors. Each unwraps to the matching sentinel below.
+type (
+	// HeldError: the lock is held by another owner.
+	HeldError = lock.HeldError
+	// ConflictError: another member of the lock's exclusion group is held.
+	// It unwraps to that member's HeldError.
+	ConflictError = lock.ConflictError
+	// FrozenError: the name is frozen.
+	FrozenError = lock.FrozenError
+	// ReservedError: the name is reserved for another owner in a window
+	// the hold would overlap. It also unwraps to a HeldError for that
+	// owner.
+	ReservedError = lock.ReservedError
+	// NotOwnerError: releasing or unfreezing someone else's lock.
+	NotOwnerError = lock.NotOwnerError
+	// NotStaleError: ReleaseOptions.BreakStale on a lock that isn't stale.
+	NotStaleError = lock.NotStaleError
+	// DeadlockError: waiting would never end, because the holder waits,
+	// directly or through others, for a lock this owner holds.
+	DeadlockError = lock.DeadlockError
+	// WaitEdge is one step of a DeadlockError's cycle.
+	WaitEdge = lock.WaitEdge
+	// PolicyError: the TTL breaks the name's rule in policy.json.
+	PolicyError = lock.PolicyError
+	// WaitError: AcquireOptions.Wait ran out of time. It unwraps to
+	// ctx.Err() and counts the attempts made.
+	WaitError = lock.WaitError
+)
+
+// Sentinel errors.
+var (
+	ErrLockHeld   = lock.ErrLockHeld
+	ErrFrozen     = lock.ErrFrozen
+	ErrNotFound   = lock.ErrNotFound
+	ErrNotOwner   = lock.ErrNotOwner
+	ErrNotStale   = lock.ErrNotStale
+	ErrLockStolen = lock.ErrLockStolen
+	ErrDeadlock   = lock.ErrDeadlock
+	ErrPolicy     = lock.ErrPolicy
+	ErrReserved   = lock.ErrReserved
+)
+
+// NameForPath returns the canonical lock name for the file at path:
+// "path/<base>-<hash>", with the hash taken from the cleaned absolute path,
+// so every program locking a per-file artifact agrees on its name.
+func NameForPath(path string) (string, error) {
+	return lock.NameForPath(path)
+}
+
+// Client performs lock operations on one lock root. It is safe for
+// concurrent use.
+type Client struct {
+	rootDir   string
+	cfg       *config.Config
+	cfgErr    error
+	auditor   *audit.Writer
+	notifiers *notify.Dispatcher
+	hook      *notify.Hook
+}
+
+// New returns a client for the lock root at rootDir. Settings are read from
+// <rootDir>/config.json once; a config that can't be loaded is ignored, as
+// the CLI does, and reported by ConfigError.
+func New(rootDir string) *Client {
+	c := &Client{rootDir: rootDir, auditor: audit.NewWriter(rootDir)}
+	c.cfg, c.cfgErr = config.Load(rootDir)
+	if c.cfgErr != nil {
+		c.cfg = &config.Config{}
+		return c
+	}
+	c.auditor.SetRotation(audit.RotatePolicy{
+		MaxSize:  int64(c.cfg.Audit.MaxSize),
+		MaxAge:   time.Duration(c.cfg.Audit.MaxAge),
+		Keep:     c.cfg.Audit.Keep,
+		Compress: c.cfg.Audit.Compress,
+	})
+	if d := notify.New(rootDir, c.cfg); d != nil {
+		c.notifiers = d
+		c.auditor.OnEmit(d.Notify)
+	}
+	if h := notify.NewHook(rootDir, c.cfg); h != nil {
+		c.hook = h
+		c.auditor.OnEmit(h.Run)
+	}
+	return c
+}
+
+// Find returns a client for the lock root the CLI would use from the
+// current directory: $LOKT_ROOT, else .lokt/ in the git common dir, else
+// .lokt/ in the working directory.
+func Find() (*Client, error) {
+	dir, err := root.Find()
+	if err != nil {
+		return nil, err
+	}
+	return New(dir), nil
+}
+
+// Root returns the lock root directory.
+func (c *Client) Root() string {
+	return c.rootDir
+}
+
+// ConfigError returns the error loading config.json, if any.
+func (c *Client) ConfigError() error {
+	return c.cfgErr
+}
+
+// Identity returns the identity locks are acquired as.
+func (c *Client) Identity() Identity {
+	return identity.Current()
+}
+
+// Wait blocks until webhooks and event hook runs triggered by this client's
+// operations have finished or timed out. Call it before the program exits.
+func (c *Client) Wait() {
+	if c.notifiers != nil {
+		c.notifiers.Wait()
+	}
+	if c.hook != nil {
+		c.hook.Wait()
+	}
+}
+
+// RetryAfterDefault is the retry hint for denials by holders without a TTL:
+// retry_after_default from config.json, or lokt's built-in default.
+func (c *Client) RetryAfterDefault() time.Duration {
+	if d := time.Duration(c.cfg.RetryAfterDefault); d > 0 {
+		return d
+	}
+	return lock.DefaultRetryAfter
+}
+
+// AcquireOptions configures Acquire.
+type AcquireOptions struct {
+	// TTL after which the lock may be reclaimed; zero means no expiry.
+	TTL time.Duration
+	// Wait polls until the lock is free or ctx is done, instead of failing
+	// with a HeldError right away.
+	Wait bool
+	// NoAdaptive keeps polling fast even when many processes wait for the
+	// same lock. Also off when adaptive_backoff is false in config.json.
+	NoAdaptive bool
+	// OnWait, if set, is called once when Wait starts waiting, with the
+	// denial that caused it.
+	OnWait func(denied *HeldError)
+	// ThawWait is time the caller already spent waiting for a freeze to
+	// lift; it is recorded on the acquire audit event.
+	ThawWait time.Duration
+	// Shared takes a shared (read) hold: any number coexist, but none
+	// while the lock is held exclusively, and vice versa.
+	Shared bool
+	// Message says what the lock is held for; it is shown to those it
+	// blocks. Labels are key=value pairs for tooling. Newlines and other
+	// control characters are replaced and long values cut (see
+	// Lock.Message).
+	Message string
+	Labels  map[string]string
+	// PollMin and PollMax bound the Wait poll interval, which starts at
+	// PollMin and grows by Multiplier after each attempt up to PollMax.
+	// Zero keeps the defaults (50ms, 2s or wait_poll_interval from
+	// config.json, 2); a Multiplier of 1 polls every PollMin.
+	PollMin    time.Duration
+	PollMax    time.Duration
+	Multiplier float64
+	// Jitter scales each interval by a random factor in [1-Jitter,
+	// 1+Jitter] so waiters don't poll in step. Zero keeps the default
+	// 0.25; negative disables it.
+	Jitter float64
+	// Path records, in the lock file, the file a name from NameForPath
+	// stands for.
+	Path string
+	// Session registers the lock in that session (as LOKT_SESSION does for
+	// the CLI), for lokt session end to release; ignored for shared holds.
+	Session string
+	// Handoff keeps the lock after this process exits, until the process
+	// given its LockID adopts it (lokt adopt); ignored for shared holds.
+	Handoff bool
+	// RespectFreeze fails with a *FrozenError if name is frozen and, with
+	// Wait, keeps waiting while it is, so a freeze placed meanwhile isn't
+	// defeated the moment the holder releases.
+	RespectFreeze bool
+}
+
+// retryPolicy is the Wait poll schedule for o, capped at wait_poll_interval
+// from config.json unless o says otherwise.
+func (c *Client) retryPolicy(o AcquireOptions) (lock.RetryPolicy, error) {
+	if o.PollMin < 0 || o.PollMax < 0 {
+		return lock.RetryPolicy{}, errors.New("PollMin and PollMax must not be negative")
+	}
+	if o.PollMin > 0 && o.PollMax > 0 && o.PollMin > o.PollMax {
+		return lock.RetryPolicy{}, fmt.Errorf("PollMin %s exceeds PollMax %s", o.PollMin, o.PollMax)
+	}
+	p := lock.DefaultRetryPolicy
+	if d := time.Duration(c.cfg.WaitPollInterval); d > 0 {
+		p.Max = d
+		p.Base = min(p.Base, p.Max)
+	}
+	if o.PollMax > 0 {
+		p.Max = o.PollMax
+		p.Base = min(p.Base, p.Max)
+	}
+	if o.PollMin > 0 {
+		p.Base = o.PollMin
+		p.Max = max(p.Max, p.Base)
+	}
+	p.Multiplier = o.Multiplier
+	switch {
+	case o.Jitter < 0:
+		p.Spread = 0
+	case o.Jitter > 0:
+		p.Spread = min(o.Jitter, 1)
+	}
+	return p, nil
+}
+
+// Acquire takes the lock name. Acquiring a lock already held under the same
+// owner refreshes it. Without opts.Wait, a held lock fails immediately with
+// a *HeldError (or *ConflictError); with it, Acquire returns a *WaitError if
+// ctx ends first, or a *DeadlockError if the wait could never end. Freezes
+// are not checked unless opts.RespectFreeze; use CheckFreeze or Check for
+// that.
+func (c *Client) Acquire(ctx context.Context, name string, opts AcquireOptions) error {
+	retry, err := c.retryPolicy(opts)
+	if err != nil {
+		return err
+	}
+	lo := lock.AcquireOptions{
+		TTL:               opts.TTL,
+		Auditor:           c.auditor,
+		ThawWait:          opts.ThawWait,
+		RetryAfterDefault: time.Duration(c.cfg.RetryAfterDefault),
+		NoAdaptive:        opts.NoAdaptive || !c.cfg.AdaptiveBackoffEnabled(),
+		OnWait:            opts.OnWait,
+		ExclusionGroups:   c.cfg.ExclusionGroups,
+		Shared:            opts.Shared,
+		Retry:             retry,
+		Message:           opts.Message,
+		Labels:            opts.Labels,
+		SkewGrace:         c.cfg.EffectiveSkewGrace(),
+		Path:              opts.Path,
+		Session:           opts.Session,
+		Handoff:           opts.Handoff,
+		RespectFreeze:     opts.RespectFreeze,
+	}
+	if opts.Wait {
+		return lock.AcquireWithWait(ctx, c.rootDir, name, lo)
+	}
+	return lock.Acquire(c.rootDir, name, lo)
+}
+
+// ReleaseOptions configures Release.
+type ReleaseOptions struct {
+	Force      bool // remove without the ownership check (break-glass)
+	BreakStale bool // remove only if stale (expired TTL or dead holder)
+}
+
+// Release removes the lock name, or this owner's shared hold on it. It
+// returns ErrNotFound if there is no such lock, a *NotOwnerError if another
+// owner holds it (unless Force or BreakStale), and a *NotStaleError for
+// BreakStale on a live lock.
+func (c *Client) Release(name string, opts ReleaseOptions) error {
+	return lock.Release(c.rootDir, name, lock.ReleaseOptions{
+		Force:      opts.Force,
+		BreakStale: opts.BreakStale,
+		Auditor:    c.auditor,
+	})
+}
+
+// ReleaseByOwner removes every lock held by owner and returns their names.
+func (c *Client) ReleaseByOwner(owner string) ([]string, error) {
+	return lock.ReleaseByOwner(c.rootDir, owner, lock.ReleaseOptions{Auditor: c.auditor})
+}
+
+// Renew restarts the TTL of a lock held by this identity, or of this
+// process's shared hold if name isn't held exclusively. It returns
+// ErrLockStolen if another owner holds it now.
+func (c *Client) Renew(name string) error {
+	return c.RenewWith(name, RenewOptions{})
+}
+
+// RenewOptions configures RenewWith.
+type RenewOptions struct {
+	// TTL, if positive, replaces the lock's TTL instead of restarting it.
+	TTL time.Duration
+	// AnyProcess renews a lock this owner took from another process, as
+	// lokt renew after lokt lock does. Another owner's lock is then a
+	// *NotOwnerError rather than ErrLockStolen.
+	AnyProcess bool
+	// Force renews, and signs, a lock file that is unsigned or badly
+	// signed while signing is on; the owner is checked all the same.
+	Force bool
+}
+
+// RenewWith is Renew with options.
+func (c *Client) RenewWith(name string, opts RenewOptions) error {
+	lo := lock.RenewOptions{Auditor: c.auditor, TTL: opts.TTL, AnyProcess: opts.AnyProcess, Force: opts.Force}
+	err := lock.Renew(c.rootDir, name, lo)
+	if errors.Is(err, os.ErrNotExist) {
+		lo.Shared = true
+		return lock.Renew(c.rootDir, name, lo)
+	}
+	return err
+}
+
+// GlobalFreeze is the name to Freeze and Unfreeze to block every name at
+// once.
+const GlobalFreeze = lock.GlobalFreeze
+
+// Freeze blocks guard commands for name (every name, for GlobalFreeze) for
+// ttl, which must be positive.
+// It returns a *HeldError if someone else's freeze is active.
+func (c *Client) Freeze(name string, ttl time.Duration) error {
+	return c.FreezeWith(name, FreezeOptions{TTL: ttl})
+}
+
+// FreezeOptions configures FreezeWith. One of TTL and Until is required.
+type FreezeOptions struct {
+	TTL time.Duration
+	// Until is when the freeze ends, instead of a TTL; it must be in the
+	// future.
+	Until time.Time
+	// Reason says why the name is frozen; it is stored as the freeze's
+	// Message and shown in FrozenError and the freeze audit event.
+	Reason string
+}
+
+// FreezeWith is Freeze with an end time or a reason.
+func (c *Client) FreezeWith(name string, opts FreezeOptions) error {
+	return lock.Freeze(c.rootDir, name, lock.FreezeOptions{
+		TTL:     opts.TTL,
+		Until:   opts.Until,
+		Reason:  opts.Reason,
+		Auditor: c.auditor,
+	})
+}
+
+// FreezeMatch freezes every name pattern matches, as FreezeWith freezes
+// one, including names first locked after it. The pattern uses path.Match
+// syntax, where * doesn't match /, and must have a wildcard.
+func (c *Client) FreezeMatch(pattern string, opts FreezeOptions) error {
+	return lock.FreezeMatch(c.rootDir, pattern, lock.FreezeOptions{
+		TTL:     opts.TTL,
+		Until:   opts.Until,
+		Reason:  opts.Reason,
+		Auditor: c.auditor,
+	})
+}
+
+// UnfreezeMatch removes the freeze FreezeMatch placed on pattern, as
+// Unfreeze removes one by name.
+func (c *Client) UnfreezeMatch(pattern string, force bool) error {
+	return lock.UnfreezeMatch(c.rootDir, pattern, lock.UnfreezeOptions{Force: force, Auditor: c.auditor})
+}
+
+// Unfreeze removes a freeze early. It returns ErrNotFound if name isn't
+// frozen and a *NotOwnerError for someone else's freeze unless force.
+func (c *Client) Unfreeze(name string, force bool) error {
+	return lock.Unfreeze(c.rootDir, name, lock.UnfreezeOptions{Force: force, Auditor: c.auditor})
+}
+
+// CheckFreeze returns a *FrozenError if name is frozen, by its own freeze,
+// a global one or a pattern freeze matching it, or nil.
+func (c *Client) CheckFreeze(name string) error {
+	return lock.CheckFreeze(c.rootDir, name, nil)
+}
+
+// Check reports whether Acquire would succeed right now without acquiring:
+// nil, a *FrozenError, a *ConflictError or a *HeldError. Read-only.
+func (c *Client) Check(name string) error {
+	return lock.Check(c.rootDir, name, time.Duration(c.cfg.RetryAfterDefault), c.cfg.ExclusionGroups)
+}
+
+// Status returns the lock file for name, or ErrNotFound.
+func (c *Client) Status(name string) (*Lock, error) {
+	if err := lockfile.ValidateName(name); err != nil {
+		return nil, err
+	}
+	dir, err := root.Follow(c.rootDir)
+	if err != nil {
+		return nil, err
+	}
+	lf, err := lockfile.Read(root.LockFilePath(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return lf, err
+}
+
+// SharedHolders returns the holders of name in shared mode, oldest first,
+// stale ones included.
+func (c *Client) SharedHolders(name string) ([]*Lock, error) {
+	dir, err := root.Follow(c.rootDir)
+	if err != nil {
+		return nil, err
+	}
+	return lock.SharedHolders(dir, name), nil
+}
+
+// Locks returns every readable exclusive lock in the root, sorted by name.
+func (c *Client) Locks() ([]*Lock, error) {
+	return c.list(root.LocksPath)
+}
+
+// Freezes returns every readable freeze in the root, sorted by name,
+// including expired ones. A pattern freeze has Pattern set and its pattern
+// as Name.
+func (c *Client) Freezes() ([]*Lock, error) {
+	return c.list(root.FreezesPath)
+}
+
+func (c *Client) list(dirOf func(string) string) ([]*Lock, error) {
+	dir, err := root.Follow(c.rootDir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := root.Names(dirOf(dir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var out []*Lock
+	for _, name := range names {
+		lf, err := lockfile.Read(filepath.Join(dirOf(dir), filepath.FromSlash(name)+".json"))
+		if err != nil {
+			continue // being written, corrupted, or removed meanwhile
+		}
+		out = append(out, lf)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
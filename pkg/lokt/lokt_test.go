@@ -0,0 +1,226 @@
+package lokt_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nikolasavic/lokt/pkg/lokt"
+)
+
+// as runs fn under owner, restoring LOKT_OWNER for the rest of the test.
+func as(t *testing.T, owner string, fn func()) {
+	t.Helper()
+	prev := os.Getenv("LOKT_OWNER")
+	os.Setenv("LOKT_OWNER", owner)
+	defer os.Setenv("LOKT_OWNER", prev)
+	fn()
+}
+
+func newClient(t *testing.T) *lokt.Client {
+	t.Helper()
+	t.Setenv("LOKT_OWNER", "me")
+	c := lokt.New(t.TempDir())
+	t.Cleanup(c.Wait)
+	return c
+}
+
+func TestClient_AcquireRelease(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+
+	if err := c.Acquire(ctx, "build", lokt.AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	lf, err := c.Status("build")
+	if err != nil || lf.Owner != "me" || lf.TTLSec != 60 {
+		t.Fatalf("Status() = %+v, %v", lf, err)
+	}
+
+	as(t, "other", func() {
+		err := c.Acquire(ctx, "build", lokt.AcquireOptions{})
+		var held *lokt.HeldError
+		if !errors.As(err, &held) || held.Lock.Owner != "me" || !errors.Is(err, lokt.ErrLockHeld) {
+			t.Errorf("Acquire(held) error = %v, want *HeldError", err)
+		}
+		err = c.Release("build", lokt.ReleaseOptions{})
+		var notOwner *lokt.NotOwnerError
+		if !errors.As(err, &notOwner) {
+			t.Errorf("Release(other's) error = %v, want *NotOwnerError", err)
+		}
+		if err := c.Check("build"); !errors.Is(err, lokt.ErrLockHeld) {
+			t.Errorf("Check(held) = %v, want ErrLockHeld", err)
+		}
+	})
+
+	if err := c.Renew("build"); err != nil {
+		t.Errorf("Renew() error = %v", err)
+	}
+	if locks, err := c.Locks(); err != nil || len(locks) != 1 || locks[0].Name != "build" {
+		t.Errorf("Locks() = %v, %v", locks, err)
+	}
+	if err := c.Release("build", lokt.ReleaseOptions{}); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := c.Status("build"); !errors.Is(err, lokt.ErrNotFound) {
+		t.Errorf("Status(released) error = %v, want ErrNotFound", err)
+	}
+	if err := c.Release("build", lokt.ReleaseOptions{}); !errors.Is(err, lokt.ErrNotFound) {
+		t.Errorf("Release(released) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClient_AcquireWait(t *testing.T) {
+	c := newClient(t)
+	as(t, "other", func() {
+		if err := c.Acquire(context.Background(), "deploy", lokt.AcquireOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var waited *lokt.HeldError
+	err := c.Acquire(ctx, "deploy", lokt.AcquireOptions{Wait: true, OnWait: func(h *lokt.HeldError) { waited = h }})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire(wait) error = %v, want deadline exceeded", err)
+	}
+	if waited == nil || waited.Lock.Owner != "other" {
+		t.Errorf("OnWait got %v, want other's lock", waited)
+	}
+}
+
+func TestClient_AcquirePollOptions(t *testing.T) {
+	c := newClient(t)
+	as(t, "other", func() {
+		if err := c.Acquire(context.Background(), "deploy", lokt.AcquireOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if err := c.Acquire(context.Background(), "deploy", lokt.AcquireOptions{Wait: true, PollMin: time.Second, PollMax: time.Millisecond}); err == nil {
+		t.Error("Acquire(PollMin > PollMax) succeeded, want an error")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err := c.Acquire(ctx, "deploy", lokt.AcquireOptions{Wait: true, PollMin: 5 * time.Millisecond, Multiplier: 1, Jitter: -1})
+	var waitErr *lokt.WaitError
+	if !errors.As(err, &waitErr) || waitErr.Attempts < 10 {
+		t.Errorf("Acquire(5ms constant poll) error = %v, want a WaitError after many attempts", err)
+	}
+}
+
+func TestClient_RenewWithAndRespectFreeze(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+	if err := c.Acquire(ctx, "build", lokt.AcquireOptions{TTL: time.Minute}); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if err := c.RenewWith("build", lokt.RenewOptions{TTL: time.Hour, AnyProcess: true}); err != nil {
+		t.Fatalf("RenewWith() error = %v", err)
+	}
+	if lf, err := c.Status("build"); err != nil || lf.TTLSec != 3600 {
+		t.Errorf("Status() after RenewWith(TTL) = %+v, %v; want a 1h TTL", lf, err)
+	}
+	as(t, "other", func() {
+		var notOwner *lokt.NotOwnerError
+		if err := c.RenewWith("build", lokt.RenewOptions{AnyProcess: true}); !errors.As(err, &notOwner) {
+			t.Errorf("RenewWith(other's, AnyProcess) error = %v, want *NotOwnerError", err)
+		}
+	})
+
+	if err := c.Freeze("deploy", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Acquire(ctx, "deploy", lokt.AcquireOptions{RespectFreeze: true}); !errors.Is(err, lokt.ErrFrozen) {
+		t.Errorf("Acquire(frozen, RespectFreeze) error = %v, want ErrFrozen", err)
+	}
+	if err := c.Acquire(ctx, "deploy", lokt.AcquireOptions{}); err != nil {
+		t.Errorf("Acquire(frozen) error = %v, want the freeze ignored", err)
+	}
+}
+
+func TestClient_Freeze(t *testing.T) {
+	c := newClient(t)
+	if err := c.Freeze("deploy", time.Minute); err != nil {
+		t.Fatalf("Freeze() error = %v", err)
+	}
+	var frozen *lokt.FrozenError
+	if err := c.CheckFreeze("deploy"); !errors.As(err, &frozen) {
+		t.Errorf("CheckFreeze() = %v, want *FrozenError", err)
+	}
+	if err := c.Check("deploy"); !errors.Is(err, lokt.ErrFrozen) {
+		t.Errorf("Check(frozen) = %v, want ErrFrozen", err)
+	}
+	if freezes, err := c.Freezes(); err != nil || len(freezes) != 1 {
+		t.Errorf("Freezes() = %v, %v", freezes, err)
+	}
+	if err := c.Unfreeze("deploy", false); err != nil {
+		t.Fatalf("Unfreeze() error = %v", err)
+	}
+	if err := c.Unfreeze("deploy", false); !errors.Is(err, lokt.ErrNotFound) {
+		t.Errorf("Unfreeze(again) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClient_Config(t *testing.T) {
+	t.Setenv("LOKT_OWNER", "me")
+	dir := t.TempDir()
+	cfg := `{"retry_after_default": "45s", "exclusion_groups": {"db": ["db-migrate", "db-restore"]}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := lokt.New(dir)
+	if err := c.ConfigError(); err != nil {
+		t.Fatalf("ConfigError() = %v", err)
+	}
+	if got := c.RetryAfterDefault(); got != 45*time.Second {
+		t.Errorf("RetryAfterDefault() = %v, want 45s", got)
+	}
+	as(t, "other", func() {
+		if err := c.Acquire(context.Background(), "db-migrate", lokt.AcquireOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+	var conflict *lokt.ConflictError
+	if err := c.Acquire(context.Background(), "db-restore", lokt.AcquireOptions{}); !errors.As(err, &conflict) || conflict.Group != "db" {
+		t.Errorf("Acquire(group member) = %v, want *ConflictError for db", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if c := lokt.New(dir); c.ConfigError() == nil {
+		t.Error("ConfigError() = nil for a broken config")
+	}
+}
+
+func TestClient_Shared(t *testing.T) {
+	c := newClient(t)
+	ctx := context.Background()
+	if err := c.Acquire(ctx, "reports", lokt.AcquireOptions{Shared: true, TTL: time.Minute}); err != nil {
+		t.Fatalf("Acquire(shared) error = %v", err)
+	}
+	as(t, "other", func() {
+		if err := c.Acquire(ctx, "reports", lokt.AcquireOptions{Shared: true}); err != nil {
+			t.Errorf("second Acquire(shared) error = %v", err)
+		}
+		var held *lokt.HeldError
+		if err := c.Acquire(ctx, "reports", lokt.AcquireOptions{}); !errors.As(err, &held) || held.Shared != 2 {
+			t.Errorf("Acquire(exclusive) error = %v, want *HeldError with 2 shared holders", err)
+		}
+	})
+	if err := c.Renew("reports"); err != nil {
+		t.Errorf("Renew(shared) error = %v", err)
+	}
+	if err := c.Release("reports", lokt.ReleaseOptions{}); err != nil {
+		t.Fatalf("Release(shared) error = %v", err)
+	}
+	if holders, err := c.SharedHolders("reports"); err != nil || len(holders) != 1 || holders[0].Owner != "other" {
+		t.Errorf("SharedHolders() = %v, %v; want only other's", holders, err)
+	}
+}